@@ -0,0 +1,197 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/agent"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func makeAgentCmd() *cobra.Command {
+	var agentCmd = &cobra.Command{
+		Use:   "agent",
+		Short: "Manage the conversations with the Defang agent",
+	}
+	agentCmd.AddCommand(makeAgentSessionsCmd())
+	return agentCmd
+}
+
+func makeAgentSessionsCmd() *cobra.Command {
+	var sessionsCmd = &cobra.Command{
+		Use:     "sessions",
+		Aliases: []string{"session"},
+		Short:   "Manage the saved agent sessions",
+	}
+	sessionsCmd.AddCommand(makeAgentSessionsListCmd())
+	sessionsCmd.AddCommand(makeAgentSessionsShowCmd())
+	sessionsCmd.AddCommand(makeAgentSessionsResumeCmd())
+	sessionsCmd.AddCommand(makeAgentSessionsRemoveCmd())
+	return sessionsCmd
+}
+
+type agentSessionRow struct {
+	ID       string
+	Updated  string
+	Stack    string
+	Messages int
+	Title    string
+}
+
+func makeAgentSessionsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Short:   "List the saved agent sessions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := agent.NewSessionStore().List()
+			if err != nil {
+				return err
+			}
+			if len(sessions) == 0 {
+				term.Info("No agent sessions found")
+				return nil
+			}
+			rows := make([]agentSessionRow, len(sessions))
+			for i, session := range sessions {
+				rows[i] = agentSessionRow{
+					ID:       session.ID,
+					Updated:  session.UpdatedAt.Local().Format(time.DateTime),
+					Stack:    session.Stack.Name,
+					Messages: len(session.Messages),
+					Title:    session.Title(),
+				}
+			}
+			return term.Table(rows, "ID", "Updated", "Stack", "Messages", "Title")
+		},
+	}
+}
+
+func makeAgentSessionsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "show SESSION_ID",
+		Aliases: []string{"get", "describe", "desc"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Show the conversation of a saved agent session",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := agent.NewSessionStore().Load(args[0])
+			if err != nil {
+				return err
+			}
+			term.Printf("Session %s, started %s in %s\n", session.ID, session.CreatedAt.Local().Format(time.DateTime), session.Cwd)
+			if session.Stack.Name != "" {
+				term.Printf("Stack %s (%s, %s)\n", session.Stack.Name, session.Stack.Provider, session.Stack.Region)
+			}
+			term.Println("")
+			printAgentMessages(session.Messages)
+			return nil
+		},
+	}
+}
+
+// printAgentMessages prints the conversation like the agent does while it runs.
+func printAgentMessages(messages []*ai.Message) {
+	for _, msg := range messages {
+		for _, part := range msg.Content {
+			switch {
+			case part.IsText() && msg.Role == ai.RoleUser:
+				term.Printf("> %s\n\n", part.Text)
+			case part.IsText():
+				term.Printf("%s\n\n", strings.TrimSpace(part.Text))
+			case part.IsToolRequest():
+				inputs, _ := json.Marshal(part.ToolRequest.Input)
+				term.Printf("* %s(%s)\n", part.ToolRequest.Name, inputs)
+			case part.IsToolResponse():
+				term.Printf("~ %v\n\n", part.ToolResponse.Output)
+			}
+		}
+	}
+}
+
+func makeAgentSessionsResumeCmd() *cobra.Command {
+	resumeCmd := &cobra.Command{
+		Use:         "resume SESSION_ID",
+		Aliases:     []string{"continue"},
+		Annotations: authNeededAlways,
+		Args:        cobra.ExactArgs(1),
+		Short:       "Continue a saved agent session",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if global.NonInteractive {
+				return errors.New("resuming an agent session requires an interactive terminal")
+			}
+			ctx := cmd.Context()
+			ag, err := agent.New(ctx, global.FabricAddr, &global.Stack, agentOptions(agent.WithSessionStore(agent.NewSessionStore()), agent.WithResume(args[0]))...)
+			if err != nil {
+				return err
+			}
+			return ag.StartWithUserPrompt(ctx, "Welcome back. What would you like to do next?")
+		},
+	}
+	addAgentFlags(resumeCmd.Flags())
+	return resumeCmd
+}
+
+// agentOptions returns the options of the agents started by the commands. The
+// conversation is only saved for interactive sessions in a terminal, not in CI.
+func agentOptions(opts ...agent.Option) []agent.Option {
+	options := []agent.Option{agent.WithAutoApprove(global.AutoApprove), agent.WithRequireValidation(global.RequireValidate)}
+	if global.HasTty && !global.NonInteractive {
+		options = append(options, agent.WithSessionStore(agent.NewSessionStore()))
+	}
+	return append(options, opts...)
+}
+
+// addAgentFlags adds the flags of the agent to a command that runs it.
+func addAgentFlags(flags *pflag.FlagSet) {
+	flags.Var(&global.AutoApprove, "auto-approve", "kinds of files the AI agent may change without confirmation; any of [compose dockerfile]")
+	addRequireValidateFlag(flags)
+}
+
+// addRequireValidateFlag adds the --require-validate flag to a command whose
+// agent or MCP tools can deploy.
+func addRequireValidateFlag(flags *pflag.FlagSet) {
+	flags.BoolVar(&global.RequireValidate, "require-validate", global.RequireValidate, "require the AI agent to validate the compose files before deploying them")
+}
+
+// checkAutoApproveEnv returns an error for an invalid DEFANG_AUTO_APPROVE, which
+// would otherwise silently fall back to confirming every change.
+func checkAutoApproveEnv(cmd *cobra.Command) error {
+	fromEnv, ok := os.LookupEnv("DEFANG_AUTO_APPROVE")
+	if !ok || cmd.Flags().Lookup("auto-approve") == nil || cmd.Flags().Changed("auto-approve") {
+		return nil
+	}
+	var autoApprove agent.AutoApprove
+	if err := autoApprove.Set(fromEnv); err != nil {
+		return fmt.Errorf("invalid DEFANG_AUTO_APPROVE value: %w", err)
+	}
+	return nil
+}
+
+func makeAgentSessionsRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "remove SESSION_ID...",
+		Aliases: []string{"rm", "delete", "del"},
+		Args:    cobra.MinimumNArgs(1),
+		Short:   "Delete saved agent sessions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := agent.NewSessionStore()
+			var errs []error
+			for _, id := range args {
+				if err := store.Remove(id); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				term.Infof("Deleted agent session %s", id)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCheckAutoApproveEnv(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{Use: "test"}
+		addAgentFlags(cmd.Flags())
+		return cmd
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv("DEFANG_AUTO_APPROVE", "compose,dockerfile")
+		if err := checkAutoApproveEnv(newCmd()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("DEFANG_AUTO_APPROVE", "everything")
+		if err := checkAutoApproveEnv(newCmd()); err == nil {
+			t.Fatal("expected an error for an invalid DEFANG_AUTO_APPROVE")
+		}
+	})
+
+	t.Run("overridden by the flag", func(t *testing.T) {
+		t.Setenv("DEFANG_AUTO_APPROVE", "everything")
+		cmd := newCmd()
+		if err := cmd.Flags().Set("auto-approve", "compose"); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkAutoApproveEnv(cmd); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("command without the flag", func(t *testing.T) {
+		t.Setenv("DEFANG_AUTO_APPROVE", "everything")
+		if err := checkAutoApproveEnv(&cobra.Command{Use: "whoami"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
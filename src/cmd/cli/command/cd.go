@@ -235,6 +235,147 @@ var cdInstallCmd = &cobra.Command{
 	},
 }
 
+var cdSetupCICmd = &cobra.Command{
+	Use:         "setup-ci",
+	Args:        cobra.NoArgs,
+	Annotations: authNeededAlways,
+	Short:       "Set up keyless deploys from GitHub Actions for this stack",
+	Long: `Create or verify the cloud resources that let a GitHub Actions workflow deploy
+this stack with an OIDC token instead of long-lived credentials: an IAM OIDC
+provider and role on AWS, a Workload Identity pool and provider on GCP, or a
+managed identity with a federated credential on Azure.
+
+On AWS, the role of the CD stack is used if "defang cd install" created one for
+GitHub Actions. Note that the workflow can start the CD CodeBuild project with
+its own buildspec, so it effectively has the permissions of the CD role.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		repo, _ := cmd.Flags().GetString("repo")
+		branch, _ := cmd.Flags().GetString("branch")
+		environment, _ := cmd.Flags().GetString("environment")
+		teardown, _ := cmd.Flags().GetBool("teardown")
+		if environment != "" {
+			if cmd.Flags().Changed("branch") {
+				return errors.New("--branch and --environment are mutually exclusive")
+			}
+			branch = ""
+		}
+
+		session, err := newCommandSession(cmd)
+		if err != nil {
+			return err
+		}
+
+		projectName, _, err := session.Loader.LoadProjectName(ctx)
+		if err != nil {
+			return err
+		}
+
+		req := client.CIRequest{Project: projectName, Repo: repo, Branch: branch, Environment: environment}
+		return cli.SetUpCI(ctx, session.Provider, req, teardown)
+	},
+}
+
+var cdStateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect and repair the Pulumi state in the CD storage",
+}
+
+// stateProvider returns an authenticated provider for the "cd state"
+// commands, which only access the CD storage and don't run the CD task.
+func stateProvider(cmd *cobra.Command, projectStack string) (client.Provider, string, string, error) {
+	ctx := cmd.Context()
+	providerID := global.Stack.Provider
+	if providerID == client.ProviderDefang || providerID == client.ProviderAuto {
+		return nil, "", "", errors.New("cannot access the CD state with the Defang Playground provider; please specify a different provider with --provider")
+	}
+
+	var projectName, stackName string
+	if projectStack != "" {
+		projectName, stackName = cli.SplitProjectStack(projectStack)
+		if projectName == "" || stackName == "" {
+			return nil, "", "", errors.New("invalid argument: " + projectStack + ", expected format: <project>/<stack>")
+		}
+	}
+	provider := cli.NewProvider(ctx, providerID, global.Client, stackName)
+	if err := authenticateProvider(ctx, provider); err != nil {
+		return nil, "", "", err
+	}
+	return provider, projectName, stackName, nil
+}
+
+var cdStateShowCmd = &cobra.Command{
+	Use:   "show PROJECT/STACK",
+	Args:  cobra.ExactArgs(1),
+	Short: "Show the resources in the state of a stack, grouped by type",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, projectName, stackName, err := stateProvider(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		return cli.CdStateShow(cmd.Context(), provider, projectName, stackName, global.Verbose)
+	},
+}
+
+var cdStatePendingCmd = &cobra.Command{
+	Use:   "pending [PROJECT/STACK]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "List the pending operations of a stack, or of all stacks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var projectStack string
+		if len(args) == 1 {
+			projectStack = args[0]
+		}
+		provider, projectName, stackName, err := stateProvider(cmd, projectStack)
+		if err != nil {
+			return err
+		}
+		return cli.CdStatePending(cmd.Context(), provider, projectName, stackName)
+	},
+}
+
+var cdStateRepairCmd = &cobra.Command{
+	Use:         "repair PROJECT/STACK",
+	Annotations: authNeededAlways,
+	Args:        cobra.ExactArgs(1),
+	Short:       "Clear or import the pending operations of a stack",
+	Long: `Clear the pending operations that a CD task left behind in the state of a
+stack when it was interrupted, so the next deployment can proceed. Resources
+that were being created can be imported instead, with --import=URN=ID. The
+original state is backed up next to the state file first. The repair takes the
+deploy lock, so it fails while a deployment of the stack is running.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imports, _ := cmd.Flags().GetStringToString("import")
+		force, _ := cmd.Flags().GetBool("force")
+		if !force && global.NonInteractive {
+			return errors.New("use --force to repair the state in non-interactive mode")
+		}
+
+		provider, projectName, stackName, err := stateProvider(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		return cli.CdStateRepair(cmd.Context(), provider, projectName, stackName, imports, force)
+	},
+}
+
+var cdUnlockCmd = &cobra.Command{
+	Use:         "unlock PROJECT/STACK",
+	Annotations: authNeededAlways,
+	Args:        cobra.ExactArgs(1),
+	Short:       "Remove a stale deploy lock of a stack",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		provider, projectName, stackName, err := stateProvider(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		return cli.DeployUnlock(cmd.Context(), provider, projectName, stackName, force)
+	},
+}
+
 var cdCloudformationCmd = &cobra.Command{
 	Use:         "cloudformation",
 	Short:       "CloudFormation template related commands",
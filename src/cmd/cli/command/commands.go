@@ -68,6 +68,14 @@ func Execute(ctx context.Context) error {
 			printDefangHint("To manage sensitive service config, use:", "config")
 		}
 
+		if lockErr := new(cli.ErrDeployLocked); errors.As(err, lockErr) {
+			printDefangHint("To wait for the other deployment, use --lock-timeout. If its lock is stale, remove it with:", "cd unlock --force "+lockErr.ProjectName+"/"+lockErr.StackName)
+		}
+
+		if drift := new(cli.ErrPlanDrift); errors.As(err, drift) {
+			printDefangHint("To review the changes, make a new plan with:", "compose up --dry-run --plan-out=plan.json")
+		}
+
 		if cerr := new(cli.CancelError); errors.As(err, &cerr) {
 			printDefangHint("Detached. The deployment will keep running.\nTo continue the logs from where you left off, do:", cerr.Error())
 		}
@@ -148,16 +156,18 @@ func SetupCommands(version string) {
 	RootCmd.PersistentFlags().StringVar(&global.FabricAddr, "cluster", global.FabricAddr, "Defang cluster to connect to")
 	RootCmd.PersistentFlags().MarkHidden("cluster") // only for Defang use
 	RootCmd.PersistentFlags().Var(&global.TenantSelection, "workspace", "workspace to use")
-	RootCmd.PersistentFlags().VarP(&global.Stack.Provider, "provider", "P", fmt.Sprintf(`bring-your-own-cloud provider; one of %v`, client.ByocProviders()))
+	RootCmd.PersistentFlags().VarP(&global.Stack.Provider, "provider", "P", fmt.Sprintf(`bring-your-own-cloud provider; one of %v, or %q to deploy with the local Docker or Podman`, client.ByocProviders(), client.ProviderLocal))
 	RootCmd.RegisterFlagCompletionFunc("provider", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		var completions []cobra.Completion
 		for _, provider := range client.ByocProviders() {
 			completions = append(completions, provider.String())
 		}
+		completions = append(completions, client.ProviderLocal.String())
 		return completions, cobra.ShellCompDirectiveNoFileComp
 	})
 	// RootCmd.Flag("provider").NoOptDefVal = "auto" NO this will break the "--provider aws"
 	RootCmd.Flags().MarkDeprecated("provider", "use '--stack' to select a stack instead")
+	addAgentFlags(RootCmd.Flags())                                                                         // the root command starts the agent
 	RootCmd.PersistentFlags().BoolVarP(&global.Verbose, "verbose", "v", global.Verbose, "verbose logging") // backwards compat: only used by tail
 	RootCmd.PersistentFlags().BoolVar(&global.Debug, "debug", global.Debug, "debug logging for troubleshooting the CLI")
 	RootCmd.PersistentFlags().BoolVar(&dryrun.DoDryRun, "dry-run", false, "dry run (don't actually change anything)")
@@ -190,6 +200,20 @@ func SetupCommands(version string) {
 	cdInstallCmd.Flags().String("bucket", pkg.Getenv("DEFANG_CD_BUCKET", ""), "adopt an existing bucket for CD state instead of creating a new one (BYOC AWS/GCP/DigitalOcean; defaults to $DEFANG_CD_BUCKET)")
 	cdCmd.AddCommand(cdInstallCmd)
 	cdCmd.AddCommand(cdCloudformationCmd)
+	cdSetupCICmd.Flags().String("repo", "", "the GitHub repository allowed to deploy, as owner/name")
+	_ = cdSetupCICmd.MarkFlagRequired("repo")
+	cdSetupCICmd.Flags().String("branch", "main", "the branch allowed to deploy")
+	cdSetupCICmd.Flags().String("environment", "", "the GitHub environment allowed to deploy, instead of a branch")
+	cdSetupCICmd.Flags().Bool("teardown", false, "remove the CI resources instead")
+	cdCmd.AddCommand(cdSetupCICmd)
+	cdStateCmd.AddCommand(cdStateShowCmd)
+	cdStateCmd.AddCommand(cdStatePendingCmd)
+	cdStateRepairCmd.Flags().StringToString("import", nil, "import a pending create as URN=ID instead of clearing it")
+	cdStateRepairCmd.Flags().Bool("force", false, "repair without asking for confirmation")
+	cdStateCmd.AddCommand(cdStateRepairCmd)
+	cdCmd.AddCommand(cdStateCmd)
+	cdUnlockCmd.Flags().Bool("force", false, "remove the lock even if it has not expired")
+	cdCmd.AddCommand(cdUnlockCmd)
 
 	// Eula command
 	tosCmd.Flags().Bool("agree-tos", false, "agree to the Defang terms of service")
@@ -200,15 +224,18 @@ func SetupCommands(version string) {
 
 	// Token command
 	tokenCmd.Flags().Duration("expires", 24*time.Hour, "validity duration of the token")
-	tokenCmd.Flags().String("scope", "", fmt.Sprintf("scope of the token; one of %v (required)", scope.All())) // TODO: make it an Option
-	_ = tokenCmd.MarkFlagRequired("scope")
-	tokenCmd.RegisterFlagCompletionFunc("scope", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		var completions []cobra.Completion
-		for _, s := range scope.All() {
-			completions = append(completions, s.String())
-		}
-		return completions, cobra.ShellCompDirectiveNoFileComp
-	})
+	tokenCmd.Flags().String("scope", "", fmt.Sprintf("scope of the token; one of %v", scope.All()))
+	_ = tokenCmd.Flags().MarkDeprecated("scope", "use \"defang token create\" instead")
+	tokenCmd.RegisterFlagCompletionFunc("scope", completeScopes)
+	tokenCreateCmd.Flags().Duration("expires", 24*time.Hour, "validity duration of the token")
+	tokenCreateCmd.Flags().StringSlice("scope", nil, fmt.Sprintf("scope(s) of the token; any of %v (required)", scope.All()))
+	_ = tokenCreateCmd.MarkFlagRequired("scope")
+	tokenCreateCmd.RegisterFlagCompletionFunc("scope", completeScopes)
+	tokenCreateCmd.Flags().String("restrict-project", "", "only allow the token to be used for this project; advisory, only checked by this CLI")
+	tokenCreateCmd.Flags().String("restrict-stack", "", "only allow the token to be used for this stack; advisory, only checked by this CLI")
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
 	RootCmd.AddCommand(tokenCmd)
 
 	// Login Command
@@ -234,6 +261,9 @@ func SetupCommands(version string) {
 	initCmd.PersistentFlags().Var(&sourcePlatform, "from", fmt.Sprintf(`the platform from which to migrate the project; one of %v`, migrate.AllSourcePlatforms))
 	RootCmd.AddCommand(initCmd)
 
+	// Migrate Command
+	RootCmd.AddCommand(makeMigrateCmd())
+
 	// Get Services Command
 	psCommand := makeComposePsCmd()
 	psCommand.Use = "services"
@@ -284,6 +314,7 @@ func SetupCommands(version string) {
 	debugCmd.Flags().String("since", "", "start time for logs; duration or timestamp (unix or RFC3339)")
 	debugCmd.Flags().String("until", "", "end time for logs; duration or timestamp (unix or RFC3339)")
 	debugCmd.Flags().StringVar(&global.ModelID, "model", global.ModelID, "LLM model to use for debugging (Pro users only)")
+	addAgentFlags(debugCmd.Flags())
 	RootCmd.AddCommand(debugCmd)
 
 	// Tail Command
@@ -296,11 +327,16 @@ func SetupCommands(version string) {
 
 	// Deployments Command
 	var deploymentsCmd = makeDeploymentsCmd("deployments")
+	deploymentsCmd.AddCommand(makeDeploymentsShowCmd())
+	deploymentsCmd.AddCommand(makeDeploymentsExportCmd())
 	RootCmd.AddCommand(deploymentsCmd)
 
 	// MCP Command
 	mcpServerCmd.Flags().Int("auth-server", 0, "auth server port")
 	mcpServerCmd.Flags().MarkDeprecated("auth-server", "we now reach out to the auth server: https://auth.defang.io directly")
+	mcpServerCmd.Flags().String("transport", "stdio", "transport to serve MCP over; one of [stdio http]")
+	mcpServerCmd.Flags().String("listen", "127.0.0.1:8090", "address to listen on for the http transport")
+	addRequireValidateFlag(mcpServerCmd.Flags())
 	mcpCmd.AddCommand(mcpServerCmd)
 	mcpCmd.PersistentFlags().String("client", "", fmt.Sprintf("MCP setup client %v", mcp.ValidClients))
 	_ = mcpCmd.RegisterFlagCompletionFunc("client", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -317,12 +353,22 @@ func SetupCommands(version string) {
 	// TODO: Add list, renew etc.
 	certCmd.AddCommand(certGenerateCmd)
 	RootCmd.AddCommand(certCmd)
+	// Quota Command
+	quotaCmd.AddCommand(quotaCheckCmd)
+	RootCmd.AddCommand(quotaCmd)
+
 	recipeCmd := makeRecipeCmd()
 	RootCmd.AddCommand(recipeCmd)
 
 	stackCmd := makeStackCmd()
 	RootCmd.AddCommand(stackCmd)
 
+	previewEnvCmd := makePreviewEnvCmd()
+	RootCmd.AddCommand(previewEnvCmd)
+
+	// Agent Command
+	RootCmd.AddCommand(makeAgentCmd())
+
 	if term.StdoutCanColor() { // TODO: should use DoColor(…) instead
 		// Add some emphasis to the help command
 		re := regexp.MustCompile(`(?m)^[A-Za-z ]+?:`)
@@ -381,6 +427,10 @@ var RootCmd = &cobra.Command{
 			return err
 		}
 
+		if err := checkAutoApproveEnv(cmd); err != nil {
+			return err
+		}
+
 		var utc, _ = cmd.Flags().GetBool("utc")
 		var json, _ = cmd.Flags().GetBool("json")
 
@@ -420,8 +470,16 @@ var RootCmd = &cobra.Command{
 			}
 		}
 
+		// The local provider runs without the Fabric, so don't require a connection or login
+		offline := stackProvider() == client.ProviderLocal
+
 		global.Client, err = cli.ConnectWithTenant(ctx, global.FabricAddr, global.TenantSelection)
 		if err != nil {
+			if offline {
+				term.Debug("Unable to connect to the Fabric; continuing with the local provider:", err)
+				track.Tracker = global.Client
+				return nil
+			}
 			if connect.CodeOf(err) != connect.CodeUnauthenticated {
 				return err
 			}
@@ -439,8 +497,14 @@ var RootCmd = &cobra.Command{
 			}
 		}
 
+		if !offline {
+			if err := checkTokenScope(cmd); err != nil {
+				return err
+			}
+		}
+
 		// Check if we are correctly logged in, but only if the command needs authorization
-		if when, ok := cmd.Annotations[authNeeded]; !ok {
+		if when, ok := cmd.Annotations[authNeeded]; !ok || offline {
 			return nil
 		} else if when == "playground" {
 			// Only need to be logged in for Playground, ie. no explicit BYOC provider (note that stack file hasn't been loaded yet)
@@ -470,7 +534,7 @@ var RootCmd = &cobra.Command{
 		}
 
 		prompt := "Welcome to Defang. I can help you deploy your project to the cloud."
-		ag, err := agent.New(ctx, global.FabricAddr, &global.Stack)
+		ag, err := agent.New(ctx, global.FabricAddr, &global.Stack, agentOptions()...)
 		if err != nil {
 			return err
 		}
@@ -483,6 +547,24 @@ func newLoaderForCommand(cmd *cobra.Command) *compose.Loader {
 	return compose.NewLoaderFromOptions(loaderOptions)
 }
 
+// stackProvider returns the provider of the selected stack, including one that
+// is only set in its stack file, which the command session loads later.
+func stackProvider() client.ProviderID {
+	if global.Stack.Provider != client.ProviderAuto || global.Stack.Name == "" {
+		return global.Stack.Provider
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return global.Stack.Provider
+	}
+	stack, err := stacks.ReadInDirectory(wd, global.Stack.Name)
+	if err != nil {
+		term.Debug("Could not read the stack file:", err)
+		return global.Stack.Provider
+	}
+	return stack.Provider
+}
+
 func isCompletionCommand(cmd *cobra.Command) bool {
 	return cmd.Name() == cobra.ShellCompRequestCmd || (cmd.Parent() != nil && cmd.Parent().Name() == "completion")
 }
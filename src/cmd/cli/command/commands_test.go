@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -540,3 +541,34 @@ func TestErrIfStackAndProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestStackProvider(t *testing.T) {
+	origStack := global.Stack
+	t.Cleanup(func() { global.Stack = origStack })
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(stacks.Directory, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stacks.Directory, "dev"), []byte("DEFANG_PROVIDER=local\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		stack stacks.Parameters
+		want  client.ProviderID
+	}{
+		{name: "provider from the stack file", stack: stacks.Parameters{Name: "dev", Provider: client.ProviderAuto}, want: client.ProviderLocal},
+		{name: "explicit provider", stack: stacks.Parameters{Name: "dev", Provider: client.ProviderAWS}, want: client.ProviderAWS},
+		{name: "no stack file", stack: stacks.Parameters{Name: "prod", Provider: client.ProviderAuto}, want: client.ProviderAuto},
+		{name: "no stack", stack: stacks.Parameters{Provider: client.ProviderAuto}, want: client.ProviderAuto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.Stack = tt.stack
+			if got := stackProvider(); got != tt.want {
+				t.Errorf("stackProvider() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/DefangLabs/defang/src/pkg/dryrun"
 	"github.com/DefangLabs/defang/src/pkg/logs"
 	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/notify"
 	"github.com/DefangLabs/defang/src/pkg/session"
 	"github.com/DefangLabs/defang/src/pkg/stacks"
 	"github.com/DefangLabs/defang/src/pkg/term"
@@ -60,6 +61,12 @@ func makeComposeUpCmd() *cobra.Command {
 			var detach, _ = cmd.Flags().GetBool("detach")
 			var waitTimeout, _ = cmd.Flags().GetInt("wait-timeout")
 			var allowUpgrade, _ = cmd.Flags().GetBool("allow-upgrade")
+			var reportFlags, _ = cmd.Flags().GetStringArray("report")
+
+			reports, err := cli.ParseReportTargets(reportFlags)
+			if err != nil {
+				return err
+			}
 
 			upload := compose.UploadModeDefault
 			if force {
@@ -71,8 +78,9 @@ func makeComposeUpCmd() *cobra.Command {
 			since := time.Now()
 
 			session, err := newCommandSessionWithOpts(cmd, commandSessionOpts{
-				CheckAccountInfo:   true,
-				AllowStackCreation: true,
+				CheckAccountInfo:    true,
+				AllowStackCreation:  true,
+				ValidateStackSchema: true,
 			})
 			if err != nil {
 				return err
@@ -88,6 +96,10 @@ func makeComposeUpCmd() *cobra.Command {
 			if loadErr != nil {
 				return handleInvalidComposeFileErr(ctx, loadErr)
 			}
+			schema, err := stacks.ParseSchema(project.Extensions)
+			if err != nil {
+				return err
+			}
 
 			// Check if the user has permission to use the provider
 			err = canIUseProvider(ctx, session.Provider, project.Name, len(project.Services), allowUpgrade)
@@ -106,7 +118,7 @@ func makeComposeUpCmd() *cobra.Command {
 				term.Debugf("AccountInfo failed: %v", err)
 			} else if len(resp.Deployments) > 0 {
 				workingDir, _ := session.Loader.ProjectWorkingDir(ctx)
-				confirmed, err := confirmDeployment(workingDir, resp.Deployments, accountInfo, session.Provider.GetStackName())
+				confirmed, err := confirmDeployment(workingDir, resp.Deployments, accountInfo, session.Provider.GetStackName(), schema)
 				if err != nil {
 					return err
 				}
@@ -120,12 +132,47 @@ func makeComposeUpCmd() *cobra.Command {
 					Provider: accountInfo.Provider,
 					Region:   accountInfo.Region,
 					Recipe:   session.Stack.Recipe,
-				})
+				}, schema)
 				if err != nil {
 					term.Debug("Failed to create stack:", err)
 				}
 			}
 
+			// Write a plan of the deployment for review, or deploy a reviewed plan
+			planOut, _ := cmd.Flags().GetString("plan-out")
+			planIn, _ := cmd.Flags().GetString("plan")
+
+			if planOut != "" {
+				planEstimate, _ := cmd.Flags().GetBool("plan-estimate")
+				plan, err := cli.MakePlan(ctx, global.Client, session.Provider, project, cli.PlanOptions{
+					Recipe:   session.Stack.Recipe,
+					Estimate: planEstimate,
+				})
+				if err != nil {
+					return err
+				}
+				if err := cli.WritePlan(planOut, plan); err != nil {
+					return err
+				}
+				term.Info("Wrote the deployment plan to", planOut)
+				if dryrun.DoDryRun {
+					return dryrun.ErrDryRun
+				}
+			}
+			// Fail before the CD task starts if the project can never fit in the cloud account
+			if !dryrun.DoDryRun {
+				if err := cli.PreflightQuotaCheck(ctx, session.Provider, project); err != nil {
+					return err
+				}
+			}
+			// The plan is checked by ComposeUp, after it has taken the deploy lock
+			var reviewedPlan *cli.Plan
+			if planIn != "" {
+				if reviewedPlan, err = cli.ReadPlan(planIn); err != nil {
+					return err
+				}
+			}
+
 			// Show a warning for any (managed) services that we cannot monitor
 			var managedServices []string
 			for _, service := range project.Services {
@@ -137,15 +184,51 @@ func makeComposeUpCmd() *cobra.Command {
 				term.Warnf("Defang cannot monitor status of the following managed service(s): %v.\n   To check if the managed service is up, check the status of the service which depends on it.", managedServices)
 			}
 
+			// The stack file can configure notifications, so this comes after the session is loaded
+			notifier, err := notify.FromEnv()
+			if err != nil {
+				return err
+			}
+			defer notifier.Close(ctx)
+			if notifier != nil && ttl != "" {
+				term.Warn("No notification is sent when the TTL expires and the deployment is destroyed")
+			}
+			notification := notify.Event{
+				Project:  project.Name,
+				Stack:    session.Stack.Name,
+				Provider: session.Stack.Provider.String(),
+				Region:   session.Stack.Region,
+			}
+
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
 			deploy, project, err := cli.ComposeUp(ctx, global.Client, session.Provider, session.Stack, cli.ComposeUpParams{
-				Project:    project,
-				UploadMode: upload,
-				Recipe:     session.Stack.Recipe,
-				TTL:        ttl,
+				Project:     project,
+				UploadMode:  upload,
+				Recipe:      session.Stack.Recipe,
+				TTL:         ttl,
+				LockTimeout: lockTimeout,
+				Plan:        reviewedPlan,
 			})
+			recorder := cli.NewDeployRecorder(since)
+			writeReports := func(deploy *defangv1.DeployResponse, deployErr error) {
+				if len(reports) == 0 || dryrun.DoDryRun {
+					return
+				}
+				report := cli.MakeUpReport(ctx, session.Provider, project, session.Stack.Name, deploy, recorder, deployErr)
+				if err := cli.WriteReports(reports, report); err != nil {
+					term.Warn(err)
+				}
+			}
 			if err != nil {
 				composeErr := err
-				debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive)
+				writeReports(nil, composeErr)
+				if !errors.Is(composeErr, dryrun.ErrDryRun) {
+					event := notification
+					event.Type = notify.EventDeployFailed
+					event.Error = composeErr.Error()
+					notifier.Notify(event)
+				}
+				debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive, agentOptions()...)
 				if err != nil {
 					return err
 				}
@@ -158,7 +241,15 @@ func makeComposeUpCmd() *cobra.Command {
 
 			printPlaygroundPortalServiceURLs(deploy.Services)
 
+			event := notification
+			event.Type = notify.EventDeployStarted
+			event.Deployment = deploy.Etag
+			notifier.Notify(event)
+
 			if detach {
+				if len(reports) > 0 {
+					term.Warn("No report is written in detached mode")
+				}
 				term.Info("Detached.")
 				return nil
 			}
@@ -171,25 +262,48 @@ func makeComposeUpCmd() *cobra.Command {
 			term.Info("Tailing logs for", tailSource, "; press Ctrl+C to detach:")
 
 			tailOptions := newTailOptionsForDeploy(session.Stack.Name, deploy.Etag, since, global.Verbose)
+			notifyHealthy := cli.NotifyServiceHealthy(notifier, notification, deploy)
+			tailOptions.OnServiceUpdate = func(msg *defangv1.SubscribeResponse) {
+				recorder.OnServiceUpdate(msg)
+				notifyHealthy(msg)
+			}
 			serviceStates, err := cli.TailAndMonitor(ctx, project, session.Provider, time.Duration(waitTimeout)*time.Second, tailOptions)
+			writeReports(deploy, err)
 			if err != nil {
 				deploymentErr := err
-				debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive)
-				if err != nil {
-					term.Warn("Failed to initialize debugger:", err)
-					return deploymentErr
-				}
-				handleTailAndMonitorErr(ctx, deploymentErr, debugger, debug.DebugConfig{
+				debugConfig := debug.DebugConfig{
 					Deployment: deploy.Etag,
 					Project:    project,
 					ProviderID: &session.Stack.Provider,
 					Stack:      session.Stack.Name,
 					Since:      since,
 					Until:      time.Now(),
-				})
+				}
+				var errDeploymentFailed client.ErrDeploymentFailed
+				if errors.As(deploymentErr, &errDeploymentFailed) && errDeploymentFailed.Service != "" {
+					debugConfig.FailedServices = []string{errDeploymentFailed.Service}
+				}
+				event := notification
+				event.Type = notify.EventDeployFailed
+				event.Deployment = deploy.Etag
+				event.Error = deploymentErr.Error()
+				event.Debug = strings.TrimSuffix(debugConfig.Summary(), "\n")
+				notifier.Notify(event)
+
+				debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive, agentOptions()...)
+				if err != nil {
+					term.Warn("Failed to initialize debugger:", err)
+					return deploymentErr
+				}
+				handleTailAndMonitorErr(ctx, deploymentErr, debugger, debugConfig)
 				return deploymentErr
 			}
 
+			event = notification
+			event.Type = notify.EventDeployCompleted
+			event.Deployment = deploy.Etag
+			notifier.Notify(event)
+
 			for _, service := range deploy.Services {
 				service.State = serviceStates[service.Service.Name]
 			}
@@ -221,7 +335,16 @@ func makeComposeUpCmd() *cobra.Command {
 	composeUpCmd.Flags().Bool("allow-upgrade", pkg.GetenvBool("DEFANG_ALLOW_UPGRADE"), "allow upgrading the CD image and Pulumi version to the latest available")
 	composeUpCmd.Flags().StringArray("env-file", nil, "compose environment file(s) for interpolation; defaults to .env") // docker-compose compatibility
 	_ = composeUpCmd.MarkFlagFilename("env-file")
+	composeUpCmd.Flags().String("plan-out", "", "write a plan of the deployment to this JSON file; use with --dry-run to review it first")
+	composeUpCmd.Flags().String("plan", "", "deploy this plan from --plan-out, unless its inputs have changed")
+	composeUpCmd.Flags().Bool("plan-estimate", false, "add the cost estimate and Pulumi preview to the plan; takes a few minutes")
+	composeUpCmd.MarkFlagsMutuallyExclusive("plan-out", "plan")
+	_ = composeUpCmd.MarkFlagFilename("plan-out", "json")
+	_ = composeUpCmd.MarkFlagFilename("plan", "json")
+	composeUpCmd.Flags().StringArray("report", nil, `write a report of the deployment for CI: "junit:<path>", "json:<path>", or "github-summary"`)
+	composeUpCmd.Flags().Duration("lock-timeout", 0, "how long to wait for another deployment of the stack to finish")
 	composeUpCmd.Flags().String("ttl", "", `time-to-live after which the deployment destroys itself (e.g. "12h", "7d12h" or a timestamp)`)
+	addAgentFlags(composeUpCmd.Flags()) // for the debugger on failure
 	return composeUpCmd
 }
 
@@ -244,7 +367,7 @@ func resolveTTL(ttlFlag string, flagSet bool, now time.Time) (string, error) {
 	return byoc.ParseTTL(ttl, now)
 }
 
-func confirmDeployment(targetDirectory string, existingDeployments []*defangv1.Deployment, accountInfo *client.AccountInfo, stackName string) (bool, error) {
+func confirmDeployment(targetDirectory string, existingDeployments []*defangv1.Deployment, accountInfo *client.AccountInfo, stackName string, schema stacks.Schema) (bool, error) {
 	samePlace := slices.ContainsFunc(existingDeployments, func(dep *defangv1.Deployment) bool {
 		if dep.Provider != accountInfo.Provider.Value() {
 			return false
@@ -273,7 +396,7 @@ func confirmDeployment(targetDirectory string, existingDeployments []*defangv1.D
 			Provider: accountInfo.Provider,
 			Region:   accountInfo.Region,
 			Recipe:   global.Stack.Recipe,
-		})
+		}, schema)
 		if err != nil {
 			term.Debugf("Failed to create stack %v", err)
 		} else {
@@ -312,19 +435,19 @@ func confirmDeploymentToNewLocation() (bool, error) {
 	return true, nil
 }
 
-func promptToCreateStack(ctx context.Context, targetDirectory string, params stacks.Parameters) error {
+func promptToCreateStack(ctx context.Context, targetDirectory string, params stacks.Parameters, schema stacks.Schema) error {
 	if global.NonInteractive {
 		term.Info("Consider creating a stack to manage your deployments.")
 		printDefangHint("To create a stack, do:", "stack new --name="+params.Name)
 		return nil
 	}
 
-	err := promptForStackParameters(ctx, &params)
+	err := promptForStackParameters(ctx, &params, schema)
 	if err != nil {
 		return err
 	}
 
-	_, err = stacks.CreateInDirectory(targetDirectory, params)
+	_, err = stacks.CreateInDirectory(targetDirectory, params, schema)
 	if err != nil {
 		return err
 	}
@@ -461,6 +584,12 @@ func makeComposeDownCmd() *cobra.Command {
 			var detach, _ = cmd.Flags().GetBool("detach")
 			var allowUpgrade, _ = cmd.Flags().GetBool("allow-upgrade")
 			var remove, _ = cmd.Flags().GetBool("remove")
+			var reportFlags, _ = cmd.Flags().GetStringArray("report")
+
+			reports, err := cli.ParseReportTargets(reportFlags)
+			if err != nil {
+				return err
+			}
 
 			if remove && detach {
 				return errors.New("cannot use --remove with --detach: the stack can only be removed after the down completes")
@@ -481,6 +610,16 @@ func makeComposeDownCmd() *cobra.Command {
 				return err
 			}
 
+			// The services are listed for the report before they are gone
+			var serviceInfos []*defangv1.ServiceInfo
+			if len(reports) > 0 && !detach {
+				if resp, err := session.Provider.GetServices(cmd.Context(), &defangv1.GetServicesRequest{Project: projectName}); err != nil {
+					term.Debugf("GetServices failed: %v", err)
+				} else {
+					serviceInfos = resp.Services
+				}
+			}
+
 			since := time.Now()
 			deployment, err := cli.ComposeDown(cmd.Context(), projectName, global.Client, session.Provider)
 			if err != nil {
@@ -515,7 +654,16 @@ func makeComposeDownCmd() *cobra.Command {
 			tailOptions := newTailOptionsForDown(session.Stack.Name, deployment, since)
 			tailCtx := cmd.Context() // FIXME: stop Tail when the deployment task is done
 			err = cli.TailAndWaitForCD(tailCtx, session.Provider, projectName, tailOptions)
-			if err != nil && !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			if len(reports) > 0 {
+				report := cli.MakeDownReport(cmd.Context(), session.Provider, projectName, session.Stack.Name, deployment, serviceInfos, since, err)
+				if err := cli.WriteReports(reports, report); err != nil {
+					term.Warn(err)
+				}
+			}
+			if err != nil {
 				if connect.CodeOf(err) == connect.CodePermissionDenied {
 					// If tail fails because of missing permission, we show a warning and detach. This is
 					// different than `up`, which will wait for the deployment to finish, but we don't have an
@@ -572,6 +720,7 @@ func makeComposeDownCmd() *cobra.Command {
 	_ = composeDownCmd.Flags().MarkHidden("tail")
 	composeDownCmd.Flags().Bool("allow-upgrade", pkg.GetenvBool("DEFANG_ALLOW_UPGRADE"), "allow upgrading the CD image and Pulumi version to the latest available")
 	composeDownCmd.Flags().Bool("remove", false, "delete the stack after a successful down")
+	composeDownCmd.Flags().StringArray("report", nil, `write a report of the down for CI: "junit:<path>", "json:<path>", or "github-summary"`)
 	return composeDownCmd
 }
 
@@ -35,7 +35,7 @@ var debugCmd = &cobra.Command{
 			return err
 		}
 
-		debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive)
+		debugger, err := debug.NewDebugger(ctx, global.FabricAddr, session.Stack, !global.NonInteractive, agentOptions()...)
 		if err != nil {
 			return err
 		}
@@ -1,9 +1,13 @@
 package command
 
 import (
+	"fmt"
 	"slices"
+	"time"
 
 	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/timeutils"
+	"github.com/DefangLabs/defang/src/pkg/types"
 	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
 	"github.com/spf13/cobra"
 )
@@ -41,7 +45,76 @@ func makeDeploymentsCmd(use string) *cobra.Command {
 			})
 		},
 	}
-	deploymentsCmd.PersistentFlags().Uint32P("limit", "l", 10, "maximum number of deployments to list")
-	deploymentsCmd.PersistentFlags().BoolP("all", "a", false, "show all deployments, including stopped")
+	deploymentsCmd.Flags().Uint32P("limit", "l", 10, "maximum number of deployments to list")
+	deploymentsCmd.Flags().BoolP("all", "a", false, "show all deployments, including stopped")
 	return deploymentsCmd
 }
+
+func makeDeploymentsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "show DEPLOYMENT",
+		Aliases:     []string{"get", "inspect"},
+		Annotations: authNeededAlways,
+		Args:        cobra.ExactArgs(1),
+		Short:       "Show the details of a deployment, including the compose file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loader := newLoaderForCommand(cmd)
+			projectName, _, _ := loader.LoadProjectName(cmd.Context()) // optional; the deployment ID is unique
+
+			return cli.DeploymentShow(cmd.Context(), global.Client, projectName, types.ETag(args[0]))
+		},
+	}
+}
+
+func makeDeploymentsExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:         "export",
+		Annotations: authNeededAlways,
+		Args:        cobra.NoArgs,
+		Short:       "Export the deployment history as CSV or JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var since, _ = cmd.Flags().GetString("since")
+			var format, _ = cmd.Flags().GetString("format")
+			var actions, _ = cmd.Flags().GetStringSlice("action")
+			var origins, _ = cmd.Flags().GetStringSlice("origin")
+
+			sinceTs, err := timeutils.ParseTimeOrDuration(since, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid 'since' time: %w", err)
+			}
+			params := cli.ExportDeploymentsParams{
+				StackName: global.Stack.Name,
+				Since:     sinceTs,
+				Format:    format,
+			}
+			for _, a := range actions {
+				action, err := cli.ParseDeploymentAction(a)
+				if err != nil {
+					return err
+				}
+				params.Actions = append(params.Actions, action)
+			}
+			for _, o := range origins {
+				origin, err := cli.ParseDeploymentOrigin(o)
+				if err != nil {
+					return err
+				}
+				params.Origins = append(params.Origins, origin)
+			}
+
+			loader := newLoaderForCommand(cmd)
+			params.ProjectName, _, err = loader.LoadProjectName(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			return cli.ExportDeployments(cmd.Context(), global.Client, cmd.OutOrStdout(), params)
+		},
+	}
+	exportCmd.Flags().String("since", "30d", "export deployments since this time or duration")
+	exportCmd.Flags().String("format", "csv", "output format; one of [csv json]")
+	exportCmd.Flags().StringSlice("action", nil, "only export deployments with these actions; any of [up down preview refresh]")
+	exportCmd.Flags().StringSlice("origin", nil, "only export deployments from these origins; any of [ci github gitlab]")
+	_ = exportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"csv", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	return exportCmd
+}
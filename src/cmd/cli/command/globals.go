@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/agent"
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/modes"
 	"github.com/DefangLabs/defang/src/pkg/stacks"
@@ -63,6 +64,7 @@ Note: Ensure the flag name, environment variable name, and struct field name are
 and follow the established naming conventions.
 */
 type GlobalConfig struct {
+	AutoApprove     agent.AutoApprove // file changes the agent may apply without confirmation
 	Client          client.FabricClient
 	ColorMode       ColorMode
 	Debug           bool
@@ -72,6 +74,7 @@ type GlobalConfig struct {
 	Json            bool
 	ModelID         string // only for debug/generate; Pro users
 	NonInteractive  bool
+	RequireValidate bool // agent and MCP deploys require a successful validate_compose first
 	Stack           stacks.Parameters
 	TenantSelection types.TenantNameOrID // workspace
 	Utc             bool
@@ -115,6 +118,14 @@ func NewGlobalConfig() *GlobalConfig {
 		}
 	}
 
+	var autoApprove agent.AutoApprove
+	if fromEnv, ok := os.LookupEnv("DEFANG_AUTO_APPROVE"); ok {
+		err := autoApprove.Set(fromEnv)
+		if err != nil {
+			term.Debugf("invalid DEFANG_AUTO_APPROVE value: %v", err)
+		}
+	}
+
 	json := pkg.GetenvBool("DEFANG_JSON")
 	hastty := term.IsTerminal() && !pkg.GetenvBool("CI")
 
@@ -127,13 +138,15 @@ func NewGlobalConfig() *GlobalConfig {
 	}
 
 	return &GlobalConfig{
-		ColorMode:      color,
-		FabricAddr:     pkg.Getenv("DEFANG_FABRIC", client.DefangFabric),
-		Debug:          pkg.GetenvBool("DEFANG_DEBUG"),
-		HasTty:         hastty,
-		HideUpdate:     pkg.GetenvBool("DEFANG_HIDE_UPDATE"),
-		Json:           json,
-		NonInteractive: !hastty,
+		AutoApprove:     autoApprove,
+		ColorMode:       color,
+		FabricAddr:      pkg.Getenv("DEFANG_FABRIC", client.DefangFabric),
+		Debug:           pkg.GetenvBool("DEFANG_DEBUG"),
+		HasTty:          hastty,
+		HideUpdate:      pkg.GetenvBool("DEFANG_HIDE_UPDATE"),
+		Json:            json,
+		NonInteractive:  !hastty,
+		RequireValidate: pkg.GetenvBool("DEFANG_REQUIRE_VALIDATE"),
 		Stack: stacks.Parameters{
 			Name:     pkg.Getenv("DEFANG_STACK", ""),
 			Provider: provider,
@@ -36,14 +36,19 @@ var initCmd = &cobra.Command{
 		var err error
 		if len(args) > 0 {
 			result, err = setupClient.CloneSample(ctx, args[0])
-		} else if from, ok := cmd.Flag("from").Value.(*migrate.SourcePlatform); ok && *from == migrate.SourcePlatformHeroku {
-			result, err = setupClient.MigrateFromHeroku(ctx)
+		} else if from, ok := cmd.Flag("from").Value.(*migrate.SourcePlatform); ok && *from == migrate.SourcePlatformKubernetes {
+			return errors.New("use `defang migrate --from=kubernetes -f <manifests>` to convert Kubernetes manifests")
+		} else if from, ok := cmd.Flag("from").Value.(*migrate.SourcePlatform); ok && *from != migrate.SourcePlatformUnspecified {
+			result, err = setupClient.Migrate(ctx, *from)
 		} else {
 			result, err = setupClient.Start(ctx)
 		}
 		if err != nil {
 			return err
 		}
+		if err := finishHerokuMigration(cmd, result.Heroku); err != nil {
+			return err
+		}
 		afterGenerate(ctx, result)
 		return nil
 	},
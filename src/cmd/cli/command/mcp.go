@@ -1,15 +1,18 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/DefangLabs/defang/src/pkg/agent/tools"
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/mcp"
 	"github.com/DefangLabs/defang/src/pkg/term"
-	"github.com/mark3labs/mcp-go/server"
 	"github.com/spf13/cobra"
 )
 
@@ -29,6 +32,8 @@ var mcpServerCmd = &cobra.Command{
 	Args:    cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ideClient, _ := cmd.Flags().GetString("client")
+		transport, _ := cmd.Flags().GetString("transport")
+		listen, _ := cmd.Flags().GetString("listen")
 
 		mcpClient, err := mcp.ParseMCPClient(ideClient)
 		if err != nil {
@@ -36,6 +41,20 @@ var mcpServerCmd = &cobra.Command{
 			mcpClient = mcp.MCPClientUnspecified
 		}
 
+		config := mcp.StackConfig{
+			FabricAddr:        global.FabricAddr,
+			Stack:             &global.Stack,
+			RequireValidation: global.RequireValidate,
+		}
+
+		switch transport {
+		case "stdio":
+		case "http":
+			return serveMCPHTTP(cmd.Context(), listen, mcpClient, config)
+		default:
+			return fmt.Errorf("unsupported transport %q; must be one of [stdio http]", transport)
+		}
+
 		term.Debug("Creating log file")
 		logFile, err := os.OpenFile(filepath.Join(client.StateDir, "defang-mcp.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 		if err != nil {
@@ -48,17 +67,14 @@ var mcpServerCmd = &cobra.Command{
 
 		// Create a new MCP server
 		term.Debug("Creating MCP server")
-		s, err := mcp.NewDefangMCPServer(RootCmd.Version, mcpClient, tools.DefaultToolCLI{}, mcp.StackConfig{
-			FabricAddr: global.FabricAddr,
-			Stack:      &global.Stack,
-		})
+		s, err := mcp.NewDefangMCPServer(RootCmd.Version, mcpClient, tools.DefaultToolCLI{}, config)
 		if err != nil {
 			return fmt.Errorf("failed to create MCP server: %w", err)
 		}
 
 		// Start the server
 		term.Println("Starting Defang MCP server")
-		if err := server.ServeStdio(s); err != nil {
+		if err := s.ServeStdio(); err != nil {
 			return err
 		}
 
@@ -68,6 +84,55 @@ var mcpServerCmd = &cobra.Command{
 	},
 }
 
+// serveMCPHTTP serves the MCP server over the streamable HTTP transport until
+// the context is canceled. Clients authenticate with the DEFANG_MCP_TOKEN (or
+// a generated secret) or with the Defang access token of the user.
+func serveMCPHTTP(ctx context.Context, listen string, mcpClient mcp.MCPClient, config mcp.StackConfig) error {
+	secret := os.Getenv("DEFANG_MCP_TOKEN")
+	if secret == "" {
+		var err error
+		if secret, err = mcp.GenerateToken(); err != nil {
+			return fmt.Errorf("failed to generate token: %w", err)
+		}
+		// Don't print the token: terminal output ends up in logs and scrollback
+		tokenFile := filepath.Join(client.StateDir, "mcp-token")
+		if err := os.MkdirAll(client.StateDir, 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(tokenFile, []byte(secret), 0600); err != nil {
+			return fmt.Errorf("failed to write token: %w", err)
+		}
+		defer os.Remove(tokenFile)
+		term.Infof("Generated bearer token for MCP clients in %s", tokenFile)
+		term.Info("Set DEFANG_MCP_TOKEN to use a fixed token instead")
+	}
+	tokens := []string{secret, client.GetExistingToken(config.FabricAddr)}
+
+	handler, err := mcp.NewDefangMCPHTTPHandler(RootCmd.Version, mcpClient, tools.DefaultToolCLI{}, config, tokens)
+	if err != nil {
+		return fmt.Errorf("failed to create MCP server: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	term.Infof("Starting Defang MCP server on http://%s%s", listen, mcp.HTTPEndpointPath)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	term.Info("Server shutdown")
+	return nil
+}
+
 var mcpSetupCmd = &cobra.Command{
 	Use:   "setup",
 	Short: "Setup MCP client for defang MCP server",
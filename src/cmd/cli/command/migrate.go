@@ -0,0 +1,152 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/migrate"
+	"github.com/DefangLabs/defang/src/pkg/setup"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/spf13/cobra"
+)
+
+func makeMigrateCmd() *cobra.Command {
+	sourcePlatform := migrate.SourcePlatformUnspecified
+	var output string
+	var skip []string
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Args:  cobra.NoArgs,
+		Short: "Create a compose file for a project deployed on another platform",
+		Example: `  defang migrate --from=heroku
+  defang migrate --from=kubernetes -f manifests/
+  helm template ./chart | defang migrate --from=kubernetes -f -`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if sourcePlatform == migrate.SourcePlatformKubernetes {
+				paths, _ := cmd.Flags().GetStringArray("file")
+				return migrateFromKubernetes(cmd, paths, output)
+			}
+
+			if global.NonInteractive {
+				return errors.New("cannot run in non-interactive mode")
+			}
+			skipSteps, err := migrate.ParseHerokuSteps(skip)
+			if err != nil {
+				return err
+			}
+			setupClient := setup.SetupClient{
+				Surveyor:   surveyor.NewDefaultSurveyor(),
+				ModelID:    global.ModelID,
+				Fabric:     global.Client,
+				FabricAddr: global.FabricAddr,
+				SkipSteps:  skipSteps,
+			}
+			result, err := setupClient.Migrate(ctx, sourcePlatform)
+			if err != nil {
+				return err
+			}
+			if err := finishHerokuMigration(cmd, result.Heroku); err != nil {
+				return err
+			}
+			afterGenerate(ctx, result)
+			return nil
+		},
+	}
+	platforms := slices.Concat(migrate.AllSourcePlatforms, []migrate.SourcePlatform{migrate.SourcePlatformKubernetes})
+	migrateCmd.Flags().Var(&sourcePlatform, "from", fmt.Sprintf(`the platform from which to migrate the project; one of %v`, platforms))
+	migrateCmd.Flags().StringVarP(&output, "output", "o", "compose.yaml", `path of the compose file to create, or "-" for stdout`)
+	migrateCmd.Flags().StringSliceVar(&skip, "skip", nil, fmt.Sprintf("Heroku migration steps to skip; any of %v", migrate.AllHerokuSteps))
+	return migrateCmd
+}
+
+// finishHerokuMigration copies the config vars and the database of a Heroku
+// application once the compose file has been written, and prints what has to
+// be carried over by hand.
+func finishHerokuMigration(cmd *cobra.Command, heroku *migrate.HerokuPostGenerate) error {
+	if heroku == nil {
+		return nil
+	}
+	defer heroku.PrintManualSteps()
+	ctx := cmd.Context()
+	if !heroku.Skips(migrate.HerokuStepConfig) {
+		session, err := newCommandSessionWithOpts(cmd, commandSessionOpts{
+			CheckAccountInfo:   true,
+			AllowStackCreation: true,
+		})
+		if err != nil {
+			return err
+		}
+		projectName, err := client.LoadProjectNameWithFallback(ctx, session.Loader, session.Provider)
+		if err != nil {
+			return err
+		}
+		if err := heroku.PushConfig(ctx, session.Provider, projectName); err != nil {
+			return err
+		}
+	}
+	return heroku.RestoreDatabase(ctx)
+}
+
+// migrateFromKubernetes converts the manifests, or the output of `helm
+// template`, to a compose file without the Fabric.
+func migrateFromKubernetes(cmd *cobra.Command, paths []string, output string) error {
+	if len(paths) == 0 {
+		return errors.New("no manifests specified; use --file with the manifest files or directories, or - for stdin")
+	}
+	manifests, err := migrate.ReadKubernetesManifests(paths, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+	conversion, err := migrate.ConvertKubernetes(manifests)
+	if err != nil {
+		return err
+	}
+
+	if _, err := compose.LoadFromContentWithInterpolation(cmd.Context(), conversion.Compose, "kubernetes"); err != nil {
+		term.Warnf("The compose file may need changes before it can be deployed: %v", err)
+	}
+
+	if output == "-" {
+		if _, err := cmd.OutOrStdout().Write(conversion.Compose); err != nil {
+			return err
+		}
+	} else {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("%s already exists; use --output to write the compose file elsewhere", output)
+			}
+			return err
+		}
+		defer f.Close()
+		if _, err := f.Write(conversion.Compose); err != nil {
+			return err
+		}
+		term.Info("Compose file written to", output)
+	}
+
+	if len(conversion.Report) > 0 {
+		term.Warn("These constructs were not translated; review the compose file before deploying:")
+		for _, line := range conversion.Report {
+			term.Warn(" - " + line)
+		}
+	}
+
+	var configInstructions []string
+	for _, name := range conversion.Config {
+		configInstructions = append(configInstructions, "config create "+name)
+	}
+	if len(configInstructions) > 0 {
+		printDefangHint("The values of Secrets are not copied. To configure this project, run ", configInstructions...)
+	} else {
+		printDefangHint("To deploy this project, run ", "compose up")
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/session"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/spf13/cobra"
+)
+
+func makePreviewEnvCmd() *cobra.Command {
+	var previewEnvCmd = &cobra.Command{
+		Use:     "preview-env",
+		Aliases: []string{"preview-envs", "previews"},
+		Short:   "Manage ephemeral preview environments for pull requests",
+	}
+	previewEnvCmd.PersistentFlags().Int("pr", 0, "pull request number; defaults to the pull request of the CI job")
+	previewEnvCmd.PersistentFlags().String("branch", "", "branch name, used when there is no pull request")
+	previewEnvCmd.AddCommand(makePreviewEnvUpCmd())
+	previewEnvCmd.AddCommand(makePreviewEnvDownCmd())
+	previewEnvCmd.AddCommand(makePreviewEnvGcCmd())
+	return previewEnvCmd
+}
+
+// previewSourceForCommand returns the source of the preview from the --pr and
+// --branch flags, falling back to the CI environment, and its stack name.
+func previewSourceForCommand(cmd *cobra.Command) (cli.PreviewSource, string, error) {
+	source := cli.PreviewSourceFromEnvironment()
+	pr, _ := cmd.Flags().GetInt("pr")
+	branch, _ := cmd.Flags().GetString("branch")
+	if pr != 0 || branch != "" {
+		source.PullRequest, source.Branch = pr, branch
+	}
+	name, err := cli.PreviewStackName(source.PullRequest, source.Branch)
+	return source, name, err
+}
+
+func makePreviewEnvUpCmd() *cobra.Command {
+	var previewEnvUpCmd = &cobra.Command{
+		Use:         "up",
+		Aliases:     []string{"deploy"},
+		Annotations: authNeededAlways,
+		Args:        cobra.NoArgs,
+		Short:       "Deploy the preview environment for a pull request",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			var template, _ = cmd.Flags().GetString("template")
+			var ttlFlag, _ = cmd.Flags().GetString("ttl")
+			var detach, _ = cmd.Flags().GetBool("detach")
+			var commentFile, _ = cmd.Flags().GetString("comment-file")
+			var allowUpgrade, _ = cmd.Flags().GetBool("allow-upgrade")
+
+			source, name, err := previewSourceForCommand(cmd)
+			if err != nil {
+				return err
+			}
+
+			loader := newLoaderForCommand(cmd)
+			sm, err := newStackManagerForLoader(ctx, loader)
+			if err != nil {
+				return err
+			}
+			if _, err := cli.CreatePreviewStack(sm.TargetDirectory(), template, name, ttlFlag, source); err != nil {
+				return err
+			}
+
+			global.Stack.Name = name
+			since := time.Now()
+			session, err := newCommandSessionWithOpts(cmd, commandSessionOpts{
+				CheckAccountInfo:    true,
+				ValidateStackSchema: true,
+			})
+			if err != nil {
+				return err
+			}
+
+			// A DEFANG_TTL in the (existing) stack file wins over the default TTL
+			ttl := ttlFlag
+			if envTTL := os.Getenv("DEFANG_TTL"); envTTL != "" && !cmd.Flags().Changed("ttl") {
+				ttl = envTTL
+			}
+			if ttl, err = byoc.ParseTTL(ttl, time.Now()); err != nil {
+				return err
+			}
+
+			project, err := session.Loader.LoadProject(ctx)
+			if err != nil {
+				return handleInvalidComposeFileErr(ctx, err)
+			}
+			if err := canIUseProvider(ctx, session.Provider, project.Name, len(project.Services), allowUpgrade); err != nil {
+				return err
+			}
+
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+			deploy, project, err := cli.ComposeUp(ctx, global.Client, session.Provider, session.Stack, cli.ComposeUpParams{
+				Project:     project,
+				UploadMode:  compose.UploadModeDefault,
+				Recipe:      session.Stack.Recipe,
+				TTL:         ttl,
+				LockTimeout: lockTimeout,
+			})
+			if err != nil {
+				return err
+			}
+
+			if !detach {
+				tailOptions := newTailOptionsForDeploy(name, deploy.Etag, since, global.Verbose)
+				serviceStates, err := cli.TailAndMonitor(ctx, project, session.Provider, 0, tailOptions)
+				if err != nil {
+					return err
+				}
+				for _, service := range deploy.Services {
+					service.State = serviceStates[service.Service.Name]
+				}
+			}
+
+			services, err := cli.NewServiceFromServiceInfo(deploy.Services)
+			if err != nil {
+				return err
+			}
+			comment := cli.FormatPreviewComment(name, services)
+			if commentFile != "" {
+				if err := os.WriteFile(commentFile, []byte(comment), 0644); err != nil {
+					return fmt.Errorf("failed to write PR comment: %w", err)
+				}
+				term.Infof("Wrote PR comment to %q", commentFile)
+			}
+			term.Println(comment)
+			return nil
+		},
+	}
+	previewEnvUpCmd.Flags().String("template", cli.DefaultPreviewTemplate, "name of the stack that preview stacks extend")
+	previewEnvUpCmd.Flags().String("ttl", cli.DefaultPreviewTTL, `time-to-live after which the preview environment destroys itself (e.g. "12h", "7d12h" or a timestamp)`)
+	previewEnvUpCmd.Flags().BoolP("detach", "d", false, "run in detached mode")
+	previewEnvUpCmd.Flags().Duration("lock-timeout", 0, "how long to wait for another deployment of the stack to finish")
+	previewEnvUpCmd.Flags().String("comment-file", "", "also write the Markdown PR comment to this file")
+	previewEnvUpCmd.Flags().Bool("allow-upgrade", false, "allow upgrading the CD image and Pulumi version to the latest available")
+	return previewEnvUpCmd
+}
+
+func makePreviewEnvDownCmd() *cobra.Command {
+	var previewEnvDownCmd = &cobra.Command{
+		Use:         "down",
+		Aliases:     []string{"rm", "remove", "destroy"},
+		Annotations: authNeededAlways,
+		Args:        cobra.NoArgs,
+		Short:       "Destroy the preview environment for a pull request and remove its stack",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var detach, _ = cmd.Flags().GetBool("detach")
+
+			_, name, err := previewSourceForCommand(cmd)
+			if err != nil {
+				return err
+			}
+
+			loader := newLoaderForCommand(cmd)
+			sm, err := newStackManagerForLoader(ctx, loader)
+			if err != nil {
+				return err
+			}
+			projectName, _, err := loader.LoadProjectName(ctx)
+			if err != nil {
+				return err
+			}
+			return destroyPreviewStack(ctx, sm, projectName, name, detach)
+		},
+	}
+	previewEnvDownCmd.Flags().BoolP("detach", "d", false, "run in detached mode; the stack is not removed")
+	return previewEnvDownCmd
+}
+
+func makePreviewEnvGcCmd() *cobra.Command {
+	var previewEnvGcCmd = &cobra.Command{
+		Use:         "gc",
+		Aliases:     []string{"prune", "cleanup"},
+		Annotations: authNeededAlways,
+		Args:        cobra.NoArgs,
+		Short:       "Destroy the preview environments of closed pull requests and deleted branches",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			loader := newLoaderForCommand(cmd)
+			sm, err := newStackManagerForLoader(ctx, loader)
+			if err != nil {
+				return err
+			}
+			projectName, _, err := loader.LoadProjectName(ctx)
+			if err != nil {
+				return err
+			}
+
+			closed, unknown, err := cli.FindClosedPreviewStacks(ctx, global.Client, cli.GetPreviewState, projectName)
+			if err != nil {
+				return err
+			}
+			if len(unknown) > 0 {
+				term.Warnf("Skipped %d preview stack(s) of unknown origin; remove them with `defang preview-env down --pr=<N>` or `--branch=<branch>`", len(unknown))
+			}
+			if len(closed) == 0 {
+				term.Info("No preview environments of closed pull requests or deleted branches found")
+				return nil
+			}
+			if err := term.Table(closed, "Stack", "Forge", "Repository", "PullRequest", "Branch", "State"); err != nil {
+				return err
+			}
+
+			var errs []error
+			for _, preview := range closed {
+				if err := destroyPreviewStack(ctx, sm, projectName, preview.Stack, false); err != nil {
+					errs = append(errs, fmt.Errorf("stack %q: %w", preview.Stack, err))
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+	return previewEnvGcCmd
+}
+
+// destroyPreviewStack takes down the services of the preview stack and, once
+// that completes, removes the stack.
+func destroyPreviewStack(ctx context.Context, sm session.StacksManager, projectName, name string, detach bool) error {
+	stack, err := sm.Load(ctx, name)
+	if err != nil {
+		return fmt.Errorf("could not load stack parameters: %w", err)
+	}
+	// scope the stack env to this stack, so gc doesn't leak it into the next one
+	return stacks.WithStackEnv(stack, func() error {
+		return destroyLoadedPreviewStack(ctx, stack, projectName, detach)
+	})
+}
+
+func destroyLoadedPreviewStack(ctx context.Context, stack *stacks.Parameters, projectName string, detach bool) error {
+	name := stack.Name
+	provider := cli.NewProvider(ctx, stack.Provider, global.Client, stack.Name)
+	if err := provider.Authenticate(ctx, global.Interactive()); err != nil {
+		return fmt.Errorf("failed to authenticate with provider %q: %w", stack.Provider, err)
+	}
+
+	since := time.Now()
+	deployment, err := cli.ComposeDown(ctx, projectName, global.Client, provider)
+	if err != nil {
+		return err
+	}
+	term.Infof("Destroying preview stack %q, deployment ID %s", name, deployment)
+	if detach {
+		printDefangHint("To track the update, do:", "tail --project-name="+projectName+" --deployment="+deployment)
+		return nil
+	}
+
+	tailOptions := newTailOptionsForDown(name, deployment, since)
+	if err := cli.TailAndWaitForCD(ctx, provider, projectName, tailOptions); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	// The down succeeded, so there is no active deployment left to confirm: remove without prompting.
+	if err := cli.RemoveStack(ctx, global.Client, provider, ec, projectName, name, true); err != nil {
+		return err
+	}
+	term.Infof("Removed preview stack %q", name)
+	return nil
+}
@@ -0,0 +1,31 @@
+package command
+
+import (
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Args:  cobra.NoArgs,
+	Short: "Inspect the service quotas of the cloud account",
+}
+
+var quotaCheckCmd = &cobra.Command{
+	Use:         "check",
+	Args:        cobra.NoArgs,
+	Annotations: authNeededAlways,
+	Short:       "Check the project against the live service quotas of the cloud account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		session, err := newCommandSession(cmd)
+		if err != nil {
+			return err
+		}
+		project, err := session.Loader.LoadProject(ctx)
+		if err != nil {
+			return err
+		}
+		return cli.QuotaCheck(ctx, session.Provider, project)
+	},
+}
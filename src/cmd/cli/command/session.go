@@ -21,8 +21,9 @@ import (
 )
 
 type commandSessionOpts struct {
-	CheckAccountInfo   bool
-	AllowStackCreation bool
+	CheckAccountInfo    bool
+	AllowStackCreation  bool
+	ValidateStackSchema bool
 }
 
 func newCommandSession(cmd *cobra.Command) (*session.Session, error) {
@@ -43,6 +44,7 @@ func newCommandSessionWithOpts(cmd *cobra.Command, opts commandSessionOpts) (*se
 				AllowStackCreation: opts.AllowStackCreation,
 			},
 		},
+		ValidateStackSchema: opts.ValidateStackSchema,
 	}
 	sm, err := newStackManagerForLoader(ctx, compose.NewLoaderFromOptions(options.LoaderOptions))
 	if err != nil {
@@ -51,11 +53,20 @@ func newCommandSessionWithOpts(cmd *cobra.Command, opts commandSessionOpts) (*se
 		}
 		term.Debugf("Could not create stack manager: %v", err)
 	}
-	sessionLoader := session.NewSessionLoader(global.Client, sm, options)
+	sessionLoader := session.NewSessionLoader(global.Client, ec, sm, options)
 	session, err := sessionLoader.LoadSession(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if restrictions := currentTokenRestrictions(); restrictions.Project != "" || restrictions.Stack != "" {
+		projectName, _, err := session.Loader.LoadProjectName(ctx)
+		if err != nil {
+			term.Debug("Could not determine project name:", err)
+		}
+		if err := restrictions.CheckTarget(projectName, session.Stack.Name); err != nil {
+			return nil, err
+		}
+	}
 	if opts.CheckAccountInfo {
 		if err := session.Provider.Authenticate(ctx, global.Interactive()); err != nil {
 			return nil, fmt.Errorf("failed to authenticate with provider %q: %w", session.Stack.Provider, err)
@@ -186,7 +197,7 @@ func handleInvalidComposeFileErr(ctx context.Context, loadErr error) error {
 		return fmt.Errorf("%w; original error: %w", err, loadErr)
 	}
 
-	debugger, err := debug.NewDebugger(ctx, global.FabricAddr, &stacks.Parameters{}, !global.NonInteractive)
+	debugger, err := debug.NewDebugger(ctx, global.FabricAddr, &stacks.Parameters{}, !global.NonInteractive, agentOptions()...)
 	if err != nil {
 		return fmt.Errorf("%w; original error: %w", err, loadErr)
 	}
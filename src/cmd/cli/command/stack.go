@@ -3,9 +3,16 @@ package command
 import (
 	"context"
 	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"connectrpc.com/connect"
 	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
 	"github.com/DefangLabs/defang/src/pkg/modes"
 	"github.com/DefangLabs/defang/src/pkg/stacks"
 	"github.com/DefangLabs/defang/src/pkg/term"
@@ -29,6 +36,8 @@ func makeStackCmd() *cobra.Command {
 	stackRemoveCmd.Hidden = true
 	stackCmd.AddCommand(stackRemoveCmd)
 	stackCmd.AddCommand(makeStackShowCmd())
+	stackCmd.AddCommand(makeStackDiffCmd())
+	stackCmd.AddCommand(makeStackSyncCmd())
 	return stackCmd
 }
 
@@ -81,12 +90,17 @@ func makeStackNewCmd() *cobra.Command {
 				}
 			}
 
+			schema, err := loadStackSchema(ctx, loader)
+			if err != nil {
+				return err
+			}
+
 			if global.NonInteractive {
-				_, err := stacks.CreateInDirectory(".", params)
+				_, err := stacks.CreateInDirectory(".", params, schema)
 				return err
 			}
 
-			err = promptForStackParameters(ctx, &params)
+			err = promptForStackParameters(ctx, &params, schema)
 			if err != nil {
 				return err
 			}
@@ -101,7 +115,7 @@ func makeStackNewCmd() *cobra.Command {
 
 			term.Debugf("Creating stack with parameters: %+v\n", params)
 
-			_, err = stacks.CreateInDirectory(".", params)
+			_, err = stacks.CreateInDirectory(".", params, schema)
 			if err != nil {
 				return err
 			}
@@ -244,8 +258,9 @@ func makeStackShowCmd() *cobra.Command {
 				return fmt.Errorf("could not load stack parameters: %w", err)
 			}
 
-			// TODO: should keep the stack file as-is not (de)ser'ed
-			env, err := godotenv.Marshal(stack.ToMap())
+			// a stack imported from a previous deployment has no stack file to point to
+			_, statErr := os.Stat(filepath.Join(sm.TargetDirectory(), stacks.Directory, name))
+			env, err := formatResolvedStack(stack, statErr == nil)
 			if err != nil {
 				return fmt.Errorf("could not marshal: %w", err)
 			}
@@ -256,8 +271,95 @@ func makeStackShowCmd() *cobra.Command {
 	return stackShowCmd
 }
 
-func promptForStackParameters(ctx context.Context, params *stacks.Parameters) error {
-	wizard := stacks.NewWizard(ec, global.Client)
+func makeStackDiffCmd() *cobra.Command {
+	var stackDiffCmd = &cobra.Command{
+		Use:         "diff STACK_NAME",
+		Annotations: authNeededAlways, // stack tracked remotely
+		Args:        cobra.ExactArgs(1),
+		Short:       "Show differences between a local stack file and the remote stack",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			name := args[0]
+			loader := newLoaderForCommand(cmd)
+			sm, err := newStackManagerForLoader(ctx, loader)
+			if err != nil {
+				return err
+			}
+			projectName, _, err := loader.LoadProjectName(ctx)
+			if err != nil {
+				return err
+			}
+
+			comparison, err := cli.DiffStack(ctx, global.Client, sm.TargetDirectory(), projectName, name)
+			if err != nil {
+				return err
+			}
+			if len(comparison.Diffs) == 0 {
+				term.Infof("Stack %q is in sync with the remote stack", name)
+				return nil
+			}
+			return term.Table(comparison.Diffs, "Key", "Local", "Remote", "Change")
+		},
+	}
+	return stackDiffCmd
+}
+
+func makeStackSyncCmd() *cobra.Command {
+	var direction cli.SyncDirection
+	var stackSyncCmd = &cobra.Command{
+		Use:         "sync STACK_NAME",
+		Annotations: authNeededAlways, // stack tracked remotely
+		Args:        cobra.ExactArgs(1),
+		Short:       "Reconcile a local stack file with the remote stack",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			name := args[0]
+			loader := newLoaderForCommand(cmd)
+			sm, err := newStackManagerForLoader(ctx, loader)
+			if err != nil {
+				return err
+			}
+			projectName, _, err := loader.LoadProjectName(ctx)
+			if err != nil {
+				return err
+			}
+
+			diffs, err := cli.SyncStack(ctx, global.Client, sm.TargetDirectory(), projectName, name, direction)
+			if err != nil {
+				return err
+			}
+			if len(diffs) == 0 {
+				return nil
+			}
+			return term.Table(diffs, "Key", "Local", "Remote", "Change")
+		},
+	}
+	stackSyncCmd.Flags().Var(&direction, "direction", fmt.Sprintf("which side to update; one of [%s %s] (required)", cli.SyncPull, cli.SyncPush))
+	_ = stackSyncCmd.MarkFlagRequired("direction")
+	return stackSyncCmd
+}
+
+// formatResolvedStack returns the effective variables of the stack in dotenv
+// format. For a local stack, each line is annotated with the stack file the
+// value was resolved from.
+func formatResolvedStack(stack *stacks.Parameters, local bool) (string, error) {
+	vars := stack.ToMap()
+	lines := make([]string, 0, len(vars))
+	for _, key := range slices.Sorted(maps.Keys(vars)) {
+		line, err := godotenv.Marshal(map[string]string{key: vars[key]})
+		if err != nil {
+			return "", err
+		}
+		if local {
+			line = fmt.Sprintf("%s # %s", line, path.Join(stacks.Directory, stack.Source(key)))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func promptForStackParameters(ctx context.Context, params *stacks.Parameters, schema stacks.Schema) error {
+	wizard := stacks.NewWizard(ec, global.Client).WithSchema(schema)
 	newParams, err := wizard.CollectRemainingParameters(ctx, params)
 	if err != nil {
 		return err
@@ -267,6 +369,17 @@ func promptForStackParameters(ctx context.Context, params *stacks.Parameters) er
 	return nil
 }
 
+// loadStackSchema returns the x-defang-stack-schema of the Compose project, or
+// nil if there is no (valid) Compose project.
+func loadStackSchema(ctx context.Context, loader *compose.Loader) (stacks.Schema, error) {
+	project, err := loader.LoadProject(ctx)
+	if err != nil {
+		term.Debugf("Could not load project for stack schema: %v", err)
+		return nil, nil
+	}
+	return stacks.ParseSchema(project.Extensions)
+}
+
 func remoteStackExists(ctx context.Context, project string, stack string) (bool, error) {
 	if stack == "" {
 		return false, nil
@@ -129,7 +129,7 @@ func TestStackListCmd(t *testing.T) {
 				os.FileMode(0644),
 			)
 			for _, stack := range tt.stacks {
-				stacks.CreateInDirectory(".", stack)
+				stacks.CreateInDirectory(".", stack, nil)
 			}
 
 			buffer := new(bytes.Buffer)
@@ -454,3 +454,31 @@ func TestStackExists(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatResolvedStack(t *testing.T) {
+	stack := &stacks.Parameters{
+		Name:     "prod",
+		Extends:  "base",
+		Provider: client.ProviderAWS,
+		Region:   "us-east-1",
+		Variables: map[string]string{
+			"AWS_PROFILE": "shared",
+		},
+		Sources: map[string]string{
+			"DEFANG_PROVIDER": "base",
+			"AWS_PROFILE":     stacks.BaseName,
+		},
+	}
+	env, err := formatResolvedStack(stack, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `AWS_PROFILE="shared" # .defang/_base
+AWS_REGION="us-east-1" # .defang/prod
+DEFANG_PROVIDER="aws" # .defang/base`, env)
+
+	// a remote-only stack has no stack files to point to
+	env, err = formatResolvedStack(stack, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `AWS_PROFILE="shared"
+AWS_REGION="us-east-1"
+DEFANG_PROVIDER="aws"`, env)
+}
@@ -1,8 +1,18 @@
 package command
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+
 	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/scope"
+	"github.com/DefangLabs/defang/src/pkg/term"
 	"github.com/spf13/cobra"
 )
 
@@ -13,8 +23,196 @@ var tokenCmd = &cobra.Command{
 	Short:       "Manage personal access tokens",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var s, _ = cmd.Flags().GetString("scope")
+		if s == "" {
+			return cmd.Help()
+		}
 		var expires, _ = cmd.Flags().GetDuration("expires")
 
-		return cli.Token(cmd.Context(), global.Client, global.TenantSelection, expires, scope.Scope(s))
+		// Backwards compatible "defang token --scope=…"
+		name := "token-" + time.Now().UTC().Format("20060102T150405Z")
+		_, err := cli.CreateToken(cmd.Context(), global.Client, global.FabricAddr, global.TenantSelection, cli.CreateTokenParams{
+			Name:    name,
+			Expires: expires,
+			Scopes:  []scope.Scope{scope.Scope(s)},
+		})
+		return err
 	},
 }
+
+var tokenCreateCmd = &cobra.Command{
+	Use:         "create NAME",
+	Annotations: authNeededAlways,
+	Args:        cobra.ExactArgs(1),
+	Aliases:     []string{"new", "add"},
+	Short:       "Create a named, scoped access token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var scopes, _ = cmd.Flags().GetStringSlice("scope")
+		var expires, _ = cmd.Flags().GetDuration("expires")
+		var project, _ = cmd.Flags().GetString("restrict-project")
+		var stack, _ = cmd.Flags().GetString("restrict-stack")
+
+		params := cli.CreateTokenParams{
+			Name:    args[0],
+			Expires: expires,
+			Project: project,
+			Stack:   stack,
+		}
+		for _, s := range scopes {
+			params.Scopes = append(params.Scopes, scope.Scope(strings.TrimSpace(s)))
+		}
+		record, err := cli.CreateToken(cmd.Context(), global.Client, global.FabricAddr, global.TenantSelection, params)
+		if err != nil {
+			return err
+		}
+		term.Infof("Token %q expires at %s", record.Name, record.ExpiresAt.Local().Format(time.RFC3339))
+		printDefangHint("To revoke this token, do:", "token revoke "+record.Name)
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:     "ls",
+	Args:    cobra.NoArgs,
+	Aliases: []string{"list"},
+	Short:   "List the access tokens created with this CLI",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cli.ListTokens(global.FabricAddr)
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:     "revoke NAME [FILE]",
+	Args:    cobra.RangeArgs(1, 2),
+	Aliases: []string{"rm", "delete", "del", "remove"},
+	Short:   "Revoke an access token created with this CLI",
+	Long: `Revoke an access token created with this CLI. The token is not stored
+locally and the Fabric only lets a token revoke itself, so provide the token to
+revoke: from FILE, from stdin with "-" or in non-interactive mode, or at the prompt.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := readTokenToRevoke(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		if err := cli.RevokeToken(cmd.Context(), global.FabricAddr, global.TenantSelection, args[0], token); err != nil {
+			return err
+		}
+		term.Infof("Token %q revoked", args[0])
+		return nil
+	},
+}
+
+func readTokenToRevoke(name string, file []string) (string, error) {
+	if len(file) == 0 && !global.NonInteractive {
+		var token string
+		err := survey.AskOne(&survey.Password{
+			Message: fmt.Sprintf("Enter the access token %q to revoke:", name),
+		}, &token, survey.WithStdio(term.DefaultTerm.Stdio()))
+		return strings.TrimSpace(token), err
+	}
+	var bytes []byte
+	var err error
+	if len(file) == 1 && file[0] != "-" {
+		bytes, err = os.ReadFile(file[0])
+	} else {
+		bytes, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed reading the access token: %w", err)
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
+
+func completeScopes(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	var completions []cobra.Completion
+	for _, s := range scope.All() {
+		completions = append(completions, s.String())
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// commandScopes are the token scopes required by commands. Any command that is
+// not listed here requires an admin token, so that a new command is not allowed
+// for scoped tokens until it's added here.
+var commandScopes = map[string]scope.Scope{
+	"defang compose logs":       scope.Tail,
+	"defang compose tail":       scope.Tail,
+	"defang logs":               scope.Tail,
+	"defang tail":               scope.Tail,
+	"defang cd ls":              scope.Read,
+	"defang cd outputs":         scope.Read,
+	"defang cd state pending":   scope.Read,
+	"defang cd state show":      scope.Read,
+	"defang compose config":     scope.Read,
+	"defang compose ls":         scope.Read,
+	"defang compose ps":         scope.Read,
+	"defang config ls":          scope.Read,
+	"defang deployments":        scope.Read,
+	"defang deployments export": scope.Read,
+	"defang deployments show":   scope.Read,
+	"defang quota check":        scope.Read,
+	"defang recipe list":        scope.Read,
+	"defang recipe show":        scope.Read,
+	"defang services":           scope.Read,
+	"defang stack diff":         scope.Read,
+	"defang stack list":         scope.Read,
+	"defang stack show":         scope.Read,
+	"defang workspace":          scope.Read,
+	"defang workspace ls":       scope.Read,
+	"defang cd destroy":         scope.Delete,
+	"defang cd down":            scope.Delete,
+	"defang cd teardown":        scope.Delete,
+	"defang compose down":       scope.Delete,
+	"defang config rm":          scope.Delete,
+	"defang down":               scope.Delete,
+	"defang preview-env down":   scope.Delete,
+	"defang preview-env gc":     scope.Delete,
+	"defang stack remove":       scope.Delete,
+	// Commands that change the state or the lock of a deployment
+	"defang cd state repair": scope.Admin,
+	"defang cd unlock":       scope.Admin,
+	// Commands that don't use the Fabric, or only show help
+	"defang agent":                 scope.Any,
+	"defang agent sessions":        scope.Any,
+	"defang agent sessions list":   scope.Any,
+	"defang agent sessions remove": scope.Any,
+	"defang agent sessions show":   scope.Any,
+	"defang cd":                    scope.Any,
+	"defang cd state":              scope.Any,
+	"defang cert":                  scope.Any,
+	"defang compose":               scope.Any,
+	"defang config":                scope.Any,
+	"defang help":                  scope.Any,
+	"defang login":                 scope.Any,
+	"defang logout":                scope.Any,
+	"defang mcp":                   scope.Any,
+	"defang mcp setup":             scope.Any,
+	"defang preview-env":           scope.Any,
+	"defang quota":                 scope.Any,
+	"defang recipe":                scope.Any,
+	"defang stack":                 scope.Any,
+	"defang token ls":              scope.Any,
+	"defang token revoke":          scope.Any,
+	"defang upgrade":               scope.Any,
+	"defang version":               scope.Any,
+	"defang whoami":                scope.Any,
+}
+
+func requiredScope(cmd *cobra.Command) scope.Scope {
+	if s, ok := commandScopes[cmd.CommandPath()]; ok {
+		return s
+	}
+	return scope.Admin
+}
+
+func currentTokenRestrictions() cli.TokenRestrictions {
+	return cli.GetTokenRestrictions(global.FabricAddr, client.GetExistingToken(global.FabricAddr))
+}
+
+// checkTokenScope refuses to run a command that the access token in use is not
+// allowed to run, instead of failing halfway through with a Fabric error.
+func checkTokenScope(cmd *cobra.Command) error {
+	if err := currentTokenRestrictions().CheckScope(requiredScope(cmd)); err != nil {
+		return fmt.Errorf("cannot run %q: %w", cmd.CommandPath(), err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/scope"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		args []string
+		want scope.Scope
+	}{
+		{[]string{"compose", "down"}, scope.Delete},
+		{[]string{"down"}, scope.Delete},
+		{[]string{"compose", "up"}, scope.Admin},
+		{[]string{"tail"}, scope.Tail},
+		{[]string{"compose", "ps"}, scope.Read},
+		{[]string{"whoami"}, scope.Any},
+		{[]string{"version"}, scope.Any},
+		{[]string{"cd", "state", "repair"}, scope.Admin},
+		{[]string{"cd", "unlock"}, scope.Admin},
+	}
+	for _, tt := range tests {
+		cmd, _, err := RootCmd.Find(tt.args)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, requiredScope(cmd), tt.args)
+	}
+}
+
+func TestCommandScopesExist(t *testing.T) {
+	RootCmd.InitDefaultHelpCmd()
+	for path := range commandScopes {
+		args := strings.Fields(path)[1:]
+		cmd, _, err := RootCmd.Find(args)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, path, cmd.CommandPath(), "commandScopes has an entry for a command that does not exist")
+		}
+	}
+}
+
+func TestCheckTokenScope(t *testing.T) {
+	originalStateDir := client.StateDir
+	client.StateDir = t.TempDir()
+	t.Cleanup(func() { client.StateDir = originalStateDir })
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"scope": "read tail"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	t.Setenv("DEFANG_ACCESS_TOKEN", token)
+
+	down, _, err := RootCmd.Find([]string{"compose", "down"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, checkTokenScope(down), `cannot run "defang compose down": access token is limited to scopes [read tail], but this command requires scope "delete"`)
+
+	up, _, err := RootCmd.Find([]string{"compose", "up"})
+	require.NoError(t, err)
+	assert.Error(t, checkTokenScope(up))
+
+	for _, args := range [][]string{{"tail"}, {"compose", "ps"}, {"whoami"}, {"version"}} {
+		cmd, _, err := RootCmd.Find(args)
+		require.NoError(t, err)
+		assert.NoError(t, checkTokenScope(cmd), args)
+	}
+}
@@ -34,6 +34,7 @@ type Agent struct {
 	// interactive controls whether the agent runs a REPL and prompts for input/elicitations.
 	// When false (e.g. CI), the agent handles the initial message once and returns.
 	interactive bool
+	sessionID   string
 }
 
 // Option configures an Agent created by New.
@@ -41,6 +42,11 @@ type Option func(*agentConfig)
 
 type agentConfig struct {
 	interactive bool
+	autoApprove AutoApprove
+	sessions    *SessionStore
+	resumeID    string
+	// requireValidation makes the deploy tool require a successful validate_compose first
+	requireValidation bool
 }
 
 // WithNonInteractive runs the agent in one-shot mode: it handles the initial message to
@@ -50,18 +56,59 @@ func WithNonInteractive() Option {
 	return func(c *agentConfig) { c.interactive = false }
 }
 
+// WithAutoApprove applies the file changes of the agent to the given kinds of
+// files without confirmation; other changes are rejected in non-interactive mode.
+func WithAutoApprove(autoApprove AutoApprove) Option {
+	return func(c *agentConfig) { c.autoApprove = autoApprove }
+}
+
+// WithRequireValidation makes the agent validate the compose files with
+// validate_compose before it can deploy them.
+func WithRequireValidation(require bool) Option {
+	return func(c *agentConfig) { c.requireValidation = require }
+}
+
+// WithSessionStore saves the conversation in the given store. By default the
+// conversation is not saved.
+func WithSessionStore(store *SessionStore) Option {
+	return func(c *agentConfig) { c.sessions = store }
+}
+
+// WithResume continues the saved session with the given ID.
+func WithResume(sessionID string) Option {
+	return func(c *agentConfig) { c.resumeID = sessionID }
+}
+
 func New(ctx context.Context, fabricAddr string, stack *stacks.Parameters, opts ...Option) (*Agent, error) {
 	cfg := agentConfig{interactive: true}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
+	var session *Session
+	if cfg.resumeID != "" {
+		if cfg.sessions == nil {
+			return nil, errors.New("cannot resume a session without a session store")
+		}
+		var err error
+		if session, err = cfg.sessions.Load(cfg.resumeID); err != nil {
+			return nil, err
+		}
+		if err := session.CheckCwd(); err != nil {
+			return nil, err
+		}
+		restoreSessionStack(stack, session.Stack)
+	}
+
 	accessToken := client.GetExistingToken(fabricAddr)
 	aiProvider := "fabric"
 	var providerPlugin api.Plugin
 	addr := client.NormalizeHost(fabricAddr)
 	// Generate a random session ID prepended with timestamp for easier sorting
 	sessionID := fmt.Sprintf("%s-%s", time.Now().Format("20060102T150405Z"), pkg.RandomID())
+	if session != nil {
+		sessionID = session.ID
+	}
 	providerPlugin = &fabric.OpenAI{
 		APIKey: accessToken,
 		Opts: []option.RequestOption{
@@ -90,12 +137,15 @@ func New(ctx context.Context, fabricAddr string, stack *stacks.Parameters, opts
 	printer := printer{outStream: os.Stdout}
 	toolManager := NewToolManager(gk, printer)
 	defangTools := tools.CollectDefangTools(ec, tools.StackConfig{
-		FabricAddr: fabricAddr,
-		Stack:      stack,
+		FabricAddr:        fabricAddr,
+		Stack:             stack,
+		RequireValidation: cfg.requireValidation,
 	})
 	toolManager.RegisterTools(defangTools...)
 	fsTools := CollectFsTools()
 	toolManager.RegisterTools(fsTools...)
+	fsWriteTools := CollectFsWriteTools(ec, printer, cfg.autoApprove)
+	toolManager.RegisterTools(fsWriteTools...)
 
 	generator := NewGenerator(
 		gk,
@@ -103,6 +153,13 @@ func New(ctx context.Context, fabricAddr string, stack *stacks.Parameters, opts
 		toolManager,
 	)
 
+	if session != nil {
+		generator.messages = session.Messages
+	}
+	if cfg.sessions != nil {
+		generator.onMessage = saveSession(cfg.sessions, sessionID, session, stack)
+	}
+
 	preparedSystemPrompt, err := prepareSystemPrompt()
 	if err != nil {
 		return nil, err
@@ -113,11 +170,69 @@ func New(ctx context.Context, fabricAddr string, stack *stacks.Parameters, opts
 		generator:   generator,
 		system:      preparedSystemPrompt,
 		interactive: cfg.interactive,
+		sessionID:   sessionID,
+	}
+	if session != nil {
+		printer.Printf("Resuming session %s with %d messages.\n", sessionID, len(session.Messages))
 	}
 
 	return a, nil
 }
 
+// saveSession returns the callback that appends the messages of the
+// conversation to the session file. The file is created on the first message,
+// so sessions without messages are not saved.
+func saveSession(store *SessionStore, sessionID string, resumed *Session, stack *stacks.Parameters) func(*ai.Message) {
+	var w *sessionWriter
+	var failed bool
+	return func(message *ai.Message) {
+		if failed {
+			return
+		}
+		if w == nil {
+			var err error
+			if resumed != nil {
+				w, err = store.resume(resumed)
+			} else {
+				w, err = store.Create(sessionID, stack)
+			}
+			if err != nil {
+				failed = true
+				term.Warnf("Failed to save the agent session: %v", err)
+				return
+			}
+		}
+		if err := w.Append(message, stack); err != nil {
+			failed = true
+			term.Warnf("Failed to save the agent session: %v", err)
+		}
+	}
+}
+
+// restoreSessionStack selects the stack of a resumed session, unless a stack
+// was selected explicitly.
+func restoreSessionStack(stack *stacks.Parameters, saved SessionStack) {
+	if stack == nil || stack.Name != "" || saved.Name == "" {
+		return
+	}
+	if params, err := stacks.ReadInDirectory(".", saved.Name); err == nil {
+		if err := stacks.LoadStackEnv(*params, true); err == nil {
+			*stack = *params
+			return
+		}
+	}
+	term.Debugf("Stack %q of the session was not found; using the saved parameters", saved.Name)
+	stack.Name = saved.Name
+	stack.Provider = saved.Provider
+	stack.Region = saved.Region
+	stack.Recipe = saved.Recipe
+}
+
+// SessionID returns the ID of the saved session, which can be resumed later.
+func (a *Agent) SessionID() string {
+	return a.sessionID
+}
+
 func (a *Agent) StartWithUserPrompt(ctx context.Context, userPrompt string) error {
 	a.printer.Printf("\n%s\n", userPrompt)
 	// The userPrompt is for the user only. Start the session with an empty message for the agent.
@@ -159,6 +274,7 @@ func (a *Agent) startSession(ctx context.Context, initialMessage string) error {
 		)
 		if err != nil {
 			if errors.Is(err, terminal.InterruptErr) {
+				a.printResumeHint()
 				return nil
 			}
 			return fmt.Errorf("error reading input: %w", err)
@@ -170,6 +286,7 @@ func (a *Agent) startSession(ctx context.Context, initialMessage string) error {
 		}
 
 		if input == "/exit" {
+			a.printResumeHint()
 			return nil
 		}
 
@@ -182,6 +299,12 @@ func (a *Agent) startSession(ctx context.Context, initialMessage string) error {
 	}
 }
 
+func (a *Agent) printResumeHint() {
+	if a.generator.onMessage != nil && len(a.generator.messages) > 0 {
+		a.printer.Printf("To continue this conversation, run: defang agent sessions resume %s\n", a.sessionID)
+	}
+}
+
 func (a *Agent) handleUserMessage(ctx context.Context, msg string) error {
 	// Handle Ctrl+C during message handling / tool calls
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
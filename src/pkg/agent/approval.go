@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FileKind classifies the files that the agent can change, for the approval policy.
+type FileKind string
+
+const (
+	FileKindCompose    FileKind = "compose"
+	FileKindDockerfile FileKind = "dockerfile"
+)
+
+var allFileKinds = []FileKind{FileKindCompose, FileKindDockerfile}
+
+// fileKind returns the kind of the file at path, or "" if it is neither a
+// compose file nor a Dockerfile.
+func fileKind(path string) FileKind {
+	base := strings.ToLower(filepath.Base(path))
+	ext := filepath.Ext(base)
+	switch {
+	case (ext == ".yaml" || ext == ".yml") && (strings.HasPrefix(base, "compose.") || strings.HasPrefix(base, "docker-compose.")):
+		return FileKindCompose
+	case base == "dockerfile" || strings.HasPrefix(base, "dockerfile.") || ext == ".dockerfile":
+		return FileKindDockerfile
+	}
+	return ""
+}
+
+// AutoApprove is the policy of the file changes that are applied without
+// confirmation, like "compose,dockerfile". It implements pflag.Value.
+type AutoApprove []FileKind
+
+func (a AutoApprove) String() string {
+	kinds := make([]string, len(a))
+	for i, kind := range a {
+		kinds[i] = string(kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+func (a *AutoApprove) Set(s string) error {
+	var kinds AutoApprove
+	for kind := range strings.SplitSeq(s, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "" {
+			continue
+		}
+		if !slices.Contains(allFileKinds, FileKind(kind)) {
+			return fmt.Errorf("invalid file kind %q; must be one of %v", kind, allFileKinds)
+		}
+		kinds = append(kinds, FileKind(kind))
+	}
+	*a = kinds
+	return nil
+}
+
+func (AutoApprove) Type() string {
+	return "kinds"
+}
+
+// Approves reports whether changes to the file at path are applied without confirmation.
+func (a AutoApprove) Approves(path string) bool {
+	kind := fileKind(path)
+	return kind != "" && slices.Contains(a, kind)
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKind(t *testing.T) {
+	tests := map[string]FileKind{
+		"compose.yaml":                FileKindCompose,
+		"app/compose.yml":             FileKindCompose,
+		"docker-compose.override.yml": FileKindCompose,
+		"compose.txt":                 "",
+		"Dockerfile":                  FileKindDockerfile,
+		"api/Dockerfile.dev":          FileKindDockerfile,
+		"worker.dockerfile":           FileKindDockerfile,
+		"main.go":                     "",
+		".dockerignore":               "",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, fileKind(path), path)
+	}
+}
+
+func TestAutoApprove(t *testing.T) {
+	var a AutoApprove
+	assert.False(t, a.Approves("compose.yaml"))
+
+	require.NoError(t, a.Set("compose, Dockerfile"))
+	assert.Equal(t, "compose,dockerfile", a.String())
+	assert.True(t, a.Approves("compose.yaml"))
+	assert.True(t, a.Approves("app/Dockerfile"))
+	assert.False(t, a.Approves("main.go"))
+
+	require.NoError(t, a.Set("compose"))
+	assert.False(t, a.Approves("Dockerfile"))
+
+	require.ErrorContains(t, a.Set("compose,secrets"), `invalid file kind "secrets"`)
+}
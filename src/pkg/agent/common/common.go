@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/DefangLabs/defang/src/pkg/cli/compose"
 	"github.com/DefangLabs/defang/src/pkg/session"
@@ -45,10 +46,18 @@ func ConfigureAgentLoader(params LoaderParams, stack *stacks.Parameters) (*compo
 	var opts []compose.LoaderOption
 
 	if stack != nil {
-		opts = append(opts, compose.WithInterpolationEnv(map[string]string{
+		// Pass the COMPOSE_* variables of the stack to the loader explicitly, so
+		// loading doesn't depend on the stack env being applied to the process.
+		interpolationEnv := map[string]string{
 			"DEFANG_PROVIDER": stack.Provider.String(),
 			"DEFANG_STACK":    stack.Name,
-		}), compose.WithDefaultEnvFiles(session.StackEnvFiles(stack)...))
+		}
+		for key, value := range stack.ToMap() {
+			if strings.HasPrefix(key, "COMPOSE_") {
+				interpolationEnv[key] = value
+			}
+		}
+		opts = append(opts, compose.WithInterpolationEnv(interpolationEnv), compose.WithDefaultEnvFiles(session.StackEnvFiles(stack)...))
 	}
 
 	if params.ProjectName != "" {
@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/muesli/termenv"
+)
+
+type WriteFileParams struct {
+	Path    string `json:"path" jsonschema:"description=The path of the existing file to overwrite."`
+	Content string `json:"content" jsonschema:"description=The new content of the file."`
+}
+
+type ApplyPatchParams struct {
+	Path  string `json:"path" jsonschema:"description=The path of the file to patch."`
+	Patch string `json:"patch" jsonschema:"description=A unified diff of the changes to the file, with @@ hunk headers and 3 lines of context."`
+}
+
+type CreateFileParams struct {
+	Path    string `json:"path" jsonschema:"description=The path of the new file; parent directories are created as needed."`
+	Content string `json:"content" jsonschema:"description=The content of the new file."`
+}
+
+type UndoFileChangeParams struct{}
+
+// fileEditor applies the file changes of the agent once they are approved,
+// either by the AutoApprove policy or by the user.
+type fileEditor struct {
+	ec          elicitations.Controller
+	printer     Printer
+	autoApprove AutoApprove
+	canColor    bool
+	now         func() time.Time
+}
+
+// edit changes the file at path to the content returned by change, which is
+// given the current content, or nil if the file doesn't exist. Rejections are
+// returned as results, not errors, so the model can adapt.
+func (e *fileEditor) edit(ctx context.Context, tool, path string, change func(old []byte) ([]byte, error)) (string, error) {
+	root, name, err := openCwdRoot(path)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+	name = filepath.Clean(name)
+	if err := checkProtected(path, name); err != nil {
+		return "", err
+	}
+
+	var mode fs.FileMode = 0o644
+	old, err := root.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		old = nil
+	} else if err != nil {
+		return "", rootPathError("open", path, err)
+	} else {
+		if old == nil {
+			old = []byte{} // exists, but empty
+		}
+		if info, err := root.Stat(name); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	content, err := change(old)
+	if err != nil {
+		return "", err
+	}
+	if old != nil && bytes.Equal(old, content) {
+		return fmt.Sprintf("No changes to %s", path), nil
+	}
+
+	e.printDiff(unifiedDiff(filepath.ToSlash(name), old, content))
+	if approved, reason, err := e.approve(ctx, name); err != nil {
+		return "", err
+	} else if !approved {
+		return fmt.Sprintf("The change to %s was not applied: %s", path, reason), nil
+	}
+
+	if err := appendJournal(root, journalEntry{
+		Time:     e.now(),
+		Tool:     tool,
+		Path:     name,
+		Existed:  old != nil,
+		Mode:     mode,
+		Previous: old,
+	}); err != nil {
+		return "", fmt.Errorf("failed to record the change in the undo journal: %w", err)
+	}
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0o755); err != nil {
+			return "", rootPathError("mkdir", path, err)
+		}
+	}
+	if err := root.WriteFile(name, content, mode); err != nil {
+		return "", rootPathError("write", path, err)
+	}
+	return fmt.Sprintf("Successfully applied the change to %s", path), nil
+}
+
+// checkProtected rejects changes to the agent's own files and the stack files,
+// also when they are reached through a symlink or by a name that differs only
+// in case, which resolves to the same file on case-insensitive filesystems.
+func checkProtected(path, name string) error {
+	resolved, err := resolveSymlinks(name)
+	if err != nil {
+		return rootPathError("open", path, err)
+	}
+	for _, name := range []string{name, resolved} {
+		if hasPathPrefixFold(name, journalDir) {
+			return fmt.Errorf("%s: cannot change the agent's own files", path)
+		}
+		// The stack files select the provider, account and region; the agent must not redirect a deployment
+		if hasPathPrefixFold(name, stacks.Directory) {
+			return fmt.Errorf("%s: cannot change the stack files; use the stack tools instead", path)
+		}
+	}
+	return nil
+}
+
+// hasPathPrefixFold reports whether name is dir or a path in dir, ignoring case.
+func hasPathPrefixFold(name, dir string) bool {
+	if len(name) < len(dir) || !strings.EqualFold(name[:len(dir)], dir) {
+		return false
+	}
+	return len(name) == len(dir) || name[len(dir)] == filepath.Separator
+}
+
+// maxSymlinks bounds the symlinks followed by resolveSymlinks, like the kernel does.
+const maxSymlinks = 40
+
+// resolveSymlinks returns the path, relative to the working directory, that
+// the given relative name refers to once all symlinks are followed. The file,
+// or some of its parents, may not exist yet, and a symlink may point to one
+// of those, so the existing part is resolved one link at a time.
+func resolveSymlinks(name string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	realCwd, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+	resolved := realCwd
+	rest := strings.Split(name, string(filepath.Separator))
+	for links := 0; len(rest) > 0; {
+		next := filepath.Join(resolved, rest[0])
+		rest = rest[1:]
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			resolved = filepath.Join(append([]string{next}, rest...)...)
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: "open", Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = string(filepath.Separator)
+			if volume := filepath.VolumeName(target); volume != "" {
+				resolved = volume + string(filepath.Separator)
+				target = target[len(volume):]
+			}
+		}
+		rest = append(strings.Split(filepath.Clean(target), string(filepath.Separator)), rest...)
+	}
+	return filepath.Rel(realCwd, resolved)
+}
+
+// approve asks the user to confirm the change to the file, unless the policy approves it.
+func (e *fileEditor) approve(ctx context.Context, path string) (bool, string, error) {
+	if e.autoApprove.Approves(path) {
+		return true, "", nil
+	}
+	if !e.ec.IsSupported() {
+		return false, "changes to this file require confirmation, which is not possible in non-interactive mode; suggest the change to the user instead", nil
+	}
+	answer, err := e.ec.RequestEnum(ctx, fmt.Sprintf("Apply this change to %s?", path), "apply", []string{"yes", "no"})
+	if err != nil {
+		return false, "", err
+	}
+	if answer != "yes" {
+		return false, "the user rejected the change; ask them what to do instead", nil
+	}
+	return true, "", nil
+}
+
+func (e *fileEditor) printDiff(diff string) {
+	b := term.NewMessageBuilder(e.canColor)
+	for line := range strings.SplitAfterSeq(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			b.WriteString(line)
+		case strings.HasPrefix(line, "+"):
+			b.Printc(termenv.ANSIGreen, line)
+		case strings.HasPrefix(line, "-"):
+			b.Printc(termenv.ANSIRed, line)
+		case strings.HasPrefix(line, "@@"):
+			b.Printc(term.BrightCyan, line)
+		default:
+			b.WriteString(line)
+		}
+	}
+	e.printer.Printf("\n%s\n", b.String())
+}
+
+func (e *fileEditor) undo(ctx context.Context) (string, error) {
+	root, err := openCwdRootDir()
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	last, err := lastJournalEntry(root)
+	if errors.Is(err, errJournalEmpty) {
+		return "There are no file changes to undo", nil
+	} else if err != nil {
+		return "", err
+	}
+	current, err := root.ReadFile(last.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", rootPathError("open", last.Path, err)
+	}
+	if last.Existed {
+		e.printDiff(unifiedDiff(filepath.ToSlash(last.Path), current, last.Previous))
+	} else {
+		e.printDiff(fmt.Sprintf("Delete %s, which was created by %s\n", last.Path, last.Tool))
+	}
+	if approved, reason, err := e.approve(ctx, last.Path); err != nil {
+		return "", err
+	} else if !approved {
+		return fmt.Sprintf("The change to %s was not undone: %s", last.Path, reason), nil
+	}
+
+	if _, err := undoLastChange(root); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Successfully undid the %s change to %s", last.Tool, last.Path), nil
+}
+
+func openCwdRootDir() (*os.Root, error) {
+	root, _, err := openCwdRoot(".")
+	return root, err
+}
+
+// CollectFsWriteTools returns the tools that change files in the working
+// directory. Each change is shown as a diff and must be approved, and is
+// recorded in an undo journal in .defang/agent.
+func CollectFsWriteTools(ec elicitations.Controller, printer Printer, autoApprove AutoApprove) []ai.Tool {
+	e := &fileEditor{
+		ec:          ec,
+		printer:     printer,
+		autoApprove: autoApprove,
+		canColor:    term.StdoutCanColor(),
+		now:         time.Now,
+	}
+	return []ai.Tool{
+		ai.NewTool(
+			"write_file",
+			"Overwrite the contents of an existing file on the local filesystem; the user must approve the change",
+			func(ctx *ai.ToolContext, params WriteFileParams) (string, error) {
+				return e.edit(ctx.Context, "write_file", params.Path, func(old []byte) ([]byte, error) {
+					if old == nil {
+						return nil, fmt.Errorf("%s does not exist; use create_file to create it", params.Path)
+					}
+					return []byte(params.Content), nil
+				})
+			},
+		),
+		ai.NewTool(
+			"apply_patch",
+			"Apply a unified diff to an existing file on the local filesystem; the user must approve the change",
+			func(ctx *ai.ToolContext, params ApplyPatchParams) (string, error) {
+				return e.edit(ctx.Context, "apply_patch", params.Path, func(old []byte) ([]byte, error) {
+					if old == nil {
+						return nil, fmt.Errorf("%s does not exist; use create_file to create it", params.Path)
+					}
+					patched, err := applyUnifiedDiff(string(old), params.Patch)
+					if err != nil {
+						return nil, fmt.Errorf("failed to apply patch to %s: %w; read the file and try again", params.Path, err)
+					}
+					return []byte(patched), nil
+				})
+			},
+		),
+		ai.NewTool(
+			"create_file",
+			"Create a new file on the local filesystem; the user must approve the change",
+			func(ctx *ai.ToolContext, params CreateFileParams) (string, error) {
+				return e.edit(ctx.Context, "create_file", params.Path, func(old []byte) ([]byte, error) {
+					if old != nil {
+						return nil, fmt.Errorf("%s already exists; use write_file or apply_patch to change it", params.Path)
+					}
+					return []byte(params.Content), nil
+				})
+			},
+		),
+		ai.NewTool(
+			"undo_file_change",
+			"Undo the most recent file change made by write_file, apply_patch or create_file",
+			func(ctx *ai.ToolContext, params UndoFileChangeParams) (string, error) {
+				return e.undo(ctx.Context)
+			},
+		),
+	}
+}
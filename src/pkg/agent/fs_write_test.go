@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedController answers the confirmations with the given answers, in order.
+type scriptedController struct {
+	answers   []string
+	supported bool
+	messages  []string
+}
+
+func (c *scriptedController) RequestString(ctx context.Context, message, field string, opts ...func(*elicitations.Options)) (string, error) {
+	panic("unexpected RequestString")
+}
+
+func (c *scriptedController) RequestEnum(ctx context.Context, message, field string, options []string) (string, error) {
+	c.messages = append(c.messages, message)
+	answer := c.answers[0]
+	c.answers = c.answers[1:]
+	return answer, nil
+}
+
+func (c *scriptedController) SetSupported(supported bool) { c.supported = supported }
+func (c *scriptedController) IsSupported() bool           { return c.supported }
+
+func fsWriteTools(t *testing.T, ec elicitations.Controller, autoApprove AutoApprove) (map[string]ai.Tool, *mockPrinter) {
+	t.Helper()
+	printer := &mockPrinter{}
+	tools := make(map[string]ai.Tool)
+	for _, tool := range CollectFsWriteTools(ec, printer, autoApprove) {
+		tools[tool.Name()] = tool
+	}
+	return tools, printer
+}
+
+func runTool(t *testing.T, tool ai.Tool, input map[string]any) (string, error) {
+	t.Helper()
+	output, err := tool.RunRaw(t.Context(), input)
+	if err != nil {
+		return "", err
+	}
+	return output.(string), nil
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestFsWriteToolsWithConfirmation(t *testing.T) {
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	ec := &scriptedController{supported: true, answers: []string{"yes", "no", "yes", "yes", "yes", "yes", "yes"}}
+	tools, printer := fsWriteTools(t, ec, nil)
+
+	result, err := runTool(t, tools["create_file"], map[string]any{"path": "app/Dockerfile", "content": "FROM node:20\nCMD node app.js\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "Successfully applied the change to app/Dockerfile", result)
+	assert.Equal(t, "FROM node:20\nCMD node app.js\n", readFile(t, filepath.Join(cwd, "app", "Dockerfile")))
+	assert.Equal(t, []string{"Apply this change to app/Dockerfile?"}, ec.messages)
+	assert.Contains(t, strings.Join(printer.output, ""), "--- /dev/null\n+++ b/app/Dockerfile\n")
+
+	_, err = runTool(t, tools["create_file"], map[string]any{"path": "app/Dockerfile", "content": "FROM scratch\n"})
+	require.ErrorContains(t, err, "already exists")
+
+	// The user rejects the change
+	result, err = runTool(t, tools["write_file"], map[string]any{"path": "app/Dockerfile", "content": "FROM scratch\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "The change to app/Dockerfile was not applied: the user rejected the change")
+	assert.Equal(t, "FROM node:20\nCMD node app.js\n", readFile(t, filepath.Join(cwd, "app", "Dockerfile")))
+
+	result, err = runTool(t, tools["write_file"], map[string]any{"path": filepath.Join(cwd, "app", "Dockerfile"), "content": "FROM node:22\nCMD node app.js\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "Successfully applied")
+
+	result, err = runTool(t, tools["apply_patch"], map[string]any{"path": "app/Dockerfile", "patch": "@@ -2 +2 @@\n-CMD node app.js\n+CMD [\"node\", \"app.js\"]\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "Successfully applied")
+	assert.Equal(t, "FROM node:22\nCMD [\"node\", \"app.js\"]\n", readFile(t, filepath.Join(cwd, "app", "Dockerfile")))
+
+	// Undo the patch, then the write; the rejected change was never recorded
+	result, err = runTool(t, tools["undo_file_change"], map[string]any{})
+	require.NoError(t, err)
+	assert.Equal(t, "Successfully undid the apply_patch change to app/Dockerfile", result)
+	assert.Equal(t, "FROM node:22\nCMD node app.js\n", readFile(t, filepath.Join(cwd, "app", "Dockerfile")))
+
+	_, err = runTool(t, tools["undo_file_change"], map[string]any{})
+	require.NoError(t, err)
+	assert.Equal(t, "FROM node:20\nCMD node app.js\n", readFile(t, filepath.Join(cwd, "app", "Dockerfile")))
+
+	_, err = runTool(t, tools["undo_file_change"], map[string]any{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(cwd, "app", "Dockerfile"))
+
+	result, err = runTool(t, tools["undo_file_change"], map[string]any{})
+	require.NoError(t, err)
+	assert.Equal(t, "There are no file changes to undo", result)
+	assert.Empty(t, ec.answers)
+}
+
+func TestFsWriteToolsNonInteractive(t *testing.T) {
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	require.NoError(t, os.WriteFile("compose.yaml", []byte("services:\n  app:\n    build: .\n"), 0o600))
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n"), 0o600))
+
+	ec := &scriptedController{supported: false}
+	tools, _ := fsWriteTools(t, ec, AutoApprove{FileKindCompose})
+
+	result, err := runTool(t, tools["write_file"], map[string]any{"path": "compose.yaml", "content": "services:\n  app:\n    build: .\n    restart: always\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "Successfully applied")
+	info, err := os.Stat("compose.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "the mode of the file is kept")
+
+	result, err = runTool(t, tools["write_file"], map[string]any{"path": "main.go", "content": "package app\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "not possible in non-interactive mode")
+	assert.Equal(t, "package main\n", readFile(t, "main.go"))
+	assert.Empty(t, ec.messages)
+}
+
+func TestFsWriteToolsConfinement(t *testing.T) {
+	parent := t.TempDir()
+	cwd := filepath.Join(parent, "cwd")
+	require.NoError(t, os.Mkdir(cwd, 0o755))
+	t.Chdir(cwd)
+
+	tools, _ := fsWriteTools(t, &scriptedController{supported: true, answers: []string{"yes", "yes"}}, nil)
+	for _, path := range []string{"../outside", filepath.Join(parent, "outside")} {
+		_, err := runTool(t, tools["create_file"], map[string]any{"path": path, "content": "escaped"})
+		assert.Error(t, err, path)
+	}
+	assert.NoFileExists(t, filepath.Join(parent, "outside"))
+
+	_, err := runTool(t, tools["create_file"], map[string]any{"path": ".defang/agent/journal.jsonl", "content": ""})
+	require.ErrorContains(t, err, "cannot change the agent's own files")
+
+	for _, path := range []string{".defang/prod", ".defang/_base", "./.defang/../.defang/beta"} {
+		_, err = runTool(t, tools["create_file"], map[string]any{"path": path, "content": "DEFANG_PROVIDER=aws"})
+		require.ErrorContains(t, err, "cannot change the stack files", path)
+	}
+	assert.NoDirExists(t, filepath.Join(cwd, ".defang"))
+
+	// case-insensitive filesystems resolve these to the same files
+	_, err = runTool(t, tools["create_file"], map[string]any{"path": ".Defang/Agent/journal.jsonl", "content": ""})
+	require.ErrorContains(t, err, "cannot change the agent's own files")
+	_, err = runTool(t, tools["create_file"], map[string]any{"path": ".DEFANG/prod", "content": "DEFANG_PROVIDER=aws"})
+	require.ErrorContains(t, err, "cannot change the stack files")
+}
+
+func TestFsWriteToolsSymlinks(t *testing.T) {
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	require.NoError(t, os.MkdirAll(filepath.Join(".defang", "agent"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(".defang", "prod"), []byte("DEFANG_PROVIDER=aws\n"), 0o644))
+	require.NoError(t, os.Symlink(".defang", "stacks"))
+	require.NoError(t, os.Symlink(filepath.Join(".defang", "agent", "journal.jsonl"), "journal")) // doesn't exist yet
+	require.NoError(t, os.Symlink(filepath.Join(cwd, ".defang", "beta"), "beta"))                 // absolute
+	require.NoError(t, os.Symlink("link2", "link1"))
+	require.NoError(t, os.Symlink(filepath.Join("stacks", "prod"), "link2"))
+
+	tools, _ := fsWriteTools(t, &scriptedController{supported: true, answers: []string{"yes", "yes", "yes", "yes", "yes"}}, nil)
+	_, err := runTool(t, tools["write_file"], map[string]any{"path": "stacks/prod", "content": "DEFANG_PROVIDER=gcp"})
+	require.ErrorContains(t, err, "cannot change the stack files")
+	_, err = runTool(t, tools["write_file"], map[string]any{"path": "link1", "content": "DEFANG_PROVIDER=gcp"})
+	require.ErrorContains(t, err, "cannot change the stack files")
+	_, err = runTool(t, tools["create_file"], map[string]any{"path": "beta", "content": "DEFANG_PROVIDER=gcp"})
+	require.ErrorContains(t, err, "cannot change the stack files")
+	_, err = runTool(t, tools["create_file"], map[string]any{"path": "journal", "content": ""})
+	require.ErrorContains(t, err, "cannot change the agent's own files")
+	assert.Equal(t, "DEFANG_PROVIDER=aws\n", readFile(t, filepath.Join(".defang", "prod")))
+	assert.NoFileExists(t, filepath.Join(".defang", "beta"))
+
+	// symlinks to other files are fine
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n"), 0o644))
+	require.NoError(t, os.Symlink("main.go", "main"))
+	result, err := runTool(t, tools["write_file"], map[string]any{"path": "main", "content": "package app\n"})
+	require.NoError(t, err)
+	assert.Contains(t, result, "Successfully applied")
+	assert.Equal(t, "package app\n", readFile(t, "main.go"))
+}
+
+func TestJournal(t *testing.T) {
+	cwd := t.TempDir()
+	root, err := os.OpenRoot(cwd)
+	require.NoError(t, err)
+	defer root.Close()
+
+	_, err = lastJournalEntry(root)
+	require.ErrorIs(t, err, errJournalEmpty)
+
+	require.NoError(t, root.WriteFile("compose.yaml", []byte("new"), 0o644))
+	entry := journalEntry{Time: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Tool: "write_file", Path: "compose.yaml", Existed: true, Mode: 0o644, Previous: []byte("old\x00binary")}
+	require.NoError(t, appendJournal(root, entry))
+
+	assert.Equal(t, "*\n", readFile(t, filepath.Join(cwd, ".defang", "agent", ".gitignore")))
+
+	last, err := lastJournalEntry(root)
+	require.NoError(t, err)
+	assert.Equal(t, entry, last)
+
+	undone, err := undoLastChange(root)
+	require.NoError(t, err)
+	assert.Equal(t, entry, undone)
+	assert.Equal(t, "old\x00binary", readFile(t, filepath.Join(cwd, "compose.yaml")))
+	_, err = undoLastChange(root)
+	require.ErrorIs(t, err, errJournalEmpty)
+}
@@ -33,6 +33,8 @@ type Generator struct {
 	genkitGenerator GenkitGenerator
 	printer         Printer
 	toolManager     *ToolManager
+	// onMessage is called with every message added to the conversation.
+	onMessage func(*ai.Message)
 }
 
 func NewGenerator(genkit *genkit.Genkit, printer Printer, toolManager *ToolManager) *Generator {
@@ -65,7 +67,7 @@ func (g *Generator) HandleMessage(ctx context.Context, prompt string, maxTurns i
 	g.toolManager.ClearPrevious()
 
 	if message != nil {
-		g.messages = append(g.messages, message)
+		g.appendMessage(message)
 	}
 	for range maxTurns {
 		resp, err := g.generate(ctx, prompt, g.messages)
@@ -77,7 +79,7 @@ func (g *Generator) HandleMessage(ctx context.Context, prompt string, maxTurns i
 			continue
 		}
 
-		g.messages = append(g.messages, resp.Message)
+		g.appendMessage(resp.Message)
 
 		toolRequests := resp.ToolRequests()
 		if len(toolRequests) == 0 {
@@ -89,12 +91,19 @@ func (g *Generator) HandleMessage(ctx context.Context, prompt string, maxTurns i
 			// HandleToolCalls only ever returns "fatal" errors
 			return err
 		}
-		g.messages = append(g.messages, toolResp)
+		g.appendMessage(toolResp)
 	}
 
 	return &maxTurnsReachedError{}
 }
 
+func (g *Generator) appendMessage(message *ai.Message) {
+	g.messages = append(g.messages, message)
+	if g.onMessage != nil {
+		g.onMessage(message)
+	}
+}
+
 func (g *Generator) generate(ctx context.Context, prompt string, messages []*ai.Message) (*ai.ModelResponse, error) {
 	g.printer.Println("* Thinking...")
 	resp, err := g.genkitGenerator.Generate(
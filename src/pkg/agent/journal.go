@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalDir is where the agent keeps its state in the project, next to the stack files.
+var journalDir = filepath.Join(".defang", "agent")
+
+var journalFile = filepath.Join(journalDir, "journal.jsonl")
+
+var errJournalEmpty = errors.New("there are no changes to undo")
+
+// journalEntry records the content of a file before the agent changed it.
+type journalEntry struct {
+	Time     time.Time   `json:"time"`
+	Tool     string      `json:"tool"`
+	Path     string      `json:"path"`
+	Existed  bool        `json:"existed"`
+	Mode     fs.FileMode `json:"mode,omitempty"`
+	Previous []byte      `json:"previous,omitempty"`
+}
+
+// appendJournal adds an entry to the undo journal in root.
+func appendJournal(root *os.Root, entry journalEntry) error {
+	if err := root.MkdirAll(journalDir, 0o755); err != nil {
+		return err
+	}
+	// The stack files in .defang are committed, but the journal is local
+	gitignore := filepath.Join(journalDir, ".gitignore")
+	if _, err := root.Stat(gitignore); errors.Is(err, fs.ErrNotExist) {
+		if err := root.WriteFile(gitignore, []byte("*\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := root.OpenFile(journalFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func readJournal(root *os.Root) ([]journalEntry, error) {
+	content, err := root.ReadFile(journalFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1) // entries hold whole files
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// lastJournalEntry returns the most recent change, or errJournalEmpty.
+func lastJournalEntry(root *os.Root) (journalEntry, error) {
+	entries, err := readJournal(root)
+	if err != nil {
+		return journalEntry{}, err
+	}
+	if len(entries) == 0 {
+		return journalEntry{}, errJournalEmpty
+	}
+	return entries[len(entries)-1], nil
+}
+
+// undoLastChange restores the file of the most recent change and removes the
+// change from the journal.
+func undoLastChange(root *os.Root) (journalEntry, error) {
+	entries, err := readJournal(root)
+	if err != nil {
+		return journalEntry{}, err
+	}
+	if len(entries) == 0 {
+		return journalEntry{}, errJournalEmpty
+	}
+	last := entries[len(entries)-1]
+	if last.Existed {
+		err = root.WriteFile(last.Path, last.Previous, last.Mode.Perm())
+	} else {
+		err = root.Remove(last.Path)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return journalEntry{}, err
+	}
+
+	var rest bytes.Buffer
+	for _, entry := range entries[:len(entries)-1] {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return journalEntry{}, err
+		}
+		rest.Write(append(line, '\n'))
+	}
+	return last, root.WriteFile(journalFile, rest.Bytes(), 0o600)
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const noNewlineMarker = `\ No newline at end of file`
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+type hunk struct {
+	oldStart int
+	oldLines []string
+	newLines []string
+	// newEOL is whether the new lines end with a newline, if the hunk ends the file.
+	newEOL *bool
+}
+
+// splitLines splits content into lines without their terminator, and reports
+// whether the last line ends with a newline.
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return nil, true
+	}
+	lines := strings.Split(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1], true
+	}
+	return lines, false
+}
+
+func joinLines(lines []string, eol bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	content := strings.Join(lines, "\n")
+	if eol {
+		content += "\n"
+	}
+	return content
+}
+
+func parseHunks(patch string) ([]hunk, error) {
+	var hunks []hunk
+	var current *hunk
+	var last byte
+	for line := range strings.SplitSeq(strings.TrimSuffix(patch, "\n"), "\n") {
+		if m := hunkHeaderPattern.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, hunk{oldStart: start})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			continue // skip the diff and file headers
+		}
+		if line == noNewlineMarker {
+			noEOL := false
+			if last != '-' {
+				current.newEOL = &noEOL
+			}
+			continue
+		}
+		if line == "" {
+			line = " " // some editors strip the space of empty context lines
+		}
+		switch line[0] {
+		case ' ':
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case '-':
+			if strings.HasPrefix(line, "--- ") {
+				current = nil // the header of the next file
+				continue
+			}
+			current.oldLines = append(current.oldLines, line[1:])
+		case '+':
+			current.newLines = append(current.newLines, line[1:])
+		default:
+			return nil, fmt.Errorf("invalid line in hunk %d: %q", len(hunks), line)
+		}
+		last = line[0]
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("the patch has no hunks")
+	}
+	return hunks, nil
+}
+
+// applyUnifiedDiff applies the hunks of a unified diff to the content of a
+// single file. Hunks that moved are found by their context, like patch(1)
+// does, but the context has to match exactly.
+func applyUnifiedDiff(original, patch string) (string, error) {
+	hunks, err := parseHunks(patch)
+	if err != nil {
+		return "", err
+	}
+	lines, eol := splitLines(original)
+	offset := 0 // the number of lines the previous hunks added
+	for i, h := range hunks {
+		expected := max(h.oldStart-1, 0) + offset
+		if len(h.oldLines) == 0 {
+			expected = h.oldStart + offset // pure insertions are after the given line
+		}
+		pos := findLines(lines, h.oldLines, expected)
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d does not apply: the context at line %d does not match the file", i+1, h.oldStart)
+		}
+		lines = slices.Concat(lines[:pos], h.newLines, lines[pos+len(h.oldLines):])
+		offset += len(h.newLines) - len(h.oldLines)
+		if h.newEOL != nil && pos+len(h.newLines) == len(lines) {
+			eol = *h.newEOL
+		} else if pos+len(h.newLines) == len(lines) && len(h.newLines) > 0 {
+			eol = true
+		}
+	}
+	return joinLines(lines, eol), nil
+}
+
+// findLines returns the position of want in lines closest to expected, or -1.
+func findLines(lines, want []string, expected int) int {
+	matches := func(pos int) bool {
+		return pos >= 0 && pos+len(want) <= len(lines) && slices.Equal(lines[pos:pos+len(want)], want)
+	}
+	for delta := 0; delta <= max(expected, len(lines)); delta++ {
+		if matches(expected - delta) {
+			return expected - delta
+		}
+		if matches(expected + delta) {
+			return expected + delta
+		}
+	}
+	return -1
+}
+
+// unifiedDiff returns the unified diff between the old and new content of the
+// file at path; old is nil if the file is new.
+func unifiedDiff(path string, old []byte, new []byte) string {
+	fromFile := "a/" + path
+	if old == nil {
+		fromFile = "/dev/null"
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(string(old)),
+		B:        diffLines(string(new)),
+		FromFile: fromFile,
+		ToFile:   "b/" + path,
+		Context:  3,
+	})
+	return diff
+}
+
+// diffLines splits content into lines for difflib, which expects every line to
+// end with a newline; unlike difflib.SplitLines, it adds no empty last line.
+func diffLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
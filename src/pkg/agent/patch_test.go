@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const composeBefore = `services:
+  app:
+    build: .
+    ports:
+      - 3000:3000
+    environment:
+      - NODE_ENV=production
+  db:
+    image: postgres:16
+`
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		patch    string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "change",
+			original: composeBefore,
+			patch: `--- a/compose.yaml
++++ b/compose.yaml
+@@ -3,3 +3,3 @@
+     build: .
+     ports:
+-      - 3000:3000
++      - 8080:8080
+`,
+			want: `services:
+  app:
+    build: .
+    ports:
+      - 8080:8080
+    environment:
+      - NODE_ENV=production
+  db:
+    image: postgres:16
+`,
+		},
+		{
+			name:     "moved hunks and stripped empty context",
+			original: "a\nb\nc\n\nd\ne\n",
+			patch: `@@ -1,2 +1,2 @@
+-a
++A
+ b
+@@ -10,3 +10,4 @@
+ c
+
+ d
++D
+`,
+			want: "A\nb\nc\n\nd\nD\ne\n",
+		},
+		{
+			name:     "append at end",
+			original: composeBefore,
+			patch: `@@ -8,2 +8,4 @@
+   db:
+     image: postgres:16
++    x-defang-postgres: true
++    restart: unless-stopped
+`,
+			want: composeBefore + "    x-defang-postgres: true\n    restart: unless-stopped\n",
+		},
+		{
+			name:     "no newline at end of file",
+			original: "FROM node:20\nCMD node app.js\n",
+			patch: `@@ -1,2 +1,2 @@
+ FROM node:20
+-CMD node app.js
++CMD ["node", "app.js"]
+\ No newline at end of file
+`,
+			want: "FROM node:20\nCMD [\"node\", \"app.js\"]",
+		},
+		{
+			name:     "insert into empty file",
+			original: "",
+			patch: `@@ -0,0 +1,2 @@
++FROM scratch
++COPY app /app
+`,
+			want: "FROM scratch\nCOPY app /app\n",
+		},
+		{
+			name:     "context mismatch",
+			original: composeBefore,
+			patch: `@@ -3,2 +3,2 @@
+     build: ./app
+-    ports:
++    expose:
+`,
+			wantErr: "hunk 1 does not apply",
+		},
+		{
+			name:     "no hunks",
+			original: composeBefore,
+			patch:    "services:\n  app: {}\n",
+			wantErr:  "no hunks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyUnifiedDiff(tt.original, tt.patch)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUnifiedDiffRoundTrip(t *testing.T) {
+	after := "services:\n  app:\n    build: .\n    ports:\n      - 8080:8080\n  db:\n    image: postgres:17\n"
+	diff := unifiedDiff("compose.yaml", []byte(composeBefore), []byte(after))
+	assert.Contains(t, diff, "--- a/compose.yaml\n+++ b/compose.yaml\n")
+
+	got, err := applyUnifiedDiff(composeBefore, diff)
+	require.NoError(t, err)
+	assert.Equal(t, after, got)
+
+	assert.Contains(t, unifiedDiff("Dockerfile", nil, []byte("FROM scratch\n")), "--- /dev/null\n")
+}
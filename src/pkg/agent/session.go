@@ -0,0 +1,364 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/firebase/genkit/go/ai"
+)
+
+const redacted = "[REDACTED]"
+
+// ErrSessionNotFound is returned for the IDs of sessions that don't exist.
+var ErrSessionNotFound = errors.New("session not found")
+
+type sessionRecordType string
+
+const (
+	sessionRecordHeader  sessionRecordType = "session"
+	sessionRecordMessage sessionRecordType = "message"
+	sessionRecordStack   sessionRecordType = "stack"
+)
+
+// SessionStack is the part of the selected stack that is saved with a session.
+type SessionStack struct {
+	Name     string            `json:"name,omitempty"`
+	Provider client.ProviderID `json:"provider,omitempty"`
+	Region   string            `json:"region,omitempty"`
+	Recipe   modes.Recipe      `json:"recipe,omitempty"`
+}
+
+func sessionStackOf(stack *stacks.Parameters) SessionStack {
+	if stack == nil {
+		return SessionStack{}
+	}
+	return SessionStack{Name: stack.Name, Provider: stack.Provider, Region: stack.Region, Recipe: stack.Recipe}
+}
+
+// sessionRecord is a line of a session file.
+type sessionRecord struct {
+	Type    sessionRecordType `json:"type"`
+	Time    time.Time         `json:"time"`
+	ID      string            `json:"id,omitempty"`  // header only
+	Cwd     string            `json:"cwd,omitempty"` // header only
+	Stack   *SessionStack     `json:"stack,omitempty"`
+	Message *ai.Message       `json:"message,omitempty"`
+}
+
+// Session is a conversation with the agent, as saved in the session store.
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Cwd       string
+	Stack     SessionStack // the most recently selected stack
+	Messages  []*ai.Message
+}
+
+// CheckCwd returns an error unless the working directory is the one the session
+// was started in: the conversation refers to the files of that project, and the
+// agent's file tools would apply it to the files of another.
+func (s *Session) CheckCwd() error {
+	if s.Cwd == "" {
+		return nil // not recorded
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if cwd == s.Cwd {
+		return nil
+	}
+	if info, err := os.Stat(cwd); err == nil {
+		if saved, err := os.Stat(s.Cwd); err == nil && os.SameFile(info, saved) {
+			return nil // the same directory, reached through a symlink
+		}
+	}
+	return fmt.Errorf("session %s was started in %s, not in %s; run the command from that directory or with --cwd %q", s.ID, s.Cwd, cwd, s.Cwd)
+}
+
+// Title returns the first user message of the session, shortened.
+func (s *Session) Title() string {
+	for _, msg := range s.Messages {
+		if msg.Role == ai.RoleUser {
+			if text := strings.Join(strings.Fields(msg.Text()), " "); text != "" {
+				if len(text) > 60 {
+					text = text[:57] + "..."
+				}
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// SessionStore keeps the sessions as JSONL files in a directory.
+type SessionStore struct {
+	Dir string
+}
+
+// NewSessionStore returns the store in the state directory of the CLI.
+func NewSessionStore() *SessionStore {
+	return &SessionStore{Dir: filepath.Join(client.StateDir, "agent", "sessions")}
+}
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (s *SessionStore) path(id string) (string, error) {
+	if !sessionIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(s.Dir, id+".jsonl"), nil
+}
+
+// sessionWriter appends the records of a single session.
+type sessionWriter struct {
+	path      string
+	lastStack SessionStack
+}
+
+// Create starts a new session file with the given ID.
+func (s *SessionStore) Create(id string, stack *stacks.Parameters) (*sessionWriter, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	cwd, _ := os.Getwd()
+	w := &sessionWriter{path: path, lastStack: sessionStackOf(stack)}
+	return w, w.write(sessionRecord{Type: sessionRecordHeader, Time: time.Now(), ID: id, Cwd: cwd, Stack: &w.lastStack})
+}
+
+// resume returns a writer that appends to an existing session.
+func (s *SessionStore) resume(session *Session) (*sessionWriter, error) {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionWriter{path: path, lastStack: session.Stack}, nil
+}
+
+func (w *sessionWriter) write(record sessionRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Append saves a message of the conversation, with secrets redacted, and the
+// selected stack if it changed.
+func (w *sessionWriter) Append(message *ai.Message, stack *stacks.Parameters) error {
+	now := time.Now()
+	if current := sessionStackOf(stack); current != w.lastStack {
+		w.lastStack = current
+		if err := w.write(sessionRecord{Type: sessionRecordStack, Time: now, Stack: &current}); err != nil {
+			return err
+		}
+	}
+	return w.write(sessionRecord{Type: sessionRecordMessage, Time: now, Message: redactMessage(message)})
+}
+
+// Load reads the session with the given ID.
+func (s *SessionStore) Load(id string) (*Session, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	session := &Session{ID: id}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024) // tool results can be large
+	for scanner.Scan() {
+		var record sessionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid session %s: %w", id, err)
+		}
+		switch record.Type {
+		case sessionRecordHeader:
+			session.CreatedAt = record.Time
+			session.Cwd = record.Cwd
+		case sessionRecordMessage:
+			if record.Message != nil {
+				session.Messages = append(session.Messages, record.Message)
+			}
+		}
+		if record.Stack != nil {
+			session.Stack = *record.Stack
+		}
+		session.UpdatedAt = record.Time
+	}
+	return session, scanner.Err()
+}
+
+// List returns all sessions, most recently updated first.
+func (s *SessionStore) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		session, err := s.Load(id)
+		if err != nil {
+			term.Debugf("Skipping session %s: %v", id, err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Remove deletes the session with the given ID.
+func (s *SessionStore) Remove(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	} else {
+		return err
+	}
+}
+
+// assignmentPattern matches lines like "KEY=value" or "key: value", which is
+// how secrets usually show up in files, logs and tool results.
+var assignmentPattern = regexp.MustCompile(`(?m)^([ \t]*(?:export[ \t]+|-[ \t]+)?["']?([A-Za-z_][A-Za-z0-9_.-]*)["']?[ \t]*[:=][ \t]*)(\S.*?)[ \t]*$`)
+
+// urlPattern matches URLs, which can have a password, in free text.
+var urlPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^\s"'<>]+`)
+
+// redactText replaces the values of the assignments and the URLs in text that
+// compose.IsSecret flags.
+func redactText(text string) string {
+	text = assignmentPattern.ReplaceAllStringFunc(text, func(line string) string {
+		m := assignmentPattern.FindStringSubmatch(line)
+		if isSecret(m[2], m[3]) {
+			return m[1] + redacted
+		}
+		return line
+	})
+	return urlPattern.ReplaceAllStringFunc(text, func(url string) string {
+		if isSecret("url", url) {
+			return redacted
+		}
+		return url
+	})
+}
+
+func isSecret(key, value string) bool {
+	secret, _, err := compose.IsSecret(key, value)
+	if err != nil {
+		term.Debugf("Failed to check %q for secrets: %v", key, err)
+		return true // err on the side of caution
+	}
+	return secret
+}
+
+// redactValue redacts the secrets in a tool input or output, which is a
+// string or a JSON-like structure.
+func redactValue(key string, value any) any {
+	switch v := value.(type) {
+	case string:
+		if key != "" && isSecret(key, v) {
+			return redacted
+		}
+		return redactText(v)
+	case map[string]any:
+		redactedMap := make(map[string]any, len(v))
+		// Tools like set_config take the name and the value of a variable
+		name, _ := v["name"].(string)
+		for k, val := range v {
+			if k == "value" && name != "" {
+				if s, ok := val.(string); ok && isSecret(name, s) {
+					redactedMap[k] = redacted
+					continue
+				}
+			}
+			redactedMap[k] = redactValue(k, val)
+		}
+		return redactedMap
+	case []any:
+		redactedSlice := make([]any, len(v))
+		for i, val := range v {
+			redactedSlice[i] = redactValue(key, val)
+		}
+		return redactedSlice
+	default:
+		// Round-trip other types through JSON, so structs are redacted too
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			return v
+		}
+		var generic any
+		if err := json.Unmarshal(bytes, &generic); err != nil {
+			return v
+		}
+		switch generic.(type) {
+		case map[string]any, []any:
+			return redactValue(key, generic)
+		}
+		return v
+	}
+}
+
+// redactMessage returns a copy of the message with the secrets redacted.
+func redactMessage(message *ai.Message) *ai.Message {
+	redactedMessage := &ai.Message{Role: message.Role, Metadata: message.Metadata}
+	for _, part := range message.Content {
+		p := *part
+		switch {
+		case part.IsText(), part.IsReasoning():
+			p.Text = redactText(part.Text)
+		case part.IsToolRequest():
+			req := *part.ToolRequest
+			req.Input = redactValue("", req.Input)
+			p.ToolRequest = &req
+		case part.IsToolResponse():
+			resp := *part.ToolResponse
+			resp.Output = redactValue("", resp.Output)
+			p.ToolResponse = &resp
+		}
+		redactedMessage.Content = append(redactedMessage.Content, &p)
+	}
+	return redactedMessage
+}
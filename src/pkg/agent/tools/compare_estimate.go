@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	"github.com/DefangLabs/defang/src/pkg/auth"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/money"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	_type "github.com/DefangLabs/defang/src/protos/google/type"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+type CompareEstimateParams struct {
+	common.LoaderParams
+	CurrentMode  string `json:"current_mode,omitempty" jsonschema:"description=The current deployment mode; defaults to the recipe of the selected stack, or affordable."`
+	ProposedMode string `json:"proposed_mode" jsonschema:"required,description=The deployment mode to compare against (e.g., affordable, balanced, high_availability)."`
+	Provider     string `json:"provider" jsonschema:"required,enum=aws,enum=gcp,description=The cloud provider for which to estimate costs."`
+	Region       string `json:"region,omitempty" jsonschema:"description=The region in which to estimate costs."`
+}
+
+func HandleCompareEstimateTool(ctx context.Context, loader client.Loader, params CompareEstimateParams, cli CLIInterface, sc StackConfig) (string, error) {
+	current := modes.ParseRecipe(params.CurrentMode)
+	if current == modes.RecipeUnspecified {
+		current = stackRecipe(sc.Stack)
+	}
+	proposed := modes.ParseRecipe(params.ProposedMode)
+	if proposed == modes.RecipeUnspecified {
+		return "", errors.New("proposed_mode is required")
+	}
+
+	term.Debug("Function invoked: loader.LoadProject")
+	project, err := cli.LoadProject(ctx, loader)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	term.Debug("Function invoked: cli.Connect")
+	fabric, err := GetClientWithRetry(ctx, cli, sc.FabricAddr)
+	if err != nil {
+		var noBrowserErr auth.ErrNoBrowser
+		if errors.As(err, &noBrowserErr) {
+			return noBrowserErr.Error(), nil
+		}
+		return "", err
+	}
+	defangProvider := cli.CreatePlaygroundProvider(fabric)
+
+	var providerID client.ProviderID
+	if err := providerID.Set(params.Provider); err != nil {
+		return "", err
+	}
+
+	term.Debug("Function invoked: cli.RunEstimate")
+	currentEstimate, err := cli.RunEstimate(ctx, project, fabric, defangProvider, providerID, params.Region, current)
+	if err != nil {
+		return "", fmt.Errorf("failed to estimate the %s mode: %w", current, err)
+	}
+	proposedEstimate, err := cli.RunEstimate(ctx, project, fabric, defangProvider, providerID, params.Region, proposed)
+	if err != nil {
+		return "", fmt.Errorf("failed to estimate the %s mode: %w", proposed, err)
+	}
+
+	return compareEstimates(providerID, current, currentEstimate, proposed, proposedEstimate), nil
+}
+
+func moneyAmount(m *_type.Money) float64 {
+	if m == nil {
+		return 0
+	}
+	return float64(m.Units) + float64(m.Nanos)/1e9
+}
+
+func currencyOf(estimates ...*defangv1.EstimateResponse) string {
+	for _, estimate := range estimates {
+		if estimate.GetSubtotal().GetCurrencyCode() != "" {
+			return estimate.Subtotal.CurrencyCode
+		}
+	}
+	return "USD"
+}
+
+// costsByService sums the line items of the estimate per service.
+func costsByService(estimate *defangv1.EstimateResponse) map[string]float64 {
+	costs := make(map[string]float64)
+	for _, item := range estimate.GetLineItems() {
+		service := strings.Join(item.Service, ", ")
+		if service == "" {
+			service = "(shared)"
+		}
+		costs[service] += moneyAmount(item.Cost)
+	}
+	return costs
+}
+
+func compareEstimates(providerID client.ProviderID, current modes.Recipe, currentEstimate *defangv1.EstimateResponse, proposed modes.Recipe, proposedEstimate *defangv1.EstimateResponse) string {
+	currency := currencyOf(currentEstimate, proposedEstimate)
+	format := func(amount float64) string {
+		return money.NewMoney(amount, currency).String()
+	}
+	currentTotal := moneyAmount(currentEstimate.GetSubtotal())
+	proposedTotal := moneyAmount(proposedEstimate.GetSubtotal())
+	delta := proposedTotal - currentTotal
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Estimated monthly cost on %s (+ usage, excluding taxes and discounts):\n", providerID.Name())
+	fmt.Fprintf(&b, "- current (%s): %s\n", current, format(currentTotal))
+	fmt.Fprintf(&b, "- proposed (%s): %s\n", proposed, format(proposedTotal))
+	switch {
+	case delta == 0:
+		b.WriteString("The proposed mode costs the same as the current mode.\n")
+	case currentTotal == 0:
+		fmt.Fprintf(&b, "The proposed mode costs %s more per month.\n", format(delta))
+	case delta > 0:
+		fmt.Fprintf(&b, "The proposed mode costs %s (%.0f%%) more per month.\n", format(delta), 100*delta/currentTotal)
+	default:
+		fmt.Fprintf(&b, "The proposed mode saves %s (%.0f%%) per month.\n", format(-delta), -100*delta/currentTotal)
+	}
+
+	currentCosts := costsByService(currentEstimate)
+	proposedCosts := costsByService(proposedEstimate)
+	var services []string
+	for service := range currentCosts {
+		services = append(services, service)
+	}
+	for service := range proposedCosts {
+		if _, ok := currentCosts[service]; !ok {
+			services = append(services, service)
+		}
+	}
+	slices.Sort(services)
+	if len(services) > 0 {
+		b.WriteString("\nPer service:\n")
+		for _, service := range services {
+			fmt.Fprintf(&b, "- %s: %s -> %s\n", service, format(currentCosts[service]), format(proposedCosts[service]))
+		}
+	}
+	return b.String()
+}
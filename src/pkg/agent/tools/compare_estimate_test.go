@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	_type "github.com/DefangLabs/defang/src/protos/google/type"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockCompareCLI returns an estimate per recipe, and a preview
+type MockCompareCLI struct {
+	MockEstimateCLI
+	Estimates    map[modes.Recipe]*defangv1.EstimateResponse
+	Preview      string
+	PreviewError error
+}
+
+func (m *MockCompareCLI) RunEstimate(ctx context.Context, project *compose.Project, fabric *client.GrpcClient, provider client.Provider, providerId client.ProviderID, region string, mode modes.Recipe) (*defangv1.EstimateResponse, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("RunEstimate(%s, %s)", providerId, mode))
+	estimate, ok := m.Estimates[mode]
+	if !ok {
+		return nil, errors.New("no estimate")
+	}
+	return estimate, nil
+}
+
+func (m *MockCompareCLI) GeneratePreview(ctx context.Context, project *compose.Project, fabric *client.GrpcClient, provider client.Provider, providerId client.ProviderID, mode modes.Recipe, region string) (string, error) {
+	m.CallLog = append(m.CallLog, fmt.Sprintf("GeneratePreview(%s, %s, %s)", providerId, mode, region))
+	return m.Preview, m.PreviewError
+}
+
+func usd(units int64, nanos int32) *_type.Money {
+	return &_type.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func TestHandleCompareEstimateTool(t *testing.T) {
+	mockCLI := &MockCompareCLI{
+		MockEstimateCLI: MockEstimateCLI{Project: &compose.Project{Name: "test-project"}},
+		Estimates: map[modes.Recipe]*defangv1.EstimateResponse{
+			modes.RecipeAffordable: {
+				Subtotal: usd(20, 0),
+				LineItems: []*defangv1.EstimateLineItem{
+					{Service: []string{"web"}, Cost: usd(15, 0)},
+					{Cost: usd(5, 0)},
+				},
+			},
+			modes.RecipeHighAvailability: {
+				Subtotal: usd(50, 0),
+				LineItems: []*defangv1.EstimateLineItem{
+					{Service: []string{"web"}, Cost: usd(30, 0)},
+					{Service: []string{"db"}, Cost: usd(10, 0)},
+					{Cost: usd(10, 0)},
+				},
+			},
+		},
+	}
+
+	result, err := HandleCompareEstimateTool(t.Context(), nil, CompareEstimateParams{
+		ProposedMode: "high_availability",
+		Provider:     "aws",
+		Region:       "us-west-2",
+	}, mockCLI, StackConfig{FabricAddr: "test-cluster", Stack: &stacks.Parameters{}})
+	require.NoError(t, err)
+	assert.Equal(t, `Estimated monthly cost on AWS (+ usage, excluding taxes and discounts):
+- current (AFFORDABLE): $20.00
+- proposed (HIGH_AVAILABILITY): $50.00
+The proposed mode costs $30.00 (150%) more per month.
+
+Per service:
+- (shared): $5.00 -> $10.00
+- db: $0.00 -> $10.00
+- web: $15.00 -> $30.00
+`, result)
+	assert.Contains(t, mockCLI.CallLog, "RunEstimate(aws, AFFORDABLE)")
+	assert.Contains(t, mockCLI.CallLog, "RunEstimate(aws, HIGH_AVAILABILITY)")
+
+	t.Run("current mode from the stack", func(t *testing.T) {
+		result, err := HandleCompareEstimateTool(t.Context(), nil, CompareEstimateParams{
+			ProposedMode: "affordable",
+			Provider:     "aws",
+		}, mockCLI, StackConfig{Stack: &stacks.Parameters{Recipe: modes.RecipeHighAvailability}})
+		require.NoError(t, err)
+		assert.Contains(t, result, "The proposed mode saves $30.00 (60%) per month.")
+	})
+
+	t.Run("estimate error", func(t *testing.T) {
+		_, err := HandleCompareEstimateTool(t.Context(), nil, CompareEstimateParams{
+			ProposedMode: "balanced",
+			Provider:     "aws",
+		}, mockCLI, StackConfig{Stack: &stacks.Parameters{}})
+		assert.EqualError(t, err, "failed to estimate the BALANCED mode: no estimate")
+	})
+}
+
+func TestHandlePreviewDeployTool(t *testing.T) {
+	mockCLI := &MockCompareCLI{
+		MockEstimateCLI: MockEstimateCLI{Project: &compose.Project{Name: "test-project"}},
+		Preview:         "+ aws:ecs:Service web create\n",
+	}
+	result, err := HandlePreviewDeployTool(t.Context(), nil, PreviewDeployParams{
+		Provider: "aws",
+		Region:   "us-west-2",
+	}, mockCLI, StackConfig{FabricAddr: "test-cluster", Stack: &stacks.Parameters{}})
+	require.NoError(t, err)
+	assert.Equal(t, "Nothing was deployed. This is the preview of the resources that deploying project \"test-project\" to AWS in AFFORDABLE mode would create or change:\n+ aws:ecs:Service web create", result)
+	assert.Contains(t, mockCLI.CallLog, "GeneratePreview(aws, AFFORDABLE, us-west-2)")
+
+	mockCLI.PreviewError = errors.New("Preview failed: boom")
+	_, err = HandlePreviewDeployTool(t.Context(), nil, PreviewDeployParams{Provider: "gcp"}, mockCLI, StackConfig{Stack: &stacks.Parameters{}})
+	assert.EqualError(t, err, "failed to generate preview: Preview failed: boom")
+}
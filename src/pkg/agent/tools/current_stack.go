@@ -14,7 +14,7 @@ func HandleCurrentStackTool(ctx context.Context, sc StackConfig) (string, error)
 		return "No stack is currently selected.", nil
 	}
 
-	stackFile, err := stacks.Marshal(sc.Stack)
+	stackFile, err := stacks.MarshalResolved(sc.Stack)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal stack details: %w", err)
 	}
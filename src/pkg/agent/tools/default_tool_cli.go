@@ -20,6 +20,16 @@ import (
 type StackConfig struct {
 	FabricAddr string
 	Stack      *stacks.Parameters
+	// OnDeploy, if set, is called once a deployment has been started
+	OnDeploy func(ctx context.Context, provider client.Provider, projectName string, etag types.ETag)
+	// RequireValidation makes deploy refuse projects that did not pass
+	// validate_compose in the same session, as recorded in Validations.
+	RequireValidation bool
+	Validations       *Validations
+	// IsolatedEnv keeps the stack out of the process env, which is shared by
+	// concurrent sessions: the stack is passed to the loader explicitly and is
+	// only applied to the env while the provider is created.
+	IsolatedEnv bool
 }
 
 // DefaultToolCLI implements all tool interfaces as passthroughs to the real CLI logic
@@ -42,6 +52,10 @@ func (DefaultToolCLI) RunEstimate(ctx context.Context, project *compose.Project,
 	return cli.RunEstimate(ctx, project, fabric, provider, providerId, region, mode)
 }
 
+func (DefaultToolCLI) GeneratePreview(ctx context.Context, project *compose.Project, fabric *client.GrpcClient, provider client.Provider, providerId client.ProviderID, mode modes.Recipe, region string) (string, error) {
+	return cli.GeneratePreview(ctx, project, fabric, provider, providerId, mode, region)
+}
+
 func (DefaultToolCLI) ListConfig(ctx context.Context, provider client.Provider, projectName string) (*defangv1.Secrets, error) {
 	req := &defangv1.ListConfigsRequest{Project: projectName}
 	return provider.ListConfig(ctx, req)
@@ -29,6 +29,7 @@ func HandleDeployTool(ctx context.Context, params DeployParams, cli CLIInterface
 	// Retry loop so the missing-config elicitation can try again with the same
 	// loader (and its cached project).
 	var deployResp *defangv1.DeployResponse
+	var projectName string
 	for {
 		term.Debug("Function invoked: loader.LoadProject")
 		project, err := cli.LoadProject(ctx, loader)
@@ -38,6 +39,16 @@ func HandleDeployTool(ctx context.Context, params DeployParams, cli CLIInterface
 			return "", fmt.Errorf("local deployment failed: %v. Please provide a valid compose file path.", err)
 		}
 
+		if sc.RequireValidation {
+			fingerprint, err := projectFingerprint(project, sc.Stack)
+			if err != nil {
+				return "", err
+			}
+			if !sc.Validations.Passed(fingerprint) {
+				return "The deployment was not started: the compose files must pass validate_compose in this session before they can be deployed, and they changed or were not validated yet. Run validate_compose, fix any errors, and then deploy.", nil
+			}
+		}
+
 		err = cli.CanIUseProvider(ctx, client, provider, project.Name, len(project.Services))
 		if err != nil {
 			return "", fmt.Errorf("failed to use provider: %w", err)
@@ -68,6 +79,7 @@ func HandleDeployTool(ctx context.Context, params DeployParams, cli CLIInterface
 
 			return "", err
 		}
+		projectName = project.Name
 		break
 	}
 
@@ -75,6 +87,10 @@ func HandleDeployTool(ctx context.Context, params DeployParams, cli CLIInterface
 		return "", errors.New("no services deployed")
 	}
 
+	if sc.OnDeploy != nil {
+		sc.OnDeploy(ctx, provider, projectName, deployResp.Etag)
+	}
+
 	urls := strings.Builder{}
 	for _, serviceInfo := range deployResp.Services {
 		if serviceInfo.PublicFqdn != "" {
@@ -21,6 +21,7 @@ type CLIInterface interface {
 	Connect(ctx context.Context, fabricAddr string) (*client.GrpcClient, error)
 	CreatePlaygroundProvider(fabric *client.GrpcClient) client.Provider
 	GenerateAuthURL(authPort int) string
+	GeneratePreview(ctx context.Context, project *compose.Project, fabric *client.GrpcClient, provider client.Provider, providerId client.ProviderID, mode modes.Recipe, region string) (string, error)
 	GetServices(ctx context.Context, projectName string, provider client.Provider) ([]cli.ServiceLineItem, error)
 	InteractiveLoginMCP(ctx context.Context, fabricAddr string, mcpClient string) error
 	ListConfig(ctx context.Context, provider client.Provider, projectName string) (*defangv1.Secrets, error)
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	"github.com/DefangLabs/defang/src/pkg/auth"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+// maxPreviewLength keeps the preview within what the model can make sense of.
+const maxPreviewLength = 16 * 1024
+
+type PreviewDeployParams struct {
+	common.LoaderParams
+	DeploymentMode string `json:"deployment_mode,omitempty" jsonschema:"default=affordable,enum=affordable,enum=balanced,enum=high_availability,description=The deployment mode to preview."`
+	Provider       string `json:"provider" jsonschema:"required,enum=aws,enum=gcp,description=The cloud provider to preview the deployment for."`
+	Region         string `json:"region,omitempty" jsonschema:"description=The region to preview the deployment in."`
+}
+
+func HandlePreviewDeployTool(ctx context.Context, loader client.Loader, params PreviewDeployParams, cli CLIInterface, sc StackConfig) (string, error) {
+	term.Debug("Function invoked: loader.LoadProject")
+	project, err := cli.LoadProject(ctx, loader)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	term.Debug("Function invoked: cli.Connect")
+	fabric, err := GetClientWithRetry(ctx, cli, sc.FabricAddr)
+	if err != nil {
+		var noBrowserErr auth.ErrNoBrowser
+		if errors.As(err, &noBrowserErr) {
+			return noBrowserErr.Error(), nil
+		}
+		return "", err
+	}
+
+	var providerID client.ProviderID
+	if err := providerID.Set(params.Provider); err != nil {
+		return "", err
+	}
+	recipe := modes.ParseRecipe(params.DeploymentMode)
+	if recipe == modes.RecipeUnspecified {
+		recipe = modes.RecipeAffordable
+	}
+
+	term.Debug("Function invoked: cli.GeneratePreview")
+	preview, err := cli.GeneratePreview(ctx, project, fabric, cli.CreatePlaygroundProvider(fabric), providerID, recipe, params.Region)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate preview: %w", err)
+	}
+	if preview = strings.TrimSpace(preview); preview == "" {
+		return fmt.Sprintf("The preview of deploying project %q to %s produced no changes.", project.Name, providerID.Name()), nil
+	}
+	if len(preview) > maxPreviewLength {
+		preview = "... (truncated)\n" + preview[len(preview)-maxPreviewLength:]
+	}
+	return fmt.Sprintf("Nothing was deployed. This is the preview of the resources that deploying project %q to %s in %s mode would create or change:\n%s", project.Name, providerID.Name(), recipe, preview), nil
+}
@@ -25,6 +25,8 @@ type providerPreparer struct {
 	ec elicitations.Controller
 	fc client.FabricClient
 	sm stacks.Manager
+	// isolatedEnv only applies the stack env while the provider is created
+	isolatedEnv bool
 }
 
 func NewProviderPreparer(pc ProviderCreator, ec elicitations.Controller, fc client.FabricClient, sm stacks.Manager) *providerPreparer {
@@ -46,12 +48,18 @@ func (pp *providerPreparer) SetupProvider(ctx context.Context, stack *stacks.Par
 			return nil, nil, fmt.Errorf("failed to setup stack: %w", err)
 		}
 		*stack = *newStack
-		err = stacks.LoadStackEnv(*stack, false)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to load stack env: %w", err)
+		if !pp.isolatedEnv {
+			err = stacks.LoadStackEnv(*stack, false)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to load stack env: %w", err)
+			}
 		}
 	}
 
+	if pp.isolatedEnv {
+		return pp.setupIsolatedProvider(ctx, stack)
+	}
+
 	term.Debug("Function invoked: cli.NewProvider")
 	provider := pp.pc.NewProvider(ctx, stack.Provider, pp.fc, stack.Name)
 	if err := provider.Authenticate(ctx, pp.ec.IsSupported()); err != nil {
@@ -61,6 +69,32 @@ func (pp *providerPreparer) SetupProvider(ctx context.Context, stack *stacks.Par
 	return &providerID, provider, nil
 }
 
+// setupIsolatedProvider creates the provider with the stack env applied, since
+// providers and cloud SDKs read their settings from the process env. The env is
+// only held while the provider is created; an interactive login, which waits
+// for the user, is done afterwards.
+func (pp *providerPreparer) setupIsolatedProvider(ctx context.Context, stack *stacks.Parameters) (*client.ProviderID, client.Provider, error) {
+	var provider client.Provider
+	var authErr error
+	err := stacks.WithStackEnv(stack, func() error {
+		term.Debug("Function invoked: cli.NewProvider")
+		provider = pp.pc.NewProvider(ctx, stack.Provider, pp.fc, stack.Name)
+		authErr = provider.Authenticate(ctx, false)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load stack env: %w", err)
+	}
+	if authErr != nil && pp.ec.IsSupported() {
+		authErr = provider.Authenticate(ctx, true)
+	}
+	if authErr != nil {
+		return nil, nil, fmt.Errorf("failed to authenticate with provider %q: %w", stack.Provider, authErr)
+	}
+	providerID := stack.Provider
+	return &providerID, provider, nil
+}
+
 // setupProviderAndLoader connects to the fabric and completes stack setup
 // before the project loader is usable: SetupProvider may select a different
 // stack (via elicitation), and the loader bakes the stack name/provider into
@@ -90,6 +124,7 @@ func setupProviderAndLoader(ctx context.Context, params common.LoaderParams, cli
 
 	initialProvider, initialStack := sc.Stack.Provider, sc.Stack.Name
 	pp := NewProviderPreparer(cli, ec, fabric, sm)
+	pp.isolatedEnv = sc.IsolatedEnv
 	_, provider, err := pp.SetupProvider(ctx, sc.Stack)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to setup provider: %w", err)
@@ -28,9 +28,11 @@ func HandleSelectStackTool(ctx context.Context, params SelectStackParams, sc Sta
 }
 
 func loadStack(stack stacks.Parameters, sc StackConfig) error {
-	err := stacks.LoadStackEnv(stack, true)
-	if err != nil {
-		return fmt.Errorf("Unable to load stack %q: %w", stack.Name, err)
+	if !sc.IsolatedEnv {
+		err := stacks.LoadStackEnv(stack, true)
+		if err != nil {
+			return fmt.Errorf("Unable to load stack %q: %w", stack.Name, err)
+		}
 	}
 
 	*sc.Stack = stack
@@ -38,7 +40,7 @@ func loadStack(stack stacks.Parameters, sc StackConfig) error {
 }
 
 func createAndLoadStack(newStack stacks.Parameters, dir string, sc StackConfig) (string, error) {
-	_, err := stacks.CreateInDirectory(dir, newStack)
+	_, err := stacks.CreateInDirectory(dir, newStack, nil)
 	if err != nil {
 		return "Failed to create stack", err
 	}
@@ -128,3 +128,19 @@ func TestHandleSelectStackTool(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleSelectStackToolIsolatedEnv(t *testing.T) {
+	t.Chdir("testdata")
+	os.Unsetenv("DEFANG_PROVIDER")
+	os.Unsetenv("AWS_PROFILE")
+	os.Unsetenv("AWS_REGION")
+
+	stackConfig := StackConfig{Stack: &stacks.Parameters{Name: "placeholder"}, IsolatedEnv: true}
+	result, err := HandleSelectStackTool(t.Context(), SelectStackParams{Stack: "test-stack"}, stackConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "Stack \"test-stack\" selected.", result)
+	assert.Equal(t, "test-stack", stackConfig.Stack.Name)
+	assert.Equal(t, "us-test-2", stackConfig.Stack.Region)
+	_, ok := os.LookupEnv("AWS_REGION")
+	assert.False(t, ok, "an isolated stack must not be loaded into the process env")
+}
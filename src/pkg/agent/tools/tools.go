@@ -7,6 +7,9 @@ import (
 )
 
 func CollectDefangTools(ec elicitations.Controller, sc StackConfig) []ai.Tool {
+	if sc.Validations == nil {
+		sc.Validations = &Validations{}
+	}
 	return []ai.Tool{
 		ai.NewTool(
 			"services",
@@ -16,6 +19,35 @@ func CollectDefangTools(ec elicitations.Controller, sc StackConfig) []ai.Tool {
 				return HandleServicesTool(ctx.Context, params, cli, ec, sc)
 			},
 		),
+		ai.NewTool("validate_compose",
+			"Validate the compose files in the current working directory for deployment with Defang without deploying anything; returns the errors with their file and line",
+			func(ctx *ai.ToolContext, params ValidateComposeParams) (string, error) {
+				cli := &DefaultToolCLI{}
+				return HandleValidateComposeTool(ctx.Context, params, cli, ec, sc)
+			},
+		),
+		ai.NewTool("preview_deploy",
+			"Preview the cloud resources that deploying the compose files in the current working directory would create, without deploying anything",
+			func(ctx *ai.ToolContext, params PreviewDeployParams) (string, error) {
+				loader, err := common.ConfigureAgentLoader(params.LoaderParams, sc.Stack)
+				if err != nil {
+					return "Failed to configure loader", err
+				}
+				cli := &DefaultToolCLI{}
+				return HandlePreviewDeployTool(ctx.Context, loader, params, cli, sc)
+			},
+		),
+		ai.NewTool("compare_estimate",
+			"Compare the estimated monthly cost of the current deployment mode with a proposed deployment mode",
+			func(ctx *ai.ToolContext, params CompareEstimateParams) (string, error) {
+				loader, err := common.ConfigureAgentLoader(params.LoaderParams, sc.Stack)
+				if err != nil {
+					return "Failed to configure loader", err
+				}
+				cli := &DefaultToolCLI{}
+				return HandleCompareEstimateTool(ctx.Context, loader, params, cli, sc)
+			},
+		),
 		ai.NewTool("deploy",
 			"Initiate deployment of the application stack defined in the docker-compose files in the current working directory",
 			func(ctx *ai.ToolContext, params DeployParams) (string, error) {
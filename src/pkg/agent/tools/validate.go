@@ -0,0 +1,354 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"go.yaml.in/yaml/v4"
+)
+
+type ValidateComposeParams struct {
+	common.LoaderParams
+}
+
+type IssueSeverity string
+
+const (
+	IssueError   IssueSeverity = "error"
+	IssueWarning IssueSeverity = "warning"
+)
+
+// ValidationIssue is a problem with the compose files, located as precisely
+// as the error allows.
+type ValidationIssue struct {
+	Severity IssueSeverity `json:"severity"`
+	Message  string        `json:"message"`
+	Service  string        `json:"service,omitempty"`
+	File     string        `json:"file,omitempty"`
+	Line     int           `json:"line,omitempty"`
+}
+
+type ValidationResult struct {
+	Valid   bool              `json:"valid"`
+	Project string            `json:"project,omitempty"`
+	Issues  []ValidationIssue `json:"issues"`
+}
+
+// Validations records the projects that passed validate_compose, so deploy
+// can require a successful validation earlier in the same session.
+type Validations struct {
+	mu     sync.Mutex
+	passed map[string]bool
+}
+
+func (v *Validations) record(fingerprint string) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.passed == nil {
+		v.passed = make(map[string]bool)
+	}
+	v.passed[fingerprint] = true
+}
+
+// Passed reports whether the project with the given fingerprint was validated.
+func (v *Validations) Passed(fingerprint string) bool {
+	if v == nil {
+		return false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.passed[fingerprint]
+}
+
+// projectFingerprint identifies the project and the stack it is validated
+// for; any change to the compose files changes the fingerprint.
+func projectFingerprint(project *compose.Project, stack *stacks.Parameters) (string, error) {
+	data, err := compose.MarshalYAML(project)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(data)
+	if stack != nil {
+		fmt.Fprintf(h, "\x00%s\x00%s\x00%s", stack.Name, stack.Provider, stack.Recipe)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func stackRecipe(stack *stacks.Parameters) modes.Recipe {
+	if stack == nil || stack.Recipe == modes.RecipeUnspecified {
+		return modes.RecipeAffordable
+	}
+	return stack.Recipe
+}
+
+func HandleValidateComposeTool(ctx context.Context, params ValidateComposeParams, cli CLIInterface, ec elicitations.Controller, sc StackConfig) (string, error) {
+	var result ValidationResult
+	var provider client.Provider
+	var loader client.Loader
+	var err error
+	if sc.Stack.Provider == client.ProviderAuto || sc.Stack.Provider == "" {
+		loader, err = common.ConfigureAgentLoader(params.LoaderParams, sc.Stack)
+		if err != nil {
+			return "", fmt.Errorf("failed to configure loader: %w", err)
+		}
+		result.Issues = append(result.Issues, ValidationIssue{
+			Severity: IssueWarning,
+			Message:  "config variables were not checked because no stack is selected; select or create a stack to check them",
+		})
+	} else {
+		_, provider, loader, err = setupProviderAndLoader(ctx, params.LoaderParams, cli, ec, sc)
+		if err != nil {
+			return setupErrorResult(err)
+		}
+	}
+
+	composeFiles := composeFilePaths(params.LoaderParams)
+
+	term.Debug("Function invoked: loader.LoadProject")
+	project, err := cli.LoadProject(ctx, loader)
+	if err != nil {
+		result.Issues = append(result.Issues, issuesFromError(err, IssueError, composeFiles)...)
+		return formatValidationResult(result)
+	}
+	result.Project = project.Name
+	if len(project.ComposeFiles) > 0 {
+		composeFiles = project.ComposeFiles
+	}
+
+	if err := compose.ValidateProject(project, stackRecipe(sc.Stack)); err != nil {
+		result.Issues = append(result.Issues, issuesFromError(err, IssueError, composeFiles)...)
+	}
+	if err := compose.ValidateServiceDockerfiles(project); err != nil {
+		result.Issues = append(result.Issues, issuesFromError(err, IssueError, composeFiles)...)
+	}
+
+	if provider != nil {
+		term.Debug("Function invoked: cli.ListConfig")
+		configs, err := cli.ListConfig(ctx, provider, project.Name)
+		if err != nil {
+			result.Issues = append(result.Issues, ValidationIssue{
+				Severity: IssueWarning,
+				Message:  fmt.Sprintf("config variables were not checked: %v", err),
+			})
+		} else if err := compose.ValidateProjectConfig(project, configs.Names); err != nil {
+			result.Issues = append(result.Issues, configIssues(err, project, composeFiles)...)
+		}
+	}
+
+	result.Valid = true
+	for _, issue := range result.Issues {
+		if issue.Severity == IssueError {
+			result.Valid = false
+		}
+	}
+	if result.Valid {
+		fingerprint, err := projectFingerprint(project, sc.Stack)
+		if err != nil {
+			return "", err
+		}
+		sc.Validations.record(fingerprint)
+	}
+	return formatValidationResult(result)
+}
+
+func formatValidationResult(result ValidationResult) (string, error) {
+	if result.Issues == nil {
+		result.Issues = []ValidationIssue{}
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func composeFilePaths(params common.LoaderParams) []string {
+	if len(params.ComposeFilePaths) > 0 {
+		return params.ComposeFilePaths
+	}
+	for _, name := range []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"} {
+		if _, err := os.Stat(name); err == nil {
+			return []string{name}
+		}
+	}
+	return nil
+}
+
+var (
+	servicePrefixPattern = regexp.MustCompile(`^service "([^"]+)": `)
+	servicePathPattern   = regexp.MustCompile(`services\.([A-Za-z0-9._-]+?)(?:\.([a-z_]+))?(?:[ :]|$)`)
+	directivePattern     = regexp.MustCompile(`directive: ([a-z_]+)`)
+	yamlLinePattern      = regexp.MustCompile(`line (\d+)`)
+	fileInErrorPattern   = regexp.MustCompile(`([\w./-]+\.ya?ml)`)
+)
+
+// splitErrors returns the individual errors of errors.Join, recursively.
+func splitErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, splitErrors(e)...)
+		}
+		return errs
+	}
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+func issuesFromError(err error, severity IssueSeverity, files []string) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, e := range splitErrors(err) {
+		issues = append(issues, issueFromMessage(e.Error(), severity, files))
+	}
+	return issues
+}
+
+// issueFromMessage locates the problem in the message by the line number of a
+// YAML error, or else by the service and directive it mentions.
+func issueFromMessage(message string, severity IssueSeverity, files []string) ValidationIssue {
+	issue := ValidationIssue{Severity: severity, Message: message}
+	if m := fileInErrorPattern.FindStringSubmatch(message); m != nil {
+		for _, file := range files {
+			if file == m[1] || strings.HasSuffix(file, "/"+m[1]) {
+				files = []string{file}
+				break
+			}
+		}
+	}
+	var directive string
+	if m := servicePrefixPattern.FindStringSubmatch(message); m != nil {
+		issue.Service = m[1]
+	} else if m := servicePathPattern.FindStringSubmatch(message); m != nil {
+		issue.Service, directive = m[1], m[2]
+	}
+	if m := directivePattern.FindStringSubmatch(message); m != nil {
+		directive = m[1]
+	}
+	// YAML errors can mention the line of the enclosing block first
+	if m := yamlLinePattern.FindAllStringSubmatch(message, -1); m != nil && len(files) > 0 {
+		issue.File = files[0]
+		issue.Line, _ = strconv.Atoi(m[len(m)-1][1])
+		return issue
+	}
+	if issue.Service != "" {
+		issue.File, issue.Line = locateInCompose(files, issue.Service, directive)
+	}
+	return issue
+}
+
+// configIssues returns an issue for each missing config variable, located at
+// the environment variable of the first service that uses it.
+func configIssues(err error, project *compose.Project, files []string) []ValidationIssue {
+	var missing compose.ErrMissingConfig
+	if !errors.As(err, &missing) {
+		return issuesFromError(err, IssueError, files)
+	}
+	var issues []ValidationIssue
+	for _, name := range missing {
+		issue := ValidationIssue{
+			Severity: IssueError,
+			Message:  fmt.Sprintf("missing config %q; set it with set_config before deploying", name),
+		}
+		for _, service := range project.Services {
+			if _, ok := service.Environment[name]; ok || usesConfig(service.Environment, name) {
+				issue.Service = service.Name
+				issue.File, issue.Line = locateInCompose(files, service.Name, name)
+				break
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+func usesConfig(environment map[string]*string, name string) bool {
+	for _, value := range environment {
+		if value != nil && strings.Contains(*value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// locateInCompose returns the file and line of the service in the compose
+// files, or of the first key or value under the service that matches needle.
+func locateInCompose(files []string, service, needle string) (string, int) {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+			continue
+		}
+		services := mappingValue(doc.Content[0], "services")
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			if services.Content[i].Value != service {
+				continue
+			}
+			if needle != "" {
+				if line := findInNode(services.Content[i+1], needle); line > 0 {
+					return file, line
+				}
+			}
+			return file, services.Content[i].Line
+		}
+	}
+	if len(files) > 0 {
+		return files[0], 0
+	}
+	return "", 0
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func findInNode(node *yaml.Node, needle string) int {
+	if node.Kind == yaml.ScalarNode {
+		if node.Value == needle || strings.HasPrefix(node.Value, needle+"=") || strings.Contains(node.Value, "${"+needle) || strings.Contains(node.Value, "$"+needle) {
+			return node.Line
+		}
+		return 0
+	}
+	for _, child := range node.Content {
+		if line := findInNode(child, needle); line > 0 {
+			return line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockValidateCLI is a MockDeployCLI that also lists config
+type MockValidateCLI struct {
+	MockDeployCLI
+	ConfigNames []string
+}
+
+func (m *MockValidateCLI) ListConfig(ctx context.Context, provider client.Provider, projectName string) (*defangv1.Secrets, error) {
+	m.CallLog = append(m.CallLog, "ListConfig")
+	return &defangv1.Secrets{Names: m.ConfigNames}, nil
+}
+
+func parseValidationResult(t *testing.T, result string) ValidationResult {
+	t.Helper()
+	var parsed ValidationResult
+	require.NoError(t, json.Unmarshal([]byte(result), &parsed), result)
+	return parsed
+}
+
+func TestHandleValidateComposeToolWithoutStack(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("compose.yaml", []byte(`name: validate
+services:
+  web:
+    image: nginx
+    hostname: web.local
+  worker:
+    image: alpine
+`), 0o644))
+
+	mockCLI := &MockValidateCLI{MockDeployCLI: MockDeployCLI{UseRealLoader: true}}
+	result, err := HandleValidateComposeTool(t.Context(), ValidateComposeParams{}, mockCLI, elicitations.NewController(&mockElicitationsClient{}), StackConfig{
+		Stack: &stacks.Parameters{Provider: client.ProviderAuto},
+	})
+	require.NoError(t, err)
+
+	parsed := parseValidationResult(t, result)
+	assert.False(t, parsed.Valid)
+	assert.Equal(t, "validate", parsed.Project)
+	require.Len(t, parsed.Issues, 2)
+	assert.Equal(t, IssueWarning, parsed.Issues[0].Severity)
+	assert.Contains(t, parsed.Issues[0].Message, "config variables were not checked")
+	assert.Equal(t, ValidationIssue{
+		Severity: IssueError,
+		Message:  `service "web": unsupported compose directive: hostname; consider using 'domainname' instead`,
+		Service:  "web",
+		File:     parsed.Issues[1].File,
+		Line:     5,
+	}, parsed.Issues[1])
+	assert.Contains(t, parsed.Issues[1].File, "compose.yaml")
+	assert.NotContains(t, mockCLI.CallLog, "ListConfig")
+}
+
+func TestHandleValidateComposeToolLoadError(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("compose.yaml", []byte("services:\n  web:\n    image: nginx\n   ports: [80]\n"), 0o644))
+
+	mockCLI := &MockValidateCLI{MockDeployCLI: MockDeployCLI{UseRealLoader: true}}
+	result, err := HandleValidateComposeTool(t.Context(), ValidateComposeParams{}, mockCLI, elicitations.NewController(&mockElicitationsClient{}), StackConfig{
+		Stack: &stacks.Parameters{Provider: client.ProviderAuto},
+	})
+	require.NoError(t, err)
+
+	parsed := parseValidationResult(t, result)
+	assert.False(t, parsed.Valid)
+	require.Len(t, parsed.Issues, 2)
+	assert.Equal(t, "compose.yaml", parsed.Issues[1].File)
+	assert.Equal(t, 3, parsed.Issues[1].Line) // as reported by the YAML parser
+}
+
+func TestDeployRequiresValidation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeCompose := func(image string) {
+		require.NoError(t, os.WriteFile("compose.yaml", []byte(`name: validate
+services:
+  web:
+    image: `+image+`
+    environment:
+      API_KEY:
+`), 0o644))
+	}
+	writeCompose("nginx")
+
+	mockCLI := &MockValidateCLI{MockDeployCLI: MockDeployCLI{
+		UseRealLoader: true,
+		ComposeUpResponse: &defangv1.DeployResponse{
+			Etag:     "test-etag",
+			Services: []*defangv1.ServiceInfo{{Service: &defangv1.Service{Name: "web"}}},
+		},
+	}}
+	ec := elicitations.NewController(&mockElicitationsClient{})
+	sc := StackConfig{
+		FabricAddr:        "test-cluster",
+		Stack:             &stacks.Parameters{Name: "production", Provider: client.ProviderAWS},
+		RequireValidation: true,
+		Validations:       &Validations{},
+	}
+	params := common.LoaderParams{WorkingDirectory: "."}
+
+	deploy := func() string {
+		t.Helper()
+		result, err := HandleDeployTool(t.Context(), DeployParams{LoaderParams: params}, mockCLI, ec, sc)
+		require.NoError(t, err)
+		return result
+	}
+	validate := func() ValidationResult {
+		t.Helper()
+		result, err := HandleValidateComposeTool(t.Context(), ValidateComposeParams{LoaderParams: params}, mockCLI, ec, sc)
+		require.NoError(t, err)
+		return parseValidationResult(t, result)
+	}
+
+	assert.Contains(t, deploy(), "must pass validate_compose")
+	assert.Nil(t, mockCLI.DeployedProject)
+
+	// The missing config fails the validation, at the line of the variable
+	parsed := validate()
+	assert.False(t, parsed.Valid)
+	require.Len(t, parsed.Issues, 1)
+	assert.Equal(t, "web", parsed.Issues[0].Service)
+	assert.Equal(t, 6, parsed.Issues[0].Line)
+	assert.Contains(t, deploy(), "must pass validate_compose")
+
+	mockCLI.ConfigNames = []string{"API_KEY"}
+	assert.True(t, validate().Valid)
+	assert.Contains(t, deploy(), "started successfully")
+	assert.NotNil(t, mockCLI.DeployedProject)
+
+	// Changing the compose file requires validating again
+	writeCompose("nginx:alpine")
+	assert.Contains(t, deploy(), "must pass validate_compose")
+}
+
+func TestIssueFromMessage(t *testing.T) {
+	files := []string{"/app/compose.yaml"}
+	tests := []struct {
+		message string
+		want    ValidationIssue
+	}{
+		{
+			message: "yaml: line 7: did not find expected key",
+			want:    ValidationIssue{Severity: IssueError, Message: "yaml: line 7: did not find expected key", File: "/app/compose.yaml", Line: 7},
+		},
+		{
+			message: "validating compose.yaml: services.web additional properties 'foo' not allowed",
+			want:    ValidationIssue{Severity: IssueError, Message: "validating compose.yaml: services.web additional properties 'foo' not allowed", Service: "web", File: "/app/compose.yaml"},
+		},
+		{
+			message: "something unrelated",
+			want:    ValidationIssue{Severity: IssueError, Message: "something unrelated"},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, issueFromMessage(tt.message, IssueError, files))
+	}
+}
@@ -30,7 +30,8 @@ func CdCommand(ctx context.Context, projectName string, provider client.Provider
 	}
 
 	var statesUrl, eventsUrl string
-	if _, ok := provider.(*client.PlaygroundProvider); !ok && command != client.CdCommandList { // Do not need upload URLs for Playground/List
+	offline := client.IsOffline(provider)
+	if _, ok := provider.(*client.PlaygroundProvider); !ok && !offline && command != client.CdCommandList { // Do not need upload URLs for Playground/offline/List
 		var err error
 		statesUrl, eventsUrl, err = GetStatesAndEventsUploadUrls(ctx, projectName, provider, fabric)
 		if err != nil {
@@ -43,6 +44,10 @@ func CdCommand(ctx context.Context, projectName string, provider client.Provider
 		return "", err
 	}
 
+	if offline {
+		return cd.ETag, nil // no subdomain or deployment history to update
+	}
+
 	action := defangv1.DeploymentAction_DEPLOYMENT_ACTION_REFRESH
 	switch command {
 	case client.CdCommandDown, client.CdCommandDestroy:
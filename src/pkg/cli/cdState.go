@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc/state"
+	"github.com/DefangLabs/defang/src/pkg/dryrun"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+const maxOutputLength = 100 // truncate long outputs unless verbose
+
+var ErrStateRepairCanceled = errors.New("state repair canceled")
+
+type pendingOperationRow struct {
+	Stack     string
+	Operation string
+	URN       string
+}
+
+func getStateStore(provider client.Provider) (client.StateStore, error) {
+	store, ok := provider.(client.StateStore)
+	if !ok {
+		return nil, errors.New("inspecting the CD state is only supported for BYOC AWS, GCP, and Azure")
+	}
+	return store, nil
+}
+
+func loadSnapshot(ctx context.Context, store client.StateStore, projectName, stackName string) ([]byte, *state.Snapshot, error) {
+	key := state.StateKey(projectName, stackName)
+	term.Debug("Loading Pulumi state from", key)
+	data, err := store.GetStateObject(ctx, key)
+	if err != nil {
+		if errors.Is(err, client.ErrNotExist) {
+			return nil, nil, fmt.Errorf("no state found for stack %s/%s", projectName, stackName)
+		}
+		return nil, nil, err
+	}
+	snap, err := state.ParseSnapshot(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return data, snap, nil
+}
+
+// CdStateShow prints the resources in the Pulumi state of the given stack,
+// grouped by type, with their outputs. Secret outputs are redacted.
+func CdStateShow(ctx context.Context, provider client.Provider, projectName, stackName string, verbose bool) error {
+	store, err := getStateStore(provider)
+	if err != nil {
+		return err
+	}
+	_, snap, err := loadSnapshot(ctx, store, projectName, stackName)
+	if err != nil {
+		return err
+	}
+
+	byType := make(map[string][]state.Resource)
+	for _, res := range snap.Resources {
+		byType[res.Type] = append(byType[res.Type], res)
+	}
+	term.Infof("Stack %s/%s has %d resources", projectName, stackName, len(snap.Resources))
+	for _, typ := range slices.Sorted(maps.Keys(byType)) {
+		resources := byType[typ]
+		term.Printf("\n%s (%d)\n", typ, len(resources))
+		for _, res := range resources {
+			term.Println("  " + res.URN)
+			if res.ID != "" {
+				term.Println("    id: " + res.ID)
+			}
+			outputs := res.RedactedOutputs()
+			for _, k := range slices.Sorted(maps.Keys(outputs)) {
+				term.Printf("    %s: %s\n", k, formatOutput(outputs[k], verbose))
+			}
+		}
+	}
+	if n := len(snap.PendingOperations); n > 0 {
+		term.Warnf("Stack %s/%s has %d pending operations; see \"defang cd state pending\"", projectName, stackName, n)
+	}
+	return nil
+}
+
+func formatOutput(v any, verbose bool) string {
+	var s string
+	if str, ok := v.(string); ok {
+		s = str
+	} else if b, err := json.Marshal(v); err == nil {
+		s = string(b)
+	} else {
+		s = fmt.Sprint(v)
+	}
+	if !verbose && len(s) > maxOutputLength {
+		s = s[:maxOutputLength] + "…"
+	}
+	return s
+}
+
+// CdStatePending prints the pending operations of the given stack, or of all
+// stacks in the CD storage if projectName is empty.
+func CdStatePending(ctx context.Context, provider client.Provider, projectName, stackName string) error {
+	store, err := getStateStore(provider)
+	if err != nil {
+		return err
+	}
+
+	var stacks []state.Info
+	if projectName != "" {
+		stacks = []state.Info{{Project: projectName, Stack: stackName}}
+	} else {
+		stacksIter, err := provider.CdList(ctx, false)
+		if err != nil {
+			return err
+		}
+		stacks = slices.Collect(stacksIter)
+	}
+
+	var rows []pendingOperationRow
+	for _, st := range stacks {
+		_, snap, err := loadSnapshot(ctx, store, st.Project, st.Stack)
+		if err != nil {
+			if projectName != "" {
+				return err
+			}
+			term.Debugf("Skipping stack %s/%s: %v", st.Project, st.Stack, err)
+			continue
+		}
+		for _, op := range snap.PendingOperations {
+			rows = append(rows, pendingOperationRow{
+				Stack:     st.Project + "/" + st.Stack,
+				Operation: op.Type,
+				URN:       op.Resource.URN,
+			})
+		}
+	}
+
+	if len(rows) == 0 {
+		term.Info("No pending operations found")
+		return nil
+	}
+	return term.Table(rows, "Stack", "Operation", "URN")
+}
+
+// CdStateRepair removes the pending operations from the Pulumi state of the
+// given stack, after writing a backup of the state next to it. Pending creates
+// whose URN is in imports are added to the state with the given cloud ID
+// instead. Unless force is true, the user is asked to confirm first.
+func CdStateRepair(ctx context.Context, provider client.Provider, projectName, stackName string, imports map[string]string, force bool) error {
+	store, err := getStateStore(provider)
+	if err != nil {
+		return err
+	}
+	data, snap, err := loadSnapshot(ctx, store, projectName, stackName)
+	if err != nil {
+		return err
+	}
+	if len(snap.PendingOperations) == 0 {
+		term.Infof("Stack %s/%s has no pending operations", projectName, stackName)
+		return nil
+	}
+
+	repaired, err := state.RepairPendingOperations(data, imports)
+	if err != nil {
+		return err
+	}
+
+	var needRefresh bool
+	for _, op := range snap.PendingOperations {
+		urn := op.Resource.URN
+		if id, ok := imports[urn]; ok {
+			term.Infof("Import %s with ID %q", urn, id)
+			needRefresh = true
+			continue
+		}
+		term.Infof("Clear pending %s of %s", op.Type, urn)
+		switch op.Type {
+		case "creating", "importing":
+			term.Warnf("%s might exist in the cloud; if so, import it with --import=%s=ID or delete it", op.Resource.Name(), urn)
+		case "deleting", "updating":
+			needRefresh = true
+		}
+	}
+
+	if dryrun.DoDryRun {
+		return dryrun.ErrDryRun
+	}
+
+	if !force {
+		var confirm bool
+		if err := survey.AskOne(&survey.Confirm{
+			Message: fmt.Sprintf("Make sure no deployment of %s/%s is running. Repair the state?", projectName, stackName),
+			Default: false,
+		}, &confirm, survey.WithStdio(term.DefaultTerm.Stdio())); err != nil {
+			return err
+		} else if !confirm {
+			return ErrStateRepairCanceled
+		}
+	}
+
+	// Refuse to repair while a deployment is running, and keep deployments from
+	// starting until the repaired state is written.
+	if locks, ok := provider.(client.LockStore); ok {
+		lease, err := acquireDeployLock(ctx, locks, projectName, stackName, 0)
+		if err != nil {
+			return err
+		}
+		defer lease.Release(ctx)
+
+		current, _, err := loadSnapshot(ctx, store, projectName, stackName)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, data) {
+			return fmt.Errorf("the state of %s/%s changed while preparing the repair; please try again", projectName, stackName)
+		}
+	}
+
+	key := state.StateKey(projectName, stackName)
+	backupKey := key + "." + time.Now().UTC().Format("20060102T150405Z") + ".bak"
+	if err := store.PutStateObject(ctx, backupKey, data); err != nil {
+		return fmt.Errorf("failed to back up the state: %w", err)
+	}
+	term.Info("Backed up the state to", backupKey)
+	if err := store.PutStateObject(ctx, key, repaired); err != nil {
+		return fmt.Errorf("failed to write the repaired state: %w", err)
+	}
+	term.Infof("Repaired the state of %s/%s", projectName, stackName)
+	if needRefresh {
+		term.Info("Run \"defang cd refresh\" to sync the state with the cloud resources")
+	}
+	return nil
+}
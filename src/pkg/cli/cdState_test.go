@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc/state"
+	"github.com/DefangLabs/defang/src/pkg/dryrun"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+type mockStateStore struct {
+	client.Provider
+	objects map[string][]byte
+}
+
+func (m *mockStateStore) GetStateObject(ctx context.Context, key string) ([]byte, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, client.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m *mockStateStore) PutStateObject(ctx context.Context, key string, data []byte) error {
+	m.objects[key] = data
+	return nil
+}
+
+func newMockStateStore(t *testing.T) *mockStateStore {
+	t.Helper()
+	data, err := os.ReadFile("client/byoc/state/testdata/pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mockStateStore{objects: map[string][]byte{state.StateKey("unit-test", "beta"): data}}
+}
+
+func TestCdStateShow(t *testing.T) {
+	stdout, _ := term.SetupTestTerm(t)
+	store := newMockStateStore(t)
+
+	if err := CdStateShow(t.Context(), store, "unit-test", "beta", false); err != nil {
+		t.Fatalf("CdStateShow() error = %v", err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"aws:ecs/cluster:Cluster (1)",
+		"urn:pulumi:beta::unit-test::defang-mvp:shared/ecs/defang:Defang$aws:ecs/cluster:Cluster::cluster",
+		"id: arn:aws:ecs:us-west-2:381492210770:cluster/Defang-unit-test-beta-cluster",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output: %s", want, out)
+		}
+	}
+
+	if err := CdStateShow(t.Context(), store, "unit-test", "missing", false); err == nil {
+		t.Error("expected error for missing stack")
+	}
+	if err := CdStateShow(t.Context(), MockConfigDeleteProvider{}, "unit-test", "beta", false); err == nil {
+		t.Error("expected error for unsupported provider")
+	}
+}
+
+func TestCdStatePending(t *testing.T) {
+	stdout, _ := term.SetupTestTerm(t)
+	store := newMockStateStore(t)
+
+	if err := CdStatePending(t.Context(), store, "unit-test", "beta"); err != nil {
+		t.Fatalf("CdStatePending() error = %v", err)
+	}
+	if got := strings.Count(stdout.String(), "creating"); got != 3 {
+		t.Errorf("expected 3 pending creates, got %d in output: %s", got, stdout.String())
+	}
+}
+
+// mockStateLockStore is a CD storage with both state objects and deploy locks.
+type mockStateLockStore struct {
+	client.Provider
+	*mockStateStore
+	*mockLockStore
+}
+
+func (m mockStateLockStore) GetStackName() string {
+	return "beta"
+}
+
+func TestCdStateRepair(t *testing.T) {
+	term.SetupTestTerm(t)
+	key := state.StateKey("unit-test", "beta")
+
+	t.Run("dry run", func(t *testing.T) {
+		dryrun.DoDryRun = true
+		t.Cleanup(func() { dryrun.DoDryRun = false })
+
+		store := newMockStateStore(t)
+		if err := CdStateRepair(t.Context(), store, "unit-test", "beta", nil, true); !errors.Is(err, dryrun.ErrDryRun) {
+			t.Fatalf("Expected dryrun.ErrDryRun, got %v", err)
+		}
+		if len(store.objects) != 1 {
+			t.Errorf("dry run wrote objects: %d", len(store.objects))
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		store := newMockStateStore(t)
+		original := store.objects[key]
+		if err := CdStateRepair(t.Context(), store, "unit-test", "beta", nil, true); err != nil {
+			t.Fatalf("CdStateRepair() error = %v", err)
+		}
+		if len(store.objects) != 2 {
+			t.Fatalf("expected a backup next to the state, got %d objects", len(store.objects))
+		}
+		for k, data := range store.objects {
+			if k != key {
+				if !strings.HasPrefix(k, key+".") || !strings.HasSuffix(k, ".bak") || string(data) != string(original) {
+					t.Errorf("unexpected backup %q", k)
+				}
+			}
+		}
+		snap, err := state.ParseSnapshot(store.objects[key])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.PendingOperations) != 0 {
+			t.Errorf("expected no pending operations, got %d", len(snap.PendingOperations))
+		}
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		store := mockStateLockStore{mockStateStore: newMockStateStore(t), mockLockStore: newMockLockStore()}
+		lease, err := AcquireDeployLock(t.Context(), store, "unit-test", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lease.Release(t.Context())
+
+		var lockErr ErrDeployLocked
+		if err := CdStateRepair(t.Context(), store, "unit-test", "beta", nil, true); !errors.As(err, &lockErr) {
+			t.Fatalf("Expected ErrDeployLocked, got %v", err)
+		}
+		if len(store.mockStateStore.objects) != 1 {
+			t.Errorf("locked repair wrote objects: %d", len(store.mockStateStore.objects))
+		}
+	})
+
+	t.Run("lock released", func(t *testing.T) {
+		store := mockStateLockStore{mockStateStore: newMockStateStore(t), mockLockStore: newMockLockStore()}
+		if err := CdStateRepair(t.Context(), store, "unit-test", "beta", nil, true); err != nil {
+			t.Fatalf("CdStateRepair() error = %v", err)
+		}
+		if store.mockLockStore.puts != 1 || len(store.mockLockStore.objects) != 0 {
+			t.Errorf("expected the deploy lock to be taken and released, got %d puts and %d locks", store.mockLockStore.puts, len(store.mockLockStore.objects))
+		}
+	})
+
+	t.Run("bad import", func(t *testing.T) {
+		store := newMockStateStore(t)
+		if err := CdStateRepair(t.Context(), store, "unit-test", "beta", map[string]string{"urn:unknown": "id"}, true); err == nil {
+			t.Error("expected error")
+		}
+		if len(store.objects) != 1 {
+			t.Errorf("failed repair wrote objects: %d", len(store.objects))
+		}
+	})
+}
@@ -136,7 +136,7 @@ func NewByocProvider(ctx context.Context, tenantName types.TenantLabel, stack st
 	}
 	b.ByocBaseClient = byoc.NewByocBaseClient(tenantName, b, stack)
 
-	b.driver.TokenStore = &tokenstore.LocalDirTokenStore{Dir: filepath.Join(client.StateDir, "providers", "aws")}
+	b.driver.TokenStore = tokenstore.New("defang-aws", filepath.Join(client.StateDir, "providers", "aws"))
 	b.driver.ExistingBucket = os.Getenv("DEFANG_CD_BUCKET") // adopt an existing CD bucket; `cd install --bucket` overrides
 	return b
 }
@@ -723,6 +723,21 @@ func (b *ByocAws) ListConfig(ctx context.Context, req *defangv1.ListConfigsReque
 	return &defangv1.Secrets{Names: configs}, nil
 }
 
+// GetConfigVersions implements client.ConfigVersioner, using the versions of
+// the SSM parameters.
+func (b *ByocAws) GetConfigVersions(ctx context.Context, req *defangv1.ListConfigsRequest) (map[string]string, error) {
+	prefix := b.getSecretID(req.Project, "")
+	awsVersions, err := b.driver.ListSecretVersionsByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, AnnotateAwsError(err)
+	}
+	versions := make(map[string]string, len(awsVersions))
+	for secret, version := range awsVersions {
+		versions[strings.TrimPrefix(secret, prefix)] = strconv.FormatInt(version, 10)
+	}
+	return versions, nil
+}
+
 func (b *ByocAws) CreateUploadURL(ctx context.Context, req *defangv1.UploadURLRequest) (*defangv1.UploadURLResponse, error) {
 	if err := b.SetUpCD(ctx, false); err != nil {
 		return nil, err
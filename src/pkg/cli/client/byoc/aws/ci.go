@@ -0,0 +1,343 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc"
+	"github.com/DefangLabs/defang/src/pkg/clouds/aws"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+const (
+	ciAudience   = "sts.amazonaws.com"
+	ciPolicyName = "defang-deployer"
+)
+
+type policyStatement struct {
+	Effect    string
+	Principal map[string]string `json:",omitempty"`
+	Action    any
+	Resource  any                          `json:",omitempty"`
+	Condition map[string]map[string]string `json:",omitempty"`
+}
+
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+func (p policyDocument) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// samePolicy compares two policy documents, ignoring formatting.
+func samePolicy(a, b string) bool {
+	var x, y any
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// ciRoleName is unique per project and stack. Names longer than the IAM limit
+// of 64 characters are shortened with a hash of the full name, so they cannot
+// collide when truncated.
+func (b *ByocAws) ciRoleName(projectName string) string {
+	name := b.Prefix + "-ci-" + projectName + "-" + b.PulumiStack
+	if len(name) > 64 {
+		sum := sha256.Sum256([]byte(name))
+		hash := hex.EncodeToString(sum[:4])
+		name = name[:64-len(hash)-1] + "-" + hash
+	}
+	return name
+}
+
+func (b *ByocAws) ciOIDCProviderARN() string {
+	return fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", b.driver.AccountID, client.GitHubOIDCIssuer)
+}
+
+func (b *ByocAws) ciTrustPolicy(req client.CIRequest) string {
+	return policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Effect:    "Allow",
+			Principal: map[string]string{"Federated": b.ciOIDCProviderARN()},
+			Action:    "sts:AssumeRoleWithWebIdentity",
+			Condition: map[string]map[string]string{
+				"StringEquals": {
+					client.GitHubOIDCIssuer + ":aud": ciAudience,
+					client.GitHubOIDCIssuer + ":sub": req.Subject(),
+				},
+			},
+		}},
+	}.String()
+}
+
+// ciDeployerPolicy allows what the CLI does to deploy the stack of the given
+// project: the actual deployment runs in the CD CodeBuild project, with its own
+// role. Config, log groups, and the objects in the CD bucket are limited to the
+// stack; the CD project and the uploads are shared by all stacks.
+//
+// NOTE: the CLI overrides the buildspec of every build it starts, so it cannot
+// be denied here. Whoever can start a build of the CD project can run any
+// command with the CD role, which can deploy any stack in the account; the
+// scoping below only limits what the workflow can do directly.
+func (b *ByocAws) ciDeployerPolicy(projectName string) string {
+	stackPath := b.StackDir(projectName, "*") // /Defang/project/stack/*
+	bucketARN := "arn:aws:s3:::" + b.bucketName()
+	lockARN := bucketARN + "/" + client.DeployLockKey(projectName, b.PulumiStack)
+	return policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"codebuild:StartBuild", "codebuild:BatchGetBuilds", "codebuild:StopBuild"},
+				Resource: b.driver.MakeRegionalARN("codebuild", "project/"+b.driver.ProjectName),
+			},
+			{
+				Effect:   "Allow",
+				Action:   "cloudformation:DescribeStacks",
+				Resource: b.driver.MakeRegionalARN("cloudformation", "stack/"+byoc.CdTaskPrefix+"/*"),
+			},
+			{
+				Effect:   "Allow",
+				Action:   "s3:ListBucket",
+				Resource: bucketARN,
+			},
+			{
+				Effect: "Allow",
+				Action: "s3:GetObject",
+				Resource: []string{
+					bucketARN + "/.pulumi/stacks/" + projectName + "/" + b.PulumiStack + "*",
+					bucketARN + "/" + path.Dir(b.GetProjectUpdatePath(projectName)) + "/*",
+					lockARN,
+				},
+			},
+			{
+				Effect:   "Allow",
+				Action:   "s3:PutObject",
+				Resource: []string{bucketARN + "/" + byoc.UploadPrefix + "*", lockARN},
+			},
+			{
+				Effect:   "Allow",
+				Action:   "s3:DeleteObject",
+				Resource: lockARN,
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"ssm:GetParameter", "ssm:GetParameters", "ssm:GetParametersByPath", "ssm:PutParameter", "ssm:DeleteParameter", "ssm:DeleteParameters"},
+				Resource: b.driver.MakeRegionalARN("ssm", "parameter"+stackPath),
+			},
+			{
+				Effect:   "Allow",
+				Action:   "ssm:DescribeParameters",
+				Resource: "*", // cannot be limited to a path
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"logs:StartLiveTail", "logs:FilterLogEvents", "logs:GetLogEvents", "logs:DescribeLogStreams"},
+				Resource: []string{b.driver.LogGroupARN, b.makeLogGroupARN(stackPath)},
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"route53:ListHostedZonesByName", "route53:GetHostedZone", "route53:ListResourceRecordSets"},
+				Resource: "*", // for custom domains
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"servicequotas:GetServiceQuota", "servicequotas:ListServiceQuotas"},
+				Resource: "*", // for the quota checks before deploying
+			},
+		},
+	}.String()
+}
+
+func (b *ByocAws) ciPrepare(ctx context.Context, req client.CIRequest) (aws.IamClientAPI, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := b.driver.FillOutputs(ctx); err != nil {
+		return nil, fmt.Errorf("the CD stack must be installed first, with \"defang cd install\": %w", AnnotateAwsError(err))
+	}
+	if b.driver.AccountID == "" {
+		if _, err := b.AccountInfo(ctx); err != nil {
+			return nil, err
+		}
+	}
+	cfg, err := b.driver.LoadConfig(ctx)
+	if err != nil {
+		return nil, AnnotateAwsError(err)
+	}
+	return aws.NewIamFromConfig(cfg), nil
+}
+
+// SetUpCI creates or verifies the IAM OIDC provider for GitHub Actions and a
+// role that the given workflow can assume to deploy this stack. If the CD stack
+// was installed with its own CI role for GitHub Actions, that role is used
+// instead; its trust and permissions are managed by the CD stack's parameters.
+func (b *ByocAws) SetUpCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	iam, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return b.setUpCI(ctx, iam, req)
+}
+
+// cdCIRole returns the CI role of the CD stack, if the stack has one that
+// trusts the GitHub Actions OIDC provider.
+func (b *ByocAws) cdCIRole(ctx context.Context, iam aws.IamClientAPI) (*aws.IamRole, error) {
+	if b.driver.CIRoleARN == "" {
+		return nil, nil
+	}
+	roleName := b.driver.CIRoleARN[strings.LastIndex(b.driver.CIRoleARN, "/")+1:]
+	role, err := iam.GetRole(ctx, roleName)
+	if err != nil {
+		if aws.IsNoSuchEntity(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get IAM role of the CD stack: %w", err)
+	}
+	if !strings.Contains(role.AssumeRolePolicyDocument, b.ciOIDCProviderARN()) {
+		term.Debug("IAM role", roleName, "of the CD stack does not trust", client.GitHubOIDCIssuer)
+		return nil, nil
+	}
+	return role, nil
+}
+
+func (b *ByocAws) setUpCI(ctx context.Context, iam aws.IamClientAPI, req client.CIRequest) (*client.CIResponse, error) {
+	resp := &client.CIResponse{}
+
+	// 0. Don't create a second role next to the one the CD stack already has
+	if role, err := b.cdCIRole(ctx, iam); err != nil {
+		return nil, err
+	} else if role != nil {
+		resp.Addf("use IAM role %s of the CD stack, which trusts the subjects in its OIDC parameters; make sure they include %s", role.RoleName, req.Subject())
+		resp.Env = map[string]string{
+			"AWS_REGION":   string(b.driver.Region),
+			"AWS_ROLE_ARN": role.Arn,
+		}
+		return resp, nil
+	}
+
+	// 1. The OIDC provider is a singleton per issuer and account, so one created by the CD stack is reused
+	providerARN := b.ciOIDCProviderARN()
+	clientIDs, err := iam.GetOpenIDConnectProvider(ctx, providerARN)
+	switch {
+	case aws.IsNoSuchEntity(err):
+		resp.Addf("create IAM OIDC provider %s", providerARN)
+		if !req.DryRun {
+			if _, err := iam.CreateOpenIDConnectProvider(ctx, "https://"+client.GitHubOIDCIssuer, []string{ciAudience}); err != nil {
+				return nil, fmt.Errorf("failed to create IAM OIDC provider: %w", err)
+			}
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get IAM OIDC provider: %w", err)
+	case !slices.Contains(clientIDs, ciAudience):
+		resp.Addf("add audience %s to IAM OIDC provider %s", ciAudience, providerARN)
+		if !req.DryRun {
+			if err := iam.AddClientIDToOpenIDConnectProvider(ctx, providerARN, ciAudience); err != nil {
+				return nil, fmt.Errorf("failed to update IAM OIDC provider: %w", err)
+			}
+		}
+	default:
+		resp.Addf("verified IAM OIDC provider %s", providerARN)
+	}
+
+	// 2. The role, trusting only the given branch or environment
+	roleName := b.ciRoleName(req.Project)
+	trustPolicy := b.ciTrustPolicy(req)
+	role, err := iam.GetRole(ctx, roleName)
+	switch {
+	case aws.IsNoSuchEntity(err):
+		resp.Addf("create IAM role %s for %s", roleName, req.Subject())
+		if !req.DryRun {
+			description := fmt.Sprintf("Deploys stack %q of Defang project %q from GitHub Actions", b.PulumiStack, req.Project)
+			if role, err = iam.CreateRole(ctx, roleName, description, trustPolicy); err != nil {
+				return nil, fmt.Errorf("failed to create IAM role: %w", err)
+			}
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get IAM role: %w", err)
+	case !samePolicy(role.AssumeRolePolicyDocument, trustPolicy):
+		resp.Addf("update trust policy of IAM role %s to %s", roleName, req.Subject())
+		if !req.DryRun {
+			if err := iam.UpdateAssumeRolePolicy(ctx, roleName, trustPolicy); err != nil {
+				return nil, fmt.Errorf("failed to update IAM role: %w", err)
+			}
+		}
+	default:
+		resp.Addf("verified IAM role %s", roleName)
+	}
+
+	// 3. The deployer permissions
+	policy := b.ciDeployerPolicy(req.Project)
+	existing, err := iam.GetRolePolicy(ctx, roleName, ciPolicyName)
+	switch {
+	case err != nil && !aws.IsNoSuchEntity(err):
+		return nil, fmt.Errorf("failed to get IAM role policy: %w", err)
+	case err == nil && samePolicy(existing, policy):
+		resp.Addf("verified policy %s of IAM role %s", ciPolicyName, roleName)
+	default:
+		resp.Addf("put policy %s on IAM role %s", ciPolicyName, roleName)
+		if !req.DryRun {
+			if err := iam.PutRolePolicy(ctx, roleName, ciPolicyName, policy); err != nil {
+				return nil, fmt.Errorf("failed to put IAM role policy: %w", err)
+			}
+		}
+	}
+
+	roleARN := fmt.Sprintf("arn:aws:iam::%s:role/%s", b.driver.AccountID, roleName)
+	if role != nil {
+		roleARN = role.Arn
+	}
+	resp.Env = map[string]string{
+		"AWS_REGION":   string(b.driver.Region),
+		"AWS_ROLE_ARN": roleARN,
+	}
+	return resp, nil
+}
+
+// TearDownCI deletes the CI role of this stack. The OIDC provider is kept,
+// since other roles in the account may trust it. A CI role of the CD stack is
+// left alone; it goes away with the CD stack or its OIDC parameters.
+func (b *ByocAws) TearDownCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	iam, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return b.tearDownCI(ctx, iam, req)
+}
+
+func (b *ByocAws) tearDownCI(ctx context.Context, iam aws.IamClientAPI, req client.CIRequest) (*client.CIResponse, error) {
+	resp := &client.CIResponse{}
+	roleName := b.ciRoleName(req.Project)
+	if _, err := iam.GetRole(ctx, roleName); err != nil {
+		if aws.IsNoSuchEntity(err) {
+			term.Debug("IAM role", roleName, "does not exist")
+			return resp, nil
+		}
+		return nil, fmt.Errorf("failed to get IAM role: %w", err)
+	}
+	resp.Addf("delete policy %s of IAM role %s", ciPolicyName, roleName)
+	resp.Addf("delete IAM role %s", roleName)
+	if req.DryRun {
+		return resp, nil
+	}
+	if err := iam.DeleteRolePolicy(ctx, roleName, ciPolicyName); err != nil && !aws.IsNoSuchEntity(err) {
+		return nil, fmt.Errorf("failed to delete IAM role policy: %w", err)
+	}
+	if err := iam.DeleteRole(ctx, roleName); err != nil && !aws.IsNoSuchEntity(err) {
+		return nil, fmt.Errorf("failed to delete IAM role: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,232 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/clouds/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIam struct {
+	providers map[string][]string
+	roles     map[string]*aws.IamRole
+	policies  map[string]string // role/policy → document
+	calls     []string
+}
+
+func newFakeIam() *fakeIam {
+	return &fakeIam{
+		providers: map[string][]string{},
+		roles:     map[string]*aws.IamRole{},
+		policies:  map[string]string{},
+	}
+}
+
+var errNoSuchEntity = &aws.IamError{Code: "NoSuchEntity", Message: "not found"}
+
+func (f *fakeIam) GetOpenIDConnectProvider(ctx context.Context, arn string) ([]string, error) {
+	ids, ok := f.providers[arn]
+	if !ok {
+		return nil, errNoSuchEntity
+	}
+	return ids, nil
+}
+
+func (f *fakeIam) CreateOpenIDConnectProvider(ctx context.Context, url string, clientIDs []string) (string, error) {
+	f.calls = append(f.calls, "CreateOpenIDConnectProvider "+url)
+	arn := "arn:aws:iam::123456789012:oidc-provider/" + strings.TrimPrefix(url, "https://")
+	f.providers[arn] = clientIDs
+	return arn, nil
+}
+
+func (f *fakeIam) AddClientIDToOpenIDConnectProvider(ctx context.Context, arn, clientID string) error {
+	f.calls = append(f.calls, "AddClientIDToOpenIDConnectProvider "+clientID)
+	f.providers[arn] = append(f.providers[arn], clientID)
+	return nil
+}
+
+func (f *fakeIam) GetRole(ctx context.Context, roleName string) (*aws.IamRole, error) {
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil, errNoSuchEntity
+	}
+	return role, nil
+}
+
+func (f *fakeIam) CreateRole(ctx context.Context, roleName, description, assumeRolePolicy string) (*aws.IamRole, error) {
+	f.calls = append(f.calls, "CreateRole "+roleName)
+	role := &aws.IamRole{Arn: "arn:aws:iam::123456789012:role/" + roleName, RoleName: roleName, AssumeRolePolicyDocument: assumeRolePolicy}
+	f.roles[roleName] = role
+	return role, nil
+}
+
+func (f *fakeIam) UpdateAssumeRolePolicy(ctx context.Context, roleName, assumeRolePolicy string) error {
+	f.calls = append(f.calls, "UpdateAssumeRolePolicy "+roleName)
+	f.roles[roleName].AssumeRolePolicyDocument = assumeRolePolicy
+	return nil
+}
+
+func (f *fakeIam) GetRolePolicy(ctx context.Context, roleName, policyName string) (string, error) {
+	policy, ok := f.policies[roleName+"/"+policyName]
+	if !ok {
+		return "", errNoSuchEntity
+	}
+	return policy, nil
+}
+
+func (f *fakeIam) PutRolePolicy(ctx context.Context, roleName, policyName, policy string) error {
+	f.calls = append(f.calls, "PutRolePolicy "+roleName+"/"+policyName)
+	f.policies[roleName+"/"+policyName] = policy
+	return nil
+}
+
+func (f *fakeIam) DeleteRolePolicy(ctx context.Context, roleName, policyName string) error {
+	f.calls = append(f.calls, "DeleteRolePolicy "+roleName+"/"+policyName)
+	delete(f.policies, roleName+"/"+policyName)
+	return nil
+}
+
+func (f *fakeIam) DeleteRole(ctx context.Context, roleName string) error {
+	f.calls = append(f.calls, "DeleteRole "+roleName)
+	delete(f.roles, roleName)
+	return nil
+}
+
+func TestSetUpCI(t *testing.T) {
+	ctx := t.Context()
+	b := newTestByocAws()
+	b.driver.BucketName = "defang-cd-bucket"
+	req := client.CIRequest{Project: "app", Repo: "acme/app", Branch: "main"}
+
+	t.Run("dry run", func(t *testing.T) {
+		iam := newFakeIam()
+		resp, err := b.setUpCI(ctx, iam, client.CIRequest{Project: "app", Repo: req.Repo, Branch: req.Branch, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, iam.calls)
+		assert.Len(t, resp.Actions, 3)
+		assert.Equal(t, "arn:aws:iam::123456789012:role/Defang-ci-app-beta", resp.Env["AWS_ROLE_ARN"])
+	})
+
+	iam := newFakeIam()
+	t.Run("create", func(t *testing.T) {
+		resp, err := b.setUpCI(ctx, iam, req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"CreateOpenIDConnectProvider https://token.actions.githubusercontent.com",
+			"CreateRole Defang-ci-app-beta",
+			"PutRolePolicy Defang-ci-app-beta/defang-deployer",
+		}, iam.calls)
+		assert.Equal(t, map[string]string{
+			"AWS_REGION":   "us-test-2",
+			"AWS_ROLE_ARN": "arn:aws:iam::123456789012:role/Defang-ci-app-beta",
+		}, resp.Env)
+
+		var trust policyDocument
+		require.NoError(t, json.Unmarshal([]byte(iam.roles["Defang-ci-app-beta"].AssumeRolePolicyDocument), &trust))
+		assert.Equal(t, "repo:acme/app:ref:refs/heads/main", trust.Statement[0].Condition["StringEquals"]["token.actions.githubusercontent.com:sub"])
+		assert.Equal(t, "sts.amazonaws.com", trust.Statement[0].Condition["StringEquals"]["token.actions.githubusercontent.com:aud"])
+
+		policy := iam.policies["Defang-ci-app-beta/defang-deployer"]
+		assert.NotContains(t, policy, "AdministratorAccess")
+		assert.NotContains(t, policy, "parameter/Defang/*/")
+		assert.Contains(t, policy, "parameter/Defang/app/beta/*")
+		assert.Contains(t, policy, "log-group:/Defang/app/beta/*")
+		assert.NotContains(t, policy, `"arn:aws:s3:::defang-cd-bucket/*"`)
+		assert.Contains(t, policy, "arn:aws:s3:::defang-cd-bucket/.pulumi/stacks/app/beta*")
+		assert.Contains(t, policy, "arn:aws:s3:::defang-cd-bucket/projects/app/beta/*")
+		assert.Contains(t, policy, "arn:aws:s3:::defang-cd-bucket/locks/app/beta.json")
+		assert.Contains(t, policy, "arn:aws:s3:::defang-cd-bucket/uploads/*")
+		assert.Contains(t, policy, "servicequotas:GetServiceQuota")
+		assert.Contains(t, policy, "project/test-project")
+	})
+
+	t.Run("idempotent", func(t *testing.T) {
+		iam.calls = nil
+		resp, err := b.setUpCI(ctx, iam, req)
+		require.NoError(t, err)
+		assert.Empty(t, iam.calls)
+		for _, action := range resp.Actions {
+			assert.True(t, strings.HasPrefix(action, "verified "), action)
+		}
+	})
+
+	t.Run("change subject", func(t *testing.T) {
+		iam.calls = nil
+		_, err := b.setUpCI(ctx, iam, client.CIRequest{Project: "app", Repo: "acme/app", Environment: "prod"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"UpdateAssumeRolePolicy Defang-ci-app-beta"}, iam.calls)
+		assert.Contains(t, iam.roles["Defang-ci-app-beta"].AssumeRolePolicyDocument, "repo:acme/app:environment:prod")
+	})
+
+	t.Run("missing audience", func(t *testing.T) {
+		iam.calls = nil
+		arn := "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"
+		iam.providers[arn] = []string{"other"}
+		_, err := b.setUpCI(ctx, iam, client.CIRequest{Project: "app", Repo: "acme/app", Environment: "prod"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"AddClientIDToOpenIDConnectProvider sts.amazonaws.com"}, iam.calls)
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		iam.calls = nil
+		resp, err := b.tearDownCI(ctx, iam, client.CIRequest{Project: "app", Repo: req.Repo, Branch: req.Branch, DryRun: true})
+		require.NoError(t, err)
+		assert.Len(t, resp.Actions, 2)
+		assert.Empty(t, iam.calls)
+
+		_, err = b.tearDownCI(ctx, iam, req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"DeleteRolePolicy Defang-ci-app-beta/defang-deployer",
+			"DeleteRole Defang-ci-app-beta",
+		}, iam.calls)
+		assert.Len(t, iam.providers, 1, "the OIDC provider should be kept")
+
+		resp, err = b.tearDownCI(ctx, iam, req)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Actions)
+	})
+}
+
+func TestCIRoleName(t *testing.T) {
+	b := newTestByocAws()
+	assert.Equal(t, "Defang-ci-app-beta", b.ciRoleName("app"))
+	assert.NotEqual(t, b.ciRoleName("other"), b.ciRoleName("app"), "projects with the same stack must not share a role")
+
+	long1 := b.ciRoleName(strings.Repeat("a", 60) + "1")
+	long2 := b.ciRoleName(strings.Repeat("a", 60) + "2")
+	assert.Len(t, long1, 64)
+	assert.NotEqual(t, long1, long2, "truncated names must not collide")
+}
+
+func TestSetUpCIWithCDRole(t *testing.T) {
+	ctx := t.Context()
+	b := newTestByocAws()
+	b.driver.CIRoleARN = "arn:aws:iam::123456789012:role/defang-cd-CIRole-ABC"
+	req := client.CIRequest{Project: "app", Repo: "acme/app", Branch: "main"}
+
+	iam := newFakeIam()
+	iam.roles["defang-cd-CIRole-ABC"] = &aws.IamRole{
+		Arn:                      b.driver.CIRoleARN,
+		RoleName:                 "defang-cd-CIRole-ABC",
+		AssumeRolePolicyDocument: `{"Statement":[{"Principal":{"Federated":"` + b.ciOIDCProviderARN() + `"}}]}`,
+	}
+
+	resp, err := b.setUpCI(ctx, iam, req)
+	require.NoError(t, err)
+	assert.Empty(t, iam.calls, "the role of the CD stack should be reused")
+	assert.Equal(t, b.driver.CIRoleARN, resp.Env["AWS_ROLE_ARN"])
+
+	t.Run("other issuer", func(t *testing.T) {
+		iam.roles["defang-cd-CIRole-ABC"].AssumeRolePolicyDocument = `{"Statement":[{"Principal":{"Federated":"arn:aws:iam::123456789012:oidc-provider/gitlab.com"}}]}`
+		resp, err := b.setUpCI(ctx, iam, req)
+		require.NoError(t, err)
+		assert.Contains(t, iam.calls, "CreateRole Defang-ci-app-beta")
+		assert.Equal(t, "arn:aws:iam::123456789012:role/Defang-ci-app-beta", resp.Env["AWS_ROLE_ARN"])
+	})
+}
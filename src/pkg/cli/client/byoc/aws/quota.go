@@ -0,0 +1,104 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+)
+
+var _ client.QuotaChecker = (*ByocAws)(nil)
+
+const (
+	fargateVCPUQuotaCode = "L-3032A538" // Fargate On-Demand vCPU resource count
+	albQuotaCode         = "L-53DA6B97" // Application Load Balancers per Region
+	vCPUsPerGPU          = 4            // the smallest GPU instances have 4 vCPUs per GPU
+)
+
+// GetQuotaUsage implements client.QuotaChecker. Service Quotas does not report
+// the current usage, so only the limits are returned.
+func (b *ByocAws) GetQuotaUsage(ctx context.Context, demand client.QuotaDemand) ([]client.QuotaUsage, error) {
+	cfg, err := b.driver.LoadConfig(ctx)
+	if err != nil {
+		return nil, AnnotateAwsError(err)
+	}
+	usages, err := getQuotaUsage(ctx, NewServiceQuotasClient(cfg), cfg.Region, demand)
+	if err != nil {
+		return nil, AnnotateAwsError(err)
+	}
+	return usages, nil
+}
+
+func getQuotaUsage(ctx context.Context, sq QuotaClientAPI, region string, demand client.QuotaDemand) ([]client.QuotaUsage, error) {
+	getQuota := func(serviceCode, quotaCode string) (float64, error) {
+		out, err := sq.GetServiceQuota(ctx, &servicequotas.GetServiceQuotaInput{
+			ServiceCode: aws.String(serviceCode),
+			QuotaCode:   aws.String(quotaCode),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get service quota %s: %w", quotaCode, err)
+		}
+		if out.Quota == nil || out.Quota.Value == nil {
+			return 0, ErrNoQuotasReceived
+		}
+		return *out.Quota.Value, nil
+	}
+	increaseURL := func(serviceCode, quotaCode string) string {
+		return fmt.Sprintf("https://%s.console.aws.amazon.com/servicequotas/home/services/%s/quotas/%s", region, serviceCode, quotaCode)
+	}
+
+	var usages []client.QuotaUsage
+	if demand.Cpus > 0 {
+		limit, err := getQuota("fargate", fargateVCPUQuotaCode)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, client.QuotaUsage{
+			Name:        "Fargate On-Demand vCPUs",
+			Region:      region,
+			Requested:   demand.Cpus,
+			Used:        -1,
+			Limit:       limit,
+			IncreaseURL: increaseURL("fargate", fargateVCPUQuotaCode),
+		})
+	}
+	if demand.Gpus > 0 {
+		// The CD can use any of the GPU instance families, so the largest quota applies
+		var limit float64
+		var limitCode = gpuQuotaCodes[0]
+		for _, quotaCode := range gpuQuotaCodes {
+			value, err := getQuota(serviceCode, quotaCode)
+			if err != nil {
+				return nil, err
+			}
+			if value > limit {
+				limit, limitCode = value, quotaCode
+			}
+		}
+		usages = append(usages, client.QuotaUsage{
+			Name:        "EC2 GPU instance vCPUs",
+			Region:      region,
+			Requested:   float64(demand.Gpus * vCPUsPerGPU),
+			Used:        -1,
+			Limit:       limit,
+			IncreaseURL: increaseURL(serviceCode, limitCode),
+		})
+	}
+	if demand.LoadBalancers > 0 {
+		limit, err := getQuota("elasticloadbalancing", albQuotaCode)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, client.QuotaUsage{
+			Name:        "Application Load Balancers",
+			Region:      region,
+			Requested:   float64(demand.LoadBalancers),
+			Used:        -1,
+			Limit:       limit,
+			IncreaseURL: increaseURL("elasticloadbalancing", albQuotaCode),
+		})
+	}
+	return usages, nil
+}
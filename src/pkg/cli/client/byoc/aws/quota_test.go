@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	quotaTypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+	"github.com/aws/smithy-go/ptr"
+)
+
+type mockServiceQuotas struct {
+	QuotaClientAPI
+	values map[string]float64
+}
+
+func (m mockServiceQuotas) GetServiceQuota(ctx context.Context, params *servicequotas.GetServiceQuotaInput, optFns ...func(*servicequotas.Options)) (*servicequotas.GetServiceQuotaOutput, error) {
+	return &servicequotas.GetServiceQuotaOutput{
+		Quota: &quotaTypes.ServiceQuota{Value: ptr.Float64(m.values[*params.QuotaCode])},
+	}, nil
+}
+
+func TestGetQuotaUsage(t *testing.T) {
+	sq := mockServiceQuotas{values: map[string]float64{
+		fargateVCPUQuotaCode: 6,
+		gpuQuotaCodes[0]:     0,
+		gpuQuotaCodes[1]:     8,
+		albQuotaCode:         50,
+	}}
+
+	usages, err := getQuotaUsage(t.Context(), sq, "us-west-2", client.QuotaDemand{Cpus: 8, Gpus: 1, LoadBalancers: 1})
+	if err != nil {
+		t.Fatalf("getQuotaUsage() error = %v", err)
+	}
+	if len(usages) != 3 {
+		t.Fatalf("expected 3 quotas, got %+v", usages)
+	}
+	if fargate := usages[0]; !fargate.Exceeded() || fargate.Limit != 6 || fargate.IncreaseURL != "https://us-west-2.console.aws.amazon.com/servicequotas/home/services/fargate/quotas/L-3032A538" {
+		t.Errorf("unexpected Fargate quota %+v", fargate)
+	}
+	if gpu := usages[1]; gpu.Exceeded() || gpu.Requested != 4 || gpu.Limit != 8 {
+		t.Errorf("unexpected GPU quota %+v", gpu)
+	}
+	if alb := usages[2]; alb.Exceeded() || alb.Used >= 0 {
+		t.Errorf("unexpected ALB quota %+v", alb)
+	}
+
+	usages, err = getQuotaUsage(t.Context(), sq, "us-west-2", client.QuotaDemand{})
+	if err != nil || len(usages) != 0 {
+		t.Errorf("expected no quotas for an empty demand, got %+v, %v", usages, err)
+	}
+}
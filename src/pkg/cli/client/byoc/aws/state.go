@@ -0,0 +1,170 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/clouds/aws"
+	awscodebuild "github.com/DefangLabs/defang/src/pkg/clouds/aws/codebuild"
+	"github.com/DefangLabs/defang/src/pkg/clouds/aws/codebuild/cfn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/ptr"
+)
+
+var _ client.StateStore = (*ByocAws)(nil)
+var _ client.LockStore = (*ByocAws)(nil)
+
+func (b *ByocAws) stateBucket(ctx context.Context) (*s3.Client, string, error) {
+	if b.bucketName() == "" {
+		if err := b.driver.FillOutputs(ctx); err != nil {
+			var cfnErr *cfn.ErrStackNotFoundException
+			if errors.As(err, &cfnErr) {
+				return nil, "", fmt.Errorf("%w: %w", client.ErrNotExist, AnnotateAwsError(err))
+			}
+			return nil, "", AnnotateAwsError(err)
+		}
+	}
+	cfg, err := b.driver.LoadConfig(ctx)
+	if err != nil {
+		return nil, "", AnnotateAwsError(err)
+	}
+	return s3.NewFromConfig(cfg), b.bucketName(), nil
+}
+
+// GetStateObject implements client.StateStore.
+func (b *ByocAws) GetStateObject(ctx context.Context, key string) ([]byte, error) {
+	s3Client, bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+	})
+	if err != nil {
+		var nsk *aws.ErrNoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, fmt.Errorf("%q: %w", key, client.ErrNotExist)
+		}
+		return nil, AnnotateAwsError(err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// PutStateObject implements client.StateStore.
+func (b *ByocAws) PutStateObject(ctx context.Context, key string, data []byte) error {
+	s3Client, bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	return AnnotateAwsError(err)
+}
+
+func isS3PreconditionFailed(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && (ae.ErrorCode() == "PreconditionFailed" || ae.ErrorCode() == "ConditionalRequestConflict")
+}
+
+// GetLockObject implements client.LockStore.
+func (b *ByocAws) GetLockObject(ctx context.Context, key string) ([]byte, string, error) {
+	s3Client, bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+	})
+	if err != nil {
+		var nsk *aws.ErrNoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, "", client.ErrNotExist
+		}
+		return nil, "", AnnotateAwsError(err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	var etag string
+	if out.ETag != nil {
+		etag = *out.ETag
+	}
+	return data, etag, nil
+}
+
+// PutLockObject implements client.LockStore, using S3 conditional writes.
+func (b *ByocAws) PutLockObject(ctx context.Context, key string, data []byte, version string) (string, error) {
+	s3Client, bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return "", err
+	}
+	input := &s3.PutObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	}
+	if version == "" {
+		input.IfNoneMatch = ptr.String("*")
+	} else {
+		input.IfMatch = &version
+	}
+	out, err := s3Client.PutObject(ctx, input)
+	if err != nil {
+		if isS3PreconditionFailed(err) {
+			return "", client.ErrPreconditionFailed
+		}
+		return "", AnnotateAwsError(err)
+	}
+	if out.ETag == nil {
+		return "", errors.New("missing ETag in PutObject response")
+	}
+	return *out.ETag, nil
+}
+
+// DeleteLockObject implements client.LockStore.
+func (b *ByocAws) DeleteLockObject(ctx context.Context, key string, version string) error {
+	s3Client, bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return err
+	}
+	input := &s3.DeleteObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+	}
+	if version != "" {
+		input.IfMatch = &version
+	}
+	if _, err := s3Client.DeleteObject(ctx, input); err != nil {
+		if isS3PreconditionFailed(err) {
+			return client.ErrPreconditionFailed
+		}
+		return AnnotateAwsError(err)
+	}
+	return nil
+}
+
+// IsCdTaskDone implements client.LockStore.
+func (b *ByocAws) IsCdTaskDone(ctx context.Context, cdID string) (bool, error) {
+	cfg, err := b.driver.LoadConfig(ctx)
+	if err != nil {
+		return false, AnnotateAwsError(err)
+	}
+	done, err := awscodebuild.GetBuildStatus(ctx, cfg, awscodebuild.BuildID(&cdID))
+	if done {
+		return true, nil // succeeded or failed
+	}
+	return false, AnnotateAwsError(err)
+}
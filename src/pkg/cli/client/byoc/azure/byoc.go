@@ -64,7 +64,7 @@ func NewByocProvider(ctx context.Context, tenantLabel types.TenantLabel, stack s
 		job:    &aca.Job{},
 	}
 	b.ByocBaseClient = byoc.NewByocBaseClient(tenantLabel, b, stack)
-	b.driver.TokenStore = &tokenstore.LocalDirTokenStore{Dir: filepath.Join(client.StateDir, "providers", "azure")}
+	b.driver.TokenStore = tokenstore.New("defang-azure", filepath.Join(client.StateDir, "providers", "azure"))
 	return b
 }
 
@@ -736,6 +736,31 @@ func (b *ByocAzure) ListConfig(ctx context.Context, req *defangv1.ListConfigsReq
 	return &defangv1.Secrets{Names: names}, nil
 }
 
+// GetConfigVersions implements client.ConfigVersioner, using the time each
+// Key Vault secret was last updated.
+func (b *ByocAzure) GetConfigVersions(ctx context.Context, req *defangv1.ListConfigsRequest) (map[string]string, error) {
+	found, err := b.findForConfig(ctx, req.Project)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil // nothing configured yet
+	}
+	entries, err := b.kv.ListSecrets(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(entries))
+	for _, e := range entries {
+		name := e.Name
+		if e.OriginalKey != "" {
+			name = e.OriginalKey
+		}
+		versions[name] = e.Updated.UTC().Format(time.RFC3339Nano)
+	}
+	return versions, nil
+}
+
 // PrepareDomainDelegation implements client.Provider. It creates a public
 // Azure DNS zone for the delegate domain and returns the zone's authoritative
 // name servers so Fabric can point NS records at it, mirroring the GCP
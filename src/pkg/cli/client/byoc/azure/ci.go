@@ -0,0 +1,207 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	cloudazure "github.com/DefangLabs/defang/src/pkg/clouds/azure"
+)
+
+// Built-in Azure role IDs granted to the CI identity
+const (
+	ciContributorRoleID                = "b24988ac-6180-42a0-ab88-20f7382dd24c" // nolint:gosec
+	ciKeyVaultSecretsOfficerRoleID     = "b86a8fe4-44ce-4948-aee5-eccb2c155cd7" // nolint:gosec
+	ciReaderRoleID                     = "acdd72a7-3385-48ef-bd42-f606fba81ae7" // nolint:gosec
+	ciStorageBlobDataContributorRoleID = "ba92f5b4-2d11-453d-a403-e96b0029c9fe" // nolint:gosec
+)
+
+const (
+	ciFederatedCredentialName = "github"
+	ciFederationAudience      = "api://AzureADTokenExchange"
+)
+
+type ciRoleAssignment struct {
+	scope  string
+	roleID string
+	role   string // for display
+}
+
+func (b *ByocAzure) ciIdentityName() string {
+	return "defang-ci-" + b.PulumiStack
+}
+
+// ciRoleAssignments are the roles needed to deploy this stack: the CD runs
+// with its own identity, so the CI identity only needs to start it, access
+// the CD storage, and read the config of the stack's projects. The Reader
+// role on the subscription lets the CLI find resources and verify that the
+// role assignments it would otherwise make already exist.
+func (b *ByocAzure) ciRoleAssignments(ctx context.Context, ic cloudazure.IdentityClientAPI) ([]ciRoleAssignment, error) {
+	subscriptionScope := "/subscriptions/" + b.driver.SubscriptionID
+	cdScope := subscriptionScope + "/resourceGroups/" + b.driver.ResourceGroupName()
+	assignments := []ciRoleAssignment{
+		{subscriptionScope, ciReaderRoleID, "Reader"},
+		{cdScope, ciContributorRoleID, "Contributor"},
+		{cdScope, ciStorageBlobDataContributorRoleID, "Storage Blob Data Contributor"},
+	}
+
+	resourceGroups, err := ic.ListResourceGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(resourceGroups)
+	prefix, suffix := strings.ToLower(b.Prefix+"-"), strings.ToLower("-"+b.PulumiStack)
+	for _, rg := range resourceGroups {
+		lower := strings.ToLower(rg)
+		if !strings.HasPrefix(lower, prefix) || !strings.HasSuffix(lower, suffix) {
+			continue
+		}
+		scope := subscriptionScope + "/resourceGroups/" + rg
+		assignments = append(assignments,
+			ciRoleAssignment{scope, ciContributorRoleID, "Contributor"},
+			ciRoleAssignment{scope, ciKeyVaultSecretsOfficerRoleID, "Key Vault Secrets Officer"},
+		)
+	}
+	return assignments, nil
+}
+
+func (b *ByocAzure) ciPrepare(ctx context.Context, req client.CIRequest) (cloudazure.IdentityClientAPI, cloudazure.Location, error) {
+	if err := req.Validate(); err != nil {
+		return nil, "", err
+	}
+	if err := b.setUpLocation(); err != nil {
+		return nil, "", err
+	}
+	ic := cloudazure.NewIdentityClient(b.driver.Azure)
+	location, err := ic.GetResourceGroupLocation(ctx, b.driver.ResourceGroupName())
+	if err != nil {
+		if cloudazure.IsNotFound(err) {
+			return nil, "", fmt.Errorf("the CD must be installed first, with \"defang cd install\": %w", err)
+		}
+		return nil, "", err
+	}
+	return ic, location, nil
+}
+
+// SetUpCI creates or verifies a user-assigned managed identity with a
+// federated credential for the given GitHub Actions workflow, and grants it
+// the roles to deploy this stack.
+func (b *ByocAzure) SetUpCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	ic, location, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &client.CIResponse{}
+	rg := b.driver.ResourceGroupName()
+	name := b.ciIdentityName()
+
+	// 1. The managed identity
+	identity, err := ic.GetIdentity(ctx, rg, name)
+	switch {
+	case cloudazure.IsNotFound(err):
+		resp.Addf("create managed identity %s in resource group %s", name, rg)
+		if !req.DryRun {
+			if identity, err = ic.CreateIdentity(ctx, rg, name, location); err != nil {
+				return nil, fmt.Errorf("failed to create managed identity: %w", err)
+			}
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get managed identity: %w", err)
+	default:
+		resp.Addf("verified managed identity %s", name)
+	}
+
+	// 2. The federated credential, trusting only the given branch or environment
+	want := cloudazure.FederatedCredential{
+		Issuer:    "https://" + client.GitHubOIDCIssuer,
+		Subject:   req.Subject(),
+		Audiences: []string{ciFederationAudience},
+	}
+	var existing *cloudazure.FederatedCredential
+	if identity != nil {
+		if existing, err = ic.GetFederatedCredential(ctx, rg, name, ciFederatedCredentialName); err != nil && !cloudazure.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get federated credential: %w", err)
+		}
+	}
+	switch {
+	case existing == nil:
+		resp.Addf("create federated credential %s for %s", ciFederatedCredentialName, want.Subject)
+	case existing.Issuer != want.Issuer || existing.Subject != want.Subject || !slices.Equal(existing.Audiences, want.Audiences):
+		resp.Addf("update federated credential %s to %s", ciFederatedCredentialName, want.Subject)
+	default:
+		resp.Addf("verified federated credential %s", ciFederatedCredentialName)
+		want.Subject = "" // nothing to do
+	}
+	if want.Subject != "" && !req.DryRun {
+		if err := ic.PutFederatedCredential(ctx, rg, name, ciFederatedCredentialName, want); err != nil {
+			return nil, fmt.Errorf("failed to put federated credential: %w", err)
+		}
+	}
+
+	// 3. The role assignments
+	assignments, err := b.ciRoleAssignments(ctx, ic)
+	if err != nil {
+		return nil, err
+	}
+	for _, ra := range assignments {
+		if identity != nil {
+			ok, err := ic.HasRoleAssignment(ctx, ra.scope, ra.roleID, identity.PrincipalID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check role assignments: %w", err)
+			}
+			if ok {
+				resp.Addf("verified role %s on %s", ra.role, ra.scope)
+				continue
+			}
+		}
+		resp.Addf("assign role %s on %s", ra.role, ra.scope)
+		if !req.DryRun {
+			if err := ic.AssignRole(ctx, ra.scope, ra.roleID, identity.PrincipalID); err != nil {
+				return nil, fmt.Errorf("failed to assign role %s: %w", ra.role, err)
+			}
+		}
+	}
+
+	resp.Env = map[string]string{
+		"AZURE_LOCATION":        b.driver.Location.String(),
+		"AZURE_SUBSCRIPTION_ID": b.driver.SubscriptionID,
+	}
+	if identity != nil {
+		resp.Env["AZURE_CLIENT_ID"] = identity.ClientID
+		resp.Env["AZURE_TENANT_ID"] = identity.TenantID
+	}
+	return resp, nil
+}
+
+// TearDownCI deletes the role assignments and the managed identity of this stack.
+func (b *ByocAzure) TearDownCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	ic, _, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &client.CIResponse{}
+	rg := b.driver.ResourceGroupName()
+	name := b.ciIdentityName()
+	identity, err := ic.GetIdentity(ctx, rg, name)
+	if err != nil {
+		if cloudazure.IsNotFound(err) {
+			return resp, nil
+		}
+		return nil, fmt.Errorf("failed to get managed identity: %w", err)
+	}
+	resp.Addf("delete role assignments of managed identity %s", name)
+	resp.Addf("delete managed identity %s", name)
+	if req.DryRun {
+		return resp, nil
+	}
+	// Role assignments outlive their principal, so delete them first
+	if err := ic.DeleteRoleAssignments(ctx, "/subscriptions/"+b.driver.SubscriptionID, identity.PrincipalID); err != nil {
+		return nil, fmt.Errorf("failed to delete role assignments: %w", err)
+	}
+	if err := ic.DeleteIdentity(ctx, rg, name); err != nil && !cloudazure.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete managed identity: %w", err)
+	}
+	return resp, nil
+}
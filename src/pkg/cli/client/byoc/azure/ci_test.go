@@ -0,0 +1,183 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	cloudazure "github.com/DefangLabs/defang/src/pkg/clouds/azure"
+)
+
+type fakeIdentityClient struct {
+	identity    *cloudazure.ManagedIdentity
+	credential  *cloudazure.FederatedCredential
+	assignments map[string]bool // scope|roleID
+	calls       []string
+}
+
+var errNotFound = &azcore.ResponseError{StatusCode: http.StatusNotFound}
+
+func (f *fakeIdentityClient) GetResourceGroupLocation(ctx context.Context, resourceGroup string) (cloudazure.Location, error) {
+	return cloudazure.LocationWestUS2, nil
+}
+
+func (f *fakeIdentityClient) ListResourceGroups(ctx context.Context) ([]string, error) {
+	return []string{"defang-cd", "Defang-app-test-stack", "Defang-app-other-stack", "unrelated"}, nil
+}
+
+func (f *fakeIdentityClient) GetIdentity(ctx context.Context, resourceGroup, name string) (*cloudazure.ManagedIdentity, error) {
+	if f.identity == nil {
+		return nil, errNotFound
+	}
+	return f.identity, nil
+}
+
+func (f *fakeIdentityClient) CreateIdentity(ctx context.Context, resourceGroup, name string, location cloudazure.Location) (*cloudazure.ManagedIdentity, error) {
+	f.calls = append(f.calls, "CreateIdentity "+resourceGroup+"/"+name)
+	f.identity = &cloudazure.ManagedIdentity{ClientID: "client-id", PrincipalID: "principal-id", TenantID: "tenant-id"}
+	return f.identity, nil
+}
+
+func (f *fakeIdentityClient) DeleteIdentity(ctx context.Context, resourceGroup, name string) error {
+	f.calls = append(f.calls, "DeleteIdentity "+resourceGroup+"/"+name)
+	f.identity = nil
+	return nil
+}
+
+func (f *fakeIdentityClient) GetFederatedCredential(ctx context.Context, resourceGroup, identity, name string) (*cloudazure.FederatedCredential, error) {
+	if f.credential == nil {
+		return nil, errNotFound
+	}
+	return f.credential, nil
+}
+
+func (f *fakeIdentityClient) PutFederatedCredential(ctx context.Context, resourceGroup, identity, name string, cred cloudazure.FederatedCredential) error {
+	f.calls = append(f.calls, "PutFederatedCredential "+cred.Subject)
+	f.credential = &cred
+	return nil
+}
+
+func (f *fakeIdentityClient) HasRoleAssignment(ctx context.Context, scope, roleID, principalID string) (bool, error) {
+	return f.assignments[scope+"|"+roleID], nil
+}
+
+func (f *fakeIdentityClient) AssignRole(ctx context.Context, scope, roleID, principalID string) error {
+	f.calls = append(f.calls, "AssignRole "+scope+" "+roleID)
+	f.assignments[scope+"|"+roleID] = true
+	return nil
+}
+
+func (f *fakeIdentityClient) DeleteRoleAssignments(ctx context.Context, scope, principalID string) error {
+	f.calls = append(f.calls, "DeleteRoleAssignments "+scope+" "+principalID)
+	clear(f.assignments)
+	return nil
+}
+
+func useFakeIdentityClient(t *testing.T) *fakeIdentityClient {
+	t.Helper()
+	fake := &fakeIdentityClient{assignments: map[string]bool{}}
+	orig := cloudazure.NewIdentityClient
+	cloudazure.NewIdentityClient = func(cloudazure.Azure) cloudazure.IdentityClientAPI { return fake }
+	t.Cleanup(func() { cloudazure.NewIdentityClient = orig })
+	return fake
+}
+
+func TestSetUpCI(t *testing.T) {
+	ctx := t.Context()
+	fake := useFakeIdentityClient(t)
+	b := newTestProvider(t, cloudazure.LocationWestUS2, "sub-id")
+	req := client.CIRequest{Project: "app", Repo: "acme/app", Branch: "main"}
+
+	// Dry run makes no changes
+	resp, err := b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Branch: req.Branch, DryRun: true})
+	if err != nil {
+		t.Fatalf("SetUpCI dry run: %v", err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("dry run made calls: %v", fake.calls)
+	}
+	if resp.Actions[0] != "create managed identity defang-ci-test-stack in resource group defang-cd" {
+		t.Errorf("Actions[0] = %q", resp.Actions[0])
+	}
+	if _, ok := resp.Env["AZURE_CLIENT_ID"]; ok {
+		t.Error("dry run should not know the client ID of a new identity")
+	}
+
+	// Create
+	resp, err = b.SetUpCI(ctx, req)
+	if err != nil {
+		t.Fatalf("SetUpCI: %v", err)
+	}
+	want := []string{
+		"CreateIdentity defang-cd/defang-ci-test-stack",
+		"PutFederatedCredential repo:acme/app:ref:refs/heads/main",
+		"AssignRole /subscriptions/sub-id " + ciReaderRoleID,
+		"AssignRole /subscriptions/sub-id/resourceGroups/defang-cd " + ciContributorRoleID,
+		"AssignRole /subscriptions/sub-id/resourceGroups/defang-cd " + ciStorageBlobDataContributorRoleID,
+		"AssignRole /subscriptions/sub-id/resourceGroups/Defang-app-test-stack " + ciContributorRoleID,
+		"AssignRole /subscriptions/sub-id/resourceGroups/Defang-app-test-stack " + ciKeyVaultSecretsOfficerRoleID,
+	}
+	if !slices.Equal(fake.calls, want) {
+		t.Errorf("calls = %v\nwant %v", fake.calls, want)
+	}
+	if fake.credential.Audiences[0] != "api://AzureADTokenExchange" || fake.credential.Issuer != "https://token.actions.githubusercontent.com" {
+		t.Errorf("credential = %+v", fake.credential)
+	}
+	for k, v := range map[string]string{
+		"AZURE_CLIENT_ID":       "client-id",
+		"AZURE_TENANT_ID":       "tenant-id",
+		"AZURE_SUBSCRIPTION_ID": "sub-id",
+		"AZURE_LOCATION":        "westus2",
+	} {
+		if resp.Env[k] != v {
+			t.Errorf("Env[%s] = %q, want %q", k, resp.Env[k], v)
+		}
+	}
+
+	// Idempotent
+	fake.calls = nil
+	resp, err = b.SetUpCI(ctx, req)
+	if err != nil {
+		t.Fatalf("SetUpCI again: %v", err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("second run made calls: %v", fake.calls)
+	}
+	for _, action := range resp.Actions {
+		if !strings.HasPrefix(action, "verified ") {
+			t.Errorf("unexpected action %q", action)
+		}
+	}
+
+	// Changing the subject updates the credential
+	fake.calls = nil
+	if _, err := b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: "acme/app", Environment: "prod"}); err != nil {
+		t.Fatalf("SetUpCI environment: %v", err)
+	}
+	if !slices.Equal(fake.calls, []string{"PutFederatedCredential repo:acme/app:environment:prod"}) {
+		t.Errorf("calls = %v", fake.calls)
+	}
+
+	// Teardown
+	fake.calls = nil
+	if _, err := b.TearDownCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Branch: req.Branch, DryRun: true}); err != nil {
+		t.Fatalf("TearDownCI dry run: %v", err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("dry run made calls: %v", fake.calls)
+	}
+	if _, err := b.TearDownCI(ctx, req); err != nil {
+		t.Fatalf("TearDownCI: %v", err)
+	}
+	want = []string{
+		"DeleteRoleAssignments /subscriptions/sub-id principal-id",
+		"DeleteIdentity defang-cd/defang-ci-test-stack",
+	}
+	if !slices.Equal(fake.calls, want) {
+		t.Errorf("calls = %v\nwant %v", fake.calls, want)
+	}
+}
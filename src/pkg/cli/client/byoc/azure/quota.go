@@ -0,0 +1,76 @@
+package azure
+
+import (
+	"context"
+	"strings"
+
+	armappcontainersv3 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/appcontainers/armappcontainers/v3"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/clouds/azure/aca"
+)
+
+var _ client.QuotaChecker = (*ByocAzure)(nil)
+
+const (
+	consumptionCoresUsage = "ManagedEnvironmentConsumptionCores"
+	quotaIncreaseURL      = "https://portal.azure.com/#view/Microsoft_Azure_Capacity/QuotaMenuBlade/~/myQuotas"
+)
+
+// GetQuotaUsage implements client.QuotaChecker, using the Container Apps usages
+// of the location.
+func (b *ByocAzure) GetQuotaUsage(ctx context.Context, demand client.QuotaDemand) ([]client.QuotaUsage, error) {
+	if err := b.setUpLocation(); err != nil {
+		return nil, err
+	}
+	usages, err := aca.ListUsages(ctx, b.driver.Azure)
+	if err != nil {
+		return nil, err
+	}
+	return containerAppsQuotaUsage(usages, b.driver.Location.String(), demand), nil
+}
+
+func containerAppsQuotaUsage(usages []*armappcontainersv3.Usage, location string, demand client.QuotaDemand) []client.QuotaUsage {
+	var cores, gpus *armappcontainersv3.Usage
+	for _, u := range usages {
+		if u == nil || u.Name == nil || u.Name.Value == nil || u.Limit == nil {
+			continue
+		}
+		name := *u.Name.Value
+		switch {
+		case name == consumptionCoresUsage:
+			cores = u
+		case strings.Contains(strings.ToLower(name), "gpu"):
+			// There is a quota per GPU type; the largest one applies
+			if gpus == nil || *u.Limit > *gpus.Limit {
+				gpus = u
+			}
+		}
+	}
+
+	var quotas []client.QuotaUsage
+	add := func(u *armappcontainersv3.Usage, name string, requested float64) {
+		if requested <= 0 {
+			return
+		}
+		q := client.QuotaUsage{
+			Name:        name,
+			Region:      location,
+			Requested:   requested,
+			Used:        -1,
+			IncreaseURL: quotaIncreaseURL,
+		}
+		if u != nil { // no quota means a limit of 0
+			q.Limit = float64(*u.Limit)
+			if u.CurrentValue != nil {
+				q.Used = float64(*u.CurrentValue)
+			}
+			if u.Name.LocalizedValue != nil {
+				q.Name = *u.Name.LocalizedValue
+			}
+		}
+		quotas = append(quotas, q)
+	}
+	add(cores, "Container Apps consumption cores", demand.Cpus)
+	add(gpus, "Container Apps GPUs", float64(demand.Gpus))
+	return quotas
+}
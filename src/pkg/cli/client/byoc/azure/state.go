@@ -0,0 +1,111 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+)
+
+var _ client.StateStore = (*ByocAzure)(nil)
+var _ client.LockStore = (*ByocAzure)(nil)
+
+func (b *ByocAzure) setUpStateStorage(ctx context.Context) error {
+	if err := b.setUpLocation(); err != nil {
+		return err
+	}
+	storageAccount, err := b.driver.FindStorageAccount(ctx)
+	if err != nil {
+		return err
+	}
+	if storageAccount == "" {
+		return fmt.Errorf("no defang cd storage account found: %w", client.ErrNotExist)
+	}
+	return nil
+}
+
+// GetStateObject implements client.StateStore.
+func (b *ByocAzure) GetStateObject(ctx context.Context, key string) ([]byte, error) {
+	if err := b.setUpStateStorage(ctx); err != nil {
+		return nil, err
+	}
+	data, err := b.driver.DownloadBlob(ctx, key)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%q: %w", key, client.ErrNotExist)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// PutStateObject implements client.StateStore.
+func (b *ByocAzure) PutStateObject(ctx context.Context, key string, data []byte) error {
+	if err := b.setUpStateStorage(ctx); err != nil {
+		return err
+	}
+	return b.driver.UploadBlob(ctx, key, data)
+}
+
+func lockStoreError(err error) error {
+	switch {
+	case bloberror.HasCode(err, bloberror.BlobNotFound):
+		return client.ErrNotExist
+	case bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists):
+		return client.ErrPreconditionFailed
+	default:
+		return err
+	}
+}
+
+// GetLockObject implements client.LockStore.
+func (b *ByocAzure) GetLockObject(ctx context.Context, key string) ([]byte, string, error) {
+	if err := b.setUpStateStorage(ctx); err != nil {
+		return nil, "", err
+	}
+	data, etag, err := b.driver.DownloadBlobWithETag(ctx, key)
+	if err != nil {
+		return nil, "", lockStoreError(err)
+	}
+	return data, string(etag), nil
+}
+
+// PutLockObject implements client.LockStore, using blob ETag conditions like
+// the S3 and GCS stores. Blob leases don't fit: a lease is either infinite or
+// at most 60 seconds, while the deploy lock must outlive the CLI for as long as
+// the CD task runs, and still expire if nobody releases it.
+func (b *ByocAzure) PutLockObject(ctx context.Context, key string, data []byte, version string) (string, error) {
+	if err := b.setUpStateStorage(ctx); err != nil {
+		return "", err
+	}
+	etag, err := b.driver.UploadBlobIfMatch(ctx, key, data, azcore.ETag(version))
+	if err != nil {
+		return "", lockStoreError(err)
+	}
+	return string(etag), nil
+}
+
+// DeleteLockObject implements client.LockStore.
+func (b *ByocAzure) DeleteLockObject(ctx context.Context, key string, version string) error {
+	if err := b.setUpStateStorage(ctx); err != nil {
+		return err
+	}
+	if err := b.driver.DeleteBlobIfMatch(ctx, key, azcore.ETag(version)); err != nil {
+		return lockStoreError(err)
+	}
+	return nil
+}
+
+// IsCdTaskDone implements client.LockStore.
+func (b *ByocAzure) IsCdTaskDone(ctx context.Context, cdID string) (bool, error) {
+	if err := b.setUpLocation(); err != nil {
+		return false, err
+	}
+	status, err := b.job.GetJobExecutionStatus(ctx, cdID)
+	if err != nil {
+		return false, err
+	}
+	return status.IsTerminal(), nil
+}
@@ -35,6 +35,7 @@ import (
 	gcpdns "google.golang.org/api/dns/v1"
 	"google.golang.org/api/googleapi"
 	auditpb "google.golang.org/genproto/googleapis/cloud/audit"
+	"google.golang.org/genproto/googleapis/type/expr"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
@@ -93,24 +94,38 @@ type gcpDriver interface {
 	CreateSecret(ctx context.Context, secretID string) (string, error)
 	CreateUploadURL(ctx context.Context, bucketName, objectName, serviceAccount string) (string, error)
 	DeleteSecret(ctx context.Context, secretName string) error
+	DeleteBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string, generation int64) error
+	DeleteWorkloadIdentityPool(ctx context.Context, poolId string) error
 	EnsureAPIsEnabled(ctx context.Context, apis ...string) error
 	EnsureBucketExists(ctx context.Context, prefix string, versioning bool) (string, error)
 	EnsureDNSZoneExists(ctx context.Context, name, domain, description string) (*gcpdns.ManagedZone, error)
 	EnsurePrincipalHasBucketRoles(ctx context.Context, bucketName, principal string, roles []string) error
+	EnsurePrincipalHasConditionalRole(ctx context.Context, principal, role string, condition *expr.Expr) error
 	EnsurePrincipalHasRoles(ctx context.Context, serviceAccount string, roles []string) error
 	EnsurePrincipalHasServiceAccountRoles(ctx context.Context, principal, serviceAccount string, roles []string) error
 	EnsureRoleExists(ctx context.Context, roleId, title, description string, permissions []string) (string, error)
 	EnsureServiceAccountExists(ctx context.Context, serviceAccountId, displayName, description string) (string, error)
+	EnsureWorkloadIdentityProviderExists(ctx context.Context, poolId, providerId, description string, provider gcp.WorkloadIdentityProvider) (string, error)
+	GetBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string) ([]byte, int64, error)
 	GetBucketObjectWithServiceAccount(ctx context.Context, bucketName, objectName, serviceAccount string) ([]byte, error)
 	GetBucketWithPrefix(ctx context.Context, prefix string) (string, error)
 	GetBuildStatus(ctx context.Context, startBuildOpName string) (bool, error)
 	GetCurrentPrincipal(ctx context.Context) (string, error)
 	GetDNSZone(ctx context.Context, name string) (*gcpdns.ManagedZone, error)
+	GetLatestSecretVersion(ctx context.Context, secretName string) (string, error)
+	GetProjectNumber(ctx context.Context) (string, error)
 	GetRegion() string
 	GetServiceAccountEmail(name string) string
+	GetServiceQuotaLimits(ctx context.Context, service string) (map[string]int64, error)
+	GetWorkloadIdentityProvider(ctx context.Context, poolId, providerId string) (*gcp.WorkloadIdentityProvider, error)
 	IterateBucketObjects(ctx context.Context, bucketName, prefix string) (iter.Seq2[*storage.ObjectAttrs, error], error)
 	Authenticate(ctx context.Context, interactive bool) error
 	ListSecrets(ctx context.Context, prefix string) ([]string, error)
+	PutBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string, data []byte, generation int64) (int64, error)
+	PutBucketObjectWithServiceAccount(ctx context.Context, bucketName, objectName, serviceAccount string, data []byte) error
+	RemovePrincipalBucketRoles(ctx context.Context, bucketName, principal string, roles []string) error
+	RemovePrincipalRoles(ctx context.Context, principal string, roles []string) error
+	RemovePrincipalServiceAccountRoles(ctx context.Context, principal, serviceAccount string, roles []string) error
 	RunCloudBuild(ctx context.Context, args gcp.CloudBuildArgs) (string, error)
 	SignBytes(ctx context.Context, b []byte, name string) ([]byte, error)
 	GcpLogsClient
@@ -137,7 +152,7 @@ func NewByocProvider(ctx context.Context, tenantName types.TenantLabel, stack st
 	b := &ByocGcp{driver: &gcp.Gcp{
 		Region:     region,
 		ProjectId:  projectId,
-		TokenStore: &tokenstore.LocalDirTokenStore{Dir: filepath.Join(client.StateDir, "providers", "gcp")},
+		TokenStore: tokenstore.New("defang-gcp", filepath.Join(client.StateDir, "providers", "gcp")),
 	}}
 	b.ByocBaseClient = byoc.NewByocBaseClient(tenantName, b, stack)
 	b.existingBucket = os.Getenv("DEFANG_CD_BUCKET") // adopt an existing CD bucket; `cd install --bucket` overrides
@@ -767,6 +782,24 @@ func (b *ByocGcp) ListConfig(ctx context.Context, req *defangv1.ListConfigsReque
 	return &defangv1.Secrets{Names: secrets}, nil
 }
 
+// GetConfigVersions implements client.ConfigVersioner, using the latest
+// versions of the secrets.
+func (b *ByocGcp) GetConfigVersions(ctx context.Context, req *defangv1.ListConfigsRequest) (map[string]string, error) {
+	configs, err := b.ListConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(configs.Names))
+	for _, name := range configs.Names {
+		version, err := b.driver.GetLatestSecretVersion(ctx, b.resourceName(req.Project, name))
+		if err != nil {
+			return nil, annotateGcpError(err)
+		}
+		versions[name] = path.Base(version) // projects/…/secrets/…/versions/3
+	}
+	return versions, nil
+}
+
 func (b *ByocGcp) PutConfig(ctx context.Context, req *defangv1.PutConfigRequest) error {
 	secretId := b.resourceName(req.Project, req.Name)
 	term.Debugf("Creating secret %q", secretId)
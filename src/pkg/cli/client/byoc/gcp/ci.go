@@ -0,0 +1,245 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/clouds/gcp"
+	"google.golang.org/genproto/googleapis/type/expr"
+)
+
+const ciProviderId = "github"
+
+// ciPermissions are what the CLI needs to deploy a stack from CI once the CD
+// is installed: the Ensure* calls in SetUpCD only read, the deployment itself
+// runs in Cloud Build as the CD service account. Secret Manager checks
+// secrets.create and secrets.list on the project, before the secret exists, so
+// these cannot be limited to the secrets of the stack; a secret created
+// elsewhere stays empty, since adding versions needs ciConfigPermissions.
+var ciPermissions = []string{
+	"cloudbuild.builds.create",
+	"cloudbuild.builds.get",
+	"cloudbuild.builds.list",
+	"compute.instanceGroupManagers.get",
+	"dns.managedZones.get",
+	"dns.managedZones.list",
+	"iam.serviceAccounts.get",
+	"iam.serviceAccounts.getIamPolicy",
+	"logging.logEntries.list",
+	"resourcemanager.projects.get",
+	"resourcemanager.projects.getIamPolicy",
+	"run.executions.get",
+	"run.executions.list",
+	"run.jobs.get",
+	"secretmanager.secrets.create",
+	"secretmanager.secrets.list",
+	"serviceusage.services.get", // SetUpCD only enables the APIs that are disabled
+	"serviceusage.services.list",
+	"storage.buckets.get",
+	"storage.buckets.getIamPolicy",
+	"storage.buckets.list",
+}
+
+// ciConfigPermissions are bound with a condition on the name of the secrets,
+// so that CI can only change the config of the stack it deploys.
+var ciConfigPermissions = []string{
+	"secretmanager.secrets.delete",
+	"secretmanager.secrets.get",
+	"secretmanager.versions.add",
+	"secretmanager.versions.destroy",
+	"secretmanager.versions.get", // plans compare the latest versions of the config
+	"secretmanager.versions.list",
+}
+
+var invalidCIIdChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ciPoolId is the ID of the workload identity pool of this stack; 4-32 chars.
+func (b *ByocGcp) ciPoolId() string {
+	id := "defang-ci-" + invalidCIIdChars.ReplaceAllString(strings.ToLower(b.PulumiStack), "-")
+	if len(id) > 32 {
+		id = id[:32]
+	}
+	return strings.TrimRight(id, "-")
+}
+
+func (b *ByocGcp) ciRoleId() string {
+	return strings.ReplaceAll(b.ciPoolId(), "-", "_")
+}
+
+func (b *ByocGcp) ciConfigRoleId() string {
+	return b.ciRoleId() + "_config"
+}
+
+// ciConfigCondition limits the config role to the secrets of the stack of the
+// given project, which are named by resourceName.
+func (b *ByocGcp) ciConfigCondition(projectNumber, projectName string) *expr.Expr {
+	return &expr.Expr{
+		Title:      "Defang config of " + projectName + "/" + b.PulumiStack,
+		Expression: fmt.Sprintf("resource.name.startsWith('projects/%s/secrets/%s')", projectNumber, b.resourceName(projectName, "")),
+	}
+}
+
+func ciAttributeCondition(req client.CIRequest) string {
+	return fmt.Sprintf("assertion.sub == '%s'", req.Subject())
+}
+
+func ciPrincipalSet(projectNumber, poolId string) string {
+	return fmt.Sprintf("principalSet://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/*", projectNumber, poolId)
+}
+
+type ciBindings struct {
+	role           string // custom role, bound on the project
+	configRole     string // custom role, bound on the project for the secrets of the stack
+	bucket         string
+	cdSA, uploadSA string
+}
+
+func (b *ByocGcp) ciPrepare(ctx context.Context, req client.CIRequest) (string, *ciBindings, error) {
+	if err := req.Validate(); err != nil {
+		return "", nil, err
+	}
+	bucket, err := b.driver.GetBucketWithPrefix(ctx, DefangCDProjectName)
+	if err != nil {
+		return "", nil, annotateGcpError(err)
+	}
+	if bucket == "" {
+		return "", nil, errors.New("the CD must be installed first, with \"defang cd install\"")
+	}
+	projectNumber, err := b.driver.GetProjectNumber(ctx)
+	if err != nil {
+		return "", nil, annotateGcpError(err)
+	}
+	return projectNumber, &ciBindings{
+		role:       fmt.Sprintf("projects/%s/roles/%s", b.driver.GetProjectID(), b.ciRoleId()),
+		configRole: fmt.Sprintf("projects/%s/roles/%s", b.driver.GetProjectID(), b.ciConfigRoleId()),
+		bucket:     bucket,
+		cdSA:       b.driver.GetServiceAccountEmail("defang-cd"),
+		uploadSA:   b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName),
+	}, nil
+}
+
+// SetUpCI creates or verifies a workload identity pool that trusts the given
+// GitHub Actions workflow and grants it the permissions to deploy this stack.
+func (b *ByocGcp) SetUpCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	projectNumber, bindings, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &client.CIResponse{}
+	poolId := b.ciPoolId()
+	principal := ciPrincipalSet(projectNumber, poolId)
+	provider := gcp.WorkloadIdentityProvider{
+		IssuerUri:          "https://" + client.GitHubOIDCIssuer,
+		AttributeCondition: ciAttributeCondition(req),
+		AttributeMapping: map[string]string{
+			"google.subject":       "assertion.sub",
+			"attribute.repository": "assertion.repository",
+		},
+	}
+
+	// 1. The pool and provider, trusting only the given branch or environment
+	existing, err := b.driver.GetWorkloadIdentityProvider(ctx, poolId, ciProviderId)
+	switch {
+	case gcp.IsNotFound(err):
+		resp.Addf("create workload identity pool %s for %s", poolId, req.Subject())
+	case err != nil:
+		return nil, annotateGcpError(err)
+	case existing.State == "DELETED":
+		resp.Addf("undelete workload identity pool %s for %s", poolId, req.Subject())
+	case existing.AttributeCondition != provider.AttributeCondition:
+		resp.Addf("update workload identity provider %s/%s to %s", poolId, ciProviderId, req.Subject())
+	default:
+		resp.Addf("verified workload identity pool %s", poolId)
+	}
+	providerName := fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s/providers/%s", projectNumber, poolId, ciProviderId)
+	if !req.DryRun {
+		description := fmt.Sprintf("GitHub Actions deploying Defang stack %q", b.PulumiStack)
+		if _, err := b.driver.EnsureWorkloadIdentityProviderExists(ctx, poolId, ciProviderId, description, provider); err != nil {
+			return nil, annotateGcpError(err)
+		}
+	}
+
+	// 2. The deployer permissions
+	resp.Addf("ensure custom role %s", bindings.role)
+	resp.Addf("ensure %s has role %s on the project", principal, bindings.role)
+	configCondition := b.ciConfigCondition(projectNumber, req.Project)
+	resp.Addf("ensure %s has role %s on the project if %s", principal, bindings.configRole, configCondition.Expression)
+	resp.Addf("ensure %s has role roles/storage.objectAdmin on bucket %s", principal, bindings.bucket)
+	resp.Addf("ensure %s can act as service account %s", principal, bindings.cdSA)
+	resp.Addf("ensure %s can sign with service account %s", principal, bindings.uploadSA)
+	if !req.DryRun {
+		title := "Defang CI " + b.PulumiStack
+		description := fmt.Sprintf("Permissions to deploy Defang stack %q from CI", b.PulumiStack)
+		role, err := b.driver.EnsureRoleExists(ctx, b.ciRoleId(), title, description, ciPermissions)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.driver.EnsurePrincipalHasRoles(ctx, principal, []string{role}); err != nil {
+			return nil, err
+		}
+		configRole, err := b.driver.EnsureRoleExists(ctx, b.ciConfigRoleId(), title+" config", description, ciConfigPermissions)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.driver.EnsurePrincipalHasConditionalRole(ctx, principal, configRole, configCondition); err != nil {
+			return nil, err
+		}
+		if err := b.driver.EnsurePrincipalHasBucketRoles(ctx, bindings.bucket, principal, []string{"roles/storage.objectAdmin"}); err != nil {
+			return nil, err
+		}
+		if err := b.driver.EnsurePrincipalHasServiceAccountRoles(ctx, principal, bindings.cdSA, []string{"roles/iam.serviceAccountUser"}); err != nil {
+			return nil, err
+		}
+		if err := b.driver.EnsurePrincipalHasServiceAccountRoles(ctx, principal, bindings.uploadSA, []string{"roles/iam.serviceAccountTokenCreator"}); err != nil {
+			return nil, err
+		}
+	}
+
+	resp.Env = map[string]string{
+		"GCP_LOCATION":                      b.driver.GetRegion(),
+		"GCP_PROJECT_ID":                    b.driver.GetProjectID().String(),
+		"GOOGLE_WORKLOAD_IDENTITY_PROVIDER": "//iam.googleapis.com/" + providerName,
+	}
+	return resp, nil
+}
+
+// TearDownCI removes the bindings and deletes the workload identity pool of
+// this stack. The custom roles are kept, since GCP blocks reusing the ID of a
+// deleted role for weeks, and they grant nothing once unbound.
+func (b *ByocGcp) TearDownCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	projectNumber, bindings, err := b.ciPrepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &client.CIResponse{}
+	poolId := b.ciPoolId()
+	principal := ciPrincipalSet(projectNumber, poolId)
+
+	resp.Addf("remove roles %s and %s from %s on the project", bindings.role, bindings.configRole, principal)
+	resp.Addf("remove %s from bucket %s", principal, bindings.bucket)
+	resp.Addf("remove %s from service accounts %s and %s", principal, bindings.cdSA, bindings.uploadSA)
+	resp.Addf("delete workload identity pool %s", poolId)
+	if req.DryRun {
+		return resp, nil
+	}
+	if err := b.driver.RemovePrincipalRoles(ctx, principal, []string{bindings.role, bindings.configRole}); err != nil {
+		return nil, err
+	}
+	if err := b.driver.RemovePrincipalBucketRoles(ctx, bindings.bucket, principal, []string{"roles/storage.objectAdmin"}); err != nil {
+		return nil, err
+	}
+	if err := b.driver.RemovePrincipalServiceAccountRoles(ctx, principal, bindings.cdSA, []string{"roles/iam.serviceAccountUser"}); err != nil {
+		return nil, err
+	}
+	if err := b.driver.RemovePrincipalServiceAccountRoles(ctx, principal, bindings.uploadSA, []string{"roles/iam.serviceAccountTokenCreator"}); err != nil {
+		return nil, err
+	}
+	if err := b.driver.DeleteWorkloadIdentityPool(ctx, poolId); err != nil {
+		return nil, annotateGcpError(err)
+	}
+	return resp, nil
+}
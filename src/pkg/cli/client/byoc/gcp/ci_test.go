@@ -0,0 +1,170 @@
+package gcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc"
+	"github.com/DefangLabs/defang/src/pkg/clouds/gcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ciGcpDriver struct {
+	gcpDriver
+	provider *gcp.WorkloadIdentityProvider
+	calls    []string
+}
+
+func (d *ciGcpDriver) GetBucketWithPrefix(ctx context.Context, prefix string) (string, error) {
+	return "defang-cd-bucket", nil
+}
+
+func (d *ciGcpDriver) GetProjectNumber(ctx context.Context) (string, error) {
+	return "123456", nil
+}
+
+func (d *ciGcpDriver) GetProjectID() gcp.ProjectId {
+	return "my-project"
+}
+
+func (d *ciGcpDriver) GetRegion() string {
+	return "us-central1"
+}
+
+func (d *ciGcpDriver) GetServiceAccountEmail(name string) string {
+	return name + "@my-project.iam.gserviceaccount.com"
+}
+
+func (d *ciGcpDriver) GetWorkloadIdentityProvider(ctx context.Context, poolId, providerId string) (*gcp.WorkloadIdentityProvider, error) {
+	if d.provider == nil {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return d.provider, nil
+}
+
+func (d *ciGcpDriver) EnsureWorkloadIdentityProviderExists(ctx context.Context, poolId, providerId, description string, provider gcp.WorkloadIdentityProvider) (string, error) {
+	d.calls = append(d.calls, "EnsureWorkloadIdentityProviderExists "+poolId+"/"+providerId)
+	provider.State = "ACTIVE"
+	d.provider = &provider
+	return "name", nil
+}
+
+func (d *ciGcpDriver) EnsureRoleExists(ctx context.Context, roleId, title, description string, permissions []string) (string, error) {
+	d.calls = append(d.calls, "EnsureRoleExists "+roleId)
+	return "projects/my-project/roles/" + roleId, nil
+}
+
+func (d *ciGcpDriver) EnsurePrincipalHasRoles(ctx context.Context, principal string, roles []string) error {
+	d.calls = append(d.calls, "EnsurePrincipalHasRoles "+strings.Join(roles, ","))
+	return nil
+}
+
+func (d *ciGcpDriver) EnsurePrincipalHasConditionalRole(ctx context.Context, principal, role string, condition *expr.Expr) error {
+	d.calls = append(d.calls, "EnsurePrincipalHasConditionalRole "+role+" if "+condition.Expression)
+	return nil
+}
+
+func (d *ciGcpDriver) EnsurePrincipalHasBucketRoles(ctx context.Context, bucketName, principal string, roles []string) error {
+	d.calls = append(d.calls, "EnsurePrincipalHasBucketRoles "+bucketName)
+	return nil
+}
+
+func (d *ciGcpDriver) EnsurePrincipalHasServiceAccountRoles(ctx context.Context, principal, serviceAccount string, roles []string) error {
+	d.calls = append(d.calls, "EnsurePrincipalHasServiceAccountRoles "+serviceAccount)
+	return nil
+}
+
+func (d *ciGcpDriver) RemovePrincipalRoles(ctx context.Context, principal string, roles []string) error {
+	d.calls = append(d.calls, "RemovePrincipalRoles "+strings.Join(roles, ","))
+	return nil
+}
+
+func (d *ciGcpDriver) RemovePrincipalBucketRoles(ctx context.Context, bucketName, principal string, roles []string) error {
+	d.calls = append(d.calls, "RemovePrincipalBucketRoles "+bucketName)
+	return nil
+}
+
+func (d *ciGcpDriver) RemovePrincipalServiceAccountRoles(ctx context.Context, principal, serviceAccount string, roles []string) error {
+	d.calls = append(d.calls, "RemovePrincipalServiceAccountRoles "+serviceAccount)
+	return nil
+}
+
+func (d *ciGcpDriver) DeleteWorkloadIdentityPool(ctx context.Context, poolId string) error {
+	d.calls = append(d.calls, "DeleteWorkloadIdentityPool "+poolId)
+	d.provider = nil
+	return nil
+}
+
+func TestSetUpCI(t *testing.T) {
+	ctx := t.Context()
+	driver := &ciGcpDriver{}
+	b := &ByocGcp{driver: driver}
+	b.ByocBaseClient = byoc.NewByocBaseClient("tenant1", b, "prod_Stack")
+	req := client.CIRequest{Project: "app", Repo: "acme/app", Environment: "prod"}
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: "acme"})
+		require.Error(t, err)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		resp, err := b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Environment: req.Environment, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, driver.calls)
+		assert.Equal(t, "create workload identity pool defang-ci-prod-stack for repo:acme/app:environment:prod", resp.Actions[0])
+	})
+
+	t.Run("create", func(t *testing.T) {
+		resp, err := b.SetUpCI(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"EnsureWorkloadIdentityProviderExists defang-ci-prod-stack/github",
+			"EnsureRoleExists defang_ci_prod_stack",
+			"EnsurePrincipalHasRoles projects/my-project/roles/defang_ci_prod_stack",
+			"EnsureRoleExists defang_ci_prod_stack_config",
+			"EnsurePrincipalHasConditionalRole projects/my-project/roles/defang_ci_prod_stack_config if resource.name.startsWith('projects/123456/secrets/Defang_app_prod_Stack_')",
+			"EnsurePrincipalHasBucketRoles defang-cd-bucket",
+			"EnsurePrincipalHasServiceAccountRoles defang-cd@my-project.iam.gserviceaccount.com",
+			"EnsurePrincipalHasServiceAccountRoles defang-upload@my-project.iam.gserviceaccount.com",
+		}, driver.calls)
+		assert.Equal(t, "assertion.sub == 'repo:acme/app:environment:prod'", driver.provider.AttributeCondition)
+		assert.Equal(t, map[string]string{
+			"GCP_LOCATION":                      "us-central1",
+			"GCP_PROJECT_ID":                    "my-project",
+			"GOOGLE_WORKLOAD_IDENTITY_PROVIDER": "//iam.googleapis.com/projects/123456/locations/global/workloadIdentityPools/defang-ci-prod-stack/providers/github",
+		}, resp.Env)
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		resp, err := b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Environment: req.Environment, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, "verified workload identity pool defang-ci-prod-stack", resp.Actions[0])
+
+		resp, err = b.SetUpCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Branch: "main", DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, "update workload identity provider defang-ci-prod-stack/github to repo:acme/app:ref:refs/heads/main", resp.Actions[0])
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		driver.calls = nil
+		_, err := b.TearDownCI(ctx, client.CIRequest{Project: "app", Repo: req.Repo, Environment: req.Environment, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, driver.calls)
+
+		_, err = b.TearDownCI(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"RemovePrincipalRoles projects/my-project/roles/defang_ci_prod_stack,projects/my-project/roles/defang_ci_prod_stack_config",
+			"RemovePrincipalBucketRoles defang-cd-bucket",
+			"RemovePrincipalServiceAccountRoles defang-cd@my-project.iam.gserviceaccount.com",
+			"RemovePrincipalServiceAccountRoles defang-upload@my-project.iam.gserviceaccount.com",
+			"DeleteWorkloadIdentityPool defang-ci-prod-stack",
+		}, driver.calls)
+	})
+}
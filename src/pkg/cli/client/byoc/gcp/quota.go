@@ -0,0 +1,54 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+var _ client.QuotaChecker = (*ByocGcp)(nil)
+
+const cloudRunService = "run.googleapis.com"
+
+// GetQuotaUsage implements client.QuotaChecker, using the Cloud Run allocation
+// quotas of the region. Service Usage does not report the current usage.
+func (b *ByocGcp) GetQuotaUsage(ctx context.Context, demand client.QuotaDemand) ([]client.QuotaUsage, error) {
+	limits, err := b.driver.GetServiceQuotaLimits(ctx, cloudRunService)
+	if err != nil {
+		return nil, annotateGcpError(err)
+	}
+	return cloudRunQuotaUsage(limits, string(b.driver.GetProjectID()), b.driver.GetRegion(), demand), nil
+}
+
+func cloudRunQuotaUsage(limits map[string]int64, projectId, region string, demand client.QuotaDemand) []client.QuotaUsage {
+	increaseURL := fmt.Sprintf("https://console.cloud.google.com/iam-admin/quotas?project=%s&service=%s", projectId, cloudRunService)
+	var usages []client.QuotaUsage
+	// scale converts the quota unit to the unit of the demand
+	add := func(metric, name string, requested, scale float64) {
+		if requested <= 0 {
+			return
+		}
+		limit, ok := limits[metric]
+		if !ok {
+			term.Debugf("Quota %s not found; cannot check %s", metric, name)
+			return
+		}
+		if limit < 0 {
+			return // unlimited
+		}
+		usages = append(usages, client.QuotaUsage{
+			Name:        name,
+			Region:      region,
+			Requested:   requested,
+			Used:        -1,
+			Limit:       float64(limit) / scale,
+			IncreaseURL: increaseURL,
+		})
+	}
+	add("run.googleapis.com/cpu_allocation", "Cloud Run CPUs", demand.Cpus, 1000)               // milli vCPU
+	add("run.googleapis.com/mem_allocation", "Cloud Run memory (MiB)", demand.MemoryMiB, 1<<20) // bytes
+	add("run.googleapis.com/nvidia_l4_gpu_allocation", "Cloud Run NVIDIA L4 GPUs", float64(demand.Gpus), 1)
+	return usages
+}
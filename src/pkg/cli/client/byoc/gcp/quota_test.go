@@ -0,0 +1,33 @@
+package gcp
+
+import (
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+)
+
+func TestCloudRunQuotaUsage(t *testing.T) {
+	limits := map[string]int64{
+		"run.googleapis.com/cpu_allocation": 20000,
+		"run.googleapis.com/mem_allocation": 4 << 30,
+	}
+	demand := client.QuotaDemand{Cpus: 2, MemoryMiB: 8192, Gpus: 1}
+	usages := cloudRunQuotaUsage(limits, "my-project", "us-central1", demand)
+	if len(usages) != 2 {
+		t.Fatalf("expected the GPU quota to be skipped, got %+v", usages)
+	}
+	if cpus := usages[0]; cpus.Exceeded() || cpus.Limit != 20 || cpus.Used != -1 || cpus.Region != "us-central1" {
+		t.Errorf("unexpected CPU quota %+v", cpus)
+	}
+	if memory := usages[1]; !memory.Exceeded() || memory.Limit != 4096 {
+		t.Errorf("expected the memory quota to be exceeded, got %+v", memory)
+	}
+}
+
+func TestCloudRunQuotaUsageUnlimited(t *testing.T) {
+	limits := map[string]int64{"run.googleapis.com/cpu_allocation": -1}
+	usages := cloudRunQuotaUsage(limits, "my-project", "us-central1", client.QuotaDemand{Cpus: 2})
+	if len(usages) != 0 {
+		t.Errorf("expected an unlimited quota to be skipped, got %+v", usages)
+	}
+}
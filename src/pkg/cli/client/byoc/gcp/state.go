@@ -0,0 +1,126 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/clouds/gcp"
+)
+
+var _ client.StateStore = (*ByocGcp)(nil)
+var _ client.LockStore = (*ByocGcp)(nil)
+
+func (b *ByocGcp) stateBucket(ctx context.Context) (string, error) {
+	bucketName, err := b.driver.GetBucketWithPrefix(ctx, DefangCDProjectName)
+	if err != nil {
+		return "", annotateGcpError(err)
+	}
+	if bucketName == "" {
+		return "", fmt.Errorf("no defang cd bucket found: %w", client.ErrNotExist)
+	}
+	return bucketName, nil
+}
+
+// GetStateObject implements client.StateStore.
+func (b *ByocGcp) GetStateObject(ctx context.Context, key string) ([]byte, error) {
+	bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Current user might not have object viewer access to the bucket, use the upload service account
+	uploadSA := b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName)
+	data, err := b.driver.GetBucketObjectWithServiceAccount(ctx, bucketName, key, uploadSA)
+	if err != nil {
+		if errors.Is(err, gcp.ErrObjectNotExist) {
+			return nil, fmt.Errorf("%q: %w", key, client.ErrNotExist)
+		}
+		return nil, annotateGcpError(err)
+	}
+	return data, nil
+}
+
+// PutStateObject implements client.StateStore.
+func (b *ByocGcp) PutStateObject(ctx context.Context, key string, data []byte) error {
+	bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return err
+	}
+	uploadSA := b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName)
+	return annotateGcpError(b.driver.PutBucketObjectWithServiceAccount(ctx, bucketName, key, uploadSA, data))
+}
+
+func lockStoreError(err error) error {
+	switch {
+	case errors.Is(err, gcp.ErrObjectNotExist):
+		return client.ErrNotExist
+	case gcp.IsPreconditionFailed(err):
+		return client.ErrPreconditionFailed
+	default:
+		return annotateGcpError(err)
+	}
+}
+
+// GetLockObject implements client.LockStore.
+func (b *ByocGcp) GetLockObject(ctx context.Context, key string) ([]byte, string, error) {
+	bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	uploadSA := b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName)
+	data, generation, err := b.driver.GetBucketObjectWithGeneration(ctx, bucketName, key, uploadSA)
+	if err != nil {
+		return nil, "", lockStoreError(err)
+	}
+	return data, strconv.FormatInt(generation, 10), nil
+}
+
+// PutLockObject implements client.LockStore, using GCS generation preconditions.
+func (b *ByocGcp) PutLockObject(ctx context.Context, key string, data []byte, version string) (string, error) {
+	bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return "", err
+	}
+	var generation int64
+	if version != "" {
+		if generation, err = strconv.ParseInt(version, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid object generation %q: %w", version, err)
+		}
+	}
+	uploadSA := b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName)
+	generation, err = b.driver.PutBucketObjectWithGeneration(ctx, bucketName, key, uploadSA, data, generation)
+	if err != nil {
+		return "", lockStoreError(err)
+	}
+	return strconv.FormatInt(generation, 10), nil
+}
+
+// DeleteLockObject implements client.LockStore.
+func (b *ByocGcp) DeleteLockObject(ctx context.Context, key string, version string) error {
+	bucketName, err := b.stateBucket(ctx)
+	if err != nil {
+		return err
+	}
+	var generation int64
+	if version != "" {
+		if generation, err = strconv.ParseInt(version, 10, 64); err != nil {
+			return fmt.Errorf("invalid object generation %q: %w", version, err)
+		}
+	}
+	uploadSA := b.driver.GetServiceAccountEmail(DefangUploadServiceAccountName)
+	if err := b.driver.DeleteBucketObjectWithGeneration(ctx, bucketName, key, uploadSA, generation); err != nil {
+		return lockStoreError(err)
+	}
+	return nil
+}
+
+// IsCdTaskDone implements client.LockStore.
+func (b *ByocGcp) IsCdTaskDone(ctx context.Context, cdID string) (bool, error) {
+	done, err := b.driver.GetBuildStatus(ctx, cdID)
+	if done {
+		return true, nil // succeeded or failed
+	}
+	return false, err
+}
@@ -0,0 +1,194 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Pulumi marks special values in the state with this signature key; see
+// https://github.com/pulumi/pulumi/blob/master/sdk/go/common/resource/sig/sig.go
+const (
+	sigKey    = "4dabf18193072939515e22adb298388d"
+	secretSig = "1b47061264138c4ac30d75fd1eb44270"
+)
+
+const Redacted = "[secret]"
+
+// StateKey returns the object key of the Pulumi state of the given project and
+// stack in the CD bucket, using the layout of Pulumi's DIY backend.
+func StateKey(project, stack string) string {
+	return ".pulumi/stacks/" + project + "/" + stack + ".json"
+}
+
+type Resource struct {
+	URN                     string         `json:"urn"`
+	Type                    string         `json:"type"`
+	ID                      string         `json:"id,omitempty"`
+	Custom                  bool           `json:"custom,omitempty"`
+	Outputs                 map[string]any `json:"outputs,omitempty"`
+	AdditionalSecretOutputs []string       `json:"additionalSecretOutputs,omitempty"`
+}
+
+// Name returns the last part of the resource URN.
+func (r Resource) Name() string {
+	if i := strings.LastIndex(r.URN, "::"); i >= 0 {
+		return r.URN[i+2:]
+	}
+	return r.URN
+}
+
+// RedactedOutputs returns the outputs of the resource with all secret values
+// replaced by Redacted.
+func (r Resource) RedactedOutputs() map[string]any {
+	outputs := make(map[string]any, len(r.Outputs))
+	for k, v := range r.Outputs {
+		outputs[k] = redactSecrets(v)
+	}
+	for _, k := range r.AdditionalSecretOutputs {
+		if _, ok := outputs[k]; ok {
+			outputs[k] = Redacted
+		}
+	}
+	return outputs
+}
+
+func redactSecrets(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if v[sigKey] == secretSig {
+			return Redacted
+		}
+		redacted := make(map[string]any, len(v))
+		for k, vv := range v {
+			redacted[k] = redactSecrets(vv)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, vv := range v {
+			redacted[i] = redactSecrets(vv)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// PendingOperation is an operation that was started but not completed, for
+// example because the CD task was killed during an update.
+type PendingOperation struct {
+	Resource Resource `json:"resource"`
+	Type     string   `json:"type"` // "creating", "updating", "deleting", "reading", or "importing"
+}
+
+// Snapshot is the latest checkpoint of a Pulumi stack.
+type Snapshot struct {
+	Stack             string // "organization/project/stack"
+	Resources         []Resource
+	PendingOperations []PendingOperation
+}
+
+type checkpointFile struct {
+	Version    int `json:"version"`
+	Checkpoint struct {
+		Stack  string `json:"stack"`
+		Latest struct {
+			Resources         []Resource         `json:"resources,omitempty"`
+			PendingOperations []PendingOperation `json:"pending_operations,omitempty"`
+		} `json:"latest"`
+	} `json:"checkpoint"`
+}
+
+func ParseSnapshot(data []byte) (*Snapshot, error) {
+	var file checkpointFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode Pulumi state: %w", err)
+	}
+	if file.Version != 3 {
+		return nil, fmt.Errorf("unsupported Pulumi state version %d", file.Version)
+	}
+	return &Snapshot{
+		Stack:             file.Checkpoint.Stack,
+		Resources:         file.Checkpoint.Latest.Resources,
+		PendingOperations: file.Checkpoint.Latest.PendingOperations,
+	}, nil
+}
+
+// RepairPendingOperations removes all pending operations from the Pulumi state
+// in data. Pending creates whose URN is in imports are instead added to the
+// resources with the given cloud ID, like "pulumi refresh --import-pending-creates";
+// their outputs are their inputs until the next refresh. Everything else in
+// the state is kept as-is.
+func RepairPendingOperations(data []byte, imports map[string]string) ([]byte, error) {
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode Pulumi state: %w", err)
+	}
+	var checkpoint map[string]json.RawMessage
+	if err := json.Unmarshal(file["checkpoint"], &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode Pulumi checkpoint: %w", err)
+	}
+	var latest map[string]json.RawMessage
+	if err := json.Unmarshal(checkpoint["latest"], &latest); err != nil || latest == nil {
+		return nil, errors.New("failed to decode the latest Pulumi deployment")
+	}
+
+	var pending []struct {
+		Resource map[string]json.RawMessage `json:"resource"`
+		Type     string                     `json:"type"`
+	}
+	if raw, ok := latest["pending_operations"]; ok {
+		if err := json.Unmarshal(raw, &pending); err != nil {
+			return nil, fmt.Errorf("failed to decode pending operations: %w", err)
+		}
+	}
+	var resources []json.RawMessage
+	if raw, ok := latest["resources"]; ok {
+		if err := json.Unmarshal(raw, &resources); err != nil {
+			return nil, fmt.Errorf("failed to decode resources: %w", err)
+		}
+	}
+
+	remaining := maps.Clone(imports)
+	for _, op := range pending {
+		var urn string
+		_ = json.Unmarshal(op.Resource["urn"], &urn)
+		id, ok := remaining[urn]
+		if !ok {
+			continue
+		}
+		if op.Type != "creating" {
+			return nil, fmt.Errorf("cannot import %q: pending operation is %q, not \"creating\"", urn, op.Type)
+		}
+		delete(remaining, urn)
+		op.Resource["id"], _ = json.Marshal(id)
+		if inputs, ok := op.Resource["inputs"]; ok {
+			op.Resource["outputs"] = inputs
+		}
+		res, err := json.Marshal(op.Resource)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res) // after its parent and dependencies, which were created before it
+	}
+	if len(remaining) > 0 {
+		return nil, fmt.Errorf("cannot import %q: no such pending operation", slices.Sorted(maps.Keys(remaining)))
+	}
+
+	var err error
+	if latest["resources"], err = json.Marshal(resources); err != nil {
+		return nil, err
+	}
+	delete(latest, "pending_operations")
+	if checkpoint["latest"], err = json.Marshal(latest); err != nil {
+		return nil, err
+	}
+	if file["checkpoint"], err = json.Marshal(checkpoint); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(file, "", "    ")
+}
@@ -0,0 +1,124 @@
+package state
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	data, err := os.ReadFile("testdata/pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := ParseSnapshot(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap.Stack != "organization/unit-test/beta" {
+		t.Errorf("expected stack %q, got %q", "organization/unit-test/beta", snap.Stack)
+	}
+	if len(snap.Resources) != 5 {
+		t.Errorf("expected 5 resources, got %d", len(snap.Resources))
+	}
+	if len(snap.PendingOperations) != 3 {
+		t.Fatalf("expected 3 pending operations, got %d", len(snap.PendingOperations))
+	}
+	op := snap.PendingOperations[0]
+	if op.Type != "creating" || op.Resource.Name() != "*.unit-test.defang.defang.appValidation" {
+		t.Errorf("unexpected pending operation %q on %q", op.Type, op.Resource.Name())
+	}
+
+	if _, err := ParseSnapshot([]byte(`{"version":1}`)); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestRedactedOutputs(t *testing.T) {
+	res := Resource{
+		Outputs: map[string]any{
+			"plain":  "value",
+			"secret": map[string]any{sigKey: secretSig, "ciphertext": "abc"},
+			"nested": []any{map[string]any{"password": map[string]any{sigKey: secretSig, "plaintext": `"hunter2"`}}},
+			"ref":    map[string]any{sigKey: "5cf8f73096256a8f31e491e813e4eb8e", "urn": "urn"},
+			"extra":  "sensitive",
+		},
+		AdditionalSecretOutputs: []string{"extra", "missing"},
+	}
+	outputs := res.RedactedOutputs()
+	if outputs["plain"] != "value" {
+		t.Errorf("plain: got %v", outputs["plain"])
+	}
+	if outputs["secret"] != Redacted {
+		t.Errorf("secret: got %v", outputs["secret"])
+	}
+	if got := outputs["nested"].([]any)[0].(map[string]any)["password"]; got != Redacted {
+		t.Errorf("nested: got %v", got)
+	}
+	if got := outputs["ref"].(map[string]any)["urn"]; got != "urn" {
+		t.Errorf("ref: got %v", got)
+	}
+	if outputs["extra"] != Redacted {
+		t.Errorf("extra: got %v", outputs["extra"])
+	}
+	if _, ok := outputs["missing"]; ok {
+		t.Error("missing: should not be added")
+	}
+	if res.Outputs["secret"].(map[string]any)["ciphertext"] != "abc" {
+		t.Error("original outputs should not be modified")
+	}
+}
+
+func TestRepairPendingOperations(t *testing.T) {
+	data, err := os.ReadFile("testdata/pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const urn = "urn:pulumi:beta::unit-test::aws:acm/certificateValidation:CertificateValidation::*.unit-test.defang.defang.appValidation"
+
+	t.Run("clear", func(t *testing.T) {
+		repaired, err := RepairPendingOperations(data, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		snap, err := ParseSnapshot(repaired)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(snap.PendingOperations) != 0 {
+			t.Errorf("expected no pending operations, got %d", len(snap.PendingOperations))
+		}
+		if len(snap.Resources) != 5 {
+			t.Errorf("expected 5 resources, got %d", len(snap.Resources))
+		}
+		if snap.Stack != "organization/unit-test/beta" {
+			t.Errorf("stack changed to %q", snap.Stack)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		repaired, err := RepairPendingOperations(data, map[string]string{urn: "cert-validation-id"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		snap, err := ParseSnapshot(repaired)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(snap.Resources) != 6 {
+			t.Fatalf("expected 6 resources, got %d", len(snap.Resources))
+		}
+		imported := snap.Resources[5]
+		if imported.URN != urn || imported.ID != "cert-validation-id" {
+			t.Errorf("unexpected imported resource %q with ID %q", imported.URN, imported.ID)
+		}
+		if imported.Outputs["certificateArn"] == nil {
+			t.Error("expected the inputs to be copied to the outputs")
+		}
+	})
+
+	t.Run("import unknown", func(t *testing.T) {
+		if _, err := RepairPendingOperations(data, map[string]string{"urn:unknown": "id"}); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
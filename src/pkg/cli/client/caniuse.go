@@ -13,6 +13,10 @@ import (
 var CliVersion string
 
 func CanIUseProvider(ctx context.Context, client FabricClient, provider Provider, projectName string, serviceCount int, allowUpgrade bool) error {
+	if IsOffline(provider) {
+		return nil // nothing to check with the Fabric
+	}
+
 	info, err := provider.AccountInfo(ctx)
 	if err != nil {
 		return err
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GitHubOIDCIssuer is the issuer of the OIDC tokens of GitHub Actions workflows.
+const GitHubOIDCIssuer = "token.actions.githubusercontent.com"
+
+// CIRequest describes the GitHub Actions workflow that is trusted to deploy a stack.
+type CIRequest struct {
+	Project     string // the project that the workflow deploys
+	Repo        string // GitHub repository, as "owner/name"
+	Branch      string // trust workflows for this branch…
+	Environment string // …or for this GitHub deployment environment
+	DryRun      bool   // only check what exists and report what would change
+}
+
+func (r CIRequest) Validate() error {
+	if r.Project == "" {
+		return errors.New("project name is required")
+	}
+	owner, name, ok := strings.Cut(r.Repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid repository %q; expected owner/name", r.Repo)
+	}
+	if r.Branch != "" && r.Environment != "" {
+		return errors.New("cannot trust both a branch and an environment; pick one")
+	}
+	if r.Branch == "" && r.Environment == "" {
+		return errors.New("either a branch or an environment is required")
+	}
+	return nil
+}
+
+// Subject is the "sub" claim of the OIDC tokens of the trusted workflow runs.
+func (r CIRequest) Subject() string {
+	if r.Environment != "" {
+		return "repo:" + r.Repo + ":environment:" + r.Environment
+	}
+	return "repo:" + r.Repo + ":ref:refs/heads/" + r.Branch
+}
+
+type CIResponse struct {
+	Actions []string          // what was (or, for a dry run, would be) created, updated, verified, or deleted
+	Env     map[string]string // variables the workflow needs to deploy the stack
+}
+
+func (r *CIResponse) Addf(format string, args ...any) {
+	r.Actions = append(r.Actions, fmt.Sprintf(format, args...))
+}
+
+// CIProvider is implemented by the BYOC providers that can set up keyless
+// (OIDC) trust for a CI workflow to deploy a stack.
+type CIProvider interface {
+	SetUpCI(context.Context, CIRequest) (*CIResponse, error)
+	TearDownCI(context.Context, CIRequest) (*CIResponse, error)
+}
@@ -23,6 +23,7 @@ type FabricClient interface {
 	GenerateFiles(context.Context, *defangv1.GenerateFilesRequest) (*defangv1.GenerateFilesResponse, error)
 	GetDefaultStack(context.Context, *defangv1.GetDefaultStackRequest) (*defangv1.GetStackResponse, error)
 	GetDelegateSubdomainZone(context.Context, *defangv1.GetDelegateSubdomainZoneRequest) (*defangv1.DelegateSubdomainZoneResponse, error)
+	GetDeployment(context.Context, *defangv1.GetDeploymentRequest) (*defangv1.GetDeploymentResponse, error)
 	GetFabricClient() defangv1connect.FabricControllerClient
 	GetPlaygroundProjectDomain(context.Context) (*defangv1.GetPlaygroundProjectDomainResponse, error)
 	GetRecipe(context.Context, *defangv1.GetRecipeRequest) (*defangv1.GetRecipeResponse, error)
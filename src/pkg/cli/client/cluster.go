@@ -14,7 +14,7 @@ import (
 const DefaultFabricAddr = "fabric-prod1.defang.dev"
 
 var DefangFabric = pkg.Getenv("DEFANG_FABRIC", DefaultFabricAddr)
-var TokenStore tokenstore.TokenStore = &tokenstore.LocalDirTokenStore{Dir: StateDir}
+var TokenStore tokenstore.TokenStore = tokenstore.New("defang", StateDir)
 
 func NormalizeHost(fabricAddr string) string {
 	if fabricAddr == "" {
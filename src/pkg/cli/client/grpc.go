@@ -113,6 +113,10 @@ func (g GrpcClient) ListDeployments(ctx context.Context, req *defangv1.ListDeplo
 	return getMsg(g.client.ListDeployments(ctx, connect.NewRequest(req)))
 }
 
+func (g GrpcClient) GetDeployment(ctx context.Context, req *defangv1.GetDeploymentRequest) (*defangv1.GetDeploymentResponse, error) {
+	return getMsg(g.client.GetDeployment(ctx, connect.NewRequest(req)))
+}
+
 func (g GrpcClient) GenerateFiles(ctx context.Context, req *defangv1.GenerateFilesRequest) (*defangv1.GenerateFilesResponse, error) {
 	return getMsg(g.client.GenerateFiles(ctx, connect.NewRequest(req)))
 }
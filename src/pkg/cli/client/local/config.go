@@ -0,0 +1,139 @@
+package local
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/tokenstore"
+)
+
+// configKeyName is the name of the config key in the OS keyring.
+const configKeyName = "local-config-key"
+
+// keyStore keeps the config key, like the OS keyring.
+type keyStore interface {
+	Load(key string) (string, error)
+	Save(key, value string) error
+}
+
+// configStore keeps the config values of a project in a JSON file encrypted
+// with AES-256-GCM. The key is derived from DEFANG_LOCAL_CONFIG_KEY if set, so
+// CI can use a secret, or else generated once and kept in the OS keyring; it
+// is never stored next to the encrypted config.
+type configStore struct {
+	path string
+	keys keyStore
+	// legacyKeyPath is where older versions kept the key; it is moved into the keyring
+	legacyKeyPath string
+}
+
+func (c configStore) key() ([]byte, error) {
+	if secret := os.Getenv("DEFANG_LOCAL_CONFIG_KEY"); secret != "" {
+		key := sha256.Sum256([]byte(secret))
+		return key[:], nil
+	}
+
+	encoded, err := c.keys.Load(configKeyName)
+	if err == nil {
+		key, err := hex.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("invalid local config key in the OS keyring")
+		}
+		return key, nil
+	}
+	if errors.Is(err, tokenstore.ErrKeyringUnavailable) {
+		return nil, errors.New("the OS keyring is not available to keep the key of the local config; set DEFANG_LOCAL_CONFIG_KEY instead")
+	}
+	if !errors.Is(err, tokenstore.ErrKeyringNotFound) {
+		return nil, err
+	}
+
+	key, err := os.ReadFile(c.legacyKeyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid config key in %s", c.legacyKeyPath)
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+	if err := c.keys.Save(configKeyName, hex.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to save the local config key; set DEFANG_LOCAL_CONFIG_KEY instead: %w", err)
+	}
+	if err := os.Remove(c.legacyKeyPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		term.Warnf("Failed to remove %s after moving the key into the OS keyring: %v", c.legacyKeyPath, err)
+	}
+	return key, nil
+}
+
+func (c configStore) aead() (cipher.AEAD, error) {
+	key, err := c.key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c configStore) load() (map[string]string, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid config file %s", c.path)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt config file %s; was DEFANG_LOCAL_CONFIG_KEY changed? %w", c.path, err)
+	}
+	configs := map[string]string{}
+	if err := json.Unmarshal(plaintext, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (c configStore) save(configs map[string]string) error {
+	plaintext, err := json.Marshal(configs)
+	if err != nil {
+		return err
+	}
+	aead, err := c.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, aead.Seal(nonce, nonce, plaintext, nil), 0600)
+}
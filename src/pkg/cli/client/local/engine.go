@@ -0,0 +1,314 @@
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var ErrNoEngine = errors.New("no container engine found")
+
+// Engine runs the commands of a local container engine, like Docker or Podman.
+type Engine interface {
+	Name() string
+	// Output runs the command and returns its standard output
+	Output(ctx context.Context, env []string, args ...string) ([]byte, error)
+	// Run runs the command with its output going to the terminal
+	Run(ctx context.Context, env []string, args ...string) error
+	// Stream starts the command and returns its standard output; closing it stops the command
+	Stream(ctx context.Context, args ...string) (io.ReadCloser, error)
+}
+
+// FindEngine returns the engine named by DEFANG_LOCAL_ENGINE, or else the
+// first of docker and podman found in the PATH.
+func FindEngine() (Engine, error) {
+	names := []string{"docker", "podman"}
+	if name := os.Getenv("DEFANG_LOCAL_ENGINE"); name != "" {
+		names = []string{name}
+	}
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			term.Debugf("Using container engine %q at %s", name, path)
+			return execEngine{name: name, path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: install Docker or Podman, or set DEFANG_LOCAL_ENGINE", ErrNoEngine)
+}
+
+type execEngine struct {
+	name string
+	path string
+}
+
+func (e execEngine) Name() string {
+	return e.name
+}
+
+func (e execEngine) command(ctx context.Context, env []string, args ...string) *exec.Cmd {
+	term.Debug("Running", e.name, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, e.path, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+func (e execEngine) Output(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	cmd := e.command(ctx, env, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w: %s", e.name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (e execEngine) Run(ctx context.Context, env []string, args ...string) error {
+	cmd := e.command(ctx, env, args...)
+	_, stdout, stderr := term.DefaultTerm.Stdio()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w", e.name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func (e execEngine) Stream(ctx context.Context, args ...string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := e.command(ctx, nil, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &commandReader{Reader: stdout, cancel: cancel, cmd: cmd}, nil
+}
+
+type commandReader struct {
+	io.Reader
+	cancel context.CancelFunc
+	cmd    *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.cancel()
+	r.cmd.Wait() // also closes the pipe; the exit status is irrelevant after a cancel
+	return nil
+}
+
+// psEntry is a container from `compose ps --format json`.
+type psEntry struct {
+	Name       string
+	Service    string
+	State      string // created, running, restarting, exited, dead, …
+	Health     string // "", starting, healthy, unhealthy
+	ExitCode   int
+	Publishers []struct {
+		URL           string
+		TargetPort    uint32
+		PublishedPort uint32
+		Protocol      string
+	}
+}
+
+// parsePs parses the output of `compose ps --format json`, which is a JSON
+// array in older versions of Compose and one JSON object per line in newer ones.
+func parsePs(out []byte) ([]psEntry, error) {
+	out = bytes.TrimSpace(out)
+	var entries []psEntry
+	if len(out) == 0 {
+		return entries, nil
+	}
+	if out[0] == '[' {
+		err := json.Unmarshal(out, &entries)
+		return entries, err
+	}
+	for line := range bytes.Lines(out) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry psEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// containerState maps the state of a container to a ServiceState.
+func (e psEntry) containerState() defangv1.ServiceState {
+	switch e.State {
+	case "running":
+		switch e.Health {
+		case "", "healthy":
+			return defangv1.ServiceState_DEPLOYMENT_COMPLETED
+		case "unhealthy":
+			return defangv1.ServiceState_DEPLOYMENT_FAILED
+		default:
+			return defangv1.ServiceState_DEPLOYMENT_PENDING
+		}
+	case "created", "restarting":
+		return defangv1.ServiceState_DEPLOYMENT_PENDING
+	case "exited", "dead":
+		if e.ExitCode == 0 {
+			return defangv1.ServiceState_DEPLOYMENT_COMPLETED // a job that ran to completion
+		}
+		return defangv1.ServiceState_DEPLOYMENT_FAILED
+	default: // paused, removing
+		return defangv1.ServiceState_NOT_SPECIFIED
+	}
+}
+
+func (e psEntry) endpoints() []string {
+	var endpoints []string
+	for _, p := range e.Publishers {
+		if p.PublishedPort == 0 {
+			continue
+		}
+		endpoint := "localhost:" + strconv.FormatUint(uint64(p.PublishedPort), 10)
+		if !slices.Contains(endpoints, endpoint) {
+			endpoints = append(endpoints, endpoint) // IPv4 and IPv6 are listed separately
+		}
+	}
+	return endpoints
+}
+
+// worseState returns the state of a service with replicas in states a and b.
+func worseState(a, b defangv1.ServiceState) defangv1.ServiceState {
+	rank := func(s defangv1.ServiceState) int {
+		switch s {
+		case defangv1.ServiceState_DEPLOYMENT_FAILED:
+			return 3
+		case defangv1.ServiceState_DEPLOYMENT_PENDING:
+			return 2
+		case defangv1.ServiceState_DEPLOYMENT_COMPLETED:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+var replicaSuffix = regexp.MustCompile(`-\d+$`)
+
+// parseLogLine parses a line of `compose logs --no-color --timestamps`, like
+// "web-1  | 2024-05-01T12:00:00.000000000Z listening on :8080".
+func parseLogLine(line string) *defangv1.LogEntry {
+	entry := &defangv1.LogEntry{Message: line}
+	prefix, rest, ok := strings.Cut(line, "|")
+	if !ok {
+		return entry
+	}
+	entry.Host = strings.TrimSpace(prefix)
+	entry.Service = replicaSuffix.ReplaceAllString(entry.Host, "")
+	rest = strings.TrimPrefix(rest, " ")
+	entry.Message = rest
+	if ts, msg, ok := strings.Cut(rest, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			entry.Timestamp = timestamppb.New(t)
+			entry.Message = msg
+		}
+	}
+	return entry
+}
+
+// event is a container event from `<engine> events --format '{{json .}}'`;
+// Docker and Podman use different fields for the same information.
+type event struct {
+	Type   string
+	Action string // Docker
+	Status string // Docker (deprecated) and Podman
+	Actor  struct {
+		Attributes map[string]string
+	} // Docker
+	Attributes        map[string]string // Podman
+	HealthStatus      string            // Podman
+	ContainerExitCode int               // Podman
+}
+
+func (e event) attribute(name string) string {
+	if value, ok := e.Actor.Attributes[name]; ok {
+		return value
+	}
+	return e.Attributes[name]
+}
+
+func (e event) service() string {
+	return e.attribute("com.docker.compose.service")
+}
+
+// serviceState maps a container event to a ServiceState; healthchecked is
+// true if the service has a healthcheck, so "start" is not the end state.
+func (e event) serviceState(healthchecked bool) (defangv1.ServiceState, string) {
+	action := e.Action
+	if action == "" {
+		action = e.Status
+	}
+	health, _ := strings.CutPrefix(action, "health_status: ")
+	if action == "health_status" {
+		health = e.HealthStatus
+	}
+	switch {
+	case action == "create":
+		return defangv1.ServiceState_DEPLOYMENT_PENDING, action
+	case action == "start":
+		if healthchecked {
+			return defangv1.ServiceState_DEPLOYMENT_PENDING, action
+		}
+		return defangv1.ServiceState_DEPLOYMENT_COMPLETED, action
+	case health == "healthy":
+		return defangv1.ServiceState_DEPLOYMENT_COMPLETED, "health_status: " + health
+	case health == "unhealthy":
+		return defangv1.ServiceState_DEPLOYMENT_FAILED, "health_status: " + health
+	case action == "oom":
+		return defangv1.ServiceState_DEPLOYMENT_FAILED, "out of memory"
+	case action == "die":
+		exitCode := e.attribute("exitCode")
+		if exitCode == "" {
+			exitCode = strconv.Itoa(e.ContainerExitCode)
+		}
+		status := "exited with code " + exitCode
+		if exitCode == "0" {
+			return defangv1.ServiceState_DEPLOYMENT_COMPLETED, status
+		}
+		return defangv1.ServiceState_DEPLOYMENT_FAILED, status
+	default:
+		return defangv1.ServiceState_NOT_SPECIFIED, action
+	}
+}
+
+// scanLines calls fn for each line read from r until fn returns false.
+func scanLines(r io.Reader, fn func(string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
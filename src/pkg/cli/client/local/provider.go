@@ -0,0 +1,594 @@
+package local
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	byocState "github.com/DefangLabs/defang/src/pkg/cli/client/byoc/state"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/logs"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/tokenstore"
+	"github.com/DefangLabs/defang/src/pkg/types"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// scheduledProfile is given to scheduled services, so `compose up` doesn't start them.
+const scheduledProfile = "defang-scheduled"
+
+// LocalProvider "deploys" to the local Docker or Podman daemon, so the CLI
+// can be tested end-to-end without a cloud account or the Fabric. Each stack
+// of a project is a separate Compose project with its own state and config.
+type LocalProvider struct {
+	client.RetryDelayer
+	Engine   Engine // nil to find one with FindEngine
+	StateDir string
+	Keys     keyStore // keeps the config key; the OS keyring by default
+	stack    string
+}
+
+var _ client.Provider = (*LocalProvider)(nil)
+
+func NewLocalProvider(stack string) *LocalProvider {
+	return &LocalProvider{
+		StateDir: filepath.Join(client.StateDir, "local"),
+		Keys:     tokenstore.NewKeyringTokenStore("defang-local", nil),
+		stack:    stack,
+	}
+}
+
+func (*LocalProvider) Offline() bool {
+	return true
+}
+
+func (p *LocalProvider) engine() (Engine, error) {
+	if p.Engine == nil {
+		engine, err := FindEngine()
+		if err != nil {
+			return nil, err
+		}
+		p.Engine = engine
+	}
+	return p.Engine, nil
+}
+
+// stackDir holds the projects deployed to the stack.
+func (p *LocalProvider) stackDir() string {
+	return filepath.Join(p.StateDir, cmp.Or(p.stack, "default"))
+}
+
+func (p *LocalProvider) projectDir(projectName string) string {
+	return filepath.Join(p.stackDir(), projectName)
+}
+
+// composeProjectName is the name of the Compose project of the project in the
+// stack, so the stacks don't replace each other's containers.
+func (p *LocalProvider) composeProjectName(projectName string) string {
+	if p.stack == "" {
+		return projectName
+	}
+	return projectName + "-" + strings.ToLower(p.stack)
+}
+
+func (p *LocalProvider) composePath(projectName string) string {
+	return filepath.Join(p.projectDir(projectName), "compose.yaml")
+}
+
+func (p *LocalProvider) projectUpdatePath(projectName string) string {
+	return filepath.Join(p.projectDir(projectName), "project.pb")
+}
+
+func (p *LocalProvider) configStore(projectName string) configStore {
+	return configStore{
+		path:          filepath.Join(p.projectDir(projectName), "config.enc"),
+		keys:          p.Keys,
+		legacyKeyPath: filepath.Join(p.StateDir, "config.key"),
+	}
+}
+
+// composeArgs returns the arguments of a `compose` command for the project.
+func (p *LocalProvider) composeArgs(projectName string, args ...string) []string {
+	composeArgs := []string{"compose", "--project-name", p.composeProjectName(projectName)}
+	if _, err := os.Stat(p.composePath(projectName)); err == nil {
+		composeArgs = append(composeArgs, "--file", p.composePath(projectName))
+	}
+	return append(composeArgs, args...)
+}
+
+func (p *LocalProvider) Authenticate(ctx context.Context, interactive bool) error {
+	_, err := p.engine()
+	return err
+}
+
+func (p *LocalProvider) AccountInfo(ctx context.Context) (*client.AccountInfo, error) {
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+	return &client.AccountInfo{
+		Provider:  client.ProviderLocal,
+		AccountID: engine.Name(),
+	}, nil
+}
+
+func (p *LocalProvider) GetStackName() string {
+	return p.stack
+}
+
+func (*LocalProvider) GetStackNameForDomain() string {
+	return ""
+}
+
+func (*LocalProvider) Driver() string {
+	return "local"
+}
+
+func (p *LocalProvider) Deploy(ctx context.Context, req *client.DeployRequest) (*client.DeployResponse, error) {
+	return p.deploy(ctx, req, false)
+}
+
+func (p *LocalProvider) Preview(ctx context.Context, req *client.DeployRequest) (*client.DeployResponse, error) {
+	return p.deploy(ctx, req, true)
+}
+
+func (p *LocalProvider) deploy(ctx context.Context, req *client.DeployRequest, preview bool) (*client.DeployResponse, error) {
+	// req.Compose is the fixed-up project; build contexts are local paths, because there's nothing to upload
+	project, err := compose.LoadFromContent(ctx, req.Compose, "")
+	if err != nil {
+		return nil, err
+	}
+	composeYaml, err := localCompose(project)
+	if err != nil {
+		return nil, err
+	}
+
+	etag := types.NewEtag()
+	serviceInfos := make([]*defangv1.ServiceInfo, 0, len(project.Services))
+	for _, name := range slices.Sorted(maps.Keys(project.Services)) {
+		serviceInfos = append(serviceInfos, &defangv1.ServiceInfo{
+			Service:     &defangv1.Service{Name: name},
+			Project:     project.Name,
+			Etag:        etag,
+			State:       defangv1.ServiceState_DEPLOYMENT_PENDING,
+			PrivateFqdn: p.ServicePrivateDNS(name),
+		})
+	}
+	resp := &client.DeployResponse{DeployResponse: &defangv1.DeployResponse{Services: serviceInfos, Etag: etag}}
+	if preview {
+		term.Println(string(composeYaml))
+		return resp, nil
+	}
+
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(p.projectDir(project.Name), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p.composePath(project.Name), composeYaml, 0600); err != nil {
+		return nil, err
+	}
+
+	// Environment variables without a value are taken from the environment of `compose`, so pass the config there
+	configs, err := p.configStore(project.Name).load()
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, 0, len(configs))
+	for name, value := range configs {
+		env = append(env, name+"="+value)
+	}
+	if err := engine.Run(ctx, env, p.composeArgs(project.Name, "up", "--detach", "--build", "--remove-orphans")...); err != nil {
+		return nil, err
+	}
+
+	data, err := proto.Marshal(&defangv1.ProjectUpdate{
+		Compose:  req.Compose,
+		Etag:     etag,
+		Mode:     req.Mode,
+		Provider: client.ProviderLocal.Value(),
+		Recipe:   req.Recipe,
+		Services: serviceInfos,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p.projectUpdatePath(project.Name), data, 0600); err != nil {
+		return nil, err
+	}
+
+	// Report the states and published ports of the containers that were just started
+	if containers, err := p.ps(ctx, project.Name); err != nil {
+		term.Debug("Failed to get container states:", err)
+	} else {
+		states := servicesFromPs(project.Name, etag, containers)
+		for _, info := range serviceInfos {
+			if i := slices.IndexFunc(states, func(s *defangv1.ServiceInfo) bool { return s.Service.Name == info.Service.Name }); i >= 0 {
+				info.State = states[i].State
+				info.Status = states[i].Status
+				info.Endpoints = states[i].Endpoints
+			}
+		}
+	}
+	return resp, nil
+}
+
+// localCompose returns the Compose file to run locally: without Railpack
+// builds, which need the CD, and with the scheduled services in a profile.
+func localCompose(project *compose.Project) ([]byte, error) {
+	for name, service := range project.Services {
+		if service.Build != nil && service.Build.Dockerfile == compose.RAILPACK {
+			return nil, fmt.Errorf("service %q: building without a Dockerfile is not supported by the local provider", name)
+		}
+		if _, ok := service.Extensions[compose.ScheduleExtension]; ok {
+			term.Warnf("service %q: scheduled services are not run by the local provider", name)
+			service.Profiles = append(service.Profiles, scheduledProfile)
+			project.Services[name] = service
+		}
+	}
+	return compose.MarshalYAML(project)
+}
+
+func (p *LocalProvider) GetDeploymentStatus(ctx context.Context) (bool, error) {
+	return true, io.EOF // `compose up --detach` returns when the containers are started
+}
+
+func (p *LocalProvider) GetProjectUpdate(ctx context.Context, projectName string) (*defangv1.ProjectUpdate, error) {
+	if projectName == "" {
+		return nil, client.ErrNotExist
+	}
+	data, err := os.ReadFile(p.projectUpdatePath(projectName))
+	if err != nil {
+		return nil, err // fs.ErrNotExist is client.ErrNotExist
+	}
+	var projUpdate defangv1.ProjectUpdate
+	if err := proto.Unmarshal(data, &projUpdate); err != nil {
+		return nil, err
+	}
+	return &projUpdate, nil
+}
+
+func (p *LocalProvider) etag(projectName string) types.ETag {
+	projUpdate, err := p.GetProjectUpdate(context.Background(), projectName)
+	if err != nil {
+		return ""
+	}
+	return projUpdate.Etag
+}
+
+func (p *LocalProvider) ps(ctx context.Context, projectName string) ([]psEntry, error) {
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+	out, err := engine.Output(ctx, nil, p.composeArgs(projectName, "ps", "--all", "--format", "json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parsePs(out)
+}
+
+// servicesFromPs aggregates the containers of each service; the state of a
+// service is the worst state of its replicas.
+func servicesFromPs(projectName string, etag types.ETag, containers []psEntry) []*defangv1.ServiceInfo {
+	services := map[string]*defangv1.ServiceInfo{}
+	for _, container := range containers {
+		info, ok := services[container.Service]
+		if !ok {
+			info = &defangv1.ServiceInfo{
+				Service:     &defangv1.Service{Name: container.Service},
+				Project:     projectName,
+				Etag:        etag,
+				PrivateFqdn: container.Service,
+			}
+			services[container.Service] = info
+		}
+		state := container.containerState()
+		if worseState(info.State, state) == state {
+			info.State = state
+			info.Status = strings.TrimSpace(container.State + " " + container.Health)
+			if container.State == "exited" {
+				info.Status += " (" + strconv.Itoa(container.ExitCode) + ")"
+			}
+		}
+		for _, endpoint := range container.endpoints() {
+			if !slices.Contains(info.Endpoints, endpoint) {
+				info.Endpoints = append(info.Endpoints, endpoint)
+			}
+		}
+	}
+	return slices.SortedFunc(maps.Values(services), func(a, b *defangv1.ServiceInfo) int {
+		return cmp.Compare(a.Service.Name, b.Service.Name)
+	})
+}
+
+func (p *LocalProvider) GetServices(ctx context.Context, req *defangv1.GetServicesRequest) (*defangv1.GetServicesResponse, error) {
+	if req.Project == "" {
+		return nil, errors.New("project name is required by the local provider")
+	}
+	containers, err := p.ps(ctx, req.Project)
+	if err != nil {
+		return nil, err
+	}
+	return &defangv1.GetServicesResponse{
+		Project:  req.Project,
+		Services: servicesFromPs(req.Project, p.etag(req.Project), containers),
+	}, nil
+}
+
+func (p *LocalProvider) GetService(ctx context.Context, req *defangv1.GetRequest) (*defangv1.ServiceInfo, error) {
+	resp, err := p.GetServices(ctx, &defangv1.GetServicesRequest{Project: req.Project})
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range resp.Services {
+		if info.Service.Name == req.Name {
+			return info, nil
+		}
+	}
+	return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("service %q not found", req.Name))
+}
+
+func (p *LocalProvider) PutConfig(ctx context.Context, req *defangv1.PutConfigRequest) error {
+	store := p.configStore(req.Project)
+	configs, err := store.load()
+	if err != nil {
+		return err
+	}
+	configs[req.Name] = req.Value
+	return store.save(configs)
+}
+
+func (p *LocalProvider) DeleteConfig(ctx context.Context, req *defangv1.Secrets) error {
+	store := p.configStore(req.Project)
+	configs, err := store.load()
+	if err != nil {
+		return err
+	}
+	for _, name := range req.Names {
+		if _, ok := configs[name]; !ok {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("config %q not found", name))
+		}
+		delete(configs, name)
+	}
+	return store.save(configs)
+}
+
+func (p *LocalProvider) ListConfig(ctx context.Context, req *defangv1.ListConfigsRequest) (*defangv1.Secrets, error) {
+	configs, err := p.configStore(req.Project).load()
+	if err != nil {
+		return nil, err
+	}
+	return &defangv1.Secrets{Names: slices.Sorted(maps.Keys(configs)), Project: req.Project}, nil
+}
+
+func (p *LocalProvider) QueryLogs(ctx context.Context, req *defangv1.TailRequest) (iter.Seq2[*defangv1.TailResponse, error], error) {
+	if logType := logs.LogType(req.LogType); logType != logs.LogTypeUnspecified && !logType.Has(logs.LogTypeRun) {
+		return func(yield func(*defangv1.TailResponse, error) bool) {}, nil // there are no CD or build logs
+	}
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+
+	args := p.composeArgs(req.Project, "logs", "--no-color", "--timestamps")
+	if req.Follow {
+		args = append(args, "--follow")
+	}
+	if req.Since.IsValid() {
+		args = append(args, "--since", req.Since.AsTime().Format(time.RFC3339Nano))
+	}
+	if req.Until.IsValid() {
+		args = append(args, "--until", req.Until.AsTime().Format(time.RFC3339Nano))
+	}
+	if req.Limit > 0 {
+		args = append(args, "--tail", strconv.FormatUint(uint64(req.Limit), 10))
+	}
+	args = append(args, req.Services...)
+
+	etag := p.etag(req.Project)
+	stdout, err := engine.Stream(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(*defangv1.TailResponse, error) bool) {
+		defer stdout.Close()
+		err := scanLines(stdout, func(line string) bool {
+			entry := parseLogLine(line)
+			if req.Pattern != "" && !strings.Contains(entry.Message, req.Pattern) {
+				return true
+			}
+			entry.Etag = etag
+			return yield(&defangv1.TailResponse{
+				Entries: []*defangv1.LogEntry{entry},
+				Service: entry.Service,
+				Etag:    etag,
+				Host:    entry.Host,
+			}, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}, nil
+}
+
+func (p *LocalProvider) Subscribe(ctx context.Context, req *defangv1.SubscribeRequest) (iter.Seq2[*defangv1.SubscribeResponse, error], error) {
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+
+	// Start watching the events before getting the current states, so we don't miss any changes
+	stdout, err := engine.Stream(ctx, "events", "--format", "{{json .}}", "--filter", "type=container", "--filter", "label=com.docker.compose.project="+req.Project)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := p.ps(ctx, req.Project)
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+
+	healthchecked := p.healthchecked(ctx, req.Project)
+	wanted := func(service string) bool {
+		return len(req.Services) == 0 || slices.Contains(req.Services, service)
+	}
+	return func(yield func(*defangv1.SubscribeResponse, error) bool) {
+		defer stdout.Close()
+		for _, info := range servicesFromPs(req.Project, req.Etag, containers) {
+			if !wanted(info.Service.Name) {
+				continue
+			}
+			if !yield(&defangv1.SubscribeResponse{Service: info, Name: info.Service.Name, Status: info.Status, State: info.State}, nil) {
+				return
+			}
+		}
+		err := scanLines(stdout, func(line string) bool {
+			var ev event
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				term.Debugf("Ignoring invalid event %q: %v", line, err)
+				return true
+			}
+			name := ev.service()
+			if name == "" || !wanted(name) {
+				return true
+			}
+			state, status := ev.serviceState(healthchecked[name])
+			return yield(&defangv1.SubscribeResponse{Name: name, Status: status, State: state}, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}, nil
+}
+
+// healthchecked returns the services of the deployed project that have a healthcheck.
+func (p *LocalProvider) healthchecked(ctx context.Context, projectName string) map[string]bool {
+	healthchecked := map[string]bool{}
+	data, err := os.ReadFile(p.composePath(projectName))
+	if err != nil {
+		return healthchecked
+	}
+	project, err := compose.LoadFromContent(ctx, data, projectName)
+	if err != nil {
+		term.Debug("Failed to load the deployed project:", err)
+		return healthchecked
+	}
+	for name, service := range project.Services {
+		healthchecked[name] = service.HealthCheck != nil && !service.HealthCheck.Disable
+	}
+	return healthchecked
+}
+
+func (p *LocalProvider) CdCommand(ctx context.Context, req client.CdCommandRequest) (*client.CdCommandResponse, error) {
+	if req.Command != client.CdCommandDown && req.Command != client.CdCommandDestroy {
+		return nil, fmt.Errorf("the CD command %q is not supported by the local provider", req.Command)
+	}
+	engine, err := p.engine()
+	if err != nil {
+		return nil, err
+	}
+	args := p.composeArgs(req.Project, "down", "--remove-orphans")
+	if req.Command == client.CdCommandDestroy {
+		args = append(args, "--volumes") // like the managed storage in the cloud, volumes are deleted
+	}
+	if err := engine.Run(ctx, nil, args...); err != nil {
+		return nil, err
+	}
+	// Keep the config, like the cloud providers do, but forget the deployment
+	if err := os.Remove(p.projectUpdatePath(req.Project)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &client.CdCommandResponse{ETag: types.NewEtag()}, nil
+}
+
+// CdList returns the projects with a current deployment.
+func (p *LocalProvider) CdList(ctx context.Context, _ bool) (iter.Seq[byocState.Info], error) {
+	entries, err := os.ReadDir(p.stackDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return func(yield func(byocState.Info) bool) {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if _, err := os.Stat(p.projectUpdatePath(entry.Name())); err != nil {
+				continue
+			}
+			if !yield(byocState.Info{Project: entry.Name(), Stack: p.stack, Workspace: "local"}) {
+				return
+			}
+		}
+	}, nil
+}
+
+func (p *LocalProvider) RemoteProjectName(ctx context.Context) (string, error) {
+	list, err := p.CdList(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	var projectNames []string
+	for info := range list {
+		projectNames = append(projectNames, info.Project)
+	}
+	switch len(projectNames) {
+	case 0:
+		return "", errors.New("no local projects found; use --project-name to specify the project")
+	case 1:
+		term.Debug("Using default local project:", projectNames[0])
+		return projectNames[0], nil
+	default:
+		return "", fmt.Errorf("multiple local projects found: %v; use --project-name to specify the project", projectNames)
+	}
+}
+
+func (*LocalProvider) CreateUploadURL(ctx context.Context, req *defangv1.UploadURLRequest) (*defangv1.UploadURLResponse, error) {
+	return nil, errors.New("the local provider builds from the local files; there is nothing to upload")
+}
+
+func (*LocalProvider) HasDelegatedSubdomain() bool {
+	return false
+}
+
+func (*LocalProvider) PrepareDomainDelegation(ctx context.Context, req client.PrepareDomainDelegationRequest) (*client.PrepareDomainDelegationResponse, error) {
+	return nil, nil // the local provider doesn't support delegate domains
+}
+
+func (*LocalProvider) ServicePrivateDNS(name string) string {
+	return name // the service name resolves on the Compose network
+}
+
+func (*LocalProvider) ServicePublicDNS(name string, projectName string) string {
+	return "localhost"
+}
+
+func (*LocalProvider) UpdateShardDomain(ctx context.Context) error {
+	return nil
+}
+
+func (*LocalProvider) SetCanIUseConfig(*defangv1.CanIUseResponse) {}
+
+func (*LocalProvider) SetUpCD(ctx context.Context, force bool) error {
+	return nil // there's no CD to set up
+}
+
+func (*LocalProvider) TearDownCD(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,386 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/tokenstore"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEngine returns canned output by the engine or compose subcommand, like "ps" or "events".
+type fakeEngine struct {
+	outputs map[string]string
+	calls   [][]string
+	envs    [][]string
+}
+
+func verb(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "compose":
+		case "--project-name", "--file":
+			i++
+		default:
+			return args[i]
+		}
+	}
+	return ""
+}
+
+func (f *fakeEngine) Name() string {
+	return "fake"
+}
+
+func (f *fakeEngine) Output(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, args)
+	f.envs = append(f.envs, env)
+	return []byte(f.outputs[verb(args)]), nil
+}
+
+func (f *fakeEngine) Run(ctx context.Context, env []string, args ...string) error {
+	_, err := f.Output(ctx, env, args...)
+	return err
+}
+
+func (f *fakeEngine) Stream(ctx context.Context, args ...string) (io.ReadCloser, error) {
+	out, err := f.Output(ctx, nil, args...)
+	return io.NopCloser(bytes.NewReader(out)), err
+}
+
+func (f *fakeEngine) call(name string) []string {
+	if i := slices.IndexFunc(f.calls, func(args []string) bool { return verb(args) == name }); i >= 0 {
+		return f.calls[i]
+	}
+	return nil
+}
+
+func (f *fakeEngine) env(name string) []string {
+	if i := slices.IndexFunc(f.calls, func(args []string) bool { return verb(args) == name }); i >= 0 {
+		return f.envs[i]
+	}
+	return nil
+}
+
+// fakeKeyring is a keyStore like the OS keyring.
+type fakeKeyring struct {
+	keys map[string]string
+	err  error // if set, the keyring is not available
+}
+
+func (k *fakeKeyring) Load(key string) (string, error) {
+	if k.err != nil {
+		return "", k.err
+	}
+	value, ok := k.keys[key]
+	if !ok {
+		return "", tokenstore.ErrKeyringNotFound
+	}
+	return value, nil
+}
+
+func (k *fakeKeyring) Save(key, value string) error {
+	if k.err != nil {
+		return k.err
+	}
+	k.keys[key] = value
+	return nil
+}
+
+func newTestProvider(t *testing.T, engine *fakeEngine) *LocalProvider {
+	t.Helper()
+	t.Setenv("DEFANG_LOCAL_CONFIG_KEY", "")
+	return &LocalProvider{Engine: engine, StateDir: t.TempDir(), Keys: &fakeKeyring{keys: map[string]string{}}, stack: "beta"}
+}
+
+const psOutput = `{"Name":"app-web-1","Service":"web","State":"running","Health":"","ExitCode":0,"Publishers":[{"URL":"0.0.0.0","TargetPort":80,"PublishedPort":8080,"Protocol":"tcp"},{"URL":"::","TargetPort":80,"PublishedPort":8080,"Protocol":"tcp"}]}
+{"Name":"app-web-2","Service":"web","State":"running","Health":"starting","ExitCode":0,"Publishers":[]}
+{"Name":"app-db-1","Service":"db","State":"running","Health":"healthy","ExitCode":0,"Publishers":null}
+{"Name":"app-migrate-1","Service":"migrate","State":"exited","Health":"","ExitCode":1,"Publishers":null}
+`
+
+func TestConfigKey(t *testing.T) {
+	t.Run("legacy key file", func(t *testing.T) {
+		p := newTestProvider(t, &fakeEngine{})
+		legacyKey := bytes.Repeat([]byte{7}, 32)
+		require.NoError(t, os.WriteFile(filepath.Join(p.StateDir, "config.key"), legacyKey, 0600))
+
+		key, err := p.configStore("app").key()
+		require.NoError(t, err)
+		assert.Equal(t, legacyKey, key)
+		assert.NoFileExists(t, filepath.Join(p.StateDir, "config.key"), "the key is moved into the keyring")
+		assert.Equal(t, hex.EncodeToString(legacyKey), p.Keys.(*fakeKeyring).keys[configKeyName])
+	})
+
+	t.Run("keyring not available", func(t *testing.T) {
+		p := newTestProvider(t, &fakeEngine{})
+		p.Keys = &fakeKeyring{err: tokenstore.ErrKeyringUnavailable}
+		_, err := p.configStore("app").key()
+		require.ErrorContains(t, err, "DEFANG_LOCAL_CONFIG_KEY")
+
+		t.Setenv("DEFANG_LOCAL_CONFIG_KEY", "secret")
+		_, err = p.configStore("app").key()
+		require.NoError(t, err)
+	})
+}
+
+func TestConfig(t *testing.T) {
+	p := newTestProvider(t, &fakeEngine{})
+	ctx := t.Context()
+
+	require.NoError(t, p.PutConfig(ctx, &defangv1.PutConfigRequest{Project: "app", Name: "PASSWORD", Value: "hunter2"}))
+	require.NoError(t, p.PutConfig(ctx, &defangv1.PutConfigRequest{Project: "app", Name: "API_KEY", Value: "s3cr3t"}))
+
+	secrets, err := p.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: "app"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"API_KEY", "PASSWORD"}, secrets.Names)
+
+	data, err := os.ReadFile(filepath.Join(p.StateDir, "beta", "app", "config.enc"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.NotContains(t, string(data), "PASSWORD")
+
+	assert.NoFileExists(t, filepath.Join(p.StateDir, "config.key"), "the key is not kept next to the config")
+	assert.Contains(t, p.Keys.(*fakeKeyring).keys, configKeyName)
+
+	require.NoError(t, p.DeleteConfig(ctx, &defangv1.Secrets{Project: "app", Names: []string{"API_KEY"}}))
+	err = p.DeleteConfig(ctx, &defangv1.Secrets{Project: "app", Names: []string{"API_KEY"}})
+	assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+	configs, err := p.configStore("app").load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"PASSWORD": "hunter2"}, configs)
+
+	t.Run("other project", func(t *testing.T) {
+		secrets, err := p.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: "other"})
+		require.NoError(t, err)
+		assert.Empty(t, secrets.Names)
+	})
+
+	t.Run("other stack", func(t *testing.T) {
+		other := &LocalProvider{StateDir: p.StateDir, Keys: p.Keys, stack: "prod"}
+		secrets, err := other.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: "app"})
+		require.NoError(t, err)
+		assert.Empty(t, secrets.Names)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		t.Setenv("DEFANG_LOCAL_CONFIG_KEY", "not the key")
+		_, err := p.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: "app"})
+		assert.ErrorContains(t, err, "failed to decrypt")
+	})
+}
+
+func TestParsePs(t *testing.T) {
+	lines, err := parsePs([]byte(psOutput))
+	require.NoError(t, err)
+	require.Len(t, lines, 4)
+
+	array, err := parsePs([]byte(`[{"Service":"web","State":"running"},{"Service":"db","State":"created"}]`))
+	require.NoError(t, err)
+	assert.Len(t, array, 2)
+
+	empty, err := parsePs([]byte("\n"))
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func TestContainerState(t *testing.T) {
+	tests := []struct {
+		container psEntry
+		want      defangv1.ServiceState
+	}{
+		{psEntry{State: "running"}, defangv1.ServiceState_DEPLOYMENT_COMPLETED},
+		{psEntry{State: "running", Health: "healthy"}, defangv1.ServiceState_DEPLOYMENT_COMPLETED},
+		{psEntry{State: "running", Health: "starting"}, defangv1.ServiceState_DEPLOYMENT_PENDING},
+		{psEntry{State: "running", Health: "unhealthy"}, defangv1.ServiceState_DEPLOYMENT_FAILED},
+		{psEntry{State: "created"}, defangv1.ServiceState_DEPLOYMENT_PENDING},
+		{psEntry{State: "restarting"}, defangv1.ServiceState_DEPLOYMENT_PENDING},
+		{psEntry{State: "exited", ExitCode: 0}, defangv1.ServiceState_DEPLOYMENT_COMPLETED},
+		{psEntry{State: "exited", ExitCode: 137}, defangv1.ServiceState_DEPLOYMENT_FAILED},
+		{psEntry{State: "dead", ExitCode: 1}, defangv1.ServiceState_DEPLOYMENT_FAILED},
+		{psEntry{State: "paused"}, defangv1.ServiceState_NOT_SPECIFIED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.container.State+" "+tt.container.Health, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.container.containerState())
+		})
+	}
+}
+
+func TestGetServices(t *testing.T) {
+	p := newTestProvider(t, &fakeEngine{outputs: map[string]string{"ps": psOutput}})
+
+	resp, err := p.GetServices(t.Context(), &defangv1.GetServicesRequest{Project: "app"})
+	require.NoError(t, err)
+	require.Len(t, resp.Services, 3)
+
+	db, migrate, web := resp.Services[0], resp.Services[1], resp.Services[2]
+	assert.Equal(t, "db", db.Service.Name)
+	assert.Equal(t, defangv1.ServiceState_DEPLOYMENT_COMPLETED, db.State)
+	assert.Equal(t, defangv1.ServiceState_DEPLOYMENT_FAILED, migrate.State)
+	assert.Equal(t, "exited (1)", migrate.Status)
+	assert.Equal(t, defangv1.ServiceState_DEPLOYMENT_PENDING, web.State, "one replica is still starting")
+	assert.Equal(t, []string{"localhost:8080"}, web.Endpoints)
+
+	_, err = p.GetService(t.Context(), &defangv1.GetRequest{Project: "app", Name: "nope"})
+	assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+}
+
+const testCompose = `name: app
+services:
+  web:
+    build:
+      context: .
+    environment:
+      PASSWORD: null
+    healthcheck:
+      test: ["CMD", "true"]
+  cleanup:
+    image: alpine
+    command: ["true"]
+    x-defang-schedule: "0 * * * *"
+`
+
+func TestDeploy(t *testing.T) {
+	engine := &fakeEngine{outputs: map[string]string{"ps": psOutput}}
+	p := newTestProvider(t, engine)
+	ctx := t.Context()
+	require.NoError(t, p.PutConfig(ctx, &defangv1.PutConfigRequest{Project: "app", Name: "PASSWORD", Value: "hunter2"}))
+
+	_, err := p.GetProjectUpdate(ctx, "app")
+	require.ErrorIs(t, err, client.ErrNotExist)
+
+	resp, err := p.Deploy(ctx, &client.DeployRequest{DeployRequest: defangv1.DeployRequest{Project: "app", Compose: []byte(testCompose)}})
+	require.NoError(t, err)
+	assert.Len(t, resp.Etag, 12)
+	require.Len(t, resp.Services, 2)
+	assert.Equal(t, "cleanup", resp.Services[0].Service.Name)
+	assert.Equal(t, []string{"localhost:8080"}, resp.Services[1].Endpoints)
+
+	up := engine.call("up")
+	composePath := filepath.Join(p.StateDir, "beta", "app", "compose.yaml")
+	assert.Equal(t, []string{"compose", "--project-name", "app-beta", "--file", composePath, "up", "--detach", "--build", "--remove-orphans"}, up)
+	assert.Contains(t, engine.env("up"), "PASSWORD=hunter2")
+
+	composeYaml, err := os.ReadFile(composePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(composeYaml), scheduledProfile)
+
+	projUpdate, err := p.GetProjectUpdate(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, resp.Etag, projUpdate.Etag)
+	assert.Equal(t, map[string]bool{"web": true}, p.healthchecked(ctx, "app"), "the scheduled service is in an inactive profile")
+
+	list, err := p.CdList(ctx, false)
+	require.NoError(t, err)
+	var projects []string
+	for info := range list {
+		projects = append(projects, info.Project)
+	}
+	assert.Equal(t, []string{"app"}, projects)
+
+	t.Run("down", func(t *testing.T) {
+		resp, err := p.CdCommand(ctx, client.CdCommandRequest{Project: "app", Command: client.CdCommandDestroy})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.ETag)
+		assert.Equal(t, []string{"compose", "--project-name", "app-beta", "--file", composePath, "down", "--remove-orphans", "--volumes"}, engine.call("down"))
+		_, err = p.GetProjectUpdate(ctx, "app")
+		require.ErrorIs(t, err, client.ErrNotExist)
+		secrets, err := p.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: "app"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"PASSWORD"}, secrets.Names, "config is kept")
+	})
+
+	t.Run("railpack", func(t *testing.T) {
+		_, err := p.Deploy(ctx, &client.DeployRequest{DeployRequest: defangv1.DeployRequest{Compose: []byte("name: app\nservices:\n  web:\n    build:\n      context: .\n      dockerfile: '*Railpack'\n")}})
+		assert.ErrorContains(t, err, "not supported by the local provider")
+	})
+}
+
+func TestQueryLogs(t *testing.T) {
+	engine := &fakeEngine{outputs: map[string]string{"logs": `web-1  | 2024-05-01T12:00:00.000000000Z listening on :8080
+web-2  | 2024-05-01T12:00:01.500000000Z GET / 200
+db-1   | no timestamp
+`}}
+	p := newTestProvider(t, engine)
+
+	logs, err := p.QueryLogs(t.Context(), &defangv1.TailRequest{Project: "app", Services: []string{"web", "db"}, Limit: 10, Follow: true})
+	require.NoError(t, err)
+	var entries []*defangv1.LogEntry
+	for resp, err := range logs {
+		require.NoError(t, err)
+		entries = append(entries, resp.Entries...)
+	}
+	assert.Equal(t, []string{"compose", "--project-name", "app-beta", "logs", "--no-color", "--timestamps", "--follow", "--tail", "10", "web", "db"}, engine.call("logs"))
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "web", entries[0].Service)
+	assert.Equal(t, "web-1", entries[0].Host)
+	assert.Equal(t, "listening on :8080", entries[0].Message)
+	assert.Equal(t, int64(1714564800), entries[0].Timestamp.GetSeconds())
+	assert.Equal(t, "web-2", entries[1].Host)
+	assert.Equal(t, "db", entries[2].Service)
+	assert.Equal(t, "no timestamp", entries[2].Message)
+	assert.Nil(t, entries[2].Timestamp)
+
+	t.Run("pattern", func(t *testing.T) {
+		logs, err := p.QueryLogs(t.Context(), &defangv1.TailRequest{Project: "app", Pattern: "GET"})
+		require.NoError(t, err)
+		var messages []string
+		for resp := range logs {
+			messages = append(messages, resp.Entries[0].Message)
+		}
+		assert.Equal(t, []string{"GET / 200"}, messages)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	events := strings.Join([]string{
+		// Docker
+		`{"Type":"container","Action":"create","Actor":{"Attributes":{"com.docker.compose.service":"web"}}}`,
+		`{"Type":"container","Action":"start","Actor":{"Attributes":{"com.docker.compose.service":"web"}}}`,
+		`{"Type":"container","Action":"health_status: healthy","Actor":{"Attributes":{"com.docker.compose.service":"web"}}}`,
+		`{"Type":"container","Action":"die","Actor":{"Attributes":{"com.docker.compose.service":"migrate","exitCode":"1"}}}`,
+		`not json`,
+		// Podman
+		`{"Type":"container","Status":"health_status","HealthStatus":"unhealthy","Attributes":{"com.docker.compose.service":"db"}}`,
+		`{"Type":"container","Status":"died","Attributes":{"com.docker.compose.service":"other"}}`,
+	}, "\n")
+	engine := &fakeEngine{outputs: map[string]string{"ps": psOutput, "events": events}}
+	p := newTestProvider(t, engine)
+	require.NoError(t, os.MkdirAll(filepath.Join(p.StateDir, "beta", "app"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(p.StateDir, "beta", "app", "compose.yaml"), []byte(testCompose), 0600))
+
+	updates, err := p.Subscribe(t.Context(), &defangv1.SubscribeRequest{Project: "app", Services: []string{"web", "db", "migrate"}})
+	require.NoError(t, err)
+	var got []string
+	for resp, err := range updates {
+		require.NoError(t, err)
+		got = append(got, resp.Name+" "+resp.State.String()+" "+resp.Status)
+	}
+	assert.Equal(t, []string{
+		// from ps
+		"db DEPLOYMENT_COMPLETED running healthy",
+		"migrate DEPLOYMENT_FAILED exited (1)",
+		"web DEPLOYMENT_PENDING running starting",
+		// from events
+		"web DEPLOYMENT_PENDING create",
+		"web DEPLOYMENT_PENDING start", // web has a healthcheck
+		"web DEPLOYMENT_COMPLETED health_status: healthy",
+		"migrate DEPLOYMENT_FAILED exited with code 1",
+		"db DEPLOYMENT_FAILED health_status: unhealthy",
+	}, got)
+	assert.Contains(t, engine.call("events"), "label=com.docker.compose.project=app")
+}
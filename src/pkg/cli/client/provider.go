@@ -116,6 +116,25 @@ type Provider interface {
 	TearDownCD(context.Context) error
 }
 
+// OfflineProvider is implemented by providers that deploy without the Fabric
+// or a cloud account, like the local provider. The CLI skips the Fabric calls
+// that only apply to cloud deployments, like delegated domains and uploads.
+type OfflineProvider interface {
+	Offline() bool
+}
+
+func IsOffline(provider Provider) bool {
+	offline, ok := provider.(OfflineProvider)
+	return ok && offline.Offline()
+}
+
+// ConfigVersioner is implemented by providers that can report a version of
+// each config of a project, which changes whenever the value is set, so that
+// changed values can be detected without reading them.
+type ConfigVersioner interface {
+	GetConfigVersions(context.Context, *defangv1.ListConfigsRequest) (map[string]string, error)
+}
+
 type Loader interface {
 	LoadProject(context.Context) (*composeTypes.Project, error)
 	LoadProjectName(context.Context) (string, bool, error) // true = name from loaded project
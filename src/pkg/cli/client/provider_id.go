@@ -16,6 +16,7 @@ const (
 	ProviderDefang ProviderID = "defang"
 	ProviderDO     ProviderID = "digitalocean"
 	ProviderGCP    ProviderID = "gcp"
+	ProviderLocal  ProviderID = "local"
 )
 
 var allProviders = []ProviderID{
@@ -25,10 +26,11 @@ var allProviders = []ProviderID{
 	ProviderDO,
 	ProviderGCP,
 	ProviderAzure,
+	ProviderLocal,
 }
 
 func ByocProviders() []ProviderID {
-	return allProviders[2:] // skip "auto" and "defang"
+	return allProviders[2 : len(allProviders)-1] // skip "auto", "defang" and "local"
 }
 
 func (p ProviderID) String() string {
@@ -49,6 +51,8 @@ func (p ProviderID) Name() string {
 		return "DigitalOcean"
 	case ProviderGCP:
 		return "Google Cloud Platform"
+	case ProviderLocal:
+		return "Local"
 	default:
 		return p.String()
 	}
@@ -56,6 +56,12 @@ func TestProvider(t *testing.T) {
 			want:     ProviderAWS,
 			wantErr:  false,
 		},
+		{
+			name:     "valid provider local",
+			provider: "local",
+			want:     ProviderLocal,
+			wantErr:  false,
+		},
 		{
 			name:     "valid provider auto",
 			provider: "auto",
@@ -83,4 +89,9 @@ func TestAllProviders(t *testing.T) {
 	if allProviders[0] != ProviderAuto {
 		t.Errorf("allProviders[0] = %v, want %v", allProviders[0], ProviderAuto)
 	}
+	for _, provider := range ByocProviders() {
+		if provider == ProviderAuto || provider == ProviderDefang || provider == ProviderLocal {
+			t.Errorf("ByocProviders() contains %v", provider)
+		}
+	}
 }
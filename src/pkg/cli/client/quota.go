@@ -0,0 +1,44 @@
+package client
+
+import "context"
+
+// QuotaDemand is the capacity a project needs from its cloud provider, summed
+// over all replicas of its compute services.
+type QuotaDemand struct {
+	Cpus          float64
+	MemoryMiB     float64
+	Gpus          int
+	PublicIPs     int // replicas with host-mode ports
+	LoadBalancers int
+}
+
+// QuotaUsage is a cloud quota that applies to the demand of a project. Used is
+// negative when the provider does not report the current usage.
+type QuotaUsage struct {
+	Name        string
+	Region      string
+	Requested   float64
+	Used        float64
+	Limit       float64
+	IncreaseURL string
+}
+
+// Exceeded is true when the demand can never fit in the quota.
+func (q QuotaUsage) Exceeded() bool {
+	return q.Requested > q.Limit
+}
+
+// Available is the part of the quota that is not in use, or the whole quota
+// when the usage is unknown.
+func (q QuotaUsage) Available() float64 {
+	if q.Used < 0 {
+		return q.Limit
+	}
+	return max(q.Limit-q.Used, 0)
+}
+
+// QuotaChecker is implemented by providers that can look up the live service
+// quotas of the account, so deployments can fail before the CD task starts.
+type QuotaChecker interface {
+	GetQuotaUsage(ctx context.Context, demand QuotaDemand) ([]QuotaUsage, error)
+}
@@ -22,7 +22,7 @@ func GetRegion(provider ProviderID) string {
 		defaultRegion = RegionDefaultGCP
 	case ProviderDO:
 		defaultRegion = RegionDefaultDO
-	case ProviderDefang, ProviderAuto:
+	case ProviderDefang, ProviderAuto, ProviderLocal:
 		return ""
 	default:
 		panic("unsupported provider")
@@ -47,7 +47,7 @@ func GetRegionVarName(provider ProviderID) string {
 		return GCPRegionEnvVar
 	case ProviderDO:
 		return "REGION"
-	case ProviderDefang, ProviderAuto:
+	case ProviderDefang, ProviderAuto, ProviderLocal:
 		return ""
 	default:
 		panic("unsupported provider")
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"errors"
+)
+
+// StateStore is implemented by BYOC providers that keep the Pulumi state of
+// their stacks in a bucket or blob container, so the state can be inspected
+// and repaired without running the CD task.
+type StateStore interface {
+	GetStateObject(ctx context.Context, key string) ([]byte, error)
+	PutStateObject(ctx context.Context, key string, data []byte) error
+}
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// LockStore is implemented by BYOC providers that can keep deploy locks in
+// their CD storage. The version of an object is an opaque token, like an ETag
+// or generation, that changes on every write.
+type LockStore interface {
+	// GetLockObject returns ErrNotExist if the object does not exist.
+	GetLockObject(ctx context.Context, key string) (data []byte, version string, err error)
+	// PutLockObject writes the object only if its current version is version,
+	// or if it does not exist when version is empty, and returns the new
+	// version; otherwise it returns ErrPreconditionFailed.
+	PutLockObject(ctx context.Context, key string, data []byte, version string) (string, error)
+	// DeleteLockObject deletes the object only if its current version is
+	// version, or unconditionally when version is empty.
+	DeleteLockObject(ctx context.Context, key string, version string) error
+	// IsCdTaskDone returns whether the CD task with the given ID, like the
+	// CdId of a DeployResponse, has exited; the deploy lock is handed off to it.
+	IsCdTaskDone(ctx context.Context, cdID string) (bool, error)
+}
+
+// DeployLockKey is the key of the deploy lock of a stack in the LockStore.
+func DeployLockKey(projectName, stackName string) string {
+	return "locks/" + projectName + "/" + stackName + ".json"
+}
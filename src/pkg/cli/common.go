@@ -65,7 +65,7 @@ func putDeploymentAndStack(ctx context.Context, provider client.Provider, fabric
 	now := timestamppb.Now()
 
 	if req.Action == defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP {
-		stackFile, err := stacks.Marshal(stack)
+		stackFile, err := stacks.MarshalResolved(stack)
 		if err != nil {
 			return err
 		}
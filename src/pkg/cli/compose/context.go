@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -201,15 +202,7 @@ func getRemoteBuildContext(ctx context.Context, provider client.Provider, projec
 		return "", fmt.Errorf("invalid build context: %w", err) // already checked in ValidateProject
 	}
 
-	var archiveType ArchiveType
-	if build.Dockerfile == RAILPACK {
-		// If we have a Railpack build, we use a zip archive
-		archiveType = ArchiveTypeZip
-	} else {
-		// We use gzip tar for all other builds
-		archiveType = ArchiveTypeGzip
-	}
-
+	archiveType := getArchiveType(build)
 	switch upload {
 	case UploadModeIgnore:
 		// `compose config`, ie. dry-run: don't upload the archive, just return the path as-is
@@ -245,6 +238,49 @@ func getRemoteBuildContext(ctx context.Context, provider client.Provider, projec
 	return uploadArchive(ctx, provider, projectName, buffer, archiveType, digest)
 }
 
+func getArchiveType(build *types.BuildConfig) ArchiveType {
+	if build.Dockerfile == RAILPACK {
+		// If we have a Railpack build, we use a zip archive
+		return ArchiveTypeZip
+	}
+	// We use gzip tar for all other builds
+	return ArchiveTypeGzip
+}
+
+// BuildContextDigest returns the digest of the archive of the build context,
+// like the one that is uploaded for a deployment, without uploading it.
+func BuildContextDigest(ctx context.Context, build *types.BuildConfig) (string, error) {
+	buffer, err := createArchive(ctx, build.Context, build.Dockerfile, getArchiveType(build))
+	if err != nil {
+		return "", err
+	}
+	return calcDigest(buffer.Bytes()), nil
+}
+
+var ErrBuildContextChanged = errors.New("the build context changed")
+
+// UploadBuildContext packages and uploads the build context like a deployment
+// does, but returns ErrBuildContextChanged if the archive does not have the
+// given digest, so that the uploaded files are the ones that were reviewed.
+func UploadBuildContext(ctx context.Context, provider client.Provider, projectName, service string, build *types.BuildConfig, upload UploadMode, digest string) (string, error) {
+	archiveType := getArchiveType(build)
+	term.Info("Packaging the project files for", service, "at", build.Context)
+	buffer, err := createArchive(ctx, build.Context, build.Dockerfile, archiveType)
+	if err != nil {
+		return "", err
+	}
+	if actual := calcDigest(buffer.Bytes()); actual != digest {
+		term.Debugf("Digest for %q: %s, expected %s", service, actual, digest)
+		return "", fmt.Errorf("service %q: %w", service, ErrBuildContextChanged)
+	}
+	if upload == UploadModeForce {
+		digest = "" // always upload the tarball (to a random URL), triggering a new build
+	}
+
+	term.Info("Uploading the project files for", service)
+	return uploadArchive(ctx, provider, projectName, buffer, archiveType, digest)
+}
+
 func calcDigest(data []byte) string {
 	sha := sha256.Sum256(data)
 	return "sha256-" + base64.StdEncoding.EncodeToString(sha[:]) // same as Nix
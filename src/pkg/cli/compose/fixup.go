@@ -147,7 +147,7 @@ func FixupServices(ctx context.Context, provider client.Provider, project *compo
 				}
 			}
 
-			if !strings.Contains(svccfg.Build.Context, "://") {
+			if !strings.Contains(svccfg.Build.Context, "://") && !client.IsOffline(provider) {
 				// Pack the build context into a Archive and upload
 				url, err := getRemoteBuildContext(ctx, provider, project.Name, svccfg.Name, svccfg.Build, upload)
 				if err != nil {
@@ -105,7 +105,9 @@ func NewLoaderFromOptions(options LoaderOptions) *Loader {
 	// If no --project-name is provided, try to get it from the environment
 	// https://docs.docker.com/compose/project-name/#set-a-project-name
 	if options.ProjectName == "" {
-		if envProjName, ok := os.LookupEnv("COMPOSE_PROJECT_NAME"); ok {
+		if envProjName, ok := options.InterpolationEnv["COMPOSE_PROJECT_NAME"]; ok {
+			options.ProjectName = envProjName
+		} else if envProjName, ok := os.LookupEnv("COMPOSE_PROJECT_NAME"); ok {
 			options.ProjectName = envProjName
 		}
 	}
@@ -197,12 +199,12 @@ func (l *Loader) newProjectOptions(suppressWarn bool) (*cli.ProjectOptions, erro
 
 	// The explicit --env-file(s) win; otherwise fall back to COMPOSE_ENV_FILES,
 	// symmetric to how ConfigPaths overrides COMPOSE_FILE (cli.WithConfigFileEnv)
-	// below. Reading the env var here (at load time) rather than up front is what
-	// lets a value injected by the selected stack file (via LoadStackEnv) take
-	// effect, since the stack env is applied before the project is loaded.
+	// below. Reading it from the interpolation env rather than up front is what
+	// lets a value from the selected stack file take effect, whether it was
+	// applied to the process env (LoadStackEnv) or passed to the loader.
 	envFiles := l.options.EnvFiles
 	if len(envFiles) == 0 {
-		if v := os.Getenv(composeEnvFilesEnvVar); v != "" {
+		if v := interpolationEnv[composeEnvFilesEnvVar]; v != "" {
 			envFiles = strings.Split(v, ",")
 		}
 	}
@@ -0,0 +1,18 @@
+package compose
+
+import "errors"
+
+// ScheduleExtension would turn a service into a job that runs on a schedule:
+//
+//	x-defang-schedule: "0 3 * * *"
+const ScheduleExtension = "x-defang-schedule"
+
+// ErrScheduleUnsupported is returned by ValidateProject for scheduled services
+// until the CD creates the EventBridge, Cloud Scheduler or Container Apps schedules.
+var ErrScheduleUnsupported = errors.New(ScheduleExtension + " is not supported yet; remove it to deploy the service")
+
+// IsScheduledService reports whether the service has a x-defang-schedule.
+func IsScheduledService(service *ServiceConfig) bool {
+	_, ok := service.Extensions[ScheduleExtension]
+	return ok
+}
@@ -243,6 +243,11 @@ func validateService(svccfg *composeTypes.ServiceConfig, project *composeTypes.P
 		}
 	}
 
+	// The CD doesn't create the schedule yet, so the job would be deployed as a service that restarts in a loop
+	if IsScheduledService(svccfg) {
+		return fmt.Errorf("service %q: %w", svccfg.Name, ErrScheduleUnsupported)
+	}
+
 	err := validatePorts(svccfg.Ports)
 	if err != nil {
 		return fmt.Errorf("service %q: %w", svccfg.Name, err)
@@ -492,6 +497,29 @@ func IsReservedConfigName(name string) bool {
 	return reservedConfigNames[name]
 }
 
+// ProjectConfigNames returns the sorted names of the configs that the services
+// of the project need: environment variables without a value, and variables
+// interpolated in environment values.
+func ProjectConfigNames(composeProject *composeTypes.Project) []string {
+	var names []string
+	for _, service := range composeProject.Services {
+		for key, value := range service.Environment {
+			if value == nil {
+				names = append(names, key)
+				continue
+			}
+			detectedNames := DetectInterpolationVariables(*value)
+			names = append(names, detectedNames...)
+		}
+	}
+
+	// Deduplicate (sort + uniq)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	// Auto-populated by Defang/compose-go; not user-provided config
+	return slices.DeleteFunc(names, IsReservedConfigName)
+}
+
 func ValidateProjectConfig(composeProject *composeTypes.Project, listConfigNames []string) error {
 	var modelInterpolations ErrConfigInterpolationInModels
 	for _, model := range composeProject.Models {
@@ -510,32 +538,8 @@ func ValidateProjectConfig(composeProject *composeTypes.Project, listConfigNames
 		return slices.Compact(modelInterpolations)
 	}
 
-	var names []string
-	// make list of secrets
-	for _, service := range composeProject.Services {
-		for key, value := range service.Environment {
-			if value == nil {
-				names = append(names, key)
-				continue
-			}
-			detectedNames := DetectInterpolationVariables(*value)
-			names = append(names, detectedNames...)
-		}
-	}
-
-	if len(names) == 0 {
-		return nil // no secrets to check
-	}
-
-	// Deduplicate (sort + uniq)
-	slices.Sort(names)
-	names = slices.Compact(names)
-
 	errMissingConfig := ErrMissingConfig{}
-	for _, name := range names {
-		if IsReservedConfigName(name) {
-			continue // auto-populated by Defang/compose-go; not user-provided config
-		}
+	for _, name := range ProjectConfigNames(composeProject) {
 		if !slices.Contains(listConfigNames, name) {
 			errMissingConfig = append(errMissingConfig, name)
 		}
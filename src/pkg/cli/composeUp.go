@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/cli/compose"
@@ -29,6 +30,12 @@ type ComposeUpParams struct {
 	// TTL is the normalized deployment time-to-live (see byoc.ParseTTL);
 	// empty when no TTL was given.
 	TTL string
+	// LockTimeout is how long to wait for another deployment of the stack to
+	// release the deploy lock.
+	LockTimeout time.Duration
+	// Plan is a reviewed plan of the deployment; if set, the compose file of
+	// the plan is deployed, unless the inputs changed since the plan was made.
+	Plan *Plan
 }
 
 func checkDeploymentMode(prevMode, newMode modes.Mode) (modes.Mode, error) {
@@ -96,20 +103,42 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 		}
 	}
 
-	// Create a new project with only the necessary resources.
-	// Do not modify the original project, because the caller needs it for debugging.
-	fixedProject := project.WithoutUnnecessaryResources()
-	if err := compose.FixupServices(ctx, provider, fixedProject, upload); err != nil {
-		return nil, project, err
+	// Prevent concurrent deployments of the same stack; once the CD task is
+	// started, the lock is handed off to it, so it's held until the CD is done.
+	// TailAndMonitor renews it while the CLI follows the deployment.
+	var lease *DeployLease
+	var err error
+	if upload != compose.UploadModeIgnore && upload != compose.UploadModePreview && upload != compose.UploadModeEstimate {
+		lease, err = AcquireDeployLock(ctx, provider, project.Name, params.LockTimeout)
+		if err != nil {
+			return nil, project, err
+		}
+		defer lease.Release(ctx)
 	}
 
-	if err := compose.ValidateProject(fixedProject, recipe); err != nil {
-		return nil, project, &ComposeError{err}
-	}
+	var composeYaml []byte
+	if params.Plan != nil {
+		// Check the plan while holding the deploy lock, so no other deployment can change the stack in between
+		composeYaml, err = applyPlan(ctx, fabric, provider, project, params.Plan, recipe, upload)
+		if err != nil {
+			return nil, project, err
+		}
+	} else {
+		// Create a new project with only the necessary resources.
+		// Do not modify the original project, because the caller needs it for debugging.
+		fixedProject := project.WithoutUnnecessaryResources()
+		if err := compose.FixupServices(ctx, provider, fixedProject, upload); err != nil {
+			return nil, project, err
+		}
 
-	composeYaml, err := compose.MarshalYAML(fixedProject)
-	if err != nil {
-		return nil, project, err
+		if err := compose.ValidateProject(fixedProject, recipe); err != nil {
+			return nil, project, &ComposeError{err}
+		}
+
+		composeYaml, err = compose.MarshalYAML(fixedProject)
+		if err != nil {
+			return nil, project, err
+		}
 	}
 
 	if upload == compose.UploadModeIgnore {
@@ -117,13 +146,20 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 		return nil, project, dryrun.ErrDryRun
 	}
 
-	delegateDomain, err := fabric.GetDelegateSubdomainZone(ctx, &defangv1.GetDelegateSubdomainZoneRequest{
-		Project: project.Name,
-		Stack:   provider.GetStackNameForDomain(),
-	})
-	if err != nil {
-		term.Debug("GetDelegateSubdomainZone failed:", err)
-		return nil, project, errors.New("failed to get delegate domain")
+	// Offline providers, like the local provider, deploy without the Fabric
+	offline := client.IsOffline(provider)
+
+	var delegateZone string
+	if !offline {
+		delegateDomain, err := fabric.GetDelegateSubdomainZone(ctx, &defangv1.GetDelegateSubdomainZoneRequest{
+			Project: project.Name,
+			Stack:   provider.GetStackNameForDomain(),
+		})
+		if err != nil {
+			term.Debug("GetDelegateSubdomainZone failed:", err)
+			return nil, project, errors.New("failed to get delegate domain")
+		}
+		delegateZone = delegateDomain.Zone
 	}
 
 	// Check previous deployment mode for compatibility with new deployment mode.
@@ -148,8 +184,13 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 
 	// An unspecified recipe (new project, no mode given) is left to the fabric to
 	// default; sending an empty recipe name to GetRecipe would be rejected.
-	recipeMsg, err := getRecipe(ctx, fabric, recipe)
-	if err != nil {
+	var recipeMsg *defangv1.Recipe
+	if offline {
+		// Offline providers don't use the recipes of the Fabric; only record the name
+		if recipe != modes.RecipeUnspecified {
+			recipeMsg = &defangv1.Recipe{Name: recipe.String(), Active: true}
+		}
+	} else if recipeMsg, err = getRecipe(ctx, fabric, recipe); err != nil {
 		return nil, project, err
 	}
 	// Allow estimate/preview with an inactive recipe so teams can evaluate it before activating.
@@ -162,14 +203,14 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 			Mode:           recipe.Mode().Value(),
 			Project:        project.Name,
 			Compose:        composeYaml,
-			DelegateDomain: delegateDomain.Zone,
+			DelegateDomain: delegateZone,
 		},
 		Recipe: recipeMsg,
 		TTL:    params.TTL,
 	}
 
 	delegation, err := provider.PrepareDomainDelegation(ctx, client.PrepareDomainDelegationRequest{
-		DelegateDomain: delegateDomain.Zone,
+		DelegateDomain: delegateZone,
 		Preview:        upload == compose.UploadModePreview || upload == compose.UploadModeEstimate,
 		Project:        project.Name,
 	})
@@ -201,7 +242,7 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 			}
 		}
 
-		if _, ok := provider.(*client.PlaygroundProvider); !ok { // Do not need upload URLs for Playground
+		if _, ok := provider.(*client.PlaygroundProvider); !ok && !offline { // Do not need upload URLs for Playground or offline providers
 			statesUrl, eventsUrl, err = GetStatesAndEventsUploadUrls(ctx, project.Name, provider, fabric)
 			if err != nil {
 				return nil, project, err
@@ -214,25 +255,28 @@ func ComposeUp(ctx context.Context, fabric client.FabricClient, provider client.
 		if err != nil {
 			return nil, project, err
 		}
+		lease.HandOff(ctx, resp.Etag, resp.CdId)
 		action = defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP
 	}
 
-	err = putDeploymentAndStack(ctx, provider, fabric, stack, putDeploymentParams{
-		Action:       action,
-		ETag:         resp.Etag,
-		Mode:         recipe.Mode().Value(),
-		ProjectName:  project.Name,
-		StatesUrl:    statesUrl,
-		EventsUrl:    eventsUrl,
-		ServiceInfos: resp.Services,
-		CdType:       resp.CdType,
-		CdId:         resp.CdId,
-		Compose:      composeYaml,
-		Recipe:       deployRequest.Recipe,
-	})
-	if err != nil {
-		term.Debug("Failed to record deployment:", err)
-		term.Warn("Unable to update deployment history; deployment will proceed anyway.")
+	if !offline {
+		err = putDeploymentAndStack(ctx, provider, fabric, stack, putDeploymentParams{
+			Action:       action,
+			ETag:         resp.Etag,
+			Mode:         recipe.Mode().Value(),
+			ProjectName:  project.Name,
+			StatesUrl:    statesUrl,
+			EventsUrl:    eventsUrl,
+			ServiceInfos: resp.Services,
+			CdType:       resp.CdType,
+			CdId:         resp.CdId,
+			Compose:      composeYaml,
+			Recipe:       deployRequest.Recipe,
+		})
+		if err != nil {
+			term.Debug("Failed to record deployment:", err)
+			term.Warn("Unable to update deployment history; deployment will proceed anyway.")
+		}
 	}
 
 	if term.DoDebug() {
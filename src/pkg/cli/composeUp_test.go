@@ -173,6 +173,36 @@ func TestComposeUp(t *testing.T) {
 		}
 	})
 
+	t.Run("deploys the reviewed plan", func(t *testing.T) {
+		plan, err := MakePlan(t.Context(), mc, mp, proj, PlanOptions{Recipe: modes.RecipeAffordable})
+		require.NoError(t, err)
+		gotContext.Store(false)
+		_, _, err = ComposeUp(t.Context(), mc, mp, stack, ComposeUpParams{
+			Recipe:     modes.RecipeAffordable,
+			Project:    proj,
+			UploadMode: compose.UploadModeDigest,
+			Plan:       plan,
+		})
+		require.NoError(t, err)
+		require.True(t, gotContext.Load(), "expected the build context to be uploaded")
+	})
+
+	t.Run("fails when the plan drifted", func(t *testing.T) {
+		plan, err := MakePlan(t.Context(), mc, mp, proj, PlanOptions{Recipe: modes.RecipeAffordable})
+		require.NoError(t, err)
+		plan.Compose += "# changed\n"
+		gotContext.Store(false)
+		_, _, err = ComposeUp(t.Context(), mc, mp, stack, ComposeUpParams{
+			Recipe:     modes.RecipeAffordable,
+			Project:    proj,
+			UploadMode: compose.UploadModeDigest,
+			Plan:       plan,
+		})
+		var drift ErrPlanDrift
+		require.ErrorAs(t, err, &drift)
+		require.False(t, gotContext.Load(), "expected no upload")
+	})
+
 	t.Run("no downgrade from HA to affordable", func(t *testing.T) {
 		mp.prevProjectUpdate = &defangv1.ProjectUpdate{
 			Mode: defangv1.DeploymentMode_PRODUCTION,
@@ -503,6 +533,50 @@ func TestComposeUpRecipe(t *testing.T) {
 	}
 }
 
+type offlineDeployProvider struct {
+	*mockDeployProvider
+}
+
+func (offlineDeployProvider) Offline() bool {
+	return true
+}
+
+// unreachableFabric fails every call, like the Fabric when it can't be reached.
+type unreachableFabric struct {
+	client.MockFabricClient
+}
+
+func (unreachableFabric) GetRecipe(context.Context, *defangv1.GetRecipeRequest) (*defangv1.GetRecipeResponse, error) {
+	return nil, errors.New("unreachable")
+}
+
+func (unreachableFabric) GetDelegateSubdomainZone(context.Context, *defangv1.GetDelegateSubdomainZoneRequest) (*defangv1.DelegateSubdomainZoneResponse, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestComposeUpOffline(t *testing.T) {
+	project := &compose.Project{
+		Name: "test-project",
+		Services: compose.Services{
+			"service1": compose.ServiceConfig{Name: "service1", Image: "test-image"},
+		},
+	}
+	provider := offlineDeployProvider{&mockDeployProvider{}}
+	stack := &stacks.Parameters{Provider: client.ProviderLocal}
+
+	_, _, err := ComposeUp(t.Context(), unreachableFabric{}, provider, stack, ComposeUpParams{
+		Recipe:     modes.RecipeAffordable,
+		Project:    project,
+		UploadMode: compose.UploadModeDigest,
+	})
+	if err != nil {
+		t.Fatalf("ComposeUp() failed: %v", err)
+	}
+	if got := provider.deployedRecipe.GetName(); got != "AFFORDABLE" {
+		t.Errorf("DeployRequest recipe = %q, want %q", got, "AFFORDABLE")
+	}
+}
+
 func TestComposeConfigWithoutLogin(t *testing.T) {
 	fabric := client.MockFabricClient{}
 	provider := &client.PlaygroundProvider{FabricClient: fabric}
@@ -0,0 +1,338 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/types"
+)
+
+var (
+	deployLockTTL           = 2 * time.Minute
+	deployLockRenewInterval = 30 * time.Second
+	deployLockPollInterval  = 10 * time.Second
+	deployLockHandOffTTL    = time.Hour // longer than a CD task is allowed to run
+)
+
+// DeployLock is the content of the deploy lock of a stack; the lock is stale
+// once it expires, because its holder stopped renewing it. Once the CD task is
+// started, the lock is handed off to it, for the given deployment, and it's
+// also stale once that CD task has exited.
+type DeployLock struct {
+	Holder     string     `json:"holder"`
+	Started    time.Time  `json:"started"`
+	Expires    time.Time  `json:"expires"`
+	Deployment types.ETag `json:"deployment,omitempty"`
+	CdID       string     `json:"cdId,omitempty"` // the CD task of the deployment
+}
+
+type ErrDeployLocked struct {
+	ProjectName string
+	StackName   string
+	Lock        DeployLock
+}
+
+func (e ErrDeployLocked) Error() string {
+	msg := fmt.Sprintf("stack %q of project %q is being deployed by %s since %s", e.StackName, e.ProjectName, e.Lock.Holder, e.Lock.Started.Local().Format(time.RFC3339))
+	if e.Lock.Deployment != "" {
+		msg += fmt.Sprintf(" (deployment %s)", e.Lock.Deployment)
+	}
+	return msg
+}
+
+func deployLockHolder() string {
+	holder := "unknown"
+	if u, err := user.Current(); err == nil {
+		holder = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		holder += "@" + host
+	}
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		holder += fmt.Sprintf(" (GitHub Actions run %s/%s/actions/runs/%s)", os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), runID)
+	} else if jobID := os.Getenv("CI_JOB_ID"); jobID != "" {
+		holder += fmt.Sprintf(" (GitLab CI job %s)", jobID)
+	}
+	return holder
+}
+
+// DeployLease is a deploy lock held by this process. It is renewed in the
+// background until it is released. Once handed off to a CD task, it's renewed
+// with deployLockHandOffTTL instead, so it outlives this process.
+type DeployLease struct {
+	store     client.LockStore
+	key       string
+	mu        sync.Mutex
+	lock      DeployLock
+	version   string
+	stop      context.CancelFunc
+	done      chan struct{}
+	handedOff bool
+}
+
+func getDeployLock(ctx context.Context, store client.LockStore, key string) (*DeployLock, string, error) {
+	data, version, err := store.GetLockObject(ctx, key)
+	if err != nil {
+		if errors.Is(err, client.ErrNotExist) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	var lock DeployLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		term.Debugf("Ignoring invalid deploy lock %q: %v", key, err)
+		return &DeployLock{Holder: "unknown"}, version, nil // expired
+	}
+	return &lock, version, nil
+}
+
+// AcquireDeployLock acquires the deploy lock of the provider's stack, waiting
+// up to wait for another deployment to release it. It returns a nil lease if
+// the provider does not support deploy locks, or if the CD is not installed yet.
+func AcquireDeployLock(ctx context.Context, provider client.Provider, projectName string, wait time.Duration) (*DeployLease, error) {
+	store, ok := provider.(client.LockStore)
+	if !ok {
+		return nil, nil
+	}
+	return acquireDeployLock(ctx, store, projectName, provider.GetStackName(), wait)
+}
+
+func acquireDeployLock(ctx context.Context, store client.LockStore, projectName, stackName string, wait time.Duration) (*DeployLease, error) {
+	key := client.DeployLockKey(projectName, stackName)
+	deadline := time.Now().Add(wait)
+	waiting := false
+	for {
+		existing, version, err := getDeployLock(ctx, store, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deploy lock: %w", err)
+		}
+		now := time.Now()
+		if existing == nil || now.After(existing.Expires) || cdTaskExited(ctx, store, existing) {
+			if existing != nil {
+				term.Debugf("Taking over stale deploy lock of %s", existing.Holder)
+			}
+			lock := DeployLock{Holder: deployLockHolder(), Started: now, Expires: now.Add(deployLockTTL)}
+			data, err := json.Marshal(lock)
+			if err != nil {
+				return nil, err
+			}
+			newVersion, err := store.PutLockObject(ctx, key, data, version)
+			if errors.Is(err, client.ErrPreconditionFailed) {
+				continue // another deployment got there first
+			}
+			if errors.Is(err, client.ErrNotExist) {
+				term.Debug("Skipping deploy lock, because the CD storage does not exist yet:", err)
+				return nil, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to acquire deploy lock: %w", err)
+			}
+			term.Debug("Acquired deploy lock", key)
+			lease := &DeployLease{store: store, key: key, lock: lock, version: newVersion}
+			lease.keepAlive(ctx)
+			return lease, nil
+		}
+
+		lockErr := ErrDeployLocked{ProjectName: projectName, StackName: stackName, Lock: *existing}
+		if now.After(deadline) {
+			return nil, lockErr
+		}
+		if !waiting {
+			term.Infof("Waiting for the deploy lock; %v", lockErr)
+			waiting = true
+		}
+		if err := pkg.SleepWithContext(ctx, deployLockPollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cdTaskExited returns whether the lock was handed off to a CD task that has
+// exited since, without releasing the lock; for example because the CLI that
+// started it detached or was killed.
+func cdTaskExited(ctx context.Context, store client.LockStore, lock *DeployLock) bool {
+	if lock.CdID == "" {
+		return false
+	}
+	done, err := store.IsCdTaskDone(ctx, lock.CdID)
+	if err != nil {
+		term.Debugf("Failed to get the status of CD task %s of deployment %s: %v", lock.CdID, lock.Deployment, err)
+		return false
+	}
+	return done
+}
+
+func (l *DeployLease) keepAlive(ctx context.Context) {
+	ctx, l.stop = context.WithCancel(context.WithoutCancel(ctx))
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(deployLockRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := l.renew(ctx); err != nil {
+				if errors.Is(err, client.ErrPreconditionFailed) || errors.Is(err, client.ErrNotExist) {
+					term.Warn("Lost the deploy lock; it was removed by \"defang cd unlock\" or taken over by another deployment")
+					return
+				}
+				term.Debug("Failed to renew deploy lock:", err)
+			}
+		}
+	}()
+}
+
+func (l *DeployLease) renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock := l.lock
+	lock.Expires = time.Now().Add(deployLockTTL)
+	if l.handedOff {
+		lock.Expires = time.Now().Add(deployLockHandOffTTL)
+	}
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	version, err := l.store.PutLockObject(ctx, l.key, data, l.version)
+	if err != nil {
+		return err
+	}
+	l.lock, l.version = lock, version
+	return nil
+}
+
+// Release stops renewing the lease and deletes the deploy lock, unless it was
+// taken over or handed off in the meantime; a handed off lock is left to the
+// CD task. It is safe to call on a nil lease.
+func (l *DeployLease) Release(ctx context.Context) {
+	l.release(ctx, false)
+}
+
+// ReleaseHandOff is like Release, but also deletes a handed off lock; call it
+// once the CD task has exited. It is safe to call on a nil lease.
+func (l *DeployLease) ReleaseHandOff(ctx context.Context) {
+	l.release(ctx, true)
+}
+
+func (l *DeployLease) release(ctx context.Context, cdTaskExited bool) {
+	if l == nil {
+		return
+	}
+	l.stop()
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.handedOff && !cdTaskExited {
+		term.Debug("Leaving deploy lock", l.key, "to deployment", l.lock.Deployment)
+		return
+	}
+	l.deleteLocked(ctx)
+}
+
+// deleteLocked deletes the deploy lock; l.mu must be held.
+func (l *DeployLease) deleteLocked(ctx context.Context) {
+	// Release even when the deployment was canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := l.store.DeleteLockObject(ctx, l.key, l.version); err != nil {
+		term.Debug("Failed to release deploy lock:", err)
+		return
+	}
+	term.Debug("Released deploy lock", l.key)
+}
+
+// HandOff hands the deploy lock to the CD task of the given deployment, which
+// keeps running when the CLI detaches or exits: from now on the lock is renewed
+// with deployLockHandOffTTL, and Release leaves it in place. The next
+// deployment takes the lock over once the CD task has exited. It is safe to
+// call on a nil lease.
+func (l *DeployLease) HandOff(ctx context.Context, etag types.ETag, cdID string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock := l.lock
+	lock.Deployment = etag
+	lock.CdID = cdID
+	lock.Expires = time.Now().Add(deployLockHandOffTTL)
+	data, err := json.Marshal(lock)
+	if err != nil {
+		term.Debug("Failed to hand off deploy lock:", err)
+		return
+	}
+	version, err := l.store.PutLockObject(ctx, l.key, data, l.version)
+	if err != nil {
+		term.Debug("Failed to hand off deploy lock:", err) // the lock expires after deployLockTTL
+		return
+	}
+	l.lock, l.version, l.handedOff = lock, version, true
+	term.Debug("Handed off deploy lock", l.key, "to deployment", etag)
+}
+
+// AdoptDeployLock resumes renewing the deploy lock that was handed off to the
+// CD task of the given deployment, while the CLI is monitoring that deployment.
+// It returns a nil lease if the stack's lock is not held by that deployment.
+func AdoptDeployLock(ctx context.Context, provider client.Provider, projectName string, etag types.ETag) *DeployLease {
+	store, ok := provider.(client.LockStore)
+	if !ok {
+		return nil
+	}
+	key := client.DeployLockKey(projectName, provider.GetStackName())
+	lock, version, err := getDeployLock(ctx, store, key)
+	if err != nil {
+		term.Debug("Failed to get deploy lock:", err)
+		return nil
+	}
+	if lock == nil || lock.Deployment != etag {
+		return nil
+	}
+	lease := &DeployLease{store: store, key: key, lock: *lock, version: version, handedOff: true}
+	lease.keepAlive(ctx)
+	return lease
+}
+
+// DeployUnlock removes the deploy lock of the given stack. Unless force is
+// true, only a stale lock is removed: one that expired, or whose CD task exited.
+func DeployUnlock(ctx context.Context, provider client.Provider, projectName, stackName string, force bool) error {
+	store, ok := provider.(client.LockStore)
+	if !ok {
+		return errors.New("deploy locks are only supported for BYOC AWS, GCP, and Azure")
+	}
+	key := client.DeployLockKey(projectName, stackName)
+	lock, version, err := getDeployLock(ctx, store, key)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		term.Infof("Stack %q of project %q is not locked", stackName, projectName)
+		return nil
+	}
+	lockErr := ErrDeployLocked{ProjectName: projectName, StackName: stackName, Lock: *lock}
+	if !force && time.Now().Before(lock.Expires) && !cdTaskExited(ctx, store, lock) {
+		return fmt.Errorf("%w; the lock is renewed while the deployment runs, so use --force only if it is stale", lockErr)
+	}
+	term.Info("Removing deploy lock:", lockErr.Error())
+	if err := store.DeleteLockObject(ctx, key, version); err != nil {
+		if errors.Is(err, client.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
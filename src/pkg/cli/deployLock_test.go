@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+)
+
+type mockLockStore struct {
+	client.Provider
+	mu       sync.Mutex
+	objects  map[string][]byte
+	versions map[string]int
+	puts     int
+	cdDone   map[string]bool
+}
+
+func newMockLockStore() *mockLockStore {
+	return &mockLockStore{objects: map[string][]byte{}, versions: map[string]int{}, cdDone: map[string]bool{}}
+}
+
+func (m *mockLockStore) GetStackName() string {
+	return "beta"
+}
+
+func (m *mockLockStore) GetLockObject(ctx context.Context, key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, "", client.ErrNotExist
+	}
+	return data, strconv.Itoa(m.versions[key]), nil
+}
+
+func (m *mockLockStore) PutLockObject(ctx context.Context, key string, data []byte, version string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, exists := m.objects[key]
+	if version == "" && exists || version != "" && version != strconv.Itoa(m.versions[key]) {
+		return "", client.ErrPreconditionFailed
+	}
+	m.puts++
+	m.versions[key]++
+	m.objects[key] = data
+	return strconv.Itoa(m.versions[key]), nil
+}
+
+func (m *mockLockStore) DeleteLockObject(ctx context.Context, key string, version string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.objects[key]; !exists {
+		return client.ErrNotExist
+	}
+	if version != "" && version != strconv.Itoa(m.versions[key]) {
+		return client.ErrPreconditionFailed
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *mockLockStore) IsCdTaskDone(ctx context.Context, cdID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cdDone[cdID], nil
+}
+
+func (m *mockLockStore) getLock(t *testing.T, key string) *DeployLock {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil
+	}
+	var lock DeployLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		t.Fatal(err)
+	}
+	return &lock
+}
+
+func setDeployLockTimings(t *testing.T, ttl, renew, poll time.Duration) {
+	t.Helper()
+	origTTL, origRenew, origPoll := deployLockTTL, deployLockRenewInterval, deployLockPollInterval
+	deployLockTTL, deployLockRenewInterval, deployLockPollInterval = ttl, renew, poll
+	t.Cleanup(func() {
+		deployLockTTL, deployLockRenewInterval, deployLockPollInterval = origTTL, origRenew, origPoll
+	})
+}
+
+func TestDeployLock(t *testing.T) {
+	ctx := t.Context()
+	key := client.DeployLockKey("app", "beta")
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		lease, err := AcquireDeployLock(ctx, MockConfigDeleteProvider{}, "app", 0)
+		if err != nil || lease != nil {
+			t.Fatalf("expected no lease and no error, got %v, %v", lease, err)
+		}
+		lease.Release(ctx) // nil-safe
+	})
+
+	t.Run("acquire, fail fast, release", func(t *testing.T) {
+		store := newMockLockStore()
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+
+		_, err = AcquireDeployLock(ctx, store, "app", 0)
+		var lockErr ErrDeployLocked
+		if !errors.As(err, &lockErr) {
+			t.Fatalf("expected ErrDeployLocked, got %v", err)
+		}
+		if lockErr.Lock.Holder != deployLockHolder() || lockErr.StackName != "beta" {
+			t.Errorf("unexpected lock %+v", lockErr)
+		}
+
+		lease.Release(ctx)
+		if _, ok := store.objects[key]; ok {
+			t.Error("expected the lock to be deleted")
+		}
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		setDeployLockTimings(t, time.Minute, 10*time.Millisecond, time.Millisecond)
+		store := newMockLockStore()
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		lease.Release(ctx)
+		if store.puts < 2 {
+			t.Errorf("expected the lock to be renewed, got %d puts", store.puts)
+		}
+		if _, ok := store.objects[key]; ok {
+			t.Error("expected the lock to be deleted")
+		}
+	})
+
+	t.Run("wait for release", func(t *testing.T) {
+		setDeployLockTimings(t, time.Minute, time.Minute, time.Millisecond)
+		store := newMockLockStore()
+		first, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			first.Release(ctx)
+		}()
+		second, err := AcquireDeployLock(ctx, store, "app", time.Second)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		second.Release(ctx)
+	})
+
+	t.Run("take over expired lock", func(t *testing.T) {
+		store := newMockLockStore()
+		stale, _ := json.Marshal(DeployLock{Holder: "someone", Started: time.Now().Add(-time.Hour), Expires: time.Now().Add(-time.Minute)})
+		store.objects[key] = stale
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		lease.Release(ctx)
+	})
+
+	t.Run("hand off", func(t *testing.T) {
+		store := newMockLockStore()
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		lease.HandOff(ctx, "abc123", "build-1")
+		lease.Release(ctx) // leaves the lock to the CD task
+
+		_, err = AcquireDeployLock(ctx, store, "app", 0)
+		var lockErr ErrDeployLocked
+		if !errors.As(err, &lockErr) {
+			t.Fatalf("expected ErrDeployLocked while the CD runs, got %v", err)
+		}
+		if lockErr.Lock.Deployment != "abc123" || lockErr.Lock.CdID != "build-1" || time.Until(lockErr.Lock.Expires) < deployLockHandOffTTL-time.Minute {
+			t.Errorf("unexpected handed off lock %+v", lockErr.Lock)
+		}
+		if err := DeployUnlock(ctx, store, "app", "beta", false); err == nil {
+			t.Error("expected an error when unlocking the lock of a running CD task without force")
+		}
+
+		store.cdDone["build-1"] = true
+		lease, err = AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("expected to take over the lock once the CD is done, got %v", err)
+		}
+		if lock := store.getLock(t, key); lock == nil || lock.Deployment != "" {
+			t.Errorf("unexpected lock after taking over %+v", lock)
+		}
+		lease.Release(ctx)
+	})
+
+	t.Run("adopt", func(t *testing.T) {
+		setDeployLockTimings(t, time.Minute, 10*time.Millisecond, time.Millisecond)
+		store := newMockLockStore()
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		lease.HandOff(ctx, "abc123", "build-1")
+		lease.Release(ctx)
+
+		if AdoptDeployLock(ctx, store, "app", "other") != nil {
+			t.Error("expected no lease for another deployment")
+		}
+		if AdoptDeployLock(ctx, MockConfigDeleteProvider{}, "app", "abc123") != nil {
+			t.Error("expected no lease for an unsupported provider")
+		}
+
+		puts := store.puts
+		adopted := AdoptDeployLock(ctx, store, "app", "abc123")
+		if adopted == nil {
+			t.Fatal("expected to adopt the handed off lock")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if lock := store.getLock(t, key); lock == nil || lock.Deployment != "abc123" || time.Until(lock.Expires) < deployLockHandOffTTL-time.Minute {
+			t.Errorf("unexpected renewed lock %+v", lock)
+		}
+		adopted.ReleaseHandOff(ctx)
+		if store.puts == puts {
+			t.Error("expected the adopted lock to be renewed")
+		}
+		if _, ok := store.objects[key]; ok {
+			t.Error("expected the lock to be deleted once the CD is done")
+		}
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		store := newMockLockStore()
+		lease, err := AcquireDeployLock(ctx, store, "app", 0)
+		if err != nil {
+			t.Fatalf("AcquireDeployLock() error = %v", err)
+		}
+		defer lease.Release(ctx)
+
+		if err := DeployUnlock(ctx, store, "app", "beta", false); err == nil {
+			t.Error("expected an error when unlocking an active lock without force")
+		}
+		if err := DeployUnlock(ctx, store, "app", "beta", true); err != nil {
+			t.Fatalf("DeployUnlock() error = %v", err)
+		}
+		if _, ok := store.objects[key]; ok {
+			t.Error("expected the lock to be deleted")
+		}
+		if err := DeployUnlock(ctx, store, "app", "beta", false); err != nil {
+			t.Errorf("unlocking an unlocked stack: %v", err)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exportPageSize is the number of deployments per ListDeployments call
+const exportPageSize = 100
+
+type ExportDeploymentsParams struct {
+	ProjectName string
+	StackName   string
+	Since       time.Time
+	Actions     []defangv1.DeploymentAction // empty means all actions
+	Origins     []defangv1.DeploymentOrigin // empty means all origins
+	Format      string                      // "csv" or "json"
+}
+
+// DeploymentRecord is a row of the deployment history export.
+type DeploymentRecord struct {
+	Id              string            `json:"id"`
+	Project         string            `json:"project"`
+	Stack           string            `json:"stack,omitempty"`
+	Action          string            `json:"action"`
+	Status          string            `json:"status"`
+	Provider        string            `json:"provider"`
+	AccountId       string            `json:"accountId,omitempty"`
+	Region          string            `json:"region,omitempty"`
+	Recipe          string            `json:"recipe,omitempty"`
+	Origin          string            `json:"origin"`
+	OriginMetadata  map[string]string `json:"originMetadata,omitempty"`
+	Timestamp       time.Time         `json:"timestamp"`
+	Completed       *time.Time        `json:"completed,omitempty"`
+	DurationSeconds float64           `json:"durationSeconds,omitempty"`
+	ServiceCount    int32             `json:"serviceCount"`
+}
+
+var deploymentRecordColumns = []string{"id", "project", "stack", "action", "status", "provider", "accountId", "region", "recipe", "origin", "originMetadata", "timestamp", "completed", "durationSeconds", "serviceCount"}
+
+func (r DeploymentRecord) csvRow() []string {
+	var completed, duration string
+	if r.Completed != nil {
+		completed = r.Completed.Format(time.RFC3339)
+		duration = strconv.FormatFloat(r.DurationSeconds, 'f', -1, 64)
+	}
+	return []string{
+		r.Id,
+		r.Project,
+		r.Stack,
+		r.Action,
+		r.Status,
+		r.Provider,
+		r.AccountId,
+		r.Region,
+		r.Recipe,
+		r.Origin,
+		formatOriginMetadata(r.OriginMetadata, ";"),
+		r.Timestamp.Format(time.RFC3339),
+		completed,
+		duration,
+		strconv.Itoa(int(r.ServiceCount)),
+	}
+}
+
+func newDeploymentRecord(d *defangv1.Deployment) DeploymentRecord {
+	record := DeploymentRecord{
+		Id:             d.Id,
+		Project:        d.Project,
+		Stack:          d.Stack,
+		Action:         strings.TrimPrefix(d.Action.String(), "DEPLOYMENT_ACTION_"),
+		Status:         strings.TrimPrefix(d.Status.String(), "DEPLOYMENT_STATUS_"),
+		Provider:       strings.ToLower(d.Provider.String()),
+		AccountId:      d.ProviderAccountId,
+		Region:         d.Region,
+		Recipe:         deploymentRecipe(d),
+		Origin:         strings.TrimPrefix(d.Origin.String(), "DEPLOYMENT_ORIGIN_"),
+		OriginMetadata: d.OriginMetadata,
+		Timestamp:      d.Timestamp.AsTime().UTC(),
+		ServiceCount:   d.ServiceCount,
+	}
+	if d.Completed.IsValid() {
+		completed := d.Completed.AsTime().UTC()
+		record.Completed = &completed
+		record.DurationSeconds = deploymentDuration(d).Seconds()
+	}
+	return record
+}
+
+// ParseDeploymentAction parses an action like "up" or "DEPLOYMENT_ACTION_UP".
+func ParseDeploymentAction(s string) (defangv1.DeploymentAction, error) {
+	name := strings.ToUpper(s)
+	if value, ok := defangv1.DeploymentAction_value["DEPLOYMENT_ACTION_"+name]; ok && value != 0 {
+		return defangv1.DeploymentAction(value), nil
+	}
+	if value, ok := defangv1.DeploymentAction_value[name]; ok && value != 0 {
+		return defangv1.DeploymentAction(value), nil
+	}
+	return 0, fmt.Errorf("invalid action %q; must be one of up, down, preview, or refresh", s)
+}
+
+// ParseDeploymentOrigin parses an origin like "github" or "DEPLOYMENT_ORIGIN_GITHUB".
+func ParseDeploymentOrigin(s string) (defangv1.DeploymentOrigin, error) {
+	name := strings.ToUpper(s)
+	if value, ok := defangv1.DeploymentOrigin_value["DEPLOYMENT_ORIGIN_"+name]; ok && value != 0 {
+		return defangv1.DeploymentOrigin(value), nil
+	}
+	if value, ok := defangv1.DeploymentOrigin_value[name]; ok && value != 0 {
+		return defangv1.DeploymentOrigin(value), nil
+	}
+	return 0, fmt.Errorf("invalid origin %q; must be one of ci, github, or gitlab", s)
+}
+
+// ListDeploymentHistory pages through the deployment history, newest first,
+// until the given time.
+func ListDeploymentHistory(ctx context.Context, fabric client.FabricClient, params ExportDeploymentsParams) ([]*defangv1.Deployment, error) {
+	var deployments []*defangv1.Deployment
+	var until *timestamppb.Timestamp
+	for {
+		resp, err := fabric.ListDeployments(ctx, &defangv1.ListDeploymentsRequest{
+			Type:    defangv1.DeploymentType_DEPLOYMENT_TYPE_HISTORY,
+			Project: params.ProjectName,
+			Stack:   params.StackName,
+			Limit:   exportPageSize,
+			Until:   until,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range resp.Deployments {
+			if d.Timestamp.AsTime().Before(params.Since) {
+				return deployments, nil
+			}
+			if len(params.Actions) > 0 && !slices.Contains(params.Actions, d.Action) {
+				continue
+			}
+			if len(params.Origins) > 0 && !slices.Contains(params.Origins, d.Origin) {
+				continue
+			}
+			deployments = append(deployments, d)
+		}
+		if len(resp.Deployments) < exportPageSize {
+			return deployments, nil
+		}
+		last := resp.Deployments[len(resp.Deployments)-1].Timestamp
+		if until != nil && !last.AsTime().Before(until.AsTime()) {
+			return deployments, nil // no progress; don't loop forever
+		}
+		until = last
+	}
+}
+
+// ExportDeployments writes the deployment history as CSV or JSON, for audits.
+func ExportDeployments(ctx context.Context, fabric client.FabricClient, w io.Writer, params ExportDeploymentsParams) error {
+	if params.Format != "csv" && params.Format != "json" {
+		return fmt.Errorf("invalid format %q; must be csv or json", params.Format)
+	}
+	deployments, err := ListDeploymentHistory(ctx, fabric, params)
+	if err != nil {
+		return err
+	}
+	records := make([]DeploymentRecord, 0, len(deployments))
+	for _, d := range deployments {
+		records = append(records, newDeploymentRecord(d))
+	}
+
+	if params.Format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(deploymentRecordColumns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := writer.Write(record.csvRow()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
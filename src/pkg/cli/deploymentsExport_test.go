@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type historyFabricClient struct {
+	client.FabricClient
+	deployments []*defangv1.Deployment // newest first
+	calls       int
+}
+
+func (h *historyFabricClient) ListDeployments(ctx context.Context, req *defangv1.ListDeploymentsRequest) (*defangv1.ListDeploymentsResponse, error) {
+	h.calls++
+	var page []*defangv1.Deployment
+	for _, d := range h.deployments {
+		if req.Until != nil && !d.Timestamp.AsTime().Before(req.Until.AsTime()) {
+			continue
+		}
+		if len(page) == int(req.Limit) {
+			break
+		}
+		page = append(page, d)
+	}
+	return &defangv1.ListDeploymentsResponse{Deployments: page}, nil
+}
+
+func makeHistory(now time.Time, count int) []*defangv1.Deployment {
+	deployments := make([]*defangv1.Deployment, 0, count)
+	for i := range count {
+		started := now.Add(-time.Duration(i) * time.Hour)
+		d := &defangv1.Deployment{
+			Id:        fmt.Sprintf("d%03d", i),
+			Project:   "test",
+			Stack:     "beta",
+			Action:    defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP,
+			Status:    defangv1.DeploymentStatus_DEPLOYMENT_STATUS_SUCCESS,
+			Provider:  defangv1.Provider_AWS,
+			Timestamp: timestamppb.New(started),
+			Completed: timestamppb.New(started.Add(time.Minute)),
+			Origin:    defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_CI,
+		}
+		if i%2 == 1 {
+			d.Action = defangv1.DeploymentAction_DEPLOYMENT_ACTION_PREVIEW
+			d.Origin = defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITHUB
+			d.OriginMetadata = map[string]string{"pr": "42", "actor": "octocat"}
+		}
+		deployments = append(deployments, d)
+	}
+	return deployments
+}
+
+func TestExportDeployments(t *testing.T) {
+	now := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	t.Run("pages until since", func(t *testing.T) {
+		fabric := &historyFabricClient{deployments: makeHistory(now, 250)}
+		deployments, err := ListDeploymentHistory(t.Context(), fabric, ExportDeploymentsParams{Since: now.Add(-220 * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deployments) != 221 {
+			t.Errorf("expected 221 deployments, got %d", len(deployments))
+		}
+		if fabric.calls != 3 {
+			t.Errorf("expected 3 calls, got %d", fabric.calls)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		fabric := &historyFabricClient{deployments: makeHistory(now, 10)}
+		deployments, err := ListDeploymentHistory(t.Context(), fabric, ExportDeploymentsParams{
+			Actions: []defangv1.DeploymentAction{defangv1.DeploymentAction_DEPLOYMENT_ACTION_PREVIEW},
+			Origins: []defangv1.DeploymentOrigin{defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITHUB},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deployments) != 5 {
+			t.Errorf("expected 5 deployments, got %d", len(deployments))
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		fabric := &historyFabricClient{deployments: makeHistory(now, 2)}
+		var buf bytes.Buffer
+		if err := ExportDeployments(t.Context(), fabric, &buf, ExportDeploymentsParams{Format: "csv"}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("expected a header and 2 rows, got %v", rows)
+		}
+		want := []string{"d001", "test", "beta", "PREVIEW", "SUCCESS", "aws", "", "", "MODE_UNSPECIFIED", "GITHUB", "actor=octocat;pr=42", "2026-01-30T23:00:00Z", "2026-01-30T23:01:00Z", "60", "0"}
+		if fmt.Sprint(rows[2]) != fmt.Sprint(want) {
+			t.Errorf("row = %q, want %q", rows[2], want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		fabric := &historyFabricClient{deployments: makeHistory(now, 2)}
+		var buf bytes.Buffer
+		if err := ExportDeployments(t.Context(), fabric, &buf, ExportDeploymentsParams{Format: "json"}); err != nil {
+			t.Fatal(err)
+		}
+		var records []DeploymentRecord
+		if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 || records[0].Id != "d000" || records[1].OriginMetadata["pr"] != "42" || records[1].DurationSeconds != 60 {
+			t.Errorf("records = %+v", records)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		if err := ExportDeployments(t.Context(), &historyFabricClient{}, &bytes.Buffer{}, ExportDeploymentsParams{Format: "xml"}); err == nil {
+			t.Error("expected an error for an invalid format")
+		}
+	})
+}
+
+func TestParseDeploymentFilters(t *testing.T) {
+	for _, s := range []string{"up", "UP", "DEPLOYMENT_ACTION_UP"} {
+		if action, err := ParseDeploymentAction(s); err != nil || action != defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP {
+			t.Errorf("ParseDeploymentAction(%q) = %v, %v", s, action, err)
+		}
+	}
+	if _, err := ParseDeploymentAction("unspecified"); err == nil {
+		t.Error("expected an error for an unspecified action")
+	}
+	if origin, err := ParseDeploymentOrigin("gitlab"); err != nil || origin != defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITLAB {
+		t.Errorf("ParseDeploymentOrigin(gitlab) = %v, %v", origin, err)
+	}
+	if _, err := ParseDeploymentOrigin("bitbucket"); err == nil {
+		t.Error("expected an error for an unknown origin")
+	}
+}
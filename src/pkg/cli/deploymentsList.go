@@ -59,10 +59,6 @@ func DeploymentsList(ctx context.Context, client client.FabricClient, params Lis
 	deployments := make([]DeploymentLineItem, numDeployments)
 	for i, d := range response.Deployments {
 		deployedAt := d.Timestamp.AsTime().Local().Format(time.RFC3339)
-		recipeName := d.Recipe.GetName()
-		if recipeName == "" {
-			recipeName = d.Mode.String() // legacy fallback
-		}
 		deployments[i] = DeploymentLineItem{
 			AccountId:   d.ProviderAccountId,
 			DeployedAt:  deployedAt,
@@ -71,7 +67,7 @@ func DeploymentsList(ctx context.Context, client client.FabricClient, params Lis
 			Stack:       d.Stack,
 			Provider:    strings.ToLower(d.Provider.String()),
 			Region:      d.Region,
-			Mode:        recipeName,
+			Mode:        deploymentRecipe(d),
 		}
 	}
 
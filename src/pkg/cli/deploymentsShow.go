@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/types"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+type deploymentServiceItem struct {
+	Service  string
+	State    string
+	Status   string
+	Endpoint string
+}
+
+// deploymentRecipe returns the recipe name of the deployment, or the legacy mode.
+func deploymentRecipe(d *defangv1.Deployment) string {
+	if name := d.Recipe.GetName(); name != "" {
+		return name
+	}
+	return d.Mode.String() // legacy fallback
+}
+
+// deploymentDuration returns how long the deployment took, or 0 if it has not completed.
+func deploymentDuration(d *defangv1.Deployment) time.Duration {
+	if !d.Timestamp.IsValid() || !d.Completed.IsValid() {
+		return 0
+	}
+	return d.Completed.AsTime().Sub(d.Timestamp.AsTime())
+}
+
+// formatOriginMetadata returns the origin metadata as sorted key=value pairs.
+func formatOriginMetadata(metadata map[string]string, sep string) string {
+	pairs := make([]string, 0, len(metadata))
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		pairs = append(pairs, key+"="+metadata[key])
+	}
+	return strings.Join(pairs, sep)
+}
+
+// DeploymentShow prints the details of a single deployment, including the
+// compose file that was deployed.
+func DeploymentShow(ctx context.Context, fabric client.FabricClient, projectName string, deploymentID types.ETag) error {
+	resp, err := fabric.GetDeployment(ctx, &defangv1.GetDeploymentRequest{Project: projectName, Etag: deploymentID})
+	if err != nil {
+		return err
+	}
+	d := resp.Deployment
+	if d == nil {
+		return errors.New("deployment not found: " + deploymentID)
+	}
+
+	fields := [][2]string{
+		{"Deployment", d.Id},
+		{"Project", d.Project},
+		{"Stack", d.Stack},
+		{"Action", strings.TrimPrefix(d.Action.String(), "DEPLOYMENT_ACTION_")},
+		{"Status", strings.TrimPrefix(d.Status.String(), "DEPLOYMENT_STATUS_")},
+		{"Provider", strings.ToLower(d.Provider.String())},
+		{"AccountId", d.ProviderAccountId},
+		{"Region", d.Region},
+		{"Recipe", deploymentRecipe(d)},
+		{"Origin", strings.TrimPrefix(d.Origin.String(), "DEPLOYMENT_ORIGIN_")},
+		{"OriginMetadata", formatOriginMetadata(d.OriginMetadata, ", ")},
+	}
+	if d.Timestamp.IsValid() {
+		fields = append(fields, [2]string{"DeployedAt", d.Timestamp.AsTime().Local().Format(time.RFC3339)})
+	}
+	if d.Completed.IsValid() {
+		fields = append(fields, [2]string{"CompletedAt", d.Completed.AsTime().Local().Format(time.RFC3339)})
+	}
+	if duration := deploymentDuration(d); duration > 0 {
+		fields = append(fields, [2]string{"Duration", duration.Round(time.Second).String()})
+	}
+	for _, field := range fields {
+		if field[1] != "" {
+			term.Printf("%-15s %s\n", field[0]+":", field[1])
+		}
+	}
+
+	if len(d.Services) > 0 {
+		services := make([]deploymentServiceItem, 0, len(d.Services))
+		for _, serviceInfo := range d.Services {
+			services = append(services, deploymentServiceItem{
+				Service:  serviceInfo.Service.GetName(),
+				State:    serviceInfo.State.String(),
+				Status:   serviceInfo.Status,
+				Endpoint: strings.Join(serviceEndpoints(serviceInfo), " "),
+			})
+		}
+		if err := term.Table(services, "Service", "State", "Status", "Endpoint"); err != nil {
+			return err
+		}
+	}
+
+	if len(d.Compose) > 0 {
+		term.Println("\nCompose file:")
+		term.Println(strings.TrimRight(string(d.Compose), "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/types"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/DefangLabs/defang/src/protos/io/defang/v1/defangv1connect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type mockGetDeploymentHandler struct {
+	defangv1connect.UnimplementedFabricControllerHandler
+}
+
+func (mockGetDeploymentHandler) WhoAmI(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[defangv1.WhoAmIResponse], error) {
+	return connect.NewResponse(&defangv1.WhoAmIResponse{}), nil
+}
+
+func (mockGetDeploymentHandler) GetDeployment(ctx context.Context, req *connect.Request[defangv1.GetDeploymentRequest]) (*connect.Response[defangv1.GetDeploymentResponse], error) {
+	if req.Msg.Etag != "a1b2c3" {
+		return nil, connect.NewError(connect.CodeNotFound, nil)
+	}
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return connect.NewResponse(&defangv1.GetDeploymentResponse{
+		Deployment: &defangv1.Deployment{
+			Id:                "a1b2c3",
+			Project:           "test",
+			Stack:             "beta",
+			Action:            defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP,
+			Status:            defangv1.DeploymentStatus_DEPLOYMENT_STATUS_SUCCESS,
+			Provider:          defangv1.Provider_AWS,
+			ProviderAccountId: "1234567890",
+			Region:            "us-test-2",
+			Timestamp:         timestamppb.New(started),
+			Completed:         timestamppb.New(started.Add(90 * time.Second)),
+			Origin:            defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITHUB,
+			OriginMetadata:    map[string]string{"commit": "deadbeef", "actor": "octocat"},
+			Services: []*defangv1.ServiceInfo{
+				{Service: &defangv1.Service{Name: "app"}, State: defangv1.ServiceState_DEPLOYMENT_COMPLETED, Domainname: "app.example.com"},
+			},
+			Compose: []byte("services:\n  app:\n    image: nginx\n"),
+		},
+	}), nil
+}
+
+func TestDeploymentShow(t *testing.T) {
+	ctx := t.Context()
+
+	_, handler := defangv1connect.NewFabricControllerHandler(&mockGetDeploymentHandler{})
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	grpcClient := Connect(strings.TrimPrefix(server.URL, "http://"), types.TenantUnset)
+
+	t.Run("found", func(t *testing.T) {
+		stdout, _ := term.SetupTestTerm(t)
+		if err := DeploymentShow(ctx, grpcClient, "test", "a1b2c3"); err != nil {
+			t.Fatalf("DeploymentShow() error = %v", err)
+		}
+		output := stdout.String()
+		for _, want := range []string{
+			"Deployment:     a1b2c3",
+			"Stack:          beta",
+			"Action:         UP",
+			"Status:         SUCCESS",
+			"Origin:         GITHUB",
+			"OriginMetadata: actor=octocat, commit=deadbeef",
+			"Duration:       1m30s",
+			"DEPLOYMENT_COMPLETED",
+			"https://app.example.com",
+			"Compose file:\nservices:\n  app:\n    image: nginx",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, output)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		term.SetupTestTerm(t)
+		if err := DeploymentShow(ctx, grpcClient, "test", "unknown"); err == nil {
+			t.Fatal("expected an error for an unknown deployment")
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"github.com/DefangLabs/defang/src/pkg/notify"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+// NotifyServiceHealthy returns a TailOptions.OnServiceUpdate hook that posts
+// an EventServiceHealthy, based on the given event, the first time each service
+// of the deployment reaches DEPLOYMENT_COMPLETED.
+func NotifyServiceHealthy(notifier *notify.Notifier, event notify.Event, deploy *defangv1.DeployResponse) func(*defangv1.SubscribeResponse) {
+	endpoints := make(map[string][]string, len(deploy.GetServices()))
+	for _, serviceInfo := range deploy.GetServices() {
+		endpoints[serviceInfo.Service.Name] = serviceEndpoints(serviceInfo)
+	}
+	healthy := make(map[string]bool) // only used by the WaitServiceState goroutine
+	return func(msg *defangv1.SubscribeResponse) {
+		if msg.State != defangv1.ServiceState_DEPLOYMENT_COMPLETED || healthy[msg.Name] {
+			return
+		}
+		healthy[msg.Name] = true
+		event := event
+		event.Type = notify.EventServiceHealthy
+		event.Deployment = deploy.GetEtag()
+		event.Service = msg.Name
+		event.Endpoints = endpoints[msg.Name]
+		notifier.Notify(event)
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/notify"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (s *recordingSink) Send(_ context.Context, event notify.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestNotifyServiceHealthy(t *testing.T) {
+	sink := &recordingSink{}
+	notifier := notify.New(nil, sink)
+	deploy := &defangv1.DeployResponse{
+		Etag: "abc123",
+		Services: []*defangv1.ServiceInfo{
+			{Service: &defangv1.Service{Name: "app"}, Domainname: "app.example.com"},
+			{Service: &defangv1.Service{Name: "db"}},
+		},
+	}
+	hook := NotifyServiceHealthy(notifier, notify.Event{Project: "proj", Stack: "beta"}, deploy)
+	hook(&defangv1.SubscribeResponse{Name: "app", State: defangv1.ServiceState_DEPLOYMENT_PENDING})
+	hook(&defangv1.SubscribeResponse{Name: "app", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED})
+	hook(&defangv1.SubscribeResponse{Name: "app", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED}) // duplicate
+	hook(&defangv1.SubscribeResponse{Name: "db", State: defangv1.ServiceState_DEPLOYMENT_FAILED})
+	notifier.Close(t.Context())
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 event, got %+v", sink.events)
+	}
+	event := sink.events[0]
+	if event.Type != notify.EventServiceHealthy || event.Service != "app" || event.Deployment != "abc123" || event.Stack != "beta" {
+		t.Errorf("event = %+v", event)
+	}
+	if len(event.Endpoints) != 1 || event.Endpoints[0] != "https://app.example.com" {
+		t.Errorf("endpoints = %v", event.Endpoints)
+	}
+}
@@ -0,0 +1,359 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/money"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+// PlanVersion is the version of the plan document; bump it on incompatible changes.
+const PlanVersion = 1
+
+// Plan is a machine-readable description of what a deployment would do, so it
+// can be reviewed before it is applied with "compose up --plan".
+type Plan struct {
+	Version       int                `json:"version"`
+	Created       time.Time          `json:"created"`
+	Target        PlanTarget         `json:"target"`
+	Compose       string             `json:"compose"` // the fixed-up compose file
+	Configs       []PlanConfig       `json:"configs,omitempty"`
+	BuildContexts []PlanBuildContext `json:"buildContexts,omitempty"`
+	Estimate      *PlanEstimate      `json:"estimate,omitempty"`
+	Changes       []PlanChange       `json:"changes,omitempty"` // from the Pulumi preview
+}
+
+type PlanTarget struct {
+	Project  string `json:"project"`
+	Stack    string `json:"stack,omitempty"`
+	Provider string `json:"provider"`
+	Region   string `json:"region,omitempty"`
+	Recipe   string `json:"recipe,omitempty"`
+}
+
+type PlanConfig struct {
+	Name   string `json:"name"`
+	Exists bool   `json:"exists"`
+	// Version changes whenever the value is set; empty if the provider does
+	// not report config versions.
+	Version string `json:"version,omitempty"`
+}
+
+type PlanBuildContext struct {
+	Service string `json:"service"`
+	Context string `json:"context"`
+	Digest  string `json:"digest"`
+}
+
+type PlanEstimate struct {
+	MonthlyCost string             `json:"monthlyCost"`
+	LineItems   []PlanEstimateItem `json:"lineItems,omitempty"`
+}
+
+type PlanEstimateItem struct {
+	Service     string `json:"service"`
+	Description string `json:"description"`
+	Quantity    string `json:"quantity"`
+	Cost        string `json:"cost"`
+}
+
+type PlanChange struct {
+	Op  string `json:"op"`
+	URN string `json:"urn"`
+}
+
+type PlanOptions struct {
+	Recipe modes.Recipe
+	// Estimate adds the cost estimate and the Pulumi preview to the plan, which
+	// takes a few minutes. Only AWS and GCP are supported.
+	Estimate bool
+}
+
+// ErrPlanDrift is returned when the inputs of a deployment differ from the plan.
+type ErrPlanDrift []string
+
+func (e ErrPlanDrift) Error() string {
+	return "the inputs have changed since the plan was made:\n - " + strings.Join(e, "\n - ")
+}
+
+// MakePlan prepares the project like a dry run of "compose up" does, and
+// describes the result.
+func MakePlan(ctx context.Context, fabric client.FabricClient, provider client.Provider, project *compose.Project, opts PlanOptions) (*Plan, error) {
+	plan, _, err := makePlan(ctx, fabric, provider, project, opts)
+	return plan, err
+}
+
+func makePlan(ctx context.Context, fabric client.FabricClient, provider client.Provider, project *compose.Project, opts PlanOptions) (*Plan, *compose.Project, error) {
+	fixedProject, composeYaml, err := planProject(ctx, provider, project, opts.Recipe)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accountInfo, err := provider.AccountInfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	plan := &Plan{
+		Version: PlanVersion,
+		Created: time.Now().UTC(),
+		Target: PlanTarget{
+			Project:  project.Name,
+			Stack:    provider.GetStackName(),
+			Provider: accountInfo.Provider.String(),
+			Region:   accountInfo.Region,
+			Recipe:   opts.Recipe.String(),
+		},
+		Compose: string(composeYaml),
+	}
+
+	if names := compose.ProjectConfigNames(project); len(names) > 0 {
+		configs, err := provider.ListConfig(ctx, &defangv1.ListConfigsRequest{Project: project.Name})
+		if err != nil {
+			return nil, nil, err
+		}
+		var versions map[string]string
+		if versioner, ok := provider.(client.ConfigVersioner); ok {
+			versions, err = versioner.GetConfigVersions(ctx, &defangv1.ListConfigsRequest{Project: project.Name})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get the config versions: %w", err)
+			}
+		}
+		for _, name := range names {
+			plan.Configs = append(plan.Configs, PlanConfig{
+				Name:    name,
+				Exists:  slices.Contains(configs.Names, name),
+				Version: versions[name],
+			})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(project.Services)) {
+		service := project.Services[name]
+		if service.Build == nil {
+			continue
+		}
+		digest, err := compose.BuildContextDigest(ctx, service.Build)
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		buildContext := relativeBuildContext(project.WorkingDir, service.Build.Context)
+		plan.BuildContexts = append(plan.BuildContexts, PlanBuildContext{Service: name, Context: buildContext, Digest: digest})
+	}
+
+	if opts.Estimate {
+		recipe := opts.Recipe
+		if recipe == modes.RecipeUnspecified {
+			recipe = modes.RecipeAffordable
+		}
+		previewProvider := &client.PlaygroundProvider{FabricClient: fabric}
+		preview, err := GeneratePreview(ctx, project, fabric, previewProvider, accountInfo.Provider, recipe, accountInfo.Region)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate the preview: %w", err)
+		}
+		plan.Changes = parsePreviewChanges(preview)
+		estimate, err := fabric.Estimate(ctx, &defangv1.EstimateRequest{
+			Provider:      accountInfo.Provider.Value(),
+			Region:        accountInfo.Region,
+			PulumiPreview: []byte(preview),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to estimate the cost: %w", err)
+		}
+		plan.Estimate = makePlanEstimate(estimate)
+	}
+	return plan, fixedProject, nil
+}
+
+// planProject fixes up the project like a dry run of "compose up" does, with
+// the build contexts relative to the project directory, so that the compose
+// file of a plan does not depend on where the project is checked out.
+func planProject(ctx context.Context, provider client.Provider, project *compose.Project, recipe modes.Recipe) (*compose.Project, []byte, error) {
+	fixedProject := project.WithoutUnnecessaryResources()
+	if err := compose.FixupServices(ctx, provider, fixedProject, compose.UploadModeIgnore); err != nil {
+		return nil, nil, err
+	}
+	if err := compose.ValidateProject(fixedProject, recipe); err != nil {
+		return nil, nil, &ComposeError{err}
+	}
+	for name, service := range fixedProject.Services {
+		if service.Build == nil {
+			continue
+		}
+		build := *service.Build // don't modify the build of the original project
+		build.Context = relativeBuildContext(project.WorkingDir, build.Context)
+		service.Build = &build
+		fixedProject.Services[name] = service
+	}
+	composeYaml, err := compose.MarshalYAML(fixedProject)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fixedProject, composeYaml, nil
+}
+
+func relativeBuildContext(workingDir, buildContext string) string {
+	if strings.Contains(buildContext, "://") {
+		return buildContext
+	}
+	if rel, err := filepath.Rel(workingDir, buildContext); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return buildContext
+}
+
+// applyPlan checks that the inputs of a deployment still match the plan, and
+// returns the compose file of the plan with the build contexts uploaded. The
+// build contexts are only uploaded if they still have the digests of the plan.
+func applyPlan(ctx context.Context, fabric client.FabricClient, provider client.Provider, project *compose.Project, plan *Plan, recipe modes.Recipe, upload compose.UploadMode) ([]byte, error) {
+	current, fixedProject, err := makePlan(ctx, fabric, provider, project, PlanOptions{Recipe: recipe})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPlan(plan, current); err != nil {
+		return nil, err
+	}
+	if upload == compose.UploadModeIgnore {
+		return []byte(plan.Compose), nil
+	}
+
+	digests := make(map[string]string, len(plan.BuildContexts))
+	for _, b := range plan.BuildContexts {
+		digests[b.Service] = b.Digest
+	}
+	for _, name := range slices.Sorted(maps.Keys(fixedProject.Services)) {
+		service := fixedProject.Services[name]
+		if service.Build == nil || strings.Contains(service.Build.Context, "://") {
+			continue
+		}
+		build := *service.Build
+		build.Context = filepath.Join(project.WorkingDir, filepath.FromSlash(build.Context))
+		if !client.IsOffline(provider) {
+			digest, ok := digests[name]
+			if !ok {
+				return nil, ErrPlanDrift{fmt.Sprintf("service %q: the build context %q is not in the plan", name, service.Build.Context)}
+			}
+			url, err := compose.UploadBuildContext(ctx, provider, project.Name, name, &build, upload, digest)
+			if errors.Is(err, compose.ErrBuildContextChanged) {
+				return nil, ErrPlanDrift{fmt.Sprintf("service %q: the build context %q changed", name, service.Build.Context)}
+			} else if err != nil {
+				return nil, err
+			}
+			build.Context = url
+		}
+		service.Build = &build
+		fixedProject.Services[name] = service
+	}
+	return compose.MarshalYAML(fixedProject)
+}
+
+func makePlanEstimate(estimate *defangv1.EstimateResponse) *PlanEstimate {
+	planEstimate := &PlanEstimate{MonthlyCost: (*money.Money)(estimate.Subtotal).String()}
+	for _, item := range prepareEstimateLineItemTableItems(estimate.LineItems) {
+		planEstimate.LineItems = append(planEstimate.LineItems, PlanEstimateItem{
+			Service:     item.Service,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			Cost:        item.Cost,
+		})
+	}
+	return planEstimate
+}
+
+// parsePreviewChanges returns the resource changes from the JSON output of
+// "pulumi preview", or nil if the preview is not in that format.
+func parsePreviewChanges(preview string) []PlanChange {
+	var output struct {
+		Steps []PlanChange `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(preview), &output); err != nil {
+		term.Debug("Failed to parse the preview:", err)
+		return nil
+	}
+	return slices.DeleteFunc(output.Steps, func(change PlanChange) bool {
+		return change.Op == "same"
+	})
+}
+
+// Drift describes how the inputs of the current plan differ from those of the
+// given plan; the estimate and preview are not compared.
+func (p *Plan) Drift(current *Plan) []string {
+	var drift []string
+	if p.Target != current.Target {
+		drift = append(drift, fmt.Sprintf("target %+v is now %+v", p.Target, current.Target))
+	}
+	if p.Compose != current.Compose {
+		drift = append(drift, "the compose file or its environment changed")
+	}
+
+	configs := make(map[string]PlanConfig, len(current.Configs))
+	for _, c := range current.Configs {
+		configs[c.Name] = c
+	}
+	for _, c := range p.Configs {
+		currentConfig, ok := configs[c.Name]
+		switch {
+		case !ok:
+		case currentConfig.Exists && !c.Exists:
+			drift = append(drift, fmt.Sprintf("config %q was set", c.Name))
+		case !currentConfig.Exists && c.Exists:
+			drift = append(drift, fmt.Sprintf("config %q was removed", c.Name))
+		case currentConfig.Version != c.Version:
+			drift = append(drift, fmt.Sprintf("config %q was changed", c.Name))
+		}
+	}
+
+	digests := make(map[string]string, len(current.BuildContexts))
+	for _, b := range current.BuildContexts {
+		digests[b.Service] = b.Digest
+	}
+	for _, b := range p.BuildContexts {
+		if digest, ok := digests[b.Service]; ok && digest != b.Digest {
+			drift = append(drift, fmt.Sprintf("service %q: the build context %q changed", b.Service, b.Context))
+		}
+	}
+	return drift
+}
+
+// CheckPlan returns ErrPlanDrift if the current plan differs from the given one.
+func CheckPlan(plan, current *Plan) error {
+	if drift := plan.Drift(current); len(drift) > 0 {
+		return ErrPlanDrift(drift)
+	}
+	return nil
+}
+
+func WritePlan(path string, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %q: %w", path, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d; expected %d", plan.Version, PlanVersion)
+	}
+	return &plan, nil
+}
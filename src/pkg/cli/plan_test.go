@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+func TestMakePlan(t *testing.T) {
+	term.SetupTestTerm(t)
+	loader := compose.NewLoader(compose.WithPath("../../testdata/testproj/compose.yaml"))
+	project, err := loader.LoadProject(t.Context())
+	if err != nil {
+		t.Fatalf("LoadProject() failed: %v", err)
+	}
+	provider := &mockDeployProvider{}
+
+	plan, err := MakePlan(t.Context(), client.MockFabricClient{}, provider, project, PlanOptions{Recipe: modes.RecipeAffordable})
+	if err != nil {
+		t.Fatalf("MakePlan() error = %v", err)
+	}
+	if plan.Version != PlanVersion || plan.Target.Project != "tests" || plan.Target.Recipe != modes.RecipeAffordable.String() {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if !strings.Contains(plan.Compose, "dfnx:") {
+		t.Errorf("expected the fixed-up compose, got %s", plan.Compose)
+	}
+	if strings.Contains(plan.Compose, project.WorkingDir) {
+		t.Errorf("expected the build contexts relative to the project, got %s", plan.Compose)
+	}
+	if len(plan.BuildContexts) != 1 || plan.BuildContexts[0].Context != "." || !strings.HasPrefix(plan.BuildContexts[0].Digest, "sha256-") {
+		t.Errorf("unexpected build contexts %+v", plan.BuildContexts)
+	}
+
+	again, err := MakePlan(t.Context(), client.MockFabricClient{}, provider, project, PlanOptions{Recipe: modes.RecipeAffordable})
+	if err != nil {
+		t.Fatalf("MakePlan() error = %v", err)
+	}
+	if err := CheckPlan(plan, again); err != nil {
+		t.Errorf("expected no drift, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := WritePlan(path, plan); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	read, err := ReadPlan(path)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %v", err)
+	}
+	if err := CheckPlan(read, plan); err != nil {
+		t.Errorf("expected no drift after a round-trip, got %v", err)
+	}
+}
+
+func TestPlanDrift(t *testing.T) {
+	plan := &Plan{
+		Version:       PlanVersion,
+		Target:        PlanTarget{Project: "app", Stack: "beta", Provider: "aws", Region: "us-west-2"},
+		Compose:       "services: {}",
+		Configs:       []PlanConfig{{Name: "API_KEY", Exists: true}, {Name: "DB_URL", Exists: false}, {Name: "TOKEN", Exists: true, Version: "1"}},
+		BuildContexts: []PlanBuildContext{{Service: "web", Context: "web", Digest: "sha256-a"}},
+	}
+	current := &Plan{
+		Version:       PlanVersion,
+		Target:        PlanTarget{Project: "app", Stack: "beta", Provider: "aws", Region: "us-east-1"},
+		Compose:       "services: {}",
+		Configs:       []PlanConfig{{Name: "API_KEY", Exists: false}, {Name: "DB_URL", Exists: false}, {Name: "TOKEN", Exists: true, Version: "2"}},
+		BuildContexts: []PlanBuildContext{{Service: "web", Context: "web", Digest: "sha256-b"}},
+	}
+
+	err := CheckPlan(plan, current)
+	var drift ErrPlanDrift
+	if !errors.As(err, &drift) {
+		t.Fatalf("expected ErrPlanDrift, got %v", err)
+	}
+	if len(drift) != 4 {
+		t.Fatalf("expected 4 drifts, got %q", drift)
+	}
+	for i, want := range []string{"us-east-1", `config "API_KEY" was removed`, `config "TOKEN" was changed`, `service "web": the build context "web" changed`} {
+		if !strings.Contains(drift[i], want) {
+			t.Errorf("drift %d: expected %q in %q", i, want, drift[i])
+		}
+	}
+}
+
+func TestParsePreviewChanges(t *testing.T) {
+	preview := `{"steps":[{"op":"same","urn":"urn:a"},{"op":"create","urn":"urn:b"},{"op":"update","urn":"urn:c"}],"changeSummary":{"create":1,"same":1,"update":1}}`
+	changes := parsePreviewChanges(preview)
+	if len(changes) != 2 || changes[0] != (PlanChange{Op: "create", URN: "urn:b"}) || changes[1].Op != "update" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	if changes := parsePreviewChanges("Preview succeeded"); changes != nil {
+		t.Errorf("expected no changes for non-JSON output, got %+v", changes)
+	}
+}
@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/github"
+	"github.com/DefangLabs/defang/src/pkg/gitlab"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+const (
+	DefaultPreviewTemplate = "preview"
+	DefaultPreviewTTL      = "3d"
+
+	maxPreviewStackNameLength  = 16
+	previewStackNameHashLength = 6
+)
+
+var previewStackNamePattern = regexp.MustCompile(`^pr([0-9]+)$`)
+
+// PreviewStackName derives the name of the preview stack for the given pull
+// request number or, if pr is zero, for the given branch.
+func PreviewStackName(pr int, branch string) (string, error) {
+	if pr > 0 {
+		return fmt.Sprintf("pr%d", pr), nil
+	}
+	var sb strings.Builder
+	for _, r := range strings.ToLower(branch) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" {
+		return "", errors.New("cannot derive a preview stack name; specify --pr or --branch")
+	}
+	if name[0] < 'a' || previewStackNamePattern.MatchString(name) {
+		name = "br" + name // must start with a letter and must not look like a PR stack
+	}
+	if len(name) > maxPreviewStackNameLength {
+		// a short hash of the full branch name keeps truncated names unique
+		sum := sha256.Sum256([]byte(branch))
+		hash := hex.EncodeToString(sum[:])[:previewStackNameHashLength]
+		name = name[:maxPreviewStackNameLength-previewStackNameHashLength] + hash
+	}
+	return name, nil
+}
+
+// The stack variables that record the pull request or branch of a preview
+// stack, so gc can check it on the forge that it came from.
+const (
+	PreviewForgeVar       = "DEFANG_PREVIEW_FORGE"
+	PreviewRepositoryVar  = "DEFANG_PREVIEW_REPOSITORY"
+	PreviewPullRequestVar = "DEFANG_PREVIEW_PR"
+	PreviewBranchVar      = "DEFANG_PREVIEW_BRANCH"
+)
+
+type Forge string
+
+const (
+	ForgeGitHub Forge = "github"
+	ForgeGitLab Forge = "gitlab"
+)
+
+// PreviewSource is the pull (or merge) request, or the branch, that a preview
+// environment was deployed for.
+type PreviewSource struct {
+	Forge       Forge
+	Repository  string // "owner/name" on GitHub, "group/project" on GitLab
+	PullRequest int
+	Branch      string
+}
+
+// PreviewSourceFromEnvironment returns the forge, repository, pull (or merge)
+// request number and source branch of the CI job, if any.
+func PreviewSourceFromEnvironment() PreviewSource {
+	// https://docs.github.com/en/actions/reference/workflows-and-actions/variables
+	if os.Getenv("GITHUB_ACTION") != "" {
+		source := PreviewSource{Forge: ForgeGitHub, Repository: os.Getenv("GITHUB_REPOSITORY")}
+		if ref, ok := strings.CutSuffix(os.Getenv("GITHUB_REF_NAME"), "/merge"); ok {
+			source.PullRequest, _ = strconv.Atoi(ref) // pull_request events use "<pr>/merge"
+		}
+		source.Branch = os.Getenv("GITHUB_HEAD_REF")
+		if source.Branch == "" {
+			source.Branch = os.Getenv("GITHUB_REF_NAME")
+		}
+		return source
+	}
+	// https://docs.gitlab.com/ci/variables/predefined_variables/
+	if os.Getenv("GITLAB_CI") != "" {
+		source := PreviewSource{Forge: ForgeGitLab, Repository: os.Getenv("CI_PROJECT_PATH")}
+		source.PullRequest, _ = strconv.Atoi(os.Getenv("CI_MERGE_REQUEST_IID"))
+		source.Branch = os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")
+		if source.Branch == "" {
+			source.Branch = os.Getenv("CI_COMMIT_REF_NAME")
+		}
+		return source
+	}
+	return PreviewSource{}
+}
+
+func (s PreviewSource) variables() map[string]string {
+	variables := map[string]string{}
+	if s.Forge != "" {
+		variables[PreviewForgeVar] = string(s.Forge)
+	}
+	if s.Repository != "" {
+		variables[PreviewRepositoryVar] = s.Repository
+	}
+	if s.PullRequest > 0 {
+		variables[PreviewPullRequestVar] = strconv.Itoa(s.PullRequest)
+	}
+	if s.Branch != "" {
+		variables[PreviewBranchVar] = s.Branch
+	}
+	return variables
+}
+
+func previewSourceFromVariables(variables map[string]string) PreviewSource {
+	pr, _ := strconv.Atoi(variables[PreviewPullRequestVar])
+	return PreviewSource{
+		Forge:       Forge(variables[PreviewForgeVar]),
+		Repository:  variables[PreviewRepositoryVar],
+		PullRequest: pr,
+		Branch:      variables[PreviewBranchVar],
+	}
+}
+
+// CreatePreviewStack creates the stack file for a preview environment, which
+// extends the template stack, sets a default TTL and records the source of the
+// preview. An existing stack file is left untouched.
+func CreatePreviewStack(targetDirectory, template, name, ttl string, source PreviewSource) (*stacks.Parameters, error) {
+	params, err := stacks.ReadInDirectory(targetDirectory, name)
+	if err == nil {
+		term.Debugf("Using existing preview stack %q", name)
+		return params, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	parent, err := stacks.ReadInDirectory(targetDirectory, template)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("template stack %q not found; create it with `defang stack new %s` or specify --template", template, template)
+		}
+		return nil, err
+	}
+
+	variables := source.variables()
+	if ttl != "" {
+		variables["DEFANG_TTL"] = ttl
+	}
+	params = &stacks.Parameters{
+		Name:      name,
+		Extends:   template,
+		Provider:  parent.Provider,
+		Region:    parent.Region,
+		Recipe:    parent.Recipe,
+		Variables: variables,
+	}
+	if _, err := stacks.CreateInDirectory(targetDirectory, *params, nil); err != nil {
+		return nil, err
+	}
+	term.Infof("Created preview stack %q from template stack %q", name, template)
+	return stacks.ReadInDirectory(targetDirectory, name)
+}
+
+// FormatPreviewComment returns the Markdown for a pull request comment that
+// lists the endpoints of the preview environment.
+func FormatPreviewComment(stackName string, services []ServiceLineItem) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### Defang preview environment `%s`\n\n", stackName)
+	sb.WriteString("| Service | State | Endpoint |\n")
+	sb.WriteString("| --- | --- | --- |\n")
+	for _, svc := range services {
+		endpoint := svc.Endpoint
+		if strings.HasPrefix(endpoint, "https://") {
+			endpoint = fmt.Sprintf("[%s](%s)", strings.TrimPrefix(endpoint, "https://"), endpoint)
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s |\n", svc.Service, svc.State, endpoint)
+	}
+	return sb.String()
+}
+
+type PreviewStacksLister interface {
+	ListStacks(ctx context.Context, req *defangv1.ListStacksRequest) (*defangv1.ListStacksResponse, error)
+	ListDeployments(ctx context.Context, req *defangv1.ListDeploymentsRequest) (*defangv1.ListDeploymentsResponse, error)
+}
+
+type PreviewState string
+
+const (
+	PreviewOpen    PreviewState = "open"
+	PreviewClosed  PreviewState = "closed"  // the pull request was closed or merged
+	PreviewDeleted PreviewState = "deleted" // the branch was deleted
+)
+
+type PreviewStateFunc func(ctx context.Context, source PreviewSource) (PreviewState, error)
+
+// GetPreviewState checks the pull request, or else the branch, of the preview
+// on its forge.
+func GetPreviewState(ctx context.Context, source PreviewSource) (PreviewState, error) {
+	switch source.Forge {
+	case ForgeGitHub:
+		if source.PullRequest > 0 {
+			state, err := github.GetPullRequestState(ctx, source.Repository, source.PullRequest)
+			if err != nil || state == github.PullRequestOpen {
+				return PreviewOpen, err
+			}
+			return PreviewClosed, nil
+		}
+		return branchState(github.BranchExists(ctx, source.Repository, source.Branch))
+	case ForgeGitLab:
+		if source.PullRequest > 0 {
+			state, err := gitlab.GetMergeRequestState(ctx, source.Repository, source.PullRequest)
+			if err != nil || state == gitlab.MergeRequestOpened || state == gitlab.MergeRequestLocked {
+				return PreviewOpen, err
+			}
+			return PreviewClosed, nil
+		}
+		return branchState(gitlab.BranchExists(ctx, source.Repository, source.Branch))
+	default:
+		return "", fmt.Errorf("unsupported forge %q", source.Forge)
+	}
+}
+
+func branchState(exists bool, err error) (PreviewState, error) {
+	if err != nil || exists {
+		return PreviewOpen, err
+	}
+	return PreviewDeleted, nil
+}
+
+type PreviewStack struct {
+	Stack       string
+	Forge       Forge
+	Repository  string
+	PullRequest int
+	Branch      string
+	State       PreviewState
+}
+
+// FindClosedPreviewStacks returns the preview stacks of the project whose pull
+// requests are closed or whose branches are deleted, and the preview stacks that
+// were skipped because their source is unknown. The source of each stack is
+// recorded in its stack file; for older "pr<N>" stacks, it is taken from the
+// origin of their latest deployment.
+func FindClosedPreviewStacks(ctx context.Context, fabric PreviewStacksLister, getState PreviewStateFunc, projectName string) (closed, unknown []PreviewStack, err error) {
+	resp, err := fabric.ListStacks(ctx, &defangv1.ListStacksRequest{Project: projectName})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list stacks: %w", err)
+	}
+
+	for _, stack := range resp.GetStacks() {
+		var source PreviewSource
+		if params, err := stacks.NewParametersFromContent(stack.Name, stack.StackFile); err != nil {
+			term.Debugf("Failed to parse stack %q: %v", stack.Name, err)
+		} else {
+			source = previewSourceFromVariables(params.Variables)
+		}
+		if match := previewStackNamePattern.FindStringSubmatch(stack.Name); match != nil && source.PullRequest == 0 && source.Branch == "" {
+			source.PullRequest, _ = strconv.Atoi(match[1])
+		}
+		if source.PullRequest == 0 && source.Branch == "" {
+			continue // not a preview stack
+		}
+
+		if source.Forge == "" || source.Repository == "" {
+			source = previewSourceFromLatestDeployment(ctx, fabric, projectName, stack.Name, source)
+		}
+		preview := PreviewStack{
+			Stack:       stack.Name,
+			Forge:       source.Forge,
+			Repository:  source.Repository,
+			PullRequest: source.PullRequest,
+			Branch:      source.Branch,
+		}
+		if source.Forge == "" || source.Repository == "" {
+			term.Warnf("Skipping preview stack %q: it was not deployed from GitHub Actions or GitLab CI, so its pull request is unknown", stack.Name)
+			unknown = append(unknown, preview)
+			continue
+		}
+
+		preview.State, err = getState(ctx, source)
+		if err != nil {
+			term.Warnf("Skipping preview stack %q: %v", stack.Name, err)
+			continue
+		}
+		if preview.State == PreviewOpen {
+			term.Debugf("Keeping preview stack %q: %+v is open", stack.Name, source)
+			continue
+		}
+		closed = append(closed, preview)
+	}
+	return closed, unknown, nil
+}
+
+// previewSourceFromLatestDeployment fills in the forge and repository from the
+// origin of the latest deployment of the stack.
+func previewSourceFromLatestDeployment(ctx context.Context, fabric PreviewStacksLister, projectName, stackName string, source PreviewSource) PreviewSource {
+	deployments, err := fabric.ListDeployments(ctx, &defangv1.ListDeploymentsRequest{
+		Project: projectName,
+		Stack:   stackName,
+		Type:    defangv1.DeploymentType_DEPLOYMENT_TYPE_HISTORY,
+		Limit:   1,
+	})
+	if err != nil {
+		term.Debugf("ListDeployments for stack %q failed: %v", stackName, err)
+		return source
+	}
+	if len(deployments.Deployments) == 0 {
+		return source
+	}
+	deployment := deployments.Deployments[0]
+	switch deployment.Origin {
+	case defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITHUB:
+		source.Forge = ForgeGitHub
+		source.Repository = deployment.OriginMetadata["GITHUB_REPOSITORY"]
+	case defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITLAB:
+		source.Forge = ForgeGitLab
+		source.Repository = deployment.OriginMetadata["CI_PROJECT_PATH"]
+	}
+	return source
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewStackName(t *testing.T) {
+	tests := []struct {
+		pr      int
+		branch  string
+		want    string
+		wantErr bool
+	}{
+		{pr: 123, branch: "feature/x", want: "pr123"},
+		{branch: "feature/Login-Page", want: "featureloginpage"},
+		{branch: "123-fix", want: "br123fix"},
+		{branch: "pr42", want: "brpr42"},
+		{branch: "dependabot/npm_and_yarn/lodash-4.17.21", want: "dependabotb7180b"},
+		{branch: "dependabot/npm_and_yarn/lodash-4.17.22", want: "dependabotad6301"}, // must not collide
+		{branch: "---", wantErr: true},
+		{wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := PreviewStackName(tt.pr, tt.branch)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, stacks.ValidateStackName(got))
+		})
+	}
+}
+
+func TestPreviewSourceFromEnvironment(t *testing.T) {
+	t.Run("github pull request", func(t *testing.T) {
+		t.Setenv("GITHUB_ACTION", "run")
+		t.Setenv("GITLAB_CI", "")
+		t.Setenv("GITHUB_REPOSITORY", "acme/app")
+		t.Setenv("GITHUB_REF_NAME", "42/merge")
+		t.Setenv("GITHUB_HEAD_REF", "feature")
+		assert.Equal(t, PreviewSource{Forge: ForgeGitHub, Repository: "acme/app", PullRequest: 42, Branch: "feature"}, PreviewSourceFromEnvironment())
+	})
+
+	t.Run("github push", func(t *testing.T) {
+		t.Setenv("GITHUB_ACTION", "run")
+		t.Setenv("GITLAB_CI", "")
+		t.Setenv("GITHUB_REPOSITORY", "acme/app")
+		t.Setenv("GITHUB_REF_NAME", "main")
+		t.Setenv("GITHUB_HEAD_REF", "")
+		assert.Equal(t, PreviewSource{Forge: ForgeGitHub, Repository: "acme/app", Branch: "main"}, PreviewSourceFromEnvironment())
+	})
+
+	t.Run("gitlab merge request", func(t *testing.T) {
+		t.Setenv("GITHUB_ACTION", "")
+		t.Setenv("GITLAB_CI", "true")
+		t.Setenv("CI_PROJECT_PATH", "acme/app")
+		t.Setenv("CI_MERGE_REQUEST_IID", "7")
+		t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "fix")
+		assert.Equal(t, PreviewSource{Forge: ForgeGitLab, Repository: "acme/app", PullRequest: 7, Branch: "fix"}, PreviewSourceFromEnvironment())
+	})
+
+	t.Run("not in CI", func(t *testing.T) {
+		t.Setenv("GITHUB_ACTION", "")
+		t.Setenv("GITLAB_CI", "")
+		assert.Equal(t, PreviewSource{}, PreviewSourceFromEnvironment())
+	})
+}
+
+func TestCreatePreviewStack(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, stacks.Directory), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, stacks.Directory, "preview"), []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nDEFANG_RECIPE=affordable\n"), 0644))
+
+	t.Run("missing template", func(t *testing.T) {
+		_, err := CreatePreviewStack(dir, "nope", "pr1", DefaultPreviewTTL, PreviewSource{})
+		assert.ErrorContains(t, err, `template stack "nope" not found`)
+	})
+
+	t.Run("from template", func(t *testing.T) {
+		params, err := CreatePreviewStack(dir, "preview", "pr1", DefaultPreviewTTL, PreviewSource{Forge: ForgeGitLab, Repository: "acme/app", PullRequest: 1, Branch: "fix"})
+		require.NoError(t, err)
+		assert.Equal(t, "pr1", params.Name)
+		assert.Equal(t, "preview", params.Extends)
+		assert.Equal(t, client.ProviderAWS, params.Provider)
+		assert.Equal(t, "us-west-2", params.Region)
+		assert.Equal(t, "3d", params.Variables["DEFANG_TTL"])
+
+		content, err := os.ReadFile(filepath.Join(dir, stacks.Directory, "pr1"))
+		require.NoError(t, err)
+		assert.Equal(t, "EXTENDS=\"preview\"\nDEFANG_PREVIEW_BRANCH=\"fix\"\nDEFANG_PREVIEW_FORGE=\"gitlab\"\nDEFANG_PREVIEW_PR=1\nDEFANG_PREVIEW_REPOSITORY=\"acme/app\"\nDEFANG_TTL=\"3d\"", string(content))
+	})
+
+	t.Run("existing stack", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, stacks.Directory, "pr2"), []byte("EXTENDS=preview\nDEFANG_TTL=1d\n"), 0644))
+		params, err := CreatePreviewStack(dir, "preview", "pr2", DefaultPreviewTTL, PreviewSource{})
+		require.NoError(t, err)
+		assert.Equal(t, "1d", params.Variables["DEFANG_TTL"])
+	})
+}
+
+func TestFormatPreviewComment(t *testing.T) {
+	comment := FormatPreviewComment("pr123", []ServiceLineItem{
+		{Service: "web", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED, Endpoint: "https://web--443.example.com"},
+		{Service: "db", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED, Endpoint: "db.internal"},
+	})
+	assert.Equal(t, "### Defang preview environment `pr123`\n\n"+
+		"| Service | State | Endpoint |\n"+
+		"| --- | --- | --- |\n"+
+		"| web | DEPLOYMENT_COMPLETED | [web--443.example.com](https://web--443.example.com) |\n"+
+		"| db | DEPLOYMENT_COMPLETED | db.internal |\n", comment)
+}
+
+type mockPreviewStacksLister struct {
+	stacks      []*defangv1.Stack
+	deployments map[string][]*defangv1.Deployment
+}
+
+func (m mockPreviewStacksLister) ListStacks(ctx context.Context, req *defangv1.ListStacksRequest) (*defangv1.ListStacksResponse, error) {
+	return &defangv1.ListStacksResponse{Stacks: m.stacks}, nil
+}
+
+func (m mockPreviewStacksLister) ListDeployments(ctx context.Context, req *defangv1.ListDeploymentsRequest) (*defangv1.ListDeploymentsResponse, error) {
+	return &defangv1.ListDeploymentsResponse{Deployments: m.deployments[req.Stack]}, nil
+}
+
+func TestFindClosedPreviewStacks(t *testing.T) {
+	fabric := mockPreviewStacksLister{
+		stacks: []*defangv1.Stack{
+			{Name: "beta", StackFile: []byte("DEFANG_PROVIDER=aws\n")},
+			{Name: "pr1", StackFile: []byte("DEFANG_PREVIEW_FORGE=github\nDEFANG_PREVIEW_REPOSITORY=acme/app\nDEFANG_PREVIEW_PR=1\n")},
+			{Name: "pr2"},
+			{Name: "pr3"},
+			{Name: "pr4", StackFile: []byte("DEFANG_PREVIEW_FORGE=gitlab\nDEFANG_PREVIEW_REPOSITORY=acme/app\nDEFANG_PREVIEW_PR=4\n")},
+			{Name: "pr5"},
+			{Name: "featurex", StackFile: []byte("DEFANG_PREVIEW_FORGE=github\nDEFANG_PREVIEW_REPOSITORY=acme/app\nDEFANG_PREVIEW_BRANCH=feature/x\n")},
+			{Name: "featurey", StackFile: []byte("DEFANG_PREVIEW_FORGE=github\nDEFANG_PREVIEW_REPOSITORY=acme/app\nDEFANG_PREVIEW_BRANCH=feature/y\n")},
+		},
+		deployments: map[string][]*defangv1.Deployment{
+			"pr2": {{Origin: defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITHUB, OriginMetadata: map[string]string{"GITHUB_REPOSITORY": "acme/app"}}},
+			"pr3": {{Origin: defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_GITLAB, OriginMetadata: map[string]string{"CI_PROJECT_PATH": "acme/app"}}},
+			"pr5": {{Origin: defangv1.DeploymentOrigin_DEPLOYMENT_ORIGIN_NOT_SPECIFIED}},
+		},
+	}
+	var checked []PreviewSource
+	getState := func(ctx context.Context, source PreviewSource) (PreviewState, error) {
+		checked = append(checked, source)
+		switch {
+		case source.Branch == "feature/x":
+			return PreviewDeleted, nil
+		case source.Branch != "":
+			return PreviewOpen, nil
+		case source.PullRequest == 2:
+			return PreviewOpen, nil
+		case source.PullRequest == 4:
+			return "", errors.New("not found")
+		}
+		return PreviewClosed, nil
+	}
+
+	closed, unknown, err := FindClosedPreviewStacks(t.Context(), fabric, getState, "app")
+	require.NoError(t, err)
+	assert.Equal(t, []PreviewStack{
+		{Stack: "pr1", Forge: ForgeGitHub, Repository: "acme/app", PullRequest: 1, State: PreviewClosed},
+		{Stack: "pr3", Forge: ForgeGitLab, Repository: "acme/app", PullRequest: 3, State: PreviewClosed},
+		{Stack: "featurex", Forge: ForgeGitHub, Repository: "acme/app", Branch: "feature/x", State: PreviewDeleted},
+	}, closed)
+	assert.Equal(t, []PreviewStack{
+		{Stack: "pr5", PullRequest: 5},
+	}, unknown)
+	assert.Equal(t, []PreviewSource{
+		{Forge: ForgeGitHub, Repository: "acme/app", PullRequest: 1},
+		{Forge: ForgeGitHub, Repository: "acme/app", PullRequest: 2},
+		{Forge: ForgeGitLab, Repository: "acme/app", PullRequest: 3},
+		{Forge: ForgeGitLab, Repository: "acme/app", PullRequest: 4},
+		{Forge: ForgeGitHub, Repository: "acme/app", Branch: "feature/x"},
+		{Forge: ForgeGitHub, Repository: "acme/app", Branch: "feature/y"},
+	}, checked, "each stack must be checked on the forge it was deployed from")
+}
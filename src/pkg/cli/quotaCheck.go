@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/quota"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+var ErrQuotaExceeded = errors.New("the project exceeds the service quotas of the cloud account")
+
+type quotaUsageRow struct {
+	Quota     string
+	Region    string
+	Requested string
+	Used      string
+	Limit     string
+	Status    string
+	Increase  string
+}
+
+func formatQuota(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func makeQuotaUsageRow(q client.QuotaUsage) quotaUsageRow {
+	row := quotaUsageRow{
+		Quota:     q.Name,
+		Region:    q.Region,
+		Requested: formatQuota(q.Requested),
+		Used:      "unknown",
+		Limit:     formatQuota(q.Limit),
+		Status:    "ok",
+	}
+	if q.Used >= 0 {
+		row.Used = formatQuota(q.Used)
+	}
+	if q.Exceeded() {
+		row.Status = "exceeded"
+		row.Increase = q.IncreaseURL
+	} else if q.Requested > q.Available() {
+		row.Status = "in use" // fits, unless the quota is used by other deployments
+		row.Increase = q.IncreaseURL
+	}
+	return row
+}
+
+func printQuotaUsage(usages []client.QuotaUsage, shortfallsOnly bool) error {
+	var rows []quotaUsageRow
+	for _, q := range usages {
+		row := makeQuotaUsageRow(q)
+		if shortfallsOnly && row.Status == "ok" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return term.Table(rows, "Quota", "Region", "Requested", "Used", "Limit", "Status", "Increase")
+}
+
+func getQuotaUsage(ctx context.Context, checker client.QuotaChecker, project *compose.Project) ([]client.QuotaUsage, error) {
+	demand := quota.ProjectDemand(project)
+	term.Debugf("Project %q requests %+v", project.Name, demand)
+	return checker.GetQuotaUsage(ctx, demand)
+}
+
+// QuotaCheck prints the live service quotas of the cloud account that apply to
+// the project, and returns ErrQuotaExceeded if the project can never fit.
+func QuotaCheck(ctx context.Context, provider client.Provider, project *compose.Project) error {
+	checker, ok := provider.(client.QuotaChecker)
+	if !ok {
+		return errors.New("quota checks are only supported for BYOC AWS, GCP, and Azure")
+	}
+	usages, err := getQuotaUsage(ctx, checker, project)
+	if err != nil {
+		return fmt.Errorf("failed to get service quotas: %w", err)
+	}
+	if len(usages) == 0 {
+		term.Infof("Project %q does not use any of the checked service quotas", project.Name)
+		return nil
+	}
+	if err := printQuotaUsage(usages, false); err != nil {
+		return err
+	}
+	for _, q := range usages {
+		if q.Exceeded() {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// PreflightQuotaCheck checks the project against the live service quotas of the
+// cloud account before the CD task starts. Only shortfalls are printed; a
+// failure to get the quotas is not fatal.
+func PreflightQuotaCheck(ctx context.Context, provider client.Provider, project *compose.Project) error {
+	checker, ok := provider.(client.QuotaChecker)
+	if !ok {
+		return nil
+	}
+	usages, err := getQuotaUsage(ctx, checker, project)
+	if err != nil {
+		term.Warn("Skipping the service quota check:", err)
+		return nil
+	}
+	var exceeded, inUse bool
+	for _, q := range usages {
+		if q.Exceeded() {
+			exceeded = true
+		} else if q.Requested > q.Available() {
+			inUse = true
+		}
+	}
+	if !exceeded && !inUse {
+		return nil
+	}
+	if exceeded {
+		term.Error("The project needs more than the service quotas of the cloud account allow:")
+	} else {
+		term.Warn("The project might not fit in the unused service quotas of the cloud account:")
+	}
+	if err := printQuotaUsage(usages, true); err != nil {
+		return err
+	}
+	if exceeded {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
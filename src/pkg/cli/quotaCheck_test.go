@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	composeTypes "github.com/compose-spec/compose-go/v2/types"
+)
+
+type mockQuotaChecker struct {
+	client.Provider
+	usages []client.QuotaUsage
+	err    error
+	demand client.QuotaDemand
+}
+
+func (m *mockQuotaChecker) GetQuotaUsage(ctx context.Context, demand client.QuotaDemand) ([]client.QuotaUsage, error) {
+	m.demand = demand
+	return m.usages, m.err
+}
+
+func TestPreflightQuotaCheck(t *testing.T) {
+	project := &compose.Project{
+		Name:     "app",
+		Services: composeTypes.Services{"web": {Name: "web"}},
+	}
+	const increaseURL = "https://example.com/increase"
+
+	tests := []struct {
+		name    string
+		checker *mockQuotaChecker
+		wantErr error
+		wantOut []string
+	}{
+		{
+			name:    "ok",
+			checker: &mockQuotaChecker{usages: []client.QuotaUsage{{Name: "vCPUs", Requested: 1, Used: 2, Limit: 6}}},
+		},
+		{
+			name:    "exceeded",
+			checker: &mockQuotaChecker{usages: []client.QuotaUsage{{Name: "GPUs", Region: "us-central1", Requested: 1, Used: 0, Limit: 0, IncreaseURL: increaseURL}}},
+			wantErr: ErrQuotaExceeded,
+			wantOut: []string{"GPUs", "us-central1", "exceeded", increaseURL},
+		},
+		{
+			name:    "in use",
+			checker: &mockQuotaChecker{usages: []client.QuotaUsage{{Name: "vCPUs", Requested: 4, Used: 4, Limit: 6, IncreaseURL: increaseURL}}},
+			wantOut: []string{"vCPUs", "in use", increaseURL},
+		},
+		{
+			name:    "lookup failure is not fatal",
+			checker: &mockQuotaChecker{err: errors.New("access denied")},
+			wantOut: []string{"access denied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := term.SetupTestTerm(t)
+			err := PreflightQuotaCheck(t.Context(), tt.checker, project)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PreflightQuotaCheck() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.checker.demand.Cpus == 0 {
+				t.Error("expected the demand of the project")
+			}
+			out := stdout.String() + stderr.String()
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in output: %s", want, out)
+				}
+			}
+			if tt.wantOut == nil && out != "" {
+				t.Errorf("unexpected output: %s", out)
+			}
+		})
+	}
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		if err := PreflightQuotaCheck(t.Context(), MockConfigDeleteProvider{}, project); err != nil {
+			t.Errorf("PreflightQuotaCheck() error = %v", err)
+		}
+		if err := QuotaCheck(t.Context(), MockConfigDeleteProvider{}, project); err == nil {
+			t.Error("expected error for unsupported provider")
+		}
+	})
+}
@@ -0,0 +1,520 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/logs"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/types"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+type ReportFormat string
+
+const (
+	ReportFormatJUnit         ReportFormat = "junit"
+	ReportFormatJSON          ReportFormat = "json"
+	ReportFormatGitHubSummary ReportFormat = "github-summary"
+)
+
+// logExcerptLines is the number of log lines in the report of a failed service
+const logExcerptLines = 20
+
+type ReportTarget struct {
+	Format ReportFormat
+	Path   string
+}
+
+// ParseReportTargets parses the --report flags, like "junit:report.xml",
+// "json:report.json" or "github-summary"; the GitHub summary is written to the
+// file in $GITHUB_STEP_SUMMARY.
+func ParseReportTargets(specs []string) ([]ReportTarget, error) {
+	var targets []ReportTarget
+	for _, spec := range specs {
+		format, path, _ := strings.Cut(spec, ":")
+		target := ReportTarget{Format: ReportFormat(format), Path: path}
+		switch target.Format {
+		case ReportFormatJUnit, ReportFormatJSON:
+			if path == "" {
+				return nil, fmt.Errorf("invalid report %q: expected %s:<path>", spec, format)
+			}
+		case ReportFormatGitHubSummary:
+			if path != "" {
+				return nil, fmt.Errorf("invalid report %q: the GitHub summary is written to $GITHUB_STEP_SUMMARY", spec)
+			}
+			target.Path = os.Getenv("GITHUB_STEP_SUMMARY")
+			if target.Path == "" {
+				return nil, errors.New("cannot write the GitHub summary: GITHUB_STEP_SUMMARY is not set")
+			}
+		default:
+			return nil, fmt.Errorf("invalid report %q: the format must be one of junit, json, or github-summary", spec)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+type ReportOutcome string
+
+const (
+	ReportOutcomePassed  ReportOutcome = "passed"
+	ReportOutcomeFailed  ReportOutcome = "failed"
+	ReportOutcomeSkipped ReportOutcome = "skipped" // the service is not monitored
+)
+
+// DeployReport is the outcome of "compose up" or "compose down" for CI, with
+// one entry per service.
+type DeployReport struct {
+	Project         string          `json:"project"`
+	Stack           string          `json:"stack,omitempty"`
+	Action          string          `json:"action"`     // "up" or "down"
+	Deployment      types.ETag      `json:"deployment"` // the deployment ID
+	Started         time.Time       `json:"started"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Outcome         ReportOutcome   `json:"outcome"`
+	Error           string          `json:"error,omitempty"`
+	LogExcerpt      []string        `json:"logExcerpt,omitempty"` // the CD logs, if the CD task failed
+	Services        []ServiceReport `json:"services"`
+}
+
+type ServiceReport struct {
+	Name                 string        `json:"name"`
+	Etag                 types.ETag    `json:"etag,omitempty"`
+	Outcome              ReportOutcome `json:"outcome"`
+	State                string        `json:"state,omitempty"` // the final ServiceState
+	Status               string        `json:"status,omitempty"`
+	BuildSeconds         float64       `json:"buildSeconds,omitempty"`
+	TimeToHealthySeconds float64       `json:"timeToHealthySeconds,omitempty"` // since the deployment started
+	Endpoints            []string      `json:"endpoints,omitempty"`
+	Error                string        `json:"error,omitempty"`
+	LogExcerpt           []string      `json:"logExcerpt,omitempty"`
+}
+
+type serviceTimeline struct {
+	state         defangv1.ServiceState
+	status        string
+	buildStarted  time.Time
+	buildFinished time.Time
+	healthy       time.Time
+}
+
+// DeployRecorder records when the services of a deployment change state; pass
+// its OnServiceUpdate method in the TailOptions of TailAndMonitor.
+type DeployRecorder struct {
+	started  time.Time
+	mu       sync.Mutex
+	services map[string]*serviceTimeline
+}
+
+func NewDeployRecorder(started time.Time) *DeployRecorder {
+	return &DeployRecorder{started: started, services: make(map[string]*serviceTimeline)}
+}
+
+func (r *DeployRecorder) OnServiceUpdate(msg *defangv1.SubscribeResponse) {
+	r.record(msg, time.Now())
+}
+
+func (r *DeployRecorder) record(msg *defangv1.SubscribeResponse, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	timeline, ok := r.services[msg.Name]
+	if !ok {
+		timeline = &serviceTimeline{}
+		r.services[msg.Name] = timeline
+	}
+	timeline.state = msg.State
+	timeline.status = msg.Status
+	switch msg.State {
+	case defangv1.ServiceState_BUILD_QUEUED, defangv1.ServiceState_BUILD_PROVISIONING, defangv1.ServiceState_BUILD_PENDING,
+		defangv1.ServiceState_BUILD_ACTIVATING, defangv1.ServiceState_BUILD_RUNNING, defangv1.ServiceState_BUILD_STOPPING:
+		if timeline.buildStarted.IsZero() {
+			timeline.buildStarted = now
+		}
+	default:
+		if !timeline.buildStarted.IsZero() && timeline.buildFinished.IsZero() {
+			timeline.buildFinished = now
+		}
+		if msg.State == defangv1.ServiceState_DEPLOYMENT_COMPLETED && timeline.healthy.IsZero() {
+			timeline.healthy = now
+		}
+	}
+}
+
+func (r *DeployRecorder) serviceReport(name string) ServiceReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := ServiceReport{Name: name}
+	timeline, ok := r.services[name]
+	if !ok {
+		return report
+	}
+	report.State = timeline.state.String()
+	report.Status = timeline.status
+	if !timeline.buildFinished.IsZero() {
+		report.BuildSeconds = seconds(timeline.buildFinished.Sub(timeline.buildStarted))
+	}
+	if !timeline.healthy.IsZero() {
+		report.TimeToHealthySeconds = seconds(timeline.healthy.Sub(r.started))
+	}
+	return report
+}
+
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+func serviceEndpoints(serviceInfo *defangv1.ServiceInfo) []string {
+	endpoints := slices.Clone(serviceInfo.Endpoints)
+	if serviceInfo.Domainname != "" {
+		endpoints = append([]string{"https://" + serviceInfo.Domainname}, endpoints...)
+	}
+	return endpoints
+}
+
+// MakeUpReport describes the outcome of "compose up" from the deployed services
+// and their recorded states; deployErr is the error from TailAndMonitor. The
+// logs of failed services are queried from the provider.
+func MakeUpReport(ctx context.Context, provider client.Provider, project *compose.Project, stack string, deploy *defangv1.DeployResponse, recorder *DeployRecorder, deployErr error) *DeployReport {
+	report := &DeployReport{
+		Project:    project.Name,
+		Stack:      stack,
+		Action:     "up",
+		Deployment: deploy.GetEtag(),
+		Started:    recorder.started.UTC(),
+		Outcome:    ReportOutcomePassed,
+	}
+	report.DurationSeconds = seconds(time.Since(recorder.started))
+
+	var failedService string
+	var deploymentFailed client.ErrDeploymentFailed
+	if errors.As(deployErr, &deploymentFailed) {
+		failedService = deploymentFailed.Service
+	}
+
+	for _, serviceInfo := range deploy.GetServices() {
+		service := recorder.serviceReport(serviceInfo.Service.Name)
+		service.Etag = serviceInfo.Etag
+		service.Endpoints = serviceEndpoints(serviceInfo)
+		serviceConfig, monitored := project.Services[service.Name]
+		monitored = monitored && CanMonitorService(&serviceConfig)
+		switch state := service.State; {
+		case state == defangv1.ServiceState_BUILD_FAILED.String(), state == defangv1.ServiceState_DEPLOYMENT_FAILED.String(), service.Name == failedService:
+			service.Outcome = ReportOutcomeFailed
+			service.Error = service.Status
+			if service.Name == failedService && service.Error == "" {
+				service.Error = deploymentFailed.Message
+			}
+			service.LogExcerpt = logExcerpt(ctx, provider, project.Name, report.Deployment, service.Name, state == defangv1.ServiceState_BUILD_FAILED.String())
+		case state == defangv1.ServiceState_DEPLOYMENT_COMPLETED.String():
+			service.Outcome = ReportOutcomePassed
+		case !monitored:
+			service.Outcome = ReportOutcomeSkipped
+		case deployErr == nil:
+			service.Outcome = ReportOutcomePassed // all monitored services reached the target state
+		default:
+			service.Outcome = ReportOutcomeFailed
+			service.Error = "the service did not finish deploying"
+		}
+		report.Services = append(report.Services, service)
+	}
+
+	if deployErr != nil {
+		report.Outcome = ReportOutcomeFailed
+		report.Error = deployErr.Error()
+		if failedService == "" && report.Deployment != "" {
+			// Not a service failure, so the CD task might have failed
+			report.LogExcerpt = logExcerpt(ctx, provider, project.Name, report.Deployment, "", false)
+		}
+	}
+	return report
+}
+
+// MakeDownReport describes the outcome of "compose down" for the services that
+// were deployed before; downErr is the error from TailAndWaitForCD.
+func MakeDownReport(ctx context.Context, provider client.Provider, projectName, stack string, deployment types.ETag, serviceInfos []*defangv1.ServiceInfo, started time.Time, downErr error) *DeployReport {
+	report := &DeployReport{
+		Project:         projectName,
+		Stack:           stack,
+		Action:          "down",
+		Deployment:      deployment,
+		Started:         started.UTC(),
+		DurationSeconds: seconds(time.Since(started)),
+		Outcome:         ReportOutcomePassed,
+	}
+	if downErr != nil {
+		report.Outcome = ReportOutcomeFailed
+		report.Error = downErr.Error()
+		report.LogExcerpt = logExcerpt(ctx, provider, projectName, deployment, "", false)
+	}
+	for _, serviceInfo := range serviceInfos {
+		service := ServiceReport{
+			Name:      serviceInfo.Service.Name,
+			Etag:      serviceInfo.Etag,
+			Outcome:   report.Outcome,
+			Endpoints: serviceEndpoints(serviceInfo),
+			Error:     report.Error,
+		}
+		report.Services = append(report.Services, service)
+	}
+	return report
+}
+
+// logExcerpt returns the last log lines of the service, or of the CD task if
+// service is empty; failures are only logged, since the report is best effort.
+func logExcerpt(ctx context.Context, provider client.Provider, projectName string, deployment types.ETag, service string, build bool) []string {
+	options := TailOptions{
+		Deployment: deployment,
+		Limit:      logExcerptLines,
+		LogType:    logs.LogTypeAll,
+		Raw:        true,
+		Verbose:    true,
+	}
+	switch {
+	case service == "":
+		options.LogType = logs.LogTypeCD
+	case build:
+		options.Services = []string{service + logs.BuildServiceNameSuffix}
+	default:
+		options.Services = []string{service}
+	}
+	var lines []string
+	err := streamLogs(ctx, provider, projectName, options, func(entry *defangv1.LogEntry, _ *TailOptions, _ *term.Term) error {
+		lines = append(lines, strings.TrimRight(entry.Message, "\n"))
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		term.Debug("Failed to get the logs for the report:", err)
+	}
+	if len(lines) > logExcerptLines {
+		lines = lines[len(lines)-logExcerptLines:]
+	}
+	return lines
+}
+
+// WriteReports writes the report in each of the requested formats.
+func WriteReports(targets []ReportTarget, report *DeployReport) error {
+	var errs []error
+	for _, target := range targets {
+		var err error
+		switch target.Format {
+		case ReportFormatJUnit:
+			err = writeReportFile(target.Path, report, writeJUnitReport, os.O_TRUNC)
+		case ReportFormatJSON:
+			err = writeReportFile(target.Path, report, writeJSONReport, os.O_TRUNC)
+		case ReportFormatGitHubSummary:
+			// Steps share the summary file, so append to it
+			err = writeReportFile(target.Path, report, writeMarkdownReport, os.O_APPEND)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to write the %s report: %w", target.Format, err))
+		} else if target.Format != ReportFormatGitHubSummary {
+			term.Infof("Wrote the %s report to %s", target.Format, target.Path)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeReportFile(path string, report *DeployReport, write func(io.Writer, *DeployReport) error, flag int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeJSONReport(w io.Writer, report *DeployReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+	SystemErr  string          `xml:"system-err,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+func writeJUnitReport(w io.Writer, report *DeployReport) error {
+	suite := junitTestSuite{
+		Name:      report.Project,
+		Time:      formatSeconds(report.DurationSeconds),
+		Timestamp: report.Started.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "action", Value: report.Action},
+			{Name: "deployment", Value: report.Deployment},
+			{Name: "stack", Value: report.Stack},
+		},
+		SystemErr: strings.Join(report.LogExcerpt, "\n"),
+	}
+	if report.Error != "" {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "error", Value: report.Error})
+	}
+	for _, service := range report.Services {
+		testCase := junitTestCase{
+			Name:      service.Name,
+			ClassName: report.Project + "." + report.Action,
+			Time:      formatSeconds(service.TimeToHealthySeconds),
+		}
+		var out []string
+		if service.Etag != "" {
+			out = append(out, "etag: "+service.Etag)
+		}
+		if service.State != "" {
+			out = append(out, "state: "+service.State)
+		}
+		if service.BuildSeconds > 0 {
+			out = append(out, "build duration: "+formatSeconds(service.BuildSeconds)+"s")
+		}
+		if service.TimeToHealthySeconds > 0 {
+			out = append(out, "time to healthy: "+formatSeconds(service.TimeToHealthySeconds)+"s")
+		}
+		for _, endpoint := range service.Endpoints {
+			out = append(out, "endpoint: "+endpoint)
+		}
+		testCase.SystemOut = strings.Join(out, "\n")
+		switch service.Outcome {
+		case ReportOutcomeFailed:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: service.Error, Type: service.State, Text: strings.Join(service.LogExcerpt, "\n")}
+		case ReportOutcomeSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: "the service is not monitored"}
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if report.Stack != "" {
+		suite.Name += "/" + report.Stack
+	}
+
+	suites := junitTestSuites{
+		Name:     "defang compose " + report.Action,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// markdownCell escapes the characters that would break a markdown table
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func formatReportSeconds(s float64) string {
+	if s <= 0 {
+		return ""
+	}
+	return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+}
+
+func writeMarkdownReport(w io.Writer, report *DeployReport) error {
+	var sb strings.Builder
+	title := report.Project
+	if report.Stack != "" {
+		title += " (" + report.Stack + ")"
+	}
+	fmt.Fprintf(&sb, "### defang compose %s: %s %s\n\n", report.Action, title, report.Outcome)
+	if report.Deployment != "" {
+		fmt.Fprintf(&sb, "Deployment `%s` took %s.\n\n", report.Deployment, formatReportSeconds(report.DurationSeconds))
+	}
+	if report.Error != "" {
+		fmt.Fprintf(&sb, "> %s\n\n", markdownCell(report.Error))
+	}
+	if len(report.Services) > 0 {
+		sb.WriteString("| Service | Outcome | State | Build | Time to healthy | Endpoints |\n")
+		sb.WriteString("|---|---|---|---|---|---|\n")
+		for _, service := range report.Services {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s |\n",
+				markdownCell(service.Name),
+				service.Outcome,
+				service.State,
+				formatReportSeconds(service.BuildSeconds),
+				formatReportSeconds(service.TimeToHealthySeconds),
+				markdownCell(strings.Join(service.Endpoints, " ")),
+			)
+		}
+		sb.WriteString("\n")
+	}
+	writeLogs := func(name string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "<details><summary>Logs of %s</summary>\n\n```\n%s\n```\n\n</details>\n\n", name, strings.Join(lines, "\n"))
+	}
+	for _, service := range report.Services {
+		writeLogs(service.Name, service.LogExcerpt)
+	}
+	writeLogs("the CD task", report.LogExcerpt)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type reportLogProvider struct {
+	client.MockProvider
+	reqs []*defangv1.TailRequest
+}
+
+func (p *reportLogProvider) QueryLogs(ctx context.Context, req *defangv1.TailRequest) (iter.Seq2[*defangv1.TailResponse, error], error) {
+	p.reqs = append(p.reqs, req)
+	return client.MockIter([]*defangv1.TailResponse{{
+		Entries: []*defangv1.LogEntry{
+			{Message: "step 1", Timestamp: timestamppb.Now()},
+			{Message: "error: boom\n", Timestamp: timestamppb.Now(), Stderr: true},
+		},
+	}}, nil), nil
+}
+
+func TestParseReportTargets(t *testing.T) {
+	t.Setenv("GITHUB_STEP_SUMMARY", "/tmp/summary.md")
+
+	targets, err := ParseReportTargets([]string{"junit:out/report.xml", "json:c:report.json", "github-summary"})
+	if err != nil {
+		t.Fatalf("ParseReportTargets() error = %v", err)
+	}
+	want := []ReportTarget{
+		{Format: ReportFormatJUnit, Path: "out/report.xml"},
+		{Format: ReportFormatJSON, Path: "c:report.json"},
+		{Format: ReportFormatGitHubSummary, Path: "/tmp/summary.md"},
+	}
+	if len(targets) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(targets), len(want))
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("target %d = %+v, want %+v", i, targets[i], want[i])
+		}
+	}
+
+	for _, spec := range []string{"junit", "json:", "xml:report.xml", "github-summary:summary.md"} {
+		if _, err := ParseReportTargets([]string{spec}); err == nil {
+			t.Errorf("ParseReportTargets(%q) expected an error", spec)
+		}
+	}
+
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	if _, err := ParseReportTargets([]string{"github-summary"}); err == nil {
+		t.Error("expected an error without GITHUB_STEP_SUMMARY")
+	}
+}
+
+func TestDeployRecorder(t *testing.T) {
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder := NewDeployRecorder(started)
+	updates := []struct {
+		offset time.Duration
+		name   string
+		state  defangv1.ServiceState
+	}{
+		{5 * time.Second, "app", defangv1.ServiceState_BUILD_QUEUED},
+		{10 * time.Second, "app", defangv1.ServiceState_BUILD_RUNNING},
+		{65 * time.Second, "app", defangv1.ServiceState_DEPLOYMENT_PENDING},
+		{90 * time.Second, "app", defangv1.ServiceState_DEPLOYMENT_COMPLETED},
+		{95 * time.Second, "db", defangv1.ServiceState_UPDATE_QUEUED},
+		{99 * time.Second, "db", defangv1.ServiceState_DEPLOYMENT_FAILED},
+	}
+	for _, u := range updates {
+		recorder.record(&defangv1.SubscribeResponse{Name: u.name, State: u.state, Status: "status of " + u.name}, started.Add(u.offset))
+	}
+
+	app := recorder.serviceReport("app")
+	if app.State != "DEPLOYMENT_COMPLETED" {
+		t.Errorf("app state = %q", app.State)
+	}
+	if app.BuildSeconds != 60 {
+		t.Errorf("app build = %v, want 60", app.BuildSeconds)
+	}
+	if app.TimeToHealthySeconds != 90 {
+		t.Errorf("app time to healthy = %v, want 90", app.TimeToHealthySeconds)
+	}
+
+	db := recorder.serviceReport("db")
+	if db.State != "DEPLOYMENT_FAILED" || db.Status != "status of db" {
+		t.Errorf("db = %+v", db)
+	}
+	if db.BuildSeconds != 0 || db.TimeToHealthySeconds != 0 {
+		t.Errorf("db should have no durations: %+v", db)
+	}
+
+	if none := recorder.serviceReport("none"); none.State != "" {
+		t.Errorf("unknown service state = %q", none.State)
+	}
+}
+
+func TestMakeUpReport(t *testing.T) {
+	project := &compose.Project{
+		Name: "proj",
+		Services: compose.Services{
+			"app": compose.ServiceConfig{Name: "app"},
+			"db":  compose.ServiceConfig{Name: "db"},
+			"job": compose.ServiceConfig{Name: "job", Restart: "no"},
+		},
+	}
+	deploy := &defangv1.DeployResponse{
+		Etag: "abc123",
+		Services: []*defangv1.ServiceInfo{
+			{Service: &defangv1.Service{Name: "app"}, Etag: "abc123", Endpoints: []string{"app--3000.example.com"}, Domainname: "app.example.com"},
+			{Service: &defangv1.Service{Name: "db"}, Etag: "abc123"},
+			{Service: &defangv1.Service{Name: "job"}, Etag: "abc123"},
+		},
+	}
+	recorder := NewDeployRecorder(time.Now())
+	recorder.OnServiceUpdate(&defangv1.SubscribeResponse{Name: "app", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED})
+	recorder.OnServiceUpdate(&defangv1.SubscribeResponse{Name: "db", State: defangv1.ServiceState_DEPLOYMENT_FAILED, Status: "exit code 1"})
+
+	provider := &reportLogProvider{}
+	deployErr := client.ErrDeploymentFailed{Service: "db", Message: "exit code 1"}
+	report := MakeUpReport(t.Context(), provider, project, "beta", deploy, recorder, deployErr)
+
+	if report.Outcome != ReportOutcomeFailed || report.Deployment != "abc123" || report.Stack != "beta" {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.LogExcerpt) != 0 {
+		t.Errorf("expected no CD logs for a service failure, got %q", report.LogExcerpt)
+	}
+	outcomes := map[string]ReportOutcome{}
+	for _, service := range report.Services {
+		outcomes[service.Name] = service.Outcome
+	}
+	want := map[string]ReportOutcome{"app": ReportOutcomePassed, "db": ReportOutcomeFailed, "job": ReportOutcomeSkipped}
+	for name, outcome := range want {
+		if outcomes[name] != outcome {
+			t.Errorf("service %q outcome = %q, want %q", name, outcomes[name], outcome)
+		}
+	}
+
+	app, db := report.Services[0], report.Services[1]
+	if strings.Join(app.Endpoints, " ") != "https://app.example.com app--3000.example.com" {
+		t.Errorf("app endpoints = %q", app.Endpoints)
+	}
+	if db.Error != "exit code 1" {
+		t.Errorf("db error = %q", db.Error)
+	}
+	if strings.Join(db.LogExcerpt, "|") != "step 1|error: boom" {
+		t.Errorf("db logs = %q", db.LogExcerpt)
+	}
+	if len(provider.reqs) != 1 || provider.reqs[0].Etag != "abc123" || strings.Join(provider.reqs[0].Services, ",") != "db" {
+		t.Errorf("unexpected log queries: %v", provider.reqs)
+	}
+}
+
+func TestMakeDownReport(t *testing.T) {
+	services := []*defangv1.ServiceInfo{{Service: &defangv1.Service{Name: "app"}, Etag: "old"}}
+	report := MakeDownReport(t.Context(), &reportLogProvider{}, "proj", "", "abc123", services, time.Now(), nil)
+	if report.Action != "down" || report.Outcome != ReportOutcomePassed || len(report.LogExcerpt) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Services) != 1 || report.Services[0].Outcome != ReportOutcomePassed {
+		t.Errorf("services = %+v", report.Services)
+	}
+
+	report = MakeDownReport(t.Context(), &reportLogProvider{}, "proj", "", "abc123", services, time.Now(), client.ErrDeploymentFailed{Message: "CD failed"})
+	if report.Outcome != ReportOutcomeFailed || len(report.LogExcerpt) != 2 || report.Services[0].Outcome != ReportOutcomeFailed {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func testReport() *DeployReport {
+	return &DeployReport{
+		Project:         "proj",
+		Stack:           "beta",
+		Action:          "up",
+		Deployment:      "abc123",
+		Started:         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		DurationSeconds: 120,
+		Outcome:         ReportOutcomeFailed,
+		Error:           `deployment failed for service "db": exit code 1`,
+		Services: []ServiceReport{
+			{Name: "app", Etag: "abc123", Outcome: ReportOutcomePassed, State: "DEPLOYMENT_COMPLETED", BuildSeconds: 60, TimeToHealthySeconds: 90, Endpoints: []string{"https://app.example.com"}},
+			{Name: "db", Etag: "abc123", Outcome: ReportOutcomeFailed, State: "DEPLOYMENT_FAILED", Error: "exit code 1", LogExcerpt: []string{"error: boom"}},
+			{Name: "job", Etag: "abc123", Outcome: ReportOutcomeSkipped},
+		},
+	}
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, testReport()); err != nil {
+		t.Fatalf("writeJUnitReport() error = %v", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Skipped != 1 {
+		t.Errorf("testsuites counts = %d/%d/%d", suites.Tests, suites.Failures, suites.Skipped)
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "proj/beta" || len(suite.Cases) != 3 {
+		t.Fatalf("testsuite = %+v", suite)
+	}
+	if app := suite.Cases[0]; app.Failure != nil || app.Time != "90.000" || !strings.Contains(app.SystemOut, "build duration: 60.000s") {
+		t.Errorf("app = %+v", app)
+	}
+	if db := suite.Cases[1]; db.Failure == nil || db.Failure.Message != "exit code 1" || db.Failure.Text != "error: boom" {
+		t.Errorf("db = %+v", db)
+	}
+	if job := suite.Cases[2]; job.Skipped == nil {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	dir := t.TempDir()
+	summary := filepath.Join(dir, "summary.md")
+	if err := os.WriteFile(summary, []byte("# Previous step\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	targets := []ReportTarget{
+		{Format: ReportFormatJSON, Path: filepath.Join(dir, "report.json")},
+		{Format: ReportFormatJUnit, Path: filepath.Join(dir, "report.xml")},
+		{Format: ReportFormatGitHubSummary, Path: summary},
+	}
+	if err := WriteReports(targets, testReport()); err != nil {
+		t.Fatalf("WriteReports() error = %v", err)
+	}
+
+	data, err := os.ReadFile(targets[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"deployment": "abc123"`, `"timeToHealthySeconds": 90`, `"outcome": "skipped"`} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("JSON report does not contain %s:\n%s", want, data)
+		}
+	}
+
+	markdown, err := os.ReadFile(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Previous step\n", // appended, not overwritten
+		"### defang compose up: proj (beta) failed",
+		"| app | passed | DEPLOYMENT_COMPLETED | 1m0s | 1m30s | https://app.example.com |",
+		"<details><summary>Logs of db</summary>",
+	} {
+		if !bytes.Contains(markdown, []byte(want)) {
+			t.Errorf("summary does not contain %q:\n%s", want, markdown)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/dryrun"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+// SetUpCI sets up (or with teardown, removes) the keyless trust that lets a
+// GitHub Actions workflow deploy the provider's stack, and prints the variables
+// the workflow needs.
+func SetUpCI(ctx context.Context, provider client.Provider, req client.CIRequest, teardown bool) error {
+	ci, ok := provider.(client.CIProvider)
+	if !ok {
+		return errors.New("setting up CI is only supported for BYOC AWS, GCP, and Azure")
+	}
+	req.DryRun = dryrun.DoDryRun
+
+	var resp *client.CIResponse
+	var err error
+	if teardown {
+		resp, err = ci.TearDownCI(ctx, req)
+	} else {
+		resp, err = ci.SetUpCI(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if req.DryRun {
+		prefix = "[dry run] "
+	}
+	for _, action := range resp.Actions {
+		term.Info(prefix + action)
+	}
+	if teardown && len(resp.Actions) == 0 {
+		term.Info("Nothing to tear down")
+	}
+
+	if len(resp.Env) > 0 {
+		term.Info("Add these to the env of the GitHub Actions workflow, which needs the permission \"id-token: write\":")
+		term.Println("env:")
+		for _, k := range slices.Sorted(maps.Keys(resp.Env)) {
+			term.Printf("  %s: %s\n", k, resp.Env[k])
+		}
+	}
+
+	if req.DryRun {
+		return dryrun.ErrDryRun
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/dryrun"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+type mockCIProvider struct {
+	client.Provider
+	teardown bool
+	dryRun   bool
+}
+
+func (m *mockCIProvider) SetUpCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	m.dryRun = req.DryRun
+	resp := &client.CIResponse{Env: map[string]string{"B_VAR": "b", "A_VAR": "a"}}
+	resp.Addf("create role for %s", req.Subject())
+	return resp, nil
+}
+
+func (m *mockCIProvider) TearDownCI(ctx context.Context, req client.CIRequest) (*client.CIResponse, error) {
+	m.teardown = true
+	return &client.CIResponse{}, nil
+}
+
+func TestSetUpCI(t *testing.T) {
+	ctx := t.Context()
+	req := client.CIRequest{Project: "app", Repo: "acme/app", Branch: "main"}
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		if err := SetUpCI(ctx, MockConfigDeleteProvider{}, req, false); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("set up", func(t *testing.T) {
+		stdout, _ := term.SetupTestTerm(t)
+		if err := SetUpCI(ctx, &mockCIProvider{}, req, false); err != nil {
+			t.Fatalf("SetUpCI() error = %v", err)
+		}
+		out := stdout.String()
+		if !strings.Contains(out, "create role for repo:acme/app:ref:refs/heads/main") {
+			t.Errorf("missing action in output: %q", out)
+		}
+		if !strings.Contains(out, "  A_VAR: a\n  B_VAR: b\n") {
+			t.Errorf("env not sorted in output: %q", out)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		term.SetupTestTerm(t)
+		dryrun.DoDryRun = true
+		t.Cleanup(func() { dryrun.DoDryRun = false })
+
+		m := &mockCIProvider{}
+		if err := SetUpCI(ctx, m, req, false); err != dryrun.ErrDryRun {
+			t.Fatalf("Expected dryrun.ErrDryRun, got %v", err)
+		}
+		if !m.dryRun {
+			t.Error("expected the request to be a dry run")
+		}
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		term.SetupTestTerm(t)
+		m := &mockCIProvider{}
+		if err := SetUpCI(ctx, m, req, true); err != nil {
+			t.Fatalf("SetUpCI() error = %v", err)
+		}
+		if !m.teardown {
+			t.Error("expected TearDownCI to be called")
+		}
+	})
+}
@@ -35,7 +35,7 @@ func SetDefaultStack(ctx context.Context, stacksPutter StacksPutter, stacksLoade
 		return err
 	}
 
-	stackFile, err := stacks.Marshal(stack)
+	stackFile, err := stacks.MarshalResolved(stack)
 	if err != nil {
 		return err
 	}
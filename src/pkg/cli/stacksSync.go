@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+type SyncDirection string
+
+const (
+	SyncPull SyncDirection = "pull"
+	SyncPush SyncDirection = "push"
+)
+
+func (d SyncDirection) String() string {
+	return string(d)
+}
+
+func (d *SyncDirection) Set(s string) error {
+	switch SyncDirection(s) {
+	case SyncPull, SyncPush:
+		*d = SyncDirection(s)
+		return nil
+	}
+	return fmt.Errorf("invalid direction %q; must be one of [%s %s]", s, SyncPull, SyncPush)
+}
+
+func (SyncDirection) Type() string {
+	return "direction"
+}
+
+type StacksSyncer interface {
+	GetStack(ctx context.Context, req *defangv1.GetStackRequest) (*defangv1.GetStackResponse, error)
+	PutStack(ctx context.Context, req *defangv1.PutStackRequest) error
+}
+
+type StackComparison struct {
+	Local  *stacks.Parameters // nil if there is no local stack file
+	Remote *stacks.Parameters // nil if there is no remote stack
+	Diffs  []stacks.VariableDiff
+}
+
+func DiffStack(ctx context.Context, fabric StacksSyncer, targetDirectory, projectName, name string) (*StackComparison, error) {
+	local, err := stacks.ReadInDirectory(targetDirectory, name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		local = nil
+	}
+
+	var remote *stacks.Parameters
+	resp, err := fabric.GetStack(ctx, &defangv1.GetStackRequest{
+		Project: projectName,
+		Stack:   name,
+	})
+	if err != nil {
+		if connect.CodeOf(err) != connect.CodeNotFound {
+			return nil, fmt.Errorf("failed to get remote stack: %w", err)
+		}
+	} else if resp.GetStack() != nil {
+		remote, err = stacks.NewParametersFromStack(resp.GetStack())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if local == nil && remote == nil {
+		return nil, &stacks.ErrNotExist{ProjectName: projectName, StackName: name}
+	}
+
+	return &StackComparison{
+		Local:  local,
+		Remote: remote,
+		Diffs:  stacks.Diff(local, remote),
+	}, nil
+}
+
+// SyncStack reconciles the local stack file and the remote stack record, in the
+// given direction. It returns the differences that were reconciled.
+func SyncStack(ctx context.Context, fabric StacksSyncer, targetDirectory, projectName, name string, direction SyncDirection) ([]stacks.VariableDiff, error) {
+	comparison, err := DiffStack(ctx, fabric, targetDirectory, projectName, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(comparison.Diffs) == 0 {
+		term.Infof("Stack %q is already in sync", name)
+		return nil, nil
+	}
+
+	switch direction {
+	case SyncPull:
+		return comparison.Diffs, pullStack(targetDirectory, comparison)
+	case SyncPush:
+		return comparison.Diffs, pushStack(ctx, fabric, projectName, comparison)
+	default:
+		return nil, fmt.Errorf("invalid direction %q; must be one of [%s %s]", direction, SyncPull, SyncPush)
+	}
+}
+
+func pullStack(targetDirectory string, comparison *StackComparison) error {
+	if comparison.Remote == nil {
+		return fmt.Errorf("stack %q has no remote record to pull; use --direction=%s instead", comparison.Local.Name, SyncPush)
+	}
+	params := *comparison.Remote
+	if comparison.Local != nil {
+		// keep the overlay structure of the local stack file
+		params.Extends = comparison.Local.Extends
+		params.Inherited = comparison.Local.Inherited
+		params.Overrides = comparison.Local.Overrides
+	}
+	filename, err := stacks.WriteInDirectory(targetDirectory, params)
+	if err != nil {
+		return err
+	}
+	if comparison.Local == nil {
+		term.Infof("Stack %q pulled and saved to %q. Add this file to source control.", params.Name, filename)
+	} else {
+		term.Infof("Stack file %q updated from remote stack %q", filename, params.Name)
+	}
+	return nil
+}
+
+func pushStack(ctx context.Context, fabric StacksSyncer, projectName string, comparison *StackComparison) error {
+	local := comparison.Local
+	if local == nil {
+		return fmt.Errorf("stack %q has no local stack file to push; use --direction=%s instead", comparison.Remote.Name, SyncPull)
+	}
+	stackFile, err := stacks.MarshalResolved(local)
+	if err != nil {
+		return err
+	}
+
+	// build the record from the local stack only, so no stale remote value survives;
+	// like a deploy, this leaves the remote IsDefault and LastDeployedAt as they are
+	stack := &defangv1.Stack{
+		Name:      local.Name,
+		Project:   projectName,
+		Provider:  local.Provider.Value(),
+		Region:    local.Region,
+		Mode:      local.Recipe.Mode().Value(),
+		StackFile: []byte(stackFile),
+	}
+	// an empty recipe name would overwrite the remote recipe
+	if local.Recipe != modes.RecipeUnspecified {
+		stack.Recipe = &defangv1.Recipe{Name: local.Recipe.String()}
+	}
+
+	if err := fabric.PutStack(ctx, &defangv1.PutStackRequest{Stack: stack}); err != nil {
+		return err
+	}
+	term.Infof("Remote stack %q updated from local stack file", local.Name)
+	return nil
+}
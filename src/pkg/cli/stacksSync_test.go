@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockStacksSyncer struct {
+	stacks map[string]*defangv1.Stack
+	puts   []*defangv1.Stack
+}
+
+func (m *mockStacksSyncer) GetStack(ctx context.Context, req *defangv1.GetStackRequest) (*defangv1.GetStackResponse, error) {
+	stack, ok := m.stacks[req.Stack]
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, nil)
+	}
+	return &defangv1.GetStackResponse{Stack: stack}, nil
+}
+
+func (m *mockStacksSyncer) PutStack(ctx context.Context, req *defangv1.PutStackRequest) error {
+	m.puts = append(m.puts, req.Stack)
+	return nil
+}
+
+func writeLocalStack(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, stacks.Directory), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, stacks.Directory, name), []byte(content), 0644))
+}
+
+func TestDiffStack(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	writeLocalStack(t, dir, "prod", "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nFOO=local\n")
+	writeLocalStack(t, dir, "dev", "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n")
+	fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+		"prod":    {Name: "prod", Provider: defangv1.Provider_AWS, Region: "us-east-1", StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-east-1\nFOO=local\n")},
+		"dev":     {Name: "dev", Provider: defangv1.Provider_AWS, Region: "us-west-2", StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n")},
+		"staging": {Name: "staging", Provider: defangv1.Provider_GCP, Region: "us-central1", StackFile: []byte("DEFANG_PROVIDER=gcp\nGOOGLE_REGION=us-central1\n")},
+	}}
+
+	t.Run("modified", func(t *testing.T) {
+		comparison, err := DiffStack(ctx, fabric, dir, "project", "prod")
+		require.NoError(t, err)
+		assert.Equal(t, []stacks.VariableDiff{
+			{Key: "AWS_REGION", Local: "us-west-2", Remote: "us-east-1", Change: stacks.ChangeModified},
+		}, comparison.Diffs)
+	})
+
+	t.Run("in sync", func(t *testing.T) {
+		comparison, err := DiffStack(ctx, fabric, dir, "project", "dev")
+		require.NoError(t, err)
+		assert.Empty(t, comparison.Diffs)
+	})
+
+	t.Run("remote only", func(t *testing.T) {
+		comparison, err := DiffStack(ctx, fabric, dir, "project", "staging")
+		require.NoError(t, err)
+		assert.Nil(t, comparison.Local)
+		assert.Len(t, comparison.Diffs, 2)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := DiffStack(ctx, fabric, dir, "project", "nope")
+		var notExist *stacks.ErrNotExist
+		assert.ErrorAs(t, err, &notExist)
+	})
+}
+
+func TestSyncStack(t *testing.T) {
+	ctx := t.Context()
+
+	t.Run("pull remote only stack", func(t *testing.T) {
+		dir := t.TempDir()
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"staging": {Name: "staging", Provider: defangv1.Provider_GCP, Region: "us-central1", StackFile: []byte("DEFANG_PROVIDER=gcp\nGOOGLE_REGION=us-central1\nGCP_PROJECT_ID=proj\n")},
+		}}
+		diffs, err := SyncStack(ctx, fabric, dir, "project", "staging", SyncPull)
+		require.NoError(t, err)
+		assert.Len(t, diffs, 3)
+
+		params, err := stacks.ReadInDirectory(dir, "staging")
+		require.NoError(t, err)
+		assert.Equal(t, "proj", params.Variables["GCP_PROJECT_ID"])
+		assert.Empty(t, fabric.puts)
+	})
+
+	t.Run("pull keeps overlay", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLocalStack(t, dir, "base", "DEFANG_PROVIDER=aws\nAWS_PROFILE=shared\n")
+		writeLocalStack(t, dir, "prod", "EXTENDS=base\nAWS_REGION=us-west-2\n")
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"prod": {Name: "prod", StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_PROFILE=shared\nAWS_REGION=us-east-1\n")},
+		}}
+		_, err := SyncStack(ctx, fabric, dir, "project", "prod", SyncPull)
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(dir, stacks.Directory, "prod"))
+		require.NoError(t, err)
+		assert.Equal(t, "EXTENDS=\"base\"\nAWS_REGION=\"us-east-1\"", string(content))
+	})
+
+	t.Run("push", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLocalStack(t, dir, "prod", "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nDEFANG_RECIPE=balanced\n")
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"prod": {Name: "prod", IsDefault: true, Provider: defangv1.Provider_AWS, Region: "us-east-1", StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-east-1\n")},
+		}}
+		_, err := SyncStack(ctx, fabric, dir, "project", "prod", SyncPush)
+		require.NoError(t, err)
+		require.Len(t, fabric.puts, 1)
+		put := fabric.puts[0]
+		assert.Equal(t, "project", put.Project)
+		assert.Equal(t, "us-west-2", put.Region)
+		assert.Equal(t, "BALANCED", put.GetRecipe().GetName())
+		assert.Equal(t, "AWS_REGION=\"us-west-2\"\nDEFANG_PROVIDER=\"aws\"\nDEFANG_RECIPE=\"balanced\"", string(put.StackFile))
+		// the remote record must not be modified in place
+		assert.Equal(t, "us-east-1", fabric.stacks["prod"].Region)
+	})
+
+	t.Run("push without local recipe", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLocalStack(t, dir, "prod", "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n")
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"prod": {Name: "prod", Mode: defangv1.DeploymentMode_PRODUCTION, Recipe: &defangv1.Recipe{Name: "high_availability"}, StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nDEFANG_RECIPE=high_availability\n")},
+		}}
+		_, err := SyncStack(ctx, fabric, dir, "project", "prod", SyncPush)
+		require.NoError(t, err)
+		require.Len(t, fabric.puts, 1)
+		put := fabric.puts[0]
+		assert.Equal(t, defangv1.DeploymentMode_MODE_UNSPECIFIED, put.Mode, "a stale remote mode must not survive")
+		assert.Nil(t, put.Recipe, "an unspecified recipe must not overwrite the remote recipe")
+	})
+
+	t.Run("push without local file", func(t *testing.T) {
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"prod": {Name: "prod", StackFile: []byte("DEFANG_PROVIDER=aws\n")},
+		}}
+		_, err := SyncStack(ctx, fabric, t.TempDir(), "project", "prod", SyncPush)
+		assert.ErrorContains(t, err, "no local stack file to push")
+	})
+
+	t.Run("already in sync", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLocalStack(t, dir, "dev", "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n")
+		fabric := &mockStacksSyncer{stacks: map[string]*defangv1.Stack{
+			"dev": {Name: "dev", StackFile: []byte("DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n")},
+		}}
+		diffs, err := SyncStack(ctx, fabric, dir, "project", "dev", SyncPush)
+		require.NoError(t, err)
+		assert.Empty(t, diffs)
+		assert.Empty(t, fabric.puts)
+	})
+}
+
+func TestSyncDirectionSet(t *testing.T) {
+	var d SyncDirection
+	assert.NoError(t, d.Set("pull"))
+	assert.Equal(t, SyncPull, d)
+	assert.Error(t, d.Set("sideways"))
+}
@@ -214,7 +214,7 @@ func TestRemoveStack(t *testing.T) {
 
 	t.Run("no deployments deletes without confirmation", func(t *testing.T) {
 		t.Chdir(t.TempDir())
-		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable})
+		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable}, nil)
 		assert.NoError(t, err)
 
 		remover := &mockStacksRemover{}
@@ -229,7 +229,7 @@ func TestRemoveStack(t *testing.T) {
 
 	t.Run("last deployment is down, deletes without confirmation", func(t *testing.T) {
 		t.Chdir(t.TempDir())
-		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable})
+		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable}, nil)
 		assert.NoError(t, err)
 
 		remover := &mockStacksRemover{}
@@ -267,7 +267,7 @@ func TestRemoveStack(t *testing.T) {
 
 	t.Run("last deployment is up, user confirms", func(t *testing.T) {
 		t.Chdir(t.TempDir())
-		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable})
+		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable}, nil)
 		assert.NoError(t, err)
 
 		remover := &mockStacksRemover{}
@@ -295,7 +295,7 @@ func TestRemoveStack(t *testing.T) {
 
 	t.Run("force with active deployment skips confirmation and deletes", func(t *testing.T) {
 		t.Chdir(t.TempDir())
-		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable})
+		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "mystack", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable}, nil)
 		assert.NoError(t, err)
 
 		remover := &mockStacksRemover{}
@@ -321,7 +321,7 @@ func TestRemoveStack(t *testing.T) {
 
 	t.Run("passes correct project and stack to DeleteStack", func(t *testing.T) {
 		t.Chdir(t.TempDir())
-		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "beta", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable})
+		_, err := stacks.CreateInDirectory(".", stacks.Parameters{Name: "beta", Provider: client.ProviderAWS, Region: "us-east-1", Recipe: modes.RecipeAffordable}, nil)
 		assert.NoError(t, err)
 
 		remover := &mockStacksRemover{}
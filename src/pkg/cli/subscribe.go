@@ -23,6 +23,18 @@ func WaitServiceState(
 	projectName string,
 	etag types.ETag,
 	services []string,
+) (ServiceStates, error) {
+	return waitServiceState(ctx, provider, targetState, projectName, etag, services, nil)
+}
+
+func waitServiceState(
+	ctx context.Context,
+	provider client.Provider,
+	targetState defangv1.ServiceState,
+	projectName string,
+	etag types.ETag,
+	services []string,
+	onUpdate func(*defangv1.SubscribeResponse),
 ) (ServiceStates, error) {
 	term.Debugf("waiting for services %v to reach state %s\n", services, targetState) // TODO: don't print in Go-routine
 
@@ -98,6 +110,9 @@ func WaitServiceState(
 			// We might get task/service states that do not map to a ServiceState; ignore those
 			continue
 		}
+		if onUpdate != nil {
+			onUpdate(msg)
+		}
 
 		if serviceStates[msg.Name] != targetState {
 			serviceStates[msg.Name] = msg.State
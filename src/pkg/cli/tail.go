@@ -57,6 +57,7 @@ type TailOptions struct {
 	Until              time.Time
 	Verbose            bool
 	PrintBookends      bool
+	OnServiceUpdate    func(*defangv1.SubscribeResponse) // called by TailAndMonitor for each service state update
 }
 
 func (to TailOptions) String() string {
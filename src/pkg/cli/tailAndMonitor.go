@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
@@ -38,6 +39,17 @@ func TailAndMonitor(ctx context.Context, project *compose.Project, provider clie
 
 	_, computeServices := splitManagedAndUnmanagedServices(project.Services)
 
+	// Keep the deploy lock that was handed off to the CD task until it exits
+	lease := AdoptDeployLock(ctx, provider, project.Name, tailOptions.Deployment)
+	var cdExited atomic.Bool
+	defer func() {
+		if cdExited.Load() {
+			lease.ReleaseHandOff(ctx)
+		} else {
+			lease.Release(ctx) // the CD task is still running
+		}
+	}()
+
 	var serviceStates ServiceStates
 	var cdErr, svcErr error
 
@@ -47,13 +59,15 @@ func TailAndMonitor(ctx context.Context, project *compose.Project, provider clie
 	go func() {
 		defer wg.Done()
 		// block on waiting for services to reach target state
-		serviceStates, svcErr = WaitServiceState(svcStatusCtx, provider, targetServiceState, project.Name, tailOptions.Deployment, computeServices)
+		serviceStates, svcErr = waitServiceState(svcStatusCtx, provider, targetServiceState, project.Name, tailOptions.Deployment, computeServices, tailOptions.OnServiceUpdate)
 	}()
 
 	go func() {
 		defer wg.Done()
 		// block on waiting for cdTask to complete
-		if err := WaitForCdTaskExit(ctx, provider); err != nil {
+		err := WaitForCdTaskExit(ctx, provider)
+		cdExited.Store(err == nil || errors.As(err, new(client.ErrDeploymentFailed)))
+		if err != nil {
 			cdErr = err
 			// When CD fails, stop WaitServiceState
 			cancelSvcStatus(cdErr)
@@ -2,8 +2,19 @@ package cli
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"connectrpc.com/connect"
 	"github.com/DefangLabs/defang/src/pkg/auth"
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/dryrun"
@@ -11,44 +22,326 @@ import (
 	"github.com/DefangLabs/defang/src/pkg/term"
 	"github.com/DefangLabs/defang/src/pkg/types"
 	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-func Token(ctx context.Context, client client.FabricClient, tenant types.TenantNameOrID, dur time.Duration, s scope.Scope) error {
+// TokenRecord is the local audit metadata of a token created with "defang token create".
+// The token itself is never stored, so only its holder can revoke it.
+type TokenRecord struct {
+	Name        string        `json:"name"`
+	Fingerprint string        `json:"fingerprint"` // first 16 hex digits of the SHA-256 of the token
+	Fabric      string        `json:"fabric"`
+	Workspace   string        `json:"workspace,omitempty"`
+	Scopes      []scope.Scope `json:"scopes,omitempty"`  // empty for admin
+	Project     string        `json:"project,omitempty"` // advisory; see TokenRestrictions
+	Stack       string        `json:"stack,omitempty"`   // advisory; see TokenRestrictions
+	CreatedAt   time.Time     `json:"createdAt"`
+	ExpiresAt   time.Time     `json:"expiresAt"`
+	RevokedAt   time.Time     `json:"revokedAt,omitzero"`
+}
+
+func (r TokenRecord) Status(now time.Time) string {
+	switch {
+	case !r.RevokedAt.IsZero():
+		return "revoked"
+	case now.After(r.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+type CreateTokenParams struct {
+	Name    string
+	Expires time.Duration
+	Scopes  []scope.Scope
+	Project string // optional and advisory; the Fabric does not enforce it
+	Stack   string // optional and advisory; the Fabric does not enforce it
+}
+
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+func tokenRecordsPath() string {
+	return filepath.Join(client.StateDir, "tokens.json")
+}
+
+func loadTokenRecords() ([]TokenRecord, error) {
+	data, err := os.ReadFile(tokenRecordsPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var records []TokenRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid token records in %s: %w", tokenRecordsPath(), err)
+	}
+	return records, nil
+}
+
+func saveTokenRecords(records []TokenRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(client.StateDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(tokenRecordsPath(), data, 0600)
+}
+
+func CreateToken(ctx context.Context, fabric client.FabricClient, fabricAddr string, tenant types.TenantNameOrID, params CreateTokenParams) (*TokenRecord, error) {
+	if params.Name == "" {
+		return nil, errors.New("token name is required")
+	}
+	if len(params.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	for _, s := range params.Scopes {
+		if !slices.Contains(scope.All(), s) {
+			return nil, fmt.Errorf("invalid scope %q; expected one of %v", s, scope.All())
+		}
+	}
+	host := client.TokenStorageName(fabricAddr)
+	records, err := loadTokenRecords()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if slices.ContainsFunc(records, func(r TokenRecord) bool {
+		return r.Fabric == host && r.Name == params.Name && r.Status(now) == "active"
+	}) {
+		return nil, fmt.Errorf("an active token named %q already exists; revoke it first or pick another name", params.Name)
+	}
+
 	if dryrun.DoDryRun {
-		return dryrun.ErrDryRun
+		return nil, dryrun.ErrDryRun
 	}
 
 	code, err := auth.StartAuthCodeFlow(ctx, false, func(token string) {
-		term.Debug("Getting access token for scope:", s)
+		term.Debug("Getting access token for scopes:", params.Scopes)
 	}, "token-cli")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	at, err := auth.ExchangeCodeForToken(ctx, code, s)
+	at, err := auth.ExchangeCodeForToken(ctx, code, params.Scopes...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Translate the OpenAuth token to our own Defang Fabric token
 	var scopes []string
-	if s != scope.Admin {
-		scopes = []string{string(s)}
+	if !slices.Contains(params.Scopes, scope.Admin) {
+		for _, s := range params.Scopes {
+			scopes = append(scopes, s.String())
+		}
 	}
 
-	term.Debugf("Generating token for tenant %q with scopes %v", tenant, scopes)
+	term.Debugf("Generating token %q for tenant %q with scopes %v", params.Name, tenant, scopes)
 
-	resp, err := client.Token(ctx, &defangv1.TokenRequest{
+	resp, err := fabric.Token(ctx, &defangv1.TokenRequest{
 		Assertion: at,
-		ExpiresIn: uint32(dur.Seconds()),
+		ExpiresIn: uint32(params.Expires.Seconds()),
 		Scope:     scopes,
 		Tenant:    string(tenant),
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	record := TokenRecord{
+		Name:        params.Name,
+		Fingerprint: tokenFingerprint(resp.AccessToken),
+		Fabric:      host,
+		Workspace:   string(tenant),
+		Project:     params.Project,
+		Stack:       params.Stack,
+		CreatedAt:   now.UTC().Truncate(time.Second),
+		ExpiresAt:   now.Add(params.Expires).UTC().Truncate(time.Second),
+	}
+	for _, s := range scopes {
+		record.Scopes = append(record.Scopes, scope.Scope(s))
+	}
+	if err := saveTokenRecords(append(records, record)); err != nil {
+		return nil, fmt.Errorf("failed to save token metadata: %w", err)
+	}
+	if record.Project != "" || record.Stack != "" {
+		term.Warn("The project and stack restrictions are only checked by this CLI on this machine; the token can be used for any project and stack elsewhere, like in CI")
 	}
 
 	term.Printc(term.BrightCyan, "Scoped access token: ")
 	term.Println(resp.AccessToken)
+	return &record, nil
+}
+
+type TokenLineItem struct {
+	Name    string
+	Scopes  string
+	Project string
+	Stack   string
+	Created string
+	Expires string
+	Status  string
+}
+
+func ListTokens(fabricAddr string) error {
+	records, err := loadTokenRecords()
+	if err != nil {
+		return err
+	}
+	host := client.TokenStorageName(fabricAddr)
+	now := time.Now()
+	var items []TokenLineItem
+	for _, r := range records {
+		if r.Fabric != host {
+			continue
+		}
+		scopes := "admin"
+		if len(r.Scopes) > 0 {
+			scopes = strings.Join(scopeStrings(r.Scopes), ",")
+		}
+		items = append(items, TokenLineItem{
+			Name:    r.Name,
+			Scopes:  scopes,
+			Project: r.Project,
+			Stack:   r.Stack,
+			Created: r.CreatedAt.Local().Format(time.RFC3339),
+			Expires: r.ExpiresAt.Local().Format(time.RFC3339),
+			Status:  r.Status(now),
+		})
+	}
+	if len(items) == 0 {
+		_, err := term.Warn("No tokens found; use \"defang token create\" to create one")
+		return err
+	}
+	return term.Table(items, "Name", "Scopes", "Project", "Stack", "Created", "Expires", "Status")
+}
+
+func scopeStrings(scopes []scope.Scope) []string {
+	strs := make([]string, len(scopes))
+	for i, s := range scopes {
+		strs[i] = s.String()
+	}
+	return strs
+}
+
+// RevokeToken revokes the active token with the given name or fingerprint and
+// marks it as revoked in the local metadata. The Fabric only lets a token revoke
+// itself, so the caller must provide the token; it is never stored locally.
+func RevokeToken(ctx context.Context, fabricAddr string, tenant types.TenantNameOrID, nameOrFingerprint, token string) error {
+	records, err := loadTokenRecords()
+	if err != nil {
+		return err
+	}
+	host := client.TokenStorageName(fabricAddr)
+	now := time.Now()
+	i := slices.IndexFunc(records, func(r TokenRecord) bool {
+		return r.Fabric == host && (r.Name == nameOrFingerprint || r.Fingerprint == nameOrFingerprint) && r.Status(now) == "active"
+	})
+	if i < 0 {
+		return fmt.Errorf("no active token named %q", nameOrFingerprint)
+	}
+	record := &records[i]
+	if tokenFingerprint(token) != record.Fingerprint {
+		return fmt.Errorf("the given token is not token %q (fingerprint %s)", record.Name, record.Fingerprint)
+	}
+
+	if dryrun.DoDryRun {
+		return dryrun.ErrDryRun
+	}
+
+	fabric := client.NewGrpcClient(client.NormalizeHost(fabricAddr), token, tenant)
+	// The token is useless to us when the Fabric no longer accepts it
+	if err := fabric.RevokeToken(ctx); err != nil && connect.CodeOf(err) != connect.CodeUnauthenticated {
+		return err
+	}
+	record.RevokedAt = now.UTC().Truncate(time.Second)
+	return saveTokenRecords(records)
+}
+
+// TokenRestrictions are the scopes and targets that the access token in use is
+// limited to. The Fabric enforces the scopes; the CLI checks them up front for a
+// clearer error. The project and stack are advisory: they are only known from
+// the local metadata, so the CLI only checks them on the machine that created
+// the token, and the Fabric accepts the token for any project and stack.
+type TokenRestrictions struct {
+	Name    string        // from the local metadata, if known
+	Scopes  []scope.Scope // empty for admin
+	Project string
+	Stack   string
+}
+
+// GetTokenRestrictions returns the restrictions of the given access token,
+// using the local metadata if the token was created here, or else the scopes
+// in the token's claims.
+func GetTokenRestrictions(fabricAddr, accessToken string) TokenRestrictions {
+	if accessToken == "" {
+		return TokenRestrictions{}
+	}
+	if records, err := loadTokenRecords(); err != nil {
+		term.Debug("Failed to load token metadata:", err)
+	} else {
+		fingerprint := tokenFingerprint(accessToken)
+		host := client.TokenStorageName(fabricAddr)
+		for _, r := range records {
+			if r.Fingerprint == fingerprint && r.Fabric == host {
+				return TokenRestrictions{Name: r.Name, Scopes: r.Scopes, Project: r.Project, Stack: r.Stack}
+			}
+		}
+	}
+
+	var claims jwt.MapClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(accessToken, &claims); err != nil {
+		term.Debug("Failed to parse access token claims:", err)
+		return TokenRestrictions{}
+	}
+	var restrictions TokenRestrictions
+	switch s := claims["scope"].(type) {
+	case string:
+		for _, s := range strings.Fields(s) {
+			restrictions.Scopes = append(restrictions.Scopes, scope.Scope(s))
+		}
+	case []any:
+		for _, s := range s {
+			if s, ok := s.(string); ok {
+				restrictions.Scopes = append(restrictions.Scopes, scope.Scope(s))
+			}
+		}
+	}
+	if slices.Contains(restrictions.Scopes, scope.Admin) {
+		restrictions.Scopes = nil
+	}
+	return restrictions
+}
+
+func (t TokenRestrictions) describe() string {
+	if t.Name != "" {
+		return fmt.Sprintf("access token %q", t.Name)
+	}
+	return "access token"
+}
+
+// CheckScope returns an error if the token does not have the required scope.
+func (t TokenRestrictions) CheckScope(required scope.Scope) error {
+	if len(t.Scopes) == 0 || required == scope.Any || slices.Contains(t.Scopes, required) {
+		return nil
+	}
+	return fmt.Errorf("%s is limited to scopes %v, but this command requires scope %q", t.describe(), t.Scopes, required)
+}
+
+// CheckTarget returns an error if the token is restricted to another project or
+// stack. This check is advisory; see TokenRestrictions.
+func (t TokenRestrictions) CheckTarget(project, stack string) error {
+	if t.Project != "" && project != t.Project {
+		return fmt.Errorf("%s is restricted to project %q, not %q", t.describe(), t.Project, project)
+	}
+	if t.Stack != "" && stack != t.Stack {
+		return fmt.Errorf("%s is restricted to stack %q, not %q", t.describe(), t.Stack, stack)
+	}
 	return nil
 }
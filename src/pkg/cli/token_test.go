@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/scope"
+	"github.com/DefangLabs/defang/src/protos/io/defang/v1/defangv1connect"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func setupTokenState(t *testing.T) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	originalStateDir := client.StateDir
+	client.StateDir = tmpDir
+	t.Cleanup(func() {
+		client.StateDir = originalStateDir
+	})
+}
+
+func TestTokenRecordStatus(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, "active", TokenRecord{ExpiresAt: now.Add(time.Hour)}.Status(now))
+	assert.Equal(t, "expired", TokenRecord{ExpiresAt: now.Add(-time.Hour)}.Status(now))
+	assert.Equal(t, "revoked", TokenRecord{ExpiresAt: now.Add(time.Hour), RevokedAt: now}.Status(now))
+}
+
+type grpcRevokeMockHandler struct {
+	defangv1connect.UnimplementedFabricControllerHandler
+	revoked []string
+}
+
+func (g *grpcRevokeMockHandler) RevokeToken(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+	token := strings.TrimPrefix(req.Header().Get("Authorization"), "Bearer ")
+	if token == "unknown-token" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid token"))
+	}
+	g.revoked = append(g.revoked, token)
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+func TestRevokeToken(t *testing.T) {
+	setupTokenState(t)
+	mockService := &grpcRevokeMockHandler{}
+	_, handler := defangv1connect.NewFabricControllerHandler(mockService)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	fabricAddr := strings.TrimPrefix(server.URL, "http://")
+	host := client.TokenStorageName(fabricAddr)
+
+	now := time.Now()
+	records := []TokenRecord{
+		{Name: "ci", Fingerprint: tokenFingerprint("old"), Fabric: host, ExpiresAt: now.Add(-time.Hour)},
+		{Name: "ci", Fingerprint: tokenFingerprint("ci-token"), Fabric: host, Scopes: []scope.Scope{scope.Read}, ExpiresAt: now.Add(time.Hour)},
+		{Name: "other", Fingerprint: tokenFingerprint("unknown-token"), Fabric: host, ExpiresAt: now.Add(time.Hour)},
+	}
+	require.NoError(t, saveTokenRecords(records))
+
+	err := RevokeToken(t.Context(), fabricAddr, "", "ci", "other-token")
+	assert.ErrorContains(t, err, `the given token is not token "ci"`)
+	assert.Empty(t, mockService.revoked)
+
+	require.NoError(t, RevokeToken(t.Context(), fabricAddr, "", "ci", "ci-token"))
+	assert.Equal(t, []string{"ci-token"}, mockService.revoked)
+
+	records, err = loadTokenRecords()
+	require.NoError(t, err)
+	assert.Equal(t, "expired", records[0].Status(now))
+	assert.Equal(t, "revoked", records[1].Status(now))
+	assert.Equal(t, "active", records[2].Status(now))
+
+	err = RevokeToken(t.Context(), fabricAddr, "", "ci", "ci-token")
+	assert.ErrorContains(t, err, `no active token named "ci"`)
+
+	// A token that the Fabric no longer accepts is marked as revoked too
+	require.NoError(t, RevokeToken(t.Context(), fabricAddr, "", tokenFingerprint("unknown-token"), "unknown-token"))
+	records, err = loadTokenRecords()
+	require.NoError(t, err)
+	assert.Equal(t, "revoked", records[2].Status(now))
+}
+
+func TestGetTokenRestrictions(t *testing.T) {
+	setupTokenState(t)
+	const fabricAddr = "fabric-prod1.defang.dev:443"
+
+	t.Run("no token", func(t *testing.T) {
+		assert.Equal(t, TokenRestrictions{}, GetTokenRestrictions(fabricAddr, ""))
+	})
+
+	t.Run("local metadata", func(t *testing.T) {
+		require.NoError(t, saveTokenRecords([]TokenRecord{{
+			Name:        "ci",
+			Fingerprint: tokenFingerprint("opaque-token"),
+			Fabric:      client.TokenStorageName(fabricAddr),
+			Scopes:      []scope.Scope{scope.Read, scope.Tail},
+			Project:     "app",
+			Stack:       "prod",
+		}}))
+		got := GetTokenRestrictions(fabricAddr, "opaque-token")
+		assert.Equal(t, TokenRestrictions{Name: "ci", Scopes: []scope.Scope{scope.Read, scope.Tail}, Project: "app", Stack: "prod"}, got)
+	})
+
+	for _, tt := range []struct {
+		name  string
+		claim any
+		want  []scope.Scope
+	}{
+		{"admin", nil, nil},
+		{"string claim", "read tail", []scope.Scope{scope.Read, scope.Tail}},
+		{"array claim", []string{"delete"}, []scope.Scope{scope.Delete}},
+		{"admin claim", "admin", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "user"}
+			if tt.claim != nil {
+				claims["scope"] = tt.claim
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, GetTokenRestrictions(fabricAddr, token).Scopes)
+		})
+	}
+}
+
+func TestTokenRestrictions(t *testing.T) {
+	admin := TokenRestrictions{}
+	assert.NoError(t, admin.CheckScope(scope.Admin))
+	assert.NoError(t, admin.CheckScope(scope.Delete))
+	assert.NoError(t, admin.CheckTarget("any", "stack"))
+
+	readOnly := TokenRestrictions{Name: "ci", Scopes: []scope.Scope{scope.Read, scope.Tail}, Project: "app", Stack: "prod"}
+	assert.NoError(t, readOnly.CheckScope(scope.Read))
+	assert.NoError(t, readOnly.CheckScope(scope.Tail))
+	assert.NoError(t, readOnly.CheckScope(scope.Any))
+	assert.ErrorContains(t, readOnly.CheckScope(scope.Delete), `access token "ci" is limited to scopes [read tail], but this command requires scope "delete"`)
+	assert.Error(t, readOnly.CheckScope(scope.Admin))
+	assert.NoError(t, readOnly.CheckTarget("app", "prod"))
+	assert.ErrorContains(t, readOnly.CheckTarget("other", "prod"), `restricted to project "app"`)
+	assert.ErrorContains(t, readOnly.CheckTarget("app", "beta"), `restricted to stack "prod"`)
+}
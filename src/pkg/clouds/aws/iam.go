@@ -0,0 +1,205 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+type IamRole struct {
+	Arn                      string
+	RoleName                 string
+	AssumeRolePolicyDocument string // URL-decoded JSON
+}
+
+// IamClientAPI is the subset of the IAM API used to set up CI roles.
+type IamClientAPI interface {
+	GetOpenIDConnectProvider(ctx context.Context, arn string) (clientIDs []string, err error)
+	CreateOpenIDConnectProvider(ctx context.Context, url string, clientIDs []string) (arn string, err error)
+	AddClientIDToOpenIDConnectProvider(ctx context.Context, arn, clientID string) error
+	GetRole(ctx context.Context, roleName string) (*IamRole, error)
+	CreateRole(ctx context.Context, roleName, description, assumeRolePolicy string) (*IamRole, error)
+	UpdateAssumeRolePolicy(ctx context.Context, roleName, assumeRolePolicy string) error
+	GetRolePolicy(ctx context.Context, roleName, policyName string) (string, error)
+	PutRolePolicy(ctx context.Context, roleName, policyName, policy string) error
+	DeleteRolePolicy(ctx context.Context, roleName, policyName string) error
+	DeleteRole(ctx context.Context, roleName string) error
+}
+
+var NewIamFromConfig = func(cfg aws.Config) IamClientAPI {
+	return &iamQueryClient{cfg: cfg, endpoint: "https://iam.amazonaws.com/"}
+}
+
+type IamError struct {
+	Code    string
+	Message string
+}
+
+func (e *IamError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func IsNoSuchEntity(err error) bool {
+	var iamErr *IamError
+	return errors.As(err, &iamErr) && iamErr.Code == "NoSuchEntity"
+}
+
+// iamQueryClient calls the IAM Query API directly, since the CLI doesn't
+// otherwise need the IAM SDK.
+type iamQueryClient struct {
+	cfg      aws.Config
+	endpoint string
+}
+
+func (c *iamQueryClient) call(ctx context.Context, action string, params url.Values, result any) error {
+	params.Set("Action", action)
+	params.Set("Version", "2010-05-08")
+	body := params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(body))
+	// IAM is a global service, signed for us-east-1
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "iam", "us-east-1", time.Now()); err != nil {
+		return err
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var errResp struct {
+			Error IamError `xml:"Error"`
+		}
+		if err := xml.Unmarshal(data, &errResp); err != nil || errResp.Error.Code == "" {
+			return fmt.Errorf("IAM %s failed: %s", action, resp.Status)
+		}
+		return &errResp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, result)
+}
+
+type iamRoleXML struct {
+	Arn                      string `xml:"Arn"`
+	RoleName                 string `xml:"RoleName"`
+	AssumeRolePolicyDocument string `xml:"AssumeRolePolicyDocument"`
+}
+
+func (r iamRoleXML) role() (*IamRole, error) {
+	doc, err := url.QueryUnescape(r.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, err
+	}
+	return &IamRole{Arn: r.Arn, RoleName: r.RoleName, AssumeRolePolicyDocument: doc}, nil
+}
+
+func (c *iamQueryClient) GetOpenIDConnectProvider(ctx context.Context, arn string) ([]string, error) {
+	var result struct {
+		ClientIDs []string `xml:"GetOpenIDConnectProviderResult>ClientIDList>member"`
+	}
+	err := c.call(ctx, "GetOpenIDConnectProvider", url.Values{"OpenIDConnectProviderArn": {arn}}, &result)
+	return result.ClientIDs, err
+}
+
+func (c *iamQueryClient) CreateOpenIDConnectProvider(ctx context.Context, providerURL string, clientIDs []string) (string, error) {
+	params := url.Values{"Url": {providerURL}}
+	for i, id := range clientIDs {
+		params.Set("ClientIDList.member."+strconv.Itoa(i+1), id)
+	}
+	var result struct {
+		Arn string `xml:"CreateOpenIDConnectProviderResult>OpenIDConnectProviderArn"`
+	}
+	err := c.call(ctx, "CreateOpenIDConnectProvider", params, &result)
+	return result.Arn, err
+}
+
+func (c *iamQueryClient) AddClientIDToOpenIDConnectProvider(ctx context.Context, arn, clientID string) error {
+	return c.call(ctx, "AddClientIDToOpenIDConnectProvider", url.Values{"OpenIDConnectProviderArn": {arn}, "ClientID": {clientID}}, nil)
+}
+
+func (c *iamQueryClient) GetRole(ctx context.Context, roleName string) (*IamRole, error) {
+	var result struct {
+		Role iamRoleXML `xml:"GetRoleResult>Role"`
+	}
+	if err := c.call(ctx, "GetRole", url.Values{"RoleName": {roleName}}, &result); err != nil {
+		return nil, err
+	}
+	return result.Role.role()
+}
+
+func (c *iamQueryClient) CreateRole(ctx context.Context, roleName, description, assumeRolePolicy string) (*IamRole, error) {
+	var result struct {
+		Role iamRoleXML `xml:"CreateRoleResult>Role"`
+	}
+	params := url.Values{
+		"RoleName":                 {roleName},
+		"Description":              {description},
+		"AssumeRolePolicyDocument": {assumeRolePolicy},
+		"Tags.member.1.Key":        {"CreatedBy"},
+		"Tags.member.1.Value":      {"Defang"},
+	}
+	if err := c.call(ctx, "CreateRole", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Role.role()
+}
+
+func (c *iamQueryClient) UpdateAssumeRolePolicy(ctx context.Context, roleName, assumeRolePolicy string) error {
+	return c.call(ctx, "UpdateAssumeRolePolicy", url.Values{"RoleName": {roleName}, "PolicyDocument": {assumeRolePolicy}}, nil)
+}
+
+func (c *iamQueryClient) GetRolePolicy(ctx context.Context, roleName, policyName string) (string, error) {
+	var result struct {
+		PolicyDocument string `xml:"GetRolePolicyResult>PolicyDocument"`
+	}
+	if err := c.call(ctx, "GetRolePolicy", url.Values{"RoleName": {roleName}, "PolicyName": {policyName}}, &result); err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(result.PolicyDocument)
+}
+
+func (c *iamQueryClient) PutRolePolicy(ctx context.Context, roleName, policyName, policy string) error {
+	return c.call(ctx, "PutRolePolicy", url.Values{"RoleName": {roleName}, "PolicyName": {policyName}, "PolicyDocument": {policy}}, nil)
+}
+
+func (c *iamQueryClient) DeleteRolePolicy(ctx context.Context, roleName, policyName string) error {
+	return c.call(ctx, "DeleteRolePolicy", url.Values{"RoleName": {roleName}, "PolicyName": {policyName}}, nil)
+}
+
+func (c *iamQueryClient) DeleteRole(ctx context.Context, roleName string) error {
+	return c.call(ctx, "DeleteRole", url.Values{"RoleName": {roleName}}, nil)
+}
@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIamClient(t *testing.T, handler http.HandlerFunc) IamClientAPI {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg := aws.Config{
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		HTTPClient:  server.Client(),
+	}
+	return &iamQueryClient{cfg: cfg, endpoint: server.URL}
+}
+
+func TestIamQueryClient(t *testing.T) {
+	ctx := t.Context()
+
+	t.Run("GetRole", func(t *testing.T) {
+		var form url.Values
+		iam := newTestIamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/iam/aws4_request")
+			body, _ := io.ReadAll(r.Body)
+			form, _ = url.ParseQuery(string(body))
+			io.WriteString(w, `<GetRoleResponse><GetRoleResult><Role>
+  <Arn>arn:aws:iam::123456789012:role/test</Arn>
+  <RoleName>test</RoleName>
+  <AssumeRolePolicyDocument>%7B%22Version%22%3A%222012-10-17%22%7D</AssumeRolePolicyDocument>
+</Role></GetRoleResult></GetRoleResponse>`)
+		})
+		role, err := iam.GetRole(ctx, "test")
+		require.NoError(t, err)
+		assert.Equal(t, "GetRole", form.Get("Action"))
+		assert.Equal(t, "test", form.Get("RoleName"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/test", role.Arn)
+		assert.JSONEq(t, `{"Version":"2012-10-17"}`, role.AssumeRolePolicyDocument)
+	})
+
+	t.Run("NoSuchEntity", func(t *testing.T) {
+		iam := newTestIamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>The role with name test cannot be found.</Message></Error></ErrorResponse>`)
+		})
+		_, err := iam.GetRole(ctx, "test")
+		require.Error(t, err)
+		assert.True(t, IsNoSuchEntity(err))
+		assert.Contains(t, err.Error(), "cannot be found")
+	})
+
+	t.Run("CreateOpenIDConnectProvider", func(t *testing.T) {
+		var form url.Values
+		iam := newTestIamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			form, _ = url.ParseQuery(string(body))
+			io.WriteString(w, `<CreateOpenIDConnectProviderResponse><CreateOpenIDConnectProviderResult><OpenIDConnectProviderArn>arn:aws:iam::123456789012:oidc-provider/example.com</OpenIDConnectProviderArn></CreateOpenIDConnectProviderResult></CreateOpenIDConnectProviderResponse>`)
+		})
+		arn, err := iam.CreateOpenIDConnectProvider(ctx, "https://example.com", []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::123456789012:oidc-provider/example.com", arn)
+		assert.Equal(t, "a", form.Get("ClientIDList.member.1"))
+		assert.Equal(t, "b", form.Get("ClientIDList.member.2"))
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		iam := newTestIamClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		err := iam.DeleteRole(ctx, "test")
+		require.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "IAM DeleteRole failed"))
+		assert.False(t, IsNoSuchEntity(err))
+	})
+}
@@ -121,6 +121,36 @@ func (a *Aws) ListSecrets(ctx context.Context) ([]string, error) {
 }
 
 func (a *Aws) ListSecretsByPrefix(ctx context.Context, prefix string) ([]string, error) {
+	params, err := a.describeSecretsByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(params))
+	for _, p := range params {
+		names = append(names, *p.Name)
+	}
+
+	sort.Strings(names) // make sure the output is deterministic
+	return names, nil
+}
+
+// ListSecretVersionsByPrefix returns the version of each secret whose name
+// starts with the given prefix; the version changes whenever the value is put.
+func (a *Aws) ListSecretVersionsByPrefix(ctx context.Context, prefix string) (map[string]int64, error) {
+	params, err := a.describeSecretsByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(params))
+	for _, p := range params {
+		versions[*p.Name] = p.Version
+	}
+	return versions, nil
+}
+
+func (a *Aws) describeSecretsByPrefix(ctx context.Context, prefix string) ([]types.ParameterMetadata, error) {
 	cfg, err := a.LoadConfig(ctx)
 	if err != nil {
 		return nil, err
@@ -138,7 +168,7 @@ func (a *Aws) ListSecretsByPrefix(ctx context.Context, prefix string) ([]string,
 		})
 	}
 
-	var names []string
+	var params []types.ParameterMetadata
 	var token *string
 	for {
 		res, err := svc.DescribeParameters(ctx, &ssm.DescribeParametersInput{
@@ -150,15 +180,11 @@ func (a *Aws) ListSecretsByPrefix(ctx context.Context, prefix string) ([]string,
 			return nil, err
 		}
 
-		for _, p := range res.Parameters {
-			names = append(names, *p.Name)
-		}
+		params = append(params, res.Parameters...)
 
 		if token = res.NextToken; token == nil {
 			break
 		}
 	}
-
-	sort.Strings(names) // make sure the output is deterministic
-	return names, nil
+	return params, nil
 }
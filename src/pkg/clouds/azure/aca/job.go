@@ -278,9 +278,17 @@ func assignRole(ctx context.Context, raClient *armauthorization.RoleAssignmentsC
 	}, nil)
 	if err != nil {
 		var respErr *azcore.ResponseError
-		if !errors.As(err, &respErr) || respErr.ErrorCode != "RoleAssignmentExists" {
-			return err
+		if errors.As(err, &respErr) && respErr.ErrorCode == "RoleAssignmentExists" {
+			return nil
+		}
+		// Identities without roleAssignments/write (e.g. from "defang cd setup-ci") can still
+		// deploy once the role has been assigned
+		if azure.IsAuthorizationFailed(err) {
+			if ok, _ := azure.HasRoleAssignment(ctx, raClient, scope, fullRoleDefID, principalID); ok {
+				return nil
+			}
 		}
+		return err
 	}
 	return nil
 }
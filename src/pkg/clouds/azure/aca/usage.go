@@ -0,0 +1,32 @@
+package aca
+
+import (
+	"context"
+	"fmt"
+
+	armappcontainersv3 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/appcontainers/armappcontainers/v3"
+	cloudazure "github.com/DefangLabs/defang/src/pkg/clouds/azure"
+)
+
+// ListUsages returns the Container Apps quotas of the subscription in the
+// location of a, with their current usage.
+func ListUsages(ctx context.Context, a cloudazure.Azure) ([]*armappcontainersv3.Usage, error) {
+	cred, err := a.NewCreds()
+	if err != nil {
+		return nil, err
+	}
+	client, err := armappcontainersv3.NewUsagesClient(a.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	var usages []*armappcontainersv3.Usage
+	pager := client.NewListPager(a.Location.String(), nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing Container Apps usages in %s: %w", a.Location, err)
+		}
+		usages = append(usages, page.Value...)
+	}
+	return usages, nil
+}
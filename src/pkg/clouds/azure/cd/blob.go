@@ -8,7 +8,11 @@ import (
 	"iter"
 	"os"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 )
 
@@ -111,3 +115,75 @@ func (d *Driver) downloadBlobFromContainer(ctx context.Context, containerName, b
 	defer resp.Body.Close()
 	return io.ReadAll(io.LimitReader(resp.Body, maxBlobDownloadSize))
 }
+
+func (d *Driver) UploadBlob(ctx context.Context, blobName string, data []byte) error {
+	client, err := d.newBlobContainerClient(ctx, d.BlobContainerName)
+	if err != nil {
+		return err
+	}
+	_, err = client.NewBlockBlobClient(blobName).UploadBuffer(ctx, data, nil)
+	return err
+}
+
+// DownloadBlobWithETag returns the blob and its ETag, which can be used as a
+// precondition to update or delete the blob.
+func (d *Driver) DownloadBlobWithETag(ctx context.Context, blobName string) ([]byte, azcore.ETag, error) {
+	client, err := d.newBlobContainerClient(ctx, d.BlobContainerName)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.NewBlobClient(blobName).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobDownloadSize))
+	if err != nil {
+		return nil, "", err
+	}
+	var etag azcore.ETag
+	if resp.ETag != nil {
+		etag = *resp.ETag
+	}
+	return data, etag, nil
+}
+
+// UploadBlobIfMatch writes the blob only if its ETag is the given one, or if
+// it does not exist when etag is empty, and returns the new ETag.
+func (d *Driver) UploadBlobIfMatch(ctx context.Context, blobName string, data []byte, etag azcore.ETag) (azcore.ETag, error) {
+	client, err := d.newBlobContainerClient(ctx, d.BlobContainerName)
+	if err != nil {
+		return "", err
+	}
+	conds := &blob.ModifiedAccessConditions{IfMatch: &etag}
+	if etag == "" {
+		conds = &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)}
+	}
+	resp, err := client.NewBlockBlobClient(blobName).UploadBuffer(ctx, data, &blockblob.UploadBufferOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: conds},
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.ETag == nil {
+		return "", errors.New("missing ETag in upload response")
+	}
+	return *resp.ETag, nil
+}
+
+// DeleteBlobIfMatch deletes the blob only if its ETag is the given one, or
+// unconditionally when etag is empty.
+func (d *Driver) DeleteBlobIfMatch(ctx context.Context, blobName string, etag azcore.ETag) error {
+	client, err := d.newBlobContainerClient(ctx, d.BlobContainerName)
+	if err != nil {
+		return err
+	}
+	var opts *blob.DeleteOptions
+	if etag != "" {
+		opts = &blob.DeleteOptions{AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag},
+		}}
+	}
+	_, err = client.NewBlobClient(blobName).Delete(ctx, opts)
+	return err
+}
@@ -0,0 +1,340 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources/v2"
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/google/uuid"
+)
+
+const managedIdentityAPIVersion = "2023-01-31"
+
+// ManagedIdentity is a user-assigned managed identity.
+type ManagedIdentity struct {
+	ID          string
+	ClientID    string
+	PrincipalID string
+	TenantID    string
+}
+
+// FederatedCredential lets tokens from an external OIDC issuer act as a
+// managed identity.
+type FederatedCredential struct {
+	Issuer    string
+	Subject   string
+	Audiences []string
+}
+
+// IdentityClientAPI is what's needed to set up a managed identity for CI.
+type IdentityClientAPI interface {
+	GetResourceGroupLocation(ctx context.Context, resourceGroup string) (Location, error)
+	ListResourceGroups(ctx context.Context) ([]string, error)
+	GetIdentity(ctx context.Context, resourceGroup, name string) (*ManagedIdentity, error)
+	CreateIdentity(ctx context.Context, resourceGroup, name string, location Location) (*ManagedIdentity, error)
+	DeleteIdentity(ctx context.Context, resourceGroup, name string) error
+	GetFederatedCredential(ctx context.Context, resourceGroup, identity, name string) (*FederatedCredential, error)
+	PutFederatedCredential(ctx context.Context, resourceGroup, identity, name string, cred FederatedCredential) error
+	HasRoleAssignment(ctx context.Context, scope, roleID, principalID string) (bool, error)
+	AssignRole(ctx context.Context, scope, roleID, principalID string) error
+	DeleteRoleAssignments(ctx context.Context, scope, principalID string) error
+}
+
+var NewIdentityClient = func(a Azure) IdentityClientAPI {
+	return &identityClient{Azure: a}
+}
+
+// IsNotFound reports whether err is a 404 from ARM.
+func IsNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// RoleDefinitionID returns the full ID of a built-in role in the subscription.
+func RoleDefinitionID(subscriptionID, roleID string) string {
+	return fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, roleID)
+}
+
+// HasRoleAssignment reports whether the principal has the role on the scope,
+// either directly or inherited from a parent scope. Callers that lack
+// roleAssignments/write use this to tell an existing assignment from a
+// missing one.
+func HasRoleAssignment(ctx context.Context, raClient *armauthorization.RoleAssignmentsClient, scope, roleDefID, principalID string) (bool, error) {
+	pager := raClient.NewListForScopePager(scope, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr(fmt.Sprintf("principalId eq '%s'", principalID)),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, ra := range page.Value {
+			if ra.Properties == nil || ra.Properties.RoleDefinitionID == nil || ra.Properties.Scope == nil {
+				continue
+			}
+			// The filter also returns assignments below the scope, which don't apply
+			if strings.EqualFold(*ra.Properties.RoleDefinitionID, roleDefID) && isParentScope(*ra.Properties.Scope, scope) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func isParentScope(parent, scope string) bool {
+	parent, scope = strings.ToLower(strings.TrimSuffix(parent, "/")), strings.ToLower(scope)
+	return parent == "/" || parent == scope || strings.HasPrefix(scope, parent+"/")
+}
+
+// IsAuthorizationFailed reports whether err is a 403 from ARM.
+func IsAuthorizationFailed(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+type identityClient struct {
+	Azure
+}
+
+func (c *identityClient) GetResourceGroupLocation(ctx context.Context, resourceGroup string) (Location, error) {
+	cred, err := c.NewCreds()
+	if err != nil {
+		return "", err
+	}
+	rgClient, err := armresources.NewResourceGroupsClient(c.SubscriptionID, cred, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := rgClient.Get(ctx, resourceGroup, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.Location == nil {
+		return "", fmt.Errorf("resource group %q has no location", resourceGroup)
+	}
+	return Location(*resp.Location), nil
+}
+
+func (c *identityClient) ListResourceGroups(ctx context.Context) ([]string, error) {
+	cred, err := c.NewCreds()
+	if err != nil {
+		return nil, err
+	}
+	rgClient, err := armresources.NewResourceGroupsClient(c.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	pager := rgClient.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, rg := range page.Value {
+			if rg.Name != nil {
+				names = append(names, *rg.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (c *identityClient) identityURL(resourceGroup, name string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ManagedIdentity/userAssignedIdentities/%s",
+		ManagementEndpoint, c.SubscriptionID, url.PathEscape(resourceGroup), url.PathEscape(name))
+}
+
+// armCall makes a direct ARM REST call, since the CLI doesn't otherwise need
+// the managed identity SDK. Errors are returned as *azcore.ResponseError.
+func (c *identityClient) armCall(ctx context.Context, method, endpoint string, body, result any) error {
+	token, err := c.ArmToken(ctx)
+	if err != nil {
+		return err
+	}
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"?api-version="+managedIdentityAPIVersion, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var armErr struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		_ = json.Unmarshal(data, &armErr)
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return &azcore.ResponseError{ErrorCode: armErr.Error.Code, StatusCode: resp.StatusCode, RawResponse: resp}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+type identityJSON struct {
+	ID         string `json:"id"`
+	Properties struct {
+		ClientID    string `json:"clientId"`
+		PrincipalID string `json:"principalId"`
+		TenantID    string `json:"tenantId"`
+	} `json:"properties"`
+}
+
+func (i identityJSON) identity() *ManagedIdentity {
+	return &ManagedIdentity{ID: i.ID, ClientID: i.Properties.ClientID, PrincipalID: i.Properties.PrincipalID, TenantID: i.Properties.TenantID}
+}
+
+func (c *identityClient) GetIdentity(ctx context.Context, resourceGroup, name string) (*ManagedIdentity, error) {
+	var result identityJSON
+	if err := c.armCall(ctx, http.MethodGet, c.identityURL(resourceGroup, name), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.identity(), nil
+}
+
+func (c *identityClient) CreateIdentity(ctx context.Context, resourceGroup, name string, location Location) (*ManagedIdentity, error) {
+	body := map[string]any{
+		"location": location.String(),
+		"tags":     map[string]string{"CreatedBy": "Defang"},
+	}
+	var result identityJSON
+	if err := c.armCall(ctx, http.MethodPut, c.identityURL(resourceGroup, name), body, &result); err != nil {
+		return nil, err
+	}
+	return result.identity(), nil
+}
+
+func (c *identityClient) DeleteIdentity(ctx context.Context, resourceGroup, name string) error {
+	return c.armCall(ctx, http.MethodDelete, c.identityURL(resourceGroup, name), nil, nil)
+}
+
+type federatedCredentialJSON struct {
+	Properties struct {
+		Issuer    string   `json:"issuer"`
+		Subject   string   `json:"subject"`
+		Audiences []string `json:"audiences"`
+	} `json:"properties"`
+}
+
+func (c *identityClient) GetFederatedCredential(ctx context.Context, resourceGroup, identity, name string) (*FederatedCredential, error) {
+	var result federatedCredentialJSON
+	endpoint := c.identityURL(resourceGroup, identity) + "/federatedIdentityCredentials/" + url.PathEscape(name)
+	if err := c.armCall(ctx, http.MethodGet, endpoint, nil, &result); err != nil {
+		return nil, err
+	}
+	return &FederatedCredential{Issuer: result.Properties.Issuer, Subject: result.Properties.Subject, Audiences: result.Properties.Audiences}, nil
+}
+
+func (c *identityClient) PutFederatedCredential(ctx context.Context, resourceGroup, identity, name string, cred FederatedCredential) error {
+	var body federatedCredentialJSON
+	body.Properties.Issuer = cred.Issuer
+	body.Properties.Subject = cred.Subject
+	body.Properties.Audiences = cred.Audiences
+	endpoint := c.identityURL(resourceGroup, identity) + "/federatedIdentityCredentials/" + url.PathEscape(name)
+	return c.armCall(ctx, http.MethodPut, endpoint, body, nil)
+}
+
+func (c *identityClient) newRoleAssignmentsClient() (*armauthorization.RoleAssignmentsClient, error) {
+	cred, err := c.NewCreds()
+	if err != nil {
+		return nil, err
+	}
+	return armauthorization.NewRoleAssignmentsClient(c.SubscriptionID, cred, nil)
+}
+
+func (c *identityClient) HasRoleAssignment(ctx context.Context, scope, roleID, principalID string) (bool, error) {
+	raClient, err := c.newRoleAssignmentsClient()
+	if err != nil {
+		return false, err
+	}
+	return HasRoleAssignment(ctx, raClient, scope, RoleDefinitionID(c.SubscriptionID, roleID), principalID)
+}
+
+func (c *identityClient) AssignRole(ctx context.Context, scope, roleID, principalID string) error {
+	raClient, err := c.newRoleAssignmentsClient()
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		_, err = raClient.Create(ctx, scope, uuid.NewString(), armauthorization.RoleAssignmentCreateParameters{
+			Properties: &armauthorization.RoleAssignmentProperties{
+				PrincipalID:      to.Ptr(principalID),
+				RoleDefinitionID: to.Ptr(RoleDefinitionID(c.SubscriptionID, roleID)),
+				PrincipalType:    to.Ptr(armauthorization.PrincipalTypeServicePrincipal),
+			},
+		}, nil)
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) {
+			return err
+		}
+		switch {
+		case respErr.ErrorCode == "RoleAssignmentExists":
+			return nil
+		case respErr.ErrorCode == "PrincipalNotFound" && i < 12: // a new identity takes a while to replicate
+			term.Debugf("Principal %s not found yet, will retry: %v", principalID, err)
+			if err := pkg.SleepWithContext(ctx, 5*time.Second); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// DeleteRoleAssignments deletes the principal's role assignments on and below the scope.
+func (c *identityClient) DeleteRoleAssignments(ctx context.Context, scope, principalID string) error {
+	raClient, err := c.newRoleAssignmentsClient()
+	if err != nil {
+		return err
+	}
+	pager := raClient.NewListForScopePager(scope, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr(fmt.Sprintf("principalId eq '%s'", principalID)),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, ra := range page.Value {
+			if ra.ID == nil {
+				continue
+			}
+			if _, err := raClient.DeleteByID(ctx, *ra.ID, nil); err != nil && !IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
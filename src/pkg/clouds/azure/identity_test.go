@@ -0,0 +1,21 @@
+package azure
+
+import "testing"
+
+func TestIsParentScope(t *testing.T) {
+	tests := []struct {
+		parent, scope string
+		want          bool
+	}{
+		{"/", "/subscriptions/sub", true},
+		{"/subscriptions/sub", "/subscriptions/sub", true},
+		{"/subscriptions/SUB", "/subscriptions/sub/resourceGroups/rg", true},
+		{"/subscriptions/sub/resourceGroups/rg", "/subscriptions/sub", false},
+		{"/subscriptions/sub/resourceGroups/rg", "/subscriptions/sub/resourceGroups/rg2", false},
+	}
+	for _, tt := range tests {
+		if got := isParentScope(tt.parent, tt.scope); got != tt.want {
+			t.Errorf("isParentScope(%q, %q) = %v, want %v", tt.parent, tt.scope, got, tt.want)
+		}
+	}
+}
@@ -255,6 +255,11 @@ func (kv *KeyVault) assignSecretsOfficerRole(ctx context.Context, cred azcore.To
 		if errors.As(err, &respErr) && respErr.ErrorCode == "RoleAssignmentExists" {
 			return nil
 		}
+		if azure.IsAuthorizationFailed(err) {
+			if ok, _ := azure.HasRoleAssignment(ctx, raClient, vaultResourceID, roleDefID, callerOID); ok {
+				return nil
+			}
+		}
 		return err
 	}
 	return nil
@@ -385,6 +390,7 @@ func (kv *KeyVault) DeleteSecret(ctx context.Context, name string) error {
 type SecretEntry struct {
 	Name        string
 	OriginalKey string
+	Updated     time.Time // changes whenever a new version is set
 }
 
 // ListSecrets returns secrets whose names start with the given prefix.
@@ -413,6 +419,9 @@ func (kv *KeyVault) ListSecrets(ctx context.Context, prefix string) ([]SecretEnt
 					continue
 				}
 				entry := SecretEntry{Name: name}
+				if props.Attributes != nil && props.Attributes.Updated != nil {
+					entry.Updated = *props.Attributes.Updated
+				}
 				if props.Tags != nil {
 					if orig, ok := props.Tags["defang-config"]; ok && orig != nil {
 						entry.OriginalKey = *orig
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/DefangLabs/defang/src/pkg"
@@ -26,6 +27,12 @@ func (gcp Gcp) EnsureAPIsEnabled(ctx context.Context, apis ...string) error {
 
 	projectName := "projects/" + gcp.ProjectId
 
+	// Skip the APIs that are enabled already, so that enabling them is a no-op
+	// that does not need the serviceusage.services.enable permission.
+	if apis = disabledAPIs(ctx, service, projectName, apis); len(apis) == 0 {
+		return nil
+	}
+
 	for i := range maxAttempts {
 		term.Debugf("Enabling services: %v\n", apis)
 		req := &serviceusage.BatchEnableServicesRequest{
@@ -75,3 +82,22 @@ func (gcp Gcp) EnsureAPIsEnabled(ctx context.Context, apis ...string) error {
 	}
 	return fmt.Errorf("failed to enable services after %d attempts", maxAttempts) // This should never be reached
 }
+
+func disabledAPIs(ctx context.Context, service *serviceusage.Service, projectName string, apis []string) []string {
+	names := make([]string, len(apis))
+	for i, api := range apis {
+		names[i] = projectName + "/services/" + api
+	}
+	resp, err := service.Services.BatchGet(projectName).Names(names...).Context(ctx).Do()
+	if err != nil {
+		term.Debug("Failed to get the state of services:", err)
+		return apis
+	}
+	var disabled []string
+	for _, svc := range resp.Services {
+		if svc.State != "ENABLED" {
+			disabled = append(disabled, path.Base(svc.Name))
+		}
+	}
+	return disabled
+}
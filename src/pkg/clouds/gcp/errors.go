@@ -12,6 +12,10 @@ import (
 )
 
 func IsNotFound(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == 404 {
+		return true
+	}
 	if grpcErr, ok := status.FromError(err); ok {
 		if grpcErr.Code() == codes.NotFound {
 			return true
@@ -45,3 +49,14 @@ func IsAccessNotEnabled(err error) bool {
 	}
 	return false
 }
+
+func IsPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == 412 {
+		return true
+	}
+	if grpcErr, ok := status.FromError(err); ok && grpcErr.Code() == codes.FailedPrecondition {
+		return true
+	}
+	return false
+}
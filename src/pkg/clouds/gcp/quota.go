@@ -0,0 +1,59 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+
+	serviceusage "google.golang.org/api/serviceusage/v1beta1"
+)
+
+// allocationQuotaUnit is the unit of the quotas on the resources allocated in
+// a region, as opposed to the rate quotas of the API.
+const allocationQuotaUnit = "1/{project}/{region}"
+
+// GetServiceQuotaLimits returns the effective allocation quota limits of a
+// service in the region, by metric. A negative limit means unlimited. The
+// Service Usage API does not report the current usage.
+func (gcp Gcp) GetServiceQuotaLimits(ctx context.Context, service string) (map[string]int64, error) {
+	svc, err := serviceusage.NewService(ctx, gcp.Options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Service Usage client: %w", err)
+	}
+
+	parent := fmt.Sprintf("projects/%s/services/%s", gcp.ProjectId, service)
+	limits := make(map[string]int64)
+	err = svc.Services.ConsumerQuotaMetrics.List(parent).View("BASIC").Pages(ctx, func(resp *serviceusage.ListConsumerQuotaMetricsResponse) error {
+		for _, metric := range resp.Metrics {
+			for _, limit := range metric.ConsumerQuotaLimits {
+				if limit.Unit != allocationQuotaUnit {
+					continue
+				}
+				if bucket := regionQuotaBucket(limit.QuotaBuckets, gcp.Region); bucket != nil {
+					limits[metric.Metric] = bucket.EffectiveLimit
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the quotas of %s: %w", service, err)
+	}
+	return limits, nil
+}
+
+// regionQuotaBucket returns the bucket of the region, or the default bucket
+// when the region has no override.
+func regionQuotaBucket(buckets []*serviceusage.QuotaBucket, region string) *serviceusage.QuotaBucket {
+	var found *serviceusage.QuotaBucket
+	for _, bucket := range buckets {
+		switch {
+		case len(bucket.Dimensions) == 0:
+			if found == nil {
+				found = bucket
+			}
+		case len(bucket.Dimensions) == 1 && bucket.Dimensions["region"] == region:
+			return bucket
+		}
+	}
+	return found
+}
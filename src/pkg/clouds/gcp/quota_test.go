@@ -0,0 +1,24 @@
+package gcp
+
+import (
+	"testing"
+
+	serviceusage "google.golang.org/api/serviceusage/v1beta1"
+)
+
+func TestRegionQuotaBucket(t *testing.T) {
+	buckets := []*serviceusage.QuotaBucket{
+		{EffectiveLimit: 10},
+		{EffectiveLimit: 20, Dimensions: map[string]string{"region": "us-central1"}},
+		{EffectiveLimit: 30, Dimensions: map[string]string{"region": "us-central1", "zone": "us-central1-a"}},
+	}
+	if got := regionQuotaBucket(buckets, "us-central1"); got == nil || got.EffectiveLimit != 20 {
+		t.Errorf("expected the region bucket, got %+v", got)
+	}
+	if got := regionQuotaBucket(buckets, "europe-west1"); got == nil || got.EffectiveLimit != 10 {
+		t.Errorf("expected the default bucket, got %+v", got)
+	}
+	if got := regionQuotaBucket(nil, "us-central1"); got != nil {
+		t.Errorf("expected no bucket, got %+v", got)
+	}
+}
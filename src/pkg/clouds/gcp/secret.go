@@ -57,6 +57,26 @@ func (gcp Gcp) AddSecretVersion(ctx context.Context, secretName string, payload
 	return resp.Name, nil
 }
 
+// GetLatestSecretVersion returns the name of the latest version of a secret,
+// without accessing its payload.
+func (gcp Gcp) GetLatestSecretVersion(ctx context.Context, secretName string) (string, error) {
+	client, err := secretmanager.NewClient(ctx, gcp.Options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create secretmanager client: %w", err)
+	}
+	defer client.Close()
+
+	req := &secretmanagerpb.GetSecretVersionRequest{
+		Name: fmt.Sprintf("projects/%v/secrets/%v/versions/latest", gcp.ProjectId, secretName),
+	}
+
+	resp, err := client.GetSecretVersion(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Name, nil
+}
+
 // CleanupOldVersions keeps only the two most recent enabled versions of a secret.
 func (gcp Gcp) CleanupOldVersionsExcept(ctx context.Context, secretName string, keep int) error {
 	client, err := secretmanager.NewClient(ctx, gcp.Options...)
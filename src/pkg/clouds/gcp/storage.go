@@ -201,6 +201,89 @@ func (gcp Gcp) getBucketObject(ctx context.Context, bucketName, objectName strin
 	return io.ReadAll(r)
 }
 
+func (gcp Gcp) PutBucketObjectWithServiceAccount(ctx context.Context, bucketName, objectName, serviceAccount string, data []byte) error {
+	client, err := gcp.getCloudStorageClientWithServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	w := client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write bucket object (%q): %w", objectName, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write bucket object (%q): %w", objectName, err)
+	}
+	return nil
+}
+
+// GetBucketObjectWithGeneration returns the object and its generation, which
+// can be used as a precondition to update or delete the object.
+func (gcp Gcp) GetBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string) ([]byte, int64, error) {
+	client, err := gcp.getCloudStorageClientWithServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(bucketName).Object(objectName).NewReader(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get bucket object (%q) reader: %w", objectName, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, r.Attrs.Generation, nil
+}
+
+// PutBucketObjectWithGeneration writes the object only if its generation is
+// the given one, or if it does not exist when generation is 0, and returns the
+// new generation.
+func (gcp Gcp) PutBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string, data []byte, generation int64) (int64, error) {
+	client, err := gcp.getCloudStorageClientWithServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	conds := storage.Conditions{GenerationMatch: generation}
+	if generation == 0 {
+		conds = storage.Conditions{DoesNotExist: true}
+	}
+	w := client.Bucket(bucketName).Object(objectName).If(conds).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return 0, fmt.Errorf("failed to write bucket object (%q): %w", objectName, err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write bucket object (%q): %w", objectName, err)
+	}
+	return w.Attrs().Generation, nil
+}
+
+// DeleteBucketObjectWithGeneration deletes the object only if its generation
+// is the given one, or unconditionally when generation is 0.
+func (gcp Gcp) DeleteBucketObjectWithGeneration(ctx context.Context, bucketName, objectName, serviceAccount string, generation int64) error {
+	client, err := gcp.getCloudStorageClientWithServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	obj := client.Bucket(bucketName).Object(objectName)
+	if generation != 0 {
+		obj = obj.If(storage.Conditions{GenerationMatch: generation})
+	}
+	if err := obj.Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete bucket object (%q): %w", objectName, err)
+	}
+	return nil
+}
+
 func (gcp Gcp) IterateBucketObjects(ctx context.Context, bucketName, prefix string) (iter.Seq2[*storage.ObjectAttrs, error], error) {
 	client, err := newStorageClient(ctx, gcp.Options...)
 	if err != nil {
@@ -0,0 +1,299 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/iam"
+	iamadm "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"cloud.google.com/go/storage"
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	iamv1 "google.golang.org/api/iam/v1"
+	"google.golang.org/genproto/googleapis/type/expr"
+)
+
+// WorkloadIdentityProvider is an OIDC provider in a workload identity pool.
+type WorkloadIdentityProvider struct {
+	Name               string // projects/NUMBER/locations/global/workloadIdentityPools/POOL/providers/PROVIDER
+	State              string // ACTIVE or DELETED
+	IssuerUri          string
+	AttributeCondition string
+	AttributeMapping   map[string]string
+}
+
+func (p WorkloadIdentityProvider) equal(other *iamv1.WorkloadIdentityPoolProvider) bool {
+	return other.Oidc != nil &&
+		other.Oidc.IssuerUri == p.IssuerUri &&
+		other.AttributeCondition == p.AttributeCondition &&
+		maps.Equal(other.AttributeMapping, p.AttributeMapping)
+}
+
+func (gcp Gcp) GetProjectNumber(ctx context.Context) (string, error) {
+	client, err := resourcemanager.NewProjectsClient(ctx, gcp.Options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create resource manager client: %w", err)
+	}
+	defer client.Close()
+
+	project, err := client.GetProject(ctx, &resourcemanagerpb.GetProjectRequest{Name: "projects/" + gcp.ProjectId})
+	if err != nil {
+		return "", fmt.Errorf("failed to get project %s: %w", gcp.ProjectId, err)
+	}
+	return strings.TrimPrefix(project.Name, "projects/"), nil
+}
+
+func (gcp Gcp) workloadIdentityPoolName(poolId string) string {
+	return fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s", gcp.ProjectId, poolId)
+}
+
+func (gcp Gcp) GetWorkloadIdentityProvider(ctx context.Context, poolId, providerId string) (*WorkloadIdentityProvider, error) {
+	service, err := iamv1.NewService(ctx, gcp.Options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IAM service: %w", err)
+	}
+	provider, err := service.Projects.Locations.WorkloadIdentityPools.Providers.Get(gcp.workloadIdentityPoolName(poolId) + "/providers/" + providerId).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	result := &WorkloadIdentityProvider{
+		Name:               provider.Name,
+		State:              provider.State,
+		AttributeCondition: provider.AttributeCondition,
+		AttributeMapping:   provider.AttributeMapping,
+	}
+	if provider.Oidc != nil {
+		result.IssuerUri = provider.Oidc.IssuerUri
+	}
+	return result, nil
+}
+
+// EnsureWorkloadIdentityProviderExists creates, undeletes, or updates the
+// workload identity pool and its OIDC provider and returns the provider name.
+func (gcp Gcp) EnsureWorkloadIdentityProviderExists(ctx context.Context, poolId, providerId, description string, provider WorkloadIdentityProvider) (string, error) {
+	service, err := iamv1.NewService(ctx, gcp.Options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create IAM service: %w", err)
+	}
+	pools := service.Projects.Locations.WorkloadIdentityPools
+
+	poolName := gcp.workloadIdentityPoolName(poolId)
+	pool, err := pools.Get(poolName).Context(ctx).Do()
+	switch {
+	case IsNotFound(err):
+		term.Infof("Creating workload identity pool %s", poolId)
+		if _, err := pools.Create("projects/"+gcp.ProjectId+"/locations/global", &iamv1.WorkloadIdentityPool{
+			DisplayName: poolId,
+			Description: description,
+		}).WorkloadIdentityPoolId(poolId).Context(ctx).Do(); err != nil {
+			return "", fmt.Errorf("failed to create workload identity pool: %w", err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to get workload identity pool: %w", err)
+	case pool.State == "DELETED": // deleted pools are kept for 30 days and block reuse of the ID
+		term.Infof("Undeleting workload identity pool %s", poolId)
+		if _, err := pools.Undelete(poolName, &iamv1.UndeleteWorkloadIdentityPoolRequest{}).Context(ctx).Do(); err != nil {
+			return "", fmt.Errorf("failed to undelete workload identity pool: %w", err)
+		}
+	}
+
+	want := &iamv1.WorkloadIdentityPoolProvider{
+		DisplayName:        providerId,
+		AttributeCondition: provider.AttributeCondition,
+		AttributeMapping:   provider.AttributeMapping,
+		Oidc:               &iamv1.Oidc{IssuerUri: provider.IssuerUri},
+	}
+	providerName := poolName + "/providers/" + providerId
+	for i := range maxAttempts { // the pool might not be usable for a few seconds after creation
+		existing, err := pools.Providers.Get(providerName).Context(ctx).Do()
+		switch {
+		case err == nil && existing.State != "DELETED" && provider.equal(existing):
+			term.Debugf("Workload identity provider %s already exists", providerId)
+			return existing.Name, nil
+		case IsNotFound(err):
+			term.Infof("Creating workload identity provider %s", providerId)
+			_, err = pools.Providers.Create(poolName, want).WorkloadIdentityPoolProviderId(providerId).Context(ctx).Do()
+		case err != nil:
+		case existing.State == "DELETED":
+			term.Infof("Undeleting workload identity provider %s", providerId)
+			_, err = pools.Providers.Undelete(providerName, &iamv1.UndeleteWorkloadIdentityPoolProviderRequest{}).Context(ctx).Do()
+		default:
+			term.Infof("Updating workload identity provider %s", providerId)
+			_, err = pools.Providers.Patch(providerName, want).UpdateMask("attributeCondition,attributeMapping,oidc").Context(ctx).Do()
+		}
+		if err == nil {
+			continue // verify the change
+		}
+		if i == maxAttempts-1 {
+			return "", fmt.Errorf("failed to ensure workload identity provider exists: %w", err)
+		}
+		term.Debugf("Failed to ensure workload identity provider, will retry in %v: %v\n", retryInterval, err)
+		if err := pkg.SleepWithContext(ctx, retryInterval); err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("timed out waiting for workload identity provider %s", providerId)
+}
+
+// DeleteWorkloadIdentityPool deletes the pool and its providers. GCP keeps
+// deleted pools for 30 days, during which they can be undeleted.
+func (gcp Gcp) DeleteWorkloadIdentityPool(ctx context.Context, poolId string) error {
+	service, err := iamv1.NewService(ctx, gcp.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create IAM service: %w", err)
+	}
+	if _, err := service.Projects.Locations.WorkloadIdentityPools.Delete(gcp.workloadIdentityPoolName(poolId)).Context(ctx).Do(); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to delete workload identity pool: %w", err)
+	}
+	return nil
+}
+
+// conditionalPolicyVersion is the IAM policy version that supports conditional
+// bindings; reading an older version would mangle them.
+const conditionalPolicyVersion = 3
+
+// EnsurePrincipalHasConditionalRole binds the role to the principal on the
+// project, only for the resources that match the condition.
+func (gcp Gcp) EnsurePrincipalHasConditionalRole(ctx context.Context, principal, role string, condition *expr.Expr) error {
+	client, err := resourcemanager.NewProjectsClient(ctx, gcp.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create resource manager client: %w", err)
+	}
+	defer client.Close()
+
+	resource := "projects/" + gcp.ProjectId
+	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource,
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get IAM policy for resource %s: %w", resource, err)
+	}
+	i := slices.IndexFunc(policy.Bindings, func(b *iampb.Binding) bool {
+		return b.Role == role && b.Condition.GetExpression() == condition.Expression
+	})
+	switch {
+	case i < 0:
+		policy.Bindings = append(policy.Bindings, &iampb.Binding{Role: role, Members: []string{principal}, Condition: condition})
+	case slices.Contains(policy.Bindings[i].Members, principal):
+		term.Debugf("%s already has role %s on resource %s", principal, role, resource)
+		return nil
+	default:
+		policy.Bindings[i].Members = append(policy.Bindings[i].Members, principal)
+	}
+	policy.Version = conditionalPolicyVersion
+
+	term.Infof("Updating IAM policy for resource %s", resource)
+	for i := range maxAttempts { // the principal might not be visible for a few seconds after creation
+		_, err = client.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: resource, Policy: policy})
+		if err == nil || i == maxAttempts-1 {
+			break
+		}
+		term.Debugf("Failed to set IAM policy for resource %s, will retry in %v: %v\n", resource, retryInterval, err)
+		if err := pkg.SleepWithContext(ctx, retryInterval); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set IAM policy for resource %s: %w", resource, err)
+	}
+	return nil
+}
+
+// RemovePrincipalRoles removes the principal from the bindings of the roles on
+// the project, including conditional bindings.
+func (gcp Gcp) RemovePrincipalRoles(ctx context.Context, principal string, roles []string) error {
+	client, err := resourcemanager.NewProjectsClient(ctx, gcp.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create resource manager client: %w", err)
+	}
+	defer client.Close()
+
+	resource := "projects/" + gcp.ProjectId
+	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource,
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get IAM policy for resource %s: %w", resource, err)
+	}
+	needUpdate := false
+	for _, binding := range policy.Bindings {
+		if slices.Contains(roles, binding.Role) && slices.Contains(binding.Members, principal) {
+			binding.Members = slices.DeleteFunc(binding.Members, func(m string) bool { return m == principal })
+			needUpdate = true
+		}
+	}
+	if !needUpdate {
+		return nil
+	}
+	policy.Bindings = slices.DeleteFunc(policy.Bindings, func(b *iampb.Binding) bool { return len(b.Members) == 0 })
+	policy.Version = conditionalPolicyVersion
+	term.Infof("Updating IAM policy for resource %s", resource)
+	if _, err := client.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: resource, Policy: policy}); err != nil {
+		return fmt.Errorf("failed to set IAM policy for resource %s: %w", resource, err)
+	}
+	return nil
+}
+
+func (gcp Gcp) RemovePrincipalBucketRoles(ctx context.Context, bucketName, principal string, roles []string) error {
+	client, err := storage.NewClient(ctx, gcp.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %w", err)
+	}
+	defer client.Close()
+
+	bucket := client.Bucket(bucketName)
+	policy, err := bucket.IAM().Policy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get IAM policy for bucket %s: %w", bucketName, err)
+	}
+	if !removeFromPolicy(policy, principal, roles) {
+		return nil
+	}
+	term.Infof("Updating IAM policy for principal %s on bucket %s", principal, bucketName)
+	if err := bucket.IAM().SetPolicy(ctx, policy); err != nil {
+		return fmt.Errorf("failed to set IAM policy for bucket %s: %w", bucketName, err)
+	}
+	return nil
+}
+
+func (gcp Gcp) RemovePrincipalServiceAccountRoles(ctx context.Context, principal, serviceAccount string, roles []string) error {
+	client, err := iamadm.NewIamClient(ctx, gcp.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create iam client: %w", err)
+	}
+	defer client.Close()
+
+	resource := fmt.Sprintf("projects/%s/serviceAccounts/%s", gcp.ProjectId, serviceAccount)
+	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: resource})
+	if err != nil {
+		return fmt.Errorf("failed to get IAM policy for service account %s: %w", serviceAccount, err)
+	}
+	if !removeFromPolicy(policy, principal, roles) {
+		return nil
+	}
+	term.Infof("Updating IAM policy for %s on service account %s", principal, serviceAccount)
+	if _, err := client.SetIamPolicy(ctx, &iamadm.SetIamPolicyRequest{Resource: resource, Policy: policy}); err != nil {
+		return fmt.Errorf("failed to set IAM policy for service account %s: %w", serviceAccount, err)
+	}
+	return nil
+}
+
+func removeFromPolicy(policy *iam.Policy, principal string, roles []string) bool {
+	removed := false
+	for _, roleStr := range roles {
+		role := iam.RoleName(roleStr)
+		if policy.HasRole(principal, role) {
+			policy.Remove(principal, role)
+			removed = true
+		}
+	}
+	return removed
+}
@@ -58,6 +58,32 @@ func (dc DebugConfig) String() string {
 	return cmd
 }
 
+// Summary is a plain-text summary of the failed deployment, for readers that
+// can't run the debugger themselves, like notifications and MCP prompts.
+func (dc DebugConfig) Summary() string {
+	var sb strings.Builder
+	if dc.Deployment != "" {
+		fmt.Fprintf(&sb, "Deployment: %s\n", dc.Deployment)
+	}
+	if dc.ProviderID != nil && *dc.ProviderID != "" {
+		fmt.Fprintf(&sb, "Provider: %s\n", dc.ProviderID.Name())
+	}
+	if dc.Stack != "" {
+		fmt.Fprintf(&sb, "Stack: %s\n", dc.Stack)
+	}
+	if len(dc.FailedServices) > 0 {
+		fmt.Fprintf(&sb, "Failed services: %s\n", strings.Join(dc.FailedServices, ", "))
+	}
+	if pkg.IsValidTime(dc.Since) {
+		fmt.Fprintf(&sb, "Started: %s\n", dc.Since.UTC().Format(time.RFC3339))
+	}
+	if pkg.IsValidTime(dc.Until) {
+		fmt.Fprintf(&sb, "Finished: %s\n", dc.Until.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&sb, "To debug the deployment, do: defang %s\n", dc.String())
+	return sb.String()
+}
+
 type Surveyor interface {
 	AskOne(q survey.Prompt, response interface{}, opts ...survey.AskOpt) error
 }
@@ -83,8 +109,8 @@ type Debugger struct {
 	interactive bool
 }
 
-func NewDebugger(ctx context.Context, fabricAddr string, stack *stacks.Parameters, interactive bool) (*Debugger, error) {
-	var opts []agent.Option
+func NewDebugger(ctx context.Context, fabricAddr string, stack *stacks.Parameters, interactive bool, agentOpts ...agent.Option) (*Debugger, error) {
+	opts := agentOpts
 	if !interactive {
 		opts = append(opts, agent.WithNonInteractive())
 	}
@@ -270,3 +270,22 @@ func TestTruncatePromptPayloads(t *testing.T) {
 		})
 	}
 }
+
+func TestDebugConfigSummary(t *testing.T) {
+	providerID := client.ProviderGCP
+	dc := DebugConfig{
+		Deployment:     "abc123",
+		ProviderID:     &providerID,
+		Stack:          "beta",
+		FailedServices: []string{"app", "db"},
+		Since:          time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	expected := `Deployment: abc123
+Provider: Google Cloud Platform
+Stack: beta
+Failed services: app, db
+Started: 2026-10-01T12:00:00Z
+To debug the deployment, do: defang debug --deployment=abc123 --since=2026-10-01T12:00:00Z --stack=beta app db
+`
+	assert.Equal(t, expected, dc.Summary())
+}
@@ -0,0 +1,82 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/DefangLabs/defang/src/pkg/http"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+const apiUrl = "https://api.github.com"
+
+type PullRequestState string
+
+const (
+	PullRequestOpen   PullRequestState = "open"
+	PullRequestClosed PullRequestState = "closed"
+)
+
+// authHeader returns the Authorization header for the GitHub API, if the user
+// has set a GitHub token.
+func authHeader() http.Header {
+	// Anonymous API request to GitHub are rate limited to 60 requests per hour per IP.
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		githubToken = os.Getenv("GH_TOKEN")
+	}
+	header := http.Header{}
+	if githubToken != "" {
+		header.Set("Authorization", "Bearer "+githubToken)
+	}
+	return header
+}
+
+// GetPullRequestState returns whether the pull request with the given number in
+// the "owner/name" repository is open or closed (which includes merged).
+func GetPullRequestState(ctx context.Context, repository string, number int) (PullRequestState, error) {
+	resp, err := http.GetWithHeader(ctx, fmt.Sprintf("%s/repos/%s/pulls/%d", apiUrl, repository, number), authHeader())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		term.Debug(resp.Header)
+		githubError := githubError{Message: resp.Status}
+		if err := json.NewDecoder(resp.Body).Decode(&githubError); err != nil {
+			term.Debugf("Failed to decode GitHub response: %v", err)
+		}
+		return "", fmt.Errorf("error fetching pull request %s#%d from GitHub: %s", repository, number, githubError.Message)
+	}
+	var pull struct {
+		State PullRequestState `json:"state"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&pull); err != nil {
+		return "", err
+	}
+	return pull.State, nil
+}
+
+// BranchExists returns whether the branch exists in the "owner/name" repository.
+func BranchExists(ctx context.Context, repository, branch string) (bool, error) {
+	resp, err := http.GetWithHeader(ctx, fmt.Sprintf("%s/repos/%s/branches/%s", apiUrl, repository, url.PathEscape(branch)), authHeader())
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	}
+	term.Debug(resp.Header)
+	githubError := githubError{Message: resp.Status}
+	if err := json.NewDecoder(resp.Body).Decode(&githubError); err != nil {
+		term.Debugf("Failed to decode GitHub response: %v", err)
+	}
+	return false, fmt.Errorf("error fetching branch %q of %s from GitHub: %s", branch, repository, githubError.Message)
+}
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ourHttp "github.com/DefangLabs/defang/src/pkg/http"
+)
+
+func TestGetPullRequestState(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    PullRequestState
+		wantErr string
+	}{
+		{name: "open", status: 200, body: `{"number":123,"state":"open"}`, want: PullRequestOpen},
+		{name: "closed", status: 200, body: `{"number":123,"state":"closed","merged":true}`, want: PullRequestClosed},
+		{name: "not found", status: 404, body: `{"message":"Not Found"}`, wantErr: "error fetching pull request DefangLabs/defang#123 from GitHub: Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Add("Content-Type", "application/json")
+			rec.WriteHeader(tt.status)
+			rec.WriteString(tt.body)
+			response := rec.Result()
+
+			client := ourHttp.DefaultClient
+			t.Cleanup(func() {
+				ourHttp.DefaultClient = client
+				response.Body.Close()
+			})
+			ourHttp.DefaultClient = &http.Client{Transport: &mockRoundTripper{
+				method: http.MethodGet,
+				url:    "https://api.github.com/repos/DefangLabs/defang/pulls/123",
+				resp:   response,
+			}}
+
+			state, err := GetPullRequestState(t.Context(), "DefangLabs/defang", 123)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("GetPullRequestState() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPullRequestState() error = %v; want nil", err)
+			}
+			if state != tt.want {
+				t.Errorf("GetPullRequestState() = %v; want %v", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr string
+	}{
+		{name: "exists", status: 200, body: `{"name":"feature/x"}`, want: true},
+		{name: "deleted", status: 404, body: `{"message":"Branch not found"}`, want: false},
+		{name: "forbidden", status: 403, body: `{"message":"API rate limit exceeded"}`, wantErr: `error fetching branch "feature/x" of DefangLabs/defang from GitHub: API rate limit exceeded`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Add("Content-Type", "application/json")
+			rec.WriteHeader(tt.status)
+			rec.WriteString(tt.body)
+			response := rec.Result()
+
+			client := ourHttp.DefaultClient
+			t.Cleanup(func() {
+				ourHttp.DefaultClient = client
+				response.Body.Close()
+			})
+			ourHttp.DefaultClient = &http.Client{Transport: &mockRoundTripper{
+				method: http.MethodGet,
+				url:    "https://api.github.com/repos/DefangLabs/defang/branches/feature%2Fx",
+				resp:   response,
+			}}
+
+			exists, err := BranchExists(t.Context(), "DefangLabs/defang", "feature/x")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("BranchExists() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BranchExists() error = %v; want nil", err)
+			}
+			if exists != tt.want {
+				t.Errorf("BranchExists() = %v; want %v", exists, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/DefangLabs/defang/src/pkg/http"
 	"github.com/DefangLabs/defang/src/pkg/term"
@@ -19,17 +18,8 @@ type githubError struct {
 }
 
 func GetLatestReleaseTag(ctx context.Context) (string, error) {
-	// Anonymous API request to GitHub are rate limited to 60 requests per hour per IP.
 	// Check whether the user has set a GitHub token to increase the rate limit. (Copied from the install script.)
-	githubToken := os.Getenv("GITHUB_TOKEN")
-	if githubToken == "" {
-		githubToken = os.Getenv("GH_TOKEN")
-	}
-	header := http.Header{}
-	if githubToken != "" {
-		header.Set("Authorization", "Bearer "+githubToken)
-	}
-	resp, err := http.GetWithHeader(ctx, latestUrl, header)
+	resp, err := http.GetWithHeader(ctx, latestUrl, authHeader())
 	if err != nil {
 		return "", err
 	}
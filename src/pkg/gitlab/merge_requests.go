@@ -0,0 +1,100 @@
+// Package gitlab queries the GitLab API for the state of merge requests and
+// branches, authenticating with the token of the CI job or the user.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/DefangLabs/defang/src/pkg/http"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+const defaultApiUrl = "https://gitlab.com/api/v4"
+
+type MergeRequestState string
+
+const (
+	MergeRequestOpened MergeRequestState = "opened"
+	MergeRequestClosed MergeRequestState = "closed"
+	MergeRequestLocked MergeRequestState = "locked"
+	MergeRequestMerged MergeRequestState = "merged"
+)
+
+type gitlabError struct {
+	Message string `json:"message"`
+}
+
+// apiUrl returns the API of the GitLab instance of the CI job, or gitlab.com.
+func apiUrl() string {
+	// https://docs.gitlab.com/ci/variables/predefined_variables/
+	if apiUrl := os.Getenv("CI_API_V4_URL"); apiUrl != "" {
+		return apiUrl
+	}
+	return defaultApiUrl
+}
+
+// authHeader returns the header to authenticate with the GitLab API, if the
+// user has set a GitLab token or runs in a GitLab CI job.
+func authHeader() http.Header {
+	header := http.Header{}
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		header.Set("PRIVATE-TOKEN", token)
+	} else if token := os.Getenv("CI_JOB_TOKEN"); token != "" {
+		header.Set("JOB-TOKEN", token)
+	}
+	return header
+}
+
+func projectUrl(project string) string {
+	return fmt.Sprintf("%s/projects/%s", apiUrl(), url.PathEscape(project))
+}
+
+// errorMessage returns the message of a GitLab error response, or the status.
+func errorMessage(body io.Reader, status string) string {
+	gitlabError := gitlabError{Message: status}
+	if err := json.NewDecoder(body).Decode(&gitlabError); err != nil {
+		term.Debugf("Failed to decode GitLab response: %v", err)
+	}
+	return gitlabError.Message
+}
+
+// GetMergeRequestState returns the state of the merge request with the given
+// IID in the "group/project" project.
+func GetMergeRequestState(ctx context.Context, project string, iid int) (MergeRequestState, error) {
+	resp, err := http.GetWithHeader(ctx, fmt.Sprintf("%s/merge_requests/%d", projectUrl(project), iid), authHeader())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("error fetching merge request %s!%d from GitLab: %s", project, iid, errorMessage(resp.Body, resp.Status))
+	}
+	var mergeRequest struct {
+		State MergeRequestState `json:"state"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&mergeRequest); err != nil {
+		return "", err
+	}
+	return mergeRequest.State, nil
+}
+
+// BranchExists returns whether the branch exists in the "group/project" project.
+func BranchExists(ctx context.Context, project, branch string) (bool, error) {
+	resp, err := http.GetWithHeader(ctx, fmt.Sprintf("%s/repository/branches/%s", projectUrl(project), url.PathEscape(branch)), authHeader())
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	}
+	return false, fmt.Errorf("error fetching branch %q of %s from GitLab: %s", branch, project, errorMessage(resp.Body, resp.Status))
+}
@@ -0,0 +1,104 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ourHttp "github.com/DefangLabs/defang/src/pkg/http"
+)
+
+type mockRoundTripper struct {
+	url    string
+	header string
+	resp   *http.Response
+}
+
+func (rt *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.url != req.URL.String() {
+		return nil, fmt.Errorf("expected URL %q; got %q", rt.url, req.URL.String())
+	}
+	if rt.header != "" && req.Header.Get(rt.header) == "" {
+		return nil, fmt.Errorf("expected header %q", rt.header)
+	}
+	return rt.resp, nil
+}
+
+func mockResponse(t *testing.T, url, header string, status int, body string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rec.Header().Add("Content-Type", "application/json")
+	rec.WriteHeader(status)
+	rec.WriteString(body)
+	response := rec.Result()
+
+	client := ourHttp.DefaultClient
+	t.Cleanup(func() {
+		ourHttp.DefaultClient = client
+		response.Body.Close()
+	})
+	ourHttp.DefaultClient = &http.Client{Transport: &mockRoundTripper{url: url, header: header, resp: response}}
+}
+
+func TestGetMergeRequestState(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    MergeRequestState
+		wantErr string
+	}{
+		{name: "opened", status: 200, body: `{"iid":7,"state":"opened"}`, want: MergeRequestOpened},
+		{name: "merged", status: 200, body: `{"iid":7,"state":"merged"}`, want: MergeRequestMerged},
+		{name: "not found", status: 404, body: `{"message":"404 Not found"}`, wantErr: "error fetching merge request acme/app!7 from GitLab: 404 Not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CI_API_V4_URL", "")
+			t.Setenv("GITLAB_TOKEN", "")
+			t.Setenv("CI_JOB_TOKEN", "job-token")
+			mockResponse(t, "https://gitlab.com/api/v4/projects/acme%2Fapp/merge_requests/7", "JOB-TOKEN", tt.status, tt.body)
+
+			state, err := GetMergeRequestState(t.Context(), "acme/app", 7)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("GetMergeRequestState() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMergeRequestState() error = %v; want nil", err)
+			}
+			if state != tt.want {
+				t.Errorf("GetMergeRequestState() = %v; want %v", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchExists(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   bool
+	}{
+		{name: "exists", status: 200, want: true},
+		{name: "deleted", status: 404, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CI_API_V4_URL", "https://gitlab.example.com/api/v4")
+			t.Setenv("GITLAB_TOKEN", "token")
+			mockResponse(t, "https://gitlab.example.com/api/v4/projects/acme%2Fapp/repository/branches/feature%2Fx", "PRIVATE-TOKEN", tt.status, `{}`)
+
+			exists, err := BranchExists(t.Context(), "acme/app", "feature/x")
+			if err != nil {
+				t.Fatalf("BranchExists() error = %v; want nil", err)
+			}
+			if exists != tt.want {
+				t.Errorf("BranchExists() = %v; want %v", exists, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	agentTools "github.com/DefangLabs/defang/src/pkg/agent/tools"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/mcp/prompts"
+	"github.com/DefangLabs/defang/src/pkg/mcp/resources"
+	"github.com/DefangLabs/defang/src/pkg/mcp/tools"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const HTTPEndpointPath = "/mcp"
+
+// GenerateToken returns a random secret that clients can use as bearer token.
+func GenerateToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// requireBearerToken rejects requests that don't carry one of the tokens in
+// the Authorization header.
+func requireBearerToken(tokens []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !isValidToken(bearer, tokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="defang"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isValidToken(bearer string, tokens []string) bool {
+	valid := false
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// sessionState is the state of a single HTTP session. Each session has its own
+// copy of the stack parameters, so selecting a stack in one session does not
+// affect the others.
+type sessionState struct {
+	ec       elicitations.Controller
+	stack    stacks.Parameters
+	tools    map[string]server.ServerTool
+	prompts  map[string]server.ServerPrompt
+	lastUsed time.Time // guarded by sessionManager.mu
+}
+
+type collectToolsFunc func(ec elicitations.Controller, config StackConfig) []server.ServerTool
+
+// sessionIdleTimeout is how long a session is kept after its last request.
+const sessionIdleTimeout = time.Hour
+
+// sessionManager issues the session IDs of the streamable HTTP transport and
+// keeps the state of each session.
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionState
+	newState func() *sessionState
+	onRemove func(sessionID string) // called for each terminated or pruned session
+	now      func() time.Time       // for testing
+}
+
+var _ server.SessionIdManager = (*sessionManager)(nil)
+
+func (m *sessionManager) Generate() string {
+	id := uuid.NewString()
+	state := m.newState()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	state.lastUsed = m.now()
+	m.sessions[id] = state
+	return id
+}
+
+func (m *sessionManager) Validate(sessionID string) (isTerminated bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	if _, ok := m.sessions[sessionID]; !ok {
+		return false, fmt.Errorf("unknown session %q", sessionID)
+	}
+	return false, nil
+}
+
+func (m *sessionManager) Terminate(sessionID string) (isNotAllowed bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[sessionID]; !ok {
+		return false, fmt.Errorf("unknown session %q", sessionID)
+	}
+	delete(m.sessions, sessionID)
+	m.removed(sessionID)
+	return false, nil
+}
+
+// pruneLocked removes the sessions that have been idle for too long, because
+// clients don't always terminate their sessions.
+func (m *sessionManager) pruneLocked() {
+	cutoff := m.now().Add(-sessionIdleTimeout)
+	maps.DeleteFunc(m.sessions, func(id string, state *sessionState) bool {
+		if state.lastUsed.Before(cutoff) {
+			m.removed(id)
+			return true
+		}
+		return false
+	})
+}
+
+func (m *sessionManager) removed(sessionID string) {
+	if m.onRemove != nil {
+		m.onRemove(sessionID)
+	}
+}
+
+// get returns the state of the session of the request, if any.
+func (m *sessionManager) get(ctx context.Context) *sessionState {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.sessions[session.SessionID()]
+	if state != nil {
+		state.lastUsed = m.now()
+	}
+	return state
+}
+
+// NewDefangMCPHTTPHandler returns an http.Handler that serves the Defang MCP
+// server over the streamable HTTP transport at HTTPEndpointPath. Clients must
+// authenticate with one of the given bearer tokens.
+func NewDefangMCPHTTPHandler(version string, client MCPClient, cli agentTools.CLIInterface, config StackConfig, tokens []string) (http.Handler, error) {
+	// Setup knowledge base
+	if err := SetupKnowledgeBase(); err != nil {
+		return nil, fmt.Errorf("failed to setup knowledge base: %w", err)
+	}
+	backend := resources.NewCLIStackBackend(config.FabricAddr, cli)
+	return newHTTPHandler(version, client, config, tokens, tools.CollectTools, backend)
+}
+
+func newHTTPHandler(version string, client MCPClient, config StackConfig, tokens []string, collectTools collectToolsFunc, backend prompts.Backend) (http.Handler, error) {
+	if !slices.ContainsFunc(tokens, func(token string) bool { return token != "" }) {
+		return nil, errors.New("at least one bearer token is required")
+	}
+
+	sessions := &sessionManager{sessions: make(map[string]*sessionState), now: time.Now}
+	s := newMCPServer(version, &server.Hooks{
+		OnAfterInitialize: []server.OnAfterInitializeFunc{
+			func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+				if state := sessions.get(ctx); state != nil && message.Params.Capabilities.Elicitation == nil {
+					state.ec.SetSupported(false)
+				}
+			},
+		},
+	}, backend)
+	subs := newSubscriptions(s)
+
+	// This is used to pass down information of what MCP client we are using
+	common.MCPDevelopmentClient = string(client)
+
+	sessions.onRemove = subs.removeSession
+
+	elicitationsClient := NewMCPElicitationsController(s)
+	sessions.newState = func() *sessionState {
+		state := &sessionState{
+			ec:      elicitations.NewController(elicitationsClient),
+			stack:   *config.Stack,
+			tools:   make(map[string]server.ServerTool),
+			prompts: make(map[string]server.ServerPrompt),
+		}
+		toolTracker := ToolTracker{
+			providerId: &state.stack.Provider,
+			fabricAddr: config.FabricAddr,
+			client:     common.MCPDevelopmentClient,
+		}
+		stackConfig := StackConfig{FabricAddr: config.FabricAddr, Stack: &state.stack, OnDeploy: subs.onDeploy(&state.stack), RequireValidation: config.RequireValidation, IsolatedEnv: true}
+		for _, tool := range collectTools(state.ec, stackConfig) {
+			tool.Handler = toolTracker.TrackTool(tool.Tool.Name, tool.Handler)
+			state.tools[tool.Tool.Name] = tool
+		}
+		if backend != nil {
+			for _, prompt := range prompts.CollectPrompts(prompts.Context{Backend: backend, Files: os.DirFS("."), Stack: &state.stack}) {
+				state.prompts[prompt.Prompt.Name] = prompt
+			}
+		}
+		return state
+	}
+
+	// The server lists the tools once; each call is dispatched to the tools of
+	// the session, which are bound to the session's stack.
+	defangTools := collectTools(elicitations.NewController(elicitationsClient), StackConfig{FabricAddr: config.FabricAddr, Stack: &stacks.Parameters{}})
+	for i := range defangTools {
+		defangTools[i].Handler = sessions.dispatch(defangTools[i].Tool.Name)
+	}
+	s.AddTools(defangTools...)
+	if backend != nil {
+		defangPrompts := prompts.CollectPrompts(prompts.Context{Backend: backend, Files: os.DirFS("."), Stack: &stacks.Parameters{}})
+		for i := range defangPrompts {
+			defangPrompts[i].Handler = sessions.dispatchPrompt(defangPrompts[i].Prompt.Name)
+		}
+		s.AddPrompts(defangPrompts...)
+	}
+
+	httpServer := server.NewStreamableHTTPServer(s,
+		server.WithEndpointPath(HTTPEndpointPath),
+		server.WithSessionIdManager(sessions),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(HTTPEndpointPath, requireBearerToken(tokens, subs.middleware(httpServer)))
+	return mux, nil
+}
+
+func (m *sessionManager) dispatch(name string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		state := m.get(ctx)
+		if state == nil {
+			return mcp.NewToolResultError("No MCP session; initialize the session first"), nil
+		}
+		tool, ok := state.tools[name]
+		if !ok {
+			return nil, fmt.Errorf("tool %q not found", name)
+		}
+		term.Debugf("Dispatching MCP tool %q for stack %q", name, state.stack.Name)
+		// The process env is shared by all sessions, so the tools don't load the
+		// stack into it (see StackConfig.IsolatedEnv); calls of different sessions,
+		// like deploys waiting for the deployment to finish, can run concurrently.
+		return tool.Handler(ctx, request)
+	}
+}
+
+func (m *sessionManager) dispatchPrompt(name string) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		state := m.get(ctx)
+		if state == nil {
+			return nil, errors.New("no MCP session; initialize the session first")
+		}
+		prompt, ok := state.prompts[name]
+		if !ok {
+			return nil, fmt.Errorf("prompt %q not found", name)
+		}
+		return prompt.Handler(ctx, request)
+	}
+}
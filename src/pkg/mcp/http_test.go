@@ -0,0 +1,279 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testToken    = "s3cr3t"
+	testStackVar = "DEFANG_MCP_TEST_STACK_VAR"
+)
+
+// waitChannels are the channels the wait tool can block on.
+var waitChannels = map[string]chan struct{}{}
+
+// fakeCollectTools returns tools that select and report the stack of the
+// session, like the select_stack and current_stack tools.
+func fakeCollectTools(ec elicitations.Controller, config StackConfig) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("select_stack", mcp.WithString("stack", mcp.Required())),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				config.Stack.Name = request.GetString("stack", "")
+				config.Stack.Variables = map[string]string{testStackVar: config.Stack.Name}
+				if !config.IsolatedEnv {
+					os.Setenv(testStackVar, config.Stack.Name) // like stacks.LoadStackEnv
+				}
+				return mcp.NewToolResultText("selected " + config.Stack.Name), nil
+			},
+		},
+		{
+			Tool: mcp.NewTool("stack_env"),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText(os.Getenv(testStackVar)), nil
+			},
+		},
+		{
+			Tool: mcp.NewTool("wait", mcp.WithString("until", mcp.Required())),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				// like deploy, which waits for the deployment to finish
+				select {
+				case <-waitChannels[request.GetString("until", "")]:
+					return mcp.NewToolResultText("done"), nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		},
+		{
+			Tool: mcp.NewTool("current_stack"),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText(config.Stack.Name), nil
+			},
+		},
+	}
+}
+
+// offlineBackend fails to gather any context, as if the user was not logged in.
+type offlineBackend struct{}
+
+var errOffline = errors.New("offline")
+
+func (offlineBackend) GetServices(ctx context.Context, stack string) ([]cli.ServiceLineItem, error) {
+	return nil, errOffline
+}
+
+func (offlineBackend) ListDeployments(ctx context.Context, stack string) ([]*defangv1.Deployment, error) {
+	return nil, errOffline
+}
+
+func (offlineBackend) ListConfigNames(ctx context.Context, stack string) ([]string, error) {
+	return nil, errOffline
+}
+
+func (offlineBackend) GetCompose(ctx context.Context, stack string) ([]byte, error) {
+	return nil, errOffline
+}
+
+func (offlineBackend) Estimate(ctx context.Context, stack string, recipe modes.Recipe) (string, error) {
+	return "", errOffline
+}
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	handler, err := newHTTPHandler("test", MCPClientUnspecified, StackConfig{Stack: &stacks.Parameters{Name: "beta"}}, []string{testToken}, fakeCollectTools, offlineBackend{})
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server, token string) *mcpclient.Client {
+	t.Helper()
+	c, err := mcpclient.NewStreamableHttpClient(srv.URL+HTTPEndpointPath, transport.WithHTTPHeaders(map[string]string{
+		"Authorization": "Bearer " + token,
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func initialize(ctx context.Context, c *mcpclient.Client) error {
+	req := mcp.InitializeRequest{}
+	req.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	req.Params.ClientInfo = mcp.Implementation{Name: "test", Version: "1.0.0"}
+	_, err := c.Initialize(ctx, req)
+	return err
+}
+
+func callTool(t *testing.T, c *mcpclient.Client, name string, args map[string]any) string {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+	result, err := c.CallTool(t.Context(), req)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Len(t, result.Content, 1)
+	return result.Content[0].(mcp.TextContent).Text
+}
+
+func TestHTTPHandlerRequiresToken(t *testing.T) {
+	_, err := newHTTPHandler("test", MCPClientUnspecified, StackConfig{Stack: &stacks.Parameters{}}, []string{""}, fakeCollectTools, offlineBackend{})
+	require.Error(t, err)
+
+	srv := newTestHTTPServer(t)
+
+	resp, err := http.Post(srv.URL+HTTPEndpointPath, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	c := newTestClient(t, srv, "wrong")
+	require.Error(t, initialize(t.Context(), c))
+
+	c = newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), c))
+}
+
+func TestHTTPHandlerSessionState(t *testing.T) {
+	srv := newTestHTTPServer(t)
+
+	alice := newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), alice))
+	bob := newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), bob))
+
+	tools, err := alice.ListTools(t.Context(), mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, tools.Tools, 4)
+
+	// Both sessions start with the stack of the server
+	assert.Equal(t, "beta", callTool(t, alice, "current_stack", nil))
+	assert.Equal(t, "beta", callTool(t, bob, "current_stack", nil))
+
+	assert.Equal(t, "selected prod", callTool(t, alice, "select_stack", map[string]any{"stack": "prod"}))
+	assert.Equal(t, "prod", callTool(t, alice, "current_stack", nil))
+	assert.Equal(t, "beta", callTool(t, bob, "current_stack", nil), "selecting a stack must not leak into other sessions")
+
+	// The stack of a session is never loaded into the env the sessions share
+	assert.Empty(t, callTool(t, alice, "stack_env", nil))
+	assert.Empty(t, callTool(t, bob, "stack_env", nil), "the stack env must not leak into other sessions")
+	_, ok := os.LookupEnv(testStackVar)
+	assert.False(t, ok, "the stack env must not leak into the process")
+
+	// Prompts are bound to the stack of the session too
+	req := mcp.GetPromptRequest{}
+	req.Params.Name = "diagnose_failing_deployment"
+	result, err := alice.GetPrompt(t.Context(), req)
+	require.NoError(t, err)
+	assert.Contains(t, result.Messages[0].Content.(mcp.TextContent).Text, `stack "prod"`)
+	result, err = bob.GetPrompt(t.Context(), req)
+	require.NoError(t, err)
+	assert.Contains(t, result.Messages[0].Content.(mcp.TextContent).Text, `stack "beta"`)
+}
+
+func TestSessionManager(t *testing.T) {
+	now := time.Now()
+	var removed []string
+	m := &sessionManager{
+		sessions: make(map[string]*sessionState),
+		newState: func() *sessionState { return &sessionState{} },
+		onRemove: func(sessionID string) { removed = append(removed, sessionID) },
+		now:      func() time.Time { return now },
+	}
+
+	_, err := m.Validate("unknown")
+	require.Error(t, err)
+
+	id := m.Generate()
+	terminated, err := m.Validate(id)
+	require.NoError(t, err)
+	assert.False(t, terminated)
+
+	_, err = m.Terminate(id)
+	require.NoError(t, err)
+	_, err = m.Validate(id)
+	require.Error(t, err, "a terminated session must be removed")
+	assert.Empty(t, m.sessions)
+	assert.Equal(t, []string{id}, removed)
+
+	// idle sessions are removed
+	idle := m.Generate()
+	now = now.Add(sessionIdleTimeout + time.Second)
+	active := m.Generate()
+	_, err = m.Validate(idle)
+	require.Error(t, err)
+	_, err = m.Validate(active)
+	require.NoError(t, err)
+	assert.Len(t, m.sessions, 1)
+	assert.Equal(t, []string{id, idle}, removed, "the subscriptions of pruned sessions must be removed too")
+}
+
+func TestHTTPHandlerSubscribe(t *testing.T) {
+	srv := newTestHTTPServer(t)
+	c := newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), c))
+
+	req := mcp.SubscribeRequest{}
+	req.Params.URI = "defang://stack/beta/services"
+	require.NoError(t, c.Subscribe(t.Context(), req))
+
+	unsubscribe := mcp.UnsubscribeRequest{}
+	unsubscribe.Params.URI = req.Params.URI
+	require.NoError(t, c.Unsubscribe(t.Context(), unsubscribe))
+}
+
+func TestHTTPHandlerConcurrentCalls(t *testing.T) {
+	done := make(chan struct{})
+	waitChannels["deployed"] = done
+	t.Cleanup(func() { delete(waitChannels, "deployed") })
+
+	srv := newTestHTTPServer(t)
+	alice := newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), alice))
+	bob := newTestClient(t, srv, testToken)
+	require.NoError(t, initialize(t.Context(), bob))
+
+	result := make(chan string)
+	go func() {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "wait"
+		req.Params.Arguments = map[string]any{"until": "deployed"}
+		res, err := alice.CallTool(t.Context(), req)
+		if err != nil || len(res.Content) != 1 {
+			result <- ""
+			return
+		}
+		result <- res.Content[0].(mcp.TextContent).Text
+	}()
+
+	// A long-running call of one session must not block the calls of another
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "current_stack"
+	_, err := bob.CallTool(ctx, req)
+	require.NoError(t, err)
+
+	close(done)
+	assert.Equal(t, "done", <-result)
+}
@@ -3,11 +3,15 @@ package mcp
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/DefangLabs/defang/src/pkg/agent/common"
 	agentTools "github.com/DefangLabs/defang/src/pkg/agent/tools"
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/mcp/prompts"
 	"github.com/DefangLabs/defang/src/pkg/mcp/resources"
 	"github.com/DefangLabs/defang/src/pkg/mcp/tools"
 	"github.com/DefangLabs/defang/src/pkg/term"
@@ -45,42 +49,70 @@ func (t *ToolTracker) TrackTool(name string, handler server.ToolHandlerFunc) ser
 
 type StackConfig = tools.StackConfig
 
-// NewDefangMCPServer returns a new MCPServer instance with all resources, tools registered.
-func NewDefangMCPServer(version string, client MCPClient, cli agentTools.CLIInterface, config StackConfig) (*server.MCPServer, error) {
-	// Setup knowledge base
-	if err := SetupKnowledgeBase(); err != nil {
-		return nil, fmt.Errorf("failed to setup knowledge base: %w", err)
-	}
+// Server is the Defang MCP server for the stdio transport.
+type Server struct {
+	*server.MCPServer
+	subscriptions *subscriptions
+}
 
-	var elicitationsController *elicitations.Controller
+// ServeStdio serves the MCP server over stdin and stdout until interrupted.
+func (s *Server) ServeStdio() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	return serveStdio(ctx, s.MCPServer, s.subscriptions, os.Stdin, os.Stdout)
+}
 
+// newMCPServer returns a new MCPServer instance with all resources registered.
+// The stack resources are only registered if a backend is given.
+func newMCPServer(version string, hooks *server.Hooks, backend resources.StackBackend) *server.MCPServer {
 	s := server.NewMCPServer(
 		"Defang Version",
 		version,
 		server.WithResourceCapabilities(true, true),
 		server.WithToolCapabilities(true),
+		server.WithPromptCapabilities(true),
 		server.WithElicitation(),
 		server.WithInstructions(prepareInstructions()),
-		server.WithHooks(&server.Hooks{
-			OnAfterInitialize: []server.OnAfterInitializeFunc{
-				func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
-					if elicitationsController == nil {
-						return
-					}
-
-					if message.Params.Capabilities.Elicitation == nil {
-						(*elicitationsController).SetSupported(false)
-					}
-				},
-			},
-		}),
+		server.WithHooks(hooks),
 	)
 
 	resources.SetupResources(s)
+	if backend != nil {
+		resources.SetupStackResources(s, backend)
+	}
+	return s
+}
+
+// NewDefangMCPServer returns a new MCPServer instance with all resources, tools registered.
+func NewDefangMCPServer(version string, client MCPClient, cli agentTools.CLIInterface, config StackConfig) (*Server, error) {
+	// Setup knowledge base
+	if err := SetupKnowledgeBase(); err != nil {
+		return nil, fmt.Errorf("failed to setup knowledge base: %w", err)
+	}
+
+	var elicitationsController *elicitations.Controller
+	backend := resources.NewCLIStackBackend(config.FabricAddr, cli)
+
+	s := newMCPServer(version, &server.Hooks{
+		OnAfterInitialize: []server.OnAfterInitializeFunc{
+			func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+				if elicitationsController == nil {
+					return
+				}
+
+				if message.Params.Capabilities.Elicitation == nil {
+					(*elicitationsController).SetSupported(false)
+				}
+			},
+		},
+	}, backend)
+	subs := newSubscriptions(s)
 
 	// This is used to pass down information of what MCP client we are using
 	common.MCPDevelopmentClient = string(client)
 
+	config.OnDeploy = subs.onDeploy(config.Stack)
+
 	providerID := config.Stack.Provider
 	toolTracker := ToolTracker{
 		providerId: &providerID,
@@ -96,5 +128,6 @@ func NewDefangMCPServer(version string, client MCPClient, cli agentTools.CLIInte
 	}
 
 	s.AddTools(defangTools...)
-	return s, nil
+	s.AddPrompts(prompts.CollectPrompts(prompts.Context{Backend: backend, Files: os.DirFS("."), Stack: config.Stack})...)
+	return &Server{MCPServer: s, subscriptions: subs}, nil
 }
@@ -0,0 +1,45 @@
+package prompts
+
+import (
+	"context"
+
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var reduceCostPrompt = Prompt{
+	Prompt: mcp.NewPrompt("reduce_monthly_cost",
+		mcp.WithPromptDescription("Reduce my monthly cost"),
+		mcp.WithArgument("stack", mcp.ArgumentDescription("The stack to optimize; defaults to the selected stack")),
+	),
+	render: renderReduceCost,
+}
+
+func renderReduceCost(ctx context.Context, pc Context, args map[string]string) (string, error) {
+	stack, err := stackName(pc, args)
+	if err != nil {
+		return "", err
+	}
+	recipe := modes.RecipeAffordable
+	if pc.Stack != nil && pc.Stack.Name == stack && pc.Stack.Recipe != modes.RecipeUnspecified {
+		recipe = pc.Stack.Recipe
+	}
+
+	var b promptBuilder
+	b.paragraph("I want to reduce the monthly cost of the Defang stack %q, which uses the %s recipe, without breaking the application.", stack, recipe)
+	compose, err := pc.Backend.GetCompose(ctx, stack)
+	b.section("Compose file", "yaml", string(compose), err)
+	estimate, err := pc.Backend.Estimate(ctx, stack, recipe)
+	b.section("Estimate with the "+recipe.String()+" recipe", "", estimate, err)
+	if recipe != modes.RecipeAffordable {
+		estimate, err := pc.Backend.Estimate(ctx, stack, modes.RecipeAffordable)
+		b.section("Estimate with the AFFORDABLE recipe", "", estimate, err)
+	}
+	b.steps("Steps",
+		"Identify the line items that contribute most to the estimate.",
+		"Suggest changes to the compose file, like lower `deploy.resources` reservations, fewer replicas, or sharing managed databases, and whether a cheaper recipe fits this stack.",
+		"For each suggestion, state the expected savings and the trade-off in availability or performance.",
+		"Ask me which suggestions to apply; after editing the compose file, call the `estimate` tool again to confirm the savings.",
+	)
+	return b.String(), nil
+}
@@ -0,0 +1,49 @@
+package prompts
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultAWSRegion = "us-west-2"
+
+var deployToAWSPrompt = Prompt{
+	Prompt: mcp.NewPrompt("deploy_to_new_aws_stack",
+		mcp.WithPromptDescription("Deploy this project to a new AWS stack"),
+		mcp.WithArgument("stack", mcp.RequiredArgument(), mcp.ArgumentDescription("The name of the new stack, like 'prod'")),
+		mcp.WithArgument("region", mcp.ArgumentDescription("The AWS region to deploy to; defaults to "+defaultAWSRegion)),
+		mcp.WithArgument("aws_profile", mcp.ArgumentDescription("The AWS profile to use; defaults to 'default'")),
+		mcp.WithArgument("recipe", mcp.ArgumentDescription("The deployment recipe: affordable, balanced or high_availability")),
+	),
+	render: renderDeployToAWS,
+}
+
+func renderDeployToAWS(ctx context.Context, pc Context, args map[string]string) (string, error) {
+	region := args["region"]
+	if region == "" {
+		region = defaultAWSRegion
+	}
+	profile := args["aws_profile"]
+	if profile == "" {
+		profile = "default"
+	}
+	recipe := args["recipe"]
+	if recipe == "" {
+		recipe = "affordable"
+	}
+
+	var b promptBuilder
+	b.paragraph("I want to deploy this project to a new Defang stack named %q on AWS, in region %s, using the %s recipe.", args["stack"], region, recipe)
+	compose, err := readComposeFile(pc.Files)
+	b.section("Compose file", "yaml", compose, err)
+	b.steps("Steps",
+		"Review the compose file above and point out anything that will not work on AWS, like missing ports, build contexts or healthchecks; suggest fixes before deploying.",
+		"Call the `estimate` tool with provider `aws` and the recipe above, and show me the estimated monthly cost.",
+		"Call the `create_aws_stack` tool with stack `"+args["stack"]+"`, region `"+region+"`, aws_profile `"+profile+"` and recipe `"+recipe+"`.",
+		"Call the `select_stack` tool to select the new stack.",
+		"For every config variable in the compose file without a value, ask me for its value and call the `set_config` tool.",
+		"Call the `deploy` tool and report the endpoints of the deployed services.",
+	)
+	return b.String(), nil
+}
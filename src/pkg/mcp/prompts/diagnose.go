@@ -0,0 +1,109 @@
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/debug"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var diagnoseDeploymentPrompt = Prompt{
+	Prompt: mcp.NewPrompt("diagnose_failing_deployment",
+		mcp.WithPromptDescription("Diagnose my failing deployment"),
+		mcp.WithArgument("stack", mcp.ArgumentDescription("The stack of the deployment; defaults to the selected stack")),
+	),
+	render: renderDiagnoseDeployment,
+}
+
+func renderDiagnoseDeployment(ctx context.Context, pc Context, args map[string]string) (string, error) {
+	stack, err := stackName(pc, args)
+	if err != nil {
+		return "", err
+	}
+
+	var b promptBuilder
+	b.paragraph("My latest deployment to the Defang stack %q is failing. Find the root cause and propose a fix.", stack)
+	services, servicesErr := pc.Backend.GetServices(ctx, stack)
+	b.section("Services", "", formatServices(services), servicesErr)
+	deployments, deploymentsErr := pc.Backend.ListDeployments(ctx, stack)
+	b.section("Recent deployments", "", formatDeployments(deployments), deploymentsErr)
+	b.section("Debug summary", "", debugSummary(stack, services, deployments), deploymentsErr)
+	compose, err := pc.Backend.GetCompose(ctx, stack)
+	b.section("Compose file", "yaml", string(compose), err)
+	b.steps("Steps",
+		"Identify the services that are not in the DEPLOYMENT_COMPLETED state, starting with the failed services of the debug summary.",
+		"Call the `logs` tool with the deployment_id of the latest deployment to read the build and runtime logs of those services; page back with `until` if needed.",
+		"Explain the root cause, quoting the relevant log lines.",
+		"Propose a fix to the compose file or the code; ask me before making changes or calling the `deploy` tool again.",
+	)
+	return b.String(), nil
+}
+
+// debugSummary returns the summary that `defang debug` starts from: the latest
+// deployment and the services that failed in it.
+func debugSummary(stack string, services []cli.ServiceLineItem, deployments []*defangv1.Deployment) string {
+	var latest *defangv1.Deployment
+	for _, deployment := range deployments {
+		if latest == nil || deployment.Timestamp.AsTime().After(latest.Timestamp.AsTime()) {
+			latest = deployment
+		}
+	}
+	if latest == nil {
+		return "No deployments found"
+	}
+	var providerID client.ProviderID
+	providerID.SetValue(latest.Provider)
+	debugConfig := debug.DebugConfig{
+		Deployment: latest.Id,
+		ProviderID: &providerID,
+		Stack:      stack,
+		Since:      latest.Timestamp.AsTime(),
+	}
+	for _, service := range services {
+		switch service.State {
+		case defangv1.ServiceState_DEPLOYMENT_FAILED, defangv1.ServiceState_BUILD_FAILED:
+			if service.Deployment == latest.Id {
+				debugConfig.FailedServices = append(debugConfig.FailedServices, service.Service)
+			}
+		}
+	}
+	return debugConfig.Summary()
+}
+
+func formatServices(services []cli.ServiceLineItem) string {
+	if len(services) == 0 {
+		return "No services found"
+	}
+	var sb strings.Builder
+	for _, service := range services {
+		fmt.Fprintf(&sb, "%s: %s", service.Service, service.State)
+		if service.Status != "" {
+			fmt.Fprintf(&sb, " (%s)", service.Status)
+		}
+		if service.Deployment != "" {
+			fmt.Fprintf(&sb, ", deployment %s", service.Deployment)
+		}
+		if service.HealthcheckStatus != "" {
+			fmt.Fprintf(&sb, ", healthcheck %s", service.HealthcheckStatus)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func formatDeployments(deployments []*defangv1.Deployment) string {
+	if len(deployments) == 0 {
+		return "No deployments found"
+	}
+	var sb strings.Builder
+	for _, deployment := range deployments {
+		fmt.Fprintf(&sb, "%s %s %s at %s\n", deployment.Id, deployment.Action, deployment.Provider, deployment.Timestamp.AsTime().UTC().Format(time.RFC3339))
+	}
+	return sb.String()
+}
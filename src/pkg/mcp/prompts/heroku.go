@@ -0,0 +1,41 @@
+package prompts
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var migrateFromHerokuPrompt = Prompt{
+	Prompt: mcp.NewPrompt("migrate_from_heroku",
+		mcp.WithPromptDescription("Migrate from Heroku"),
+		mcp.WithArgument("app_name", mcp.RequiredArgument(), mcp.ArgumentDescription("The name of the Heroku application")),
+	),
+	render: renderMigrateFromHeroku,
+}
+
+func renderMigrateFromHeroku(ctx context.Context, pc Context, args map[string]string) (string, error) {
+	var b promptBuilder
+	b.paragraph("I want to migrate my Heroku application %q to Defang.", args["app_name"])
+	for _, file := range []struct{ name, language string }{{"Procfile", ""}, {"app.json", "json"}} {
+		content, err := fs.ReadFile(pc.Files, file.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // not every Heroku app has these
+		}
+		b.section(file.name, file.language, string(content), err)
+	}
+	if compose, err := readComposeFile(pc.Files); err == nil {
+		b.section("Existing compose file", "yaml", compose, nil)
+	}
+	b.steps("Steps",
+		"Map every process type in the Procfile to a compose service; the `web` process must listen on the port in the PORT environment variable.",
+		"Map Heroku add-ons to managed services: Heroku Postgres to a service with `x-defang-postgres`, Heroku Redis to a service with `x-defang-redis`.",
+		"Turn the release phase into a service with `restart: \"no\"` that the others depend on with `condition: service_completed_successfully`. Don't add services for the Heroku Scheduler jobs: Defang can't run scheduled jobs yet. List their commands as steps for me to run after deploying instead.",
+		"Write the compose file, or suggest running `defang init --from=heroku` to generate one from the Heroku API.",
+		"List the config vars of the application (`heroku config -a "+args["app_name"]+"`), and call the `set_config` tool for each secret after I confirm.",
+		"Call the `estimate` tool to compare the cost with my current Heroku dynos, then ask me before calling the `deploy` tool.",
+	)
+	return b.String(), nil
+}
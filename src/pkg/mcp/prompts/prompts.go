@@ -0,0 +1,135 @@
+// Package prompts is the registry of the MCP prompts for common Defang
+// workflows. Each prompt gathers context from the project and its stacks and
+// assembles a structured prompt for the client model.
+package prompts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/mcp/resources"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Backend provides the live data of the stacks that the prompts include.
+type Backend interface {
+	resources.StackBackend
+	Estimate(ctx context.Context, stack string, recipe modes.Recipe) (string, error)
+}
+
+// Context is what the prompts gather their context from.
+type Context struct {
+	Backend Backend
+	Files   fs.FS              // the working directory
+	Stack   *stacks.Parameters // the selected stack, if any
+}
+
+// Prompt is an entry of the registry.
+type Prompt struct {
+	Prompt mcp.Prompt
+	render func(ctx context.Context, pc Context, args map[string]string) (string, error)
+}
+
+// registry lists the prompts, in the order they are listed to clients.
+var registry = []Prompt{
+	deployToAWSPrompt,
+	diagnoseDeploymentPrompt,
+	migrateFromHerokuPrompt,
+	reduceCostPrompt,
+}
+
+// Render returns the messages of the prompt for the given arguments.
+func (p Prompt) Render(ctx context.Context, pc Context, args map[string]string) (*mcp.GetPromptResult, error) {
+	for _, arg := range p.Prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("missing required argument %q", arg.Name)
+		}
+	}
+	text, err := p.render(ctx, pc, args)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewGetPromptResult(p.Prompt.Description, []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+	}), nil
+}
+
+// CollectPrompts returns all the prompts in the registry, bound to the given context.
+func CollectPrompts(pc Context) []server.ServerPrompt {
+	var serverPrompts []server.ServerPrompt
+	for _, p := range registry {
+		serverPrompts = append(serverPrompts, server.ServerPrompt{
+			Prompt: p.Prompt,
+			Handler: func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+				term.Debug("MCP Prompt Requested: " + p.Prompt.Name)
+				return p.Render(ctx, pc, request.Params.Arguments)
+			},
+		})
+	}
+	return serverPrompts
+}
+
+// stackName returns the stack from the arguments, or the selected stack.
+func stackName(pc Context, args map[string]string) (string, error) {
+	if stack := args["stack"]; stack != "" {
+		return stack, nil
+	}
+	if pc.Stack != nil && pc.Stack.Name != "" {
+		return pc.Stack.Name, nil
+	}
+	return "", errors.New("no stack selected; pass the stack argument or select a stack first")
+}
+
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// readComposeFile returns the compose file in the working directory, if any.
+func readComposeFile(files fs.FS) (string, error) {
+	for _, name := range composeFileNames {
+		content, err := fs.ReadFile(files, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return string(content), err
+	}
+	return "", errors.New("no compose file found in the working directory")
+}
+
+// promptBuilder assembles the markdown of a prompt.
+type promptBuilder struct {
+	strings.Builder
+}
+
+func (b *promptBuilder) paragraph(format string, args ...any) {
+	fmt.Fprintf(b, format, args...)
+	b.WriteString("\n\n")
+}
+
+// section adds a section with context; if the context could not be gathered,
+// the error is included instead, so the model can work around it.
+func (b *promptBuilder) section(title, language, content string, err error) {
+	fmt.Fprintf(b, "## %s\n\n", title)
+	if err != nil {
+		fmt.Fprintf(b, "Could not be retrieved: %v\n\n", err)
+		return
+	}
+	fmt.Fprintf(b, "```%s\n%s\n```\n\n", language, strings.TrimRight(content, "\n"))
+}
+
+func (b *promptBuilder) steps(title string, steps ...string) {
+	fmt.Fprintf(b, "## %s\n\n", title)
+	for i, step := range steps {
+		fmt.Fprintf(b, "%d. %s\n", i+1, step)
+	}
+	b.WriteString("\n")
+}
+
+func (b *promptBuilder) String() string {
+	return strings.TrimRight(b.Builder.String(), "\n") + "\n"
+}
@@ -0,0 +1,139 @@
+package prompts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testCompose = "services:\n  app:\n    build: .\n    ports:\n      - 8080:8080\n"
+
+type fakeBackend struct {
+	err error
+}
+
+func (f fakeBackend) GetServices(ctx context.Context, stack string) ([]cli.ServiceLineItem, error) {
+	return []cli.ServiceLineItem{
+		{Service: "app", State: defangv1.ServiceState_DEPLOYMENT_FAILED, Status: "CrashLoop", Deployment: "abc123", HealthcheckStatus: "unhealthy"},
+		{Service: "worker", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED, Deployment: "abc123"},
+	}, f.err
+}
+
+func (f fakeBackend) ListDeployments(ctx context.Context, stack string) ([]*defangv1.Deployment, error) {
+	return []*defangv1.Deployment{
+		{Id: "abc123", Action: defangv1.DeploymentAction_DEPLOYMENT_ACTION_UP, Provider: defangv1.Provider_AWS, Timestamp: timestamppb.New(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))},
+	}, f.err
+}
+
+func (f fakeBackend) ListConfigNames(ctx context.Context, stack string) ([]string, error) {
+	return []string{"API_KEY"}, f.err
+}
+
+func (f fakeBackend) GetCompose(ctx context.Context, stack string) ([]byte, error) {
+	return []byte(testCompose), f.err
+}
+
+func (f fakeBackend) Estimate(ctx context.Context, stack string, recipe modes.Recipe) (string, error) {
+	return "Estimated monthly cost for " + recipe.String() + ": $42.00\n", f.err
+}
+
+func testContext(backend Backend) Context {
+	return Context{
+		Backend: backend,
+		Files: fstest.MapFS{
+			"compose.yaml": {Data: []byte(testCompose)},
+			"Procfile":     {Data: []byte("web: gunicorn app:app\nrelease: python manage.py migrate\n")},
+		},
+		Stack: &stacks.Parameters{Name: "beta", Recipe: modes.RecipeBalanced},
+	}
+}
+
+func renderText(result *mcp.GetPromptResult) string {
+	var sb strings.Builder
+	sb.WriteString("# " + result.Description + "\n")
+	for _, message := range result.Messages {
+		sb.WriteString("\n[" + string(message.Role) + "]\n")
+		sb.WriteString(message.Content.(mcp.TextContent).Text)
+	}
+	return sb.String()
+}
+
+func findPrompt(t *testing.T, name string) Prompt {
+	t.Helper()
+	for _, p := range registry {
+		if p.Prompt.Name == name {
+			return p
+		}
+	}
+	t.Fatalf("prompt %q not registered", name)
+	return Prompt{}
+}
+
+func TestPromptSnapshots(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		args    map[string]string
+		backend Backend
+	}{
+		{name: "deploy_to_new_aws_stack", prompt: "deploy_to_new_aws_stack", args: map[string]string{"stack": "prod", "region": "eu-west-1"}},
+		{name: "diagnose_failing_deployment", prompt: "diagnose_failing_deployment"},
+		{name: "diagnose_failing_deployment_unavailable", prompt: "diagnose_failing_deployment", args: map[string]string{"stack": "prod"}, backend: fakeBackend{err: errors.New("not authenticated")}},
+		{name: "migrate_from_heroku", prompt: "migrate_from_heroku", args: map[string]string{"app_name": "my-app"}},
+		{name: "reduce_monthly_cost", prompt: "reduce_monthly_cost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := tt.backend
+			if backend == nil {
+				backend = fakeBackend{}
+			}
+			result, err := findPrompt(t, tt.prompt).Render(t.Context(), testContext(backend), tt.args)
+			require.NoError(t, err)
+			if err := pkg.Compare([]byte(renderText(result)), "testdata/"+tt.name+".golden"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPromptErrors(t *testing.T) {
+	_, err := findPrompt(t, "migrate_from_heroku").Render(t.Context(), testContext(fakeBackend{}), nil)
+	require.ErrorContains(t, err, `missing required argument "app_name"`)
+
+	pc := testContext(fakeBackend{})
+	pc.Stack = nil
+	_, err = findPrompt(t, "diagnose_failing_deployment").Render(t.Context(), pc, nil)
+	require.ErrorContains(t, err, "no stack selected")
+}
+
+func TestCollectPrompts(t *testing.T) {
+	serverPrompts := CollectPrompts(testContext(fakeBackend{}))
+	require.Len(t, serverPrompts, len(registry))
+
+	var names []string
+	for _, sp := range serverPrompts {
+		names = append(names, sp.Prompt.Name)
+	}
+	assert.Equal(t, []string{"deploy_to_new_aws_stack", "diagnose_failing_deployment", "migrate_from_heroku", "reduce_monthly_cost"}, names)
+
+	req := mcp.GetPromptRequest{}
+	req.Params.Arguments = map[string]string{"stack": "prod"}
+	result, err := serverPrompts[0].Handler(t.Context(), req)
+	require.NoError(t, err)
+	assert.Len(t, result.Messages, 1)
+	assert.Equal(t, mcp.RoleUser, result.Messages[0].Role)
+}
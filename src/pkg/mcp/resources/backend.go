@@ -0,0 +1,178 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/DefangLabs/defang/src/pkg/agent/common"
+	agentTools "github.com/DefangLabs/defang/src/pkg/agent/tools"
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+)
+
+const maxStackDeployments = 10
+
+// CLIStackBackend reads the stacks of the project in the working directory,
+// the same way the tools do. It keeps one connected provider per stack.
+type CLIStackBackend struct {
+	FabricAddr string
+	CLI        agentTools.CLIInterface
+
+	mu       sync.Mutex
+	sessions map[string]*stackSession
+}
+
+var _ StackBackend = (*CLIStackBackend)(nil)
+
+func NewCLIStackBackend(fabricAddr string, cli agentTools.CLIInterface) *CLIStackBackend {
+	return &CLIStackBackend{FabricAddr: fabricAddr, CLI: cli, sessions: make(map[string]*stackSession)}
+}
+
+type stackSession struct {
+	fabric      *client.GrpcClient
+	provider    client.Provider
+	loader      client.Loader
+	projectName string
+	stack       *stacks.Parameters
+}
+
+// withStack calls fn with the session of the given stack, connecting on first
+// use. Providers read their settings from the process env, so fn runs with the
+// env of the stack, which is restored afterwards.
+func (b *CLIStackBackend) withStack(ctx context.Context, stackName string, fn func(*stackSession) error) error {
+	ss, err := b.session(ctx, stackName)
+	if err != nil {
+		return err
+	}
+	return stacks.WithStackEnv(ss.stack, func() error {
+		return fn(ss)
+	})
+}
+
+func (b *CLIStackBackend) session(ctx context.Context, stackName string) (*stackSession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ss, ok := b.sessions[stackName]; ok {
+		return ss, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	stack, err := stacks.ReadInDirectory(wd, stackName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stack %q: %w", stackName, err)
+	}
+	var ss *stackSession
+	err = stacks.WithStackEnv(stack, func() error {
+		var err error
+		ss, err = b.connect(ctx, stack)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.sessions == nil {
+		b.sessions = make(map[string]*stackSession)
+	}
+	b.sessions[stackName] = ss
+	return ss, nil
+}
+
+func (b *CLIStackBackend) connect(ctx context.Context, stack *stacks.Parameters) (*stackSession, error) {
+	loader, err := common.ConfigureAgentLoader(common.LoaderParams{}, stack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure loader: %w", err)
+	}
+	fabric, err := b.CLI.Connect(ctx, b.FabricAddr)
+	if err != nil {
+		return nil, err
+	}
+	provider := b.CLI.NewProvider(ctx, stack.Provider, fabric, stack.Name)
+	if err := provider.Authenticate(ctx, false); err != nil {
+		return nil, fmt.Errorf("failed to authenticate with provider %q: %w", stack.Provider, err)
+	}
+	projectName, err := b.CLI.LoadProjectNameWithFallback(ctx, loader, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project name: %w", err)
+	}
+	return &stackSession{fabric: fabric, provider: provider, loader: loader, projectName: projectName, stack: stack}, nil
+}
+
+func (b *CLIStackBackend) GetServices(ctx context.Context, stack string) ([]cli.ServiceLineItem, error) {
+	var services []cli.ServiceLineItem
+	err := b.withStack(ctx, stack, func(ss *stackSession) error {
+		var err error
+		services, err = b.CLI.GetServices(ctx, ss.projectName, ss.provider)
+		return err
+	})
+	return services, err
+}
+
+func (b *CLIStackBackend) ListDeployments(ctx context.Context, stack string) ([]*defangv1.Deployment, error) {
+	var deployments []*defangv1.Deployment
+	err := b.withStack(ctx, stack, func(ss *stackSession) error {
+		resp, err := ss.fabric.ListDeployments(ctx, &defangv1.ListDeploymentsRequest{
+			Project: ss.projectName,
+			Stack:   stack,
+			Type:    defangv1.DeploymentType_DEPLOYMENT_TYPE_HISTORY,
+			Limit:   maxStackDeployments,
+		})
+		if err != nil {
+			return err
+		}
+		deployments = resp.Deployments
+		return nil
+	})
+	return deployments, err
+}
+
+func (b *CLIStackBackend) ListConfigNames(ctx context.Context, stack string) ([]string, error) {
+	var names []string
+	err := b.withStack(ctx, stack, func(ss *stackSession) error {
+		secrets, err := b.CLI.ListConfig(ctx, ss.provider, ss.projectName)
+		if err != nil {
+			return err
+		}
+		names = secrets.Names
+		return nil
+	})
+	return names, err
+}
+
+func (b *CLIStackBackend) GetCompose(ctx context.Context, stack string) ([]byte, error) {
+	var yaml []byte
+	err := b.withStack(ctx, stack, func(ss *stackSession) error {
+		project, err := b.CLI.LoadProject(ctx, ss.loader)
+		if err != nil {
+			return err
+		}
+		yaml, err = project.MarshalYAML()
+		return err
+	})
+	return yaml, err
+}
+
+// Estimate returns the printed cost estimate of the project in the given stack
+// for the given recipe.
+func (b *CLIStackBackend) Estimate(ctx context.Context, stack string, recipe modes.Recipe) (string, error) {
+	var printed string
+	err := b.withStack(ctx, stack, func(ss *stackSession) error {
+		project, err := b.CLI.LoadProject(ctx, ss.loader)
+		if err != nil {
+			return err
+		}
+		estimate, err := b.CLI.RunEstimate(ctx, project, ss.fabric, b.CLI.CreatePlaygroundProvider(ss.fabric), ss.stack.Provider, ss.stack.Region, recipe)
+		if err != nil {
+			return fmt.Errorf("failed to run estimate: %w", err)
+		}
+		printed = b.CLI.PrintEstimate(recipe, estimate)
+		return nil
+	})
+	return printed, err
+}
@@ -0,0 +1,122 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const stackURIPrefix = "defang://stack/"
+
+// StackResource is the kind of live data of a stack that is exposed as a resource.
+type StackResource string
+
+const (
+	StackServices    StackResource = "services"
+	StackDeployments StackResource = "deployments"
+	StackConfig      StackResource = "config"
+	StackCompose     StackResource = "compose"
+)
+
+// StackResourceURI returns the URI of the resource of the given stack, like
+// "defang://stack/beta/services".
+func StackResourceURI(stack string, resource StackResource) string {
+	return stackURIPrefix + stack + "/" + string(resource)
+}
+
+// ParseStackResourceURI is the inverse of StackResourceURI.
+func ParseStackResourceURI(uri string) (string, StackResource, error) {
+	rest, ok := strings.CutPrefix(uri, stackURIPrefix)
+	if !ok {
+		return "", "", fmt.Errorf("invalid stack resource URI %q", uri)
+	}
+	stack, resource, ok := strings.Cut(rest, "/")
+	if !ok || stack == "" {
+		return "", "", fmt.Errorf("invalid stack resource URI %q", uri)
+	}
+	return stack, StackResource(resource), nil
+}
+
+// StackBackend provides the live data of the stacks of the project in the
+// working directory.
+type StackBackend interface {
+	GetServices(ctx context.Context, stack string) ([]cli.ServiceLineItem, error)
+	ListDeployments(ctx context.Context, stack string) ([]*defangv1.Deployment, error)
+	ListConfigNames(ctx context.Context, stack string) ([]string, error)
+	GetCompose(ctx context.Context, stack string) ([]byte, error)
+}
+
+var stackResources = []struct {
+	resource    StackResource
+	description string
+	mimeType    string
+}{
+	{StackServices, "The deployed services of the stack, with their state and endpoints.", "application/json"},
+	{StackDeployments, "The recent deployments of the stack.", "application/json"},
+	{StackConfig, "The names of the config variables of the stack; values are never exposed.", "application/json"},
+	{StackCompose, "The compose file of the project, as loaded for the stack.", "application/yaml"},
+}
+
+// SetupStackResources adds the defang://stack/{stack}/... resource templates
+// to the MCP server.
+func SetupStackResources(s *server.MCPServer, backend StackBackend) {
+	for _, sr := range stackResources {
+		template := mcp.NewResourceTemplate(
+			StackResourceURI("{stack}", sr.resource),
+			"stack_"+string(sr.resource),
+			mcp.WithTemplateDescription(sr.description),
+			mcp.WithTemplateMIMEType(sr.mimeType),
+		)
+		s.AddResourceTemplate(template, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			text, err := readStackResource(ctx, backend, request.Params.URI)
+			if err != nil {
+				term.Error("Failed to read stack resource", "error", err, "uri", request.Params.URI)
+				return nil, err
+			}
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: sr.mimeType,
+					Text:     text,
+				},
+			}, nil
+		})
+	}
+}
+
+func readStackResource(ctx context.Context, backend StackBackend, uri string) (string, error) {
+	stack, resource, err := ParseStackResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	var data any
+	switch resource {
+	case StackServices:
+		data, err = backend.GetServices(ctx, stack)
+	case StackDeployments:
+		data, err = backend.ListDeployments(ctx, stack)
+	case StackConfig:
+		data, err = backend.ListConfigNames(ctx, stack)
+	case StackCompose:
+		compose, err := backend.GetCompose(ctx, stack)
+		return string(compose), err
+	default:
+		return "", fmt.Errorf("unsupported stack resource %q", resource)
+	}
+	if err != nil {
+		return "", err
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
@@ -0,0 +1,81 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStackBackend struct{}
+
+func (fakeStackBackend) GetServices(ctx context.Context, stack string) ([]cli.ServiceLineItem, error) {
+	return []cli.ServiceLineItem{{Service: "app", Deployment: "abc123"}}, nil
+}
+
+func (fakeStackBackend) ListDeployments(ctx context.Context, stack string) ([]*defangv1.Deployment, error) {
+	return []*defangv1.Deployment{{Id: "abc123", Stack: stack}}, nil
+}
+
+func (fakeStackBackend) ListConfigNames(ctx context.Context, stack string) ([]string, error) {
+	return []string{"API_KEY"}, nil
+}
+
+func (fakeStackBackend) GetCompose(ctx context.Context, stack string) ([]byte, error) {
+	return []byte("services:\n  app:\n    image: nginx\n"), nil
+}
+
+func TestParseStackResourceURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		stack    string
+		resource StackResource
+		wantErr  bool
+	}{
+		{uri: "defang://stack/beta/services", stack: "beta", resource: StackServices},
+		{uri: StackResourceURI("prod", StackCompose), stack: "prod", resource: StackCompose},
+		{uri: "defang://stack/beta", wantErr: true},
+		{uri: "defang://stack//services", wantErr: true},
+		{uri: "file:///beta/services", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			stack, resource, err := ParseStackResourceURI(tt.uri)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.stack, stack)
+			assert.Equal(t, tt.resource, resource)
+		})
+	}
+}
+
+func TestReadStackResource(t *testing.T) {
+	tests := []struct {
+		resource StackResource
+		want     string
+	}{
+		{StackDeployments, `[{"id":"abc123","stack":"beta"}]`},
+		{StackConfig, `["API_KEY"]`},
+		{StackCompose, "services:\n  app:\n    image: nginx\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.resource), func(t *testing.T) {
+			text, err := readStackResource(t.Context(), fakeStackBackend{}, StackResourceURI("beta", tt.resource))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, text)
+		})
+	}
+
+	text, err := readStackResource(t.Context(), fakeStackBackend{}, StackResourceURI("beta", StackServices))
+	require.NoError(t, err)
+	assert.Contains(t, text, `"Service":"app"`)
+
+	_, err = readStackResource(t.Context(), fakeStackBackend{}, StackResourceURI("beta", "secrets"))
+	require.Error(t, err)
+}
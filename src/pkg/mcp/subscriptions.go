@@ -0,0 +1,222 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/mcp/resources"
+	"github.com/DefangLabs/defang/src/pkg/stacks"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/DefangLabs/defang/src/pkg/types"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+
+	// deploymentWatchTimeout bounds how long a deployment drives notifications.
+	deploymentWatchTimeout = time.Hour
+)
+
+// subscriptions keeps track of the resources that each session subscribed to.
+// mcp-go does not implement resources/subscribe, so the transports pass those
+// requests to handleRequest instead of the MCP server.
+type subscriptions struct {
+	server *server.MCPServer
+
+	mu   sync.Mutex
+	uris map[string]map[string]struct{} // resource URI → session IDs
+}
+
+func newSubscriptions(s *server.MCPServer) *subscriptions {
+	return &subscriptions{server: s, uris: make(map[string]map[string]struct{})}
+}
+
+// handleRequest answers resources/subscribe and resources/unsubscribe
+// requests. It returns nil for any other message.
+func (s *subscriptions) handleRequest(sessionID string, message []byte) mcp.JSONRPCMessage {
+	var req struct {
+		ID     mcp.RequestId       `json:"id"`
+		Method string              `json:"method"`
+		Params mcp.SubscribeParams `json:"params"`
+	}
+	if err := json.Unmarshal(message, &req); err != nil {
+		return nil // let the MCP server report the error
+	}
+	if req.Method != methodResourcesSubscribe && req.Method != methodResourcesUnsubscribe {
+		return nil
+	}
+	if req.Params.URI == "" {
+		return mcp.NewJSONRPCError(req.ID, mcp.INVALID_PARAMS, "missing resource URI", nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Method == methodResourcesSubscribe {
+		if s.uris[req.Params.URI] == nil {
+			s.uris[req.Params.URI] = make(map[string]struct{})
+		}
+		s.uris[req.Params.URI][sessionID] = struct{}{}
+		term.Debugf("Session %q subscribed to %s", sessionID, req.Params.URI)
+	} else {
+		delete(s.uris[req.Params.URI], sessionID)
+	}
+	return mcp.NewJSONRPCResponse(req.ID, mcp.Result{})
+}
+
+func (s *subscriptions) removeSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sessions := range s.uris {
+		delete(sessions, sessionID)
+	}
+}
+
+func (s *subscriptions) subscribers(uri string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessionIDs []string
+	for sessionID := range s.uris[uri] {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs
+}
+
+// notify sends a resources/updated notification to the subscribers of the resource.
+func (s *subscriptions) notify(uri string) {
+	for _, sessionID := range s.subscribers(uri) {
+		if err := s.server.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri}); err != nil {
+			term.Debugf("Failed to notify session %q of update to %s: %v", sessionID, uri, err)
+		}
+	}
+}
+
+// watchDeployment notifies the subscribers of the stack resources while the
+// services of the deployment change state.
+func (s *subscriptions) watchDeployment(ctx context.Context, provider client.Provider, stack, projectName string, etag types.ETag) {
+	deploymentsURI := resources.StackResourceURI(stack, resources.StackDeployments)
+	servicesURI := resources.StackResourceURI(stack, resources.StackServices)
+	s.notify(deploymentsURI)
+	if len(s.subscribers(servicesURI)) == 0 && len(s.subscribers(deploymentsURI)) == 0 {
+		return
+	}
+
+	// The deployment outlives the tool call that started it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deploymentWatchTimeout)
+	go func() {
+		defer cancel()
+		defer s.notify(deploymentsURI)
+
+		updates, err := provider.Subscribe(ctx, &defangv1.SubscribeRequest{Project: projectName, Etag: etag})
+		if err != nil {
+			term.Debugf("Failed to subscribe to deployment %s: %v", etag, err)
+			return
+		}
+		states := make(map[string]defangv1.ServiceState)
+		for msg, err := range updates {
+			if err != nil {
+				term.Debugf("Subscription to deployment %s ended: %v", etag, err)
+				return
+			}
+			if msg == nil || states[msg.Name] == msg.State {
+				continue
+			}
+			states[msg.Name] = msg.State
+			s.notify(servicesURI)
+			if allServicesDone(states) {
+				return
+			}
+		}
+	}()
+}
+
+// onDeploy returns a StackConfig.OnDeploy hook that watches the deployments
+// of the selected stack.
+func (s *subscriptions) onDeploy(stack *stacks.Parameters) func(context.Context, client.Provider, string, types.ETag) {
+	return func(ctx context.Context, provider client.Provider, projectName string, etag types.ETag) {
+		s.watchDeployment(ctx, provider, stack.Name, projectName, etag)
+	}
+}
+
+func allServicesDone(states map[string]defangv1.ServiceState) bool {
+	for _, state := range states {
+		switch state {
+		case defangv1.ServiceState_DEPLOYMENT_COMPLETED, defangv1.ServiceState_DEPLOYMENT_FAILED, defangv1.ServiceState_BUILD_FAILED:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// middleware answers the subscription requests of the streamable HTTP transport.
+func (s *subscriptions) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The subscriptions of a session are removed by the session manager, once
+		// the session is terminated or has been idle for too long.
+		if r.Method == http.MethodPost {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if resp := s.handleRequest(r.Header.Get(server.HeaderKeySessionID), body); resp != nil {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// syncWriter serializes the writes of the stdio server and the subscription
+// responses, each of which is a single Write of a whole line.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
+// serveStdio serves the MCP server over stdio, answering the subscription
+// requests before they reach the MCP server.
+func serveStdio(ctx context.Context, s *server.MCPServer, subs *subscriptions, stdin io.Reader, stdout io.Writer) error {
+	const stdioSessionID = "stdio" // the ID of mcp-go's only stdio session
+	out := &syncWriter{w: stdout}
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if resp := subs.handleRequest(stdioSessionID, line); resp != nil {
+					bytes, _ := json.Marshal(resp)
+					out.Write(append(bytes, '\n'))
+				} else if _, err := pw.Write(line); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return server.NewStdioServer(s).Listen(ctx, pr, out)
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/mcp/resources"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSubscribeProvider struct {
+	client.Provider
+	updates []*defangv1.SubscribeResponse
+}
+
+func (m mockSubscribeProvider) Subscribe(ctx context.Context, req *defangv1.SubscribeRequest) (iter.Seq2[*defangv1.SubscribeResponse, error], error) {
+	return func(yield func(*defangv1.SubscribeResponse, error) bool) {
+		for _, update := range m.updates {
+			if !yield(update, nil) {
+				return
+			}
+		}
+	}, nil
+}
+
+func TestSubscriptionsHandleRequest(t *testing.T) {
+	subs := newSubscriptions(newMCPServer("test", &server.Hooks{}, nil))
+	uri := resources.StackResourceURI("beta", resources.StackServices)
+
+	assert.Nil(t, subs.handleRequest("s1", []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	assert.Nil(t, subs.handleRequest("s1", []byte(`not json`)))
+
+	resp := subs.handleRequest("s1", []byte(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{}}`))
+	require.IsType(t, mcp.JSONRPCError{}, resp)
+	assert.Equal(t, mcp.INVALID_PARAMS, resp.(mcp.JSONRPCError).Error.Code)
+
+	resp = subs.handleRequest("s1", []byte(`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"`+uri+`"}}`))
+	require.IsType(t, mcp.JSONRPCResponse{}, resp)
+	subs.handleRequest("s2", []byte(`{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"`+uri+`"}}`))
+	assert.ElementsMatch(t, []string{"s1", "s2"}, subs.subscribers(uri))
+
+	subs.handleRequest("s1", []byte(`{"jsonrpc":"2.0","id":4,"method":"resources/unsubscribe","params":{"uri":"`+uri+`"}}`))
+	assert.Equal(t, []string{"s2"}, subs.subscribers(uri))
+
+	subs.removeSession("s2")
+	assert.Empty(t, subs.subscribers(uri))
+}
+
+func TestAllServicesDone(t *testing.T) {
+	assert.True(t, allServicesDone(nil))
+	assert.False(t, allServicesDone(map[string]defangv1.ServiceState{
+		"app": defangv1.ServiceState_DEPLOYMENT_COMPLETED,
+		"db":  defangv1.ServiceState_DEPLOYMENT_PENDING,
+	}))
+	assert.True(t, allServicesDone(map[string]defangv1.ServiceState{
+		"app": defangv1.ServiceState_DEPLOYMENT_COMPLETED,
+		"db":  defangv1.ServiceState_BUILD_FAILED,
+	}))
+}
+
+func TestServeStdioNotifiesSubscribers(t *testing.T) {
+	s := newMCPServer("test", &server.Hooks{}, nil)
+	subs := newSubscriptions(s)
+
+	stdin, clientOut := io.Pipe()
+	clientIn, stdout := io.Pipe()
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+	go serveStdio(ctx, s, subs, stdin, stdout)
+
+	lines := bufio.NewScanner(clientIn)
+	send := func(message string) {
+		t.Helper()
+		_, err := io.WriteString(clientOut, message+"\n")
+		require.NoError(t, err)
+	}
+	receive := func() map[string]any {
+		t.Helper()
+		require.True(t, lines.Scan())
+		var message map[string]any
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &message))
+		return message
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + mcp.LATEST_PROTOCOL_VERSION + `","clientInfo":{"name":"test","version":"1.0.0"},"capabilities":{}}}`)
+	initResult := receive()
+	assert.Equal(t, true, initResult["result"].(map[string]any)["capabilities"].(map[string]any)["resources"].(map[string]any)["subscribe"])
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	servicesURI := resources.StackResourceURI("beta", resources.StackServices)
+	send(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"` + servicesURI + `"}}`)
+	assert.Equal(t, map[string]any{"jsonrpc": "2.0", "id": float64(2), "result": map[string]any{}}, receive())
+
+	provider := mockSubscribeProvider{updates: []*defangv1.SubscribeResponse{
+		{Name: "app", State: defangv1.ServiceState_BUILD_ACTIVATING},
+		{Name: "app", State: defangv1.ServiceState_BUILD_ACTIVATING}, // unchanged
+		{Name: "app", State: defangv1.ServiceState_DEPLOYMENT_COMPLETED},
+	}}
+	// Messages are processed in order, so the session is initialized once the ping is answered
+	send(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)
+	assert.Equal(t, float64(3), receive()["id"])
+	subs.watchDeployment(ctx, provider, "beta", "project", "etag")
+
+	for range 2 {
+		notification := receive()
+		assert.Equal(t, mcp.MethodNotificationResourceUpdated, notification["method"])
+		assert.Equal(t, map[string]any{"uri": servicesURI}, notification["params"])
+	}
+}
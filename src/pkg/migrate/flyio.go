@@ -0,0 +1,298 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	ourHttp "github.com/DefangLabs/defang/src/pkg/http"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// FlyioClient collects application info from the Fly.io Machines API, and
+// from the fly.toml file in the working directory if it is for the same app.
+type FlyioClient struct {
+	Token      string
+	HTTPClient *http.Client
+	BaseURL    string
+	Org        string
+	Dir        string
+}
+
+func NewFlyioClient() *FlyioClient {
+	return &FlyioClient{
+		HTTPClient: ourHttp.DefaultClient,
+		BaseURL:    "https://api.machines.dev/v1",
+		Org:        pkg.Getenv("FLY_ORG", "personal"),
+		Dir:        ".",
+	}
+}
+
+type FlyioApp struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MachineCount int    `json:"machine_count"`
+}
+
+type FlyioMachine struct {
+	ID     string             `json:"id"`
+	Name   string             `json:"name"`
+	State  string             `json:"state"`
+	Region string             `json:"region"`
+	Config FlyioMachineConfig `json:"config"`
+}
+
+type FlyioMachineConfig struct {
+	Image string            `json:"image"`
+	Env   map[string]string `json:"env"`
+	Init  struct {
+		Cmd        []string `json:"cmd"`
+		Entrypoint []string `json:"entrypoint"`
+	} `json:"init"`
+	Guest struct {
+		CPUKind  string `json:"cpu_kind"`
+		CPUs     int    `json:"cpus"`
+		MemoryMB int    `json:"memory_mb"`
+	} `json:"guest"`
+	Services []struct {
+		Protocol     string `json:"protocol"`
+		InternalPort int    `json:"internal_port"`
+		Ports        []struct {
+			Port     int      `json:"port"`
+			Handlers []string `json:"handlers"`
+		} `json:"ports"`
+	} `json:"services"`
+	Checks   map[string]FlyioCheck `json:"checks"`
+	Metadata map[string]string     `json:"metadata"`
+}
+
+type FlyioCheck struct {
+	Type     string `json:"type" toml:"type"`
+	Port     int    `json:"port" toml:"port"`
+	Path     string `json:"path" toml:"path"`
+	Interval string `json:"interval" toml:"interval"`
+	Timeout  string `json:"timeout" toml:"timeout"`
+}
+
+type FlyioSecret struct {
+	Name  string `json:"name"`
+	Label string `json:"label"` // older versions of the API
+}
+
+// flyToml is the subset of fly.toml that matters for the migration.
+type flyToml struct {
+	App   string `toml:"app"`
+	Build struct {
+		Image      string `toml:"image"`
+		Dockerfile string `toml:"dockerfile"`
+	} `toml:"build"`
+	Processes   map[string]string `toml:"processes"`
+	HTTPService *struct {
+		InternalPort int          `toml:"internal_port"`
+		Processes    []string     `toml:"processes"`
+		Checks       []FlyioCheck `toml:"checks"`
+	} `toml:"http_service"`
+	Services []struct {
+		InternalPort int          `toml:"internal_port"`
+		Processes    []string     `toml:"processes"`
+		HTTPChecks   []FlyioCheck `toml:"http_checks"`
+	} `toml:"services"`
+}
+
+func (f *FlyioClient) Authenticate(ctx context.Context, surveyor surveyor.Surveyor) error {
+	token, err := getAuthToken(surveyor, SourcePlatformFlyio, "Run `fly tokens create readonly` or visit https://fly.io/user/personal_access_tokens", "FLY_API_TOKEN", "FLY_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+	f.Token = token
+	return nil
+}
+
+func (f *FlyioClient) ListApps(ctx context.Context) ([]string, error) {
+	resp, err := apiRequest[struct {
+		Apps []FlyioApp `json:"apps"`
+	}](ctx, f.HTTPClient, http.MethodGet, f.BaseURL+"/apps?org_slug="+url.QueryEscape(f.Org), f.Token, nil)
+	if err != nil {
+		return nil, err
+	}
+	appNames := make([]string, len(resp.Apps))
+	for i, app := range resp.Apps {
+		appNames[i] = app.Name
+	}
+	return appNames, nil
+}
+
+func (f *FlyioClient) ListMachines(ctx context.Context, appName string) ([]FlyioMachine, error) {
+	return apiRequest[[]FlyioMachine](ctx, f.HTTPClient, http.MethodGet, f.BaseURL+"/apps/"+url.PathEscape(appName)+"/machines", f.Token, nil)
+}
+
+func (f *FlyioClient) ListSecrets(ctx context.Context, appName string) ([]string, error) {
+	secrets, err := apiRequest[[]FlyioSecret](ctx, f.HTTPClient, http.MethodGet, f.BaseURL+"/apps/"+url.PathEscape(appName)+"/secrets", f.Token, nil)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.Name != "" {
+			names = append(names, secret.Name)
+		} else if secret.Label != "" {
+			names = append(names, secret.Label)
+		}
+	}
+	return names, nil
+}
+
+// readFlyToml reads the fly.toml in the directory, if there is one.
+func readFlyToml(dir string) (*flyToml, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "fly.toml"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var config flyToml
+	if err := toml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse fly.toml: %w", err)
+	}
+	return &config, nil
+}
+
+func (f *FlyioClient) CollectAppInfo(ctx context.Context, appName string) (any, error) {
+	term.Info("Identifying deployed machines")
+	machines, err := f.ListMachines(ctx, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+	secrets, err := f.ListSecrets(ctx, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	config, err := readFlyToml(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && config.App != appName {
+		term.Debugf("Ignoring fly.toml for app %q", config.App)
+		config = nil
+	}
+	return flyioAppInfo(appName, machines, secrets, config), nil
+}
+
+func (f *FlyioClient) Sanitize(info any) (any, error) {
+	return sanitizeAppInfo(info)
+}
+
+// flyioAppInfo maps each process group of the machines to a service.
+func flyioAppInfo(appName string, machines []FlyioMachine, secrets []string, flyToml *flyToml) AppInfo {
+	info := AppInfo{Name: appName, ConfigVars: make(map[string]string)}
+
+	groups := make(map[string][]FlyioMachine)
+	for _, machine := range machines {
+		group := machine.Config.Metadata["fly_process_group"]
+		if group == "" {
+			group = "app"
+		}
+		groups[group] = append(groups[group], machine)
+	}
+
+	for _, group := range slices.Sorted(maps.Keys(groups)) {
+		machine := groups[group][0]
+		config := machine.Config
+		service := ServiceInfo{
+			Name:     group,
+			Image:    config.Image,
+			Replicas: len(groups[group]),
+			CPUs:     float64(config.Guest.CPUs),
+			MemoryMB: config.Guest.MemoryMB,
+		}
+		if len(config.Init.Cmd) > 0 {
+			service.Command = pkg.ShellQuote(config.Init.Cmd...)
+		}
+		if len(config.Services) > 0 {
+			svc := config.Services[0]
+			service.Port = svc.InternalPort
+			for _, port := range svc.Ports {
+				if slices.Contains(port.Handlers, "http") || slices.Contains(port.Handlers, "tls") {
+					service.Public = true
+				}
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(config.Checks)) {
+			if check := config.Checks[name]; check.Type == "http" {
+				service.HealthCheck = flyioHealthCheck(check)
+				break
+			}
+		}
+
+		if flyToml != nil {
+			// Build from source instead of pulling from the Fly.io registry
+			service.Image = flyToml.Build.Image
+			service.Dockerfile = flyToml.Build.Dockerfile
+			if command, ok := flyToml.Processes[group]; ok {
+				service.Command = command
+			}
+			if service.HealthCheck == nil {
+				service.HealthCheck = flyTomlHealthCheck(flyToml, group)
+			}
+		} else if strings.HasPrefix(service.Image, "registry.fly.io/") {
+			term.Warnf("The image of %q is in the Fly.io registry; run the migration from the directory with fly.toml to build from source instead", group)
+		}
+
+		for key, value := range config.Env {
+			if isFlyioRuntimeEnv(key) {
+				continue
+			}
+			service.Env = append(service.Env, key)
+			info.ConfigVars[key] = value
+		}
+		service.Env = append(service.Env, secrets...)
+		info.Services = append(info.Services, service)
+	}
+
+	for _, name := range secrets {
+		// The values of Fly.io secrets cannot be read back
+		info.ConfigVars[name] = redacted
+	}
+	info.Postgres, info.Redis = managedServicesFromEnv(secrets)
+	return info
+}
+
+func flyioHealthCheck(check FlyioCheck) *HealthCheck {
+	return &HealthCheck{
+		Path:     check.Path,
+		Port:     check.Port,
+		Interval: parseDuration(check.Interval),
+		Timeout:  parseDuration(check.Timeout),
+	}
+}
+
+func flyTomlHealthCheck(config *flyToml, group string) *HealthCheck {
+	forGroup := func(processes []string) bool {
+		return len(processes) == 0 || slices.Contains(processes, group)
+	}
+	if hs := config.HTTPService; hs != nil && forGroup(hs.Processes) && len(hs.Checks) > 0 {
+		return flyioHealthCheck(hs.Checks[0])
+	}
+	for _, svc := range config.Services {
+		if forGroup(svc.Processes) && len(svc.HTTPChecks) > 0 {
+			return flyioHealthCheck(svc.HTTPChecks[0])
+		}
+	}
+	return nil
+}
+
+// isFlyioRuntimeEnv reports whether the variable is set by Fly.io itself.
+func isFlyioRuntimeEnv(key string) bool {
+	return strings.HasPrefix(key, "FLY_") || key == "PRIMARY_REGION"
+}
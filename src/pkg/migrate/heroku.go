@@ -87,15 +87,18 @@ func collectHerokuApplicationInfo(ctx context.Context, client HerokuClientInterf
 	return applicationInfo, nil
 }
 
-func selectSourceApplication(surveyor surveyor.Surveyor, appNames []string) (string, error) {
+func selectSourceApplication(surveyor surveyor.Surveyor, platform SourcePlatform, appNames []string) (string, error) {
+	if len(appNames) == 0 {
+		return "", fmt.Errorf("no %s applications found", platform.Name())
+	}
 	var selectedApp string
 	for {
 		err := surveyor.AskOne(&survey.Select{
-			Message: "Select the Heroku application you would like to migrate:",
-			Options: appNames, // This should be a list of app names, but for simplicity, we use the whole string
+			Message: fmt.Sprintf("Select the %s application you would like to migrate:", platform.Name()),
+			Options: appNames,
 		}, &selectedApp)
 		if err != nil {
-			return "", fmt.Errorf("failed to select Heroku application: %w", err)
+			return "", fmt.Errorf("failed to select %s application: %w", platform.Name(), err)
 		}
 
 		if selectedApp != "" {
@@ -107,6 +110,73 @@ func selectSourceApplication(surveyor surveyor.Surveyor, appNames []string) (str
 	return selectedApp, nil
 }
 
+// HerokuSource is the SourceClient for Heroku; the compose file is generated
+// by the Defang Fabric from the collected information.
+type HerokuSource struct {
+	Client HerokuClientInterface
+
+	// App and Info are set by CollectAppInfo, for the post-generation steps
+	App  string
+	Info HerokuApplicationInfo
+}
+
+func NewHerokuSource(client HerokuClientInterface) *HerokuSource {
+	return &HerokuSource{Client: client}
+}
+
+func (h *HerokuSource) Authenticate(ctx context.Context, surveyor surveyor.Surveyor) error {
+	token, err := getHerokuAuthToken()
+	if err != nil {
+		return err
+	}
+	h.Client.SetToken(token)
+	return nil
+}
+
+func (h *HerokuSource) ListApps(ctx context.Context) ([]string, error) {
+	apps, err := h.Client.ListApps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appNames := make([]string, len(apps))
+	for i, app := range apps {
+		appNames[i] = app.Name
+	}
+	return appNames, nil
+}
+
+func (h *HerokuSource) CollectAppInfo(ctx context.Context, appName string) (any, error) {
+	info, err := collectHerokuApplicationInfo(ctx, h.Client, appName)
+	if err != nil {
+		return nil, err
+	}
+	h.App, h.Info = appName, info
+	return info, nil
+}
+
+// PostGenerate returns the steps to run after the compose file is generated,
+// or nil if no application was collected.
+func (h *HerokuSource) PostGenerate(surveyor surveyor.Surveyor, skip []HerokuStep) *HerokuPostGenerate {
+	if h.App == "" {
+		return nil
+	}
+	return &HerokuPostGenerate{
+		Client:   h.Client,
+		Surveyor: surveyor,
+		AppName:  h.App,
+		Info:     h.Info,
+		Skip:     skip,
+	}
+}
+
+func (h *HerokuSource) Sanitize(info any) (any, error) {
+	herokuInfo, ok := info.(HerokuApplicationInfo)
+	if !ok {
+		return nil, fmt.Errorf("unexpected application info type %T", info)
+	}
+	return sanitizeHerokuApplicationInfo(herokuInfo)
+}
+
 // HerokuClientInterface defines the interface for Heroku client operations
 type HerokuClientInterface interface {
 	SetToken(token string)
@@ -117,6 +187,7 @@ type HerokuClientInterface interface {
 	GetPGInfo(ctx context.Context, addonID string) (PGInfo, error)
 	ListConfigVars(ctx context.Context, appName string) (HerokuConfigVars, error)
 	GetReleaseTasks(ctx context.Context, appName string) ([]HerokuReleaseTask, error)
+	ListSchedulerJobs(ctx context.Context, appName string) ([]HerokuSchedulerJob, error)
 }
 
 // HerokuClient represents the Heroku API client
@@ -171,7 +242,8 @@ type HerokuAddon struct {
 			} `json:"app"`
 		} `json:"addon"`
 	} `json:"attachments"`
-	State string `json:"state"`
+	ConfigVars []string `json:"config_vars"`
+	State      string   `json:"state"`
 }
 
 func (h *HerokuClient) ListAddons(ctx context.Context, appName string) ([]HerokuAddon, error) {
@@ -230,6 +302,23 @@ func (h *HerokuClient) GetReleaseTasks(ctx context.Context, appName string) ([]H
 	return releaseTasks, nil
 }
 
+// HerokuSchedulerJob is a job of the Heroku Scheduler add-on. The frequency is
+// one of every_ten_minutes, every_hour_at_MM or every_day_at_HH:MM, in UTC.
+type HerokuSchedulerJob struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	DynoSize  string `json:"dyno_size"`
+	Frequency string `json:"frequency"`
+}
+
+// ListSchedulerJobs lists the jobs of the Heroku Scheduler add-on, using the
+// API of the Heroku Scheduler dashboard.
+func (h *HerokuClient) ListSchedulerJobs(ctx context.Context, appName string) ([]HerokuSchedulerJob, error) {
+	endpoint := fmt.Sprintf("/apps/%s/jobs", appName)
+	url := "https://particleboard.heroku.com" + endpoint
+	return herokuGet[[]HerokuSchedulerJob](ctx, h, url)
+}
+
 type HerokuDyno struct {
 	Name         string `json:"name"`
 	Command      string `json:"command"`
@@ -0,0 +1,558 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/dryrun"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"go.yaml.in/yaml/v4"
+)
+
+// HerokuStep is one of the steps that run after the compose file for a Heroku
+// application has been generated. Each step can be skipped.
+type HerokuStep string
+
+const (
+	HerokuStepConfig    HerokuStep = "config"    // copy the config vars to the Defang stack
+	HerokuStepRelease   HerokuStep = "release"   // run the release phase before the other services
+	HerokuStepScheduler HerokuStep = "scheduler" // print the steps to run the Heroku Scheduler jobs
+	HerokuStepDatabase  HerokuStep = "database"  // copy the data of Heroku Postgres with pg_dump
+)
+
+var AllHerokuSteps = []HerokuStep{
+	HerokuStepConfig,
+	HerokuStepRelease,
+	HerokuStepScheduler,
+	HerokuStepDatabase,
+}
+
+func ParseHerokuSteps(steps []string) ([]HerokuStep, error) {
+	var parsed []HerokuStep
+	for _, step := range steps {
+		if !slices.Contains(AllHerokuSteps, HerokuStep(step)) {
+			return nil, fmt.Errorf("invalid step %q; must be one of %v", step, AllHerokuSteps)
+		}
+		parsed = append(parsed, HerokuStep(step))
+	}
+	return parsed, nil
+}
+
+// ConfigPutter stores config values in the target stack, like a Provider.
+type ConfigPutter interface {
+	PutConfig(ctx context.Context, req *defangv1.PutConfigRequest) error
+}
+
+// HerokuPostGenerate carries over the parts of a Heroku application that the
+// generated compose file does not cover: the config vars, the release phase,
+// the Heroku Scheduler jobs and the Postgres data.
+type HerokuPostGenerate struct {
+	Client   HerokuClientInterface
+	Surveyor surveyor.Surveyor
+	AppName  string
+	Info     HerokuApplicationInfo // not sanitized; the config vars hold the actual values
+	Skip     []HerokuStep
+	// Exec runs pg_dump and pg_restore with the extra environment variables;
+	// defaults to running the command in the current terminal.
+	Exec func(ctx context.Context, env []string, name string, args ...string) error
+
+	manualSteps []string // printed by PrintManualSteps
+}
+
+// Skips reports whether the step is skipped.
+func (h *HerokuPostGenerate) Skips(step HerokuStep) bool {
+	if slices.Contains(h.Skip, step) {
+		term.Debugf("Skipping step %q", step)
+		return true
+	}
+	return false
+}
+
+func (h *HerokuPostGenerate) confirm(message string, defaultValue bool) (bool, error) {
+	confirmed := defaultValue
+	if err := h.Surveyor.AskOne(&survey.Confirm{Message: message, Default: defaultValue}, &confirmed); err != nil {
+		return false, err
+	}
+	return confirmed, nil
+}
+
+// UpdateCompose points the connection strings of the generated compose file at
+// the managed services and adds the release phase as a one-shot service. The
+// Heroku Scheduler jobs are not added as services while x-defang-schedule is
+// not supported; the steps to run them are collected to be printed by
+// PrintManualSteps instead.
+func (h *HerokuPostGenerate) UpdateCompose(ctx context.Context, composeFile string) (string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(composeFile), &document); err != nil {
+		return "", fmt.Errorf("failed to unmarshal compose content as yaml: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return composeFile, nil
+	}
+	services := mappingValue(document.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return composeFile, nil
+	}
+	// The add-on config vars are not copied, so derive them from the managed services
+	changed := setManagedServiceURLs(services)
+
+	if !h.Skips(HerokuStepRelease) {
+		base, baseName := herokuBaseService(services)
+		if base == nil {
+			term.Warn("The compose file has no service to run the release phase; skipping")
+		} else {
+			ok, err := h.addReleaseServices(services, base, baseName)
+			if err != nil {
+				return "", err
+			}
+			changed = changed || ok
+		}
+	}
+	if !h.Skips(HerokuStepScheduler) {
+		if err := h.addSchedulerSteps(ctx, services); err != nil {
+			return "", err
+		}
+	}
+	if !changed {
+		return composeFile, nil
+	}
+
+	contentBytes, err := yaml.Marshal(document.Content[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal compose content to yaml: %w", err)
+	}
+	if _, err := compose.LoadFromContentWithInterpolation(ctx, contentBytes, h.AppName); err != nil {
+		term.Warnf("Keeping the generated compose file; the release phase and connection strings could not be added: %v", err)
+		return composeFile, nil
+	}
+	return string(contentBytes), nil
+}
+
+// PrintManualSteps prints the parts of the Heroku application that have to be
+// carried over by hand.
+func (h *HerokuPostGenerate) PrintManualSteps() {
+	if len(h.manualSteps) == 0 {
+		return
+	}
+	term.Warn("Defang does not run these parts of the Heroku application; carry them over yourself:")
+	for _, step := range h.manualSteps {
+		term.Warn(" - " + step)
+	}
+}
+
+// addReleaseServices turns each release task into a one-shot service that the
+// other services depend on, so it runs to completion before they start.
+func (h *HerokuPostGenerate) addReleaseServices(services, base *yaml.Node, baseName string) (bool, error) {
+	var tasks []HerokuReleaseTask
+	for _, task := range h.Info.ReleaseTasks {
+		if task.Command != "" && !hasServiceWithCommand(services, task.Command) {
+			tasks = append(tasks, task)
+		}
+	}
+	if len(tasks) == 0 {
+		return false, nil
+	}
+	if ok, err := h.confirm(fmt.Sprintf("Run the release phase (%s) before the services of %q start?", tasks[0].Command, baseName), true); err != nil || !ok {
+		return false, err
+	}
+
+	dependents := computeServiceNames(services)
+	for _, task := range tasks {
+		name := uniqueServiceName(services, "release")
+		service := herokuJobService(base, task.Command)
+		appendMapping(service, "restart", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "no", Style: yaml.DoubleQuotedStyle})
+		appendMapping(services, name, service)
+		for _, dependent := range dependents {
+			addDependency(mappingValue(services, dependent), name, "service_completed_successfully")
+		}
+		term.Infof("Added service %q to run the release phase", name)
+	}
+	return true, nil
+}
+
+// addSchedulerSteps adds the steps to run the Heroku Scheduler jobs, unless the
+// compose file already has a service that runs the same command.
+func (h *HerokuPostGenerate) addSchedulerSteps(ctx context.Context, services *yaml.Node) error {
+	if !slices.ContainsFunc(h.Info.Addons, func(addon HerokuAddon) bool { return addon.AddonService.Name == "scheduler" }) {
+		return nil
+	}
+	jobs, err := h.Client.ListSchedulerJobs(ctx, h.AppName)
+	if err != nil {
+		return fmt.Errorf("failed to list Heroku Scheduler jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if hasServiceWithCommand(services, job.Command) {
+			continue
+		}
+		schedule := job.Frequency
+		if cron, err := herokuSchedulerCron(job.Frequency); err == nil {
+			schedule = fmt.Sprintf("%q (cron, UTC)", cron)
+		}
+		h.manualSteps = append(h.manualSteps, fmt.Sprintf("Heroku Scheduler: run `%s` on schedule %s with an external scheduler, for example a scheduled CI workflow", job.Command, schedule))
+	}
+	return nil
+}
+
+var herokuHourly = regexp.MustCompile(`^every_hour_at_(\d{1,2})$`)
+var herokuDaily = regexp.MustCompile(`^every_day_at_(\d{1,2}):(\d{2})$`)
+
+// herokuSchedulerCron converts the frequency of a Heroku Scheduler job to a
+// cron expression. Heroku Scheduler uses UTC.
+func herokuSchedulerCron(frequency string) (string, error) {
+	if frequency == "every_ten_minutes" {
+		return "*/10 * * * *", nil
+	}
+	if m := herokuHourly.FindStringSubmatch(frequency); m != nil {
+		if minute, _ := strconv.Atoi(m[1]); minute < 60 {
+			return fmt.Sprintf("%d * * * *", minute), nil
+		}
+	}
+	if m := herokuDaily.FindStringSubmatch(frequency); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 24 && minute < 60 {
+			return fmt.Sprintf("%d %d * * *", minute, hour), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported frequency %q", frequency)
+}
+
+// herokuConfigVarNames returns the config vars to copy, without the ones that
+// are attached by add-ons; those are replaced by the managed services.
+func (h *HerokuPostGenerate) herokuConfigVarNames() []string {
+	var addonVars []string
+	for _, addon := range h.Info.Addons {
+		addonVars = append(addonVars, addon.ConfigVars...)
+	}
+	var names []string
+	for name := range h.Info.ConfigVars {
+		if slices.Contains(addonVars, name) {
+			continue
+		}
+		if !pkg.IsValidSecretName(name) {
+			term.Warnf("Skipping config var %q; it is not a valid config name", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// PushConfig copies the config vars that the user selects to the project in
+// the target stack.
+func (h *HerokuPostGenerate) PushConfig(ctx context.Context, configs ConfigPutter, projectName string) error {
+	if h.Skips(HerokuStepConfig) {
+		return nil
+	}
+	names := h.herokuConfigVarNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	var selected []string
+	if err := h.Surveyor.AskOne(&survey.MultiSelect{
+		Message: fmt.Sprintf("Review the config vars to copy from %q to project %q:", h.AppName, projectName),
+		Options: names,
+		Default: names,
+		Help:    "Config vars attached by add-ons are not copied; deselect any config var you want to set yourself",
+	}, &selected); err != nil {
+		return fmt.Errorf("failed to select config vars: %w", err)
+	}
+	if len(selected) == 0 {
+		term.Info("No config vars selected; skipping")
+		return nil
+	}
+	if dryrun.DoDryRun {
+		return dryrun.ErrDryRun
+	}
+
+	for _, name := range selected {
+		if err := configs.PutConfig(ctx, &defangv1.PutConfigRequest{Project: projectName, Name: name, Value: h.Info.ConfigVars[name]}); err != nil {
+			return fmt.Errorf("failed to set config %q: %w", name, err)
+		}
+	}
+	term.Infof("Copied %d config var(s) to project %q", len(selected), projectName)
+	return nil
+}
+
+// RestoreDatabase copies the data of Heroku Postgres to the new managed
+// Postgres with pg_dump and pg_restore. Without a connection string for the
+// new database, the dump is kept to be restored later.
+func (h *HerokuPostGenerate) RestoreDatabase(ctx context.Context) error {
+	if h.Skips(HerokuStepDatabase) {
+		return nil
+	}
+	i := slices.IndexFunc(h.Info.Addons, func(addon HerokuAddon) bool { return addon.AddonService.Name == "heroku-postgresql" })
+	if i < 0 {
+		return nil
+	}
+	addon := h.Info.Addons[i]
+	sourceURL := h.Info.ConfigVars["DATABASE_URL"]
+	for _, name := range addon.ConfigVars {
+		if strings.HasSuffix(name, "_URL") && h.Info.ConfigVars[name] != "" {
+			sourceURL = h.Info.ConfigVars[name]
+			break
+		}
+	}
+	if sourceURL == "" {
+		term.Warnf("Skipping the database copy; no connection string found for %q", addon.Name)
+		return nil
+	}
+	if ok, err := h.confirm(fmt.Sprintf("Copy the data of %q with pg_dump and pg_restore?", addon.Name), false); err != nil || !ok {
+		return err
+	}
+
+	run := h.Exec
+	if run == nil {
+		run = runCommand
+	}
+	dump, err := os.CreateTemp("", "heroku-"+h.AppName+"-*.dump")
+	if err != nil {
+		return err
+	}
+	dump.Close()
+	keepDump := false
+	defer func() {
+		if !keepDump {
+			os.Remove(dump.Name())
+		}
+	}()
+
+	// Pass the passwords in the environment; the arguments are visible to other users
+	sourceDB, sourceEnv, err := pgConnection(sourceURL)
+	if err != nil {
+		return fmt.Errorf("invalid connection string for %q: %w", addon.Name, err)
+	}
+	term.Infof("Dumping %q to %s", addon.Name, dump.Name())
+	if err := run(ctx, sourceEnv, "pg_dump", "--format=custom", "--no-owner", "--no-acl", "--file="+dump.Name(), "--dbname="+sourceDB); err != nil {
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+
+	var targetURL string
+	if err := h.Surveyor.AskOne(&survey.Password{
+		Message: "Connection string of the new Postgres database (leave empty to restore later):",
+		Help:    "The managed Postgres is created by `defang compose up`; the connection string must be reachable from this machine",
+	}, &targetURL); err != nil {
+		return fmt.Errorf("failed to prompt for the connection string: %w", err)
+	}
+	if targetURL == "" {
+		keepDump = true
+		term.Infof("To restore the data after deploying, run `pg_restore --no-owner --no-acl --dbname=<connection string> %s`", dump.Name())
+		return nil
+	}
+
+	targetDB, targetEnv, err := pgConnection(targetURL)
+	if err != nil {
+		return fmt.Errorf("invalid connection string: %w", err)
+	}
+	if err := run(ctx, targetEnv, "pg_restore", "--no-owner", "--no-acl", "--dbname="+targetDB, dump.Name()); err != nil {
+		keepDump = true
+		return fmt.Errorf("pg_restore failed; the dump is kept at %s: %w", dump.Name(), err)
+	}
+	term.Infof("Restored the data of %q", addon.Name)
+	return nil
+}
+
+// pgConnection splits the password off a Postgres connection string and
+// returns it as a PGPASSWORD environment variable.
+func pgConnection(connection string) (string, []string, error) {
+	u, err := url.Parse(connection)
+	if err != nil {
+		return "", nil, errors.New("cannot parse the connection string") // don't leak the password
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		return connection, nil, nil
+	}
+	u.User = url.User(u.User.Username())
+	return u.String(), []string{"PGPASSWORD=" + password}, nil
+}
+
+func runCommand(ctx context.Context, env []string, name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s is not installed: %w", name, err)
+	}
+	_, stdout, stderr := term.DefaultTerm.Stdio()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// setManagedServiceURLs sets DATABASE_URL and REDIS_URL of the services to the
+// connection strings of the managed Postgres and Redis services, if any.
+func setManagedServiceURLs(services *yaml.Node) bool {
+	urls := make(map[string]string)
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name, service := services.Content[i].Value, services.Content[i+1]
+		if _, ok := urls["DATABASE_URL"]; !ok && mappingValue(service, "x-defang-postgres") != nil {
+			urls["DATABASE_URL"] = postgresURL(name)
+		}
+		if _, ok := urls["REDIS_URL"]; !ok && mappingValue(service, "x-defang-redis") != nil {
+			urls["REDIS_URL"] = redisURL(name)
+		}
+	}
+	changed := false
+	for _, name := range computeServiceNames(services) {
+		env := mappingValue(mappingValue(services, name), "environment")
+		if env == nil {
+			continue
+		}
+		for key, url := range urls {
+			switch env.Kind {
+			case yaml.MappingNode:
+				if value := mappingValue(env, key); value != nil && value.Value != url {
+					*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: url}
+					changed = true
+				}
+			case yaml.SequenceNode:
+				for _, item := range env.Content {
+					if (item.Value == key || strings.HasPrefix(item.Value, key+"=")) && item.Value != key+"="+url {
+						item.Value = key + "=" + url
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// herokuBaseService returns the service that runs the "web" process, or else
+// the first service that is built or has an image and is not managed.
+func herokuBaseService(services *yaml.Node) (*yaml.Node, string) {
+	names := computeServiceNames(services)
+	if slices.Contains(names, "web") {
+		return mappingValue(services, "web"), "web"
+	}
+	for _, name := range names {
+		service := mappingValue(services, name)
+		if mappingValue(service, "build") != nil || mappingValue(service, "image") != nil {
+			return service, name
+		}
+	}
+	return nil, ""
+}
+
+// herokuJobService returns a service that runs the command with the build,
+// image and environment of the base service.
+func herokuJobService(base *yaml.Node, command string) *yaml.Node {
+	service := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range []string{"build", "image"} {
+		if value := mappingValue(base, key); value != nil {
+			appendMapping(service, key, value)
+		}
+	}
+	appendMapping(service, "command", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: command})
+	if value := mappingValue(base, "environment"); value != nil {
+		appendMapping(service, "environment", value)
+	}
+	return service
+}
+
+// computeServiceNames returns the services that are not managed.
+func computeServiceNames(services *yaml.Node) []string {
+	var names []string
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		service := services.Content[i+1]
+		managed := false
+		for _, ext := range []string{"x-defang-postgres", "x-defang-redis", "x-defang-mongodb"} {
+			if mappingValue(service, ext) != nil {
+				managed = true
+			}
+		}
+		if !managed {
+			names = append(names, services.Content[i].Value)
+		}
+	}
+	return names
+}
+
+func hasServiceWithCommand(services *yaml.Node, command string) bool {
+	for i := 1; i < len(services.Content); i += 2 {
+		value := mappingValue(services.Content[i], "command")
+		if value == nil {
+			continue
+		}
+		if value.Kind == yaml.ScalarNode && value.Value == command {
+			return true
+		}
+		if value.Kind == yaml.SequenceNode {
+			var args []string
+			for _, arg := range value.Content {
+				args = append(args, arg.Value)
+			}
+			if strings.Join(args, " ") == command {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func uniqueServiceName(services *yaml.Node, name string) string {
+	if name == "" {
+		name = "job"
+	}
+	unique := name
+	for n := 2; mappingValue(services, unique) != nil; n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	return unique
+}
+
+// addDependency makes the service depend on another service, converting the
+// short syntax of depends_on to the long syntax if needed.
+func addDependency(service *yaml.Node, dependency, condition string) {
+	dependsOn := mappingValue(service, "depends_on")
+	if dependsOn == nil {
+		dependsOn = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		appendMapping(service, "depends_on", dependsOn)
+	} else if dependsOn.Kind == yaml.SequenceNode {
+		long := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, name := range dependsOn.Content {
+			appendMapping(long, name.Value, dependencyNode("service_started"))
+		}
+		*dependsOn = *long
+	}
+	if mappingValue(dependsOn, dependency) == nil {
+		appendMapping(dependsOn, dependency, dependencyNode(condition))
+	}
+}
+
+func dependencyNode(condition string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	appendMapping(node, "condition", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: condition})
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func appendMapping(node *yaml.Node, key string, value *yaml.Node) {
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
@@ -0,0 +1,320 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const herokuGeneratedCompose = `services:
+  web:
+    build:
+      context: .
+    command: bundle exec puma -C config/puma.rb
+    ports:
+      - target: 3000
+        mode: ingress
+    environment:
+      - RAILS_ENV=production
+      - SECRET_KEY_BASE
+    depends_on:
+      - postgres
+  worker:
+    build:
+      context: .
+    command: bundle exec sidekiq
+    environment:
+      - RAILS_ENV=production
+      - SECRET_KEY_BASE
+  postgres:
+    image: postgres:16
+    x-defang-postgres: true
+`
+
+func herokuAddon(service, name string, configVars ...string) HerokuAddon {
+	addon := HerokuAddon{Name: name, ID: name + "-id", ConfigVars: configVars}
+	addon.AddonService.Name = service
+	return addon
+}
+
+func newHerokuPostGenerate(client *MockHerokuClient, surveyor *MockSurveyor) *HerokuPostGenerate {
+	return &HerokuPostGenerate{
+		Client:   client,
+		Surveyor: surveyor,
+		AppName:  "shop",
+		Info: HerokuApplicationInfo{
+			Addons: []HerokuAddon{
+				herokuAddon("heroku-postgresql", "postgresql-round-12345", "DATABASE_URL"),
+				herokuAddon("scheduler", "scheduler-flat-67890"),
+			},
+			ConfigVars: HerokuConfigVars{
+				"DATABASE_URL":    "postgres://u:p@ec2-1-2-3-4.compute-1.amazonaws.com:5432/d8a",
+				"RAILS_ENV":       "production",
+				"SECRET_KEY_BASE": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+				"bad-name":        "x",
+			},
+			ReleaseTasks: []HerokuReleaseTask{{Command: "bin/rails db:migrate", Type: "release"}},
+		},
+	}
+}
+
+func TestHerokuUpdateCompose(t *testing.T) {
+	mockHerokuClient := &MockHerokuClient{}
+	mockHerokuClient.On("ListSchedulerJobs", mock.Anything, "shop").Return([]HerokuSchedulerJob{
+		{Command: "bin/rake cleanup", Frequency: "every_ten_minutes"},
+		{Command: "bin/rake reports:daily", Frequency: "every_day_at_3:30"},
+		{Command: "bundle exec sidekiq", Frequency: "every_hour_at_0"}, // already a service
+		{Command: "bin/rake weekly", Frequency: "every_week"},
+	}, nil).Once()
+	mockSurveyor := &MockSurveyor{responses: []any{true}}
+	mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+	composeFile, err := h.UpdateCompose(t.Context(), herokuGeneratedCompose)
+	require.NoError(t, err)
+	mockHerokuClient.AssertExpectations(t)
+	mockSurveyor.AssertExpectations(t)
+	require.NoError(t, pkg.Compare([]byte(composeFile), "testdata/heroku-post-generate.compose.yaml"))
+	require.NoError(t, pkg.Compare([]byte(strings.Join(h.manualSteps, "\n")+"\n"), "testdata/heroku-post-generate.steps.txt"))
+
+	// The release phase runs once before the other services; x-defang-schedule
+	// is not supported yet, so the scheduled jobs are not added as services
+	project, err := compose.LoadFromContentWithInterpolation(t.Context(), []byte(composeFile), "shop")
+	require.NoError(t, err)
+	require.NoError(t, compose.ValidateProject(project, modes.RecipeAffordable))
+	release := project.Services["release"]
+	assert.Equal(t, "no", release.Restart)
+	assert.Equal(t, "bin/rails db:migrate", strings.Join(release.Command, " "))
+	for _, name := range []string{"web", "worker"} {
+		assert.Equal(t, "service_completed_successfully", project.Services[name].DependsOn["release"].Condition, name)
+	}
+	for _, service := range project.Services {
+		assert.NotContains(t, service.Extensions, compose.ScheduleExtension, service.Name)
+	}
+
+	t.Run("skipped", func(t *testing.T) {
+		mockHerokuClient := &MockHerokuClient{}
+		mockSurveyor := &MockSurveyor{}
+		h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+		h.Skip = []HerokuStep{HerokuStepRelease, HerokuStepScheduler}
+		composeFile, err := h.UpdateCompose(t.Context(), herokuGeneratedCompose)
+		require.NoError(t, err)
+		assert.Equal(t, herokuGeneratedCompose, composeFile)
+		assert.Empty(t, h.manualSteps)
+		mockHerokuClient.AssertNotCalled(t, "ListSchedulerJobs", mock.Anything, mock.Anything)
+	})
+
+	t.Run("managed service urls", func(t *testing.T) {
+		mockHerokuClient := &MockHerokuClient{}
+		mockSurveyor := &MockSurveyor{}
+		h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+		h.Skip = []HerokuStep{HerokuStepRelease, HerokuStepScheduler}
+		composeFile, err := h.UpdateCompose(t.Context(), `services:
+  web:
+    build:
+      context: .
+    environment:
+      - DATABASE_URL
+      - REDIS_URL=redis://old:6379
+  worker:
+    build:
+      context: .
+    environment:
+      DATABASE_URL:
+  db:
+    image: postgres:16
+    x-defang-postgres: true
+  cache:
+    image: redis:7
+    x-defang-redis: true
+`)
+		require.NoError(t, err)
+		assert.Contains(t, composeFile, "- DATABASE_URL=postgres://postgres:${POSTGRES_PASSWORD}@db:5432/postgres\n")
+		assert.Contains(t, composeFile, "- REDIS_URL=redis://cache:6379\n")
+		assert.Contains(t, composeFile, "DATABASE_URL: postgres://postgres:${POSTGRES_PASSWORD}@db:5432/postgres\n")
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		mockHerokuClient := &MockHerokuClient{}
+		mockSurveyor := &MockSurveyor{responses: []any{false}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+		h.Skip = []HerokuStep{HerokuStepScheduler}
+		composeFile, err := h.UpdateCompose(t.Context(), herokuGeneratedCompose)
+		require.NoError(t, err)
+		assert.Equal(t, herokuGeneratedCompose, composeFile)
+		mockSurveyor.AssertExpectations(t)
+	})
+
+}
+
+func TestHerokuSchedulerCron(t *testing.T) {
+	tests := []struct {
+		frequency string
+		want      string
+	}{
+		{"every_ten_minutes", "*/10 * * * *"},
+		{"every_hour_at_0", "0 * * * *"},
+		{"every_hour_at_45", "45 * * * *"},
+		{"every_day_at_3:30", "30 3 * * *"},
+		{"every_day_at_23:00", "0 23 * * *"},
+		{"every_hour_at_60", ""},
+		{"every_day_at_24:00", ""},
+		{"every_week", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.frequency, func(t *testing.T) {
+			cron, err := herokuSchedulerCron(tt.frequency)
+			if tt.want == "" {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, cron)
+			}
+		})
+	}
+}
+
+type mockConfigPutter struct {
+	requests []*defangv1.PutConfigRequest
+}
+
+func (m *mockConfigPutter) PutConfig(ctx context.Context, req *defangv1.PutConfigRequest) error {
+	m.requests = append(m.requests, req)
+	return nil
+}
+
+func TestHerokuPushConfig(t *testing.T) {
+	mockHerokuClient := &MockHerokuClient{}
+	mockSurveyor := &MockSurveyor{responses: []any{[]string{"SECRET_KEY_BASE"}}}
+	mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+
+	// The names offered for review exclude the add-on config vars and invalid names
+	assert.Equal(t, []string{"RAILS_ENV", "SECRET_KEY_BASE"}, h.herokuConfigVarNames())
+
+	configs := &mockConfigPutter{}
+	require.NoError(t, h.PushConfig(t.Context(), configs, "shop"))
+	mockSurveyor.AssertExpectations(t)
+	require.Len(t, configs.requests, 1)
+	assert.Equal(t, "shop", configs.requests[0].Project)
+	assert.Equal(t, "SECRET_KEY_BASE", configs.requests[0].Name)
+	assert.Equal(t, h.Info.ConfigVars["SECRET_KEY_BASE"], configs.requests[0].Value)
+
+	t.Run("skipped", func(t *testing.T) {
+		mockSurveyor := &MockSurveyor{}
+		h := newHerokuPostGenerate(mockHerokuClient, mockSurveyor)
+		h.Skip = []HerokuStep{HerokuStepConfig}
+		configs := &mockConfigPutter{}
+		require.NoError(t, h.PushConfig(t.Context(), configs, "shop"))
+		assert.Empty(t, configs.requests)
+		mockSurveyor.AssertNotCalled(t, "AskOne", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("values are not sanitized", func(t *testing.T) {
+		mockHerokuClient := &MockHerokuClient{}
+		mockHerokuClient.On("ListDynos", mock.Anything, "shop").Return([]HerokuDyno{}, nil)
+		mockHerokuClient.On("GetReleaseTasks", mock.Anything, "shop").Return([]HerokuReleaseTask{}, nil)
+		mockHerokuClient.On("ListAddons", mock.Anything, "shop").Return([]HerokuAddon{}, nil)
+		mockHerokuClient.On("ListConfigVars", mock.Anything, "shop").Return(HerokuConfigVars{"SECRET_KEY_BASE": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}, nil)
+		source := NewHerokuSource(mockHerokuClient)
+		info, err := source.CollectAppInfo(t.Context(), "shop")
+		require.NoError(t, err)
+		sanitized, err := source.Sanitize(info)
+		require.NoError(t, err)
+		assert.Equal(t, "REDACTED", sanitized.(HerokuApplicationInfo).ConfigVars["SECRET_KEY_BASE"])
+
+		mockSurveyor := &MockSurveyor{responses: []any{[]string{"SECRET_KEY_BASE"}}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		configs := &mockConfigPutter{}
+		require.NoError(t, source.PostGenerate(mockSurveyor, nil).PushConfig(t.Context(), configs, "shop"))
+		require.Len(t, configs.requests, 1)
+		assert.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", configs.requests[0].Value)
+	})
+}
+
+func TestHerokuRestoreDatabase(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	var commands []string
+	var envs [][]string
+	exec := func(ctx context.Context, env []string, name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		envs = append(envs, env)
+		return nil
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		commands, envs = nil, nil
+		mockSurveyor := &MockSurveyor{responses: []any{true, "postgres://defang:pw@db.internal:5432/postgres"}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Twice()
+		h := newHerokuPostGenerate(&MockHerokuClient{}, mockSurveyor)
+		h.Exec = exec
+		require.NoError(t, h.RestoreDatabase(t.Context()))
+		mockSurveyor.AssertExpectations(t)
+		require.Len(t, commands, 2)
+		assert.Contains(t, commands[0], "pg_dump --format=custom")
+		assert.Contains(t, commands[0], "--dbname=postgres://u@ec2-1-2-3-4.compute-1.amazonaws.com:5432/d8a")
+		assert.Contains(t, commands[1], "pg_restore --no-owner --no-acl --dbname=postgres://defang@db.internal:5432/postgres")
+		assert.Equal(t, [][]string{{"PGPASSWORD=p"}, {"PGPASSWORD=pw"}}, envs, "the passwords are not in the arguments")
+		dumps, _ := os.ReadDir(os.TempDir())
+		assert.Empty(t, dumps, "the dump is removed after the restore")
+	})
+
+	t.Run("restore later", func(t *testing.T) {
+		commands, envs = nil, nil
+		mockSurveyor := &MockSurveyor{responses: []any{true, ""}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Twice()
+		h := newHerokuPostGenerate(&MockHerokuClient{}, mockSurveyor)
+		h.Exec = exec
+		require.NoError(t, h.RestoreDatabase(t.Context()))
+		assert.Len(t, commands, 1, "only pg_dump runs")
+		dumps, _ := os.ReadDir(os.TempDir())
+		assert.Len(t, dumps, 1, "the dump is kept")
+	})
+
+	t.Run("dump failed", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(os.TempDir()))
+		require.NoError(t, os.Mkdir(os.TempDir(), 0o700))
+		mockSurveyor := &MockSurveyor{responses: []any{true}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		h := newHerokuPostGenerate(&MockHerokuClient{}, mockSurveyor)
+		h.Exec = func(ctx context.Context, env []string, name string, args ...string) error {
+			return errors.New("connection refused")
+		}
+		require.ErrorContains(t, h.RestoreDatabase(t.Context()), "pg_dump failed")
+		dumps, _ := os.ReadDir(os.TempDir())
+		assert.Empty(t, dumps, "the dump is removed")
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		commands = nil
+		mockSurveyor := &MockSurveyor{}
+		h := newHerokuPostGenerate(&MockHerokuClient{}, mockSurveyor)
+		h.Exec = exec
+		h.Skip = []HerokuStep{HerokuStepDatabase}
+		require.NoError(t, h.RestoreDatabase(t.Context()))
+		assert.Empty(t, commands)
+		mockSurveyor.AssertNotCalled(t, "AskOne", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		commands = nil
+		mockSurveyor := &MockSurveyor{responses: []any{false}}
+		mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		h := newHerokuPostGenerate(&MockHerokuClient{}, mockSurveyor)
+		h.Exec = exec
+		require.NoError(t, h.RestoreDatabase(t.Context()))
+		assert.Empty(t, commands)
+	})
+}
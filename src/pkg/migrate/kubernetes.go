@@ -0,0 +1,714 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"go.yaml.in/yaml/v4"
+)
+
+// KubernetesConversion is the compose file converted from Kubernetes manifests.
+type KubernetesConversion struct {
+	Compose []byte
+	// Config lists the config variables, with values from Secrets, to set with
+	// `defang config set` before deploying.
+	Config []string
+	// Report lists the constructs that could not be translated.
+	Report []string
+}
+
+type k8sMetadata struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+type k8sObject struct {
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Spec       yaml.Node         `yaml:"spec"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+	Items      []yaml.Node       `yaml:"items"` // kind: List
+}
+
+func (o k8sObject) ref() string {
+	return o.Kind + "/" + o.Metadata.Name
+}
+
+type k8sWorkloadSpec struct {
+	Replicas *int `yaml:"replicas"`
+	Template struct {
+		Metadata k8sMetadata `yaml:"metadata"`
+		Spec     k8sPodSpec  `yaml:"spec"`
+	} `yaml:"template"`
+	VolumeClaimTemplates []struct {
+		Metadata k8sMetadata `yaml:"metadata"`
+	} `yaml:"volumeClaimTemplates"`
+}
+
+type k8sPodSpec struct {
+	Containers     []k8sContainer `yaml:"containers"`
+	InitContainers []k8sContainer `yaml:"initContainers"`
+	Volumes        []struct {
+		Name string `yaml:"name"`
+	} `yaml:"volumes"`
+}
+
+type k8sContainer struct {
+	Name    string   `yaml:"name"`
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Ports   []struct {
+		Name          string `yaml:"name"`
+		ContainerPort int    `yaml:"containerPort"`
+		Protocol      string `yaml:"protocol"`
+	} `yaml:"ports"`
+	Env     []k8sEnvVar `yaml:"env"`
+	EnvFrom []struct {
+		Prefix       string  `yaml:"prefix"`
+		ConfigMapRef *k8sRef `yaml:"configMapRef"`
+		SecretRef    *k8sRef `yaml:"secretRef"`
+	} `yaml:"envFrom"`
+	Resources struct {
+		Requests map[string]string `yaml:"requests"`
+		Limits   map[string]string `yaml:"limits"`
+	} `yaml:"resources"`
+	ReadinessProbe *k8sProbe `yaml:"readinessProbe"`
+	LivenessProbe  *k8sProbe `yaml:"livenessProbe"`
+	StartupProbe   *k8sProbe `yaml:"startupProbe"`
+}
+
+type k8sRef struct {
+	Name string `yaml:"name"`
+}
+
+type k8sKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type k8sEnvVar struct {
+	Name      string `yaml:"name"`
+	Value     string `yaml:"value"`
+	ValueFrom *struct {
+		SecretKeyRef     *k8sKeyRef `yaml:"secretKeyRef"`
+		ConfigMapKeyRef  *k8sKeyRef `yaml:"configMapKeyRef"`
+		FieldRef         *struct{}  `yaml:"fieldRef"`
+		ResourceFieldRef *struct{}  `yaml:"resourceFieldRef"`
+	} `yaml:"valueFrom"`
+}
+
+type k8sProbe struct {
+	HTTPGet *struct {
+		Path   string `yaml:"path"`
+		Port   string `yaml:"port"`
+		Scheme string `yaml:"scheme"`
+	} `yaml:"httpGet"`
+	Exec *struct {
+		Command []string `yaml:"command"`
+	} `yaml:"exec"`
+	TCPSocket           *struct{} `yaml:"tcpSocket"`
+	GRPC                *struct{} `yaml:"grpc"`
+	InitialDelaySeconds int       `yaml:"initialDelaySeconds"`
+	PeriodSeconds       int       `yaml:"periodSeconds"`
+	TimeoutSeconds      int       `yaml:"timeoutSeconds"`
+	FailureThreshold    int       `yaml:"failureThreshold"`
+}
+
+type k8sServiceSpec struct {
+	Type     string            `yaml:"type"`
+	Selector map[string]string `yaml:"selector"`
+	Ports    []struct {
+		Port       int    `yaml:"port"`
+		TargetPort string `yaml:"targetPort"`
+	} `yaml:"ports"`
+}
+
+type k8sIngressBackend struct {
+	Service *struct {
+		Name string `yaml:"name"`
+	} `yaml:"service"`
+}
+
+type k8sIngressSpec struct {
+	DefaultBackend *k8sIngressBackend `yaml:"defaultBackend"`
+	Rules          []struct {
+		Host string `yaml:"host"`
+		HTTP struct {
+			Paths []struct {
+				Path    string            `yaml:"path"`
+				Backend k8sIngressBackend `yaml:"backend"`
+			} `yaml:"paths"`
+		} `yaml:"http"`
+	} `yaml:"rules"`
+}
+
+// k8sWorkload is a container of a workload, which becomes a compose service.
+type k8sWorkload struct {
+	name      string
+	object    k8sObject
+	labels    map[string]string
+	container k8sContainer
+	service   composeService
+}
+
+// k8sBackend is a port of a workload that a Service selects.
+type k8sBackend struct {
+	workload *k8sWorkload
+	port     int
+}
+
+type k8sConverter struct {
+	configMaps map[string]map[string]string
+	secrets    map[string][]string
+	workloads  []*k8sWorkload
+	backends   map[string][]k8sBackend // by Service name
+	config     map[string]bool
+	report     []string
+}
+
+func (c *k8sConverter) reportf(object k8sObject, format string, args ...any) {
+	c.report = append(c.report, object.ref()+": "+fmt.Sprintf(format, args...))
+}
+
+// ReadKubernetesManifests reads the YAML files, recursively for directories,
+// as one multi-document manifest; "-" reads from stdin.
+func ReadKubernetesManifests(paths []string, stdin io.Reader) ([]byte, error) {
+	var manifests bytes.Buffer
+	appendDocument := func(data []byte) {
+		if manifests.Len() > 0 {
+			manifests.WriteString("\n---\n")
+		}
+		manifests.Write(data)
+	}
+	for _, path := range paths {
+		if path == "-" {
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read manifests from stdin: %w", err)
+			}
+			appendDocument(data)
+			continue
+		}
+		var files []string
+		err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// Files given explicitly are read whatever their extension
+			if file == path || strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			appendDocument(data)
+		}
+	}
+	return manifests.Bytes(), nil
+}
+
+// ConvertKubernetes converts Kubernetes manifests, like the output of
+// `helm template`, to a compose file. The conversion is deterministic: the
+// same manifests always produce the same compose file and report.
+func ConvertKubernetes(manifests []byte) (*KubernetesConversion, error) {
+	objects, err := parseKubernetesManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &k8sConverter{
+		configMaps: make(map[string]map[string]string),
+		secrets:    make(map[string][]string),
+		backends:   make(map[string][]k8sBackend),
+		config:     make(map[string]bool),
+	}
+	for _, object := range objects {
+		switch object.Kind {
+		case "ConfigMap":
+			c.configMaps[object.Metadata.Name] = object.Data
+		case "Secret":
+			// Only the names of the keys are used; values are never copied
+			keys := slices.Collect(maps.Keys(object.Data))
+			keys = append(keys, slices.Collect(maps.Keys(object.StringData))...)
+			slices.Sort(keys)
+			c.secrets[object.Metadata.Name] = slices.Compact(keys)
+		}
+	}
+
+	var services, ingresses []k8sObject
+	for _, object := range objects {
+		switch object.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Pod":
+			if err := c.convertWorkload(object); err != nil {
+				return nil, err
+			}
+		case "Service":
+			services = append(services, object)
+		case "Ingress":
+			ingresses = append(ingresses, object)
+		case "ConfigMap", "Secret", "Namespace":
+			// used for lookups, or not needed
+		default:
+			c.reportf(object, "%s is not translated", object.Kind)
+		}
+	}
+	for _, object := range services {
+		if err := c.convertService(object); err != nil {
+			return nil, err
+		}
+	}
+	for _, object := range ingresses {
+		if err := c.convertIngress(object); err != nil {
+			return nil, err
+		}
+	}
+
+	project := composeFile{Services: make(map[string]composeService)}
+	for _, workload := range c.workloads {
+		if _, ok := project.Services[workload.name]; ok {
+			c.reportf(workload.object, "duplicate service name %q; only the first one is kept", workload.name)
+			continue
+		}
+		project.Services[workload.name] = workload.service
+	}
+	data, err := yaml.Marshal(project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal compose file: %w", err)
+	}
+	return &KubernetesConversion{
+		Compose: data,
+		Config:  slices.Sorted(maps.Keys(c.config)),
+		Report:  c.report,
+	}, nil
+}
+
+func parseKubernetesManifests(manifests []byte) ([]k8sObject, error) {
+	var objects []k8sObject
+	decoder := yaml.NewDecoder(bytes.NewReader(manifests))
+	for i := 1; ; i++ {
+		var object k8sObject
+		if err := decoder.Decode(&object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("failed to parse manifest document %d: %w", i, err)
+		}
+		if object.Kind == "" {
+			continue // empty document, like a helm template that rendered nothing
+		}
+		if object.Kind == "List" {
+			for _, item := range object.Items {
+				var listed k8sObject
+				if err := item.Decode(&listed); err != nil {
+					return nil, fmt.Errorf("failed to parse item of manifest document %d: %w", i, err)
+				}
+				objects = append(objects, listed)
+			}
+			continue
+		}
+		objects = append(objects, object)
+	}
+}
+
+func (c *k8sConverter) convertWorkload(object k8sObject) error {
+	var spec k8sWorkloadSpec
+	var podSpec k8sPodSpec
+	labels := object.Metadata.Labels
+	if object.Kind == "Pod" {
+		if err := object.Spec.Decode(&podSpec); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", object.ref(), err)
+		}
+	} else {
+		if err := object.Spec.Decode(&spec); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", object.ref(), err)
+		}
+		podSpec = spec.Template.Spec
+		labels = spec.Template.Metadata.Labels
+	}
+
+	if object.Kind == "DaemonSet" {
+		c.reportf(object, "a DaemonSet runs on every node; it is converted to a single replica")
+	}
+	for _, container := range podSpec.InitContainers {
+		c.reportf(object, "init container %q is not translated", container.Name)
+	}
+	for _, volume := range podSpec.Volumes {
+		c.reportf(object, "volume %q is not translated", volume.Name)
+	}
+	for _, claim := range spec.VolumeClaimTemplates {
+		c.reportf(object, "volume claim template %q is not translated", claim.Metadata.Name)
+	}
+
+	for _, container := range podSpec.Containers {
+		name := object.Metadata.Name
+		if len(podSpec.Containers) > 1 {
+			name += "-" + container.Name
+		}
+		workload := &k8sWorkload{
+			name:      composeServiceName(name),
+			object:    object,
+			labels:    labels,
+			container: container,
+			service:   c.convertContainer(object, container),
+		}
+		if spec.Replicas != nil {
+			workload.service.Deploy = withReplicas(workload.service.Deploy, *spec.Replicas)
+		}
+		c.workloads = append(c.workloads, workload)
+	}
+	return nil
+}
+
+func withReplicas(deploy *composeDeploy, replicas int) *composeDeploy {
+	if deploy == nil {
+		deploy = &composeDeploy{}
+	}
+	deploy.Replicas = replicas
+	return deploy
+}
+
+func (c *k8sConverter) convertContainer(object k8sObject, container k8sContainer) composeService {
+	service := composeService{
+		Image:      container.Image,
+		Entrypoint: container.Command,
+	}
+	if len(container.Args) > 0 {
+		service.Command = container.Args
+	}
+	repo := compose.GetImageRepo(container.Image)
+	service.XDefangPostgres = compose.IsPostgresRepo(repo)
+	service.XDefangRedis = compose.IsRedisRepo(repo)
+
+	for _, port := range container.Ports {
+		if port.Protocol == "UDP" {
+			c.reportf(object, "UDP port %d is not translated", port.ContainerPort)
+			continue
+		}
+		// Ports are private, until a Service of type LoadBalancer or an Ingress exposes them
+		service.Ports = append(service.Ports, composePort{Target: port.ContainerPort, Mode: "host"})
+	}
+
+	service.Environment = c.convertEnv(object, container)
+
+	reservations, untranslated := k8sResources(container.Resources.Requests)
+	for _, name := range untranslated {
+		c.reportf(object, "resource request %s=%s of container %q is not translated", name, container.Resources.Requests[name], container.Name)
+	}
+	limits, untranslated := k8sResources(container.Resources.Limits)
+	for _, name := range untranslated {
+		c.reportf(object, "resource limit %s=%s of container %q is not translated", name, container.Resources.Limits[name], container.Name)
+	}
+	if reservations != nil || limits != nil {
+		service.Deploy = &composeDeploy{Resources: &composeResources{Reservations: reservations, Limits: limits}}
+	}
+
+	service.HealthCheck = c.convertProbe(object, container)
+	return service
+}
+
+func (c *k8sConverter) convertEnv(object k8sObject, container k8sContainer) []string {
+	var environment []string
+	addConfig := func(name string) {
+		c.config[name] = true
+		environment = append(environment, name)
+	}
+	for _, envFrom := range container.EnvFrom {
+		switch {
+		case envFrom.ConfigMapRef != nil:
+			data, ok := c.configMaps[envFrom.ConfigMapRef.Name]
+			if !ok {
+				c.reportf(object, "ConfigMap %q is not in the manifests", envFrom.ConfigMapRef.Name)
+				continue
+			}
+			for _, key := range slices.Sorted(maps.Keys(data)) {
+				environment = append(environment, envFrom.Prefix+key+"="+escapeInterpolation(data[key]))
+			}
+		case envFrom.SecretRef != nil:
+			keys, ok := c.secrets[envFrom.SecretRef.Name]
+			if !ok {
+				c.reportf(object, "Secret %q is not in the manifests", envFrom.SecretRef.Name)
+				continue
+			}
+			for _, key := range keys {
+				addConfig(envFrom.Prefix + key)
+			}
+		}
+	}
+	for _, env := range container.Env {
+		switch {
+		case env.ValueFrom == nil:
+			environment = append(environment, env.Name+"="+escapeInterpolation(env.Value))
+		case env.ValueFrom.SecretKeyRef != nil:
+			addConfig(env.Name)
+		case env.ValueFrom.ConfigMapKeyRef != nil:
+			ref := env.ValueFrom.ConfigMapKeyRef
+			value, ok := c.configMaps[ref.Name][ref.Key]
+			if !ok {
+				c.reportf(object, "key %q of ConfigMap %q is not in the manifests; %s is a config variable instead", ref.Key, ref.Name, env.Name)
+				addConfig(env.Name)
+				continue
+			}
+			environment = append(environment, env.Name+"="+escapeInterpolation(value))
+		default:
+			c.reportf(object, "environment variable %s of container %q is not translated", env.Name, container.Name)
+		}
+	}
+	slices.Sort(environment)
+	return slices.Compact(environment)
+}
+
+// escapeInterpolation keeps compose from interpolating the value.
+func escapeInterpolation(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
+
+var composeMemoryPattern = regexp.MustCompile(`^\d+(\.\d+)?[kKmMgGtT]?i?$`)
+
+// k8sResources converts the CPU and memory quantities; it returns the names
+// of the resources it cannot convert.
+func k8sResources(resources map[string]string) (*composeReservations, []string) {
+	var result composeReservations
+	var untranslated []string
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		quantity := resources[name]
+		switch name {
+		case "cpu":
+			cpus, err := parseCPUQuantity(quantity)
+			if err != nil {
+				untranslated = append(untranslated, name)
+				continue
+			}
+			result.CPUs = strconv.FormatFloat(cpus, 'f', -1, 64)
+		case "memory":
+			if !composeMemoryPattern.MatchString(quantity) {
+				untranslated = append(untranslated, name)
+				continue
+			}
+			result.Memory = quantity
+		default:
+			untranslated = append(untranslated, name)
+		}
+	}
+	if result == (composeReservations{}) {
+		return nil, untranslated
+	}
+	return &result, untranslated
+}
+
+func parseCPUQuantity(quantity string) (float64, error) {
+	if millis, ok := strings.CutSuffix(quantity, "m"); ok {
+		m, err := strconv.ParseFloat(millis, 64)
+		return m / 1000, err
+	}
+	return strconv.ParseFloat(quantity, 64)
+}
+
+// containerPort resolves a named or numbered port of the container.
+func containerPort(container k8sContainer, port string) (int, bool) {
+	if n, err := strconv.Atoi(port); err == nil {
+		return n, true
+	}
+	for _, p := range container.Ports {
+		if p.Name == port {
+			return p.ContainerPort, true
+		}
+	}
+	return 0, false
+}
+
+func (c *k8sConverter) convertProbe(object k8sObject, container k8sContainer) *composeHealthCheck {
+	probe := container.ReadinessProbe
+	if probe == nil {
+		probe = container.LivenessProbe
+	}
+	if probe == nil {
+		probe = container.StartupProbe
+	}
+	if probe == nil {
+		return nil
+	}
+
+	var healthCheck composeHealthCheck
+	switch {
+	case probe.HTTPGet != nil:
+		port, ok := containerPort(container, probe.HTTPGet.Port)
+		if !ok {
+			c.reportf(object, "probe port %q of container %q is not translated", probe.HTTPGet.Port, container.Name)
+			return nil
+		}
+		scheme := strings.ToLower(probe.HTTPGet.Scheme)
+		if scheme == "" {
+			scheme = "http"
+		}
+		path := probe.HTTPGet.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		healthCheck.Test = []string{"CMD", "curl", "-f", fmt.Sprintf("%s://localhost:%d%s", scheme, port, path)}
+		if scheme == "https" {
+			healthCheck.Test = slices.Insert(healthCheck.Test, 3, "-k")
+		}
+	case probe.Exec != nil:
+		healthCheck.Test = append([]string{"CMD"}, probe.Exec.Command...)
+	default:
+		c.reportf(object, "TCP and gRPC probes of container %q are not translated", container.Name)
+		return nil
+	}
+	healthCheck.Interval = secondsDuration(probe.PeriodSeconds)
+	healthCheck.Timeout = secondsDuration(probe.TimeoutSeconds)
+	healthCheck.StartPeriod = secondsDuration(probe.InitialDelaySeconds)
+	healthCheck.Retries = probe.FailureThreshold
+	return &healthCheck
+}
+
+func secondsDuration(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return strconv.Itoa(seconds) + "s"
+}
+
+// selected returns the workloads with all the labels of the selector.
+func (c *k8sConverter) selected(selector map[string]string) []*k8sWorkload {
+	if len(selector) == 0 {
+		return nil
+	}
+	var workloads []*k8sWorkload
+	for _, workload := range c.workloads {
+		matches := true
+		for key, value := range selector {
+			if workload.labels[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			workloads = append(workloads, workload)
+		}
+	}
+	return workloads
+}
+
+// convertService exposes the ports of the workloads that the Service selects.
+func (c *k8sConverter) convertService(object k8sObject) error {
+	var spec k8sServiceSpec
+	if err := object.Spec.Decode(&spec); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", object.ref(), err)
+	}
+	workloads := c.selected(spec.Selector)
+	if len(workloads) == 0 {
+		c.reportf(object, "no workload matches the selector; the Service is not translated")
+		return nil
+	}
+	public := spec.Type == "LoadBalancer" || spec.Type == "NodePort"
+	for _, workload := range workloads {
+		exposed := false
+		for _, port := range spec.Ports {
+			target := port.TargetPort
+			if target == "" {
+				target = strconv.Itoa(port.Port)
+			}
+			n, ok := containerPort(workload.container, target)
+			if !ok {
+				continue // the port is on another container of the pod
+			}
+			if n != port.Port {
+				c.reportf(object, "port %d is exposed as port %d of %q", port.Port, n, workload.name)
+			}
+			workload.exposePort(n, public)
+			c.backends[object.Metadata.Name] = append(c.backends[object.Metadata.Name], k8sBackend{workload, n})
+			exposed = true
+		}
+		if exposed && workload.name != object.Metadata.Name {
+			c.reportf(object, "clients must use the hostname %q instead of %q", workload.name, object.Metadata.Name)
+		}
+	}
+	return nil
+}
+
+// convertIngress makes the ports of the backends public, with the host of
+// the rule as the domain name.
+func (c *k8sConverter) convertIngress(object k8sObject) error {
+	var spec k8sIngressSpec
+	if err := object.Spec.Decode(&spec); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", object.ref(), err)
+	}
+	expose := func(backend k8sIngressBackend, host string) {
+		if backend.Service == nil {
+			c.reportf(object, "only Service backends are translated")
+			return
+		}
+		backends, ok := c.backends[backend.Service.Name]
+		if !ok {
+			c.reportf(object, "Service %q is not in the manifests", backend.Service.Name)
+			return
+		}
+		for _, b := range backends {
+			b.workload.exposePort(b.port, true)
+			if host == "" {
+				continue
+			}
+			if domain := b.workload.service.DomainName; domain != "" && domain != host {
+				c.reportf(object, "host %q is not translated; %q already has the domain name %q", host, b.workload.name, domain)
+				continue
+			}
+			b.workload.service.DomainName = host
+		}
+	}
+	if spec.DefaultBackend != nil {
+		expose(*spec.DefaultBackend, "")
+	}
+	for _, rule := range spec.Rules {
+		if strings.HasPrefix(rule.Host, "*.") {
+			c.reportf(object, "wildcard host %q is not translated", rule.Host)
+			rule.Host = ""
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Path != "" && path.Path != "/" {
+				c.reportf(object, "path %q is not translated; all paths of the host go to the service", path.Path)
+			}
+			expose(path.Backend, rule.Host)
+		}
+	}
+	return nil
+}
+
+func (w *k8sWorkload) exposePort(target int, public bool) {
+	mode := "host"
+	if public {
+		mode = "ingress"
+	}
+	for i, port := range w.service.Ports {
+		if port.Target == target {
+			if public {
+				w.service.Ports[i].Mode = mode
+			}
+			return
+		}
+	}
+	w.service.Ports = append(w.service.Ports, composePort{Target: target, Mode: mode})
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertKubernetes(t *testing.T) {
+	testFiles, err := filepath.Glob("testdata/kubernetes/*.yaml")
+	require.NoError(t, err)
+	for _, path := range testFiles {
+		if strings.HasSuffix(path, ".compose.yaml") {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			manifests, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			conversion, err := ConvertKubernetes(manifests)
+			require.NoError(t, err)
+
+			base := strings.TrimSuffix(path, ".yaml")
+			require.NoError(t, pkg.Compare(conversion.Compose, base+".compose.yaml"))
+
+			var report strings.Builder
+			for _, name := range conversion.Config {
+				report.WriteString("config: " + name + "\n")
+			}
+			for _, line := range conversion.Report {
+				report.WriteString(line + "\n")
+			}
+			require.NoError(t, pkg.Compare([]byte(report.String()), base+".report.txt"))
+
+			// The conversion is deterministic
+			again, err := ConvertKubernetes(manifests)
+			require.NoError(t, err)
+			assert.Equal(t, conversion, again)
+
+			// The values of Secrets are never copied
+			assert.NotContains(t, string(conversion.Compose), "not-copied")
+			assert.NotContains(t, string(conversion.Compose), "c2tfbGl2ZV9zZWNyZXQ=")
+		})
+	}
+}
+
+func TestConvertKubernetesInvalid(t *testing.T) {
+	_, err := ConvertKubernetes([]byte("kind: Deployment\nspec: [unclosed\n"))
+	assert.ErrorContains(t, err, "failed to parse manifest document 1")
+}
+
+func TestReadKubernetesManifests(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "base"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base", "a.yaml"), []byte("kind: A"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("kind: B"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# not a manifest"), 0o644))
+
+	manifests, err := ReadKubernetesManifests([]string{dir, "-"}, strings.NewReader("kind: C"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind: B\n---\nkind: A\n---\nkind: C", string(manifests))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"runtime"
 	"slices"
 	"strings"
@@ -17,9 +18,9 @@ import (
 	"go.yaml.in/yaml/v4"
 )
 
-func InteractiveSetup(ctx context.Context, fabric client.FabricClient, surveyor surveyor.Surveyor, heroku HerokuClientInterface, sourcePlatform SourcePlatform) (string, error) {
+func InteractiveSetup(ctx context.Context, fabric client.FabricClient, surveyor surveyor.Surveyor, sources SourceClients, sourcePlatform SourcePlatform) (string, error) {
 	if sourcePlatform == "" {
-		err, selected := selectSourcePlatform(surveyor)
+		err, selected := selectSourcePlatform(surveyor, sources)
 		if err != nil {
 			return "", fmt.Errorf("failed to select source platform: %w", err)
 		}
@@ -28,73 +29,72 @@ func InteractiveSetup(ctx context.Context, fabric client.FabricClient, surveyor
 
 	term.Debugf("Selected source platform: %s", sourcePlatform)
 
-	var composeFileContents string
-	var err error
-	switch sourcePlatform {
-	case SourcePlatformHeroku:
-		composeFileContents, err = setupFromHeroku(ctx, fabric, surveyor, heroku)
-		if err != nil {
-			return "", fmt.Errorf("failed to setup from Heroku: %w", err)
-		}
-	default:
+	source, ok := sources[sourcePlatform]
+	if !ok {
 		return "", fmt.Errorf("unsupported source platform: %s", sourcePlatform)
 	}
 
+	composeFileContents, err := setupFromSource(ctx, fabric, surveyor, source, sourcePlatform)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup from %s: %w", sourcePlatform.Name(), err)
+	}
+
 	return composeFileContents, nil
 }
 
-func setupFromHeroku(ctx context.Context, fabric client.FabricClient, surveyor surveyor.Surveyor, herokuClient HerokuClientInterface) (string, error) {
-	token, err := getHerokuAuthToken()
-	if err != nil {
-		return "", fmt.Errorf("failed to get Heroku auth token: %w", err)
+func setupFromSource(ctx context.Context, fabric client.FabricClient, surveyor surveyor.Surveyor, source SourceClient, platform SourcePlatform) (string, error) {
+	if err := source.Authenticate(ctx, surveyor); err != nil {
+		return "", fmt.Errorf("failed to get %s auth token: %w", platform.Name(), err)
 	}
-	herokuClient.SetToken(token)
-	apps, err := herokuClient.ListApps(ctx)
+	appNames, err := source.ListApps(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to list Heroku apps: %w", err)
+		return "", fmt.Errorf("failed to list %s apps: %w", platform.Name(), err)
 	}
 
-	// Here you can add logic to process the retrieved apps and set up the project accordingly
-	// For now, we just print the apps
-	term.Debugf("Your Heroku applications: %+v\n", apps)
-
-	appNames := make([]string, len(apps))
-	for i, app := range apps {
-		appNames[i] = app.Name
-	}
+	term.Debugf("Your %s applications: %+v\n", platform.Name(), appNames)
 
-	sourceApp, err := selectSourceApplication(surveyor, appNames)
+	sourceApp, err := selectSourceApplication(surveyor, platform, appNames)
 	if err != nil {
 		return "", fmt.Errorf("failed to select source application: %w", err)
 	}
 
 	term.Infof("Collecting information about %q...", sourceApp)
 
-	applicationInfo, err := collectHerokuApplicationInfo(ctx, herokuClient, sourceApp)
+	applicationInfo, err := source.CollectAppInfo(ctx, sourceApp)
 	if err != nil {
-		return "", fmt.Errorf("failed to collect Heroku application info: %w", err)
+		return "", fmt.Errorf("failed to collect %s application info: %w", platform.Name(), err)
 	}
 
 	term.Debugf("Application info: %+v\n", applicationInfo)
 
-	sanitizedApplicationInfo, err := sanitizeHerokuApplicationInfo(applicationInfo)
+	sanitizedApplicationInfo, err := source.Sanitize(applicationInfo)
 	if err != nil {
-		return "", fmt.Errorf("failed to sanitize Heroku application info: %w", err)
+		return "", fmt.Errorf("failed to sanitize %s application info: %w", platform.Name(), err)
 	}
 
 	term.Debugf("Sanitized application info: %+v\n", sanitizedApplicationInfo)
 
 	term.Info("Generating compose file...")
 
-	composeFileContents, err := generateComposeFile(ctx, fabric, defangv1.SourcePlatform_SOURCE_PLATFORM_HEROKU, sourceApp, sanitizedApplicationInfo)
+	var composeFileContents string
+	switch info := sanitizedApplicationInfo.(type) {
+	case AppInfo:
+		composeFileContents, err = composeFromAppInfo(ctx, info)
+		if err == nil {
+			printConfigInstructions(info)
+		}
+	default:
+		composeFileContents, err = generateComposeFile(ctx, fabric, platform.fabricPlatform(), sourceApp, info)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to generate compose file from Heroku info: %w", err)
+		return "", fmt.Errorf("failed to generate compose file from %s info: %w", platform.Name(), err)
 	}
 
 	return composeFileContents, nil
 }
 
 func sanitizeHerokuApplicationInfo(info HerokuApplicationInfo) (interface{}, error) {
+	info.ConfigVars = maps.Clone(info.ConfigVars) // the collected values are used by the post-generation steps
 	for key, value := range info.ConfigVars {
 		// Redact sensitive information in config vars
 		isSecret, _, err := compose.IsSecret(key, value)
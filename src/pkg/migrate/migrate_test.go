@@ -31,6 +31,14 @@ func (m *MockSurveyor) AskOne(prompt survey.Prompt, response interface{}, opts .
 			if val, ok := m.responses[m.callIndex].(string); ok {
 				*r = val
 			}
+		case *bool:
+			if val, ok := m.responses[m.callIndex].(bool); ok {
+				*r = val
+			}
+		case *[]string:
+			if val, ok := m.responses[m.callIndex].([]string); ok {
+				*r = val
+			}
 		}
 		m.callIndex++
 	}
@@ -122,6 +130,15 @@ func (m *MockHerokuClient) GetReleaseTasks(ctx context.Context, appName string)
 	return releaseTasks, args.Error(1)
 }
 
+func (m *MockHerokuClient) ListSchedulerJobs(ctx context.Context, appName string) ([]HerokuSchedulerJob, error) {
+	args := m.Called(ctx, appName)
+	jobs, ok := args.Get(0).([]HerokuSchedulerJob)
+	if !ok {
+		return nil, errors.New("failed to cast to []HerokuSchedulerJob")
+	}
+	return jobs, args.Error(1)
+}
+
 func (m *MockHerokuClient) SetToken(token string) {
 	m.Called(token)
 }
@@ -352,7 +369,7 @@ func TestInteractiveSetup(t *testing.T) {
 
 			// Execute the function under test
 			ctx := t.Context()
-			composeFileContents, err := InteractiveSetup(ctx, mockFabricClient, mockSurveyor, mockHerokuClient, tt.sourcePlatform)
+			composeFileContents, err := InteractiveSetup(ctx, mockFabricClient, mockSurveyor, SourceClients{SourcePlatformHeroku: NewHerokuSource(mockHerokuClient)}, tt.sourcePlatform)
 
 			// Assertions
 			if tt.expectError {
@@ -6,6 +6,7 @@ import (
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/DefangLabs/defang/src/pkg/surveyor"
 	"github.com/DefangLabs/defang/src/pkg/term"
+	defangv1 "github.com/DefangLabs/defang/src/protos/io/defang/v1"
 )
 
 type SourcePlatform string
@@ -33,24 +34,71 @@ func (sp *SourcePlatform) Type() string {
 const (
 	SourcePlatformUnspecified SourcePlatform = ""
 	SourcePlatformHeroku      SourcePlatform = "heroku"
+	SourcePlatformFlyio       SourcePlatform = "flyio"
+	SourcePlatformRender      SourcePlatform = "render"
+	SourcePlatformRailway     SourcePlatform = "railway"
+	// SourcePlatformKubernetes is converted from manifests, not by InteractiveSetup
+	SourcePlatformKubernetes SourcePlatform = "kubernetes"
 )
 
 var AllSourcePlatforms = []SourcePlatform{
 	SourcePlatformHeroku,
+	SourcePlatformFlyio,
+	SourcePlatformRender,
+	SourcePlatformRailway,
 }
 
 func ParseSourcePlatform(input string) (SourcePlatform, error) {
 	switch input {
 	case string(SourcePlatformHeroku):
 		return SourcePlatformHeroku, nil
+	case string(SourcePlatformFlyio), "fly", "fly.io":
+		return SourcePlatformFlyio, nil
+	case string(SourcePlatformRender):
+		return SourcePlatformRender, nil
+	case string(SourcePlatformRailway):
+		return SourcePlatformRailway, nil
+	case string(SourcePlatformKubernetes), "k8s", "helm":
+		return SourcePlatformKubernetes, nil
 	default:
 		return "", fmt.Errorf("unknown source platform: %s", input)
 	}
 }
 
-func selectSourcePlatform(surveyor surveyor.Surveyor) (error, SourcePlatform) {
-	options := []string{
-		string(SourcePlatformHeroku),
+// Name returns the display name of the platform.
+func (sp SourcePlatform) Name() string {
+	switch sp {
+	case SourcePlatformHeroku:
+		return "Heroku"
+	case SourcePlatformFlyio:
+		return "Fly.io"
+	case SourcePlatformRender:
+		return "Render"
+	case SourcePlatformRailway:
+		return "Railway"
+	case SourcePlatformKubernetes:
+		return "Kubernetes"
+	default:
+		return string(sp)
+	}
+}
+
+// fabricPlatform returns the platform for the compose generation by the Fabric.
+func (sp SourcePlatform) fabricPlatform() defangv1.SourcePlatform {
+	switch sp {
+	case SourcePlatformHeroku:
+		return defangv1.SourcePlatform_SOURCE_PLATFORM_HEROKU
+	default:
+		return defangv1.SourcePlatform_SOURCE_PLATFORM_UNSPECIFIED
+	}
+}
+
+func selectSourcePlatform(surveyor surveyor.Surveyor, sources SourceClients) (error, SourcePlatform) {
+	var options []string
+	for _, platform := range AllSourcePlatforms {
+		if _, ok := sources[platform]; ok {
+			options = append(options, string(platform))
+		}
 	}
 
 	var selectedOption string
@@ -0,0 +1,314 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	ourHttp "github.com/DefangLabs/defang/src/pkg/http"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+// RailwayClient collects application info from the Railway GraphQL API. An
+// application is a Railway project; its production environment is migrated.
+type RailwayClient struct {
+	Token      string
+	HTTPClient *http.Client
+	URL        string
+}
+
+func NewRailwayClient() *RailwayClient {
+	return &RailwayClient{
+		HTTPClient: ourHttp.DefaultClient,
+		URL:        "https://backboard.railway.com/graphql/v2",
+	}
+}
+
+type railwayEdges[T any] struct {
+	Edges []struct {
+		Node T `json:"node"`
+	} `json:"edges"`
+}
+
+func (e railwayEdges[T]) nodes() []T {
+	nodes := make([]T, len(e.Edges))
+	for i, edge := range e.Edges {
+		nodes[i] = edge.Node
+	}
+	return nodes
+}
+
+type RailwayProject struct {
+	ID           string                              `json:"id"`
+	Name         string                              `json:"name"`
+	Environments railwayEdges[RailwayEnvironment]    `json:"environments"`
+	Services     railwayEdges[RailwayProjectService] `json:"services"`
+}
+
+type RailwayEnvironment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type RailwayProjectService struct {
+	ID               string                               `json:"id"`
+	Name             string                               `json:"name"`
+	ServiceInstances railwayEdges[RailwayServiceInstance] `json:"serviceInstances"`
+}
+
+type RailwayServiceInstance struct {
+	EnvironmentID      string `json:"environmentId"`
+	StartCommand       string `json:"startCommand"`
+	HealthcheckPath    string `json:"healthcheckPath"`
+	HealthcheckTimeout int    `json:"healthcheckTimeout"`
+	NumReplicas        int    `json:"numReplicas"`
+	Source             struct {
+		Image string `json:"image"`
+		Repo  string `json:"repo"`
+	} `json:"source"`
+	Domains struct {
+		ServiceDomains []struct {
+			Domain     string `json:"domain"`
+			TargetPort int    `json:"targetPort"`
+		} `json:"serviceDomains"`
+	} `json:"domains"`
+}
+
+const railwayProjectsQuery = `query projects {
+  projects {
+    edges { node { id name } }
+  }
+}`
+
+const railwayProjectQuery = `query project($id: String!) {
+  project(id: $id) {
+    id
+    name
+    environments { edges { node { id name } } }
+    services {
+      edges {
+        node {
+          id
+          name
+          serviceInstances {
+            edges {
+              node {
+                environmentId
+                startCommand
+                healthcheckPath
+                healthcheckTimeout
+                numReplicas
+                source { image repo }
+                domains { serviceDomains { domain targetPort } }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const railwayVariablesQuery = `query variables($projectId: String!, $environmentId: String!, $serviceId: String) {
+  variables(projectId: $projectId, environmentId: $environmentId, serviceId: $serviceId)
+}`
+
+func (r *RailwayClient) Authenticate(ctx context.Context, surveyor surveyor.Surveyor) error {
+	token, err := getAuthToken(surveyor, SourcePlatformRailway, "Visit https://railway.com/account/tokens", "RAILWAY_API_TOKEN", "RAILWAY_TOKEN")
+	if err != nil {
+		return err
+	}
+	r.Token = token
+	return nil
+}
+
+// railwayQuery runs a GraphQL query and decodes its data into a value of type T.
+func railwayQuery[T any](ctx context.Context, r *RailwayClient, query string, variables map[string]any) (T, error) {
+	resp, err := apiRequest[struct {
+		Data   T `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}](ctx, r.HTTPClient, http.MethodPost, r.URL, r.Token, map[string]any{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return resp.Data, err
+	}
+	if len(resp.Errors) > 0 {
+		var errs []error
+		for _, e := range resp.Errors {
+			errs = append(errs, errors.New(e.Message))
+		}
+		return resp.Data, errors.Join(errs...)
+	}
+	return resp.Data, nil
+}
+
+func (r *RailwayClient) ListProjects(ctx context.Context) ([]RailwayProject, error) {
+	data, err := railwayQuery[struct {
+		Projects railwayEdges[RailwayProject] `json:"projects"`
+	}](ctx, r, railwayProjectsQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	return data.Projects.nodes(), nil
+}
+
+func (r *RailwayClient) GetProject(ctx context.Context, projectID string) (RailwayProject, error) {
+	data, err := railwayQuery[struct {
+		Project RailwayProject `json:"project"`
+	}](ctx, r, railwayProjectQuery, map[string]any{"id": projectID})
+	return data.Project, err
+}
+
+func (r *RailwayClient) GetVariables(ctx context.Context, projectID, environmentID, serviceID string) (map[string]string, error) {
+	data, err := railwayQuery[struct {
+		Variables map[string]string `json:"variables"`
+	}](ctx, r, railwayVariablesQuery, map[string]any{
+		"projectId":     projectID,
+		"environmentId": environmentID,
+		"serviceId":     serviceID,
+	})
+	return data.Variables, err
+}
+
+func (r *RailwayClient) ListApps(ctx context.Context) ([]string, error) {
+	projects, err := r.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appNames := make([]string, len(projects))
+	for i, project := range projects {
+		appNames[i] = project.Name
+	}
+	return appNames, nil
+}
+
+func (r *RailwayClient) CollectAppInfo(ctx context.Context, appName string) (any, error) {
+	projects, err := r.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	i := slices.IndexFunc(projects, func(p RailwayProject) bool { return p.Name == appName })
+	if i < 0 {
+		return nil, fmt.Errorf("project %q not found", appName)
+	}
+
+	term.Info("Identifying deployed services")
+	project, err := r.GetProject(ctx, projects[i].ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	environment, err := railwayEnvironment(project)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make(map[string]map[string]string)
+	for _, service := range project.Services.nodes() {
+		vars, err := r.GetVariables(ctx, project.ID, environment.ID, service.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variables of service %s: %w", service.Name, err)
+		}
+		variables[service.ID] = vars
+	}
+	return railwayAppInfo(project, environment, variables), nil
+}
+
+func (r *RailwayClient) Sanitize(info any) (any, error) {
+	return sanitizeAppInfo(info)
+}
+
+// railwayEnvironment returns the production environment, or else the first.
+func railwayEnvironment(project RailwayProject) (RailwayEnvironment, error) {
+	environments := project.Environments.nodes()
+	if len(environments) == 0 {
+		return RailwayEnvironment{}, fmt.Errorf("project %q has no environments", project.Name)
+	}
+	for _, environment := range environments {
+		if environment.Name == "production" {
+			return environment, nil
+		}
+	}
+	term.Warnf("Project %q has no production environment; migrating environment %q", project.Name, environments[0].Name)
+	return environments[0], nil
+}
+
+// railwayDatabase reports whether the image is one of the Railway templates
+// for Postgres or Redis, like ghcr.io/railwayapp-templates/postgres-ssl.
+func railwayDatabase(image string) (postgres, redis bool) {
+	if image == "" {
+		return false, false
+	}
+	repo := strings.TrimSuffix(compose.GetImageRepo(image), "-ssl")
+	return compose.IsPostgresRepo(repo), compose.IsRedisRepo(repo)
+}
+
+func railwayAppInfo(project RailwayProject, environment RailwayEnvironment, variables map[string]map[string]string) AppInfo {
+	info := AppInfo{Name: project.Name, ConfigVars: make(map[string]string)}
+
+	for _, rs := range project.Services.nodes() {
+		var instance *RailwayServiceInstance
+		for _, si := range rs.ServiceInstances.nodes() {
+			if si.EnvironmentID == environment.ID {
+				instance = &si
+				break
+			}
+		}
+		if instance == nil {
+			term.Debugf("Service %q is not deployed to environment %q", rs.Name, environment.Name)
+			continue
+		}
+
+		// The variables of the databases are generated; they become the managed services
+		if postgres, redis := railwayDatabase(instance.Source.Image); postgres || redis {
+			if postgres {
+				info.Postgres = append(info.Postgres, rs.Name)
+			} else {
+				info.Redis = append(info.Redis, rs.Name)
+			}
+			continue
+		}
+
+		service := ServiceInfo{
+			Name:     rs.Name,
+			Image:    instance.Source.Image,
+			Command:  instance.StartCommand,
+			Replicas: instance.NumReplicas,
+		}
+		vars := variables[rs.ID]
+		for key, value := range vars {
+			if strings.HasPrefix(key, "RAILWAY_") {
+				continue // set by Railway itself
+			}
+			service.Env = append(service.Env, key)
+			info.ConfigVars[key] = value
+		}
+		for _, domain := range instance.Domains.ServiceDomains {
+			service.Public = true
+			service.Port = domain.TargetPort
+		}
+		if service.Port == 0 {
+			if port, err := strconv.Atoi(vars["PORT"]); err == nil {
+				service.Port = port
+			}
+		}
+		if instance.HealthcheckPath != "" && service.Port > 0 {
+			service.HealthCheck = &HealthCheck{
+				Path:    instance.HealthcheckPath,
+				Timeout: time.Duration(instance.HealthcheckTimeout) * time.Second,
+			}
+		}
+		info.Services = append(info.Services, service)
+	}
+	return info
+}
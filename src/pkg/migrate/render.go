@@ -0,0 +1,367 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	ourHttp "github.com/DefangLabs/defang/src/pkg/http"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"go.yaml.in/yaml/v4"
+)
+
+// RenderClient collects application info from the Render API, and from the
+// render.yaml blueprint in the working directory. An application is a Render
+// project, or a service that is not part of any project.
+type RenderClient struct {
+	Token      string
+	HTTPClient *http.Client
+	BaseURL    string
+	Dir        string
+}
+
+func NewRenderClient() *RenderClient {
+	return &RenderClient{
+		HTTPClient: ourHttp.DefaultClient,
+		BaseURL:    "https://api.render.com/v1",
+		Dir:        ".",
+	}
+}
+
+type RenderProject struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	EnvironmentIDs []string `json:"environmentIds"`
+}
+
+type RenderService struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	EnvironmentID string `json:"environmentId"`
+	Image         *struct {
+		ImagePath string `json:"imagePath"`
+	} `json:"image"`
+	ServiceDetails struct {
+		Runtime            string `json:"runtime"`
+		HealthCheckPath    string `json:"healthCheckPath"`
+		NumInstances       int    `json:"numInstances"`
+		Plan               string `json:"plan"`
+		Schedule           string `json:"schedule"`
+		EnvSpecificDetails struct {
+			StartCommand   string `json:"startCommand"`
+			DockerCommand  string `json:"dockerCommand"`
+			DockerfilePath string `json:"dockerfilePath"`
+		} `json:"envSpecificDetails"`
+	} `json:"serviceDetails"`
+}
+
+type RenderDatastore struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	EnvironmentID string `json:"environmentId"`
+}
+
+type RenderEnvVar struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// renderBlueprint is the subset of render.yaml that matters for the migration.
+type renderBlueprint struct {
+	Services []struct {
+		Type            string `yaml:"type"`
+		Name            string `yaml:"name"`
+		StartCommand    string `yaml:"startCommand"`
+		DockerCommand   string `yaml:"dockerCommand"`
+		DockerfilePath  string `yaml:"dockerfilePath"`
+		HealthCheckPath string `yaml:"healthCheckPath"`
+		EnvVars         []struct {
+			Key          string `yaml:"key"`
+			FromDatabase *struct {
+				Name string `yaml:"name"`
+			} `yaml:"fromDatabase"`
+			FromService *struct {
+				Type string `yaml:"type"`
+				Name string `yaml:"name"`
+			} `yaml:"fromService"`
+		} `yaml:"envVars"`
+	} `yaml:"services"`
+}
+
+// renderPlans maps the instance types of Render to CPUs and memory in MB.
+var renderPlans = map[string]struct {
+	CPUs     float64
+	MemoryMB int
+}{
+	"free":     {0.1, 512},
+	"starter":  {0.5, 512},
+	"standard": {1, 2048},
+	"pro":      {2, 4096},
+	"pro_plus": {4, 8192},
+	"pro_max":  {4, 16384},
+}
+
+// renderDefaultPort is the port Render expects web services to listen on,
+// unless PORT is set.
+const renderDefaultPort = 10000
+
+func (r *RenderClient) Authenticate(ctx context.Context, surveyor surveyor.Surveyor) error {
+	token, err := getAuthToken(surveyor, SourcePlatformRender, "Visit https://dashboard.render.com/u/settings#api-keys", "RENDER_API_KEY")
+	if err != nil {
+		return err
+	}
+	r.Token = token
+	return nil
+}
+
+// listAll gets the items of a paginated list of the Render API; each item is
+// wrapped in an object with a cursor.
+func listAll[T any](ctx context.Context, r *RenderClient, path, key string) ([]T, error) {
+	var items []T
+	cursor := ""
+	for {
+		query := url.Values{"limit": {"100"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		page, err := apiRequest[[]map[string]any](ctx, r.HTTPClient, http.MethodGet, r.BaseURL+path+"?"+query.Encode(), r.Token, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range page {
+			var item T
+			if err := remarshal(entry[key], &item); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s: %w", key, err)
+			}
+			items = append(items, item)
+			cursor, _ = entry["cursor"].(string)
+		}
+		if len(page) < 100 || cursor == "" {
+			return items, nil
+		}
+	}
+}
+
+func (r *RenderClient) ListProjects(ctx context.Context) ([]RenderProject, error) {
+	return listAll[RenderProject](ctx, r, "/projects", "project")
+}
+
+func (r *RenderClient) ListServices(ctx context.Context) ([]RenderService, error) {
+	return listAll[RenderService](ctx, r, "/services", "service")
+}
+
+func (r *RenderClient) ListPostgres(ctx context.Context) ([]RenderDatastore, error) {
+	return listAll[RenderDatastore](ctx, r, "/postgres", "postgres")
+}
+
+func (r *RenderClient) ListKeyValue(ctx context.Context) ([]RenderDatastore, error) {
+	return listAll[RenderDatastore](ctx, r, "/key-value", "keyValue")
+}
+
+func (r *RenderClient) ListEnvVars(ctx context.Context, serviceID string) ([]RenderEnvVar, error) {
+	return listAll[RenderEnvVar](ctx, r, "/services/"+url.PathEscape(serviceID)+"/env-vars", "envVar")
+}
+
+func (r *RenderClient) ListApps(ctx context.Context) ([]string, error) {
+	projects, err := r.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	services, err := r.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var appNames []string
+	for _, project := range projects {
+		appNames = append(appNames, project.Name)
+	}
+	for _, service := range services {
+		if service.EnvironmentID == "" {
+			appNames = append(appNames, service.Name)
+		}
+	}
+	return appNames, nil
+}
+
+func (r *RenderClient) CollectAppInfo(ctx context.Context, appName string) (any, error) {
+	projects, err := r.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	// belongs reports whether a resource is part of the application
+	belongs := func(name, environmentID string) bool {
+		return environmentID == "" && name == appName
+	}
+	if i := slices.IndexFunc(projects, func(p RenderProject) bool { return p.Name == appName }); i >= 0 {
+		belongs = func(_, environmentID string) bool {
+			return slices.Contains(projects[i].EnvironmentIDs, environmentID)
+		}
+	}
+
+	term.Info("Identifying deployed services")
+	allServices, err := r.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	var services []RenderService
+	envVars := make(map[string][]RenderEnvVar)
+	for _, service := range allServices {
+		if !belongs(service.Name, service.EnvironmentID) {
+			continue
+		}
+		services = append(services, service)
+		vars, err := r.ListEnvVars(ctx, service.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list env vars of service %s: %w", service.Name, err)
+		}
+		envVars[service.ID] = vars
+	}
+
+	term.Info("Identifying managed datastores")
+	var postgres, redis []string
+	databases, err := r.ListPostgres(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Postgres databases: %w", err)
+	}
+	for _, db := range databases {
+		if belongs(db.Name, db.EnvironmentID) {
+			postgres = append(postgres, db.Name)
+		}
+	}
+	keyValues, err := r.ListKeyValue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Key Value instances: %w", err)
+	}
+	for _, kv := range keyValues {
+		if belongs(kv.Name, kv.EnvironmentID) {
+			redis = append(redis, kv.Name)
+		}
+	}
+
+	blueprint, err := readRenderBlueprint(r.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return renderAppInfo(appName, services, envVars, postgres, redis, blueprint), nil
+}
+
+func (r *RenderClient) Sanitize(info any) (any, error) {
+	return sanitizeAppInfo(info)
+}
+
+// readRenderBlueprint reads the render.yaml in the directory, if there is one.
+func readRenderBlueprint(dir string) (*renderBlueprint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "render.yaml"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var blueprint renderBlueprint
+	if err := yaml.Unmarshal(data, &blueprint); err != nil {
+		return nil, fmt.Errorf("failed to parse render.yaml: %w", err)
+	}
+	return &blueprint, nil
+}
+
+func renderAppInfo(appName string, services []RenderService, envVars map[string][]RenderEnvVar, postgres, redis []string, blueprint *renderBlueprint) AppInfo {
+	info := AppInfo{Name: appName, ConfigVars: make(map[string]string)}
+	usedPostgres := make(map[string]bool)
+	usedRedis := make(map[string]bool)
+
+	for _, rs := range services {
+		details := rs.ServiceDetails
+		service := ServiceInfo{
+			Name:       rs.Name,
+			Command:    details.EnvSpecificDetails.StartCommand,
+			Dockerfile: strings.TrimPrefix(details.EnvSpecificDetails.DockerfilePath, "./"),
+			Replicas:   details.NumInstances,
+		}
+		if details.EnvSpecificDetails.DockerCommand != "" {
+			service.Command = details.EnvSpecificDetails.DockerCommand
+		}
+		if rs.Image != nil {
+			service.Image = rs.Image.ImagePath
+		}
+		if plan, ok := renderPlans[details.Plan]; ok {
+			service.CPUs, service.MemoryMB = plan.CPUs, plan.MemoryMB
+		}
+
+		for _, envVar := range envVars[rs.ID] {
+			service.Env = append(service.Env, envVar.Key)
+			info.ConfigVars[envVar.Key] = envVar.Value
+		}
+
+		switch rs.Type {
+		case "web_service", "private_service":
+			service.Public = rs.Type == "web_service"
+			service.Port = renderDefaultPort
+			if port, err := strconv.Atoi(info.ConfigVars["PORT"]); err == nil && slices.Contains(service.Env, "PORT") {
+				service.Port = port
+			}
+		case "cron_job":
+			term.Warnf("Service %q is a cron job (%s); the schedule is not migrated", rs.Name, details.Schedule)
+		}
+
+		healthCheckPath := details.HealthCheckPath
+		if blueprint != nil {
+			for _, bs := range blueprint.Services {
+				if bs.Name != rs.Name {
+					continue
+				}
+				if healthCheckPath == "" {
+					healthCheckPath = bs.HealthCheckPath
+				}
+				if service.Command == "" {
+					service.Command = bs.StartCommand + bs.DockerCommand
+				}
+				for _, envVar := range bs.EnvVars {
+					if envVar.FromDatabase != nil {
+						usedPostgres[envVar.FromDatabase.Name] = true
+					}
+					if envVar.FromService != nil && (envVar.FromService.Type == "redis" || envVar.FromService.Type == "keyvalue") {
+						usedRedis[envVar.FromService.Name] = true
+					}
+					if envVar.Key != "" && !slices.Contains(service.Env, envVar.Key) {
+						service.Env = append(service.Env, envVar.Key)
+					}
+				}
+			}
+		}
+		if healthCheckPath != "" && service.Port > 0 {
+			service.HealthCheck = &HealthCheck{Path: healthCheckPath}
+		}
+		info.Services = append(info.Services, service)
+	}
+
+	// Databases referenced by the blueprint belong to the application too
+	for name := range usedPostgres {
+		if !slices.Contains(postgres, name) {
+			postgres = append(postgres, name)
+		}
+	}
+	for name := range usedRedis {
+		if !slices.Contains(redis, name) {
+			redis = append(redis, name)
+		}
+	}
+	if len(postgres) == 0 && len(redis) == 0 {
+		// Services outside of a project only refer to datastores by URL
+		postgres, redis = managedServicesFromEnv(slices.Sorted(maps.Keys(info.ConfigVars)))
+	}
+	slices.Sort(postgres)
+	slices.Sort(redis)
+	info.Postgres, info.Redis = postgres, redis
+	return info
+}
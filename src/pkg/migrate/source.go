@@ -0,0 +1,406 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/surveyor"
+	"github.com/DefangLabs/defang/src/pkg/term"
+	"go.yaml.in/yaml/v4"
+)
+
+// SourceClient collects information about an application deployed on another
+// platform, from which a compose file can be generated.
+type SourceClient interface {
+	// Authenticate obtains a token for the API of the platform.
+	Authenticate(ctx context.Context, surveyor surveyor.Surveyor) error
+	ListApps(ctx context.Context) ([]string, error)
+	CollectAppInfo(ctx context.Context, appName string) (any, error)
+	// Sanitize redacts the secrets from the collected information.
+	Sanitize(info any) (any, error)
+}
+
+// SourceClients holds the client for each supported source platform.
+type SourceClients map[SourcePlatform]SourceClient
+
+func DefaultSourceClients() SourceClients {
+	return SourceClients{
+		SourcePlatformHeroku:  NewHerokuSource(NewHerokuClient()),
+		SourcePlatformFlyio:   NewFlyioClient(),
+		SourcePlatformRender:  NewRenderClient(),
+		SourcePlatformRailway: NewRailwayClient(),
+	}
+}
+
+const redacted = "REDACTED"
+
+// AppInfo is a platform-neutral description of an application, which is
+// mapped to a compose file without the help of the Defang Fabric.
+type AppInfo struct {
+	Name       string            `json:"name"`
+	Services   []ServiceInfo     `json:"services"`
+	Postgres   []string          `json:"postgres,omitempty"`
+	Redis      []string          `json:"redis,omitempty"`
+	ConfigVars map[string]string `json:"config_vars,omitempty"`
+}
+
+type ServiceInfo struct {
+	Name        string       `json:"name"`
+	Image       string       `json:"image,omitempty"`
+	Dockerfile  string       `json:"dockerfile,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	Port        int          `json:"port,omitempty"`
+	Public      bool         `json:"public,omitempty"`
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	Replicas    int          `json:"replicas,omitempty"`
+	CPUs        float64      `json:"cpus,omitempty"`
+	MemoryMB    int          `json:"memory_mb,omitempty"`
+	// Env lists the names of the environment variables of the service; the
+	// values are in the ConfigVars of the application.
+	Env []string `json:"env,omitempty"`
+}
+
+type HealthCheck struct {
+	Path     string        `json:"path,omitempty"`
+	Port     int           `json:"port,omitempty"`
+	Interval time.Duration `json:"interval,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
+func sanitizeAppInfo(info any) (any, error) {
+	appInfo, ok := info.(AppInfo)
+	if !ok {
+		return nil, fmt.Errorf("unexpected application info type %T", info)
+	}
+	configVars := make(map[string]string, len(appInfo.ConfigVars))
+	for key, value := range appInfo.ConfigVars {
+		isSecret, _, err := compose.IsSecret(key, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if config var %q is a secret: %w", key, err)
+		}
+		if isSecret {
+			value = redacted
+		}
+		configVars[key] = value
+	}
+	appInfo.ConfigVars = configVars
+	return appInfo, nil
+}
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image           string              `yaml:"image,omitempty"`
+	Build           *composeBuild       `yaml:"build,omitempty"`
+	Entrypoint      []string            `yaml:"entrypoint,omitempty"`
+	Command         any                 `yaml:"command,omitempty"` // string or []string
+	DomainName      string              `yaml:"domainname,omitempty"`
+	Ports           []composePort       `yaml:"ports,omitempty"`
+	Environment     []string            `yaml:"environment,omitempty"`
+	HealthCheck     *composeHealthCheck `yaml:"healthcheck,omitempty"`
+	Deploy          *composeDeploy      `yaml:"deploy,omitempty"`
+	XDefangPostgres bool                `yaml:"x-defang-postgres,omitempty"`
+	XDefangRedis    bool                `yaml:"x-defang-redis,omitempty"`
+}
+
+type composeBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile,omitempty"`
+}
+
+type composePort struct {
+	Target int    `yaml:"target"`
+	Mode   string `yaml:"mode"`
+}
+
+type composeHealthCheck struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+}
+
+type composeDeploy struct {
+	Replicas  int               `yaml:"replicas,omitempty"`
+	Resources *composeResources `yaml:"resources,omitempty"`
+}
+
+type composeResources struct {
+	Reservations *composeReservations `yaml:"reservations,omitempty"`
+	Limits       *composeReservations `yaml:"limits,omitempty"`
+}
+
+type composeReservations struct {
+	CPUs   string `yaml:"cpus,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// composeFromAppInfo maps the application to a compose file. The environment
+// variables are not inlined; each is a config variable to set with
+// `defang config set`.
+func composeFromAppInfo(ctx context.Context, info AppInfo) (string, error) {
+	project := composeFile{Services: make(map[string]composeService)}
+	managedURLs := managedServiceURLs(info)
+	for _, service := range info.Services {
+		cs := composeService{
+			Image: service.Image,
+		}
+		for _, name := range slices.Sorted(slices.Values(service.Env)) {
+			if url, ok := managedURLs[name]; ok {
+				name += "=" + url
+			}
+			cs.Environment = append(cs.Environment, name)
+		}
+		if service.Command != "" {
+			cs.Command = service.Command
+		}
+		if service.Image == "" {
+			cs.Build = &composeBuild{Context: ".", Dockerfile: service.Dockerfile}
+		}
+		if service.Port > 0 {
+			mode := "host"
+			if service.Public {
+				mode = "ingress"
+			}
+			cs.Ports = []composePort{{Target: service.Port, Mode: mode}}
+		}
+		if hc := service.HealthCheck; hc != nil {
+			port := hc.Port
+			if port == 0 {
+				port = service.Port
+			}
+			cs.HealthCheck = &composeHealthCheck{
+				Test:     []string{"CMD", "curl", "-f", fmt.Sprintf("http://localhost:%d%s", port, hc.Path)},
+				Interval: formatDuration(hc.Interval),
+				Timeout:  formatDuration(hc.Timeout),
+			}
+		}
+		if service.Replicas > 1 || service.CPUs > 0 || service.MemoryMB > 0 {
+			cs.Deploy = &composeDeploy{Replicas: service.Replicas}
+			if service.CPUs > 0 || service.MemoryMB > 0 {
+				cs.Deploy.Resources = &composeResources{Reservations: &composeReservations{}}
+				if service.CPUs > 0 {
+					cs.Deploy.Resources.Reservations.CPUs = strconv.FormatFloat(service.CPUs, 'f', -1, 64)
+				}
+				if service.MemoryMB > 0 {
+					cs.Deploy.Resources.Reservations.Memory = fmt.Sprintf("%dM", service.MemoryMB)
+				}
+			}
+		}
+		project.Services[composeServiceName(service.Name)] = cs
+	}
+	for _, name := range info.Postgres {
+		project.Services[composeServiceName(name)] = composeService{
+			Image:           "postgres:16",
+			Ports:           []composePort{{Target: 5432, Mode: "host"}},
+			Environment:     []string{"POSTGRES_PASSWORD"},
+			XDefangPostgres: true,
+		}
+	}
+	for _, name := range info.Redis {
+		project.Services[composeServiceName(name)] = composeService{
+			Image:        "redis:7",
+			Ports:        []composePort{{Target: 6379, Mode: "host"}},
+			XDefangRedis: true,
+		}
+	}
+
+	data, err := yaml.Marshal(project)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal compose file: %w", err)
+	}
+	if _, err := compose.LoadFromContentWithInterpolation(ctx, data, composeServiceName(info.Name)); err != nil {
+		return "", fmt.Errorf("invalid compose file generated: %w", err)
+	}
+	return string(data), nil
+}
+
+// postgresURL is the connection string of a managed Postgres service.
+func postgresURL(service string) string {
+	return fmt.Sprintf("postgres://postgres:${POSTGRES_PASSWORD}@%s:5432/postgres", service)
+}
+
+// redisURL is the connection string of a managed Redis service.
+func redisURL(service string) string {
+	return fmt.Sprintf("redis://%s:6379", service)
+}
+
+// managedServiceURLs returns the environment variables that point at the
+// managed services of the compose file, instead of at the databases on the
+// source platform.
+func managedServiceURLs(info AppInfo) map[string]string {
+	urls := make(map[string]string)
+	if len(info.Postgres) > 0 {
+		urls["DATABASE_URL"] = postgresURL(composeServiceName(info.Postgres[0]))
+	}
+	if len(info.Redis) > 0 {
+		urls["REDIS_URL"] = redisURL(composeServiceName(info.Redis[0]))
+	}
+	return urls
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// composeServiceName turns a name into a valid compose service name.
+func composeServiceName(name string) string {
+	name = strings.ToLower(name)
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-_")
+}
+
+// printConfigInstructions tells the user which config variables to set before
+// deploying; the values of secrets are never printed.
+func printConfigInstructions(info AppInfo) {
+	managedURLs := managedServiceURLs(info)
+	names := make(map[string]bool)
+	for _, service := range info.Services {
+		for _, name := range service.Env {
+			if _, ok := managedURLs[name]; !ok {
+				names[name] = true
+			}
+		}
+	}
+	if len(info.Postgres) > 0 {
+		names["POSTGRES_PASSWORD"] = true
+	}
+	if len(names) == 0 {
+		return
+	}
+	term.Info("Set the config variables of the application before deploying:")
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if value, ok := info.ConfigVars[name]; ok && value != redacted && value != "" {
+			term.Printf("  defang config set %s=%s\n", name, value)
+		} else {
+			term.Printf("  defang config set %s\n", name)
+		}
+	}
+}
+
+// getAuthToken gets an API token from the first of the environment variables
+// that is set, or else prompts for it.
+func getAuthToken(surveyor surveyor.Surveyor, platform SourcePlatform, help string, envVars ...string) (string, error) {
+	for _, envVar := range envVars {
+		if token := os.Getenv(envVar); token != "" {
+			term.Debugf("Using %s environment variable", envVar)
+			return token, nil
+		}
+	}
+
+	term.Debugf("Prompting for %s auth token", platform.Name())
+	var token string
+	for token == "" {
+		err := surveyor.AskOne(&survey.Password{
+			Message: fmt.Sprintf("Please paste a %s API token, so Defang can collect information about your applications", platform.Name()),
+			Help:    help,
+		}, &token)
+		if err != nil {
+			return "", fmt.Errorf("failed to prompt for %s token: %w", platform.Name(), err)
+		}
+	}
+	return token, nil
+}
+
+// apiRequest sends a request with a bearer token to a JSON API, and decodes
+// the response into a value of type T.
+func apiRequest[T any](ctx context.Context, httpClient *http.Client, method, url, token string, body any) (T, error) {
+	var data T
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return data, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return data, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return data, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte("Unknown error")
+		}
+		return data, fmt.Errorf("API call failed: %d - %s", resp.StatusCode, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return data, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	return data, nil
+}
+
+// managedServicesFromEnv guesses the managed databases of an application from
+// the names of its environment variables.
+func managedServicesFromEnv(names []string) (postgres, redis []string) {
+	for _, name := range names {
+		switch {
+		case name == "DATABASE_URL" || strings.HasPrefix(name, "POSTGRES"):
+			if len(postgres) == 0 {
+				postgres = append(postgres, "postgres")
+			}
+		case strings.HasPrefix(name, "REDIS") || strings.HasPrefix(name, "UPSTASH_REDIS"):
+			if len(redis) == 0 {
+				redis = append(redis, "redis")
+			}
+		}
+	}
+	return postgres, redis
+}
+
+// parseDuration parses a duration like "10s", returning 0 if it is invalid.
+func parseDuration(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// remarshal converts a decoded JSON value into a value of another type.
+func remarshal(in any, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newFixtureServer serves the recorded API responses in testdata; route
+// returns the fixture for each request.
+func newFixtureServer(t *testing.T, route func(r *http.Request) string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		fixture := route(r)
+		if fixture == "" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFlyioSource(t *testing.T) {
+	t.Setenv("FLY_API_TOKEN", "test-token")
+	server := newFixtureServer(t, func(r *http.Request) string {
+		switch r.URL.Path {
+		case "/v1/apps":
+			assert.Equal(t, "personal", r.URL.Query().Get("org_slug"))
+			return "flyio/apps.json"
+		case "/v1/apps/shop-api/machines":
+			return "flyio/machines.json"
+		case "/v1/apps/shop-api/secrets":
+			return "flyio/secrets.json"
+		}
+		return ""
+	})
+	flyio := &FlyioClient{HTTPClient: server.Client(), BaseURL: server.URL + "/v1", Org: "personal", Dir: "testdata/flyio"}
+
+	mockSurveyor := &MockSurveyor{responses: []any{"shop-api"}}
+	mockSurveyor.On("AskOne", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	mockFabricClient := &MockFabricClient{}
+
+	composeFileContents, err := InteractiveSetup(t.Context(), mockFabricClient, mockSurveyor, SourceClients{SourcePlatformFlyio: flyio}, SourcePlatformFlyio)
+	require.NoError(t, err)
+	mockSurveyor.AssertExpectations(t)
+	assert.Empty(t, mockFabricClient.generateComposeRequests, "the Fabric is not used for Fly.io")
+	require.NoError(t, pkg.Compare([]byte(composeFileContents), "testdata/flyio.compose.yaml"))
+
+	t.Run("without fly.toml", func(t *testing.T) {
+		flyio.Dir = t.TempDir()
+		info, err := flyio.CollectAppInfo(t.Context(), "shop-api")
+		require.NoError(t, err)
+		services := info.(AppInfo).Services
+		require.Len(t, services, 2)
+		assert.Equal(t, "registry.fly.io/shop-api:deployment-01HZ3K5Q3V6W", services[0].Image)
+		assert.Equal(t, "bundle exec puma -C config/puma.rb", services[0].Command)
+		assert.Equal(t, 2, services[0].Replicas)
+	})
+}
+
+func TestRenderSource(t *testing.T) {
+	server := newFixtureServer(t, func(r *http.Request) string {
+		switch r.URL.Path {
+		case "/v1/projects":
+			return "render/projects.json"
+		case "/v1/services":
+			return "render/services.json"
+		case "/v1/postgres":
+			return "render/postgres.json"
+		case "/v1/key-value":
+			return "render/key-value.json"
+		case "/v1/services/srv-cq8hb4lds78s73d0ub10/env-vars":
+			return "render/env-vars-web.json"
+		case "/v1/services/srv-cq8hc2tds78s73d0uc40/env-vars":
+			return "render/env-vars-worker.json"
+		}
+		return ""
+	})
+	render := &RenderClient{Token: "test-token", HTTPClient: server.Client(), BaseURL: server.URL + "/v1", Dir: "testdata/render"}
+
+	apps, err := render.ListApps(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"blog", "status-page"}, apps)
+
+	info, err := render.CollectAppInfo(t.Context(), "blog")
+	require.NoError(t, err)
+	sanitized, err := render.Sanitize(info)
+	require.NoError(t, err)
+	appInfo := sanitized.(AppInfo)
+	assert.Equal(t, []string{"blog-db"}, appInfo.Postgres)
+	assert.Equal(t, []string{"blog-cache"}, appInfo.Redis)
+	assert.Equal(t, redacted, appInfo.ConfigVars["SESSION_SECRET"])
+	assert.Equal(t, "3000", appInfo.ConfigVars["PORT"])
+
+	composeFileContents, err := composeFromAppInfo(t.Context(), appInfo)
+	require.NoError(t, err)
+	assert.NotContains(t, composeFileContents, "d1f8c3a9b2e7f4061c5d")
+	require.NoError(t, pkg.Compare([]byte(composeFileContents), "testdata/render.compose.yaml"))
+}
+
+var graphqlOperation = regexp.MustCompile(`^query (\w+)`)
+
+func TestRailwaySource(t *testing.T) {
+	server := newFixtureServer(t, func(r *http.Request) string {
+		var body struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return ""
+		}
+		m := graphqlOperation.FindStringSubmatch(body.Query)
+		if m == nil {
+			return ""
+		}
+		switch m[1] {
+		case "projects":
+			return "railway/projects.json"
+		case "project":
+			assert.Equal(t, "0b6f3c2e-5a1d-4e8b-9c7f-2d4a6e8b1c3f", body.Variables["id"])
+			return "railway/project.json"
+		case "variables":
+			assert.Equal(t, "a9b8c7d6-1111-4e5f-9a0b-bbbbbbbbbbbb", body.Variables["environmentId"], "the production environment")
+			if body.Variables["serviceId"] == "5f1e2d3c-aaaa-4b5c-8d9e-000000000001" {
+				return "railway/variables-api.json"
+			}
+			return "railway/variables-db.json"
+		}
+		return ""
+	})
+	railway := &RailwayClient{Token: "test-token", HTTPClient: server.Client(), URL: server.URL}
+
+	apps, err := railway.ListApps(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chat-app", "sandbox"}, apps)
+
+	info, err := railway.CollectAppInfo(t.Context(), "chat-app")
+	require.NoError(t, err)
+	sanitized, err := railway.Sanitize(info)
+	require.NoError(t, err)
+	appInfo := sanitized.(AppInfo)
+	assert.Equal(t, []string{"Postgres"}, appInfo.Postgres)
+	assert.Equal(t, []string{"Redis"}, appInfo.Redis)
+	assert.Equal(t, redacted, appInfo.ConfigVars["DATABASE_URL"])
+	assert.Equal(t, "debug", appInfo.ConfigVars["LOG_LEVEL"])
+
+	composeFileContents, err := composeFromAppInfo(t.Context(), appInfo)
+	require.NoError(t, err)
+	assert.NotContains(t, composeFileContents, "kT9xQ2vLm4pW")
+	require.NoError(t, pkg.Compare([]byte(composeFileContents), "testdata/railway.compose.yaml"))
+
+	t.Run("unauthorized", func(t *testing.T) {
+		railway := &RailwayClient{Token: "wrong-token", HTTPClient: server.Client(), URL: server.URL}
+		_, err := railway.ListApps(t.Context())
+		assert.ErrorContains(t, err, "API call failed: 401")
+	})
+}
@@ -0,0 +1,221 @@
+// Package notify posts deployment events to Slack, Microsoft Teams, and generic
+// webhooks, so deployments triggered from CI can be followed without watching
+// the terminal.
+//
+// The events are sent by the CLI, so nothing is posted when the TTL of a
+// deployment expires and the CD destroys the stack: the CD task would need the
+// webhook URLs, which are secrets and must not be put in its environment.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+// The environment variables that configure the notifications; set them in the
+// stack file to configure them per stack.
+const (
+	EnvWebhook  = "DEFANG_NOTIFY_WEBHOOK"
+	EnvSlack    = "DEFANG_NOTIFY_SLACK"
+	EnvTeams    = "DEFANG_NOTIFY_TEAMS"
+	EnvTemplate = "DEFANG_NOTIFY_TEMPLATE" // Go template for the message text
+)
+
+// EnvVars are all the variables that configure the notifications.
+var EnvVars = []string{EnvWebhook, EnvSlack, EnvTeams, EnvTemplate}
+
+// sendTimeout bounds a single notification, including the retries of the HTTP client
+const sendTimeout = 30 * time.Second
+
+type EventType string
+
+const (
+	EventDeployStarted   EventType = "deploy_started"
+	EventServiceHealthy  EventType = "service_healthy"
+	EventDeployCompleted EventType = "deploy_completed"
+	EventDeployFailed    EventType = "deploy_failed"
+)
+
+// Event is the structured message that is posted as JSON to generic webhooks.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Project    string    `json:"project"`
+	Stack      string    `json:"stack,omitempty"`
+	Provider   string    `json:"provider,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Deployment string    `json:"deployment,omitempty"` // the deployment ID
+	Service    string    `json:"service,omitempty"`
+	Endpoints  []string  `json:"endpoints,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Debug      string    `json:"debug,omitempty"` // the debug summary or command, if available
+	Text       string    `json:"text"`            // the rendered message text
+}
+
+func (e Event) target() string {
+	target := e.Project
+	if e.Stack != "" {
+		target += "/" + e.Stack
+	}
+	return target
+}
+
+// defaultText is the message text if there is no template.
+func defaultText(e Event) string {
+	switch e.Type {
+	case EventDeployStarted:
+		return fmt.Sprintf("Deployment %s of %s started", e.Deployment, e.target())
+	case EventServiceHealthy:
+		text := fmt.Sprintf("Service %s of %s is healthy", e.Service, e.target())
+		if len(e.Endpoints) > 0 {
+			text += ": " + strings.Join(e.Endpoints, ", ")
+		}
+		return text
+	case EventDeployCompleted:
+		return fmt.Sprintf("Deployment %s of %s completed", e.Deployment, e.target())
+	case EventDeployFailed:
+		text := fmt.Sprintf("Deployment %s of %s failed", e.Deployment, e.target())
+		if e.Error != "" {
+			text += ": " + e.Error
+		}
+		if e.Debug != "" {
+			text += "\n" + e.Debug
+		}
+		return text
+	default:
+		return fmt.Sprintf("%s: %s", e.Type, e.target())
+	}
+}
+
+// Sink is a destination for notifications.
+type Sink interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// Notifier sends events to its sinks in the background, in order; call Close
+// to wait for the pending notifications. A nil Notifier does nothing.
+type Notifier struct {
+	sinks    []Sink
+	template *template.Template
+	events   chan Event
+	done     chan struct{}
+	mu       sync.Mutex // guards closed
+	closed   bool
+}
+
+func New(tmpl *template.Template, sinks ...Sink) *Notifier {
+	n := &Notifier{
+		sinks:    sinks,
+		template: tmpl,
+		events:   make(chan Event, 64),
+		done:     make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// FromEnv returns a Notifier for the sinks configured in the environment, or
+// nil if there are none.
+func FromEnv() (*Notifier, error) {
+	var sinks []Sink
+	if url := os.Getenv(EnvWebhook); url != "" {
+		sinks = append(sinks, &Webhook{URL: url})
+	}
+	if url := os.Getenv(EnvSlack); url != "" {
+		sinks = append(sinks, &Slack{URL: url})
+	}
+	if url := os.Getenv(EnvTeams); url != "" {
+		sinks = append(sinks, &Teams{URL: url})
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	var tmpl *template.Template
+	if text := os.Getenv(EnvTemplate); text != "" {
+		var err error
+		if tmpl, err = template.New("notify").Parse(text); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvTemplate, err)
+		}
+	}
+	return New(tmpl, sinks...), nil
+}
+
+// Notify queues the event; the Text is rendered from the template if empty.
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Text == "" {
+		event.Text = n.render(event)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		term.Debug("Notifier is closed; dropping", event.Type)
+		return
+	}
+	n.events <- event
+}
+
+func (n *Notifier) render(event Event) string {
+	if n.template != nil {
+		var buf bytes.Buffer
+		err := n.template.Execute(&buf, event)
+		if err == nil {
+			return buf.String()
+		}
+		term.Debugf("Failed to render %s: %v", EnvTemplate, err)
+	}
+	return defaultText(event)
+}
+
+func (n *Notifier) run() {
+	for event := range n.events {
+		n.send(event)
+	}
+	close(n.done)
+}
+
+func (n *Notifier) send(event Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	var errs []error
+	for _, sink := range n.sinks {
+		if err := sink.Send(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		term.Warn("Failed to send the notification:", err)
+	}
+}
+
+// Close waits until the queued events are sent, or the context is done.
+func (n *Notifier) Close(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.events)
+	}
+	n.mu.Unlock()
+	select {
+	case <-n.done:
+	case <-ctx.Done():
+		term.Debug("Stopped waiting for the notifications:", ctx.Err())
+	}
+}
@@ -0,0 +1,188 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   [][]byte
+	failures int // the number of requests to fail with 503 first
+}
+
+func newRecordingServer(t *testing.T, failures int) *recordingServer {
+	s := &recordingServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.bodies = append(s.bodies, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *recordingServer) received() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies
+}
+
+var testEvent = Event{
+	Type:       EventDeployFailed,
+	Time:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	Project:    "proj",
+	Stack:      "beta",
+	Deployment: "abc123",
+	Error:      "deployment failed for service \"app\": exit code 1",
+	Debug:      "To debug the deployment, do: defang debug --deployment=abc123",
+}
+
+func TestSinks(t *testing.T) {
+	webhook := newRecordingServer(t, 0)
+	slack := newRecordingServer(t, 0)
+	teams := newRecordingServer(t, 0)
+	n := New(nil, &Webhook{URL: webhook.URL}, &Slack{URL: slack.URL}, &Teams{URL: teams.URL})
+	n.Notify(testEvent)
+	n.Close(t.Context())
+
+	wantText := "Deployment abc123 of proj/beta failed: deployment failed for service \"app\": exit code 1\nTo debug the deployment, do: defang debug --deployment=abc123"
+
+	if got := webhook.received(); len(got) != 1 {
+		t.Fatalf("webhook got %d requests", len(got))
+	} else {
+		var event Event
+		if err := json.Unmarshal(got[0], &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != EventDeployFailed || event.Deployment != "abc123" || event.Stack != "beta" || event.Text != wantText {
+			t.Errorf("webhook event = %+v", event)
+		}
+	}
+
+	if got := slack.received(); len(got) != 1 {
+		t.Fatalf("slack got %d requests", len(got))
+	} else if want := `{"text":` + jsonString(t, wantText) + `}`; string(got[0]) != want {
+		t.Errorf("slack payload = %s, want %s", got[0], want)
+	}
+
+	if got := teams.received(); len(got) != 1 {
+		t.Fatalf("teams got %d requests", len(got))
+	} else {
+		var message teamsMessage
+		if err := json.Unmarshal(got[0], &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type != "message" || len(message.Attachments) != 1 {
+			t.Fatalf("teams message = %+v", message)
+		}
+		card := message.Attachments[0]
+		if card.ContentType != "application/vnd.microsoft.card.adaptive" || card.Content.Type != "AdaptiveCard" || card.Content.Body[0].Text != wantText {
+			t.Errorf("teams card = %+v", card)
+		}
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRetry(t *testing.T) {
+	server := newRecordingServer(t, 1)
+	n := New(nil, &Slack{URL: server.URL})
+	n.Notify(Event{Type: EventDeployStarted, Project: "proj", Deployment: "abc123"})
+	n.Close(t.Context())
+	if got := server.received(); len(got) != 1 {
+		t.Errorf("expected the notification after a retry, got %d", len(got))
+	}
+}
+
+func TestTemplateAndOrder(t *testing.T) {
+	server := newRecordingServer(t, 0)
+	tmpl := template.Must(template.New("test").Parse(`[{{.Type}}] {{.Project}}{{with .Service}} {{.}}{{end}}`))
+	n := New(tmpl, &Slack{URL: server.URL})
+	n.Notify(Event{Type: EventDeployStarted, Project: "proj"})
+	n.Notify(Event{Type: EventServiceHealthy, Project: "proj", Service: "app"})
+	n.Notify(Event{Type: EventDeployCompleted, Project: "proj", Text: "custom"})
+	n.Close(t.Context())
+	n.Notify(Event{Type: EventDeployFailed, Project: "proj"}) // dropped after Close
+
+	want := []string{
+		`{"text":"[deploy_started] proj"}`,
+		`{"text":"[service_healthy] proj app"}`,
+		`{"text":"custom"}`,
+	}
+	got := server.received()
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if string(got[i]) != want[i] {
+			t.Errorf("request %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDefaultText(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Type: EventDeployStarted, Project: "proj", Deployment: "abc123"}, "Deployment abc123 of proj started"},
+		{Event{Type: EventServiceHealthy, Project: "proj", Stack: "beta", Service: "app", Endpoints: []string{"https://app.example.com"}}, "Service app of proj/beta is healthy: https://app.example.com"},
+		{Event{Type: EventDeployCompleted, Project: "proj", Deployment: "abc123"}, "Deployment abc123 of proj completed"},
+	}
+	for _, tt := range tests {
+		if got := defaultText(tt.event); got != tt.want {
+			t.Errorf("defaultText(%s) = %q, want %q", tt.event.Type, got, tt.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	for _, key := range EnvVars {
+		t.Setenv(key, "")
+	}
+	if n, err := FromEnv(); n != nil || err != nil {
+		t.Errorf("FromEnv() = %v, %v; want nil, nil", n, err)
+	}
+	var nilNotifier *Notifier
+	nilNotifier.Notify(testEvent) // no-op
+	nilNotifier.Close(t.Context())
+
+	t.Setenv(EnvSlack, "https://hooks.slack.com/services/T/B/X")
+	t.Setenv(EnvTemplate, "{{.Bad")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+
+	t.Setenv(EnvTemplate, "{{.Project}}")
+	n, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close(t.Context())
+	if len(n.sinks) != 1 {
+		t.Errorf("expected 1 sink, got %d", len(n.sinks))
+	}
+}
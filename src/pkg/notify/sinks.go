@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/DefangLabs/defang/src/pkg/http"
+)
+
+// Webhook posts the Event as JSON.
+type Webhook struct {
+	URL string
+}
+
+func (w *Webhook) Send(ctx context.Context, event Event) error {
+	return postJSON(ctx, w.URL, event)
+}
+
+// Slack posts the message text to a Slack incoming webhook.
+type Slack struct {
+	URL string
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (s *Slack) Send(ctx context.Context, event Event) error {
+	return postJSON(ctx, s.URL, slackMessage{Text: event.Text})
+}
+
+// Teams posts the message text as an Adaptive Card to a Microsoft Teams
+// workflow webhook.
+type Teams struct {
+	URL string
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []teamsTextBlock `json:"body"`
+}
+
+type teamsTextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Wrap bool   `json:"wrap"`
+}
+
+func (t *Teams) Send(ctx context.Context, event Event) error {
+	return postJSON(ctx, t.URL, teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    []teamsTextBlock{{Type: "TextBlock", Text: event.Text, Wrap: true}},
+			},
+		}},
+	})
+}
+
+// postJSON posts the payload; the http package retries on connection errors,
+// 429 and 5xx responses.
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.PostWithContext(ctx, url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package quota
+
+import (
+	"slices"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// The smallest task size, used for services without reservations
+const (
+	DefaultCpus      = 0.25
+	DefaultMemoryMiB = 512
+)
+
+// ProjectDemand sums the resources that the compute services of the project
+// reserve over all their replicas. Ingress ports share a single load balancer;
+// each replica of a service with host-mode ports gets its own public IP.
+func ProjectDemand(project *types.Project) client.QuotaDemand {
+	var demand client.QuotaDemand
+	for _, service := range project.Services {
+		if !compose.IsComputeService(&service) {
+			continue
+		}
+		replicas := 1
+		cpus, memoryMiB := float64(DefaultCpus), float64(DefaultMemoryMiB)
+		if service.Deploy != nil {
+			if service.Deploy.Replicas != nil {
+				replicas = *service.Deploy.Replicas
+			}
+			if reservations := service.Deploy.Resources.Reservations; reservations != nil {
+				if reservations.NanoCPUs > 0 {
+					cpus = float64(reservations.NanoCPUs)
+				}
+				if reservations.MemoryBytes > 0 {
+					memoryMiB = float64(reservations.MemoryBytes) / compose.MiB
+				}
+			}
+		}
+		demand.Cpus += cpus * float64(replicas)
+		demand.MemoryMiB += memoryMiB * float64(replicas)
+		demand.Gpus += compose.GetNumOfGPUs(types.Services{service.Name: service}) * replicas
+
+		if slices.ContainsFunc(service.Ports, isIngressPort) {
+			demand.LoadBalancers = 1
+		}
+		if slices.ContainsFunc(service.Ports, func(port types.ServicePortConfig) bool { return !isIngressPort(port) }) {
+			demand.PublicIPs += replicas
+		}
+	}
+	return demand
+}
+
+// isIngressPort mirrors the port fixup: ports default to ingress mode, except UDP ports
+func isIngressPort(port types.ServicePortConfig) bool {
+	return port.Mode != compose.Mode_HOST && port.Protocol != compose.Protocol_UDP
+}
@@ -0,0 +1,65 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestProjectDemand(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": {
+				Name:  "web",
+				Ports: []types.ServicePortConfig{{Target: 80, Mode: "ingress", Protocol: "tcp"}},
+				Deploy: &types.DeployConfig{
+					Replicas: ptr.Int(2),
+					Resources: types.Resources{
+						Reservations: &types.Resource{NanoCPUs: 1, MemoryBytes: 1024 * compose.MiB},
+					},
+				},
+			},
+			"api": {
+				Name:  "api",
+				Ports: []types.ServicePortConfig{{Target: 8080, Mode: "ingress", Protocol: "tcp"}},
+			},
+			"game": {
+				Name:  "game",
+				Ports: []types.ServicePortConfig{{Target: 9000, Mode: "ingress", Protocol: "udp"}},
+				Deploy: &types.DeployConfig{
+					Replicas: ptr.Int(3),
+				},
+			},
+			"llm": {
+				Name: "llm",
+				Deploy: &types.DeployConfig{
+					Resources: types.Resources{
+						Reservations: &types.Resource{
+							NanoCPUs: 4,
+							Devices:  []types.DeviceRequest{{Capabilities: []string{"gpu"}, Count: 2}},
+						},
+					},
+				},
+			},
+			"db": {
+				Name:       "db",
+				Extensions: map[string]any{"x-defang-postgres": true},
+			},
+		},
+	}
+
+	got := ProjectDemand(project)
+	want := client.QuotaDemand{
+		Cpus:          2*1 + DefaultCpus + 3*DefaultCpus + 4,
+		MemoryMiB:     2*1024 + DefaultMemoryMiB + 3*DefaultMemoryMiB + DefaultMemoryMiB,
+		Gpus:          2,
+		PublicIPs:     3,
+		LoadBalancers: 1,
+	}
+	if got != want {
+		t.Errorf("ProjectDemand() = %+v, want %+v", got, want)
+	}
+}
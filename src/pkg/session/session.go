@@ -3,12 +3,14 @@ package session
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/DefangLabs/defang/src/pkg"
 	"github.com/DefangLabs/defang/src/pkg/cli"
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
 	"github.com/DefangLabs/defang/src/pkg/cli/compose"
 	"github.com/DefangLabs/defang/src/pkg/clouds/aws"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
 	"github.com/DefangLabs/defang/src/pkg/modes"
 	"github.com/DefangLabs/defang/src/pkg/stacks"
 	"github.com/DefangLabs/defang/src/pkg/term"
@@ -29,17 +31,22 @@ type Session struct {
 type SessionLoaderOptions struct {
 	compose.LoaderOptions
 	stacks.GetStackOpts
+	// ValidateStackSchema checks the stack against the x-defang-stack-schema of
+	// the Compose project; only commands that deploy need this.
+	ValidateStackSchema bool
 }
 
 type SessionLoader struct {
 	client client.FabricClient
+	ec     elicitations.Controller
 	sm     StacksManager
 	opts   SessionLoaderOptions
 }
 
-func NewSessionLoader(client client.FabricClient, maybeSm StacksManager, opts SessionLoaderOptions) *SessionLoader {
+func NewSessionLoader(client client.FabricClient, ec elicitations.Controller, maybeSm StacksManager, opts SessionLoaderOptions) *SessionLoader {
 	return &SessionLoader{
 		client: client,
+		ec:     ec,
 		sm:     maybeSm,
 		opts:   opts,
 	}
@@ -58,6 +65,12 @@ func (sl *SessionLoader) LoadSession(ctx context.Context) (*Session, error) {
 		"DEFANG_PROVIDER": stack.Provider.String(),
 		"DEFANG_STACK":    stack.Name,
 	}
+	if sl.opts.ValidateStackSchema {
+		// use a separate loader, because the project it caches predates any prompted values
+		if err := sl.validateStackSchema(ctx, compose.NewLoaderFromOptions(loaderOptions), stack); err != nil {
+			return nil, err
+		}
+	}
 	session := &Session{
 		Stack:    stack,
 		Loader:   compose.NewLoaderFromOptions(loaderOptions),
@@ -95,6 +108,37 @@ func (sl *SessionLoader) loadStack(ctx context.Context) (*stacks.Parameters, str
 	return stack, whence, nil
 }
 
+// validateStackSchema checks the stack against the x-defang-stack-schema of the
+// Compose project, if any, prompting for missing required variables.
+func (sl *SessionLoader) validateStackSchema(ctx context.Context, loader client.Loader, stack *stacks.Parameters) error {
+	project, err := loader.LoadProject(ctx)
+	if err != nil {
+		// not every command needs a Compose project; errors are reported later
+		term.Debugf("Skipping stack schema validation: %v", err)
+		return nil
+	}
+	schema, err := stacks.ParseSchema(project.Extensions)
+	if err != nil {
+		return err
+	}
+	missing := schema.Missing(stack)
+	if err := schema.CollectMissing(ctx, sl.ec, stack); err != nil {
+		return err
+	}
+	if err := schema.Validate(stack); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		for _, name := range missing {
+			if err := os.Setenv(name, stack.Variables[name]); err != nil {
+				return fmt.Errorf("could not set env var %q: %w", name, err)
+			}
+		}
+		term.Infof("To avoid this prompt, add %v to the stack file for %q", missing, stack.Name)
+	}
+	return nil
+}
+
 // StackEnvFiles returns the env files loaded by convention for the selected
 // stack: .env, then .env.<provider>, then .env.<stack>, so the more specific
 // file overrides the more generic ones.
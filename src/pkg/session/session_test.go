@@ -10,6 +10,7 @@ import (
 	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc/aws"
 	"github.com/DefangLabs/defang/src/pkg/cli/client/byoc/gcp"
 	"github.com/DefangLabs/defang/src/pkg/cli/compose"
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
 	"github.com/DefangLabs/defang/src/pkg/modes"
 	"github.com/DefangLabs/defang/src/pkg/stacks"
 	"github.com/stretchr/testify/assert"
@@ -222,7 +223,7 @@ func TestLoadSession(t *testing.T) {
 				sm.On("List", ctx).Maybe().Return(tt.stacksList, nil)
 			}
 
-			loader := NewSessionLoader(client.MockFabricClient{}, sm, tt.options)
+			loader := NewSessionLoader(client.MockFabricClient{}, nil, sm, tt.options)
 			session, err := loader.LoadSession(ctx)
 			if tt.expectedError != "" {
 				require.Error(t, err)
@@ -282,7 +283,7 @@ services:
 	stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang}
 	sm := &mockStacksManager{}
 	sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
-	loader := NewSessionLoader(client.MockFabricClient{}, sm, SessionLoaderOptions{
+	loader := NewSessionLoader(client.MockFabricClient{}, nil, sm, SessionLoaderOptions{
 		LoaderOptions: compose.LoaderOptions{ConfigPaths: []string{composePath}},
 	})
 
@@ -298,3 +299,111 @@ services:
 	assert.Equal(t, "production", *env["STACK"])
 	sm.AssertExpectations(t)
 }
+
+func TestLoadSessionValidatesStackSchema(t *testing.T) {
+	const composeYAML = `name: sessionschematest
+x-defang-stack-schema:
+  DOMAIN:
+    required: true
+  REPLICAS:
+    type: int
+services:
+  web:
+    image: alpine
+`
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "compose.yaml")
+	require.NoError(t, os.WriteFile(composePath, []byte(composeYAML), 0o644))
+	options := SessionLoaderOptions{
+		LoaderOptions:       compose.LoaderOptions{ConfigPaths: []string{composePath}},
+		ValidateStackSchema: true,
+	}
+	// LoadSession exports the stack variables; restore them afterwards
+	t.Setenv("DOMAIN", "")
+	t.Setenv("REPLICAS", "")
+
+	t.Run("missing required variable", func(t *testing.T) {
+		ctx := t.Context()
+		stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang}
+		sm := &mockStacksManager{}
+		sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
+		_, err := NewSessionLoader(client.MockFabricClient{}, nil, sm, options).LoadSession(ctx)
+		assert.ErrorContains(t, err, `stack "production" is missing required variable(s) [DOMAIN]`)
+	})
+
+	t.Run("invalid variable", func(t *testing.T) {
+		ctx := t.Context()
+		stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang, Variables: map[string]string{
+			"DOMAIN":   "example.com",
+			"REPLICAS": "many",
+		}}
+		sm := &mockStacksManager{}
+		sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
+		_, err := NewSessionLoader(client.MockFabricClient{}, nil, sm, options).LoadSession(ctx)
+		assert.ErrorContains(t, err, `variable "REPLICAS": "many" is not an integer`)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		ctx := t.Context()
+		stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang, Variables: map[string]string{
+			"DOMAIN": "example.com",
+		}}
+		sm := &mockStacksManager{}
+		sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
+		_, err := NewSessionLoader(client.MockFabricClient{}, nil, sm, options).LoadSession(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("prompted variable reaches the project", func(t *testing.T) {
+		// only COMPOSE_* variables from the environment are used for interpolation
+		const composeYAML = `name: sessionschemapromptedtest
+x-defang-stack-schema:
+  COMPOSE_DOMAIN:
+    required: true
+services:
+  web:
+    image: alpine
+    domainname: ${COMPOSE_DOMAIN}
+`
+		composePath := filepath.Join(t.TempDir(), "compose.yaml")
+		require.NoError(t, os.WriteFile(composePath, []byte(composeYAML), 0o644))
+		t.Setenv("COMPOSE_DOMAIN", "")
+		ctx := t.Context()
+		stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang}
+		sm := &mockStacksManager{}
+		sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
+		options := options
+		options.ConfigPaths = []string{composePath}
+		session, err := NewSessionLoader(client.MockFabricClient{}, stringElicitations("example.com"), sm, options).LoadSession(ctx)
+		require.NoError(t, err)
+		project, err := session.Loader.LoadProject(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", project.Services["web"].DomainName)
+	})
+
+	t.Run("not validated unless requested", func(t *testing.T) {
+		ctx := t.Context()
+		stack := &stacks.Parameters{Name: "production", Provider: client.ProviderDefang}
+		sm := &mockStacksManager{}
+		sm.On("GetStack", ctx, mock.Anything).Return(stack, "local", nil)
+		options := options
+		options.ValidateStackSchema = false
+		_, err := NewSessionLoader(client.MockFabricClient{}, nil, sm, options).LoadSession(ctx)
+		assert.NoError(t, err)
+	})
+}
+
+// stringElicitations answers every prompt with the same value.
+type stringElicitations string
+
+func (s stringElicitations) RequestString(context.Context, string, string, ...func(*elicitations.Options)) (string, error) {
+	return string(s), nil
+}
+
+func (s stringElicitations) RequestEnum(context.Context, string, string, []string) (string, error) {
+	return string(s), nil
+}
+
+func (stringElicitations) SetSupported(bool) {}
+
+func (stringElicitations) IsSupported() bool { return true }
@@ -26,6 +26,7 @@ type SetupClient struct {
 	ModelID    string
 	Fabric     client.FabricClient
 	FabricAddr string
+	SkipSteps  []migrate.HerokuStep // post-generation steps to skip when migrating from Heroku
 }
 
 func (s *SetupClient) Start(ctx context.Context) (SetupResult, error) {
@@ -35,7 +36,7 @@ func (s *SetupClient) Start(ctx context.Context) (SetupResult, error) {
 		Options: []string{
 			"Generate with AI",
 			"Clone a sample",
-			"Migrate from Heroku",
+			"Migrate from another platform",
 		},
 	}, &response)
 	if err != nil {
@@ -47,8 +48,8 @@ func (s *SetupClient) Start(ctx context.Context) (SetupResult, error) {
 		return s.AIGenerate(ctx)
 	case "Clone a sample":
 		return s.CloneSample(ctx, "")
-	case "Migrate from Heroku":
-		return s.MigrateFromHeroku(ctx)
+	case "Migrate from another platform":
+		return s.Migrate(ctx, migrate.SourcePlatformUnspecified)
 	}
 
 	return SetupResult{}, errors.New("invalid option selected")
@@ -160,6 +161,7 @@ func (s *SetupClient) AIGenerate(ctx context.Context) (SetupResult, error) {
 
 type SetupResult struct {
 	Folder string
+	Heroku *migrate.HerokuPostGenerate // the remaining steps of a migration from Heroku
 }
 
 func (s *SetupClient) CloneSample(ctx context.Context, sample string) (SetupResult, error) {
@@ -224,7 +226,9 @@ func beforeGenerate(directory string) {
 	}
 }
 
-func (s *SetupClient) MigrateFromHeroku(ctx context.Context) (SetupResult, error) {
+// Migrate generates a compose file for an application deployed on another
+// platform; if the platform is unspecified, the user is asked to select one.
+func (s *SetupClient) Migrate(ctx context.Context, platform migrate.SourcePlatform) (SetupResult, error) {
 	var err error
 	s.Fabric, err = login.InteractiveRequireLoginAndToS(ctx, s.Fabric, s.FabricAddr)
 	if err != nil {
@@ -232,12 +236,23 @@ func (s *SetupClient) MigrateFromHeroku(ctx context.Context) (SetupResult, error
 	}
 
 	term.Info("Ok, let's create a compose file for your existing deployment.")
-	heroku := migrate.NewHerokuClient()
-	composeFileContents, err := migrate.InteractiveSetup(ctx, s.Fabric, s.Surveyor, heroku, migrate.SourcePlatformHeroku)
+	sources := migrate.DefaultSourceClients()
+	composeFileContents, err := migrate.InteractiveSetup(ctx, s.Fabric, s.Surveyor, sources, platform)
 	if err != nil {
 		return SetupResult{}, err
 	}
 
+	var heroku *migrate.HerokuPostGenerate
+	if source, ok := sources[migrate.SourcePlatformHeroku].(*migrate.HerokuSource); ok {
+		heroku = source.PostGenerate(s.Surveyor, s.SkipSteps)
+	}
+	if heroku != nil {
+		composeFileContents, err = heroku.UpdateCompose(ctx, composeFileContents)
+		if err != nil {
+			return SetupResult{}, err
+		}
+	}
+
 	composeFilePath, err := writeComposeFile(composeFileContents)
 	if err != nil {
 		return SetupResult{}, fmt.Errorf("failed to write compose file: %w", err)
@@ -245,9 +260,11 @@ func (s *SetupClient) MigrateFromHeroku(ctx context.Context) (SetupResult, error
 
 	term.Info("Compose file written to", composeFilePath)
 	term.Info("Your application is now ready to deploy with Defang.")
-	term.Info("For next steps, visit https://s.defang.io/from-heroku")
+	if heroku != nil {
+		term.Info("For next steps, visit https://s.defang.io/from-heroku")
+	}
 
-	return SetupResult{Folder: "."}, nil
+	return SetupResult{Folder: ".", Heroku: heroku}, nil
 }
 
 func writeComposeFile(content string) (string, error) {
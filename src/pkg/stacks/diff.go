@@ -0,0 +1,62 @@
+package stacks
+
+import (
+	"maps"
+	"slices"
+)
+
+type Change string
+
+const (
+	ChangeLocalOnly  Change = "local only"
+	ChangeRemoteOnly Change = "remote only"
+	ChangeModified   Change = "modified"
+)
+
+// VariableDiff describes a stack variable that differs between the local stack
+// file and the remote stack record.
+type VariableDiff struct {
+	Key    string
+	Local  string
+	Remote string
+	Change Change
+}
+
+// Diff compares the effective variables of the local and remote stack, which
+// includes the provider, region and recipe. Either side may be nil.
+func Diff(local, remote *Parameters) []VariableDiff {
+	var localVars, remoteVars map[string]string
+	if local != nil {
+		localVars = local.ToMap()
+	}
+	if remote != nil {
+		remoteVars = remote.ToMap()
+	}
+
+	keys := slices.Sorted(maps.Keys(localVars))
+	for key := range remoteVars {
+		if _, ok := localVars[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var diffs []VariableDiff
+	for _, key := range keys {
+		localVal, inLocal := localVars[key]
+		remoteVal, inRemote := remoteVars[key]
+		diff := VariableDiff{Key: key, Local: localVal, Remote: remoteVal}
+		switch {
+		case !inRemote:
+			diff.Change = ChangeLocalOnly
+		case !inLocal:
+			diff.Change = ChangeRemoteOnly
+		case localVal != remoteVal:
+			diff.Change = ChangeModified
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
@@ -0,0 +1,60 @@
+package stacks
+
+import (
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	local := &Parameters{
+		Name:     "prod",
+		Provider: client.ProviderAWS,
+		Region:   "us-west-2",
+		Recipe:   modes.RecipeAffordable,
+		Variables: map[string]string{
+			"AWS_PROFILE": "prod",
+			"FOO":         "local",
+		},
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		assert.Empty(t, Diff(local, local))
+	})
+
+	t.Run("differences", func(t *testing.T) {
+		remote := &Parameters{
+			Name:     "prod",
+			Provider: client.ProviderAWS,
+			Region:   "us-east-1",
+			Recipe:   modes.RecipeAffordable,
+			Variables: map[string]string{
+				"AWS_PROFILE": "prod",
+				"BAR":         "remote",
+			},
+		}
+		assert.Equal(t, []VariableDiff{
+			{Key: "AWS_REGION", Local: "us-west-2", Remote: "us-east-1", Change: ChangeModified},
+			{Key: "BAR", Remote: "remote", Change: ChangeRemoteOnly},
+			{Key: "FOO", Local: "local", Change: ChangeLocalOnly},
+		}, Diff(local, remote))
+	})
+
+	t.Run("remote only stack", func(t *testing.T) {
+		diffs := Diff(nil, local)
+		assert.Len(t, diffs, 5)
+		for _, diff := range diffs {
+			assert.Equal(t, ChangeRemoteOnly, diff.Change)
+		}
+	})
+
+	t.Run("local only stack", func(t *testing.T) {
+		diffs := Diff(local, nil)
+		assert.Len(t, diffs, 5)
+		for _, diff := range diffs {
+			assert.Equal(t, ChangeLocalOnly, diff.Change)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package stacks
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// ExtendsKey is the stack file variable that names the parent stack file.
+	ExtendsKey = "EXTENDS"
+	// BaseName is the stack file that is implicitly extended by every stack
+	// without an explicit EXTENDS key.
+	BaseName = "_base"
+)
+
+type stackLayer struct {
+	name      string
+	extends   string // explicit EXTENDS value, if any
+	variables map[string]string
+}
+
+// readLayers reads the named stack file followed by every stack file it
+// (transitively) extends, returning an error on cycles.
+func readLayers(workingDirectory, name string) ([]stackLayer, error) {
+	var layers []stackLayer
+	for next := name; next != ""; {
+		if slices.ContainsFunc(layers, func(l stackLayer) bool { return l.name == next }) {
+			chain := make([]string, 0, len(layers)+1)
+			for _, l := range layers {
+				chain = append(chain, l.name)
+			}
+			return nil, fmt.Errorf("stack inheritance cycle: %s", strings.Join(append(chain, next), " -> "))
+		}
+		if err := validateExtends(next); err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(filename(workingDirectory, next))
+		if err != nil {
+			if len(layers) == 0 {
+				return nil, err // keep os.ErrNotExist for the stack itself
+			}
+			// don't wrap: a missing parent must not look like a missing stack
+			return nil, fmt.Errorf("stack %q extends %q: %v", layers[len(layers)-1].name, next, err)
+		}
+		variables, err := parseContent(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse stack %q: %w", next, err)
+		}
+		extends := variables[ExtendsKey]
+		delete(variables, ExtendsKey)
+		layers = append(layers, stackLayer{name: next, extends: extends, variables: variables})
+
+		if extends == "" && next != BaseName {
+			if _, err := os.Stat(filename(workingDirectory, BaseName)); err == nil {
+				next = BaseName
+				continue
+			}
+		}
+		next = extends
+	}
+	return layers, nil
+}
+
+func validateExtends(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid %s value %q: must be the name of a file in the %s directory", ExtendsKey, name, Directory)
+	}
+	return nil
+}
+
+// mergeLayers merges the variables of the given layers, with earlier layers
+// overriding later ones, and records which layer each variable came from.
+func mergeLayers(layers []stackLayer) (variables, sources map[string]string) {
+	variables = make(map[string]string)
+	sources = make(map[string]string)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i].variables {
+			variables[k] = v
+			sources[k] = layers[i].name
+		}
+	}
+	return variables, sources
+}
+
+// newParametersFromLayers creates the parameters for the first layer (the
+// stack itself), inheriting the variables of the layers it extends.
+func newParametersFromLayers(layers []stackLayer) (*Parameters, error) {
+	if len(layers) == 0 {
+		return nil, errors.New("no stack files to merge")
+	}
+	self := layers[0]
+	variables, sources := mergeLayers(layers)
+	maps.DeleteFunc(sources, func(_, source string) bool { return source == self.name })
+
+	params, err := paramsFromMap(variables)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse stack %q: %w", self.name, err)
+	}
+	params.Name = self.name
+	params.Extends = self.extends
+	params.Overrides = make(map[string]bool, len(self.variables))
+	for k := range self.variables {
+		params.Overrides[k] = true
+	}
+	if len(layers) > 1 {
+		params.Inherited, _ = mergeLayers(layers[1:])
+	}
+	if len(sources) > 0 {
+		params.Sources = sources
+	}
+	return params, nil
+}
+
+// inheritInDirectory resolves the variables that a new stack inherits from its
+// parent stack file(s), so that only its own overrides get written.
+func (p *Parameters) inheritInDirectory(workingDirectory string) error {
+	parent := p.Extends
+	if parent == "" {
+		if _, err := os.Stat(filename(workingDirectory, BaseName)); err != nil {
+			return nil // no implicit base
+		}
+		parent = BaseName
+	}
+	layers, err := readLayers(workingDirectory, parent)
+	if err != nil {
+		return fmt.Errorf("stack %q extends %q: %w", p.Name, parent, err)
+	}
+	p.Inherited, _ = mergeLayers(layers)
+	return nil
+}
+
+// Source returns the name of the stack file that the given variable was
+// resolved from: either this stack or one of the stacks it extends.
+func (p *Parameters) Source(key string) string {
+	if source, ok := p.Sources[key]; ok {
+		return source
+	}
+	return p.Name
+}
+
+// effectiveMap returns the stack variables, including any inherited ones that a
+// new stack doesn't have in its Variables yet.
+func (p *Parameters) effectiveMap() map[string]string {
+	vars := maps.Clone(p.Inherited)
+	if vars == nil {
+		return p.ToMap()
+	}
+	maps.Copy(vars, p.ToMap())
+	return vars
+}
+
+// overlay returns the variables that are not inherited as-is from a parent.
+// Keys that the stack file sets explicitly are always kept, so an override
+// doesn't disappear just because it currently equals the parent's value.
+func (p *Parameters) overlay() map[string]string {
+	vars := p.ToMap()
+	for k, v := range p.Inherited {
+		if vars[k] == v && !p.Overrides[k] {
+			delete(vars, k)
+		}
+	}
+	return vars
+}
@@ -0,0 +1,232 @@
+package stacks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeStackFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, Directory), 0700))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, Directory, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestReadInDirectoryExtends(t *testing.T) {
+	t.Run("explicit parent", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"base": "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nFOO=base\nBAR=base\n",
+			"prod": "EXTENDS=base\nAWS_REGION=us-east-1\nFOO=prod\n",
+		})
+		params, err := ReadInDirectory(dir, "prod")
+		require.NoError(t, err)
+		assert.Equal(t, "prod", params.Name)
+		assert.Equal(t, "base", params.Extends)
+		assert.Equal(t, client.ProviderAWS, params.Provider)
+		assert.Equal(t, "us-east-1", params.Region)
+		assert.Equal(t, map[string]string{
+			"DEFANG_PROVIDER": "aws",
+			"AWS_REGION":      "us-east-1",
+			"FOO":             "prod",
+			"BAR":             "base",
+		}, params.Variables)
+		assert.NotContains(t, params.Variables, ExtendsKey)
+		assert.Equal(t, "base", params.Source("DEFANG_PROVIDER"))
+		assert.Equal(t, "base", params.Source("BAR"))
+		assert.Equal(t, "prod", params.Source("FOO"))
+		assert.Equal(t, "prod", params.Source("AWS_REGION"))
+	})
+
+	t.Run("multiple levels", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"common":  "DEFANG_PROVIDER=gcp\nGCP_PROJECT_ID=shared\nFOO=common\n",
+			"staging": "EXTENDS=common\nGOOGLE_REGION=us-central1\nFOO=staging\n",
+			"preview": "EXTENDS=staging\nBAR=preview\n",
+		})
+		params, err := ReadInDirectory(dir, "preview")
+		require.NoError(t, err)
+		assert.Equal(t, client.ProviderGCP, params.Provider)
+		assert.Equal(t, "us-central1", params.Region)
+		assert.Equal(t, "staging", params.Variables["FOO"])
+		assert.Equal(t, "common", params.Source("GCP_PROJECT_ID"))
+		assert.Equal(t, "staging", params.Source("FOO"))
+		assert.Equal(t, "preview", params.Source("BAR"))
+	})
+
+	t.Run("implicit base", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			BaseName: "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nAWS_PROFILE=shared\n",
+			"dev":    "AWS_PROFILE=dev\n",
+		})
+		params, err := ReadInDirectory(dir, "dev")
+		require.NoError(t, err)
+		assert.Empty(t, params.Extends)
+		assert.Equal(t, client.ProviderAWS, params.Provider)
+		assert.Equal(t, "us-west-2", params.Region)
+		assert.Equal(t, "dev", params.Variables["AWS_PROFILE"])
+		assert.Equal(t, BaseName, params.Source("AWS_REGION"))
+	})
+
+	t.Run("no parent", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"solo": "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n",
+		})
+		params, err := ReadInDirectory(dir, "solo")
+		require.NoError(t, err)
+		assert.Nil(t, params.Inherited)
+		assert.Nil(t, params.Sources)
+		assert.Equal(t, "solo", params.Source("AWS_REGION"))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"a": "EXTENDS=b\n",
+			"b": "EXTENDS=c\n",
+			"c": "EXTENDS=a\n",
+		})
+		_, err := ReadInDirectory(dir, "a")
+		assert.EqualError(t, err, "stack inheritance cycle: a -> b -> c -> a")
+	})
+
+	t.Run("cycle through implicit base", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			BaseName: "EXTENDS=dev\n",
+			"dev":    "FOO=bar\n",
+		})
+		_, err := ReadInDirectory(dir, "dev")
+		assert.EqualError(t, err, "stack inheritance cycle: dev -> _base -> dev")
+	})
+
+	t.Run("self reference", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"dev": "EXTENDS=dev\n",
+		})
+		_, err := ReadInDirectory(dir, "dev")
+		assert.EqualError(t, err, "stack inheritance cycle: dev -> dev")
+	})
+
+	t.Run("missing parent", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"dev": "EXTENDS=nope\n",
+		})
+		_, err := ReadInDirectory(dir, "dev")
+		assert.ErrorContains(t, err, `stack "dev" extends "nope"`)
+		assert.False(t, errors.Is(err, os.ErrNotExist), "missing parent should not look like a missing stack")
+	})
+
+	t.Run("parent outside directory", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"dev": "EXTENDS=../secrets\n",
+		})
+		_, err := ReadInDirectory(dir, "dev")
+		assert.ErrorContains(t, err, "invalid EXTENDS value")
+	})
+}
+
+func TestListInDirectoryExtends(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		BaseName: "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nAWS_PROFILE=shared\n",
+		"dev":    "AWS_PROFILE=dev\n",
+		"prod":   "AWS_REGION=us-east-1\n",
+	})
+	list, err := ListInDirectory(dir)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, ListItem{Name: "dev", Provider: client.ProviderAWS, Region: "us-west-2", Account: "dev"}, list[0])
+	assert.Equal(t, ListItem{Name: "prod", Provider: client.ProviderAWS, Region: "us-east-1", Account: "shared"}, list[1])
+}
+
+func TestMarshalExtends(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"base": "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nFOO=base\n",
+		"prod": "EXTENDS=base\nFOO=prod\n",
+	})
+	params, err := ReadInDirectory(dir, "prod")
+	require.NoError(t, err)
+
+	content, err := Marshal(params)
+	require.NoError(t, err)
+	assert.Equal(t, "EXTENDS=\"base\"\nFOO=\"prod\"", content)
+
+	// editing an inherited value writes it to the overlay
+	params.Region = "eu-west-1"
+	params.Recipe = modes.RecipeAffordable
+	content, err = Marshal(params)
+	require.NoError(t, err)
+	assert.Equal(t, "EXTENDS=\"base\"\nAWS_REGION=\"eu-west-1\"\nDEFANG_RECIPE=\"affordable\"\nFOO=\"prod\"", content)
+
+	// the resolved form inlines everything and drops EXTENDS
+	content, err = MarshalResolved(params)
+	require.NoError(t, err)
+	assert.Equal(t, "AWS_REGION=\"eu-west-1\"\nDEFANG_PROVIDER=\"aws\"\nDEFANG_RECIPE=\"affordable\"\nFOO=\"prod\"", content)
+}
+
+func TestMarshalKeepsExplicitOverrides(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"base": "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nFOO=same\n",
+		"prod": "EXTENDS=base\nAWS_REGION=us-west-2\nFOO=same\n",
+	})
+	params, err := ReadInDirectory(dir, "prod")
+	require.NoError(t, err)
+
+	// the overrides equal the parent's values today, but must not be dropped
+	content, err := Marshal(params)
+	require.NoError(t, err)
+	assert.Equal(t, "EXTENDS=\"base\"\nAWS_REGION=\"us-west-2\"\nFOO=\"same\"", content)
+}
+
+func TestCreateInDirectoryExtends(t *testing.T) {
+	t.Run("implicit base", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			BaseName: "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\nAWS_PROFILE=shared\n",
+		})
+		path, err := CreateInDirectory(dir, Parameters{
+			Name:      "dev",
+			Provider:  client.ProviderAWS,
+			Region:    "us-west-2",
+			Recipe:    modes.RecipeAffordable,
+			Variables: map[string]string{"AWS_PROFILE": "shared"},
+		}, nil)
+		require.NoError(t, err)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "DEFANG_RECIPE=\"affordable\"", string(content))
+	})
+
+	t.Run("explicit parent", func(t *testing.T) {
+		dir := writeStackFiles(t, map[string]string{
+			"base": "DEFANG_PROVIDER=aws\nAWS_REGION=us-west-2\n",
+		})
+		path, err := CreateInDirectory(dir, Parameters{
+			Name:     "prod",
+			Extends:  "base",
+			Provider: client.ProviderAWS,
+			Region:   "us-east-1",
+		}, nil)
+		require.NoError(t, err)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "EXTENDS=\"base\"\nAWS_REGION=\"us-east-1\"", string(content))
+
+		params, err := ReadInDirectory(dir, "prod")
+		require.NoError(t, err)
+		assert.Equal(t, "us-east-1", params.Region)
+		assert.Equal(t, "base", params.Source("DEFANG_PROVIDER"))
+	})
+
+	t.Run("missing parent", func(t *testing.T) {
+		dir := writeStackFiles(t, nil)
+		_, err := CreateInDirectory(dir, Parameters{Name: "prod", Extends: "base"}, nil)
+		assert.ErrorContains(t, err, `stack "prod" extends "base"`)
+	})
+}
@@ -103,7 +103,7 @@ func (sm *manager) ListRemote(ctx context.Context) ([]ListItem, error) {
 	}
 	stackParams := make([]ListItem, 0, len(resp.GetStacks()))
 	for _, stack := range resp.GetStacks() {
-		params, err := newParametersFromPB(stack)
+		params, err := NewParametersFromStack(stack)
 		if err != nil {
 			term.Warnf("Skipping invalid remote stack %s: %v\n", stack.GetName(), err)
 			continue
@@ -134,7 +134,9 @@ func (sm *manager) ListRemote(ctx context.Context) ([]ListItem, error) {
 	return stackParams, nil
 }
 
-func newParametersFromPB(stack *defangv1.Stack) (*Parameters, error) {
+// NewParametersFromStack parses the stack file of a remote stack record,
+// filling in any missing fields from the record itself.
+func NewParametersFromStack(stack *defangv1.Stack) (*Parameters, error) {
 	name := stack.GetName()
 	if name == "" {
 		name = DefaultBeta
@@ -211,14 +213,14 @@ func (sm *manager) GetRemote(ctx context.Context, name string) (*Parameters, err
 		return nil, fmt.Errorf("failed to get remote stack: %w", err)
 	}
 
-	return newParametersFromPB(remoteStack.GetStack())
+	return NewParametersFromStack(remoteStack.GetStack())
 }
 
 func (sm *manager) Create(params Parameters) (string, error) {
 	if sm.targetDirectory == "" {
 		return "", &ErrOutside{Operation: "Create", TargetDirectory: sm.targetDirectory}
 	}
-	return CreateInDirectory(sm.targetDirectory, params)
+	return CreateInDirectory(sm.targetDirectory, params, nil)
 }
 
 type GetStackOpts struct {
@@ -350,7 +352,7 @@ func (sm *manager) getDefaultStack(ctx context.Context) (*Parameters, string, er
 	}
 
 	whence := "default stack from server"
-	params, err := newParametersFromPB(res.Stack)
+	params, err := NewParametersFromStack(res.Stack)
 	if err != nil {
 		return nil, whence, err
 	}
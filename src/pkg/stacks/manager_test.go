@@ -916,7 +916,7 @@ func TestGetStack(t *testing.T) {
 			}
 
 			if tt.localStack != nil {
-				_, err := CreateInDirectory(tmpDir, *tt.localStack)
+				_, err := CreateInDirectory(tmpDir, *tt.localStack, nil)
 				require.NoError(t, err, "Failed to create local stack")
 			}
 
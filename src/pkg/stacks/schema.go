@@ -0,0 +1,268 @@
+package stacks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DefangLabs/defang/src/pkg/elicitations"
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+// SchemaExtension is the top-level compose extension that declares the
+// variables a stack file for the project can (or must) contain:
+//
+//	x-defang-stack-schema:
+//	  AWS_REGION:
+//	    required: true
+//	    enum: [us-east-1, us-west-2]
+//	  REPLICAS:
+//	    type: int
+//	  DOMAIN:
+//	    pattern: ^[a-z.]+$
+const SchemaExtension = "x-defang-stack-schema"
+
+type VariableType string
+
+const (
+	TypeString VariableType = "string"
+	TypeInt    VariableType = "int"
+	TypeNumber VariableType = "number"
+	TypeBool   VariableType = "bool"
+)
+
+type VariableSchema struct {
+	Required    bool
+	Type        VariableType
+	Enum        []string
+	Pattern     *regexp.Regexp
+	Description string
+}
+
+// Schema maps stack variable names to their declared constraints.
+type Schema map[string]VariableSchema
+
+// ParseSchema parses the x-defang-stack-schema extension from the given compose
+// project extensions. It returns nil if the extension is absent.
+func ParseSchema(extensions map[string]any) (Schema, error) {
+	ext, ok := extensions[SchemaExtension]
+	if !ok || ext == nil {
+		return nil, nil
+	}
+	vars, ok := ext.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a mapping of variable names", SchemaExtension)
+	}
+	schema := make(Schema, len(vars))
+	for name, def := range vars {
+		vs, err := parseVariableSchema(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: variable %q: %w", SchemaExtension, name, err)
+		}
+		schema[name] = vs
+	}
+	return schema, nil
+}
+
+func parseVariableSchema(def any) (VariableSchema, error) {
+	vs := VariableSchema{Type: TypeString}
+	if def == nil {
+		return vs, nil // just declares the variable
+	}
+	fields, ok := def.(map[string]any)
+	if !ok {
+		return vs, errors.New("definition must be a mapping")
+	}
+	for key, value := range fields {
+		switch key {
+		case "required":
+			required, ok := value.(bool)
+			if !ok {
+				return vs, errors.New("'required' must be a boolean")
+			}
+			vs.Required = required
+		case "type":
+			str, _ := value.(string)
+			switch VariableType(strings.ToLower(str)) {
+			case TypeString:
+				vs.Type = TypeString
+			case TypeInt, "integer":
+				vs.Type = TypeInt
+			case TypeNumber, "float":
+				vs.Type = TypeNumber
+			case TypeBool, "boolean":
+				vs.Type = TypeBool
+			default:
+				return vs, fmt.Errorf("unsupported type %v; must be one of [%s %s %s %s]", value, TypeString, TypeInt, TypeNumber, TypeBool)
+			}
+		case "enum":
+			values, ok := value.([]any)
+			if !ok {
+				return vs, errors.New("'enum' must be a list")
+			}
+			for _, v := range values {
+				vs.Enum = append(vs.Enum, fmt.Sprint(v))
+			}
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				return vs, errors.New("'pattern' must be a string")
+			}
+			re, err := regexp.Compile(str)
+			if err != nil {
+				return vs, fmt.Errorf("invalid 'pattern': %w", err)
+			}
+			vs.Pattern = re
+		case "description":
+			vs.Description = fmt.Sprint(value)
+		default:
+			return vs, fmt.Errorf("unsupported field %q", key)
+		}
+	}
+	return vs, nil
+}
+
+// Check returns an error if the value does not satisfy the variable schema.
+func (vs VariableSchema) Check(value string) error {
+	switch vs.Type {
+	case TypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case TypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	}
+	if len(vs.Enum) > 0 && !slices.Contains(vs.Enum, value) {
+		return fmt.Errorf("%q is not one of %v", value, vs.Enum)
+	}
+	if vs.Pattern != nil && !vs.Pattern.MatchString(value) {
+		return fmt.Errorf("%q does not match pattern %q", value, vs.Pattern)
+	}
+	return nil
+}
+
+// Missing returns the sorted names of the required variables that the stack
+// does not set.
+func (s Schema) Missing(params *Parameters) []string {
+	vars := params.effectiveMap()
+	var missing []string
+	for name, vs := range s {
+		if _, ok := vars[name]; vs.Required && !ok {
+			missing = append(missing, name)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// Validate checks the effective variables of the stack against the schema.
+// Variables that are not declared, but look like a typo of a declared variable,
+// only produce a warning.
+func (s Schema) Validate(params *Parameters) error {
+	if len(s) == 0 {
+		return nil
+	}
+	var errs []error
+	if missing := s.Missing(params); len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing required variable(s) %v", missing))
+	}
+	vars := params.effectiveMap()
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		vs, ok := s[name]
+		if !ok {
+			if suggestion := s.closestVariable(name); suggestion != "" {
+				term.Warnf("Stack %q sets %q, which is not declared in %s; did you mean %q?", params.Name, name, SchemaExtension, suggestion)
+			}
+			continue
+		}
+		if err := vs.Check(vars[name]); err != nil {
+			errs = append(errs, fmt.Errorf("variable %q: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("stack %q does not match %s: %w", params.Name, SchemaExtension, err)
+	}
+	return nil
+}
+
+// CollectMissing prompts for the required variables that the stack does not
+// set and stores the answers in the stack variables. It fails fast when
+// elicitations are not supported, i.e. in non-interactive mode.
+func (s Schema) CollectMissing(ctx context.Context, ec elicitations.Controller, params *Parameters) error {
+	missing := s.Missing(params)
+	if len(missing) == 0 {
+		return nil
+	}
+	if ec == nil || !ec.IsSupported() {
+		return fmt.Errorf("stack %q is missing required variable(s) %v declared in %s; add them to the stack file", params.Name, missing, SchemaExtension)
+	}
+	if params.Variables == nil {
+		params.Variables = make(map[string]string)
+	}
+	for _, name := range missing {
+		vs := s[name]
+		message := fmt.Sprintf("What value do you want to use for %s?", name)
+		if vs.Description != "" {
+			message = fmt.Sprintf("%s (%s):", name, vs.Description)
+		}
+		var value string
+		var err error
+		if len(vs.Enum) > 0 {
+			value, err = ec.RequestEnum(ctx, message, strings.ToLower(name), vs.Enum)
+		} else {
+			value, err = ec.RequestString(ctx, message, strings.ToLower(name),
+				elicitations.WithValidator(func(val any) error {
+					str, _ := val.(string)
+					return vs.Check(str)
+				}),
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to elicit %s: %w", name, err)
+		}
+		params.Variables[name] = value
+	}
+	return nil
+}
+
+func (s Schema) closestVariable(name string) string {
+	var best string
+	bestDist := 3 // only suggest names within an edit distance of 2
+	for declared := range s {
+		if d := editDistance(name, declared); d < bestDist || (d == bestDist && declared < best) {
+			best, bestDist = declared, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
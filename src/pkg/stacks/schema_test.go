@@ -0,0 +1,195 @@
+package stacks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DefangLabs/defang/src/pkg/cli/client"
+	"github.com/DefangLabs/defang/src/pkg/modes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSchema(t *testing.T) Schema {
+	t.Helper()
+	schema, err := ParseSchema(map[string]any{
+		SchemaExtension: map[string]any{
+			"AWS_REGION": map[string]any{
+				"required": true,
+				"enum":     []any{"us-east-1", "us-west-2"},
+			},
+			"REPLICAS": map[string]any{
+				"type": "int",
+			},
+			"DOMAIN": map[string]any{
+				"required":    true,
+				"pattern":     `^[a-z.]+$`,
+				"description": "public domain name",
+			},
+			"DEBUG": nil,
+		},
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+func TestParseSchema(t *testing.T) {
+	t.Run("absent", func(t *testing.T) {
+		schema, err := ParseSchema(map[string]any{"x-other": true})
+		assert.NoError(t, err)
+		assert.Nil(t, schema)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		schema := testSchema(t)
+		assert.Len(t, schema, 4)
+		assert.True(t, schema["AWS_REGION"].Required)
+		assert.Equal(t, []string{"us-east-1", "us-west-2"}, schema["AWS_REGION"].Enum)
+		assert.Equal(t, TypeInt, schema["REPLICAS"].Type)
+		assert.Equal(t, TypeString, schema["DEBUG"].Type)
+	})
+
+	tests := []struct {
+		name    string
+		ext     any
+		wantErr string
+	}{
+		{"not a mapping", "AWS_REGION", "must be a mapping of variable names"},
+		{"bad type", map[string]any{"X": map[string]any{"type": "list"}}, `variable "X": unsupported type list`},
+		{"bad required", map[string]any{"X": map[string]any{"required": "yes"}}, "'required' must be a boolean"},
+		{"bad pattern", map[string]any{"X": map[string]any{"pattern": "("}}, "invalid 'pattern'"},
+		{"bad enum", map[string]any{"X": map[string]any{"enum": "a"}}, "'enum' must be a list"},
+		{"unknown field", map[string]any{"X": map[string]any{"default": "a"}}, `unsupported field "default"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchema(map[string]any{SchemaExtension: tt.ext})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := testSchema(t)
+	valid := Parameters{
+		Name:     "prod",
+		Provider: client.ProviderAWS,
+		Region:   "us-west-2",
+		Variables: map[string]string{
+			"DOMAIN":   "example.com",
+			"REPLICAS": "3",
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, schema.Validate(&valid))
+	})
+
+	t.Run("nil schema", func(t *testing.T) {
+		assert.NoError(t, Schema(nil).Validate(&Parameters{Name: "prod"}))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		params := Parameters{
+			Name:     "prod",
+			Provider: client.ProviderAWS,
+			Region:   "eu-west-1",
+			Variables: map[string]string{
+				"REPLICAS": "three",
+			},
+		}
+		err := schema.Validate(&params)
+		assert.ErrorContains(t, err, `stack "prod" does not match x-defang-stack-schema`)
+		assert.ErrorContains(t, err, "missing required variable(s) [DOMAIN]")
+		assert.ErrorContains(t, err, `variable "AWS_REGION": "eu-west-1" is not one of [us-east-1 us-west-2]`)
+		assert.ErrorContains(t, err, `variable "REPLICAS": "three" is not an integer`)
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		params := valid
+		params.Variables = map[string]string{"DOMAIN": "Example.com"}
+		assert.ErrorContains(t, schema.Validate(&params), `does not match pattern`)
+	})
+
+	t.Run("inherited values count", func(t *testing.T) {
+		params := Parameters{
+			Name:      "dev",
+			Inherited: map[string]string{"AWS_REGION": "us-east-1", "DOMAIN": "dev.example.com"},
+		}
+		assert.NoError(t, schema.Validate(&params))
+	})
+}
+
+func TestSchemaClosestVariable(t *testing.T) {
+	schema := testSchema(t)
+	assert.Equal(t, "AWS_REGION", schema.closestVariable("AWS_REGOIN"))
+	assert.Equal(t, "DOMAIN", schema.closestVariable("DOMIAN"))
+	assert.Empty(t, schema.closestVariable("AWS_PROFILE"))
+}
+
+func TestSchemaCollectMissing(t *testing.T) {
+	schema := testSchema(t)
+
+	t.Run("interactive", func(t *testing.T) {
+		ec := newMockElicitationsController()
+		ec.enumResponses["aws_region"] = "us-east-1"
+		ec.responses["domain"] = "example.com"
+		params := Parameters{Name: "prod", Provider: client.ProviderAWS}
+		require.NoError(t, schema.CollectMissing(t.Context(), ec, &params))
+		assert.Equal(t, []string{"RequestEnum:aws_region", "RequestString:domain"}, ec.callOrder)
+		assert.Equal(t, "us-east-1", params.Variables["AWS_REGION"])
+		assert.Equal(t, "example.com", params.Variables["DOMAIN"])
+		assert.NoError(t, schema.Validate(&params))
+	})
+
+	t.Run("non-interactive", func(t *testing.T) {
+		ec := newMockElicitationsController()
+		ec.SetSupported(false)
+		params := Parameters{Name: "prod", Provider: client.ProviderAWS, Region: "us-east-1"}
+		err := schema.CollectMissing(t.Context(), ec, &params)
+		assert.EqualError(t, err, `stack "prod" is missing required variable(s) [DOMAIN] declared in x-defang-stack-schema; add them to the stack file`)
+		assert.Empty(t, ec.callOrder)
+	})
+
+	t.Run("nothing missing", func(t *testing.T) {
+		params := Parameters{Name: "prod", Region: "us-east-1", Provider: client.ProviderAWS, Variables: map[string]string{"DOMAIN": "a.b"}}
+		assert.NoError(t, schema.CollectMissing(t.Context(), nil, &params))
+	})
+}
+
+func TestCreateInDirectorySchema(t *testing.T) {
+	schema := testSchema(t)
+	dir := t.TempDir()
+	params := Parameters{
+		Name:     "prod",
+		Provider: client.ProviderAWS,
+		Region:   "us-west-2",
+		Recipe:   modes.RecipeAffordable,
+	}
+	_, err := CreateInDirectory(dir, params, schema)
+	assert.ErrorContains(t, err, "missing required variable(s) [DOMAIN]")
+	_, statErr := os.Stat(filepath.Join(dir, Directory, "prod"))
+	assert.ErrorIs(t, statErr, os.ErrNotExist)
+
+	params.Variables = map[string]string{"DOMAIN": "example.com"}
+	_, err = CreateInDirectory(dir, params, schema)
+	assert.NoError(t, err)
+}
+
+func TestWizardWithSchema(t *testing.T) {
+	ec := newMockElicitationsController()
+	ec.responses["domain"] = "example.com"
+	wizard := NewWizardWithProfileLister(ec, nil, &mockAWSProfileLister{profiles: []string{"default"}}).WithSchema(testSchema(t))
+	ec.enumResponses["aws_profile"] = "default"
+
+	params, err := wizard.CollectRemainingParameters(t.Context(), &Parameters{
+		Name:     "prod",
+		Provider: client.ProviderAWS,
+		Region:   "us-east-1",
+		Recipe:   modes.RecipeAffordable,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", params.Variables["DOMAIN"])
+	assert.Contains(t, ec.callOrder, "RequestString:domain")
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DefangLabs/defang/src/pkg/cli/client"
@@ -21,6 +22,15 @@ type Parameters struct {
 	Recipe    modes.Recipe
 	Region    string
 	Variables map[string]string
+	// Extends is the name of the parent stack file, from the EXTENDS key.
+	Extends string
+	// Inherited holds the resolved variables of the parent stack file(s).
+	Inherited map[string]string
+	// Sources maps each inherited variable to the stack file it came from.
+	Sources map[string]string
+	// Overrides holds the keys that the stack file sets explicitly, even if
+	// their values equal the inherited ones.
+	Overrides map[string]bool
 }
 
 func NewParametersFromContent(name string, content []byte) (*Parameters, error) {
@@ -28,11 +38,14 @@ func NewParametersFromContent(name string, content []byte) (*Parameters, error)
 	if err != nil {
 		return nil, err
 	}
+	extends := variables[ExtendsKey]
+	delete(variables, ExtendsKey)
 	params, err := paramsFromMap(variables)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse stack %q: %w", name, err)
 	}
 	params.Name = name
+	params.Extends = extends
 	return params, nil
 }
 
@@ -95,7 +108,9 @@ func MakeDefaultName(providerId client.ProviderID, region string) string {
 	return strings.ToLower(providerId.String() + compressedRegion)
 }
 
-func CreateInDirectory(workingDirectory string, params Parameters) (string, error) {
+// CreateInDirectory creates a new stack file, after validating the parameters
+// against the given x-defang-stack-schema (which may be nil).
+func CreateInDirectory(workingDirectory string, params Parameters, schema Schema) (string, error) {
 	if params.Name == "" {
 		return "", errors.New("stack name cannot be empty")
 	}
@@ -103,6 +118,15 @@ func CreateInDirectory(workingDirectory string, params Parameters) (string, erro
 		return "", err
 	}
 
+	if params.Inherited == nil {
+		if err := params.inheritInDirectory(workingDirectory); err != nil {
+			return "", err
+		}
+	}
+	if err := schema.Validate(&params); err != nil {
+		return "", err
+	}
+
 	content, err := Marshal(&params)
 	if err != nil {
 		return "", err
@@ -141,6 +165,32 @@ func CreateInDirectory(workingDirectory string, params Parameters) (string, erro
 	return filename, nil
 }
 
+// WriteInDirectory creates or overwrites the stack file for the given parameters.
+func WriteInDirectory(workingDirectory string, params Parameters) (string, error) {
+	if err := ValidateStackName(params.Name); err != nil {
+		return "", err
+	}
+	if params.Inherited == nil {
+		if err := params.inheritInDirectory(workingDirectory); err != nil {
+			return "", err
+		}
+	}
+
+	content, err := Marshal(&params)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Join(workingDirectory, Directory), 0700); err != nil {
+		return "", err
+	}
+	filename := filename(workingDirectory, params.Name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
 func (p *Parameters) Account() string {
 	switch p.Provider {
 	case client.ProviderAWS:
@@ -181,14 +231,12 @@ func ListInDirectory(workingDirectory string) ([]ListItem, error) {
 
 	var stacks []ListItem
 	for _, file := range files {
-		filename := filename(workingDirectory, file.Name())
-		content, err := os.ReadFile(filename)
-		if err != nil {
-			term.Warnf("Skipping unreadable stack file %s: %v\n", filename, err)
+		// files like _base are only used as parents of other stacks
+		if file.IsDir() || strings.HasPrefix(file.Name(), "_") {
 			continue
 		}
-
-		params, err := NewParametersFromContent(file.Name(), content)
+		filename := filename(workingDirectory, file.Name())
+		params, err := ReadInDirectory(workingDirectory, file.Name())
 		if err != nil {
 			term.Warnf("Skipping invalid stack file %s: %v\n", filename, err)
 			continue
@@ -209,11 +257,34 @@ func parseContent(content string) (map[string]string, error) {
 	return godotenv.Parse(strings.NewReader(content))
 }
 
+// Marshal returns the stack file content for the given parameters. Variables
+// inherited unchanged from a parent stack are omitted and the EXTENDS key is
+// kept, so editing a stack preserves its overlay structure.
 func Marshal(params *Parameters) (string, error) {
 	if params == nil {
 		return "", nil
 	}
-	return godotenv.Marshal(params.ToMap()) // TODO: should append LF at EOF
+	content, err := godotenv.Marshal(params.overlay()) // TODO: should append LF at EOF
+	if err != nil || params.Extends == "" {
+		return content, err
+	}
+	extends, err := godotenv.Marshal(map[string]string{ExtendsKey: params.Extends})
+	if err != nil {
+		return "", err
+	}
+	if content == "" {
+		return extends, nil
+	}
+	return extends + "\n" + content, nil
+}
+
+// MarshalResolved returns the effective stack file content, with all inherited
+// variables inlined, for readers that don't have access to the parent files.
+func MarshalResolved(params *Parameters) (string, error) {
+	if params == nil {
+		return "", nil
+	}
+	return godotenv.Marshal(params.ToMap())
 }
 
 func RemoveInDirectory(workingDirectory, name string) error {
@@ -229,12 +300,11 @@ func RemoveInDirectory(workingDirectory, name string) error {
 }
 
 func ReadInDirectory(workingDirectory, name string) (*Parameters, error) {
-	path := filename(workingDirectory, name)
-	content, err := os.ReadFile(path)
+	layers, err := readLayers(workingDirectory, name)
 	if err != nil {
 		return nil, err
 	}
-	return NewParametersFromContent(name, content)
+	return newParametersFromLayers(layers)
 }
 
 // This was basically ripped out of godotenv.Overload/Load. Unfortunately, they don't export
@@ -265,6 +335,43 @@ func LoadStackEnv(params Parameters, overload bool) error {
 	return nil
 }
 
+// envMu serializes WithStackEnv, because the environment is shared by the process.
+var envMu sync.Mutex
+
+// WithStackEnv runs fn with the stack variables set in the process environment
+// and restores the previous environment afterwards, including any changes made
+// by fn, so the variables of one stack can't leak into work done for another.
+func WithStackEnv(params *Parameters, fn func() error) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	defer restoreEnv(os.Environ())
+	if err := LoadStackEnv(*params, true); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func restoreEnv(saved []string) {
+	want := make(map[string]string, len(saved))
+	for _, kv := range saved {
+		if key, value, found := strings.Cut(kv, "="); found && key != "" {
+			want[key] = value
+		}
+	}
+	for _, kv := range os.Environ() {
+		if key, _, found := strings.Cut(kv, "="); found && key != "" {
+			if _, ok := want[key]; !ok {
+				os.Unsetenv(key)
+			}
+		}
+	}
+	for key, value := range want {
+		if current, ok := os.LookupEnv(key); !ok || current != value {
+			os.Setenv(key, value)
+		}
+	}
+}
+
 func filename(workingDirectory, stackname string) string {
 	return filepath.Join(workingDirectory, Directory, stackname)
 }
@@ -99,7 +99,7 @@ func TestCreate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Chdir(t.TempDir())
-			filename, err := CreateInDirectory(".", tt.parameters)
+			filename, err := CreateInDirectory(".", tt.parameters, nil)
 			if (err != nil) != tt.expectErr {
 				t.Errorf("CreateInDirectory() error = %v, expectErr %v", err, tt.expectErr)
 			}
@@ -127,12 +127,12 @@ func TestRepeatCreate(t *testing.T) {
 		Recipe:   modes.RecipeBalanced,
 	}
 
-	_, err := CreateInDirectory(".", params)
+	_, err := CreateInDirectory(".", params, nil)
 	if err != nil {
 		t.Errorf("First CreateInDirectory() error = %v", err)
 	}
 
-	_, err = CreateInDirectory(".", params)
+	_, err = CreateInDirectory(".", params, nil)
 	if err == nil {
 		t.Errorf("Expected error on duplicate CreateInDirectory(), got nil")
 	} else {
@@ -184,7 +184,7 @@ func TestRemove(t *testing.T) {
 			Region:   "us-west-2",
 			Recipe:   modes.RecipeAffordable,
 		}
-		stackFile, err := CreateInDirectory(".", params)
+		stackFile, err := CreateInDirectory(".", params, nil)
 		if err != nil {
 			t.Errorf("Setup CreateInDirectory() error = %v", err)
 		}
@@ -346,7 +346,7 @@ func TestReadInDirectory(t *testing.T) {
 			Region:   "us-west-2",
 			Recipe:   modes.RecipeAffordable,
 		}
-		_, err := CreateInDirectory(".", expectedParams)
+		_, err := CreateInDirectory(".", expectedParams, nil)
 		if err != nil {
 			t.Errorf("Setup CreateInDirectory() error = %v", err)
 		}
@@ -476,3 +476,29 @@ func TestParamsFromMap(t *testing.T) {
 		})
 	}
 }
+
+func TestWithStackEnv(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("STACK_ONLY_VAR", "") // restored by t.Cleanup
+	os.Unsetenv("STACK_ONLY_VAR")
+
+	stack := Parameters{
+		Name:      "beta",
+		Provider:  client.ProviderAWS,
+		Region:    "eu-west-1",
+		Variables: map[string]string{"STACK_ONLY_VAR": "beta"},
+	}
+	err := WithStackEnv(&stack, func() error {
+		assert.Equal(t, "eu-west-1", os.Getenv("AWS_REGION"))
+		assert.Equal(t, "beta", os.Getenv("STACK_ONLY_VAR"))
+		os.Setenv("SET_BY_FN", "1")
+		return errors.New("fn failed")
+	})
+	assert.EqualError(t, err, "fn failed")
+
+	assert.Equal(t, "us-east-1", os.Getenv("AWS_REGION"))
+	_, ok := os.LookupEnv("STACK_ONLY_VAR")
+	assert.False(t, ok, "stack variable leaked")
+	_, ok = os.LookupEnv("SET_BY_FN")
+	assert.False(t, ok, "variable set by fn leaked")
+}
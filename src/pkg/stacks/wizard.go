@@ -28,6 +28,7 @@ type Wizard struct {
 	ec            elicitations.Controller
 	recipeLister  RecipeLister
 	profileLister AWSProfileLister
+	schema        Schema
 }
 
 func NewWizard(ec elicitations.Controller, recipeLister RecipeLister) *Wizard {
@@ -46,6 +47,13 @@ func NewWizardWithProfileLister(ec elicitations.Controller, recipeLister RecipeL
 	}
 }
 
+// WithSchema makes the wizard prompt for, and validate, the variables declared
+// in the x-defang-stack-schema of the Compose project.
+func (w *Wizard) WithSchema(schema Schema) *Wizard {
+	w.schema = schema
+	return w
+}
+
 func (w *Wizard) CollectParameters(ctx context.Context) (*Parameters, error) {
 	return w.CollectRemainingParameters(ctx, &Parameters{})
 }
@@ -180,6 +188,13 @@ func (w *Wizard) CollectRemainingParameters(ctx context.Context, params *Paramet
 		}
 	}
 
+	if err := w.schema.CollectMissing(ctx, w.ec, params); err != nil {
+		return nil, err
+	}
+	if err := w.schema.Validate(params); err != nil {
+		return nil, err
+	}
+
 	return params, nil
 }
 
@@ -0,0 +1,186 @@
+package tokenstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DefangLabs/defang/src/pkg/term"
+)
+
+var ErrKeyringUnavailable = errors.New("OS keyring is not available")
+
+var ErrKeyringNotFound = errors.New("key not found in OS keyring")
+
+// keyring is the credential store of the operating system: the Secret Service
+// (libsecret) on Linux, the Keychain on macOS and the Credential Manager on
+// Windows. Items are identified by a service name and a key.
+type keyring interface {
+	Set(service, key, secret string) error
+	Get(service, key string) (string, error)
+	Delete(service, key string) error
+	List(service string) ([]string, error)
+}
+
+// KeyringTokenStore saves tokens in the OS keyring. It falls back to the
+// Fallback store when the keyring is not available, like on a headless Linux
+// host without a Secret Service, and moves a token from the Fallback store into
+// the keyring when it is loaded.
+type KeyringTokenStore struct {
+	Service  string
+	Fallback TokenStore // optional
+	keyring  keyring
+}
+
+func NewKeyringTokenStore(service string, fallback TokenStore) *KeyringTokenStore {
+	return &KeyringTokenStore{Service: service, Fallback: fallback, keyring: newOSKeyring()}
+}
+
+func (s *KeyringTokenStore) Save(key string, token string) error {
+	if key == "" {
+		return errors.New("token store key is empty")
+	}
+	err := s.keyring.Set(s.Service, key, token)
+	if err == nil {
+		if s.Fallback != nil {
+			s.Fallback.Delete(key) // don't leave an older copy behind
+		}
+		return nil
+	}
+	if s.Fallback == nil || !errors.Is(err, ErrKeyringUnavailable) {
+		return fmt.Errorf("failed to save token in OS keyring: %w", err)
+	}
+	term.Debug("Saving token in fallback store:", err)
+	return s.Fallback.Save(key, token)
+}
+
+func (s *KeyringTokenStore) Load(key string) (string, error) {
+	token, err := s.keyring.Get(s.Service, key)
+	if err == nil {
+		return token, nil
+	}
+	if s.Fallback == nil || !(errors.Is(err, ErrKeyringNotFound) || errors.Is(err, ErrKeyringUnavailable)) {
+		return "", fmt.Errorf("failed to read token from OS keyring: %w", err)
+	}
+
+	token, fallbackErr := s.Fallback.Load(key)
+	if fallbackErr != nil {
+		return "", fallbackErr
+	}
+	if errors.Is(err, ErrKeyringNotFound) {
+		// One-time migration of a token saved before the keyring was used
+		if err := s.keyring.Set(s.Service, key, token); err != nil {
+			term.Debugf("Failed to move token %q to OS keyring: %v", key, err)
+		} else if err := s.Fallback.Delete(key); err != nil {
+			term.Debugf("Failed to delete token %q after moving it to OS keyring: %v", key, err)
+		} else {
+			term.Debugf("Moved token %q to OS keyring", key)
+		}
+	}
+	return token, nil
+}
+
+func (s *KeyringTokenStore) List(prefix string) ([]string, error) {
+	keys, err := s.keyring.List(s.Service)
+	if err != nil {
+		if s.Fallback == nil || !errors.Is(err, ErrKeyringUnavailable) {
+			return nil, fmt.Errorf("failed to list tokens in OS keyring: %w", err)
+		}
+		term.Debug("Listing tokens in fallback store only:", err)
+	}
+	keys = slices.DeleteFunc(keys, func(key string) bool {
+		return !strings.HasPrefix(key, prefix)
+	})
+	if s.Fallback != nil {
+		fallbackKeys, err := s.Fallback.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fallbackKeys...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+func (s *KeyringTokenStore) Delete(key string) error {
+	if err := s.keyring.Delete(s.Service, key); err != nil && !errors.Is(err, ErrKeyringNotFound) && !errors.Is(err, ErrKeyringUnavailable) {
+		return fmt.Errorf("failed to delete token from OS keyring: %w", err)
+	}
+	if s.Fallback != nil {
+		return s.Fallback.Delete(key)
+	}
+	return nil
+}
+
+// New returns the TokenStore selected by DEFANG_TOKEN_STORE: "file" (the
+// default) for files in dir, "memory" for tokens that are gone when the CLI
+// exits, or "keyring" for the OS keyring, with the files in dir as the
+// fallback. Switching to the keyring moves each saved token into it when the
+// token is next used.
+func New(service, dir string) TokenStore {
+	files := &LocalDirTokenStore{Dir: dir}
+	switch store := os.Getenv("DEFANG_TOKEN_STORE"); store {
+	case "", "file":
+		return files
+	case "memory":
+		return NewMemTokenStore()
+	case "keyring":
+		return NewKeyringTokenStore(service, files)
+	default:
+		term.Warnf("Unknown DEFANG_TOKEN_STORE %q; expected one of file, keyring, or memory", store)
+		return files
+	}
+}
+
+// memKeyring is an in-memory keyring, for tests and the fakekeyring build.
+type memKeyring struct {
+	mu    sync.Mutex
+	items map[string]map[string]string
+}
+
+func newMemKeyring() *memKeyring {
+	return &memKeyring{items: map[string]map[string]string{}}
+}
+
+func (k *memKeyring) Set(service, key, secret string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.items[service] == nil {
+		k.items[service] = map[string]string{}
+	}
+	k.items[service][key] = secret
+	return nil
+}
+
+func (k *memKeyring) Get(service, key string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	secret, ok := k.items[service][key]
+	if !ok {
+		return "", ErrKeyringNotFound
+	}
+	return secret, nil
+}
+
+func (k *memKeyring) Delete(service, key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.items[service][key]; !ok {
+		return ErrKeyringNotFound
+	}
+	delete(k.items[service], key)
+	return nil
+}
+
+func (k *memKeyring) List(service string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var keys []string
+	for key := range k.items[service] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,94 @@
+//go:build darwin && !fakekeyring
+
+package tokenstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychain uses the macOS Keychain through the security command. Secrets are
+// written with `security -i`, so they don't show up in the process list.
+type keychain struct {
+	run commandRunner
+}
+
+func newOSKeyring() keyring {
+	return keychain{run: runCommand}
+}
+
+const errSecItemNotFound = 44 // the exit code of security when the item doesn't exist
+
+func (keychain) keyringError(err error, stderr []byte) error {
+	if errors.Is(err, ErrKeyringUnavailable) {
+		return err
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return ErrKeyringNotFound
+	}
+	return fmt.Errorf("%w: %v: %s", ErrKeyringUnavailable, err, strings.TrimSpace(string(stderr)))
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (k keychain) Set(service, key, secret string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -X %s\n", quote(service), quote(key), quote("Defang "+service), hex.EncodeToString([]byte(secret)))
+	_, stderr, err := k.run(command, "security", "-i")
+	if err != nil {
+		return k.keyringError(err, stderr)
+	}
+	return nil
+}
+
+func (k keychain) Get(service, key string) (string, error) {
+	stdout, stderr, err := k.run("", "security", "find-generic-password", "-s", service, "-a", key, "-w")
+	if err != nil {
+		return "", k.keyringError(err, stderr)
+	}
+	return strings.TrimSuffix(string(stdout), "\n"), nil
+}
+
+func (k keychain) Delete(service, key string) error {
+	_, stderr, err := k.run("", "security", "delete-generic-password", "-s", service, "-a", key)
+	if err != nil {
+		return k.keyringError(err, stderr)
+	}
+	return nil
+}
+
+// List parses the attributes of `security dump-keychain`, which doesn't print the secrets.
+func (k keychain) List(service string) ([]string, error) {
+	stdout, stderr, err := k.run("", "security", "dump-keychain")
+	if err != nil {
+		return nil, k.keyringError(err, stderr)
+	}
+	var keys []string
+	var account, svce string
+	flush := func() {
+		if svce == service && account != "" {
+			keys = append(keys, account)
+		}
+		account, svce = "", ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "keychain:") {
+			flush()
+		} else if value, ok := strings.CutPrefix(line, `"acct"<blob>=`); ok {
+			account = strings.Trim(value, `"`)
+		} else if value, ok := strings.CutPrefix(line, `"svce"<blob>=`); ok {
+			svce = strings.Trim(value, `"`)
+		}
+	}
+	flush()
+	return keys, scanner.Err()
+}
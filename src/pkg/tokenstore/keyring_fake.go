@@ -0,0 +1,9 @@
+//go:build fakekeyring
+
+package tokenstore
+
+// Build with -tags=fakekeyring to use an in-memory keyring instead of the OS
+// keyring, so tests and CI runs of the CLI don't touch the real credentials.
+func newOSKeyring() keyring {
+	return newMemKeyring()
+}
@@ -0,0 +1,80 @@
+//go:build linux && !fakekeyring
+
+package tokenstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretTool uses the Secret Service API through secret-tool, the command-line
+// tool of libsecret. The secret is passed on standard input.
+type secretTool struct {
+	run commandRunner
+}
+
+func newOSKeyring() keyring {
+	return secretTool{run: runCommand}
+}
+
+// keyringError returns ErrKeyringNotFound if secret-tool exited without a
+// message, which it does when nothing matches, or else ErrKeyringUnavailable.
+func (secretTool) keyringError(err error, stderr []byte) error {
+	if errors.Is(err, ErrKeyringUnavailable) {
+		return err
+	}
+	message := strings.TrimSpace(string(stderr))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && message == "" {
+		return ErrKeyringNotFound
+	}
+	return fmt.Errorf("%w: %v: %s", ErrKeyringUnavailable, err, message)
+}
+
+func (k secretTool) Set(service, key, secret string) error {
+	_, stderr, err := k.run(secret, "secret-tool", "store", "--label=Defang "+service+" "+key, "service", service, "account", key)
+	if err != nil {
+		if err := k.keyringError(err, stderr); !errors.Is(err, ErrKeyringNotFound) {
+			return err
+		}
+		return fmt.Errorf("%w: secret-tool store failed", ErrKeyringUnavailable)
+	}
+	return nil
+}
+
+func (k secretTool) Get(service, key string) (string, error) {
+	stdout, stderr, err := k.run("", "secret-tool", "lookup", "service", service, "account", key)
+	if err != nil {
+		return "", k.keyringError(err, stderr)
+	}
+	return strings.TrimSuffix(string(stdout), "\n"), nil // secret-tool adds a newline on a terminal
+}
+
+func (k secretTool) Delete(service, key string) error {
+	_, stderr, err := k.run("", "secret-tool", "clear", "service", service, "account", key)
+	if err != nil {
+		return k.keyringError(err, stderr)
+	}
+	return nil
+}
+
+func (k secretTool) List(service string) ([]string, error) {
+	stdout, stderr, err := k.run("", "secret-tool", "search", "--all", "service", service)
+	if err != nil {
+		if err := k.keyringError(err, stderr); !errors.Is(err, ErrKeyringNotFound) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Some versions print the attributes to stderr and the secrets to stdout
+	var keys []string
+	for line := range bytes.Lines(append(stdout, stderr...)) {
+		if key, ok := strings.CutPrefix(strings.TrimSpace(string(line)), "attribute.account = "); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,80 @@
+//go:build linux && !fakekeyring
+
+package tokenstore
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeSecretTool stands in for secret-tool, keeping the items in a map.
+func fakeSecretTool(items map[string]string) commandRunner {
+	notFound := exec.Command("false").Run() // an *exec.ExitError without a message
+	return func(stdin string, name string, args ...string) ([]byte, []byte, error) {
+		attrs := strings.Join(args[len(args)-4:], " ")
+		switch args[0] {
+		case "store":
+			items[attrs] = stdin
+		case "lookup":
+			secret, ok := items[attrs]
+			if !ok {
+				return nil, nil, notFound
+			}
+			return []byte(secret), nil, nil
+		case "clear":
+			delete(items, attrs)
+		case "search":
+			var stdout strings.Builder
+			for attrs, secret := range items {
+				service, account, _ := strings.Cut(strings.TrimPrefix(attrs, "service "), " account ")
+				if service == args[len(args)-1] {
+					stdout.WriteString("[/org/freedesktop/secrets/collection/login/1]\nlabel = Defang\nsecret = " + secret + "\nattribute.service = " + service + "\nattribute.account = " + account + "\n")
+				}
+			}
+			if stdout.Len() == 0 {
+				return nil, nil, notFound
+			}
+			return []byte(stdout.String()), nil, nil
+		}
+		return nil, nil, nil
+	}
+}
+
+func TestSecretTool(t *testing.T) {
+	items := map[string]string{}
+	k := secretTool{run: fakeSecretTool(items)}
+
+	if keys, err := k.List("defang"); err != nil || len(keys) != 0 {
+		t.Errorf("List = %v, %v; want nothing", keys, err)
+	}
+	if _, err := k.Get("defang", "k"); !errors.Is(err, ErrKeyringNotFound) {
+		t.Errorf("Get = %v, want %v", err, ErrKeyringNotFound)
+	}
+	if err := k.Set("defang", "k", "v"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := k.Get("defang", "k"); err != nil || got != "v" {
+		t.Errorf("Get = %q, %v; want %q", got, err, "v")
+	}
+	if keys, err := k.List("defang"); err != nil || !slices.Equal(keys, []string{"k"}) {
+		t.Errorf("List = %v, %v; want [k]", keys, err)
+	}
+	if err := k.Delete("defang", "k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	t.Run("unavailable", func(t *testing.T) {
+		k := secretTool{run: func(stdin string, name string, args ...string) ([]byte, []byte, error) {
+			return nil, []byte("Cannot autolaunch D-Bus without X11 $DISPLAY"), exec.Command("false").Run()
+		}}
+		if _, err := k.Get("defang", "k"); !errors.Is(err, ErrKeyringUnavailable) {
+			t.Errorf("Get = %v, want %v", err, ErrKeyringUnavailable)
+		}
+		if err := k.Set("defang", "k", "v"); !errors.Is(err, ErrKeyringUnavailable) {
+			t.Errorf("Set = %v, want %v", err, ErrKeyringUnavailable)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+//go:build !darwin && !linux && !windows && !fakekeyring
+
+package tokenstore
+
+// unavailableKeyring is used on platforms without a supported keyring, so
+// KeyringTokenStore always uses its fallback store.
+type unavailableKeyring struct{}
+
+func newOSKeyring() keyring {
+	return unavailableKeyring{}
+}
+
+func (unavailableKeyring) Set(service, key, secret string) error {
+	return ErrKeyringUnavailable
+}
+
+func (unavailableKeyring) Get(service, key string) (string, error) {
+	return "", ErrKeyringUnavailable
+}
+
+func (unavailableKeyring) Delete(service, key string) error {
+	return ErrKeyringUnavailable
+}
+
+func (unavailableKeyring) List(service string) ([]string, error) {
+	return nil, ErrKeyringUnavailable
+}
@@ -0,0 +1,118 @@
+package tokenstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type unavailable struct{}
+
+func (unavailable) Set(service, key, secret string) error   { return ErrKeyringUnavailable }
+func (unavailable) Get(service, key string) (string, error) { return "", ErrKeyringUnavailable }
+func (unavailable) Delete(service, key string) error        { return ErrKeyringUnavailable }
+func (unavailable) List(service string) ([]string, error)   { return nil, ErrKeyringUnavailable }
+
+func TestKeyringTokenStore(t *testing.T) {
+	files := &LocalDirTokenStore{Dir: t.TempDir()}
+	kr := newMemKeyring()
+	s := &KeyringTokenStore{Service: "defang", Fallback: files, keyring: kr}
+
+	if err := s.Save("fabric-prod1.defang.dev", "secret"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, _ := kr.Get("defang", "fabric-prod1.defang.dev"); got != "secret" {
+		t.Errorf("keyring has %q, want %q", got, "secret")
+	}
+	if keys, _ := files.List(""); len(keys) != 0 {
+		t.Errorf("fallback has %v, want nothing", keys)
+	}
+	if got, err := s.Load("fabric-prod1.defang.dev"); err != nil || got != "secret" {
+		t.Errorf("Load = %q, %v; want %q", got, err, "secret")
+	}
+	if err := s.Delete("fabric-prod1.defang.dev"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Load("fabric-prod1.defang.dev"); err == nil {
+		t.Error("Load after Delete: expected error, got nil")
+	}
+}
+
+func TestKeyringTokenStore_Migration(t *testing.T) {
+	files := &LocalDirTokenStore{Dir: t.TempDir()}
+	if err := files.Save("aws-oauth-old", "from-file"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	kr := newMemKeyring()
+	kr.Set("defang-aws", "aws-oauth-new", "from-keyring")
+	kr.Set("defang-gcp", "aws-oauth-other", "other service")
+	s := &KeyringTokenStore{Service: "defang-aws", Fallback: files, keyring: kr}
+
+	keys, err := s.List("aws-oauth-")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []string{"aws-oauth-new", "aws-oauth-old"}; !slices.Equal(keys, want) {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+
+	if got, err := s.Load("aws-oauth-old"); err != nil || got != "from-file" {
+		t.Fatalf("Load = %q, %v; want %q", got, err, "from-file")
+	}
+	if got, _ := kr.Get("defang-aws", "aws-oauth-old"); got != "from-file" {
+		t.Errorf("token was not moved to the keyring")
+	}
+	if _, err := files.Load("aws-oauth-old"); err == nil {
+		t.Errorf("token file was not deleted after the move")
+	}
+}
+
+func TestKeyringTokenStore_Unavailable(t *testing.T) {
+	files := &LocalDirTokenStore{Dir: t.TempDir()}
+	s := &KeyringTokenStore{Service: "defang", Fallback: files, keyring: unavailable{}}
+
+	if err := s.Save("k", "v"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, err := files.Load("k"); err != nil || got != "v" {
+		t.Errorf("fallback Load = %q, %v; want %q", got, err, "v")
+	}
+	if got, err := s.Load("k"); err != nil || got != "v" {
+		t.Errorf("Load = %q, %v; want %q", got, err, "v")
+	}
+	if keys, err := s.List(""); err != nil || !slices.Equal(keys, []string{"k"}) {
+		t.Errorf("List = %v, %v; want [k]", keys, err)
+	}
+	if err := s.Delete("k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	t.Run("no fallback", func(t *testing.T) {
+		s := &KeyringTokenStore{Service: "defang", keyring: unavailable{}}
+		if err := s.Save("k", "v"); !errors.Is(err, ErrKeyringUnavailable) {
+			t.Errorf("Save = %v, want %v", err, ErrKeyringUnavailable)
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "*tokenstore.LocalDirTokenStore"},
+		{"keyring", "*tokenstore.KeyringTokenStore"},
+		{"file", "*tokenstore.LocalDirTokenStore"},
+		{"memory", "*tokenstore.MemTokenStore"},
+		{"bogus", "*tokenstore.LocalDirTokenStore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("DEFANG_TOKEN_STORE", tt.env)
+			if got := fmt.Sprintf("%T", New("defang", t.TempDir())); got != tt.want {
+				t.Errorf("New = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+//go:build (darwin || linux) && !fakekeyring
+
+package tokenstore
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// commandRunner runs a command with the given standard input.
+type commandRunner func(stdin string, name string, args ...string) (stdout []byte, stderr []byte, err error)
+
+func runCommand(stdin string, name string, args ...string) ([]byte, []byte, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
@@ -0,0 +1,154 @@
+//go:build windows && !fakekeyring
+
+package tokenstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW     = advapi32.NewProc("CredWriteW")
+	procCredReadW      = advapi32.NewProc("CredReadW")
+	procCredDeleteW    = advapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = advapi32.NewProc("CredEnumerateW")
+	procCredFree       = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	credMaxBlobSize         = 5 * 512
+
+	errorNotFound syscall.Errno = 1168
+)
+
+// credential is the CREDENTIALW struct of wincred.h.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialManager uses the Windows Credential Manager; the generic
+// credentials are named "<service>:<key>".
+type credentialManager struct{}
+
+func newOSKeyring() keyring {
+	return credentialManager{}
+}
+
+func targetName(service, key string) string {
+	return service + ":" + key
+}
+
+func credError(err error) error {
+	if errors.Is(err, errorNotFound) {
+		return ErrKeyringNotFound
+	}
+	return fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+}
+
+func (credentialManager) Set(service, key, secret string) error {
+	if len(secret) > credMaxBlobSize {
+		return fmt.Errorf("%w: the token is larger than %d bytes", ErrKeyringUnavailable, credMaxBlobSize)
+	}
+	target, err := syscall.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(key)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		UserName:           user,
+		Persist:            credPersistLocalMachine,
+		CredentialBlobSize: uint32(len(secret)),
+	}
+	if len(secret) > 0 {
+		blob := []byte(secret)
+		cred.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return credError(err)
+	}
+	return nil
+}
+
+func (credentialManager) Get(service, key string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		return "", credError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (credentialManager) Delete(service, key string) error {
+	target, err := syscall.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ret == 0 {
+		return credError(err)
+	}
+	return nil
+}
+
+func (credentialManager) List(service string) ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(targetName(service, "*"))
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	var creds **credential
+	if ret, _, err := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds))); ret == 0 {
+		if err := credError(err); errors.Is(err, ErrKeyringNotFound) {
+			return nil, nil
+		} else {
+			return nil, err
+		}
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+	var keys []string
+	for _, cred := range unsafe.Slice(creds, count) {
+		if key, ok := strings.CutPrefix(utf16PtrToString(cred.TargetName), targetName(service, "")); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, unsafe.Sizeof(*p))
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
@@ -18,8 +18,8 @@ type TokenStore interface {
 	Delete(key string) error
 }
 
-// Backwards-compatible token store that saves tokens as files in stateDir
-// TODO: consider using os provided keyring
+// Backwards-compatible token store that saves tokens as files in stateDir;
+// also the fallback of KeyringTokenStore
 type LocalDirTokenStore struct {
 	mu  sync.RWMutex
 	Dir string